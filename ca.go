@@ -0,0 +1,326 @@
+package codechallenge
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/misc"
+	"github.com/smartedge/codechallenge/pki"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCACommonName is the common name of the subject of the certificate
+// of a local CA, if no subject is given.
+const DefaultCACommonName = "codechallenge CA"
+
+// Files of a local CA, relative to its directory. The serial and crlnumber
+// files hold the next serial number and CRL number in hex, and the index
+// records every certificate issued, as in OpenSSL's ca command. Issued
+// certificates are kept in the certs directory, named by serial number.
+const (
+	CAPrivateKeyFile  = "ca.priv"
+	CAPublicKeyFile   = "ca.pub"
+	CACertificateFile = "ca.crt"
+	CASerialFile      = "serial"
+	CAIndexFile       = "index.txt"
+	CACRLNumberFile   = "crlnumber"
+	CACRLFile         = "crl.pem"
+	CACertsDir        = "certs"
+)
+
+// CASettings describes the directory of a local CA, and how long the CRLs it
+// generates are valid for.
+type CASettings struct {
+	Dir         string
+	CRLValidity time.Duration
+}
+
+// localCA is a local CA loaded from its directory.
+type localCA struct {
+	Dir         string
+	Certificate *x509.Certificate
+	Crypt       *crypt.CryptoTooling
+}
+
+// path returns the path of name in the directory of the CA.
+func (ca *localCA) path(name string) string {
+	return filepath.Join(ca.Dir, name)
+}
+
+// caKeySettings returns settings for the key-pair of the CA in dir, with the
+// algorithm and key parameters of settings.
+func caKeySettings(settings crypt.PkiSettings, dir string) *crypt.PkiSettings {
+	settings.PrivateKeyPath = filepath.Join(dir, CAPrivateKeyFile)
+	settings.PublicKeyPath = filepath.Join(dir, CAPublicKeyFile)
+	return &settings
+}
+
+// loadCA loads the certificate and key-pair of the local CA in config, which
+// must have been initialized.
+func loadCA(d *deps.Dependencies, config *RunConfig) (*localCA, error) {
+	result := &localCA{Dir: config.CA.Dir}
+	if !misc.FileExists(d, result.path(CACertificateFile)) {
+		return nil, fmt.Errorf("No CA in %s: run %s first", result.Dir, CAInitCommand)
+	}
+	cert, err := loadCertificate(d, result.path(CACertificateFile))
+	if err != nil {
+		return nil, err
+	}
+	result.Certificate = cert
+	if !misc.FileExists(d, result.path(CAPrivateKeyFile)) {
+		return nil, fmt.Errorf("The key of the CA is missing from %s", result.Dir)
+	}
+	settings := caKeySettings(config.PubKeySettings, result.Dir)
+	settings.Algorithm = cert.PublicKeyAlgorithm
+	result.Crypt, err = crypt.GetCryptoTooling(d, settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.Crypt.PopulateKeys(); err != nil {
+		return nil, err
+	}
+	if !pki.Certifies(cert, result.Crypt.Signer.Public()) {
+		return nil, fmt.Errorf("Certificate in %s is not of the key of the CA", result.path(CACertificateFile))
+	}
+	return result, nil
+}
+
+// readSerialNumber reads the hex number in the file name of the CA.
+func (ca *localCA) readSerialNumber(d *deps.Dependencies, name string) (*big.Int, error) {
+	buff, err := d.Io.Ioutil.ReadFile(ca.path(name))
+	if err != nil {
+		return nil, err
+	}
+	result, err := pki.ParseSerialNumber(string(buff))
+	if err != nil {
+		return nil, fmt.Errorf("File %s: %s", ca.path(name), err.Error())
+	}
+	return result, nil
+}
+
+// writeFile writes buff to the file name of the CA, creating its directory
+// if necessary.
+func (ca *localCA) writeFile(d *deps.Dependencies, name string, buff []byte) error {
+	return misc.WriteDirAndFile(d, ca.path(name), buff, 0644, 0700)
+}
+
+// writeSerialNumber writes number in hex to the file name of the CA.
+func (ca *localCA) writeSerialNumber(d *deps.Dependencies, name string, number *big.Int) error {
+	return ca.writeFile(d, name, []byte(pki.FormatSerialNumber(number)+"\n"))
+}
+
+// readIndex reads the index of the certificates the CA has issued.
+func (ca *localCA) readIndex(d *deps.Dependencies) ([]pki.IndexEntry, error) {
+	buff, err := d.Io.Ioutil.ReadFile(ca.path(CAIndexFile))
+	if err != nil {
+		return nil, err
+	}
+	return pki.ParseIndex(buff)
+}
+
+// CAInitMain is the entry-point for the ca init command. It creates a local
+// CA in the CA directory: a key-pair, a self-signed CA certificate with the
+// profile in config, and empty serial number and CRL number databases and
+// index. It writes the PEM certificate of the CA to d.Os.Stdout.
+func CAInitMain(d *deps.Dependencies, config *RunConfig) {
+	ca := &localCA{Dir: config.CA.Dir}
+	if misc.FileExists(d, ca.path(CACertificateFile)) {
+		HandleError(d, fmt.Errorf("A CA already exists in %s", ca.Dir), 4)
+	}
+	var err error
+	ca.Crypt, err = crypt.GetCryptoTooling(d, caKeySettings(config.PubKeySettings, ca.Dir))
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = ca.Crypt.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	cert, err := pki.SelfSign(ca.Crypt.Signer, d.Crypto.Rand.Reader, &config.Certificate, d.Time.Now())
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	err = cert.CheckSignatureFrom(cert)
+	if err != nil {
+		HandleError(d, fmt.Errorf("round trip verification of CA certificate failed: %s", err.Error()), 7)
+	}
+	for name, buff := range map[string][]byte{
+		CASerialFile:    []byte("01\n"),
+		CACRLNumberFile: []byte("01\n"),
+		CAIndexFile:     {},
+	} {
+		if err := ca.writeFile(d, name, buff); err != nil {
+			HandleError(d, err, 8)
+		}
+	}
+	// The certificate is written last, as it marks the CA as initialized:
+	err = ca.writeFile(d, CACertificateFile, pki.EncodePEM(cert))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	err = WriteOutput(d, pki.EncodePEM(cert))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// CAIssueMain is the entry-point for the ca issue command. It reads a PEM or
+// DER certificate signing request from d.Os.Stdin, and writes a PEM
+// certificate issued for it by the local CA to d.Os.Stdout, with the subject
+// and subject alternative names of the request and otherwise the profile in
+// config. The extensions the request asks for are ignored. The certificate is
+// added to the index, and kept in the certs directory of the CA.
+func CAIssueMain(d *deps.Dependencies, config *RunConfig) {
+	ca, err := loadCA(d, config)
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	request, err := pki.ParseRequest(buff)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	serialNumber, err := ca.readSerialNumber(d, CASerialFile)
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	index, err := ca.readIndex(d)
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	cert, err := pki.Issue(ca.Certificate, ca.Crypt.Signer, d.Crypto.Rand.Reader, request, &config.Certificate, serialNumber, d.Time.Now())
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	err = cert.CheckSignatureFrom(ca.Certificate)
+	if err != nil {
+		HandleError(d, fmt.Errorf("round trip verification of certificate failed: %s", err.Error()), 7)
+	}
+	err = ca.writeFile(d, filepath.Join(CACertsDir, pki.FormatSerialNumber(serialNumber)+".pem"), pki.EncodePEM(cert))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	index = append(index, pki.IndexEntry{
+		Status:       pki.StatusValid,
+		NotAfter:     cert.NotAfter,
+		SerialNumber: serialNumber,
+		Subject:      cert.Subject.String(),
+	})
+	err = ca.writeFile(d, CAIndexFile, pki.FormatIndex(index))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	err = ca.writeSerialNumber(d, CASerialFile, new(big.Int).Add(serialNumber, big.NewInt(1)))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	err = WriteOutput(d, pki.EncodePEM(cert))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// CARevokeMain is the entry-point for the ca revoke command. It marks the
+// certificate of the local CA with the serial number in hex given by the path
+// in config as revoked in the index, as of now. It is listed by the CRLs the
+// CA generates from then on.
+func CARevokeMain(d *deps.Dependencies, config *RunConfig) {
+	ca, err := loadCA(d, config)
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	serialNumber, err := pki.ParseSerialNumber(config.Paths[0])
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	index, err := ca.readIndex(d)
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	found := false
+	for i := range index {
+		if index[i].SerialNumber.Cmp(serialNumber) != 0 {
+			continue
+		}
+		if index[i].Status == pki.StatusRevoked {
+			HandleError(d, fmt.Errorf("Certificate %s was already revoked", pki.FormatSerialNumber(serialNumber)), 2)
+		}
+		index[i].Status = pki.StatusRevoked
+		index[i].RevokedAt = d.Time.Now()
+		found = true
+	}
+	if !found {
+		HandleError(d, fmt.Errorf("Certificate %s was not issued by the CA in %s", pki.FormatSerialNumber(serialNumber), ca.Dir), 2)
+	}
+	err = ca.writeFile(d, CAIndexFile, pki.FormatIndex(index))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// CACRLMain is the entry-point for the ca crl command. It writes a PEM CRL of
+// the certificates the local CA has revoked to d.Os.Stdout, valid for the
+// period in config, and keeps it in the directory of the CA.
+func CACRLMain(d *deps.Dependencies, config *RunConfig) {
+	ca, err := loadCA(d, config)
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	if ca.Certificate.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		HandleError(d, errors.New("CA certificate may not be used to sign CRLs"), 5)
+	}
+	number, err := ca.readSerialNumber(d, CACRLNumberFile)
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	index, err := ca.readIndex(d)
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	der, err := pki.CreateCRL(ca.Certificate, ca.Crypt.Signer, d.Crypto.Rand.Reader, index, number, d.Time.Now(), config.CA.CRLValidity)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	crl, err := x509.ParseDERCRL(der)
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	err = ca.Certificate.CheckCRLSignature(crl)
+	if err != nil {
+		HandleError(d, fmt.Errorf("round trip verification of CRL failed: %s", err.Error()), 7)
+	}
+	err = ca.writeFile(d, CACRLFile, pki.EncodeCRLPEM(der))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	err = ca.writeSerialNumber(d, CACRLNumberFile, new(big.Int).Add(number, big.NewInt(1)))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	err = WriteOutput(d, pki.EncodeCRLPEM(der))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// parseCAOptions validates the CA directory option in cl into config.
+func parseCAOptions(config *RunConfig, cl *commandLine) error {
+	if *cl.caDir != "" {
+		if !isCACommand(config.Command) {
+			return errors.New("Option -ca-dir is only valid with the ca commands")
+		}
+		config.CA.Dir = *cl.caDir
+	}
+	return nil
+}
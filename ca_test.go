@@ -0,0 +1,121 @@
+package codechallenge_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/pki"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLocalCA verifies that a local CA issues certificates for CSRs within
+// its name constraints, records them in its databases, and lists those it
+// revokes in its CRLs.
+func TestLocalCA(t *testing.T) {
+	files := testtools.FakeFileSystem{}
+	caDir := "/home/anybody/.smartEdge/ca/"
+	checkFailure(t, runMain(t, &files, "", "ca", "crl"), 4, "No CA in /home/anybody/.smartEdge/ca: run ca init first")
+
+	initBundle := runMain(t, &files, "", "ca", "init", "-permitted-dns", "example.com")
+	if exitStatus := initBundle.GetExitStatus(); exitStatus != 0 {
+		t.Fatalf("Creating the CA failed with exit status %d:\n%s", exitStatus, initBundle.ErrBuf.String())
+	}
+	ca, err := pki.ParsePEM(initBundle.OutBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error parsing CA certificate:\n%s", initBundle.OutBuf.String())
+	}
+	if (ca.Subject.String() != "CN=codechallenge CA") || !ca.IsCA || (fmt.Sprint(ca.PermittedDNSDomains) != "[example.com]") {
+		t.Errorf("CA certificate of %s has IsCA %t and permitted DNS domains %v.", ca.Subject.String(), ca.IsCA, ca.PermittedDNSDomains)
+	}
+	if !ca.NotAfter.Equal(mocks.MockCurrentTime.Add(pki.DefaultCAValidity)) {
+		t.Errorf("CA certificate expires at %s.", ca.NotAfter)
+	}
+	for name, contents := range map[string]string{
+		codechallenge.CACertificateFile: initBundle.OutBuf.String(),
+		codechallenge.CASerialFile:      "01\n",
+		codechallenge.CACRLNumberFile:   "01\n",
+		codechallenge.CAIndexFile:       "",
+	} {
+		if (files[caDir+name] == nil) || (*files[caDir+name] != contents) {
+			t.Errorf("File %s should contain %#v.", name, contents)
+		}
+	}
+	checkFailure(t, runMain(t, &files, "", "ca", "init"), 4, "A CA already exists in /home/anybody/.smartEdge/ca")
+
+	csrBundle := runMain(t, &files, "", "csr", "-subject", "CN=signer", "-san", "signer.example.com")
+	if exitStatus := csrBundle.GetExitStatus(); exitStatus != 0 {
+		t.Fatalf("Creating the CSR failed with exit status %d:\n%s", exitStatus, csrBundle.ErrBuf.String())
+	}
+	issueBundle := runMain(t, &files, csrBundle.OutBuf.String(), "ca", "issue", "-days", "30", "-ext-key-usage", "codeSigning")
+	if exitStatus := issueBundle.GetExitStatus(); exitStatus != 0 {
+		t.Fatalf("Issuing the certificate failed with exit status %d:\n%s", exitStatus, issueBundle.ErrBuf.String())
+	}
+	cert, err := pki.ParsePEM(issueBundle.OutBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error parsing certificate:\n%s", issueBundle.OutBuf.String())
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("Certificate is not signed by the CA: %s", err.Error())
+	}
+	if (cert.Subject.String() != "CN=signer") || (fmt.Sprint(cert.DNSNames) != "[signer.example.com]") || (cert.SerialNumber.Int64() != 1) {
+		t.Errorf("Certificate of %s has DNS names %v and serial number %s.", cert.Subject.String(), cert.DNSNames, cert.SerialNumber)
+	}
+	if !cert.NotAfter.Equal(mocks.MockCurrentTime.Add(30*24*time.Hour)) || (fmt.Sprint(cert.ExtKeyUsage) != fmt.Sprint([]x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning})) {
+		t.Errorf("Certificate expires at %s, with extended key usages %v.", cert.NotAfter, cert.ExtKeyUsage)
+	}
+	for name, contents := range map[string]string{
+		"certs/01.pem":                issueBundle.OutBuf.String(),
+		codechallenge.CASerialFile:    "02\n",
+		codechallenge.CAIndexFile:     "V\t191001120000Z\t\t01\tunknown\tCN=signer\n",
+		codechallenge.CACRLNumberFile: "01\n",
+	} {
+		if (files[caDir+name] == nil) || (*files[caDir+name] != contents) {
+			t.Errorf("File %s should contain %#v.", name, contents)
+		}
+	}
+
+	otherCSRBundle := runMain(t, &files, "", "csr", "-san", "signer.example.org")
+	checkFailure(t, runMain(t, &files, otherCSRBundle.OutBuf.String(), "ca", "issue"), 5, "DNS name signer.example.org is not permitted by the name constraints of the CA")
+	checkFailure(t, runMain(t, &files, "Hello, World!", "ca", "issue"), 2, "Input is not a PEM or DER encoded certificate signing request")
+
+	revokeBundle := runMain(t, &files, "", "ca", "revoke", "1")
+	if exitStatus := revokeBundle.GetExitStatus(); exitStatus != 0 {
+		t.Fatalf("Revoking the certificate failed with exit status %d:\n%s", exitStatus, revokeBundle.ErrBuf.String())
+	}
+	if index := *files[caDir+codechallenge.CAIndexFile]; index != "R\t191001120000Z\t190901120000Z\t01\tunknown\tCN=signer\n" {
+		t.Errorf("Index should record the revocation. Got %#v instead.", index)
+	}
+	checkFailure(t, runMain(t, &files, "", "ca", "revoke", "01"), 2, "Certificate 01 was already revoked")
+	checkFailure(t, runMain(t, &files, "", "ca", "revoke", "0A"), 2, "Certificate 0A was not issued by the CA in /home/anybody/.smartEdge/ca")
+
+	crlBundle := runMain(t, &files, "", "ca", "crl", "-days", "7")
+	if exitStatus := crlBundle.GetExitStatus(); exitStatus != 0 {
+		t.Fatalf("Generating the CRL failed with exit status %d:\n%s", exitStatus, crlBundle.ErrBuf.String())
+	}
+	block, _ := pem.Decode(crlBundle.OutBuf.Bytes())
+	if (block == nil) || (block.Type != pki.CRLPEMType) {
+		t.Fatalf("Output is not a PEM CRL:\n%s", crlBundle.OutBuf.String())
+	}
+	crl, err := x509.ParseDERCRL(block.Bytes)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing CRL: %s", err.Error())
+	}
+	if err := ca.CheckCRLSignature(crl); err != nil {
+		t.Errorf("CRL is not signed by the CA: %s", err.Error())
+	}
+	tbs := crl.TBSCertList
+	if number := pki.CRLNumber(crl); (number == nil) || (number.Int64() != 1) || !tbs.NextUpdate.Equal(mocks.MockCurrentTime.Add(7*24*time.Hour)) {
+		t.Errorf("CRL has number %s, and is valid until %s.", number, tbs.NextUpdate)
+	}
+	if (len(tbs.RevokedCertificates) != 1) || (tbs.RevokedCertificates[0].SerialNumber.Int64() != 1) {
+		t.Errorf("CRL should list certificate 1 as revoked. Got %v instead.", tbs.RevokedCertificates)
+	}
+	if (*files[caDir+codechallenge.CACRLNumberFile] != "02\n") || !strings.HasPrefix(*files[caDir+codechallenge.CACRLFile], "-----BEGIN X509 CRL-----") {
+		t.Errorf("CRL number should be advanced, and the CRL kept in %s.", codechallenge.CACRLFile)
+	}
+}
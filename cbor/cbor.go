@@ -0,0 +1,300 @@
+// Package cbor implements the subset of the Concise Binary Object
+// Representation (RFC 8949) needed by COSE: integers, byte and text strings,
+// arrays, maps, tags and the simple values false, true and null. Encoding is
+// always deterministic, as defined by RFC 8949, section 4.2.1.
+package cbor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+// Major types of data items
+const (
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorArray    = 4
+	majorMap      = 5
+	majorTag      = 6
+	majorSimple   = 7
+)
+
+// Simple values
+const (
+	simpleFalse = 20
+	simpleTrue  = 21
+	simpleNull  = 22
+)
+
+// maxDepth limits how deeply data items may be nested when decoding.
+const maxDepth = 32
+
+// Map is a CBOR map. Keys are int64 or string.
+type Map map[interface{}]interface{}
+
+// Tag is a tagged data item.
+type Tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// Marshal encodes v, which may be an int, int64, uint64, []byte, string,
+// []interface{}, Map, Tag, bool or nil, along with any values it contains.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeHead writes the head of a data item, with arg in its shortest form.
+func encodeHead(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major<<5 | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write([]byte{byte(arg >> 8), byte(arg)})
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write([]byte{byte(arg >> 24), byte(arg >> 16), byte(arg >> 8), byte(arg)})
+	default:
+		buf.WriteByte(major<<5 | 27)
+		for shift := 56; shift >= 0; shift -= 8 {
+			buf.WriteByte(byte(arg >> uint(shift)))
+		}
+	}
+}
+
+// encode writes the encoding of v to buf.
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch typed := v.(type) {
+	case nil:
+		encodeHead(buf, majorSimple, simpleNull)
+	case bool:
+		if typed {
+			encodeHead(buf, majorSimple, simpleTrue)
+		} else {
+			encodeHead(buf, majorSimple, simpleFalse)
+		}
+	case int:
+		return encode(buf, int64(typed))
+	case int64:
+		if typed < 0 {
+			encodeHead(buf, majorNegative, uint64(-(typed + 1)))
+		} else {
+			encodeHead(buf, majorUnsigned, uint64(typed))
+		}
+	case uint64:
+		encodeHead(buf, majorUnsigned, typed)
+	case []byte:
+		encodeHead(buf, majorBytes, uint64(len(typed)))
+		buf.Write(typed)
+	case string:
+		if !utf8.ValidString(typed) {
+			return fmt.Errorf("CBOR text string is not valid UTF-8: %#v", typed)
+		}
+		encodeHead(buf, majorText, uint64(len(typed)))
+		buf.WriteString(typed)
+	case []interface{}:
+		encodeHead(buf, majorArray, uint64(len(typed)))
+		for _, item := range typed {
+			if err := encode(buf, item); err != nil {
+				return err
+			}
+		}
+	case Map:
+		// Deterministic encoding sorts entries by their encoded keys.
+		type entry struct {
+			key   []byte
+			value interface{}
+		}
+		entries := make([]entry, 0, len(typed))
+		for key, value := range typed {
+			switch key.(type) {
+			case int64, string:
+			default:
+				return fmt.Errorf("Unsupported CBOR map key type: %T", key)
+			}
+			encodedKey, err := Marshal(key)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry{key: encodedKey, value: value})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+		encodeHead(buf, majorMap, uint64(len(entries)))
+		for _, e := range entries {
+			buf.Write(e.key)
+			if err := encode(buf, e.value); err != nil {
+				return err
+			}
+		}
+	case Tag:
+		encodeHead(buf, majorTag, typed.Number)
+		return encode(buf, typed.Content)
+	default:
+		return fmt.Errorf("Unsupported CBOR value type: %T", v)
+	}
+	return nil
+}
+
+// Unmarshal decodes a single data item, which must make up all of data.
+// Integers decode to int64, and maps to Map. Indefinite lengths and floating
+// point numbers aren't supported.
+func Unmarshal(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	result, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.offset != len(data) {
+		return nil, fmt.Errorf("CBOR data item is followed by %d unexpected bytes", len(data)-d.offset)
+	}
+	return result, nil
+}
+
+// decoder tracks the position within the data being decoded.
+type decoder struct {
+	data   []byte
+	offset int
+}
+
+// errTruncated is returned when data ends within a data item.
+var errTruncated = errors.New("CBOR data is truncated")
+
+// decodeHead reads the head of a data item, returning its major type and
+// argument.
+func (d *decoder) decodeHead() (byte, uint64, error) {
+	if d.offset >= len(d.data) {
+		return 0, 0, errTruncated
+	}
+	initial := d.data[d.offset]
+	d.offset++
+	major := initial >> 5
+	info := initial & 0x1f
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, fmt.Errorf("Unsupported CBOR additional information %d, at offset %d", info, d.offset-1)
+	}
+	size := 1 << (info - 24)
+	if d.offset+size > len(d.data) {
+		return 0, 0, errTruncated
+	}
+	arg := uint64(0)
+	for _, b := range d.data[d.offset : d.offset+size] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.offset += size
+	return major, arg, nil
+}
+
+// decodeBytes reads the content of a string of length arg.
+func (d *decoder) decodeBytes(arg uint64) ([]byte, error) {
+	if arg > uint64(len(d.data)-d.offset) {
+		return nil, errTruncated
+	}
+	result := make([]byte, arg)
+	copy(result, d.data[d.offset:])
+	d.offset += int(arg)
+	return result, nil
+}
+
+// decode reads one data item, nested depth items deep.
+func (d *decoder) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("CBOR data items are nested more than %d deep", maxDepth)
+	}
+	start := d.offset
+	major, arg, err := d.decodeHead()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("CBOR integer %d is too large", arg)
+		}
+		return int64(arg), nil
+	case majorNegative:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("CBOR integer -1-%d is too small", arg)
+		}
+		return -1 - int64(arg), nil
+	case majorBytes:
+		return d.decodeBytes(arg)
+	case majorText:
+		text, err := d.decodeBytes(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(text) {
+			return nil, fmt.Errorf("CBOR text string is not valid UTF-8: %#v", string(text))
+		}
+		return string(text), nil
+	case majorArray:
+		// Each item takes at least one byte.
+		if arg > uint64(len(d.data)-d.offset) {
+			return nil, errTruncated
+		}
+		result := make([]interface{}, arg)
+		for i := range result {
+			if result[i], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case majorMap:
+		if arg > uint64(len(d.data)-d.offset) {
+			return nil, errTruncated
+		}
+		result := make(Map, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("Unsupported CBOR map key type: %T", key)
+			}
+			if _, ok := result[key]; ok {
+				return nil, fmt.Errorf("CBOR map has duplicate key %#v", key)
+			}
+			if result[key], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case majorTag:
+		content, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Tag{Number: arg, Content: content}, nil
+	}
+	switch d.data[start] & 0x1f {
+	case simpleFalse:
+		return false, nil
+	case simpleTrue:
+		return true, nil
+	case simpleNull:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unsupported CBOR simple value or float, at offset %d", start)
+}
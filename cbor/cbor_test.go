@@ -0,0 +1,125 @@
+package cbor_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/smartedge/codechallenge/cbor"
+	"github.com/smartedge/codechallenge/testtools"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestRoundTrip tests encoding and decoding against the examples in RFC 8949,
+// appendix A.
+func TestRoundTrip(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		value   interface{}
+		encoded string
+	}{
+		"Zero":                  {value: int64(0), encoded: "00"},
+		"Largest immediate":     {value: int64(23), encoded: "17"},
+		"One byte argument":     {value: int64(24), encoded: "1818"},
+		"Two byte argument":     {value: int64(1000), encoded: "1903e8"},
+		"Four byte argument":    {value: int64(1000000), encoded: "1a000f4240"},
+		"Eight byte argument":   {value: int64(1000000000000), encoded: "1b000000e8d4a51000"},
+		"Negative":              {value: int64(-1), encoded: "20"},
+		"Negative one byte":     {value: int64(-100), encoded: "3863"},
+		"Negative two byte":     {value: int64(-1000), encoded: "3903e7"},
+		"False":                 {value: false, encoded: "f4"},
+		"True":                  {value: true, encoded: "f5"},
+		"Null":                  {value: nil, encoded: "f6"},
+		"Empty byte string":     {value: []byte{}, encoded: "40"},
+		"Byte string":           {value: []byte{1, 2, 3, 4}, encoded: "4401020304"},
+		"Empty text string":     {value: "", encoded: "60"},
+		"Text string":           {value: "IETF", encoded: "6449455446"},
+		"Unicode text string":   {value: "\u00fc", encoded: "62c3bc"},
+		"Empty array":           {value: []interface{}{}, encoded: "80"},
+		"Nested arrays":         {value: []interface{}{int64(1), []interface{}{int64(2), int64(3)}}, encoded: "8201820203"},
+		"Empty map":             {value: cbor.Map{}, encoded: "a0"},
+		"Map with integer keys": {value: cbor.Map{int64(1): int64(2), int64(3): int64(4)}, encoded: "a201020304"},
+		"Map with text keys":    {value: cbor.Map{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}, encoded: "a26161016162820203"},
+		"Tag":                   {value: cbor.Tag{Number: 1, Content: int64(1363896240)}, encoded: "c11a514b67b0"},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			encoded, err := cbor.Marshal(tc.value)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if hex.EncodeToString(encoded) != tc.encoded {
+				tt.Errorf("%#v encoded as %s when expecting %s", tc.value, hex.EncodeToString(encoded), tc.encoded)
+			}
+			decoded, err := cbor.Unmarshal(encoded)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if !reflect.DeepEqual(decoded, tc.value) {
+				tt.Errorf("%s decoded as %#v when expecting %#v", tc.encoded, decoded, tc.value)
+			}
+		})
+	}
+}
+
+// TestDeterministicMapOrder verifies that map entries are sorted by their
+// encoded keys, which puts shorter keys first.
+func TestDeterministicMapOrder(t *testing.T) {
+	encoded, err := cbor.Marshal(cbor.Map{"aa": int64(3), "b": int64(2), int64(-1): int64(1), int64(10): int64(0)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if expected := "a40a00200161620262616103"; hex.EncodeToString(encoded) != expected {
+		t.Errorf("Map encoded as %s when expecting %s", hex.EncodeToString(encoded), expected)
+	}
+}
+
+// TestUnmarshalErrors tests data that isn't supported or isn't valid.
+func TestUnmarshalErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		encoded string
+		err     *testtools.ErrorSpec
+	}{
+		"Truncated": {
+			encoded: "1903",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CBOR data is truncated"},
+		},
+		"Truncated string": {
+			encoded: "64494554",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CBOR data is truncated"},
+		},
+		"Trailing bytes": {
+			encoded: "0000",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CBOR data item is followed by 1 unexpected bytes"},
+		},
+		"Indefinite length": {
+			encoded: "9fff",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported CBOR additional information 31, at offset 0"},
+		},
+		"Float": {
+			encoded: "f93c00",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported CBOR simple value or float, at offset 0"},
+		},
+		"Duplicate map key": {
+			encoded: "a201020103",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CBOR map has duplicate key 1"},
+		},
+		"Invalid UTF-8": {
+			encoded: "61ff",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CBOR text string is not valid UTF-8: \"\\xff\""},
+		},
+		"Too deeply nested": {
+			encoded: strings.Repeat("81", 33) + "00",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CBOR data items are nested more than 32 deep"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			data, err := hex.DecodeString(tc.encoded)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			_, err = cbor.Unmarshal(data)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package codechallenge
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/pki"
+	"strings"
+	"time"
+)
+
+// DefaultCertificateCommonName is the common name of the subject of a
+// certificate, if no subject is given.
+const DefaultCertificateCommonName = "codechallenge"
+
+// CertSelfSignMain is the entry-point for the cert self-sign command. It
+// writes a PEM certificate of the public key, signed by the private key, with
+// the profile in config, to d.Os.Stdout, creating the key-pair if necessary.
+func CertSelfSignMain(d *deps.Dependencies, config *RunConfig) {
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	cert, err := pki.SelfSign(cryptStuff.Signer, d.Crypto.Rand.Reader, &config.Certificate, d.Time.Now())
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	err = cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+	if err != nil {
+		HandleError(d, fmt.Errorf("round trip verification of certificate failed: %s", err.Error()), 7)
+	}
+	err = WriteOutput(d, pki.EncodePEM(cert))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// loadSigningCertificate reads the PEM certificate in filename, which must
+// certify the public key of cryptStuff, and returns it PEM encoded, followed
+// by any PEM certificates of its chain in the file.
+func loadSigningCertificate(d *deps.Dependencies, filename string, cryptStuff *crypt.CryptoTooling) (string, error) {
+	certs, err := loadCertificates(d, filename)
+	if err != nil {
+		return "", err
+	}
+	if !pki.Certifies(certs[0], cryptStuff.Signer.Public()) {
+		return "", fmt.Errorf("Certificate in %s is not of the signing key", filename)
+	}
+	result := ""
+	for _, cert := range certs {
+		result += string(pki.EncodePEM(cert))
+	}
+	return result, nil
+}
+
+// CertificateVerdict is the outcome of checking a certificate issued for a
+// CSR against the key-pair, to be rendered to JSON. The subject, issuer,
+// serial number and expiry of the certificate are only included if it is of
+// the key-pair and currently valid.
+type CertificateVerdict struct {
+	*Verdict
+	Subject      string `json:"subject,omitempty"`
+	Issuer       string `json:"issuer,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	NotAfter     string `json:"not_after,omitempty"`
+}
+
+// CSRMain is the entry-point for the csr command. It writes a PKCS #10
+// certificate signing request for the public key, signed by the private key,
+// with the profile in config, to d.Os.Stdout in PEM or DER, creating the
+// key-pair if necessary. If a certificate issued for the request is given,
+// it writes the verdict on it in JSON format instead, exiting with the
+// verdict's exit status if it isn't valid.
+func CSRMain(d *deps.Dependencies, config *RunConfig) {
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	if config.Output.IssuedCertPath != "" {
+		verdict, err := CheckIssuedCertificate(d, config, cryptStuff)
+		if err != nil {
+			HandleError(d, err, 2)
+		}
+		err = WriteJSON(d, verdict)
+		if err != nil {
+			HandleError(d, err, 8)
+		}
+		if !verdict.Valid {
+			d.Os.Exit(verdict.ExitStatus())
+		}
+		return
+	}
+	der, err := pki.CreateRequest(cryptStuff.Signer, d.Crypto.Rand.Reader, &config.Certificate)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	request, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	err = request.CheckSignature()
+	if err != nil {
+		HandleError(d, fmt.Errorf("round trip verification of CSR failed: %s", err.Error()), 7)
+	}
+	if !config.Output.DER {
+		der = pki.EncodeRequestPEM(der)
+	}
+	err = WriteOutput(d, der)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// CheckIssuedCertificate checks that the certificate issued for a CSR, in
+// the file in config, is of the public key of cryptStuff, and is valid at the
+// current time. Its issuer's signature isn't checked, as the issuer's
+// certificate isn't known.
+func CheckIssuedCertificate(d *deps.Dependencies, config *RunConfig, cryptStuff *crypt.CryptoTooling) (*CertificateVerdict, error) {
+	buff, err := d.Io.Ioutil.ReadFile(config.Output.IssuedCertPath)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := pki.ParseCertificate(buff)
+	if err != nil {
+		return nil, err
+	}
+	if !pki.Certifies(cert, cryptStuff.Signer.Public()) {
+		return &CertificateVerdict{Verdict: NewVerdict(BadSignature, "Certificate is not of the signing key")}, nil
+	}
+	now := d.Time.Now()
+	if now.Before(cert.NotBefore) {
+		return &CertificateVerdict{Verdict: NewVerdict(InvalidClaims, fmt.Sprintf("Certificate is not valid before %s", cert.NotBefore.Format(time.RFC3339)))}, nil
+	}
+	if now.After(cert.NotAfter) {
+		return &CertificateVerdict{Verdict: NewVerdict(InvalidClaims, fmt.Sprintf("Certificate expired at %s", cert.NotAfter.Format(time.RFC3339)))}, nil
+	}
+	return &CertificateVerdict{
+		Verdict:      NewVerdict(SignatureValid, ""),
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.Text(16),
+		NotAfter:     cert.NotAfter.Format(time.RFC3339),
+	}, nil
+}
+
+// parseCertificateOptions validates the options of the certificates and CSRs
+// written, and the key usages required of those verified, in cl into config.
+func parseCertificateOptions(config *RunConfig, cl *commandLine) error {
+	if config.Command == CAInitCommand {
+		config.Certificate.Subject = pkix.Name{CommonName: DefaultCACommonName}
+		config.Certificate.Validity = pki.DefaultCAValidity
+		config.Certificate.IsCA = true
+	}
+	if (*cl.certSubject != "") || (*cl.subjectAltNames != "") || (*cl.validityDays != 0) || (*cl.keyUsages != "") || (*cl.extKeyUsages != "") || *cl.isCA || (*cl.maxPathLen != -1) || (*cl.permittedDNSDomains != "") || (*cl.excludedDNSDomains != "") {
+		verifiesCertificate := config.VerifyMode && (*cl.trustStorePath != "")
+		if verifiesCertificate && ((*cl.certSubject != "") || (*cl.subjectAltNames != "") || (*cl.validityDays != 0) || *cl.isCA || (*cl.maxPathLen != -1) || (*cl.permittedDNSDomains != "") || (*cl.excludedDNSDomains != "")) {
+			return errors.New("Options -key-usage and -ext-key-usage are the only certificate options valid with -trust-store")
+		}
+		if !verifiesCertificate && (config.Command != CertSelfSignCommand) && (config.Command != CSRCommand) && (config.Command != CAInitCommand) && (config.Command != CAIssueCommand) && (config.Command != CACRLCommand) {
+			return fmt.Errorf("Certificate options are only valid with the %s, %s, %s, %s and %s commands", CertSelfSignCommand, CSRCommand, CAInitCommand, CAIssueCommand, CACRLCommand)
+		}
+		if *cl.issuedCertPath != "" {
+			return errors.New("Option -issued may not be used with other certificate options, as no CSR is written")
+		}
+		if (config.Command == CACRLCommand) && ((*cl.certSubject != "") || (*cl.subjectAltNames != "") || (*cl.keyUsages != "") || (*cl.extKeyUsages != "") || *cl.isCA || (*cl.maxPathLen != -1) || (*cl.permittedDNSDomains != "") || (*cl.excludedDNSDomains != "")) {
+			return fmt.Errorf("Option -days is the only certificate option valid with the %s command", CACRLCommand)
+		}
+		if (config.Command == CAIssueCommand) && ((*cl.certSubject != "") || (*cl.subjectAltNames != "")) {
+			return fmt.Errorf("Options -subject and -san are not valid with the %s command, as the names are those of the CSR", CAIssueCommand)
+		}
+		if *cl.certSubject != "" {
+			name, err := pki.ParseSubject(*cl.certSubject)
+			if err != nil {
+				return err
+			}
+			config.Certificate.Subject = name
+		}
+		if *cl.subjectAltNames != "" {
+			for _, name := range strings.Split(*cl.subjectAltNames, ",") {
+				if err := config.Certificate.AddSubjectAltName(name); err != nil {
+					return err
+				}
+			}
+		}
+		if *cl.validityDays != 0 {
+			if config.Command == CSRCommand {
+				return fmt.Errorf("Option -days is not valid with the %s command, as the CA sets the validity period", CSRCommand)
+			}
+			if config.Command == CACRLCommand {
+				config.CA.CRLValidity = time.Duration(*cl.validityDays) * 24 * time.Hour
+			} else {
+				config.Certificate.Validity = time.Duration(*cl.validityDays) * 24 * time.Hour
+			}
+		}
+		if *cl.keyUsages != "" {
+			for _, name := range strings.Split(*cl.keyUsages, ",") {
+				usage, err := pki.ParseKeyUsage(strings.TrimSpace(name))
+				if err != nil {
+					return err
+				}
+				config.Certificate.KeyUsage |= usage
+			}
+		}
+		if *cl.extKeyUsages != "" {
+			for _, name := range strings.Split(*cl.extKeyUsages, ",") {
+				usage, err := pki.ParseExtKeyUsage(strings.TrimSpace(name))
+				if err != nil {
+					return err
+				}
+				config.Certificate.ExtKeyUsage = append(config.Certificate.ExtKeyUsage, usage)
+			}
+		}
+		isCACertificate := *cl.isCA || (config.Command == CAInitCommand)
+		if *cl.maxPathLen != -1 {
+			if !isCACertificate {
+				return errors.New("Option -path-len is only valid with -ca")
+			}
+			if *cl.maxPathLen < 0 {
+				return fmt.Errorf("Option -path-len must not be negative. Saw -path-len=%d", *cl.maxPathLen)
+			}
+		}
+		if (*cl.permittedDNSDomains != "") || (*cl.excludedDNSDomains != "") {
+			if !isCACertificate {
+				return fmt.Errorf("Options -permitted-dns and -excluded-dns are only valid with -ca or the %s command", CAInitCommand)
+			}
+			if config.Command == CSRCommand {
+				return fmt.Errorf("Options -permitted-dns and -excluded-dns are not valid with the %s command, as the CA sets the name constraints", CSRCommand)
+			}
+			for _, domains := range []struct {
+				value string
+				dest  *[]string
+			}{
+				{value: *cl.permittedDNSDomains, dest: &config.Certificate.PermittedDNSDomains},
+				{value: *cl.excludedDNSDomains, dest: &config.Certificate.ExcludedDNSDomains},
+			} {
+				if domains.value == "" {
+					continue
+				}
+				for _, domain := range strings.Split(domains.value, ",") {
+					domain = strings.TrimSpace(domain)
+					if (domain == "") || strings.ContainsAny(domain, " @:/") {
+						return fmt.Errorf("Name constraint %#v is not a DNS domain", domain)
+					}
+					*domains.dest = append(*domains.dest, domain)
+				}
+			}
+		}
+		config.Certificate.IsCA = isCACertificate
+		config.Certificate.MaxPathLen = *cl.maxPathLen
+		if verifiesCertificate {
+			config.Trust.KeyUsage = config.Certificate.KeyUsage
+			config.Trust.ExtKeyUsage = config.Certificate.ExtKeyUsage
+		}
+	}
+	return nil
+}
+
+// parseCSROptions validates the DER and issued certificate options of the csr
+// command in cl into config.
+func parseCSROptions(config *RunConfig, cl *commandLine) error {
+	if *cl.der || (*cl.issuedCertPath != "") {
+		if config.Command != CSRCommand {
+			return fmt.Errorf("Options -der and -issued are only valid with the %s command", CSRCommand)
+		}
+		if *cl.der && (*cl.issuedCertPath != "") {
+			return errors.New("Options -der and -issued may not be used together, as no CSR is written")
+		}
+		config.Output.DER = *cl.der
+		config.Output.IssuedCertPath = *cl.issuedCertPath
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package codechallenge_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/pki"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// TestCertSelfSign verifies that the cert self-sign command writes a
+// certificate of the key-pair with the profile given by the certificate
+// options, and that it can replace the public key in signed messages.
+func TestCertSelfSign(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		keyArgs  []string
+		certArgs []string
+		check    func(*x509.Certificate) error
+	}{
+		"Defaults": {
+			check: func(cert *x509.Certificate) error {
+				if (cert.Subject.String() != "CN=codechallenge") || cert.IsCA || (cert.KeyUsage != x509.KeyUsageDigitalSignature) {
+					return fmt.Errorf("certificate of %s has IsCA %t and KeyUsage %d", cert.Subject.String(), cert.IsCA, cert.KeyUsage)
+				}
+				if cert.PublicKeyAlgorithm != x509.ECDSA {
+					return fmt.Errorf("certificate is of a %s key", cert.PublicKeyAlgorithm)
+				}
+				return nil
+			},
+		},
+		"Leaf with subject alternative names": {
+			keyArgs:  []string{"-ed25519"},
+			certArgs: []string{"-subject", "CN=signer,O=Example Corp,C=US", "-san", "signer.example.com, IP:192.0.2.1,signer@example.com", "-days", "30", "-ext-key-usage", "codeSigning"},
+			check: func(cert *x509.Certificate) error {
+				if cert.Subject.String() != "CN=signer,O=Example Corp,C=US" {
+					return fmt.Errorf("certificate subject is %s", cert.Subject.String())
+				}
+				if fmt.Sprint(cert.DNSNames, cert.IPAddresses, cert.EmailAddresses) != "[signer.example.com] [192.0.2.1] [signer@example.com]" {
+					return fmt.Errorf("certificate has DNS names %v, IP addresses %v and email addresses %v", cert.DNSNames, cert.IPAddresses, cert.EmailAddresses)
+				}
+				if !cert.NotAfter.Equal(mocks.MockCurrentTime.Add(30 * 24 * time.Hour)) {
+					return fmt.Errorf("certificate expires at %s", cert.NotAfter)
+				}
+				if (len(cert.ExtKeyUsage) != 1) || (cert.ExtKeyUsage[0] != x509.ExtKeyUsageCodeSigning) {
+					return fmt.Errorf("certificate has extended key usages %v", cert.ExtKeyUsage)
+				}
+				return nil
+			},
+		},
+		"CA with path length": {
+			keyArgs:  []string{"-rsa"},
+			certArgs: []string{"-subject", "CN=Example Root CA", "-ca", "-path-len", "1", "-key-usage", "keyCertSign,cRLSign"},
+			check: func(cert *x509.Certificate) error {
+				if !cert.IsCA || (cert.MaxPathLen != 1) {
+					return fmt.Errorf("certificate has IsCA %t and MaxPathLen %d", cert.IsCA, cert.MaxPathLen)
+				}
+				if cert.KeyUsage != (x509.KeyUsageCertSign | x509.KeyUsageCRLSign) {
+					return fmt.Errorf("certificate has KeyUsage %d", cert.KeyUsage)
+				}
+				return cert.CheckSignatureFrom(cert)
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{}
+			certBundle := mocks.NewDefaultMockDeps("", append(append([]string{"codechallenge", "cert", "self-sign"}, tc.keyArgs...), tc.certArgs...), "/home/anybody", &files)
+			err := certBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(certBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling certBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := certBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Creating the certificate failed with exit status %d:\n%s", exitStatus, certBundle.ErrBuf.String())
+			}
+			cert, err := pki.ParsePEM(certBundle.OutBuf.Bytes())
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing certificate:\n%s", certBundle.OutBuf.String())
+			}
+			if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+				tt.Errorf("Certificate is not signed by its key: %s", err.Error())
+			}
+			if !cert.NotBefore.Equal(mocks.MockCurrentTime) {
+				tt.Errorf("Certificate should be valid from %s. Got %s instead.", mocks.MockCurrentTime, cert.NotBefore)
+			}
+			if err := tc.check(cert); err != nil {
+				tt.Errorf("Certificate didn't match: %s.", err.Error())
+			}
+			// Sign a message with the certificate in place of the public key:
+			files["/home/anybody/signer.crt"] = testtools.StringPtr(certBundle.OutBuf.String())
+			signBundle := mocks.NewDefaultMockDeps("Hello, World!", append([]string{"codechallenge", "-cert", "signer.crt"}, tc.keyArgs...), "/home/anybody", &files)
+			err = signBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(signBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling signBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+			}
+			doc := codechallenge.SignedMessage{}
+			if err := json.Unmarshal(signBundle.OutBuf.Bytes(), &doc); err != nil {
+				tt.Fatalf("Unexpected error parsing signed message: %s", err.Error())
+			}
+			if doc.Pubkey != certBundle.OutBuf.String() {
+				tt.Errorf("Signed message should have the certificate as its pubkey. Got:\n%s", doc.Pubkey)
+			}
+			verifyBundle := mocks.NewDefaultMockDeps(signBundle.OutBuf.String(), append([]string{"codechallenge", "-verify"}, tc.keyArgs...), "/home/anybody", &files)
+			err = verifyBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(verifyBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Errorf("Unexpected error calling verifyBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Errorf("Verifying failed with exit status %d:\n%s", exitStatus, verifyBundle.ErrBuf.String())
+			}
+			if verdict := verifyBundle.OutBuf.String(); verdict != "{\n\"valid\": true,\n\"reason\": \"valid\"\n}" {
+				tt.Errorf("Verdict should be valid. Got %#v instead.", verdict)
+			}
+		})
+	}
+}
+
+// TestSignWithCertificateOfAnotherKey verifies that a certificate is only
+// used in a signed message if it certifies the signing key, here an Ed25519
+// key rather than the ECDSA key it certifies.
+func TestSignWithCertificateOfAnotherKey(t *testing.T) {
+	files := testtools.FakeFileSystem{}
+	certBundle := mocks.NewDefaultMockDeps("", []string{"codechallenge", "cert", "self-sign"}, "/home/anybody", &files)
+	err := certBundle.InvokeCallInMockedEnv(func() error {
+		codechallenge.RealMain(certBundle.Deps)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error calling certBundle.InvokeCallInMockedEnv(): %s", err.Error())
+	}
+	files["/home/anybody/other.crt"] = testtools.StringPtr(certBundle.OutBuf.String())
+	signBundle := mocks.NewDefaultMockDeps("Hello, World!", []string{"codechallenge", "-ed25519", "-cert", "other.crt"}, "/home/anybody", &files)
+	err = signBundle.InvokeCallInMockedEnv(func() error {
+		codechallenge.RealMain(signBundle.Deps)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error calling signBundle.InvokeCallInMockedEnv(): %s", err.Error())
+	}
+	if exitStatus := signBundle.GetExitStatus(); exitStatus != 4 {
+		t.Errorf("RealMain() should have an exit status of 4. Got %#v instead.", exitStatus)
+	}
+	if err := testtools.NewStringStringMatcher("Certificate in other.crt is not of the signing key\nUsage of codechallenge:" + UsageMessageBody).MatchString(signBundle.ErrBuf.String()); err != nil {
+		t.Errorf("Standard Error:\n%#v didn't match:\n%s.", signBundle.ErrBuf.String(), err.Error())
+	}
+}
+
+// TestCSR verifies that the csr command writes a certificate signing request
+// of the key-pair in PEM or DER, and that certificates issued for it are
+// checked against the key-pair with -issued.
+func TestCSR(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caProfile := pki.NewProfile("Test CA")
+	caProfile.IsCA = true
+	ca, err := pki.SelfSign(caKey, rand.Reader, caProfile, mocks.MockCurrentTime.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error creating CA: %s", err.Error())
+	}
+	for desc, tc := range map[string]struct {
+		csrArgs   []string
+		der       bool
+		issue     func(*x509.CertificateRequest) crypto.PublicKey
+		notBefore time.Time
+		status    int
+		stdOutput testtools.StringMatcher
+	}{
+		"PEM": {
+			csrArgs:   []string{"-subject", "CN=signer,O=Example Corp", "-san", "signer.example.com", "-ext-key-usage", "codeSigning"},
+			issue:     func(request *x509.CertificateRequest) crypto.PublicKey { return request.PublicKey },
+			notBefore: mocks.MockCurrentTime,
+			status:    0,
+			stdOutput: testtools.NewRegexpStringMatcher("^\\{\n\"valid\": true,\n\"reason\": \"valid\",\n\"subject\": \"CN=signer,O=Example Corp\",\n\"issuer\": \"CN=Test CA\",\n\"serial_number\": \"2a\",\n\"not_after\": \"2019-09-02T12:00:00Z\"\n\\}$"),
+		},
+		"DER": {
+			csrArgs:   []string{"-der"},
+			der:       true,
+			issue:     func(request *x509.CertificateRequest) crypto.PublicKey { return request.PublicKey },
+			notBefore: mocks.MockCurrentTime,
+			status:    0,
+			stdOutput: testtools.NewRegexpStringMatcher("^\\{\n\"valid\": true,\n\"reason\": \"valid\",\n\"subject\": \"CN=codechallenge\","),
+		},
+		"Issued for another key": {
+			issue:     func(*x509.CertificateRequest) crypto.PublicKey { return caKey.Public() },
+			notBefore: mocks.MockCurrentTime,
+			status:    9,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"Certificate is not of the signing key\"\n}"),
+		},
+		"Expired": {
+			issue:     func(request *x509.CertificateRequest) crypto.PublicKey { return request.PublicKey },
+			notBefore: mocks.MockCurrentTime.Add(-25 * time.Hour),
+			status:    11,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"invalid claims\",\n\"detail\": \"Certificate expired at 2019-09-01T11:00:00Z\"\n}"),
+		},
+		"Not yet valid": {
+			issue:     func(request *x509.CertificateRequest) crypto.PublicKey { return request.PublicKey },
+			notBefore: mocks.MockCurrentTime.Add(time.Hour),
+			status:    11,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"invalid claims\",\n\"detail\": \"Certificate is not valid before 2019-09-01T13:00:00Z\"\n}"),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{}
+			csrBundle := mocks.NewDefaultMockDeps("", append([]string{"codechallenge", "csr"}, tc.csrArgs...), "/home/anybody", &files)
+			err := csrBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(csrBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling csrBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := csrBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Creating the CSR failed with exit status %d:\n%s", exitStatus, csrBundle.ErrBuf.String())
+			}
+			der := csrBundle.OutBuf.Bytes()
+			if !tc.der {
+				block, _ := pem.Decode(der)
+				if (block == nil) || (block.Type != pki.RequestPEMType) {
+					tt.Fatalf("Output should be a PEM encoded CSR. Got:\n%s", csrBundle.OutBuf.String())
+				}
+				der = block.Bytes
+			}
+			request, err := x509.ParseCertificateRequest(der)
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing CSR: %s", err.Error())
+			}
+			if err := request.CheckSignature(); err != nil {
+				tt.Errorf("CSR is not signed by its key: %s", err.Error())
+			}
+			// Issue a certificate for the CSR, as a CA would:
+			template := &x509.Certificate{
+				SerialNumber:    big.NewInt(42),
+				Subject:         request.Subject,
+				DNSNames:        request.DNSNames,
+				NotBefore:       tc.notBefore,
+				NotAfter:        tc.notBefore.Add(24 * time.Hour),
+				ExtraExtensions: request.Extensions,
+			}
+			certDER, err := x509.CreateCertificate(rand.Reader, template, ca, tc.issue(request), caKey)
+			if err != nil {
+				tt.Fatalf("Unexpected error issuing certificate: %s", err.Error())
+			}
+			files["/home/anybody/issued.crt"] = testtools.StringPtr(string(certDER))
+			if !tc.der {
+				files["/home/anybody/issued.crt"] = testtools.StringPtr(string(pem.EncodeToMemory(&pem.Block{Type: pki.PEMType, Bytes: certDER})))
+			}
+			checkBundle := mocks.NewDefaultMockDeps("", []string{"codechallenge", "csr", "-issued", "issued.crt"}, "/home/anybody", &files)
+			err = checkBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(checkBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Errorf("Unexpected error calling checkBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := checkBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(checkBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", checkBundle.OutBuf.String(), err.Error())
+			}
+			if errOutput := checkBundle.ErrBuf.String(); errOutput != "" {
+				tt.Errorf("Standard Error should be empty. Got %#v instead.", errOutput)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package codechallenge
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/cms"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/pki"
+	"github.com/smartedge/codechallenge/tsp"
+	"io/ioutil"
+	"time"
+)
+
+// loadCertificate reads the PEM encoded certificate in the file filename.
+func loadCertificate(d *deps.Dependencies, filename string) (*x509.Certificate, error) {
+	buff, err := d.Io.Ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(buff)
+	if (block == nil) || (block.Type != "CERTIFICATE") {
+		return nil, fmt.Errorf("File %s does not contain a PEM encoded certificate", filename)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// loadCertificates reads the PEM certificate in filename, followed by any
+// PEM certificates of its chain.
+func loadCertificates(d *deps.Dependencies, filename string) ([]*x509.Certificate, error) {
+	buff, err := d.Io.Ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := pki.ParsePEMChain(buff)
+	if err != nil {
+		return nil, fmt.Errorf("File %s does not contain a PEM encoded certificate", filename)
+	}
+	return certs, nil
+}
+
+// SignCMSMain signs message as CMS SignedData with the keys in cryptStuff,
+// embedding the certificate in config and any intermediates following it if
+// there is one, and writes it to d.Os.Stdout in DER or PEM. Given a TSA, a
+// time-stamp token of the signature is added as an unsigned attribute.
+func SignCMSMain(d *deps.Dependencies, config *RunConfig, cryptStuff *crypt.CryptoTooling, message string) {
+	var cert *x509.Certificate
+	var intermediates []*x509.Certificate
+	if config.Output.CertPath != "" {
+		certs, err := loadCertificates(d, config.Output.CertPath)
+		if err != nil {
+			HandleError(d, err, 4)
+		}
+		cert, intermediates = certs[0], certs[1:]
+	}
+	buff, err := cms.Sign(cryptStuff.Signer, d.Crypto.Rand.Reader, []byte(message), config.PubKeySettings.GetHash(), cert, config.Output.Detached, d.Time.Now(), intermediates...)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	signed, err := cms.Parse(buff)
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	signed.Content = []byte(message)
+	valid, err := signed.Verify(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	if config.Timestamp.URL != "" {
+		token, err := RequestTimestamp(d, config.Timestamp.URL, &config.PubKeySettings, signed.Signature())
+		if err != nil {
+			HandleError(d, err, 5)
+		}
+		buff, err = cms.AddUnsignedAttribute(buff, tsp.OIDTimeStampToken, asn1.RawValue{FullBytes: token})
+		if err != nil {
+			HandleError(d, err, 5)
+		}
+	}
+	if config.Output.Format == CMSPEMOutput {
+		buff = pem.EncodeToMemory(&pem.Block{Type: cms.PEMType, Bytes: buff})
+	}
+	err = WriteOutput(d, buff)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// VerifyCMSMain is the entry-point for -verify mode with CMS input. It reads
+// CMS SignedData in DER or PEM from d.Os.Stdin, and writes the verdict in
+// JSON format to d.Os.Stdout, exiting with the verdict's exit status if it
+// isn't valid. Any time-stamp token of the signature must be valid. Given a
+// trust store, the signer must be identified by an embedded certificate
+// trusted by it, instead of by the public key file.
+func VerifyCMSMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	if config.Output.Format == CMSPEMOutput {
+		block, _ := pem.Decode(buff)
+		if block == nil {
+			HandleError(d, errors.New("Input is not a PEM encoded CMS message"), 2)
+		}
+		buff = block.Bytes
+	}
+	signed, err := cms.Parse(buff)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	var verdict *Verdict
+	var report interface{}
+	if config.Trust.StorePath != "" {
+		trustVerdict, err := VerifyCMSTrust(d, config, signed)
+		if err != nil {
+			HandleError(d, err, 3)
+		}
+		report, verdict = trustVerdict, trustVerdict.Verdict
+	} else {
+		verdict, err = VerifyCMS(d, config, signed)
+		if err != nil {
+			HandleError(d, err, 3)
+		}
+		report = verdict
+	}
+	err = WriteJSON(d, report)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyCMS checks the signature of signed against the public key file in
+// config, and any time-stamp token of the signature. Detached content is read
+// from the file in config.
+func VerifyCMS(d *deps.Dependencies, config *RunConfig, signed *cms.SignedData) (*Verdict, error) {
+	if err := readDetachedCMSContent(d, config, signed); err != nil {
+		return nil, err
+	}
+	publicKey, err := loadPublicKey(d, config.PubKeySettings.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	verdict, _, err := checkCMSTimestamp(d, config, signed, newVerdictFromVerification(signed.Verify(publicKey)))
+	return verdict, err
+}
+
+// VerifyCMSTrust checks the signature of signed against the embedded
+// certificate of its signer, and validates that certificate, with the other
+// embedded certificates as intermediates, against the trust store in config.
+// Detached content is read from the file in config.
+func VerifyCMSTrust(d *deps.Dependencies, config *RunConfig, signed *cms.SignedData) (*TrustVerdict, error) {
+	if err := readDetachedCMSContent(d, config, signed); err != nil {
+		return nil, err
+	}
+	leaf, err := signed.SignerCertificate()
+	if err != nil {
+		return CheckTrust(d, config, NewVerdict(Untrusted, err.Error()), nil, nil, signed.SigningTime, time.Time{})
+	}
+	intermediates := []*x509.Certificate{}
+	for _, cert := range signed.Certificates {
+		if cert != leaf {
+			intermediates = append(intermediates, cert)
+		}
+	}
+	verdict, timestampTime, err := checkCMSTimestamp(d, config, signed, newVerdictFromVerification(signed.Verify(leaf.PublicKey)))
+	if err != nil {
+		return nil, err
+	}
+	return CheckTrust(d, config, verdict, leaf, intermediates, signed.SigningTime, timestampTime)
+}
+
+// checkCMSTimestamp checks the time-stamp token in the unsigned attributes of
+// the signer of signed, if it has one, given the verdict on its signature.
+func checkCMSTimestamp(d *deps.Dependencies, config *RunConfig, signed *cms.SignedData, verdict *Verdict) (*Verdict, time.Time, error) {
+	return CheckTimestamp(d, config, verdict, signed.UnsignedAttribute(tsp.OIDTimeStampToken), signed.Signature())
+}
+
+// readDetachedCMSContent reads the detached content of signed from the file
+// in config, which is only valid if the content is detached.
+func readDetachedCMSContent(d *deps.Dependencies, config *RunConfig, signed *cms.SignedData) error {
+	if signed.Detached {
+		if config.Output.PayloadPath == "" {
+			return errors.New("CMS content is detached, which requires -payload")
+		}
+		payload, err := d.Io.Ioutil.ReadFile(config.Output.PayloadPath)
+		if err != nil {
+			return err
+		}
+		signed.Content = payload
+	} else if config.Output.PayloadPath != "" {
+		return errors.New("Option -payload is only valid for detached CMS content")
+	}
+	return nil
+}
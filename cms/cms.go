@@ -0,0 +1,575 @@
+// Package cms implements CMS SignedData, as defined by RFC 5652, with a
+// single signer and signed attributes, as expected by S/MIME tooling and
+// `openssl cms -verify`. The content is data, unless another content type is
+// given, such as that of the TSTInfo of an RFC 3161 time-stamp token.
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// PEMType is the type of PEM blocks containing CMS messages.
+const PEMType = "CMS"
+
+// Object identifiers of content types, attributes and algorithms
+var (
+	OIDData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	OIDSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	OIDContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	OIDSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	OIDRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	OIDEd25519       = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// digestAlgorithmOIDs maps the supported hashes to their object identifiers.
+var digestAlgorithmOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA256: {2, 16, 840, 1, 101, 3, 4, 2, 1},
+	crypto.SHA384: {2, 16, 840, 1, 101, 3, 4, 2, 2},
+	crypto.SHA512: {2, 16, 840, 1, 101, 3, 4, 2, 3},
+}
+
+// DigestAlgorithmOID returns the object identifier of the digest algorithm
+// hash.
+func DigestAlgorithmOID(hash crypto.Hash) (asn1.ObjectIdentifier, error) {
+	oid, ok := digestAlgorithmOIDs[hash]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported CMS digest algorithm %s", crypt.HashName(hash))
+	}
+	return oid, nil
+}
+
+// DigestAlgorithmHash returns the hash identified by the object identifier
+// of a digest algorithm.
+func DigestAlgorithmHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for hash, hashOID := range digestAlgorithmOIDs {
+		if hashOID.Equal(oid) {
+			return hash, nil
+		}
+	}
+	return 0, fmt.Errorf("Unsupported CMS digest algorithm %s", oid.String())
+}
+
+// ecdsaSignatureOIDs maps the supported hashes to the object identifiers of
+// ECDSA signatures of digests made with them.
+var ecdsaSignatureOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA256: {1, 2, 840, 10045, 4, 3, 2},
+	crypto.SHA384: {1, 2, 840, 10045, 4, 3, 3},
+	crypto.SHA512: {1, 2, 840, 10045, 4, 3, 4},
+}
+
+// rsaSignatureOIDs maps the supported hashes to the object identifiers of
+// RSA PKCS #1 v1.5 signatures of digests made with them, which are accepted
+// as well as rsaEncryption.
+var rsaSignatureOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA256: {1, 2, 840, 113549, 1, 1, 11},
+	crypto.SHA384: {1, 2, 840, 113549, 1, 1, 12},
+	crypto.SHA512: {1, 2, 840, 113549, 1, 1, 13},
+}
+
+// contentInfo is the outermost structure of a CMS message.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// encapsulatedContentInfo holds the signed content, unless it is detached.
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"optional,explicit,tag:0"`
+}
+
+// signedData is the SignedData content of a CMS message.
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// signerInfo holds a signature, and what was signed.
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// issuerAndSerialNumber identifies a signer by their certificate.
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// attribute is a signed or unsigned attribute, which always has a single
+// value here.
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// Attribute is a further signed attribute of a signer, whose value is
+// marshalled to DER.
+type Attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value interface{}
+}
+
+// SignedData is a parsed CMS SignedData message with a single signer.
+type SignedData struct {
+	Content       []byte
+	ContentType   asn1.ObjectIdentifier
+	Detached      bool
+	Certificates  []*x509.Certificate
+	Hash          crypto.Hash
+	SigningTime   time.Time
+	messageDigest []byte
+	sid           asn1.RawValue
+	signedAttrs   []byte
+	attrs         []attribute
+	unsignedAttrs []attribute
+	signatureAlg  asn1.ObjectIdentifier
+	signature     []byte
+}
+
+// SubjectKeyID returns the subject key identifier of publicKey: the SHA-1
+// hash of its subjectPublicKey bit string, as described by RFC 5280.
+func SubjectKeyID(publicKey crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	info := struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}{}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum(info.SubjectPublicKey.Bytes)
+	return hash[:], nil
+}
+
+// signatureAlgorithm returns the signature algorithm identifier of
+// publicKey, signing digests made with hash. RSA keys sign with PKCS #1 v1.5
+// padding, which S/MIME tooling expects.
+func signatureAlgorithm(publicKey crypto.PublicKey, hash crypto.Hash) (pkix.AlgorithmIdentifier, crypt.SignatureScheme, error) {
+	scheme := crypt.SignatureScheme{Hash: hash, RSAPadding: crypt.PKCS1v15Padding, ECDSAEncoding: crypt.ASN1Encoding}
+	switch publicKey.(type) {
+	case ed25519.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: OIDEd25519}, scheme, nil
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: OIDRSAEncryption, Parameters: asn1.NullRawValue}, scheme, nil
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: ecdsaSignatureOIDs[hash]}, scheme, nil
+	}
+	return pkix.AlgorithmIdentifier{}, scheme, fmt.Errorf("Public key did not conform to recognized algorithm: %T", publicKey)
+}
+
+// marshalAttributes returns the DER encoding of the content of attrs as a
+// SET OF, with the attributes sorted as DER requires.
+func marshalAttributes(attrs []attribute) ([]byte, error) {
+	encoded := make([][]byte, 0, len(attrs))
+	for _, attr := range attrs {
+		buff, err := asn1.Marshal(attr)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, buff)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return bytes.Join(encoded, nil), nil
+}
+
+// attributeSet returns the DER encoding of signed attributes with content as
+// a SET OF, which is what is signed, rather than with the implicit tag they
+// have within a signerInfo.
+func attributeSet(content []byte) ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: content})
+}
+
+// newAttribute returns an attribute of type oid, with the DER encoding of
+// value.
+func newAttribute(oid asn1.ObjectIdentifier, value interface{}) (attribute, error) {
+	buff, err := asn1.Marshal(value)
+	if err != nil {
+		return attribute{}, err
+	}
+	return attribute{Type: oid, Values: []asn1.RawValue{{FullBytes: buff}}}, nil
+}
+
+// Sign returns the DER encoding of a CMS SignedData message of content,
+// signed by signer at signingTime, with the content-type, message-digest and
+// signing-time signed attributes. The content is digested with hash, except
+// for Ed25519 keys, which always use SHA-512 as RFC 8419 requires. If cert
+// is given, it is embedded, and identifies the signer, along with any
+// intermediates of its chain. Otherwise the signer is identified by its
+// subject key identifier. The content is omitted if detached is true.
+func Sign(signer crypto.Signer, randReader io.Reader, content []byte, hash crypto.Hash, cert *x509.Certificate, detached bool, signingTime time.Time, intermediates ...*x509.Certificate) ([]byte, error) {
+	var embedded []*x509.Certificate
+	if cert != nil {
+		embedded = append([]*x509.Certificate{cert}, intermediates...)
+	}
+	return SignContent(signer, randReader, OIDData, content, hash, cert, embedded, detached, []Attribute{{Type: OIDSigningTime, Value: signingTime.UTC()}})
+}
+
+// SignContent is like Sign, but for content of type contentType, with the
+// further signed attributes in attrs rather than signing-time. The signer is
+// identified by cert if it is given, as with Sign, but only the embedded
+// certificates are embedded, which need not include cert.
+func SignContent(signer crypto.Signer, randReader io.Reader, contentType asn1.ObjectIdentifier, content []byte, hash crypto.Hash, cert *x509.Certificate, embedded []*x509.Certificate, detached bool, attrs []Attribute) ([]byte, error) {
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		hash = crypto.SHA512
+	}
+	digestOID, err := DigestAlgorithmOID(hash)
+	if err != nil {
+		return nil, err
+	}
+	sigAlg, scheme, err := signatureAlgorithm(signer.Public(), hash)
+	if err != nil {
+		return nil, err
+	}
+	encodedAttrs := make([]attribute, 2, 2+len(attrs))
+	if encodedAttrs[0], err = newAttribute(OIDContentType, contentType); err != nil {
+		return nil, err
+	}
+	if encodedAttrs[1], err = newAttribute(OIDMessageDigest, []byte(crypt.NewDigestHash(hash, string(content)))); err != nil {
+		return nil, err
+	}
+	for _, attr := range attrs {
+		encoded, err := newAttribute(attr.Type, attr.Value)
+		if err != nil {
+			return nil, err
+		}
+		encodedAttrs = append(encodedAttrs, encoded)
+	}
+	attrsContent, err := marshalAttributes(encodedAttrs)
+	if err != nil {
+		return nil, err
+	}
+	signedAttrs, err := attributeSet(attrsContent)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := crypt.SignWithScheme(signer, randReader, signedAttrs, scheme)
+	if err != nil {
+		return nil, err
+	}
+	info := signerInfo{
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: digestOID},
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrsContent},
+		SignatureAlgorithm: sigAlg,
+		Signature:          signature,
+	}
+	result := signedData{
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{info.DigestAlgorithm},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: contentType},
+		SignerInfos:      []signerInfo{info},
+	}
+	if !detached {
+		result.EncapContentInfo.EContent = append([]byte{}, content...)
+	}
+	if cert != nil {
+		if !crypt.PublicKeysEqual(cert.PublicKey, signer.Public()) {
+			return nil, errors.New("Certificate does not match the signing key")
+		}
+		sid, err := asn1.Marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber})
+		if err != nil {
+			return nil, err
+		}
+		result.Version = 1
+		result.SignerInfos[0].Version = 1
+		result.SignerInfos[0].SID = asn1.RawValue{FullBytes: sid}
+	} else {
+		keyID, err := SubjectKeyID(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		result.Version = 3
+		result.SignerInfos[0].Version = 3
+		result.SignerInfos[0].SID = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: keyID}
+	}
+	if len(embedded) > 0 {
+		certs := []byte{}
+		for _, embeddedCert := range embedded {
+			certs = append(certs, embeddedCert.Raw...)
+		}
+		result.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs}
+	}
+	inner, err := asn1.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	// The explicit tag of the content is ignored when marshalling a RawValue:
+	return asn1.Marshal(contentInfo{ContentType: OIDSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner}})
+}
+
+// Parse parses the DER encoding of a CMS SignedData message of data with a
+// single signer. The signature is not verified.
+func Parse(der []byte) (*SignedData, error) {
+	return ParseContent(der, OIDData)
+}
+
+// ParseContent is like Parse, but for content of type contentType.
+func ParseContent(der []byte, contentType asn1.ObjectIdentifier) (*SignedData, error) {
+	inner, err := parseSignedData(der)
+	if err != nil {
+		return nil, err
+	}
+	if !inner.EncapContentInfo.EContentType.Equal(contentType) {
+		return nil, fmt.Errorf("CMS SignedData has content type %s, but %s was expected", inner.EncapContentInfo.EContentType.String(), contentTypeName(contentType))
+	}
+	info := inner.SignerInfos[0]
+	result := &SignedData{
+		Content:      inner.EncapContentInfo.EContent,
+		ContentType:  contentType,
+		Detached:     inner.EncapContentInfo.EContent == nil,
+		sid:          info.SID,
+		signatureAlg: info.SignatureAlgorithm.Algorithm,
+		signature:    info.Signature,
+	}
+	if result.Hash, err = DigestAlgorithmHash(info.DigestAlgorithm.Algorithm); err != nil {
+		return nil, err
+	}
+	if len(inner.Certificates.Bytes) > 0 {
+		certs, err := x509.ParseCertificates(inner.Certificates.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		result.Certificates = certs
+	}
+	if err := result.parseSignedAttrs(info.SignedAttrs.Bytes); err != nil {
+		return nil, err
+	}
+	if len(info.UnsignedAttrs.Bytes) > 0 {
+		unsignedAttrs, err := attributeSet(info.UnsignedAttrs.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := asn1.UnmarshalWithParams(unsignedAttrs, &result.unsignedAttrs, "set"); err != nil {
+			return nil, fmt.Errorf("CMS unsigned attributes are not valid: %s", err.Error())
+		}
+	}
+	return result, nil
+}
+
+// contentTypeName returns the name of contentType in error messages.
+func contentTypeName(contentType asn1.ObjectIdentifier) string {
+	if contentType.Equal(OIDData) {
+		return "data"
+	}
+	return contentType.String()
+}
+
+// parseSignedData parses the DER encoding of a CMS SignedData message with a
+// single signer, returning its SignedData content.
+func parseSignedData(der []byte) (*signedData, error) {
+	outer := contentInfo{}
+	if rest, err := asn1.Unmarshal(der, &outer); err != nil {
+		return nil, fmt.Errorf("Input is not a valid CMS message: %s", err.Error())
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("CMS message is followed by %d unexpected bytes", len(rest))
+	}
+	if !outer.ContentType.Equal(OIDSignedData) {
+		return nil, fmt.Errorf("CMS message has content type %s, but SignedData was expected", outer.ContentType.String())
+	}
+	inner := &signedData{}
+	if _, err := asn1.Unmarshal(outer.Content.Bytes, inner); err != nil {
+		return nil, fmt.Errorf("Input is not a valid CMS SignedData message: %s", err.Error())
+	}
+	if len(inner.SignerInfos) != 1 {
+		return nil, fmt.Errorf("CMS SignedData has %d signers, but only 1 is supported", len(inner.SignerInfos))
+	}
+	return inner, nil
+}
+
+// AddUnsignedAttribute returns the DER encoding of the CMS SignedData
+// message der, with an unsigned attribute of type oid and the DER encoding of
+// value added to its signer. Unsigned attributes aren't covered by the
+// signature, so they may be added once it is made, as a time-stamp token of
+// the signature is.
+func AddUnsignedAttribute(der []byte, oid asn1.ObjectIdentifier, value interface{}) ([]byte, error) {
+	inner, err := parseSignedData(der)
+	if err != nil {
+		return nil, err
+	}
+	info := &inner.SignerInfos[0]
+	attrs := []attribute{}
+	if len(info.UnsignedAttrs.Bytes) > 0 {
+		unsignedAttrs, err := attributeSet(info.UnsignedAttrs.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := asn1.UnmarshalWithParams(unsignedAttrs, &attrs, "set"); err != nil {
+			return nil, fmt.Errorf("CMS unsigned attributes are not valid: %s", err.Error())
+		}
+	}
+	attr, err := newAttribute(oid, value)
+	if err != nil {
+		return nil, err
+	}
+	attrsContent, err := marshalAttributes(append(attrs, attr))
+	if err != nil {
+		return nil, err
+	}
+	info.UnsignedAttrs = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: attrsContent}
+	encoded, err := asn1.Marshal(*inner)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{ContentType: OIDSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: encoded}})
+}
+
+// parseSignedAttrs parses the content of the signed attributes, which are
+// required, and keeps their encoding as a SET OF, which is what was signed.
+func (sd *SignedData) parseSignedAttrs(content []byte) error {
+	if len(content) == 0 {
+		return errors.New("CMS signer has no signed attributes")
+	}
+	signedAttrs, err := attributeSet(content)
+	if err != nil {
+		return err
+	}
+	sd.signedAttrs = signedAttrs
+	attrs := []attribute{}
+	if _, err := asn1.UnmarshalWithParams(signedAttrs, &attrs, "set"); err != nil {
+		return fmt.Errorf("CMS signed attributes are not valid: %s", err.Error())
+	}
+	var contentType asn1.ObjectIdentifier
+	for _, attr := range attrs {
+		if len(attr.Values) != 1 {
+			return fmt.Errorf("CMS signed attribute %s has %d values, but 1 was expected", attr.Type.String(), len(attr.Values))
+		}
+		var err error
+		switch {
+		case attr.Type.Equal(OIDContentType):
+			_, err = asn1.Unmarshal(attr.Values[0].FullBytes, &contentType)
+		case attr.Type.Equal(OIDMessageDigest):
+			_, err = asn1.Unmarshal(attr.Values[0].FullBytes, &sd.messageDigest)
+		case attr.Type.Equal(OIDSigningTime):
+			_, err = asn1.Unmarshal(attr.Values[0].FullBytes, &sd.SigningTime)
+		}
+		if err != nil {
+			return fmt.Errorf("CMS signed attribute %s is not valid: %s", attr.Type.String(), err.Error())
+		}
+	}
+	if !contentType.Equal(sd.ContentType) {
+		return fmt.Errorf("CMS content-type attribute is missing, or isn't %s", contentTypeName(sd.ContentType))
+	}
+	if sd.messageDigest == nil {
+		return errors.New("CMS message-digest attribute is missing")
+	}
+	sd.attrs = attrs
+	return nil
+}
+
+// findAttribute returns the DER encoding of the value of the attribute of
+// type oid in attrs, or nil if there is none.
+func findAttribute(attrs []attribute, oid asn1.ObjectIdentifier) []byte {
+	for _, attr := range attrs {
+		if attr.Type.Equal(oid) && (len(attr.Values) > 0) {
+			return attr.Values[0].FullBytes
+		}
+	}
+	return nil
+}
+
+// SignedAttribute returns the DER encoding of the value of the signed
+// attribute of type oid, or nil if the signer has none.
+func (sd *SignedData) SignedAttribute(oid asn1.ObjectIdentifier) []byte {
+	return findAttribute(sd.attrs, oid)
+}
+
+// UnsignedAttribute returns the DER encoding of the value of the unsigned
+// attribute of type oid, or nil if the signer has none.
+func (sd *SignedData) UnsignedAttribute(oid asn1.ObjectIdentifier) []byte {
+	return findAttribute(sd.unsignedAttrs, oid)
+}
+
+// Signature returns the signature value of the signer, which is what a
+// time-stamp token of the signature covers.
+func (sd *SignedData) Signature() []byte {
+	return sd.signature
+}
+
+// Verify checks that the signer of sd is publicKey, that the message-digest
+// attribute matches the content, and that the signature of the signed
+// attributes is valid. An error explains why a signature isn't valid.
+func (sd *SignedData) Verify(publicKey crypto.PublicKey) (bool, error) {
+	if err := sd.checkSigner(publicKey); err != nil {
+		return false, err
+	}
+	if !bytes.Equal(sd.messageDigest, crypt.NewDigestHash(sd.Hash, string(sd.Content))) {
+		return false, errors.New("CMS message-digest attribute does not match the content")
+	}
+	expected, scheme, err := signatureAlgorithm(publicKey, sd.Hash)
+	if err != nil {
+		return false, err
+	}
+	if !sd.signatureAlg.Equal(expected.Algorithm) && !(expected.Algorithm.Equal(OIDRSAEncryption) && sd.signatureAlg.Equal(rsaSignatureOIDs[sd.Hash])) {
+		return false, fmt.Errorf("CMS signature algorithm %s doesn't match the public key", sd.signatureAlg.String())
+	}
+	return crypt.VerifyWithScheme(publicKey, sd.signedAttrs, crypt.BinarySignature(sd.signature), scheme)
+}
+
+// checkSigner returns an error unless the signer identifier of sd
+// identifies publicKey: either by its subject key identifier, or by the
+// issuer and serial number of an embedded certificate of it.
+func (sd *SignedData) checkSigner(publicKey crypto.PublicKey) error {
+	if (sd.sid.Class == asn1.ClassContextSpecific) && (sd.sid.Tag == 0) {
+		keyID, err := SubjectKeyID(publicKey)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(keyID, sd.sid.Bytes) {
+			return errors.New("CMS subject key identifier of signer does not match its public key")
+		}
+		return nil
+	}
+	cert, err := sd.SignerCertificate()
+	if err != nil {
+		return err
+	}
+	if !crypt.PublicKeysEqual(cert.PublicKey, publicKey) {
+		return errors.New("CMS certificate of signer does not match its public key")
+	}
+	return nil
+}
+
+// SignerCertificate returns the embedded certificate identified by the
+// issuer and serial number of the signer of sd.
+func (sd *SignedData) SignerCertificate() (*x509.Certificate, error) {
+	if (sd.sid.Class == asn1.ClassContextSpecific) && (sd.sid.Tag == 0) {
+		return nil, errors.New("CMS signer is identified by its subject key identifier, rather than a certificate")
+	}
+	sid := issuerAndSerialNumber{}
+	if _, err := asn1.Unmarshal(sd.sid.FullBytes, &sid); err != nil {
+		return nil, fmt.Errorf("CMS signer identifier is not valid: %s", err.Error())
+	}
+	for _, cert := range sd.Certificates {
+		if bytes.Equal(cert.RawIssuer, sid.Issuer.FullBytes) && (cert.SerialNumber.Cmp(sid.SerialNumber) == 0) {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("CMS certificate of signer is not embedded")
+}
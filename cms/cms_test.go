@@ -0,0 +1,277 @@
+package cms_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/smartedge/codechallenge/cms"
+	"github.com/smartedge/codechallenge/testtools"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// OpenSSLSignedData is an attached CMS message of "Hello, World!", made by
+// `openssl cms -sign -nodetach -binary -md sha256`, with an embedded
+// self-signed certificate of OpenSSLPublicKey.
+const OpenSSLSignedData = `-----BEGIN CMS-----
+MIIDRgYJKoZIhvcNAQcCoIIDNzCCAzMCAQExDTALBglghkgBZQMEAgEwHAYJKoZI
+hvcNAQcBoA8EDUhlbGxvLCBXb3JsZCGgggF/MIIBezCCASGgAwIBAgIUVv51wf1L
+1CgxNys2t8vdYVOfX58wCgYIKoZIzj0EAwIwEjEQMA4GA1UEAwwHZml4dHVyZTAg
+Fw0yNjEwMTgxOTAzMjlaGA8yMTI2MDkyNDE5MDMyOVowEjEQMA4GA1UEAwwHZml4
+dHVyZTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABFZkJZg/uGvQnOP7Pc5xoOu0
+y+EuUfiKWiLbOnPOruAQ6ARqa6wHg5tH3VyF3FiX9go0/u2Q+Za//oiB0cmVJjSj
+UzBRMB0GA1UdDgQWBBRoXHu+pVRauGLXTCLJFDaPyZWedzAfBgNVHSMEGDAWgBRo
+XHu+pVRauGLXTCLJFDaPyZWedzAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49BAMC
+A0gAMEUCIGHfwahvGmiAMhdhxaYh9eR//UV/VyVi20D0xpg3pCa/AiEAokd3lIlY
+lODGeYbfE9CWCFbLiNF+Pe2Nwv2kFv1kYAQxggF8MIIBeAIBATAqMBIxEDAOBgNV
+BAMMB2ZpeHR1cmUCFFb+dcH9S9QoMTcrNrfL3WFTn1+fMAsGCWCGSAFlAwQCAaCB
+5DAYBgkqhkiG9w0BCQMxCwYJKoZIhvcNAQcBMBwGCSqGSIb3DQEJBTEPFw0yNjEw
+MTgxOTAzMjlaMC8GCSqGSIb3DQEJBDEiBCDf/WAhuyvVsK9nYpCAnsOlMZHdgcf3
+CksoaIo2IYKYbzB5BgkqhkiG9w0BCQ8xbDBqMAsGCWCGSAFlAwQBKjALBglghkgB
+ZQMEARYwCwYJYIZIAWUDBAECMAoGCCqGSIb3DQMHMA4GCCqGSIb3DQMCAgIAgDAN
+BggqhkiG9w0DAgIBQDAHBgUrDgMCBzANBggqhkiG9w0DAgIBKDAKBggqhkjOPQQD
+AgRHMEUCIE4YY1dkkI+Ln6L3PBj41n2NubEE+CSX6eolrRbSqKQlAiEApjo7D10s
+rToVxSvFqmBqN53ids9kgXzb/+TtW1rxeA0=
+-----END CMS-----
+`
+
+// OpenSSLPublicKey is the public key that signed OpenSSLSignedData
+const OpenSSLPublicKey = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEVmQlmD+4a9Cc4/s9znGg67TL4S5R
++IpaIts6c86u4BDoBGprrAeDm0fdXIXcWJf2CjT+7ZD5lr/+iIHRyZUmNA==
+-----END PUBLIC KEY-----
+`
+
+// selfSignedCertificate returns a certificate of signer, signed by itself.
+func selfSignedCertificate(t *testing.T, signer crypto.Signer) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Unix(1567339200, 0),
+		NotAfter:     time.Unix(1567339200, 0).Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return cert
+}
+
+// TestSignAndVerify verifies that signed messages parse back to valid
+// signatures for each kind of key, identified by certificate or by subject
+// key identifier, and that changes to the content are detected.
+func TestSignAndVerify(t *testing.T) {
+	ecdsaP256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecdsaP384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	signingTime := time.Unix(1567339200, 0)
+	for desc, tc := range map[string]struct {
+		signer       crypto.Signer
+		hash         crypto.Hash
+		expectedHash crypto.Hash
+		withCert     bool
+		detached     bool
+	}{
+		"ECDSA P-256":                 {signer: ecdsaP256, hash: crypto.SHA256, expectedHash: crypto.SHA256},
+		"ECDSA P-384 with SHA-384":    {signer: ecdsaP384, hash: crypto.SHA384, expectedHash: crypto.SHA384},
+		"Ed25519 always uses SHA-512": {signer: ed25519Key, hash: crypto.SHA256, expectedHash: crypto.SHA512},
+		"RSA":                         {signer: rsaKey, hash: crypto.SHA256, expectedHash: crypto.SHA256},
+		"Certificate":                 {signer: ecdsaP256, hash: crypto.SHA256, expectedHash: crypto.SHA256, withCert: true},
+		"Detached":                    {signer: rsaKey, hash: crypto.SHA512, expectedHash: crypto.SHA512, detached: true},
+		"Detached with certificate":   {signer: ed25519Key, hash: crypto.SHA512, expectedHash: crypto.SHA512, withCert: true, detached: true},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			var cert *x509.Certificate
+			if tc.withCert {
+				cert = selfSignedCertificate(tt, tc.signer)
+			}
+			content := []byte("Hello, World!")
+			der, err := cms.Sign(tc.signer, rand.Reader, content, tc.hash, cert, tc.detached, signingTime)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			parsed, err := cms.Parse(der)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if parsed.Detached != tc.detached {
+				tt.Errorf("Parsed message should have Detached %t.", tc.detached)
+			}
+			if parsed.Hash != tc.expectedHash {
+				tt.Errorf("Parsed hash should be %d. Got %d instead.", tc.expectedHash, parsed.Hash)
+			}
+			if !parsed.SigningTime.Equal(signingTime) {
+				tt.Errorf("Parsed signing time should be %s. Got %s instead.", signingTime, parsed.SigningTime)
+			}
+			if len(parsed.Certificates) != map[bool]int{false: 0, true: 1}[tc.withCert] {
+				tt.Errorf("Parsed message has %d certificates.", len(parsed.Certificates))
+			}
+			if tc.detached {
+				parsed.Content = content
+			}
+			if valid, err := parsed.Verify(tc.signer.Public()); !valid {
+				tt.Errorf("Signature should be valid: %v", err)
+			}
+			parsed.Content = []byte("Goodbye, World!")
+			valid, err := parsed.Verify(tc.signer.Public())
+			expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CMS message-digest attribute does not match the content"}
+			if err := expectedErr.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+			if valid {
+				tt.Error("Signature of changed content should not be valid")
+			}
+		})
+	}
+}
+
+// TestVerifyOtherKey verifies that a signature isn't valid for another key,
+// whether the signer is identified by certificate or by subject key
+// identifier.
+func TestVerifyOtherKey(t *testing.T) {
+	signer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	for desc, tc := range map[string]struct {
+		cert *x509.Certificate
+		err  *testtools.ErrorSpec
+	}{
+		"Subject key identifier": {
+			err: &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CMS subject key identifier of signer does not match its public key"},
+		},
+		"Certificate": {
+			cert: selfSignedCertificate(t, signer),
+			err:  &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CMS certificate of signer does not match its public key"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			der, err := cms.Sign(signer, rand.Reader, []byte("Hello, World!"), crypto.SHA256, tc.cert, false, time.Now())
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			parsed, err := cms.Parse(der)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			valid, err := parsed.Verify(other.Public())
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+			if valid {
+				tt.Error("Signature should not be valid for another key")
+			}
+		})
+	}
+	_, err := cms.Sign(signer, rand.Reader, []byte("Hello, World!"), crypto.SHA256, selfSignedCertificate(t, other), false, time.Now())
+	expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Certificate does not match the signing key"}
+	if err := expectedErr.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+// TestSignerCertificate verifies that intermediates are embedded along with
+// the certificate of the signer, which identifies it.
+func TestSignerCertificate(t *testing.T) {
+	signer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := selfSignedCertificate(t, signer)
+	intermediate := selfSignedCertificate(t, other)
+	der, err := cms.Sign(signer, rand.Reader, []byte("Hello, World!"), crypto.SHA256, cert, false, time.Now(), intermediate)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	parsed, err := cms.Parse(der)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if (len(parsed.Certificates) != 2) || !parsed.Certificates[1].Equal(intermediate) {
+		t.Errorf("CMS message should embed the certificate and intermediate. Got %d certificates instead.", len(parsed.Certificates))
+	}
+	if signerCert, err := parsed.SignerCertificate(); (err != nil) || !signerCert.Equal(cert) {
+		t.Errorf("Signer certificate should be the certificate of the signing key: %v", err)
+	}
+	if valid, err := parsed.Verify(signer.Public()); !valid || (err != nil) {
+		t.Errorf("Signature should be valid: %v", err)
+	}
+	der, err = cms.Sign(signer, rand.Reader, []byte("Hello, World!"), crypto.SHA256, nil, false, time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	parsed, err = cms.Parse(der)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	_, err = parsed.SignerCertificate()
+	expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CMS signer is identified by its subject key identifier, rather than a certificate"}
+	if err := expectedErr.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+// TestOpenSSLSignedData verifies a message signed by OpenSSL, which has
+// signed attributes beyond those this package adds.
+func TestOpenSSLSignedData(t *testing.T) {
+	block, _ := pem.Decode([]byte(OpenSSLSignedData))
+	parsed, err := cms.Parse(block.Bytes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if string(parsed.Content) != "Hello, World!" {
+		t.Errorf("Parsed content should be \"Hello, World!\". Got %#v instead.", string(parsed.Content))
+	}
+	if expected := time.Date(2026, 10, 18, 19, 3, 29, 0, time.UTC); !parsed.SigningTime.Equal(expected) {
+		t.Errorf("Parsed signing time should be %s. Got %s instead.", expected, parsed.SigningTime)
+	}
+	if len(parsed.Certificates) != 1 {
+		t.Errorf("Parsed message should have 1 certificate. Got %d instead.", len(parsed.Certificates))
+	}
+	keyBlock, _ := pem.Decode([]byte(OpenSSLPublicKey))
+	publicKey, err := x509.ParsePKIXPublicKey(keyBlock.Bytes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if valid, err := parsed.Verify(publicKey); !valid {
+		t.Errorf("Signature should be valid: %v", err)
+	}
+}
+
+// TestParseErrors tests messages that can't be parsed.
+func TestParseErrors(t *testing.T) {
+	data, _ := pem.Decode([]byte(OpenSSLSignedData))
+	for desc, tc := range map[string]struct {
+		der []byte
+		err *testtools.ErrorSpec
+	}{
+		"Truncated": {
+			der: data.Bytes[:2],
+			err: &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Input is not a valid CMS message: asn1: syntax error: truncated tag or length"},
+		},
+		"Trailing bytes": {
+			der: append(append([]byte{}, data.Bytes...), 0),
+			err: &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CMS message is followed by 1 unexpected bytes"},
+		},
+		"Enveloped data": {
+			der: []byte{0x30, 0x0f, 0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x07, 0x03, 0xa0, 0x02, 0x30, 0x00},
+			err: &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CMS message has content type 1.2.840.113549.1.7.3, but SignedData was expected"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			_, err := cms.Parse(tc.der)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package codechallenge_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/smartedge/codechallenge/cms"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"math/big"
+	"testing"
+)
+
+// writeCertificate writes a self-signed certificate of the ECDSA private key
+// in the file privPath to the file certPath.
+func writeCertificate(t *testing.T, files testtools.FakeFileSystem, privPath string, certPath string) {
+	block, _ := pem.Decode([]byte(*files[privPath]))
+	if block == nil {
+		t.Fatalf("File %s does not contain a PEM encoded key", privPath)
+	}
+	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing private key: %s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "anybody"},
+		NotBefore:    mocks.MockCurrentTime,
+		NotAfter:     mocks.MockCurrentTime.AddDate(1, 0, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, privateKey.Public(), privateKey)
+	if err != nil {
+		t.Fatalf("Unexpected error creating certificate: %s", err.Error())
+	}
+	files[certPath] = testtools.StringPtr(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+}
+
+// TestSignAndVerifyCMS verifies that CMS output written by RealMain can be
+// verified in -verify mode, in DER or PEM, attached or detached, and with or
+// without an embedded certificate.
+func TestSignAndVerifyCMS(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signArgs    []string
+		pem         bool
+		detached    bool
+		certificate bool
+		verifyArgs  []string
+		status      int
+		stdOutput   testtools.StringMatcher
+		stdErr      testtools.StringMatcher
+	}{
+		"DER": {
+			signArgs:   []string{"codechallenge", "-format", "cms"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cms"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"PEM with SHA-384": {
+			signArgs:   []string{"codechallenge", "-format", "cms-pem", "-hash", "sha384"},
+			pem:        true,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cms-pem"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"RSA": {
+			signArgs:   []string{"codechallenge", "-rsa", "-format", "cms"},
+			verifyArgs: []string{"codechallenge", "-rsa", "-verify", "-format", "cms"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Ed25519": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "cms"},
+			verifyArgs: []string{"codechallenge", "-ed25519", "-verify", "-format", "cms"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Embedded certificate": {
+			signArgs:    []string{"codechallenge", "-format", "cms-pem", "-cert", "signer.crt"},
+			pem:         true,
+			certificate: true,
+			verifyArgs:  []string{"codechallenge", "-verify", "-format", "cms-pem"},
+			status:      0,
+			stdOutput:   testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:      testtools.NewStringStringMatcher(""),
+		},
+		"Detached with payload file": {
+			signArgs:   []string{"codechallenge", "-format", "cms", "-detached"},
+			detached:   true,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cms", "-payload", "hello.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Detached with the wrong payload file": {
+			signArgs:   []string{"codechallenge", "-format", "cms", "-detached"},
+			detached:   true,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cms", "-payload", "goodbye.txt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"CMS message-digest attribute does not match the content\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Detached without payload file": {
+			signArgs:   []string{"codechallenge", "-format", "cms", "-detached"},
+			detached:   true,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cms"},
+			status:     3,
+			stdOutput:  testtools.NewStringStringMatcher(""),
+			stdErr:     testtools.NewStringStringMatcher("CMS content is detached, which requires -payload\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"DER verified as PEM": {
+			signArgs:   []string{"codechallenge", "-format", "cms"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cms-pem"},
+			status:     2,
+			stdOutput:  testtools.NewStringStringMatcher(""),
+			stdErr:     testtools.NewStringStringMatcher("Input is not a PEM encoded CMS message\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Verified with the wrong key": {
+			signArgs:   []string{"codechallenge", "-format", "cms"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cms", "-public", "other.pub"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"CMS subject key identifier of signer does not match its public key\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/hello.txt":   testtools.StringPtr("Hello, World!"),
+				"/home/anybody/goodbye.txt": testtools.StringPtr("Goodbye, World!"),
+			}
+			// An unrelated key-pair, to verify with, and the default key-pair,
+			// to certify:
+			testtools.AddOtherKeyPair(files, "/home/anybody")
+			runMain(tt, &files, "Hello, World!")
+			if tc.certificate {
+				writeCertificate(tt, files, "/home/anybody/.smartEdge/id_ecdsa.priv", "/home/anybody/signer.crt")
+			}
+			signBundle := runMain(tt, &files, "Hello, World!", tc.signArgs[1:]...)
+			if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+			}
+			der := signBundle.OutBuf.Bytes()
+			if tc.pem {
+				block, _ := pem.Decode(der)
+				if (block == nil) || (block.Type != cms.PEMType) {
+					tt.Fatalf("Output should be PEM encoded CMS. Got:\n%s", signBundle.OutBuf.String())
+				}
+				der = block.Bytes
+			}
+			signed, err := cms.Parse(der)
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing CMS message: %s", err.Error())
+			}
+			if signed.Detached != tc.detached {
+				tt.Errorf("CMS message should have Detached %t.", tc.detached)
+			}
+			if len(signed.Certificates) != map[bool]int{false: 0, true: 1}[tc.certificate] {
+				tt.Errorf("CMS message has %d certificates.", len(signed.Certificates))
+			}
+			if !signed.SigningTime.Equal(mocks.MockCurrentTime) {
+				tt.Errorf("CMS signing time should be %s. Got %s instead.", mocks.MockCurrentTime, signed.SigningTime)
+			}
+			verifyBundle := runMain(tt, &files, signBundle.OutBuf.String(), tc.verifyArgs[1:]...)
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if err := tc.stdErr.MatchString(verifyBundle.ErrBuf.String()); err != nil {
+				tt.Errorf("Standard Error:\n%#v didn't match:\n%s.", verifyBundle.ErrBuf.String(), err.Error())
+			}
+		})
+	}
+}
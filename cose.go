@@ -0,0 +1,201 @@
+package codechallenge
+
+import (
+	"bytes"
+	"errors"
+	"github.com/smartedge/codechallenge/cose"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/jws"
+	"io/ioutil"
+)
+
+// NewCOSEAlgorithm returns the algorithm for signing with the keys in
+// cryptStuff: the one in settings if given, or otherwise the one determined
+// by the key.
+func NewCOSEAlgorithm(cryptStuff *crypt.CryptoTooling, settings *OutputSettings) (string, error) {
+	if settings.JWSAlgorithm != "" {
+		return settings.JWSAlgorithm, nil
+	}
+	return jws.AlgorithmForKey(cryptStuff.Signer.Public(), crypt.PSSPadding)
+}
+
+// NewSignedCOSE signs message with the keys in cryptStuff as a COSE_Sign1
+// message, according to settings. The kid of the key is always included.
+func NewSignedCOSE(d *deps.Dependencies, cryptStuff *crypt.CryptoTooling, message []byte, settings *OutputSettings) (*cose.Sign1, error) {
+	alg, err := NewCOSEAlgorithm(cryptStuff, settings)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := cose.KeyID(cryptStuff.Signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return cose.Sign(cryptStuff.Signer, d.Crypto.Rand.Reader, message, alg, kid, settings.Detached)
+}
+
+// SignCOSEMain signs message as a COSE_Sign1 message with the keys in
+// cryptStuff, and writes it to d.Os.Stdout in binary.
+func SignCOSEMain(d *deps.Dependencies, config *RunConfig, cryptStuff *crypt.CryptoTooling, message string) {
+	signed, err := NewSignedCOSE(d, cryptStuff, []byte(message), &config.Output)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	valid, err := signed.Verify(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	buff, err := signed.Marshal()
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	err = WriteOutput(d, buff)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// VerifyCOSEMain is the entry-point for -verify mode with COSE input. It
+// reads a COSE_Sign1 message from d.Os.Stdin, and writes the verdict in JSON
+// format to d.Os.Stdout, exiting with the verdict's exit status if it isn't
+// valid.
+func VerifyCOSEMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	signed, err := cose.Parse(buff)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyCOSE(d, config, signed)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyCOSE checks the signature of signed against the public key file in
+// config. A detached payload is read from the file in config.
+func VerifyCOSE(d *deps.Dependencies, config *RunConfig, signed *cose.Sign1) (*Verdict, error) {
+	if signed.Detached {
+		if config.Output.PayloadPath == "" {
+			return nil, errors.New("COSE_Sign1 payload is detached, which requires -payload")
+		}
+		payload, err := d.Io.Ioutil.ReadFile(config.Output.PayloadPath)
+		if err != nil {
+			return nil, err
+		}
+		signed.Payload = payload
+	} else if config.Output.PayloadPath != "" {
+		return nil, errors.New("Option -payload is only valid for a detached COSE_Sign1 message")
+	}
+	publicKey, err := loadPublicKey(d, config.PubKeySettings.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(signed.KeyID) > 0 {
+		kid, err := cose.KeyID(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(kid, signed.KeyID) {
+			return NewVerdict(BadSignature, "kid of signature does not match its public key"), nil
+		}
+	}
+	return newVerdictFromVerification(signed.Verify(publicKey)), nil
+}
+
+// CWTMain is the entry-point for the cwt command. It writes a signed CWT of
+// the claims in config to d.Os.Stdout, in binary.
+func CWTMain(d *deps.Dependencies, config *RunConfig) {
+	claims, err := NewJWTClaims(d, &config.JWT)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	alg, err := NewCOSEAlgorithm(cryptStuff, &config.Output)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	kid, err := cose.KeyID(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	token, err := cose.SignCWT(cryptStuff.Signer, d.Crypto.Rand.Reader, claims, alg, kid)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	signed, _, err := cose.ParseCWT(token)
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	valid, err := signed.Verify(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	err = WriteOutput(d, token)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// VerifyCWTMain is the entry-point for the verify-cwt command. It reads a CWT
+// from d.Os.Stdin, and writes the verdict in JSON format to d.Os.Stdout, with
+// the claims in their JWT form, exiting with the verdict's exit status if it
+// isn't valid.
+func VerifyCWTMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyCWT(d, config, buff)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyCWT checks the signature of token, and then its claims, in the same
+// way as VerifyJWT.
+func VerifyCWT(d *deps.Dependencies, config *RunConfig, token []byte) (*JWTVerdict, error) {
+	signed, claims, err := cose.ParseCWT(token)
+	if err != nil {
+		return nil, err
+	}
+	verdict, err := VerifyCOSE(d, config, signed)
+	if err != nil {
+		return nil, err
+	}
+	if !verdict.Valid {
+		return &JWTVerdict{Verdict: verdict}, nil
+	}
+	return &JWTVerdict{Verdict: ValidateClaims(d, &config.JWT, claims), Claims: claims}, nil
+}
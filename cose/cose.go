@@ -0,0 +1,226 @@
+// Package cose implements COSE_Sign1 messages, as defined by RFC 9052, and
+// CBOR Web Tokens signed with them, as defined by RFC 8392.
+package cose
+
+import (
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/cbor"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/jws"
+	"io"
+)
+
+// CBOR tags identifying COSE structures
+const (
+	Sign1Tag uint64 = 18
+	CWTTag   uint64 = 61
+)
+
+// Header parameter labels, from RFC 9052
+const (
+	HeaderAlgorithm int64 = 1
+	HeaderCritical  int64 = 2
+	HeaderKeyID     int64 = 4
+)
+
+// algorithmIDs maps the names of the supported algorithms, which are shared
+// with JWS, to their COSE algorithm identifiers.
+var algorithmIDs = map[string]int64{
+	jws.ES256: -7,
+	jws.ES384: -35,
+	jws.ES512: -36,
+	jws.EdDSA: -8,
+	jws.PS256: -37,
+	jws.RS256: -257,
+}
+
+// AlgorithmID returns the COSE algorithm identifier of the algorithm named
+// alg.
+func AlgorithmID(alg string) (int64, error) {
+	id, ok := algorithmIDs[alg]
+	if !ok {
+		return 0, fmt.Errorf("Unsupported COSE algorithm %#v", alg)
+	}
+	return id, nil
+}
+
+// AlgorithmName returns the name of the algorithm with the COSE algorithm
+// identifier id.
+func AlgorithmName(id int64) (string, error) {
+	for name, algID := range algorithmIDs {
+		if algID == id {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("Unsupported COSE algorithm %d", id)
+}
+
+// KeyID returns the kid of publicKey: its JWK thumbprint, as the raw bytes
+// rather than the base64url encoding JWS uses.
+func KeyID(publicKey crypto.PublicKey) ([]byte, error) {
+	thumbprint, err := jws.KeyID(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return base64.RawURLEncoding.DecodeString(thumbprint)
+}
+
+// Sign1 is a COSE_Sign1 message: a payload with a single signature. A
+// detached message doesn't include its payload, which must be provided
+// separately before it can be verified.
+type Sign1 struct {
+	Protected []byte
+	Algorithm string
+	KeyID     []byte
+	Payload   []byte
+	Detached  bool
+	Signature crypt.BinarySignature
+}
+
+// Sign returns a COSE_Sign1 message of payload, signed by signer with the
+// algorithm named alg. The algorithm and kid are protected headers.
+func Sign(signer crypto.Signer, randReader io.Reader, payload []byte, alg string, kid []byte, detached bool) (*Sign1, error) {
+	algID, err := AlgorithmID(alg)
+	if err != nil {
+		return nil, err
+	}
+	scheme, err := jws.SchemeForAlgorithm(alg, signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	header := cbor.Map{HeaderAlgorithm: algID}
+	if len(kid) > 0 {
+		header[HeaderKeyID] = kid
+	}
+	protected, err := cbor.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	result := &Sign1{
+		Protected: protected,
+		Algorithm: alg,
+		KeyID:     kid,
+		Payload:   payload,
+		Detached:  detached,
+	}
+	toBeSigned, err := result.SigStructure()
+	if err != nil {
+		return nil, err
+	}
+	result.Signature, err = crypt.SignWithScheme(signer, randReader, toBeSigned, scheme)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SigStructure returns what the message signs: the Sig_structure of its
+// protected header and payload, with no externally supplied data.
+func (s *Sign1) SigStructure() ([]byte, error) {
+	return cbor.Marshal([]interface{}{"Signature1", s.Protected, []byte{}, s.Payload})
+}
+
+// Verify checks the signature of the message against publicKey. An error
+// explains why a signature isn't valid.
+func (s *Sign1) Verify(publicKey crypto.PublicKey) (bool, error) {
+	scheme, err := jws.SchemeForAlgorithm(s.Algorithm, publicKey)
+	if err != nil {
+		return false, err
+	}
+	toBeSigned, err := s.SigStructure()
+	if err != nil {
+		return false, err
+	}
+	return crypt.VerifyWithScheme(publicKey, toBeSigned, s.Signature, scheme)
+}
+
+// untagged returns the message as an untagged COSE_Sign1 array.
+func (s *Sign1) untagged() []interface{} {
+	var payload interface{}
+	if !s.Detached {
+		payload = s.Payload
+	}
+	return []interface{}{s.Protected, cbor.Map{}, payload, []byte(s.Signature)}
+}
+
+// Marshal returns the message as a tagged COSE_Sign1 structure.
+func (s *Sign1) Marshal() ([]byte, error) {
+	return cbor.Marshal(cbor.Tag{Number: Sign1Tag, Content: s.untagged()})
+}
+
+// Parse parses a COSE_Sign1 message, which may or may not be tagged.
+func Parse(data []byte) (*Sign1, error) {
+	item, err := cbor.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseItem(item)
+}
+
+// parseItem parses a decoded COSE_Sign1 message.
+func parseItem(item interface{}) (*Sign1, error) {
+	if tag, ok := item.(cbor.Tag); ok {
+		if tag.Number != Sign1Tag {
+			return nil, fmt.Errorf("CBOR tag %d is not a COSE_Sign1 message", tag.Number)
+		}
+		item = tag.Content
+	}
+	parts, ok := item.([]interface{})
+	if !ok || (len(parts) != 4) {
+		return nil, errors.New("COSE_Sign1 message must be an array of 4 items")
+	}
+	protected, ok := parts[0].([]byte)
+	if !ok {
+		return nil, errors.New("COSE_Sign1 protected header must be a byte string")
+	}
+	if _, ok := parts[1].(cbor.Map); !ok {
+		return nil, errors.New("COSE_Sign1 unprotected header must be a map")
+	}
+	signature, ok := parts[3].([]byte)
+	if !ok {
+		return nil, errors.New("COSE_Sign1 signature must be a byte string")
+	}
+	result := &Sign1{
+		Protected: protected,
+		Signature: crypt.BinarySignature(signature),
+	}
+	switch payload := parts[2].(type) {
+	case []byte:
+		result.Payload = payload
+	case nil:
+		result.Detached = true
+	default:
+		return nil, errors.New("COSE_Sign1 payload must be a byte string or nil")
+	}
+	header := cbor.Map{}
+	if len(protected) > 0 {
+		decoded, err := cbor.Unmarshal(protected)
+		if err != nil {
+			return nil, fmt.Errorf("COSE_Sign1 protected header is not valid: %s", err.Error())
+		}
+		if header, ok = decoded.(cbor.Map); !ok {
+			return nil, errors.New("COSE_Sign1 protected header must be a map")
+		}
+	}
+	if _, ok := header[HeaderCritical]; ok {
+		return nil, errors.New("COSE critical header parameters are not supported")
+	}
+	algID, ok := header[HeaderAlgorithm].(int64)
+	if !ok {
+		return nil, errors.New("COSE_Sign1 protected header must include an integer algorithm")
+	}
+	algorithm, err := AlgorithmName(algID)
+	if err != nil {
+		return nil, err
+	}
+	result.Algorithm = algorithm
+	if kid, ok := header[HeaderKeyID]; ok {
+		if result.KeyID, ok = kid.([]byte); !ok {
+			return nil, errors.New("COSE_Sign1 kid must be a byte string")
+		}
+	}
+	return result, nil
+}
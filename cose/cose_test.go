@@ -0,0 +1,241 @@
+package cose_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/smartedge/codechallenge/cbor"
+	"github.com/smartedge/codechallenge/cose"
+	"github.com/smartedge/codechallenge/jws"
+	"github.com/smartedge/codechallenge/jwt"
+	"github.com/smartedge/codechallenge/testtools"
+	"testing"
+)
+
+// RFC8392ClaimsSet is the example CWT claims set from RFC 8392, appendix A.1
+const RFC8392ClaimsSet = "a70175636f61703a2f2f61732e6578616d706c652e636f6d02656572696b77037818636f61703a2f2f6c696768742e6578616d706c652e636f6d041a5612aeb0051a5610d9f0061a5610d9f007420b71"
+
+// TestSignAndParse verifies that signed messages parse back to valid
+// signatures for each algorithm, and that ECDSA signatures are raw r||s.
+func TestSignAndParse(t *testing.T) {
+	ecdsaP256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecdsaP384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for desc, tc := range map[string]struct {
+		signer   crypto.Signer
+		alg      string
+		detached bool
+		sigLen   int
+	}{
+		"ES256":          {signer: ecdsaP256, alg: jws.ES256, sigLen: 64},
+		"ES384":          {signer: ecdsaP384, alg: jws.ES384, sigLen: 96},
+		"EdDSA":          {signer: ed25519Key, alg: jws.EdDSA, sigLen: 64},
+		"PS256":          {signer: rsaKey, alg: jws.PS256, sigLen: 256},
+		"RS256":          {signer: rsaKey, alg: jws.RS256, sigLen: 256},
+		"Detached ES256": {signer: ecdsaP256, alg: jws.ES256, detached: true, sigLen: 64},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			kid, err := cose.KeyID(tc.signer.Public())
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			payload := []byte("Hello, World!")
+			signed, err := cose.Sign(tc.signer, rand.Reader, payload, tc.alg, kid, tc.detached)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			encoded, err := signed.Marshal()
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			parsed, err := cose.Parse(encoded)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if parsed.Algorithm != tc.alg {
+				tt.Errorf("Parsed algorithm should be %s. Got %s instead.", tc.alg, parsed.Algorithm)
+			}
+			if hex.EncodeToString(parsed.KeyID) != hex.EncodeToString(kid) {
+				tt.Errorf("Parsed kid should be %x. Got %x instead.", kid, parsed.KeyID)
+			}
+			if parsed.Detached != tc.detached {
+				tt.Errorf("Parsed message should have Detached %t.", tc.detached)
+			}
+			if len(parsed.Signature) != tc.sigLen {
+				tt.Errorf("Signature should be %d bytes. Got %d instead.", tc.sigLen, len(parsed.Signature))
+			}
+			if tc.detached {
+				parsed.Payload = payload
+			}
+			if valid, err := parsed.Verify(tc.signer.Public()); !valid {
+				tt.Errorf("Signature should be valid: %v", err)
+			}
+			parsed.Payload = []byte("Goodbye, World!")
+			if valid, _ := parsed.Verify(tc.signer.Public()); valid {
+				tt.Error("Signature of a different payload should not be valid")
+			}
+		})
+	}
+}
+
+// TestParseErrors tests messages that aren't valid COSE_Sign1 messages.
+func TestParseErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		encoded string
+		err     *testtools.ErrorSpec
+	}{
+		"Not an array": {
+			encoded: "a0",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "COSE_Sign1 message must be an array of 4 items"},
+		},
+		"Tagged, with no algorithm": {
+			encoded: "d28440a0f640",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "COSE_Sign1 protected header must include an integer algorithm"},
+		},
+		"COSE_Sign tag": {
+			encoded: "d8628440a0f640",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CBOR tag 98 is not a COSE_Sign1 message"},
+		},
+		"No algorithm": {
+			encoded: "8440a0f640",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "COSE_Sign1 protected header must include an integer algorithm"},
+		},
+		"Unsupported algorithm": {
+			encoded: "8443a10105a0f640",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported COSE algorithm 5"},
+		},
+		"Critical header": {
+			encoded: "8446a2012602810fa0f640",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "COSE critical header parameters are not supported"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			data, err := hex.DecodeString(tc.encoded)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			_, err = cose.Parse(data)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
+
+// TestCWTClaims tests converting the example claims set from RFC 8392 to JWT
+// claims and back.
+func TestCWTClaims(t *testing.T) {
+	data, _ := hex.DecodeString(RFC8392ClaimsSet)
+	decoded, err := cbor.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	claims, err := cose.ParseCWTClaims(decoded.(cbor.Map))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	actual, _ := json.Marshal(claims)
+	expected := `{"iss":"coap://as.example.com","sub":"erikw","aud":"coap://light.example.com","exp":1444064944,"nbf":1443944944,"iat":1443944944,"jti":"\u000bq"}`
+	if string(actual) != expected {
+		t.Errorf("Claims:\n%s when expecting:\n%s", string(actual), expected)
+	}
+	cwtClaims, err := cose.NewCWTClaims(claims)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	encoded, err := cbor.Marshal(cwtClaims)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if hex.EncodeToString(encoded) != RFC8392ClaimsSet {
+		t.Errorf("Claims set encoded as:\n%x when expecting:\n%s", encoded, RFC8392ClaimsSet)
+	}
+}
+
+// TestExtraCWTClaims tests converting claims that aren't registered.
+func TestExtraCWTClaims(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		extra    string
+		expected string
+		err      *testtools.ErrorSpec
+	}{
+		"Named claims": {
+			extra:    `{"scope":["read",7],"admin":false}`,
+			expected: `{"admin":false,"scope":["read",7]}`,
+		},
+		"Integer keyed claim": {
+			extra:    `{"-260":{"a":null}}`,
+			expected: `{"-260":{"a":null}}`,
+		},
+		"Fractional number": {
+			extra: `{"ratio":0.5}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CWT claim ratio: only integer numbers are supported, not 0.5"},
+		},
+		"Registered claim key": {
+			extra: `{"4":1}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "CWT claim 4 conflicts with a registered claim"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			claims := &jwt.Claims{}
+			if err := json.Unmarshal([]byte(tc.extra), claims); err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			cwtClaims, err := cose.NewCWTClaims(claims)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Fatal(err.Error())
+			}
+			if tc.err != nil {
+				return
+			}
+			parsed, err := cose.ParseCWTClaims(cwtClaims)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			actual, _ := json.Marshal(parsed)
+			if string(actual) != tc.expected {
+				tt.Errorf("Claims:\n%s when expecting:\n%s", string(actual), tc.expected)
+			}
+		})
+	}
+}
+
+// TestSignAndParseCWT verifies that a signed CWT is tagged as one, and parses
+// back to the same claims and a valid signature.
+func TestSignAndParseCWT(t *testing.T) {
+	signer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	issuedAt := jwt.NumericDate(1567339200)
+	claims := &jwt.Claims{
+		Issuer:   "me",
+		Audience: jwt.Audience{"you", "them"},
+		IssuedAt: &issuedAt,
+		ID:       "1",
+	}
+	token, err := cose.SignCWT(signer, rand.Reader, claims, jws.ES256, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	// Tag 61 followed by tag 18:
+	if prefix := hex.EncodeToString(token[:3]); prefix != "d83dd2" {
+		t.Errorf("CWT should start with tags d83dd2. Got %s instead.", prefix)
+	}
+	signed, parsedClaims, err := cose.ParseCWT(token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if valid, err := signed.Verify(signer.Public()); !valid {
+		t.Errorf("CWT signature should be valid: %v", err)
+	}
+	expected, _ := json.Marshal(claims)
+	actual, _ := json.Marshal(parsedClaims)
+	if string(actual) != string(expected) {
+		t.Errorf("Parsed claims:\n%s when expecting:\n%s", string(actual), string(expected))
+	}
+}
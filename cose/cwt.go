@@ -0,0 +1,273 @@
+package cose
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/cbor"
+	"github.com/smartedge/codechallenge/jwt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// CWT claim keys, from RFC 8392
+const (
+	ClaimIssuer    int64 = 1
+	ClaimSubject   int64 = 2
+	ClaimAudience  int64 = 3
+	ClaimExpiresAt int64 = 4
+	ClaimNotBefore int64 = 5
+	ClaimIssuedAt  int64 = 6
+	ClaimID        int64 = 7
+)
+
+// NewCWTClaims returns the CWT claims set equivalent to the JWT claims. Any
+// claim that isn't registered is keyed by its name, or by an integer if its
+// name is one. The jti claim becomes the cti byte string.
+func NewCWTClaims(claims *jwt.Claims) (cbor.Map, error) {
+	result := cbor.Map{}
+	if claims.Issuer != "" {
+		result[ClaimIssuer] = claims.Issuer
+	}
+	if claims.Subject != "" {
+		result[ClaimSubject] = claims.Subject
+	}
+	if len(claims.Audience) == 1 {
+		result[ClaimAudience] = claims.Audience[0]
+	} else if len(claims.Audience) > 1 {
+		audience := make([]interface{}, len(claims.Audience))
+		for i, aud := range claims.Audience {
+			audience[i] = aud
+		}
+		result[ClaimAudience] = audience
+	}
+	for key, date := range map[int64]*jwt.NumericDate{
+		ClaimExpiresAt: claims.ExpiresAt,
+		ClaimNotBefore: claims.NotBefore,
+		ClaimIssuedAt:  claims.IssuedAt,
+	} {
+		if date != nil {
+			result[key] = int64(*date)
+		}
+	}
+	if claims.ID != "" {
+		result[ClaimID] = []byte(claims.ID)
+	}
+	for name, rawValue := range claims.Extra {
+		value, err := fromJSON(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("CWT claim %s: %s", name, err.Error())
+		}
+		if key, err := strconv.ParseInt(name, 10, 64); err == nil {
+			if (key >= ClaimIssuer) && (key <= ClaimID) {
+				return nil, fmt.Errorf("CWT claim %s conflicts with a registered claim", name)
+			}
+			result[key] = value
+		} else {
+			result[name] = value
+		}
+	}
+	return result, nil
+}
+
+// ParseCWTClaims returns the JWT claims equivalent to the CWT claims set. A
+// cti that isn't valid UTF-8 becomes a base64url encoded jti.
+func ParseCWTClaims(claims cbor.Map) (*jwt.Claims, error) {
+	result := &jwt.Claims{}
+	for key, value := range claims {
+		var ok bool
+		switch key {
+		case ClaimIssuer:
+			result.Issuer, ok = value.(string)
+		case ClaimSubject:
+			result.Subject, ok = value.(string)
+		case ClaimAudience:
+			switch typed := value.(type) {
+			case string:
+				result.Audience, ok = jwt.Audience{typed}, true
+			case []interface{}:
+				ok = true
+				for _, item := range typed {
+					aud, isString := item.(string)
+					ok = ok && isString
+					result.Audience = append(result.Audience, aud)
+				}
+			}
+		case ClaimExpiresAt, ClaimNotBefore, ClaimIssuedAt:
+			var seconds int64
+			if seconds, ok = value.(int64); ok {
+				date := jwt.NumericDate(seconds)
+				switch key {
+				case ClaimExpiresAt:
+					result.ExpiresAt = &date
+				case ClaimNotBefore:
+					result.NotBefore = &date
+				default:
+					result.IssuedAt = &date
+				}
+			}
+		case ClaimID:
+			var cti []byte
+			if cti, ok = value.([]byte); ok {
+				if utf8.Valid(cti) {
+					result.ID = string(cti)
+				} else {
+					result.ID = base64.RawURLEncoding.EncodeToString(cti)
+				}
+			}
+		default:
+			name := fmt.Sprint(key)
+			rawValue, err := toJSON(value)
+			if err != nil {
+				return nil, fmt.Errorf("CWT claim %s: %s", name, err.Error())
+			}
+			if result.Extra == nil {
+				result.Extra = map[string]json.RawMessage{}
+			}
+			result.Extra[name] = rawValue
+			ok = true
+		}
+		if !ok {
+			return nil, fmt.Errorf("CWT claim %v has the wrong type: %T", key, value)
+		}
+	}
+	return result, nil
+}
+
+// fromJSON converts a JSON value to CBOR. Numbers must be integers.
+func fromJSON(rawValue json.RawMessage) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(rawValue))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return fromJSONValue(value)
+}
+
+// fromJSONValue converts a decoded JSON value to CBOR.
+func fromJSONValue(value interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case json.Number:
+		result, err := typed.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("only integer numbers are supported, not %s", typed.String())
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for i, item := range typed {
+			var err error
+			if result[i], err = fromJSONValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := cbor.Map{}
+		for key, item := range typed {
+			var err error
+			if result[key], err = fromJSONValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+	// strings, booleans and null
+	return value, nil
+}
+
+// toJSON converts a CBOR value to JSON. Byte strings become base64url
+// encoded strings, and integer map keys become their decimal names.
+func toJSON(value interface{}) (json.RawMessage, error) {
+	converted, err := toJSONValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(converted)
+}
+
+// toJSONValue converts a CBOR value to one json.Marshal() accepts.
+func toJSONValue(value interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case []byte:
+		return base64.RawURLEncoding.EncodeToString(typed), nil
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for i, item := range typed {
+			var err error
+			if result[i], err = toJSONValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case cbor.Map:
+		result := map[string]interface{}{}
+		for key, item := range typed {
+			var err error
+			if result[fmt.Sprint(key)], err = toJSONValue(item); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case cbor.Tag:
+		return nil, fmt.Errorf("tagged values are not supported, but found tag %d", typed.Number)
+	}
+	// integers, strings, booleans and null
+	return value, nil
+}
+
+// SignCWT returns a CWT of claims, signed by signer with the algorithm named
+// alg, as a COSE_Sign1 message tagged as a CWT.
+func SignCWT(signer crypto.Signer, randReader io.Reader, claims *jwt.Claims, alg string, kid []byte) ([]byte, error) {
+	cwtClaims, err := NewCWTClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := cbor.Marshal(cwtClaims)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := Sign(signer, randReader, payload, alg, kid, false)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(cbor.Tag{Number: CWTTag, Content: cbor.Tag{Number: Sign1Tag, Content: signed.untagged()}})
+}
+
+// ParseCWT parses a CWT, which may or may not be tagged, returning the
+// COSE_Sign1 message it is signed as along with its claims. The signature is
+// not verified.
+func ParseCWT(data []byte) (*Sign1, *jwt.Claims, error) {
+	item, err := cbor.Unmarshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tag, ok := item.(cbor.Tag); ok && (tag.Number == CWTTag) {
+		item = tag.Content
+	}
+	signed, err := parseItem(item)
+	if err != nil {
+		return nil, nil, err
+	}
+	if signed.Detached {
+		return nil, nil, errors.New("CWT must not have a detached payload")
+	}
+	decoded, err := cbor.Unmarshal(signed.Payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CWT claims are not valid: %s", err.Error())
+	}
+	cwtClaims, ok := decoded.(cbor.Map)
+	if !ok {
+		return nil, nil, errors.New("CWT claims must be a map")
+	}
+	claims, err := ParseCWTClaims(cwtClaims)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signed, claims, nil
+}
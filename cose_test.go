@@ -0,0 +1,231 @@
+package codechallenge_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/cose"
+	"github.com/smartedge/codechallenge/jws"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"testing"
+	"time"
+)
+
+// TestSignAndVerifyCOSE verifies that COSE_Sign1 output written by RealMain
+// can be verified in -verify mode, and that tampering with it is detected.
+func TestSignAndVerifyCOSE(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signArgs   []string
+		alg        string
+		tamper     func(*cose.Sign1)
+		verifyArgs []string
+		status     int
+		stdOutput  testtools.StringMatcher
+		stdErr     testtools.StringMatcher
+	}{
+		"ECDSA": {
+			signArgs:   []string{"codechallenge", "-format", "cose"},
+			alg:        jws.ES256,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cose"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"ECDSA on P-521": {
+			signArgs:   []string{"codechallenge", "-format", "cose", "-curve", "P-521", "-private", "p521.priv", "-public", "p521.pub"},
+			alg:        jws.ES512,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cose", "-public", "p521.pub"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"RSA with PKCS #1 v1.5 padding": {
+			signArgs:   []string{"codechallenge", "-rsa", "-format", "cose", "-alg", "RS256"},
+			alg:        jws.RS256,
+			verifyArgs: []string{"codechallenge", "-rsa", "-verify", "-format", "cose"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Ed25519": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "cose"},
+			alg:        jws.EdDSA,
+			verifyArgs: []string{"codechallenge", "-ed25519", "-verify", "-format", "cose"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Detached with payload file": {
+			signArgs:   []string{"codechallenge", "-format", "cose", "-detached"},
+			alg:        jws.ES256,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cose", "-payload", "hello.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Detached without payload file": {
+			signArgs:   []string{"codechallenge", "-format", "cose", "-detached"},
+			alg:        jws.ES256,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cose"},
+			status:     3,
+			stdOutput:  testtools.NewStringStringMatcher(""),
+			stdErr:     testtools.NewStringStringMatcher("COSE_Sign1 payload is detached, which requires -payload\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Tampered payload": {
+			signArgs:   []string{"codechallenge", "-format", "cose"},
+			alg:        jws.ES256,
+			tamper:     func(signed *cose.Sign1) { signed.Payload = []byte("Goodbye, World!") },
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cose"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Verified with the wrong key": {
+			signArgs:   []string{"codechallenge", "-format", "cose"},
+			alg:        jws.ES256,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "cose", "-public", "other.pub"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"kid of signature does not match its public key\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/hello.txt": testtools.StringPtr("Hello, World!"),
+			}
+			// An unrelated key-pair, to verify with:
+			testtools.AddOtherKeyPair(files, "/home/anybody")
+			signBundle := runMain(tt, &files, "Hello, World!", tc.signArgs[1:]...)
+			if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+			}
+			signed, err := cose.Parse(signBundle.OutBuf.Bytes())
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing COSE_Sign1 message: %s", err.Error())
+			}
+			if signed.Algorithm != tc.alg {
+				tt.Errorf("COSE algorithm should be %s. Got %s instead.", tc.alg, signed.Algorithm)
+			} else if len(signed.KeyID) == 0 {
+				tt.Errorf("COSE protected header should include a kid")
+			}
+			input := signBundle.OutBuf.String()
+			if tc.tamper != nil {
+				tc.tamper(signed)
+				tampered, err := signed.Marshal()
+				if err != nil {
+					tt.Fatalf("Unexpected error encoding COSE_Sign1 message: %s", err.Error())
+				}
+				input = string(tampered)
+			}
+			verifyBundle := runMain(tt, &files, input, tc.verifyArgs[1:]...)
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if err := tc.stdErr.MatchString(verifyBundle.ErrBuf.String()); err != nil {
+				tt.Errorf("Standard Error:\n%#v didn't match:\n%s.", verifyBundle.ErrBuf.String(), err.Error())
+			}
+		})
+	}
+}
+
+// TestIssueAndVerifyCWT verifies that CWTs issued by the cwt command are
+// accepted by the verify-cwt command until they expire, using the mock clock.
+func TestIssueAndVerifyCWT(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		issueArgs  []string
+		verifyArgs []string
+		verifyAt   time.Duration
+		status     int
+		stdOutput  testtools.StringMatcher
+	}{
+		"Claims from flags and a file": {
+			issueArgs:  []string{"codechallenge", "cwt", "-claims", "claims.json", "-iss", "me", "-aud", "you,them", "-exp", "2h", "-jti", "1"},
+			verifyArgs: []string{"codechallenge", "verify-cwt", "-iss", "me", "-aud", "them"},
+			verifyAt:   90 * time.Minute,
+			status:     0,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"claims\": {\n" +
+				"\"iss\": \"me\",\n\"sub\": \"someone\",\n\"aud\": [\n\"you\",\n\"them\"\n],\n" +
+				"\"exp\": 1567346400,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\",\n\"scope\": \"read\"\n}\n}"),
+		},
+		"Ed25519 key": {
+			issueArgs:  []string{"codechallenge", "cwt", "-ed25519", "-jti", "1"},
+			verifyArgs: []string{"codechallenge", "verify-cwt", "-ed25519"},
+			verifyAt:   30 * time.Minute,
+			status:     0,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"claims\": {\n" +
+				"\"exp\": 1567342800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\"\n}\n}"),
+		},
+		"Expired": {
+			issueArgs:  []string{"codechallenge", "cwt", "-exp", "10m", "-jti", "1"},
+			verifyArgs: []string{"codechallenge", "verify-cwt"},
+			verifyAt:   11 * time.Minute,
+			status:     11,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"invalid claims\",\n\"detail\": \"token expired at 2019-09-01T12:10:00Z\",\n\"claims\": {\n" +
+				"\"exp\": 1567339800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\"\n}\n}"),
+		},
+		"Expired within leeway": {
+			issueArgs:  []string{"codechallenge", "cwt", "-exp", "10m", "-jti", "1"},
+			verifyArgs: []string{"codechallenge", "verify-cwt", "-leeway", "2m"},
+			verifyAt:   11 * time.Minute,
+			status:     0,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"claims\": {\n" +
+				"\"exp\": 1567339800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\"\n}\n}"),
+		},
+		"Verified with the wrong key": {
+			issueArgs:  []string{"codechallenge", "cwt", "-rsa"},
+			verifyArgs: []string{"codechallenge", "verify-cwt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"kid of signature does not match its public key\"\n}"),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/claims.json": testtools.StringPtr("{\"sub\": \"someone\", \"iss\": \"not me\", \"scope\": \"read\"}"),
+			}
+			// Generate the default key-pair, in case the CWT is issued with
+			// another:
+			defaultBundle := mocks.NewDefaultMockDeps("Hello, World!", []string{"codechallenge"}, "/home/anybody", &files)
+			err := defaultBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(defaultBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling defaultBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			issueBundle := mocks.NewDefaultMockDeps("", tc.issueArgs, "/home/anybody", &files)
+			err = issueBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(issueBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling issueBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := issueBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Issuing failed with exit status %d:\n%s", exitStatus, issueBundle.ErrBuf.String())
+			}
+			verifyBundle := mocks.NewDefaultMockDeps(issueBundle.OutBuf.String(), tc.verifyArgs, "/home/anybody", &files)
+			verifyBundle.Deps.Time.Now = func() time.Time {
+				return mocks.MockCurrentTime.Add(tc.verifyAt)
+			}
+			err = verifyBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(verifyBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Errorf("Unexpected error calling verifyBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if verifyBundle.ErrBuf.String() != "" {
+				tt.Errorf("Standard Error should be empty. Got:\n%s", verifyBundle.ErrBuf.String())
+			}
+		})
+	}
+}
@@ -1,8 +1,14 @@
 package crypt
 
 import (
+	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/sha256"
+	// Registers SHA-384 and SHA-512 with crypto.Hash.New()
+	_ "crypto/sha512"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
@@ -11,6 +17,7 @@ import (
 	"fmt"
 	"github.com/smartedge/codechallenge/deps"
 	"github.com/smartedge/codechallenge/misc"
+	"io"
 	"math/big"
 	"os"
 	"strings"
@@ -58,6 +65,16 @@ func (x X509Encoded) AsGenericPublicKey() (crypto.PublicKey, error) {
 	return crypto.PublicKey(genericPublicKey), nil
 }
 
+// PublicKeysEqual returns true if a and b are the same public key.
+func PublicKeysEqual(a, b crypto.PublicKey) bool {
+	aDER, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	bDER, err := x509.MarshalPKIXPublicKey(b)
+	return (err == nil) && bytes.Equal(aDER, bDER)
+}
+
 // PEMEncoded text data buffer
 type PEMEncoded []byte
 
@@ -71,15 +88,78 @@ func (pemBuf PEMEncoded) String() string {
 	return string([]byte(pemBuf))
 }
 
-// DecodeToX509 decodes the PEM key data block to a x509 buffer
+// DecodeToX509 decodes the PEM key data block to a x509 buffer. A PEM
+// certificate decodes to the public key it certifies.
 func (pemBuf PEMEncoded) DecodeToX509() (X509Encoded, error) {
 	blockPub, _ := pem.Decode([]byte(pemBuf))
 	if blockPub == nil {
 		return nil, errors.New("No PEM data was found")
 	}
+	if blockPub.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(blockPub.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return X509Encoded(cert.RawSubjectPublicKeyInfo), nil
+	}
 	return X509Encoded(blockPub.Bytes), nil
 }
 
+// PublicKeyAlgorithm determines the PKI algorithm of the public key (if it
+// is one)
+func (x X509Encoded) PublicKeyAlgorithm() (x509.PublicKeyAlgorithm, error) {
+	genericPublicKey, err := x.AsGenericPublicKey()
+	if err != nil {
+		return x509.UnknownPublicKeyAlgorithm, err
+	}
+	switch genericPublicKey.(type) {
+	case *ecdsa.PublicKey:
+		return x509.ECDSA, nil
+	case *rsa.PublicKey:
+		return x509.RSA, nil
+	case ed25519.PublicKey:
+		return x509.Ed25519, nil
+	}
+	return x509.UnknownPublicKeyAlgorithm, fmt.Errorf("Public key did not conform to recognized algorithm: %T", genericPublicKey)
+}
+
+// PublicKeyAlgorithm determines the PKI algorithm of the PEM encoded public
+// key (if it is one)
+func (pemBuf PEMEncoded) PublicKeyAlgorithm() (x509.PublicKeyAlgorithm, error) {
+	x509Key, err := pemBuf.DecodeToX509()
+	if err != nil {
+		return x509.UnknownPublicKeyAlgorithm, err
+	}
+	return x509Key.PublicKeyAlgorithm()
+}
+
+// hashNames maps each supported hash function to its name
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA256: "sha256",
+	crypto.SHA384: "sha384",
+	crypto.SHA512: "sha512",
+}
+
+// ParseHashName returns the hash function named by name. Names are not case
+// sensitive.
+func ParseHashName(name string) (crypto.Hash, error) {
+	for hash, hashName := range hashNames {
+		if strings.EqualFold(hashName, name) {
+			return hash, nil
+		}
+	}
+	return 0, fmt.Errorf("Unrecognized hash %#v: expected sha256, sha384 or sha512", name)
+}
+
+// HashName returns the name of the hash function.
+func HashName(hash crypto.Hash) string {
+	name, ok := hashNames[hash]
+	if !ok {
+		return fmt.Sprintf("Unknown hash %#v (INTERNAL ERROR)", int(hash))
+	}
+	return name
+}
+
 // DigestHash data buffer
 type DigestHash []byte
 
@@ -90,6 +170,57 @@ func NewSHA256DigestHash(data string) DigestHash {
 	return DigestHash(digest[0:])
 }
 
+// NewDigestHash hashes the provided string buffer with the specified hash
+// function.
+func NewDigestHash(hash crypto.Hash, data string) DigestHash {
+	hasher := hash.New()
+	// hash.Hash never returns an error
+	_, _ = hasher.Write([]byte(data))
+	return DigestHash(hasher.Sum(nil))
+}
+
+// NewDigestHashFromReader hashes everything read from src with the specified
+// hash function, without holding all of it in memory.
+func NewDigestHashFromReader(hash crypto.Hash, src io.Reader) (DigestHash, error) {
+	hasher := hash.New()
+	if _, err := io.Copy(hasher, src); err != nil {
+		return nil, err
+	}
+	return DigestHash(hasher.Sum(nil)), nil
+}
+
+// digestDecoders are the encodings a pre-computed digest may be provided in,
+// in order of preference.
+var digestDecoders = []func(string) ([]byte, error){
+	hex.DecodeString,
+	base64.StdEncoding.DecodeString,
+	base64.RawURLEncoding.DecodeString,
+}
+
+// NewDigestHashFromString decodes a hex or base64 encoded digest that was
+// computed elsewhere. Returns an error if it isn't the length of a digest
+// produced by hash. As some strings are valid in more than one encoding, the
+// first decoding of the correct length is used.
+func NewDigestHashFromString(src string, hash crypto.Hash) (DigestHash, error) {
+	var decoded []byte
+	for _, decode := range digestDecoders {
+		buf, err := decode(src)
+		if err != nil {
+			continue
+		}
+		if len(buf) == hash.Size() {
+			return DigestHash(buf), nil
+		}
+		if decoded == nil {
+			decoded = buf
+		}
+	}
+	if decoded == nil {
+		return nil, fmt.Errorf("Digest %#v is neither hex nor base64 encoded", src)
+	}
+	return nil, fmt.Errorf("Digest is %d bytes long, but %s digests are %d bytes long", len(decoded), HashName(hash), hash.Size())
+}
+
 // Hex renders the hash digest as a hex string.
 // This is primarily for debugging and error messages.
 func (hash DigestHash) Hex() string {
@@ -1,10 +1,13 @@
 package crypt_test
 
 import (
+	"crypto"
+	"errors"
 	"fmt"
 	"github.com/smartedge/codechallenge/crypt"
 	"github.com/smartedge/codechallenge/testtools"
 	"github.com/smartedge/codechallenge/testtools/mocks"
+	"io"
 	"os"
 	"strings"
 	"testing"
@@ -232,6 +235,143 @@ func TestDigestHash(t *testing.T) {
 	}
 }
 
+// TestParseHashName tests ParseHashName() and HashName().
+func TestParseHashName(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		name         string
+		expected     crypto.Hash
+		expectedName string
+		err          *testtools.ErrorSpec
+	}{
+		"sha256":      {name: "sha256", expected: crypto.SHA256, expectedName: "sha256"},
+		"upper case":  {name: "SHA384", expected: crypto.SHA384, expectedName: "sha384"},
+		"sha512":      {name: "sha512", expected: crypto.SHA512, expectedName: "sha512"},
+		"unsupported": {name: "md5", err: &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unrecognized hash \"md5\": expected sha256, sha384 or sha512"}},
+		"hyphenated":  {name: "sha-256", err: &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unrecognized hash \"sha-256\": expected sha256, sha384 or sha512"}},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			hash, err := crypt.ParseHashName(tc.name)
+			if err2 := tc.err.EnsureMatches(err); err2 != nil {
+				tt.Error(err2.Error())
+			}
+			if err != nil {
+				return
+			}
+			if hash != tc.expected {
+				tt.Errorf("ParseHashName(%#v) returned %#v when %#v was expected", tc.name, hash, tc.expected)
+			}
+			if actualName := crypt.HashName(hash); actualName != tc.expectedName {
+				tt.Errorf("HashName(%#v) returned %#v when %#v was expected", hash, actualName, tc.expectedName)
+			}
+		})
+	}
+}
+
+// TestNewDigestHashFromString tests decoding pre-computed digests.
+func TestNewDigestHashFromString(t *testing.T) {
+	abc123SHA256Hex := "6ca13d52ca70c883e0f0bb101e425a89e8624de51db2d2392593af6a84118090"
+	for desc, tc := range map[string]struct {
+		src      string
+		hash     crypto.Hash
+		expected string
+		err      *testtools.ErrorSpec
+	}{
+		"hex": {
+			src:      abc123SHA256Hex,
+			hash:     crypto.SHA256,
+			expected: abc123SHA256Hex,
+		},
+		"upper case hex": {
+			src:      strings.ToUpper(abc123SHA256Hex),
+			hash:     crypto.SHA256,
+			expected: abc123SHA256Hex,
+		},
+		"base64": {
+			src:      "bKE9UspwyIPg8LsQHkJaiehiTeUdstI5JZOvaoQRgJA=",
+			hash:     crypto.SHA256,
+			expected: abc123SHA256Hex,
+		},
+		"unpadded base64url": {
+			src:      "bKE9UspwyIPg8LsQHkJaiehiTeUdstI5JZOvaoQRgJA",
+			hash:     crypto.SHA256,
+			expected: abc123SHA256Hex,
+		},
+		"sha384 base64 that is also valid hex": {
+			src:      strings.Repeat("0", 64),
+			hash:     crypto.SHA384,
+			expected: strings.Repeat("d34", 32),
+		},
+		"sha384 hex": {
+			src:      crypt.NewDigestHash(crypto.SHA384, "abc123").Hex(),
+			hash:     crypto.SHA384,
+			expected: crypt.NewDigestHash(crypto.SHA384, "abc123").Hex(),
+		},
+		"sha256 digest for sha512": {
+			src:  abc123SHA256Hex,
+			hash: crypto.SHA512,
+			err:  &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Digest is 32 bytes long, but sha512 digests are 64 bytes long"},
+		},
+		"truncated hex": {
+			src:  abc123SHA256Hex[:62],
+			hash: crypto.SHA256,
+			err:  &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Digest is 31 bytes long, but sha256 digests are 32 bytes long"},
+		},
+		"not encoded": {
+			src:  "not a digest!",
+			hash: crypto.SHA256,
+			err:  &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Digest \"not a digest!\" is neither hex nor base64 encoded"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			digest, err := crypt.NewDigestHashFromString(tc.src, tc.hash)
+			if err2 := tc.err.EnsureMatches(err); err2 != nil {
+				tt.Error(err2.Error())
+			}
+			if (err == nil) && (digest.Hex() != tc.expected) {
+				tt.Errorf("NewDigestHashFromString(%#v) returned %#v when %#v was expected", tc.src, digest.Hex(), tc.expected)
+			}
+		})
+	}
+}
+
+// TestNewDigestHashFromReader tests hashing streamed data.
+func TestNewDigestHashFromReader(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		src      io.Reader
+		hash     crypto.Hash
+		expected string
+		err      *testtools.ErrorSpec
+	}{
+		"sha256": {
+			src:      strings.NewReader("abc123"),
+			hash:     crypto.SHA256,
+			expected: "6ca13d52ca70c883e0f0bb101e425a89e8624de51db2d2392593af6a84118090",
+		},
+		"sha512": {
+			src:      strings.NewReader("abc123"),
+			hash:     crypto.SHA512,
+			expected: crypt.NewDigestHash(crypto.SHA512, "abc123").Hex(),
+		},
+		"read error": {
+			src: testtools.ReaderFunc(func([]byte) (int, error) {
+				return 0, errors.New("Fake I/O Error")
+			}),
+			hash: crypto.SHA256,
+			err:  &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Fake I/O Error"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			digest, err := crypt.NewDigestHashFromReader(tc.hash, tc.src)
+			if err2 := tc.err.EnsureMatches(err); err2 != nil {
+				tt.Error(err2.Error())
+			}
+			if (err == nil) && (digest.Hex() != tc.expected) {
+				tt.Errorf("NewDigestHashFromReader() returned %#v when %#v was expected", digest.Hex(), tc.expected)
+			}
+		})
+	}
+}
+
 // TestBinarySignature tests how the binary signature buffer behaves.
 func TestBinarySignature(t *testing.T) {
 	for i, tc := range []struct {
@@ -8,14 +8,38 @@ import (
 	"encoding/asn1"
 	"fmt"
 	"io"
+	"strings"
 )
 
-// ECDSAPlugin Implementation details for ECDSA.
-type ECDSAPlugin struct{}
+// curveNames maps the name of each supported elliptic curve to the curve.
+var curveNames = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// ParseCurveName returns the elliptic curve named by name. Names are not case
+// sensitive.
+func ParseCurveName(name string) (elliptic.Curve, error) {
+	for curveName, curve := range curveNames {
+		if strings.EqualFold(curveName, name) {
+			return curve, nil
+		}
+	}
+	return nil, fmt.Errorf("Unrecognized elliptic curve %#v: expected P-256, P-384 or P-521", name)
+}
+
+// ECDSAPlugin Implementation details for ECDSA. A nil Curve selects P-256.
+type ECDSAPlugin struct {
+	Curve elliptic.Curve
+}
 
 // GenKeyPair generates a new ECDSA public and private key pair
 func (p *ECDSAPlugin) GenKeyPair(randReader io.Reader) (pubKey X509Encoded, privKey X509Encoded, err error) {
-	pubkeyCurve := elliptic.P256()
+	pubkeyCurve := p.Curve
+	if pubkeyCurve == nil {
+		pubkeyCurve = elliptic.P256()
+	}
 	privatekey, err := ecdsa.GenerateKey(pubkeyCurve, randReader)
 	if err != nil {
 		return nil, nil, err
@@ -36,8 +60,14 @@ func (p *ECDSAPlugin) InjestPrivateKey(privKey X509Encoded) (signer crypto.Signe
 	return x509.ParseECPrivateKey([]byte(privKey))
 }
 
+// GetSignerOpts returns hash, as ECDSA signatures don't need any other
+// options.
+func (p *ECDSAPlugin) GetSignerOpts(hash crypto.Hash) crypto.SignerOpts {
+	return hash
+}
+
 // VerifySignature verifies a ECDSA signature for a message digest,
-func (p *ECDSAPlugin) VerifySignature(sha256Hash DigestHash, binSig BinarySignature, publicKey crypto.PublicKey) (bool, error) {
+func (p *ECDSAPlugin) VerifySignature(_ crypto.Hash, digest DigestHash, binSig BinarySignature, publicKey crypto.PublicKey) (bool, error) {
 	// Decode the signature to get R and S
 	sigStruct := ecdsaSignature{}
 	_, err := asn1.Unmarshal([]byte(binSig), &sigStruct)
@@ -50,7 +80,7 @@ func (p *ECDSAPlugin) VerifySignature(sha256Hash DigestHash, binSig BinarySignat
 	}
 
 	// Verify signature
-	return ecdsa.Verify(ecdsaPublicKey, []byte(sha256Hash), sigStruct.R, sigStruct.S), nil
+	return ecdsa.Verify(ecdsaPublicKey, []byte(digest), sigStruct.R, sigStruct.S), nil
 }
 
 // GetAlgorithmName returns the string "ECDSA"
@@ -0,0 +1,62 @@
+package crypt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"fmt"
+	"io"
+)
+
+// Ed25519Plugin Implementation details for Ed25519.
+type Ed25519Plugin struct{}
+
+// GenKeyPair generates a new Ed25519 public and private key pair
+func (p *Ed25519Plugin) GenKeyPair(randReader io.Reader) (pubKey X509Encoded, privKey X509Encoded, err error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(randReader)
+	if err != nil {
+		return nil, nil, err
+	}
+	x509EncodedPriv, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	x509EncodedPub, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return X509Encoded(x509EncodedPub), X509Encoded(x509EncodedPriv), nil
+}
+
+// InjestPrivateKey loads a Ed25519 private key from a X509Encoded buffer,
+func (p *Ed25519Plugin) InjestPrivateKey(privKey X509Encoded) (signer crypto.Signer, err error) {
+	genericPrivateKey, err := x509.ParsePKCS8PrivateKey([]byte(privKey))
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := genericPrivateKey.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Expecting a ed25519.PrivateKey, but encountered a %T instead", genericPrivateKey)
+	}
+	return privateKey, nil
+}
+
+// GetSignerOpts returns crypto.Hash(0), as Ed25519 signs the digest bytes
+// directly, rather than hashing them again.
+func (p *Ed25519Plugin) GetSignerOpts(_ crypto.Hash) crypto.SignerOpts {
+	return crypto.Hash(0)
+}
+
+// VerifySignature verifies a Ed25519 signature for a message digest,
+func (p *Ed25519Plugin) VerifySignature(_ crypto.Hash, digest DigestHash, binSig BinarySignature, publicKey crypto.PublicKey) (bool, error) {
+	ed25519PublicKey, ok := publicKey.(ed25519.PublicKey)
+	if !ok {
+		return false, fmt.Errorf("Expecting a ed25519.PublicKey, but encountered a %T instead", publicKey)
+	}
+	return ed25519.Verify(ed25519PublicKey, []byte(digest), []byte(binSig)), nil
+}
+
+// GetAlgorithmName returns the string "ED25519"
+func (p *Ed25519Plugin) GetAlgorithmName() string {
+	return "ED25519"
+}
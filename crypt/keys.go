@@ -2,7 +2,7 @@ package crypt
 
 import (
 	"crypto"
-	"crypto/rsa"
+	"crypto/elliptic"
 	"crypto/x509"
 	"errors"
 	"fmt"
@@ -12,18 +12,32 @@ import (
 )
 
 // PkiSettings are the public key settings as specified on the command line.
+// A zero Hash selects the default of SHA-256, and a nil ECDSACurve selects
+// P-256.
 type PkiSettings struct {
 	Algorithm      x509.PublicKeyAlgorithm
 	RSAKeyBits     int
+	ECDSACurve     elliptic.Curve
+	Hash           crypto.Hash
 	PrivateKeyPath string
 	PublicKeyPath  string
 }
 
+// GetHash returns the hash function messages are digested with before
+// signing.
+func (s *PkiSettings) GetHash() crypto.Hash {
+	if s.Hash == 0 {
+		return crypto.SHA256
+	}
+	return s.Hash
+}
+
 // AlgorithmPlugin is used to encapsulate algorithm specific code.
 type AlgorithmPlugin interface {
 	GenKeyPair(randReader io.Reader) (pubKey X509Encoded, privKey X509Encoded, err error)
 	InjestPrivateKey(privKey X509Encoded) (signer crypto.Signer, err error)
-	VerifySignature(sha256Hash DigestHash, binSig BinarySignature, publicKey crypto.PublicKey) (bool, error)
+	GetSignerOpts(hash crypto.Hash) crypto.SignerOpts
+	VerifySignature(hash crypto.Hash, digest DigestHash, binSig BinarySignature, publicKey crypto.PublicKey) (bool, error)
 	GetAlgorithmName() string
 }
 
@@ -49,11 +63,15 @@ func GetCryptoTooling(d *deps.Dependencies, keySettings *PkiSettings) (*CryptoTo
 	}
 	switch result.Settings.Algorithm {
 	case x509.ECDSA:
-		result.AlgPlugin = &ECDSAPlugin{}
+		result.AlgPlugin = &ECDSAPlugin{
+			Curve: result.Settings.ECDSACurve,
+		}
 	case x509.RSA:
 		result.AlgPlugin = &RSAPlugin{
 			KeyLen: result.Settings.RSAKeyBits,
 		}
+	case x509.Ed25519:
+		result.AlgPlugin = &Ed25519Plugin{}
 	default:
 		return nil, fmt.Errorf("INTERNAL ERROR: Unrecognized algorithm: %#v", result.Settings.Algorithm)
 	}
@@ -125,10 +143,7 @@ func (ct *CryptoTooling) Sign(digest DigestHash) (BinarySignature, error) {
 	signature, err := ct.Signer.Sign(
 		ct.D.Crypto.Rand.Reader,
 		[]byte(digest),
-		&rsa.PSSOptions{
-			SaltLength: rsa.PSSSaltLengthAuto,
-			Hash:       crypto.SHA256,
-		})
+		ct.AlgPlugin.GetSignerOpts(ct.Settings.GetHash()))
 	if err != nil {
 		return nil, err
 	}
@@ -138,12 +153,18 @@ func (ct *CryptoTooling) Sign(digest DigestHash) (BinarySignature, error) {
 // SignMessage simply sighs a hash of the message. It was added for
 // consistancy with VerifySignedMessage.
 func (ct *CryptoTooling) SignMessage(msg string) (BinarySignature, error) {
-	return ct.Sign(NewSHA256DigestHash(msg))
+	return ct.Sign(NewDigestHash(ct.Settings.GetHash(), msg))
 }
 
 // VerifySignedMessage simply sighs a hash of the message. It was added for
 // consistancy with VerifySignedMessage.
 func (ct *CryptoTooling) VerifySignedMessage(msg string, base64Sig string, pemPubKey string) (bool, error) {
+	return ct.VerifySignedDigest(NewDigestHash(ct.Settings.GetHash(), msg), base64Sig, pemPubKey)
+}
+
+// VerifySignedDigest verifies a signature of a message digest that was
+// computed with the hash function in ct.Settings.
+func (ct *CryptoTooling) VerifySignedDigest(digest DigestHash, base64Sig string, pemPubKey string) (bool, error) {
 	sig, err := NewBinarySignatureFromBase64(base64Sig)
 	if err != nil {
 		return false, err
@@ -156,7 +177,7 @@ func (ct *CryptoTooling) VerifySignedMessage(msg string, base64Sig string, pemPu
 	if err != nil {
 		return false, err
 	}
-	valid, err := ct.AlgPlugin.VerifySignature(NewSHA256DigestHash(msg), sig, genericPubKey)
+	valid, err := ct.AlgPlugin.VerifySignature(ct.Settings.GetHash(), digest, sig, genericPubKey)
 	if err != nil {
 		return false, err
 	}
@@ -32,8 +32,17 @@ func (p *RSAPlugin) InjestPrivateKey(privKey X509Encoded) (signer crypto.Signer,
 	return x509.ParsePKCS1PrivateKey([]byte(privKey))
 }
 
+// GetSignerOpts returns the options for a PSS signature of a digest produced
+// by hash.
+func (p *RSAPlugin) GetSignerOpts(hash crypto.Hash) crypto.SignerOpts {
+	return &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthAuto,
+		Hash:       hash,
+	}
+}
+
 // VerifySignature verifies a RSA signature for a message digest,
-func (p *RSAPlugin) VerifySignature(sha256Hash DigestHash, binSig BinarySignature, publicKey crypto.PublicKey) (bool, error) {
+func (p *RSAPlugin) VerifySignature(hash crypto.Hash, digest DigestHash, binSig BinarySignature, publicKey crypto.PublicKey) (bool, error) {
 	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
 	if !ok {
 		return false, fmt.Errorf("Expecting a *rsa.PublicKey, but encountered a %T instead", publicKey)
@@ -42,12 +51,12 @@ func (p *RSAPlugin) VerifySignature(sha256Hash DigestHash, binSig BinarySignatur
 	// Verify signature
 	err := rsa.VerifyPSS(
 		rsaPublicKey,
-		crypto.SHA256,
-		[]byte(sha256Hash),
+		hash,
+		[]byte(digest),
 		[]byte(binSig),
 		&rsa.PSSOptions{
 			SaltLength: rsa.PSSSaltLengthAuto,
-			Hash:       crypto.SHA256,
+			Hash:       hash,
 		})
 	return err == nil, err
 }
@@ -0,0 +1,132 @@
+package crypt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// RSAPadding selects the padding of RSA signatures.
+type RSAPadding int
+
+// RSA signature paddings
+const (
+	PSSPadding RSAPadding = iota
+	PKCS1v15Padding
+)
+
+// ECDSAEncoding selects how the two integers of an ECDSA signature are
+// encoded.
+type ECDSAEncoding int
+
+// ECDSA signature encodings
+const (
+	// ASN1Encoding is a DER encoded ASN.1 sequence, as used by X.509.
+	ASN1Encoding ECDSAEncoding = iota
+	// RawEncoding is R and S, each padded to the byte length of the curve,
+	// concatenated together, as used by JOSE and COSE.
+	RawEncoding
+)
+
+// SignatureScheme describes how a message is signed, for formats that fix
+// these details themselves rather than leaving them to the key. Ed25519 keys
+// always sign the message itself, so ignore all three.
+type SignatureScheme struct {
+	Hash          crypto.Hash
+	RSAPadding    RSAPadding
+	ECDSAEncoding ECDSAEncoding
+}
+
+// SignWithScheme signs message with signer according to scheme, hashing it
+// first unless signer is an Ed25519 key.
+func SignWithScheme(signer crypto.Signer, randReader io.Reader, message []byte, scheme SignatureScheme) (BinarySignature, error) {
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		signature, err := signer.Sign(randReader, message, crypto.Hash(0))
+		if err != nil {
+			return nil, err
+		}
+		return BinarySignature(signature), nil
+	}
+	digest := NewDigestHash(scheme.Hash, string(message))
+	var opts crypto.SignerOpts = scheme.Hash
+	if _, ok := signer.Public().(*rsa.PublicKey); ok && (scheme.RSAPadding == PSSPadding) {
+		opts = &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       scheme.Hash,
+		}
+	}
+	signature, err := signer.Sign(randReader, []byte(digest), opts)
+	if err != nil {
+		return nil, err
+	}
+	if ecdsaPublicKey, ok := signer.Public().(*ecdsa.PublicKey); ok && (scheme.ECDSAEncoding == RawEncoding) {
+		return ecdsaASN1ToRaw(ecdsaPublicKey, signature)
+	}
+	return BinarySignature(signature), nil
+}
+
+// VerifyWithScheme verifies a signature of message by publicKey according to
+// scheme.
+func VerifyWithScheme(publicKey crypto.PublicKey, message []byte, binSig BinarySignature, scheme SignatureScheme) (bool, error) {
+	switch typedPublicKey := publicKey.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(typedPublicKey, message, []byte(binSig)), nil
+	case *rsa.PublicKey:
+		digest := NewDigestHash(scheme.Hash, string(message))
+		var err error
+		if scheme.RSAPadding == PSSPadding {
+			err = rsa.VerifyPSS(typedPublicKey, scheme.Hash, []byte(digest), []byte(binSig), &rsa.PSSOptions{
+				SaltLength: rsa.PSSSaltLengthAuto,
+				Hash:       scheme.Hash,
+			})
+		} else {
+			err = rsa.VerifyPKCS1v15(typedPublicKey, scheme.Hash, []byte(digest), []byte(binSig))
+		}
+		return err == nil, err
+	case *ecdsa.PublicKey:
+		digest := NewDigestHash(scheme.Hash, string(message))
+		sigStruct := ecdsaSignature{}
+		if scheme.ECDSAEncoding == RawEncoding {
+			size := ecdsaCoordinateSize(typedPublicKey)
+			if len(binSig) != 2*size {
+				return false, fmt.Errorf("ECDSA signature is %d bytes long, but %d bytes were expected", len(binSig), 2*size)
+			}
+			sigStruct.R = new(big.Int).SetBytes(binSig[:size])
+			sigStruct.S = new(big.Int).SetBytes(binSig[size:])
+		} else if _, err := asn1.Unmarshal([]byte(binSig), &sigStruct); err != nil {
+			return false, err
+		}
+		return ecdsa.Verify(typedPublicKey, []byte(digest), sigStruct.R, sigStruct.S), nil
+	}
+	return false, fmt.Errorf("Public key did not conform to recognized algorithm: %T", publicKey)
+}
+
+// ecdsaCoordinateSize returns the byte length of a coordinate on the curve of
+// publicKey.
+func ecdsaCoordinateSize(publicKey *ecdsa.PublicKey) int {
+	return (publicKey.Curve.Params().BitSize + 7) / 8
+}
+
+// ecdsaASN1ToRaw converts an ASN.1 encoded ECDSA signature to RawEncoding.
+func ecdsaASN1ToRaw(publicKey *ecdsa.PublicKey, signature []byte) (BinarySignature, error) {
+	sigStruct := ecdsaSignature{}
+	if _, err := asn1.Unmarshal(signature, &sigStruct); err != nil {
+		return nil, err
+	}
+	size := ecdsaCoordinateSize(publicKey)
+	rBytes := sigStruct.R.Bytes()
+	sBytes := sigStruct.S.Bytes()
+	if (len(rBytes) > size) || (len(sBytes) > size) {
+		return nil, errors.New("INTERNAL ERROR: ECDSA signature too large for curve")
+	}
+	result := make([]byte, 2*size)
+	copy(result[size-len(rBytes):size], rBytes)
+	copy(result[2*size-len(sBytes):], sBytes)
+	return BinarySignature(result), nil
+}
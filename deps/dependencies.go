@@ -4,9 +4,11 @@ import (
 	"crypto/rand"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 )
 
 // CryptoRandDependencies contains all external dependencies from the crypto/rand package.
@@ -30,6 +32,18 @@ type IoDependencies struct {
 	Ioutil IoIoutilDependencies
 }
 
+// NetHTTPDependencies contains all external dependencies from the net/http
+// package.
+type NetHTTPDependencies struct {
+	ListenAndServe func(string, http.Handler) error
+	Post           func(string, string, io.Reader) (*http.Response, error)
+}
+
+// NetDependencies contains all external dependencies from the net package.
+type NetDependencies struct {
+	HTTP NetHTTPDependencies
+}
+
 // OsDependencies contains all external dependencies from the os package.
 type OsDependencies struct {
 	Args      []string
@@ -40,8 +54,10 @@ type OsDependencies struct {
 	Getuid    func() int
 	Getwd     func() (string, error) // Used only by buildtools.
 	MkdirAll  func(string, os.FileMode) error
-	Open      func(string) (*os.File, error) // Used only by testtools.
+	Open      func(string) (*os.File, error)
+	OpenFile  func(string, int, os.FileMode) (*os.File, error)
 	RemoveAll func(string) error
+	Rename    func(string, string) error
 	Setenv    func(string, string) error
 	Stat      func(string) (os.FileInfo, error)
 	Stderr    io.Writer
@@ -55,7 +71,6 @@ type PathFilePathDependencies struct {
 }
 
 // PathDependencies contains all external dependencies from the path package.
-// Used only by buildtools.
 type PathDependencies struct {
 	FilePath PathFilePathDependencies
 }
@@ -66,14 +81,21 @@ type RuntimeDependencies struct {
 	Caller func(int) (uintptr, string, int, bool)
 }
 
+// TimeDependencies contains all external dependencies from the time package.
+type TimeDependencies struct {
+	Now func() time.Time
+}
+
 // Dependencies contains all external dependencies injected by main()
 // into RealMain(). Used only by buildtools.
 type Dependencies struct {
 	Crypto  CryptoDependencies
 	Io      IoDependencies
+	Net     NetDependencies
 	Os      OsDependencies
-	Path    PathDependencies    // Used only by buildtools.
+	Path    PathDependencies
 	Runtime RuntimeDependencies // Used only by testtools.
+	Time    TimeDependencies
 }
 
 // Defaults is the default set of injected dependencies
@@ -89,6 +111,12 @@ var Defaults = &Dependencies{
 			WriteFile: ioutil.WriteFile,
 		},
 	},
+	Net: NetDependencies{
+		HTTP: NetHTTPDependencies{
+			ListenAndServe: http.ListenAndServe,
+			Post:           http.Post,
+		},
+	},
 	Os: OsDependencies{
 		Args:      os.Args,
 		Chdir:     os.Chdir,
@@ -99,7 +127,9 @@ var Defaults = &Dependencies{
 		Getwd:     os.Getwd,
 		MkdirAll:  os.MkdirAll,
 		Open:      os.Open,
+		OpenFile:  os.OpenFile,
 		RemoveAll: os.RemoveAll,
+		Rename:    os.Rename,
 		Setenv:    os.Setenv,
 		Stat:      os.Stat,
 		Stderr:    os.Stderr,
@@ -114,4 +144,7 @@ var Defaults = &Dependencies{
 	Runtime: RuntimeDependencies{
 		Caller: runtime.Caller,
 	},
+	Time: TimeDependencies{
+		Now: time.Now,
+	},
 }
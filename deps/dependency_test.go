@@ -7,10 +7,12 @@ import (
 	"github.com/smartedge/codechallenge/testtools"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 )
 
 // TestEntryPoint verifies that the injected dependencies are properly bound
@@ -40,6 +42,18 @@ func TestDependencies(t *testing.T) {
 			DepName:  "deps.Defaults.Io.Ioutil.WriteFile",
 			Dep:      deps.Defaults.Io.Ioutil.WriteFile,
 		},
+		{
+			OrigName: "http.ListenAndServe",
+			Orig:     http.ListenAndServe,
+			DepName:  "deps.Defaults.Net.HTTP.ListenAndServe",
+			Dep:      deps.Defaults.Net.HTTP.ListenAndServe,
+		},
+		{
+			OrigName: "http.Post",
+			Orig:     http.Post,
+			DepName:  "deps.Defaults.Net.HTTP.Post",
+			Dep:      deps.Defaults.Net.HTTP.Post,
+		},
 		{
 			OrigName: "os.Args",
 			Orig:     os.Args,
@@ -94,12 +108,24 @@ func TestDependencies(t *testing.T) {
 			DepName:  "deps.Defaults.Os.Open",
 			Dep:      deps.Defaults.Os.Open,
 		},
+		{
+			OrigName: "os.OpenFile",
+			Orig:     os.OpenFile,
+			DepName:  "deps.Defaults.Os.OpenFile",
+			Dep:      deps.Defaults.Os.OpenFile,
+		},
 		{
 			OrigName: "os.RemoveAll",
 			Orig:     os.RemoveAll,
 			DepName:  "deps.Defaults.Os.RemoveAll",
 			Dep:      deps.Defaults.Os.RemoveAll,
 		},
+		{
+			OrigName: "os.Rename",
+			Orig:     os.Rename,
+			DepName:  "deps.Defaults.Os.Rename",
+			Dep:      deps.Defaults.Os.Rename,
+		},
 		{
 			OrigName: "os.Setenv",
 			Orig:     os.Setenv,
@@ -142,6 +168,12 @@ func TestDependencies(t *testing.T) {
 			DepName:  "deps.Defaults.Runtime.Caller",
 			Dep:      deps.Defaults.Runtime.Caller,
 		},
+		{
+			OrigName: "time.Now",
+			Orig:     time.Now,
+			DepName:  "deps.Defaults.Time.Now",
+			Dep:      deps.Defaults.Time.Now,
+		},
 	} {
 		t.Run(fmt.Sprintf("Verifying %s", tc.DepName), func(tt *testing.T) {
 			// There are three types of dependencies:
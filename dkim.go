@@ -0,0 +1,283 @@
+package codechallenge
+
+import (
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/dkim"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// DKIMSettings describes the domain and selector of a DKIM signature, how
+// it is canonicalized and the header fields it covers, or the DNS record of
+// the key it is verified against. If Headers is nil, the signature covers
+// those of dkim.DefaultHeaders the message has.
+type DKIMSettings struct {
+	Domain                 string
+	Selector               string
+	HeaderCanonicalization dkim.Canonicalization
+	BodyCanonicalization   dkim.Canonicalization
+	Headers                []string
+	RecordPath             string
+}
+
+// DKIMVerdict is the outcome of verifying a DKIM signature, to be rendered
+// to JSON. The domain, selector and header fields the signature covers are
+// only included if it is valid.
+type DKIMVerdict struct {
+	*Verdict
+	Domain   string   `json:"domain,omitempty"`
+	Selector string   `json:"selector,omitempty"`
+	Headers  []string `json:"headers,omitempty"`
+}
+
+// readEmailMessage reads a raw email message from d.Os.Stdin, which isn't
+// subject to the length limit of a message.
+func readEmailMessage(d *deps.Dependencies) ([]byte, *dkim.Message, error) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		return nil, nil, err
+	}
+	message, err := dkim.ParseMessage(buff)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buff, message, nil
+}
+
+// NewDKIMSignature returns the unsigned DKIM signature of message described
+// by config, made at the current time.
+func NewDKIMSignature(d *deps.Dependencies, config *RunConfig, message *dkim.Message) *dkim.Signature {
+	headers := config.DKIM.Headers
+	if headers == nil {
+		for _, name := range dkim.DefaultHeaders {
+			if message.Has(name) {
+				headers = append(headers, name)
+			}
+		}
+	}
+	return &dkim.Signature{
+		HeaderCanonicalization: config.DKIM.HeaderCanonicalization,
+		BodyCanonicalization:   config.DKIM.BodyCanonicalization,
+		Domain:                 config.DKIM.Domain,
+		Selector:               config.DKIM.Selector,
+		Headers:                headers,
+		Timestamp:              d.Time.Now(),
+	}
+}
+
+// DKIMMain is the entry-point for the dkim command. It reads a raw email
+// message from d.Os.Stdin, and writes the DKIM-Signature header field to add
+// to the top of it to d.Os.Stdout.
+func DKIMMain(d *deps.Dependencies, config *RunConfig) {
+	raw, message, err := readEmailMessage(d)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	field, err := NewDKIMSignature(d, config, message).Sign(cryptStuff.Signer, d.Crypto.Rand.Reader, message)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip, through the DNS record of the key:
+	record, err := dkim.Record(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	key, err := dkim.ParseRecord(record)
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	signed, err := dkim.ParseMessage(append([]byte(field), raw...))
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	sig, err := dkim.ParseSignature(signed.Signatures()[0])
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	valid, err := sig.Verify(signed, key)
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid || (sig.CheckBodyHash(signed) != nil) {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	err = WriteOutput(d, []byte(field))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// ExportDKIMRecordMain is the entry-point for the export-dkim-record
+// command. It writes the value of the DNS TXT record that publishes the
+// public key for DKIM to d.Os.Stdout, creating the key-pair if necessary.
+func ExportDKIMRecordMain(d *deps.Dependencies, config *RunConfig) {
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	record, err := dkim.Record(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	err = WriteOutput(d, []byte(record+"\n"))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// VerifyDKIMMain is the entry-point for the verify-dkim command. It reads a
+// raw email message from d.Os.Stdin, and writes the verdict on its DKIM
+// signature in JSON format to d.Os.Stdout, exiting with the verdict's exit
+// status if it isn't valid.
+func VerifyDKIMMain(d *deps.Dependencies, config *RunConfig) {
+	_, message, err := readEmailMessage(d)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	sig, err := FindDKIMSignature(config, message)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyDKIM(d, config, message, sig)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// FindDKIMSignature returns the topmost DKIM signature of message by the
+// domain and selector in config, if given. Signatures that can't be parsed
+// are skipped, but the first such error is returned if none are found.
+func FindDKIMSignature(config *RunConfig, message *dkim.Message) (*dkim.Signature, error) {
+	var firstErr error
+	for _, field := range message.Signatures() {
+		sig, err := dkim.ParseSignature(field)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if (config.DKIM.Domain != "") && !strings.EqualFold(sig.Domain, config.DKIM.Domain) {
+			continue
+		}
+		if (config.DKIM.Selector != "") && (sig.Selector != config.DKIM.Selector) {
+			continue
+		}
+		return sig, nil
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if (config.DKIM.Domain != "") || (config.DKIM.Selector != "") {
+		return nil, errors.New("Email message has no DKIM-Signature with the given -domain and -selector")
+	}
+	return nil, errors.New("Email message has no DKIM-Signature")
+}
+
+// VerifyDKIM checks that sig of message was made by the key published in
+// the DNS record file in config, hasn't expired, and that the body of
+// message matches its body hash.
+func VerifyDKIM(d *deps.Dependencies, config *RunConfig, message *dkim.Message, sig *dkim.Signature) (*DKIMVerdict, error) {
+	buff, err := d.Io.Ioutil.ReadFile(config.DKIM.RecordPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := dkim.ParseRecord(strings.TrimSpace(string(buff)))
+	if err != nil {
+		return nil, err
+	}
+	if !sig.Expiration.IsZero() && !d.Time.Now().Before(sig.Expiration) {
+		return &DKIMVerdict{Verdict: NewVerdict(InvalidClaims, fmt.Sprintf("DKIM signature expired at %s", sig.Expiration.Format(time.RFC3339)))}, nil
+	}
+	result := &DKIMVerdict{Verdict: newVerdictFromVerification(sig.Verify(message, key))}
+	if !result.Valid {
+		return result, nil
+	}
+	if err := sig.CheckBodyHash(message); err != nil {
+		return &DKIMVerdict{Verdict: NewVerdict(ContentMismatch, err.Error())}, nil
+	}
+	result.Domain = sig.Domain
+	result.Selector = sig.Selector
+	result.Headers = sig.Headers
+	return result, nil
+}
+
+// signsDKIM returns true if config is of a command that signs with a DKIM key,
+// or exports its DNS record.
+func (config *RunConfig) signsDKIM() bool {
+	return (config.Command == DKIMCommand) || (config.Command == ExportDKIMRecordCommand)
+}
+
+// usesDKIM returns true if config is of a command that uses a DKIM key.
+func (config *RunConfig) usesDKIM() bool {
+	return config.signsDKIM() || (config.Command == VerifyDKIMCommand)
+}
+
+// parseDKIMOptions validates the DKIM domain, selector, canonicalization,
+// signed header and DNS record options in cl into config.
+func parseDKIMOptions(config *RunConfig, cl *commandLine) error {
+	if (*cl.domain != "") || (*cl.selector != "") {
+		if (config.Command != DKIMCommand) && (config.Command != VerifyDKIMCommand) {
+			return fmt.Errorf("Options -domain and -selector are only valid with the %s and %s commands", DKIMCommand, VerifyDKIMCommand)
+		}
+		config.DKIM.Domain = *cl.domain
+		config.DKIM.Selector = *cl.selector
+	}
+	if (*cl.canonicalization != "") || (*cl.headers != "") {
+		if config.Command != DKIMCommand {
+			return fmt.Errorf("Options -canonicalization and -headers are only valid with the %s command", DKIMCommand)
+		}
+		if *cl.canonicalization != "" {
+			header, body, err := dkim.ParseCanonicalization(*cl.canonicalization)
+			if err != nil {
+				return err
+			}
+			config.DKIM.HeaderCanonicalization = header
+			config.DKIM.BodyCanonicalization = body
+		}
+		if *cl.headers != "" {
+			coversFrom := false
+			for _, name := range strings.Split(*cl.headers, ",") {
+				name = strings.TrimSpace(name)
+				if (name == "") || strings.ContainsAny(name, ": \t") {
+					return fmt.Errorf("DKIM header %#v is not a header field name", name)
+				}
+				coversFrom = coversFrom || strings.EqualFold(name, "From")
+				config.DKIM.Headers = append(config.DKIM.Headers, name)
+			}
+			if !coversFrom {
+				return errors.New("Option -headers must include From, as DKIM signatures must cover it")
+			}
+		}
+	}
+	if *cl.dnsRecordPath != "" {
+		if config.Command != VerifyDKIMCommand {
+			return fmt.Errorf("Option -dns-record is only valid with the %s command", VerifyDKIMCommand)
+		}
+		config.DKIM.RecordPath = *cl.dnsRecordPath
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+// Package dkim implements DomainKeys Identified Mail signatures of RFC 5322
+// email messages, as defined by RFC 6376, with the rsa-sha256 algorithm and
+// the ed25519-sha256 algorithm of RFC 8463.
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIM signature algorithm names
+const (
+	RSASHA256     = "rsa-sha256"
+	Ed25519SHA256 = "ed25519-sha256"
+)
+
+// HeaderName is the name of the header field of a DKIM signature.
+const HeaderName = "DKIM-Signature"
+
+// DefaultHeaders are the header fields a signature covers by default, if the
+// message has them.
+var DefaultHeaders = []string{"From", "To", "Cc", "Subject", "Date", "Message-ID", "Reply-To", "MIME-Version", "Content-Type"}
+
+// keyTypes are the k= key types of the DNS records of keys for each
+// algorithm.
+var keyTypes = map[string]string{
+	RSASHA256:     "rsa",
+	Ed25519SHA256: "ed25519",
+}
+
+// AlgorithmForKey returns the DKIM signature algorithm that signs with
+// publicKey.
+func AlgorithmForKey(publicKey crypto.PublicKey) (string, error) {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return RSASHA256, nil
+	case ed25519.PublicKey:
+		return Ed25519SHA256, nil
+	}
+	return "", errors.New("DKIM requires an RSA or Ed25519 key")
+}
+
+// Signature is a DKIM signature of a message by a domain, whose key is
+// published in DNS under selector._domainkey.domain.
+type Signature struct {
+	Algorithm              string
+	HeaderCanonicalization Canonicalization
+	BodyCanonicalization   Canonicalization
+	Domain                 string
+	Selector               string
+	Headers                []string
+	BodyHash               []byte
+	Timestamp              time.Time
+	Expiration             time.Time
+	Value                  crypt.BinarySignature
+	// field is the header field, as it appeared, with its b= tag empty.
+	field string
+}
+
+// bodyHash returns the hash of the canonicalized body of message.
+func (s *Signature) bodyHash(message *Message) []byte {
+	digest := sha256.Sum256(canonicalizeBody(message.Body, s.BodyCanonicalization))
+	return digest[:]
+}
+
+// signedData returns the header fields of message the signature covers,
+// followed by its own header field with an empty b= tag, canonicalized.
+// Each name in Headers selects the last instance of the field not already
+// selected, or nothing once there are none left.
+func (s *Signature) signedData(message *Message) []byte {
+	var result strings.Builder
+	used := map[int]bool{}
+	for _, name := range s.Headers {
+		for i := len(message.Fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fieldName(message.Fields[i]), name) {
+				used[i] = true
+				result.WriteString(canonicalizeField(message.Fields[i], s.HeaderCanonicalization))
+				break
+			}
+		}
+	}
+	result.WriteString(strings.TrimSuffix(canonicalizeField(s.field+"\r\n", s.HeaderCanonicalization), "\r\n"))
+	return []byte(result.String())
+}
+
+// scheme returns what is signed of data, and how, for the algorithm.
+func (s *Signature) scheme(data []byte) ([]byte, crypt.SignatureScheme) {
+	if s.Algorithm == Ed25519SHA256 {
+		digest := sha256.Sum256(data)
+		return digest[:], crypt.SignatureScheme{}
+	}
+	return data, crypt.SignatureScheme{Hash: crypto.SHA256, RSAPadding: crypt.PKCS1v15Padding}
+}
+
+// Sign signs message with signer, returning the header field to add to the
+// top of it, including its final CRLF. The Domain, Selector, Headers,
+// canonicalizations and Timestamp must already be set.
+func (s *Signature) Sign(signer crypto.Signer, randReader io.Reader, message *Message) (string, error) {
+	var err error
+	if s.Algorithm, err = AlgorithmForKey(signer.Public()); err != nil {
+		return "", err
+	}
+	if err := s.validate(); err != nil {
+		return "", err
+	}
+	s.BodyHash = s.bodyHash(message)
+	tags := []string{
+		"v=1",
+		"a=" + s.Algorithm,
+		"c=" + string(s.HeaderCanonicalization) + "/" + string(s.BodyCanonicalization),
+		"d=" + s.Domain,
+		"s=" + s.Selector,
+		"t=" + strconv.FormatInt(s.Timestamp.Unix(), 10),
+		"h=" + strings.Join(s.Headers, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(s.BodyHash),
+	}
+	// Fold the field to keep its lines short, with b= on a line of its own:
+	field := HeaderName + ":"
+	lineLength := len(field)
+	for _, tag := range tags {
+		if lineLength+len(tag)+2 > 78 {
+			field += "\r\n\t" + tag + ";"
+			lineLength = len(tag) + 2
+		} else {
+			field += " " + tag + ";"
+			lineLength += len(tag) + 2
+		}
+	}
+	s.field = field + "\r\n\tb="
+	data, scheme := s.scheme(s.signedData(message))
+	if s.Value, err = crypt.SignWithScheme(signer, randReader, data, scheme); err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(s.Value)
+	lines := []string{}
+	for len(encoded) > 70 {
+		lines, encoded = append(lines, encoded[:70]), encoded[70:]
+	}
+	return s.field + strings.Join(append(lines, encoded), "\r\n\t") + "\r\n", nil
+}
+
+// validate returns an error if the signature is missing something it
+// requires.
+func (s *Signature) validate() error {
+	if (s.Domain == "") || (s.Selector == "") {
+		return errors.New("DKIM signatures require a domain and a selector")
+	}
+	for _, name := range s.Headers {
+		if strings.EqualFold(name, "From") {
+			return nil
+		}
+	}
+	return errors.New("DKIM signatures must cover the From header")
+}
+
+// parseTags parses a DKIM tag list, such as the value of a DKIM-Signature
+// header field or of a DNS record, indexed by tag name.
+func parseTags(value string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, tag := range strings.Split(value, ";") {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+		equals := strings.Index(tag, "=")
+		if equals < 0 {
+			return nil, fmt.Errorf("DKIM tag %#v has no value", strings.TrimSpace(tag))
+		}
+		name := strings.TrimSpace(tag[:equals])
+		if _, ok := result[name]; ok {
+			return nil, fmt.Errorf("DKIM tag %s appears more than once", name)
+		}
+		result[name] = strings.TrimSpace(tag[equals+1:])
+	}
+	return result, nil
+}
+
+// removeWhitespace removes the folding whitespace allowed within base64
+// values and lists.
+func removeWhitespace(value string) string {
+	return strings.Join(strings.Fields(value), "")
+}
+
+// Signatures returns the DKIM-Signature header fields of message, from the
+// top, which is the most recently added.
+func (m *Message) Signatures() []string {
+	result := []string{}
+	for _, field := range m.Fields {
+		if strings.EqualFold(fieldName(field), HeaderName) {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// ParseSignature parses a DKIM-Signature header field, as returned by
+// Signatures.
+func ParseSignature(field string) (*Signature, error) {
+	field = strings.TrimSuffix(field, "\r\n")
+	tags, err := parseTags(field[strings.Index(field, ":")+1:])
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[name]; !ok {
+			return nil, fmt.Errorf("DKIM-Signature is missing its %s= tag", name)
+		}
+	}
+	if tags["v"] != "1" {
+		return nil, fmt.Errorf("Unsupported DKIM-Signature version %#v", tags["v"])
+	}
+	if _, ok := tags["l"]; ok {
+		return nil, errors.New("DKIM signatures with a body length limit (l=) are not supported")
+	}
+	result := &Signature{
+		Algorithm: tags["a"],
+		Domain:    tags["d"],
+		Selector:  tags["s"],
+	}
+	if _, ok := keyTypes[result.Algorithm]; !ok {
+		return nil, fmt.Errorf("Unsupported DKIM signature algorithm %#v: expected %s or %s", result.Algorithm, Ed25519SHA256, RSASHA256)
+	}
+	result.HeaderCanonicalization, result.BodyCanonicalization = Simple, Simple
+	if c, ok := tags["c"]; ok {
+		if result.HeaderCanonicalization, result.BodyCanonicalization, err = ParseCanonicalization(c); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range strings.Split(tags["h"], ":") {
+		result.Headers = append(result.Headers, strings.TrimSpace(name))
+	}
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+	if result.BodyHash, err = base64.StdEncoding.DecodeString(removeWhitespace(tags["bh"])); err != nil {
+		return nil, fmt.Errorf("DKIM body hash is not valid base64: %s", err.Error())
+	}
+	signature, err := base64.StdEncoding.DecodeString(removeWhitespace(tags["b"]))
+	if err != nil {
+		return nil, fmt.Errorf("DKIM signature is not valid base64: %s", err.Error())
+	}
+	result.Value = crypt.BinarySignature(signature)
+	for name, value := range map[string]*time.Time{"t": &result.Timestamp, "x": &result.Expiration} {
+		if tags[name] == "" {
+			continue
+		}
+		seconds, err := strconv.ParseInt(tags[name], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("DKIM %s= tag is not a number of seconds", name)
+		}
+		*value = time.Unix(seconds, 0).UTC()
+	}
+	// The field with the value of its b= tag removed, as it was signed:
+	result.field = field
+	for start := 0; start < len(field); {
+		end := strings.Index(field[start:], ";")
+		if end < 0 {
+			end = len(field)
+		} else {
+			end += start
+		}
+		tag := field[start:end]
+		if equals := strings.Index(tag, "="); (equals >= 0) && (strings.TrimSpace(tag[:equals]) == "b") {
+			result.field = field[:start+equals+1] + field[end:]
+			break
+		}
+		start = end + 1
+	}
+	return result, nil
+}
+
+// CheckBodyHash returns an error unless the body of message matches the
+// body hash of the signature.
+func (s *Signature) CheckBodyHash(message *Message) error {
+	if subtle.ConstantTimeCompare(s.bodyHash(message), s.BodyHash) != 1 {
+		return errors.New("DKIM body hash does not match the body of the message")
+	}
+	return nil
+}
+
+// Verify checks the signature of the header fields of message, which
+// include the body hash, by key. The body itself is checked separately, by
+// CheckBodyHash.
+func (s *Signature) Verify(message *Message, key *Key) (bool, error) {
+	if key.PublicKey == nil {
+		return false, errors.New("DKIM key has been revoked")
+	}
+	if keyTypes[s.Algorithm] != key.Type {
+		return false, fmt.Errorf("DKIM signature algorithm %s can't be used with a key of type %s", s.Algorithm, key.Type)
+	}
+	if (len(key.Hashes) > 0) && !containsString(key.Hashes, "sha256") {
+		return false, errors.New("DKIM key does not allow sha256")
+	}
+	data, scheme := s.scheme(s.signedData(message))
+	return crypt.VerifyWithScheme(key.PublicKey, data, s.Value, scheme)
+}
+
+// containsString returns whether list contains value.
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Key is the public key of a DKIM DNS record. A revoked key has a nil
+// PublicKey.
+type Key struct {
+	Type      string
+	PublicKey crypto.PublicKey
+	Hashes    []string
+}
+
+// Record returns the value of the DNS TXT record that publishes publicKey,
+// under selector._domainkey.domain.
+func Record(publicKey crypto.PublicKey) (string, error) {
+	var p []byte
+	switch typedPublicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		var err error
+		if p, err = x509.MarshalPKIXPublicKey(typedPublicKey); err != nil {
+			return "", err
+		}
+	case ed25519.PublicKey:
+		p = typedPublicKey
+	default:
+		return "", errors.New("DKIM requires an RSA or Ed25519 key")
+	}
+	alg, _ := AlgorithmForKey(publicKey)
+	return fmt.Sprintf("v=DKIM1; k=%s; p=%s", keyTypes[alg], base64.StdEncoding.EncodeToString(p)), nil
+}
+
+// ParseRecord parses the value of a DKIM DNS TXT record. The value may be
+// given as it appears in a zone file, as quoted strings to be concatenated.
+func ParseRecord(record string) (*Key, error) {
+	if strings.Contains(record, "\"") {
+		unquoted := ""
+		for i, part := range strings.Split(record, "\"") {
+			if i%2 == 1 {
+				unquoted += part
+			}
+		}
+		record = unquoted
+	}
+	tags, err := parseTags(record)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := tags["v"]; ok && (v != "DKIM1") {
+		return nil, fmt.Errorf("Unsupported DKIM key record version %#v", v)
+	}
+	result := &Key{Type: "rsa"}
+	if k, ok := tags["k"]; ok {
+		result.Type = k
+	}
+	if h, ok := tags["h"]; ok {
+		for _, hash := range strings.Split(h, ":") {
+			result.Hashes = append(result.Hashes, strings.TrimSpace(hash))
+		}
+	}
+	p, ok := tags["p"]
+	if !ok {
+		return nil, errors.New("DKIM key record is missing its p= tag")
+	}
+	if p = removeWhitespace(p); p == "" {
+		return result, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, fmt.Errorf("DKIM key is not valid base64: %s", err.Error())
+	}
+	switch result.Type {
+	case "rsa":
+		publicKey, err := x509.ParsePKIXPublicKey(decoded)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := publicKey.(*rsa.PublicKey); !ok {
+			return nil, errors.New("DKIM key of type rsa is not an RSA key")
+		}
+		result.PublicKey = publicKey
+	case "ed25519":
+		if len(decoded) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("DKIM key of type ed25519 is %d bytes long, but %d bytes were expected", len(decoded), ed25519.PublicKeySize)
+		}
+		result.PublicKey = ed25519.PublicKey(decoded)
+	default:
+		return nil, fmt.Errorf("Unsupported DKIM key type %#v: expected ed25519 or rsa", result.Type)
+	}
+	return result, nil
+}
@@ -0,0 +1,304 @@
+package dkim_test
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"github.com/smartedge/codechallenge/dkim"
+	"github.com/smartedge/codechallenge/testtools"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Message is the message of the examples of RFC 8463, Appendix A.
+const Message = "From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+// RFCSignature is the Ed25519 signature of Message in RFC 8463, Appendix A,
+// made with the key in RFCRecord.
+const RFCSignature = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+	" subject : date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+	" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n"
+
+// RFCRecord is the DNS record of the brisbane._domainkey.football.example.com
+// key in RFC 8463, Appendix A.
+const RFCRecord = "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+
+// OpenSSLSignature is a simple/simple signature of Message made with the key
+// in OpenSSLRecord by `openssl dgst -sha256 -sign`.
+const OpenSSLSignature = "DKIM-Signature: v=1; a=rsa-sha256; c=simple/simple; d=football.example.com;\r\n" +
+	"\ts=test; t=1528637909; h=From:To:Subject:Date; bh=4bLNXImK9drULnmePzZNEBleUanJCX5PIsDIFoH4KTQ=;\r\n" +
+	"\tb=dZFojJgKSSDb0sdTSUzVfOFQvpoSGHGFqtifLW1brE9HFFjYySZlKwOMbLKUhEGtXkijW6hd9w8j9sEP+rvuHLrM1qFBUVrJGyoa9jCAi+Xjg/n2HDEI0qKx5xB3lEN6oWYwQqFQHUq/mRyGz1KeUp7Qk3o6pzJzxWulS7crl78=\r\n"
+
+// OpenSSLRecord is the DNS record of the key that made OpenSSLSignature, as
+// it appears in a zone file.
+const OpenSSLRecord = "\"v=DKIM1; k=rsa; \" " +
+	"\"p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCqVVm//PXsyDfCKRGCewDiXKK2m7Kiuzrg9v4G8rpEi5RLldWfss/DWRnvUacmG3tU6YbpIsu/MAnU6zOgU4NnqMOcW0vTDYl\" " +
+	"\"L1/zhFCfQHoqfu4Bc9ul6CM0Xgw+DNn2oV1oJAwhhHWxmeCrcnhNQhtU0rc+XCgzd4OfNIlMHFQIDAQAB\""
+
+// TestIndependentSignatures verifies signatures made independently of this
+// package, and that changes to the message are detected.
+func TestIndependentSignatures(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		message string
+		record  string
+	}{
+		"RFC 8463 Ed25519 example": {
+			message: RFCSignature + Message,
+			record:  RFCRecord,
+		},
+		"OpenSSL RSA with LF line endings": {
+			message: strings.ReplaceAll(OpenSSLSignature+Message, "\r\n", "\n"),
+			record:  OpenSSLRecord,
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			message, err := dkim.ParseMessage([]byte(tc.message))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			key, err := dkim.ParseRecord(tc.record)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			sig, err := dkim.ParseSignature(message.Signatures()[0])
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if err := sig.CheckBodyHash(message); err != nil {
+				tt.Errorf("Body hash should match: %s", err.Error())
+			}
+			if valid, err := sig.Verify(message, key); !valid {
+				tt.Errorf("Signature should be valid: %v", err)
+			}
+			changed, _ := dkim.ParseMessage([]byte(strings.Replace(tc.message, "Is dinner ready?", "Is lunch ready?", 1)))
+			if valid, err := sig.Verify(changed, key); valid {
+				tt.Errorf("Signature of another subject should not be valid: %v", err)
+			}
+			changed, _ = dkim.ParseMessage([]byte(strings.Replace(tc.message, "hungry", "thirsty", 1)))
+			err = sig.CheckBodyHash(changed)
+			expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DKIM body hash does not match the body of the message"}
+			if err := expectedErr.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
+
+// TestCanonicalization verifies the body hashes of the canonicalization
+// examples of RFC 6376, section 3.4.5, and that relaxed canonicalization
+// tolerates changes to whitespace and folding that simple doesn't.
+func TestCanonicalization(t *testing.T) {
+	_, signer, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := dkim.ParseRecord(mustRecord(t, signer.Public()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	original := "From: A\r\nB : Y\t\r\n\tZ  \r\n\r\n C \r\nD \t E\r\n\r\n\r\n"
+	changed := "From:  A\r\nB:Y Z\r\n\r\n C\r\nD E\r\n"
+	for desc, tc := range map[string]struct {
+		canonicalization string
+		canonicalBody    string
+		validIfChanged   bool
+	}{
+		"Simple": {
+			canonicalization: "simple/simple",
+			canonicalBody:    " C \r\nD \t E\r\n",
+			validIfChanged:   false,
+		},
+		"Relaxed": {
+			canonicalization: "relaxed/relaxed",
+			canonicalBody:    " C\r\nD E\r\n",
+			validIfChanged:   true,
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			header, body, err := dkim.ParseCanonicalization(tc.canonicalization)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			message, err := dkim.ParseMessage([]byte(original))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			sig := &dkim.Signature{
+				HeaderCanonicalization: header,
+				BodyCanonicalization:   body,
+				Domain:                 "example.com",
+				Selector:               "test",
+				Headers:                []string{"From", "B"},
+				Timestamp:              time.Unix(1567339200, 0),
+			}
+			if _, err := sig.Sign(signer, rand.Reader, message); err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if expected := sha256.Sum256([]byte(tc.canonicalBody)); string(sig.BodyHash) != string(expected[:]) {
+				tt.Errorf("Body hash should be of %#v", tc.canonicalBody)
+			}
+			changedMessage, err := dkim.ParseMessage([]byte(changed))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			valid, _ := sig.Verify(changedMessage, key)
+			if valid != tc.validIfChanged {
+				tt.Errorf("Signature of the changed message should have validity %v. Got %v instead.", tc.validIfChanged, valid)
+			}
+			if err := sig.CheckBodyHash(changedMessage); (err == nil) != tc.validIfChanged {
+				tt.Errorf("Body hash of the changed message should have validity %v. Got %v instead.", tc.validIfChanged, err)
+			}
+		})
+	}
+}
+
+// mustRecord returns the DNS record of publicKey.
+func mustRecord(t *testing.T, publicKey crypto.PublicKey) string {
+	record, err := dkim.Record(publicKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return record
+}
+
+// TestSignAndVerify verifies that signatures added to a message parse back
+// to valid signatures for each algorithm.
+func TestSignAndVerify(t *testing.T) {
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for desc, tc := range map[string]struct {
+		signer crypto.Signer
+		alg    string
+		kind   string
+	}{
+		"Ed25519": {signer: ed25519Key, alg: dkim.Ed25519SHA256, kind: "k=ed25519"},
+		"RSA":     {signer: rsaKey, alg: dkim.RSASHA256, kind: "k=rsa"},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			record := mustRecord(tt, tc.signer.Public())
+			if !strings.HasPrefix(record, "v=DKIM1; "+tc.kind+"; p=") {
+				tt.Errorf("Unexpected DNS record %#v", record)
+			}
+			key, err := dkim.ParseRecord(record)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			message, err := dkim.ParseMessage([]byte(Message))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			sig := &dkim.Signature{
+				HeaderCanonicalization: dkim.Relaxed,
+				BodyCanonicalization:   dkim.Simple,
+				Domain:                 "football.example.com",
+				Selector:               "test",
+				Headers:                []string{"From", "To", "Subject", "Date", "From"},
+				Timestamp:              time.Unix(1567339200, 0),
+			}
+			field, err := sig.Sign(tc.signer, rand.Reader, message)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(field, "\r\n"), "\r\n") {
+				if len(line) > 78 {
+					tt.Errorf("Line %#v of the DKIM-Signature is too long", line)
+				}
+			}
+			signed, err := dkim.ParseMessage([]byte(field + Message))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			parsed, err := dkim.ParseSignature(signed.Signatures()[0])
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if parsed.Algorithm != tc.alg {
+				tt.Errorf("Algorithm should be %s. Got %s instead.", tc.alg, parsed.Algorithm)
+			}
+			if valid, err := parsed.Verify(signed, key); !valid {
+				tt.Errorf("Signature should be valid: %v", err)
+			}
+			if err := parsed.CheckBodyHash(signed); err != nil {
+				tt.Errorf("Body hash should match: %s", err.Error())
+			}
+			// The second From is signed as absent, so can't be added:
+			added, _ := dkim.ParseMessage([]byte(field + "From: Mallory <mallory@example.net>\r\n" + Message))
+			if valid, err := parsed.Verify(added, key); valid {
+				tt.Errorf("Signature of a message with another From should not be valid: %v", err)
+			}
+		})
+	}
+}
+
+// TestParseErrors verifies that unusable signatures and DNS records are
+// rejected with an explanation.
+func TestParseErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		field  string
+		record string
+		err    *testtools.ErrorSpec
+	}{
+		"Missing body hash": {
+			field: "DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=test; h=from; b=AAAA",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DKIM-Signature is missing its bh= tag"},
+		},
+		"Body length limit": {
+			field: "DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=test; h=from; l=10; bh=AAAA; b=AAAA",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DKIM signatures with a body length limit (l=) are not supported"},
+		},
+		"Unsupported algorithm": {
+			field: "DKIM-Signature: v=1; a=rsa-sha1; d=example.com; s=test; h=from; bh=AAAA; b=AAAA",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported DKIM signature algorithm \"rsa-sha1\": expected ed25519-sha256 or rsa-sha256"},
+		},
+		"From not covered": {
+			field: "DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=test; h=to:subject; bh=AAAA; b=AAAA",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DKIM signatures must cover the From header"},
+		},
+		"Unsupported key type": {
+			record: "v=DKIM1; k=dsa; p=AAAA",
+			err:    &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported DKIM key type \"dsa\": expected ed25519 or rsa"},
+		},
+		"Missing key": {
+			record: "v=DKIM1; k=rsa",
+			err:    &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DKIM key record is missing its p= tag"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			var err error
+			if tc.field != "" {
+				_, err = dkim.ParseSignature(tc.field)
+			} else {
+				_, err = dkim.ParseRecord(tc.record)
+			}
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+	key, err := dkim.ParseRecord("v=DKIM1; k=ed25519; p=")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	message, _ := dkim.ParseMessage([]byte(RFCSignature + Message))
+	sig, _ := dkim.ParseSignature(message.Signatures()[0])
+	_, err = sig.Verify(message, key)
+	expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DKIM key has been revoked"}
+	if err := expectedErr.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+}
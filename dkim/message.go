@@ -0,0 +1,140 @@
+package dkim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Canonicalization is a DKIM canonicalization algorithm, which determines
+// how much a message may be changed in transit without breaking its
+// signature.
+type Canonicalization string
+
+// DKIM canonicalization algorithms
+const (
+	// Simple tolerates almost no changes.
+	Simple Canonicalization = "simple"
+	// Relaxed tolerates common changes to whitespace and header folding.
+	Relaxed Canonicalization = "relaxed"
+)
+
+// ParseCanonicalization parses the value of a c= tag: the header and body
+// canonicalization separated by a slash, or just the header canonicalization,
+// in which case the body canonicalization is simple.
+func ParseCanonicalization(value string) (header Canonicalization, body Canonicalization, err error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) == 1 {
+		parts = append(parts, string(Simple))
+	}
+	for _, part := range parts {
+		if (Canonicalization(part) != Simple) && (Canonicalization(part) != Relaxed) {
+			return "", "", fmt.Errorf("Unsupported DKIM canonicalization %#v: expected simple or relaxed, or header/body such as relaxed/simple", value)
+		}
+	}
+	return Canonicalization(parts[0]), Canonicalization(parts[1]), nil
+}
+
+// wspRun matches a run of whitespace within a line.
+var wspRun = regexp.MustCompile("[ \t]+")
+
+// Message is an RFC 5322 email message, split into its header fields, each
+// as it appeared including any folding and its final CRLF, and its body.
+type Message struct {
+	Fields []string
+	Body   []byte
+}
+
+// ParseMessage parses a raw email message. Lines may end with CRLF or just
+// LF, and are converted to end with CRLF, as they are when sent.
+func ParseMessage(data []byte) (*Message, error) {
+	normalized := bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	header := normalized
+	result := &Message{Body: []byte{}}
+	if end := bytes.Index(normalized, []byte("\r\n\r\n")); end >= 0 {
+		header = normalized[:end+2]
+		result.Body = normalized[end+4:]
+	} else if bytes.HasPrefix(normalized, []byte("\r\n")) {
+		header = nil
+		result.Body = normalized[2:]
+	}
+	for i, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ') || (line[0] == '\t') {
+			if len(result.Fields) == 0 {
+				return nil, errors.New("Email message starts with a continuation line")
+			}
+			result.Fields[len(result.Fields)-1] += line
+			continue
+		}
+		if !strings.Contains(line, ":") {
+			return nil, fmt.Errorf("Email header line %d is not a header field", i+1)
+		}
+		if !strings.HasSuffix(line, "\r\n") {
+			line += "\r\n"
+		}
+		result.Fields = append(result.Fields, line)
+	}
+	if len(result.Fields) == 0 {
+		return nil, errors.New("Email message has no header fields")
+	}
+	return result, nil
+}
+
+// fieldName returns the name of a header field.
+func fieldName(field string) string {
+	return strings.TrimSpace(field[:strings.Index(field, ":")])
+}
+
+// Has returns whether the message has a header field called name, ignoring
+// case.
+func (m *Message) Has(name string) bool {
+	for _, field := range m.Fields {
+		if strings.EqualFold(fieldName(field), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalizeField canonicalizes a header field, including its final CRLF.
+func canonicalizeField(field string, c Canonicalization) string {
+	if c == Simple {
+		return field
+	}
+	colon := strings.Index(field, ":")
+	value := strings.ReplaceAll(field[colon+1:], "\r\n", "")
+	value = strings.Trim(wspRun.ReplaceAllString(value, " "), " ")
+	return strings.ToLower(fieldName(field)) + ":" + value + "\r\n"
+}
+
+// canonicalizeBody canonicalizes a message body.
+func canonicalizeBody(body []byte, c Canonicalization) []byte {
+	lines := strings.SplitAfter(string(body), "\r\n")
+	if c == Relaxed {
+		for i, line := range lines {
+			ending := ""
+			if strings.HasSuffix(line, "\r\n") {
+				line, ending = strings.TrimSuffix(line, "\r\n"), "\r\n"
+			}
+			lines[i] = strings.TrimRight(wspRun.ReplaceAllString(line, " "), " ") + ending
+		}
+	}
+	for (len(lines) > 0) && ((lines[len(lines)-1] == "\r\n") || (lines[len(lines)-1] == "")) {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		if c == Simple {
+			return []byte("\r\n")
+		}
+		return []byte{}
+	}
+	if last := lines[len(lines)-1]; !strings.HasSuffix(last, "\r\n") {
+		lines[len(lines)-1] = last + "\r\n"
+	}
+	return []byte(strings.Join(lines, ""))
+}
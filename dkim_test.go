@@ -0,0 +1,177 @@
+package codechallenge_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"strings"
+	"testing"
+)
+
+// EmailMessage is the message of the examples of RFC 8463, Appendix A.
+const EmailMessage = "From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+// RFCDKIMSignature is the Ed25519 signature of EmailMessage in RFC 8463,
+// Appendix A, by the key in RFCDKIMRecord.
+const RFCDKIMSignature = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+	" subject : date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+	" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n"
+
+// RFCDKIMRecord is the zone file entry of the
+// brisbane._domainkey.football.example.com key in RFC 8463, Appendix A.
+const RFCDKIMRecord = "brisbane._domainkey.football.example.com. IN TXT (\n" +
+	"    \"v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=\")\n"
+
+// TestSignAndVerifyDKIM verifies that the DKIM-Signature header field written
+// by the dkim command makes a message that verify-dkim finds valid against
+// the DNS record written by export-dkim-record, and that changes to the
+// message are detected.
+func TestSignAndVerifyDKIM(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		keyArgs    []string
+		signArgs   []string
+		field      testtools.StringMatcher
+		tamper     func(string) string
+		verifyArgs []string
+		status     int
+		stdOutput  testtools.StringMatcher
+	}{
+		"Ed25519 with default headers": {
+			keyArgs:    []string{"-ed25519"},
+			signArgs:   []string{"-domain", "football.example.com", "-selector", "mail"},
+			field:      testtools.NewRegexpStringMatcher("^DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n\td=football.example.com; s=mail; t=1567339200;\r\n\th=From:To:Subject:Date:Message-ID;\r\n\tbh=[A-Za-z0-9+/]{43}=;\r\n\tb=[A-Za-z0-9+/]{70}\r\n\t[A-Za-z0-9+/]{16}==\r\n$"),
+			verifyArgs: []string{"-dns-record", "mail.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"domain\": \"football.example.com\",\n\"selector\": \"mail\",\n\"headers\": [\n\"From\",\n\"To\",\n\"Subject\",\n\"Date\",\n\"Message-ID\"\n]\n}"),
+		},
+		"RSA with simple canonicalization": {
+			keyArgs:    []string{"-rsa"},
+			signArgs:   []string{"-domain", "football.example.com", "-selector", "mail", "-canonicalization", "simple", "-headers", "From, Subject, From"},
+			field:      testtools.NewRegexpStringMatcher("^DKIM-Signature: v=1; a=rsa-sha256; c=simple/simple; d=football.example.com;\r\n\ts=mail; t=1567339200; h=From:Subject:From;\r\n\tbh=[A-Za-z0-9+/]{43}=;\r\n\tb="),
+			verifyArgs: []string{"-dns-record", "mail.txt", "-domain", "football.example.com", "-selector", "mail"},
+			status:     0,
+			stdOutput:  testtools.NewRegexpStringMatcher("^\\{\n\"valid\": true,"),
+		},
+		"RFC 8463 example": {
+			field:      testtools.NewStringStringMatcher(RFCDKIMSignature),
+			verifyArgs: []string{"-dns-record", "rfc.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"domain\": \"football.example.com\",\n\"selector\": \"brisbane\",\n\"headers\": [\n\"from\",\n\"to\",\n\"subject\",\n\"date\",\n\"message-id\",\n\"from\",\n\"subject\",\n\"date\"\n]\n}"),
+		},
+		"Relaxed canonicalization of changed whitespace": {
+			keyArgs:    []string{"-ed25519"},
+			signArgs:   []string{"-domain", "football.example.com", "-selector", "mail"},
+			field:      testtools.NewRegexpStringMatcher("^DKIM-Signature: "),
+			tamper:     func(message string) string { return strings.Replace(message, "Subject: Is", "subject:\r\n\tIs", 1) },
+			verifyArgs: []string{"-dns-record", "mail.txt"},
+			status:     0,
+			stdOutput:  testtools.NewRegexpStringMatcher("^\\{\n\"valid\": true,"),
+		},
+		"Changed subject": {
+			keyArgs:    []string{"-ed25519"},
+			signArgs:   []string{"-domain", "football.example.com", "-selector", "mail"},
+			field:      testtools.NewRegexpStringMatcher("^DKIM-Signature: "),
+			tamper:     func(message string) string { return strings.Replace(message, "dinner", "lunch", 1) },
+			verifyArgs: []string{"-dns-record", "mail.txt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+		},
+		"Changed body": {
+			keyArgs:    []string{"-rsa"},
+			signArgs:   []string{"-domain", "football.example.com", "-selector", "mail"},
+			field:      testtools.NewRegexpStringMatcher("^DKIM-Signature: "),
+			tamper:     func(message string) string { return strings.Replace(message, "hungry", "thirsty", 1) },
+			verifyArgs: []string{"-dns-record", "mail.txt"},
+			status:     10,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"signed content mismatch\",\n\"detail\": \"DKIM body hash does not match the body of the message\"\n}"),
+		},
+		"Verified against another key's record": {
+			keyArgs:    []string{"-ed25519"},
+			signArgs:   []string{"-domain", "football.example.com", "-selector", "mail"},
+			field:      testtools.NewRegexpStringMatcher("^DKIM-Signature: "),
+			verifyArgs: []string{"-dns-record", "rfc.txt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+		},
+		"RSA signature verified against an Ed25519 record": {
+			keyArgs:    []string{"-rsa"},
+			signArgs:   []string{"-domain", "football.example.com", "-selector", "mail"},
+			field:      testtools.NewRegexpStringMatcher("^DKIM-Signature: "),
+			verifyArgs: []string{"-dns-record", "rfc.txt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"DKIM signature algorithm rsa-sha256 can't be used with a key of type ed25519\"\n}"),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/rfc.txt": testtools.StringPtr(RFCDKIMRecord),
+			}
+			field := RFCDKIMSignature
+			if tc.signArgs != nil {
+				recordBundle := mocks.NewDefaultMockDeps("", append([]string{"codechallenge", "export-dkim-record"}, tc.keyArgs...), "/home/anybody", &files)
+				err := recordBundle.InvokeCallInMockedEnv(func() error {
+					codechallenge.RealMain(recordBundle.Deps)
+					return nil
+				})
+				if err != nil {
+					tt.Fatalf("Unexpected error calling recordBundle.InvokeCallInMockedEnv(): %s", err.Error())
+				}
+				if exitStatus := recordBundle.GetExitStatus(); exitStatus != 0 {
+					tt.Fatalf("Exporting the DNS record failed with exit status %d:\n%s", exitStatus, recordBundle.ErrBuf.String())
+				}
+				files["/home/anybody/mail.txt"] = testtools.StringPtr(recordBundle.OutBuf.String())
+				signBundle := mocks.NewDefaultMockDeps(EmailMessage, append(append([]string{"codechallenge", "dkim"}, tc.keyArgs...), tc.signArgs...), "/home/anybody", &files)
+				err = signBundle.InvokeCallInMockedEnv(func() error {
+					codechallenge.RealMain(signBundle.Deps)
+					return nil
+				})
+				if err != nil {
+					tt.Fatalf("Unexpected error calling signBundle.InvokeCallInMockedEnv(): %s", err.Error())
+				}
+				if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+					tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+				}
+				field = signBundle.OutBuf.String()
+			}
+			if err := tc.field.MatchString(field); err != nil {
+				tt.Errorf("DKIM-Signature:\n%#v didn't match:\n%s.", field, err.Error())
+			}
+			message := field + EmailMessage
+			if tc.tamper != nil {
+				message = tc.tamper(message)
+			}
+			verifyBundle := mocks.NewDefaultMockDeps(message, append([]string{"codechallenge", "verify-dkim"}, tc.verifyArgs...), "/home/anybody", &files)
+			err := verifyBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(verifyBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Errorf("Unexpected error calling verifyBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if errOutput := verifyBundle.ErrBuf.String(); errOutput != "" {
+				tt.Errorf("Standard Error should be empty. Got %#v instead.", errOutput)
+			}
+		})
+	}
+}
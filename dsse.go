@@ -0,0 +1,209 @@
+package codechallenge
+
+import (
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/dsse"
+	"github.com/smartedge/codechallenge/intoto"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// DSSESettings describes the payload type of a DSSE envelope being signed,
+// or that a signature is being added to an existing envelope, and the
+// predicate of the in-toto Statement written by the attest command.
+type DSSESettings struct {
+	PayloadType   string
+	AddSignature  bool
+	PredicateType string
+	PredicatePath string
+}
+
+// DSSEVerdict is the outcome of verifying a DSSE envelope, to be rendered to
+// JSON. The payload type, and the Statement of an in-toto payload, are only
+// included if the signature is valid.
+type DSSEVerdict struct {
+	*Verdict
+	PayloadType string            `json:"payloadType,omitempty"`
+	Statement   *intoto.Statement `json:"statement,omitempty"`
+}
+
+// signAndWriteDSSE adds a signature by the keys in cryptStuff to envelope,
+// or signs payload of payloadType as a new envelope if envelope is nil, and
+// writes the envelope to d.Os.Stdout.
+func signAndWriteDSSE(d *deps.Dependencies, cryptStuff *crypt.CryptoTooling, envelope *dsse.Envelope, payloadType string, payload []byte) {
+	var err error
+	if envelope == nil {
+		envelope, err = dsse.Sign(cryptStuff.Signer, d.Crypto.Rand.Reader, payloadType, payload)
+	} else {
+		err = envelope.AddSignature(cryptStuff.Signer, d.Crypto.Rand.Reader)
+	}
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	valid, err := envelope.VerifyKey(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	buff, err := envelope.JSON()
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	err = WriteOutput(d, buff)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// SignDSSEMain signs message as the payload of a DSSE envelope with the keys
+// in cryptStuff, and writes the envelope to d.Os.Stdout.
+func SignDSSEMain(d *deps.Dependencies, config *RunConfig, cryptStuff *crypt.CryptoTooling, message string) {
+	signAndWriteDSSE(d, cryptStuff, nil, config.DSSE.PayloadType, []byte(message))
+}
+
+// AddDSSESignatureMain is the entry-point for -add-signature. It reads a DSSE
+// envelope from d.Os.Stdin, which isn't subject to the length limit of a
+// message, and writes it to d.Os.Stdout with a signature by the configured
+// key added.
+func AddDSSESignatureMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	envelope, err := dsse.Parse(buff)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	signAndWriteDSSE(d, cryptStuff, envelope, envelope.PayloadType, envelope.Payload)
+}
+
+// AttestMain is the entry-point for the attest command. It writes a DSSE
+// envelope of an in-toto Statement of the predicate in config about the files
+// in config, each identified by its digest, to d.Os.Stdout.
+func AttestMain(d *deps.Dependencies, config *RunConfig) {
+	hash := config.PubKeySettings.GetHash()
+	subjects := []*intoto.Subject{}
+	for _, path := range config.Paths {
+		digest, err := HashFile(d, path, hash)
+		if err != nil {
+			HandleError(d, err, 2)
+		}
+		subjects = append(subjects, &intoto.Subject{
+			Name:   filepath.ToSlash(path),
+			Digest: map[string]string{crypt.HashName(hash): digest.Hex()},
+		})
+	}
+	var predicate []byte
+	if config.DSSE.PredicatePath != "" {
+		var err error
+		predicate, err = d.Io.Ioutil.ReadFile(config.DSSE.PredicatePath)
+		if err != nil {
+			HandleError(d, err, 2)
+		}
+	}
+	statement, err := intoto.NewStatement(subjects, config.DSSE.PredicateType, predicate)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	payload, err := statement.Marshal()
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	signAndWriteDSSE(d, cryptStuff, nil, intoto.PayloadType, payload)
+}
+
+// VerifyDSSEMain is the entry-point for -verify mode with DSSE input. It
+// reads a DSSE envelope from d.Os.Stdin, and writes the verdict in JSON
+// format to d.Os.Stdout, exiting with the verdict's exit status if it isn't
+// valid.
+func VerifyDSSEMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	envelope, err := dsse.Parse(buff)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyDSSE(d, config, envelope)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyDSSE checks that envelope has a valid signature by the public key
+// file in config. Signatures by other keys are ignored, so that each signer
+// of an envelope can be checked in turn. An in-toto payload must also be a
+// valid Statement.
+func VerifyDSSE(d *deps.Dependencies, config *RunConfig, envelope *dsse.Envelope) (*DSSEVerdict, error) {
+	publicKey, err := loadPublicKey(d, config.PubKeySettings.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	result := &DSSEVerdict{Verdict: newVerdictFromVerification(envelope.VerifyKey(publicKey))}
+	if !result.Valid {
+		return result, nil
+	}
+	result.PayloadType = envelope.PayloadType
+	if envelope.PayloadType == intoto.PayloadType {
+		result.Statement, err = intoto.ParseStatement(envelope.Payload)
+		if err != nil {
+			result.Verdict = NewVerdict(InvalidClaims, err.Error())
+		}
+	}
+	return result, nil
+}
+
+// parseDSSEOptions validates the DSSE payload type, co-signing and in-toto
+// predicate options in cl into config.
+func parseDSSEOptions(config *RunConfig, cl *commandLine) error {
+	if (*cl.payloadType != "") || *cl.addSignature {
+		if !config.Output.Format.IsDSSE() || config.VerifyMode {
+			return errors.New("Options -payload-type and -add-signature are only valid when signing DSSE output")
+		}
+		if (*cl.payloadType != "") && *cl.addSignature {
+			return errors.New("Options -payload-type and -add-signature may not be used together, as the envelope already has a payload type")
+		}
+		if *cl.payloadType != "" {
+			config.DSSE.PayloadType = *cl.payloadType
+		}
+		config.DSSE.AddSignature = *cl.addSignature
+	}
+	if (*cl.predicateType != "") || (*cl.predicatePath != "") {
+		if config.Command != AttestCommand {
+			return fmt.Errorf("Options -predicate-type and -predicate are only valid with the %s command", AttestCommand)
+		}
+		config.DSSE.PredicateType = *cl.predicateType
+		config.DSSE.PredicatePath = *cl.predicatePath
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Package dsse signs and verifies Dead Simple Signing Envelopes, which sign a
+// payload of any type, along with that type, with one or more keys.
+package dsse
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/jws"
+	"io"
+)
+
+// paePrefix starts the pre-authentication encoding of every envelope.
+const paePrefix = "DSSEv1"
+
+// curveHashes maps the supported ECDSA curves to the hash their signatures
+// use, as DSSE leaves that to the key.
+var curveHashes = map[elliptic.Curve]crypto.Hash{
+	elliptic.P256(): crypto.SHA256,
+	elliptic.P384(): crypto.SHA384,
+	elliptic.P521(): crypto.SHA512,
+}
+
+// Signature is one signature of an envelope. The key ID is a hint of which
+// key made it, and may be empty.
+type Signature struct {
+	KeyID string
+	Value crypt.BinarySignature
+}
+
+// Envelope is a DSSE envelope.
+type Envelope struct {
+	PayloadType string
+	Payload     []byte
+	Signatures  []*Signature
+}
+
+// envelopeJSON is the JSON serialization of an envelope.
+type envelopeJSON struct {
+	PayloadType string           `json:"payloadType"`
+	Payload     string           `json:"payload"`
+	Signatures  []*signatureJSON `json:"signatures"`
+}
+
+// signatureJSON is the JSON serialization of a signature.
+type signatureJSON struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// PAE returns the pre-authentication encoding of payloadType and payload,
+// which is what each signature signs.
+func PAE(payloadType string, payload []byte) []byte {
+	result := []byte(fmt.Sprintf("%s %d %s %d ", paePrefix, len(payloadType), payloadType, len(payload)))
+	return append(result, payload...)
+}
+
+// SchemeForKey returns how publicKey signs an envelope. ECDSA signatures are
+// ASN.1 encoded, as those of sigstore are, with the hash that matches the
+// curve, and RSA signatures use PSS with SHA-256.
+func SchemeForKey(publicKey crypto.PublicKey) (crypt.SignatureScheme, error) {
+	scheme := crypt.SignatureScheme{Hash: crypto.SHA256, RSAPadding: crypt.PSSPadding, ECDSAEncoding: crypt.ASN1Encoding}
+	switch typedKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		hash, ok := curveHashes[typedKey.Curve]
+		if !ok {
+			return scheme, fmt.Errorf("Unsupported elliptic curve: %s", typedKey.Curve.Params().Name)
+		}
+		scheme.Hash = hash
+	case *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return scheme, fmt.Errorf("Public key did not conform to recognized algorithm: %T", publicKey)
+	}
+	return scheme, nil
+}
+
+// Sign returns an envelope of payload, of type payloadType, signed by
+// signer.
+func Sign(signer crypto.Signer, randReader io.Reader, payloadType string, payload []byte) (*Envelope, error) {
+	if payloadType == "" {
+		return nil, errors.New("DSSE envelopes require a payload type")
+	}
+	result := &Envelope{PayloadType: payloadType, Payload: payload}
+	if err := result.AddSignature(signer, randReader); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AddSignature signs the envelope with signer, alongside its existing
+// signatures, none of which may be by the same key.
+func (e *Envelope) AddSignature(signer crypto.Signer, randReader io.Reader) error {
+	scheme, err := SchemeForKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	kid, err := jws.KeyID(signer.Public())
+	if err != nil {
+		return err
+	}
+	for _, sig := range e.Signatures {
+		if sig.KeyID == kid {
+			return fmt.Errorf("DSSE envelope is already signed by key %s", kid)
+		}
+	}
+	value, err := crypt.SignWithScheme(signer, randReader, PAE(e.PayloadType, e.Payload), scheme)
+	if err != nil {
+		return err
+	}
+	e.Signatures = append(e.Signatures, &Signature{KeyID: kid, Value: value})
+	return nil
+}
+
+// Verify checks sig against publicKey. RSA signatures may use either PSS or
+// PKCS #1 v1.5 padding, as both are in use. An error explains why a
+// signature isn't valid.
+func (e *Envelope) Verify(sig *Signature, publicKey crypto.PublicKey) (bool, error) {
+	scheme, err := SchemeForKey(publicKey)
+	if err != nil {
+		return false, err
+	}
+	valid, err := crypt.VerifyWithScheme(publicKey, PAE(e.PayloadType, e.Payload), sig.Value, scheme)
+	if _, ok := publicKey.(*rsa.PublicKey); ok && !valid {
+		scheme.RSAPadding = crypt.PKCS1v15Padding
+		return crypt.VerifyWithScheme(publicKey, PAE(e.PayloadType, e.Payload), sig.Value, scheme)
+	}
+	return valid, err
+}
+
+// VerifyKey checks that the envelope has a valid signature by publicKey.
+// Signatures with the key ID of another key are skipped, and those without
+// a key ID are tried. An error explains why there is no valid signature.
+func (e *Envelope) VerifyKey(publicKey crypto.PublicKey) (bool, error) {
+	kid, err := jws.KeyID(publicKey)
+	if err != nil {
+		return false, err
+	}
+	tried := false
+	for _, sig := range e.Signatures {
+		if (sig.KeyID != "") && (sig.KeyID != kid) {
+			continue
+		}
+		tried = true
+		if valid, _ := e.Verify(sig, publicKey); valid {
+			return true, nil
+		}
+	}
+	if !tried {
+		return false, fmt.Errorf("DSSE envelope has no signature by key %s", kid)
+	}
+	return false, nil
+}
+
+// JSON returns the JSON serialization of the envelope.
+func (e *Envelope) JSON() ([]byte, error) {
+	result := &envelopeJSON{
+		PayloadType: e.PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(e.Payload),
+		Signatures:  []*signatureJSON{},
+	}
+	for _, sig := range e.Signatures {
+		result.Signatures = append(result.Signatures, &signatureJSON{KeyID: sig.KeyID, Sig: sig.Value.Base64()})
+	}
+	return json.Marshal(result)
+}
+
+// decodeBase64 decodes src, which may be in standard or URL safe base64,
+// with or without padding, as DSSE allows.
+func decodeBase64(src string) ([]byte, error) {
+	var err error
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		var result []byte
+		if result, err = encoding.DecodeString(src); err == nil {
+			return result, nil
+		}
+	}
+	return nil, err
+}
+
+// Parse parses the JSON serialization of an envelope.
+func Parse(data []byte) (*Envelope, error) {
+	parsed := &envelopeJSON{}
+	if err := json.Unmarshal(data, parsed); err != nil {
+		return nil, fmt.Errorf("DSSE envelope is not valid JSON: %s", err.Error())
+	}
+	if parsed.PayloadType == "" {
+		return nil, errors.New("DSSE envelope is missing its payloadType")
+	}
+	if len(parsed.Signatures) == 0 {
+		return nil, errors.New("DSSE envelope has no signatures")
+	}
+	payload, err := decodeBase64(parsed.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("DSSE payload is not valid base64: %s", err.Error())
+	}
+	result := &Envelope{PayloadType: parsed.PayloadType, Payload: payload}
+	for i, sig := range parsed.Signatures {
+		value, err := decodeBase64(sig.Sig)
+		if err != nil {
+			return nil, fmt.Errorf("DSSE signature %d is not valid base64: %s", i+1, err.Error())
+		}
+		result.Signatures = append(result.Signatures, &Signature{KeyID: sig.KeyID, Value: value})
+	}
+	return result, nil
+}
@@ -0,0 +1,172 @@
+package dsse_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/smartedge/codechallenge/dsse"
+	"github.com/smartedge/codechallenge/testtools"
+	"testing"
+)
+
+// OpenSSLEnvelope is an envelope of an in-toto Statement signed with
+// OpenSSLPublicKey's private key by `openssl dgst -sha256 -sign`, without a
+// key ID.
+const OpenSSLEnvelope = `{"payloadType": "application/vnd.in-toto+json", "payload": "eyJfdHlwZSI6Imh0dHBzOi8vaW4tdG90by5pby9TdGF0ZW1lbnQvdjEiLCJzdWJqZWN0IjpbeyJuYW1lIjoiaGVsbG8udHh0IiwiZGlnZXN0Ijp7InNoYTI1NiI6ImRmZmQ2MDIxYmIyYmQ1YjBhZjY3NjI5MDgwOWVjM2E1MzE5MWRkODFjN2Y3MGE0YjI4Njg4YTM2MjE4Mjk4NmYifX1dLCJwcmVkaWNhdGVUeXBlIjoiaHR0cHM6Ly9leGFtcGxlLmNvbS90ZXN0L3YxIiwicHJlZGljYXRlIjp7ImJ1aWx0Ijp0cnVlfX0=", "signatures": [{"keyid": "", "sig": "MEUCIQCPst+Hb38AIMHQs0Jq57CLQLjicPnFsqFwY8lHetIAzQIgaPC9b4M/8pQYbkl7tRfJ0mZPHAJBZmjNO082pYwX5ZY="}]}`
+
+// OpenSSLPublicKey is the P-256 public key that signed OpenSSLEnvelope.
+const OpenSSLPublicKey = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE3TremGLoqmpf82y4JojUFZh31rjL
+sSn1bStMNYh4KygXnR8ttEo1D91EMwogWSRVhjSQlAECt46AZvAHx/osRA==
+-----END PUBLIC KEY-----
+`
+
+// TestPAE verifies the pre-authentication encoding against the example in
+// the DSSE specification.
+func TestPAE(t *testing.T) {
+	expected := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if pae := string(dsse.PAE("http://example.com/HelloWorld", []byte("hello world"))); pae != expected {
+		t.Errorf("PAE should be %#v. Got %#v instead.", expected, pae)
+	}
+}
+
+// TestSignAndVerify verifies that envelopes parse back to valid envelopes
+// for each kind of key, and that changes to the payload or its type are
+// detected.
+func TestSignAndVerify(t *testing.T) {
+	ecdsaP256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecdsaP384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	ecdsaP521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for desc, signer := range map[string]crypto.Signer{
+		"ECDSA P-256": ecdsaP256,
+		"ECDSA P-384": ecdsaP384,
+		"ECDSA P-521": ecdsaP521,
+		"Ed25519":     ed25519Key,
+		"RSA":         rsaKey,
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			envelope, err := dsse.Sign(signer, rand.Reader, "text/plain", []byte("Hello, World!"))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			buff, err := envelope.JSON()
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			parsed, err := dsse.Parse(buff)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if valid, err := parsed.VerifyKey(signer.Public()); !valid {
+				tt.Errorf("Envelope should be valid: %v", err)
+			}
+			parsed.Payload = []byte("Goodbye, World!")
+			if valid, err := parsed.VerifyKey(signer.Public()); valid {
+				tt.Errorf("Envelope of another payload should not be valid: %v", err)
+			}
+			parsed.Payload = []byte("Hello, World!")
+			parsed.PayloadType = "text/html"
+			if valid, err := parsed.VerifyKey(signer.Public()); valid {
+				tt.Errorf("Envelope of another payload type should not be valid: %v", err)
+			}
+		})
+	}
+}
+
+// TestMultipleSignatures verifies that an envelope signed by two keys is
+// valid for each of them, but not for a third, and can't be signed twice by
+// the same key.
+func TestMultipleSignatures(t *testing.T) {
+	first, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, second, _ := ed25519.GenerateKey(rand.Reader)
+	third, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	envelope, err := dsse.Sign(first, rand.Reader, "text/plain", []byte("Hello, World!"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if err := envelope.AddSignature(second, rand.Reader); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(envelope.Signatures) != 2 {
+		t.Fatalf("Envelope should have 2 signatures. Got %d instead.", len(envelope.Signatures))
+	}
+	for _, signer := range []crypto.Signer{first, second} {
+		if valid, err := envelope.VerifyKey(signer.Public()); !valid {
+			t.Errorf("Envelope should be valid for each signer: %v", err)
+		}
+	}
+	valid, err := envelope.VerifyKey(third.Public())
+	if valid || (err == nil) {
+		t.Errorf("Envelope should not be valid for a third key")
+	}
+	err = envelope.AddSignature(first, rand.Reader)
+	expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: fmt.Sprintf("DSSE envelope is already signed by key %s", envelope.Signatures[0].KeyID)}
+	if err := expectedErr.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+// TestOpenSSLEnvelope verifies an envelope made independently of this
+// package.
+func TestOpenSSLEnvelope(t *testing.T) {
+	block, _ := pem.Decode([]byte(OpenSSLPublicKey))
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	envelope, err := dsse.Parse([]byte(OpenSSLEnvelope))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if envelope.PayloadType != "application/vnd.in-toto+json" {
+		t.Errorf("Unexpected payload type %#v", envelope.PayloadType)
+	}
+	if valid, err := envelope.VerifyKey(publicKey); !valid {
+		t.Errorf("Envelope should be valid: %v", err)
+	}
+}
+
+// TestParseErrors verifies that malformed envelopes are rejected with an
+// explanation.
+func TestParseErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		input string
+		err   *testtools.ErrorSpec
+	}{
+		"Not JSON": {
+			input: "Hello, World!",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DSSE envelope is not valid JSON: invalid character 'H' looking for beginning of value"},
+		},
+		"Missing payload type": {
+			input: `{"payload": "", "signatures": [{"sig": ""}]}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DSSE envelope is missing its payloadType"},
+		},
+		"No signatures": {
+			input: `{"payloadType": "text/plain", "payload": "", "signatures": []}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DSSE envelope has no signatures"},
+		},
+		"Payload not base64": {
+			input: `{"payloadType": "text/plain", "payload": "!", "signatures": [{"sig": ""}]}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DSSE payload is not valid base64: illegal base64 data at input byte 0"},
+		},
+		"Signature not base64": {
+			input: `{"payloadType": "text/plain", "payload": "", "signatures": [{"sig": "!"}]}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "DSSE signature 1 is not valid base64: illegal base64 data at input byte 0"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			_, err := dsse.Parse([]byte(tc.input))
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package codechallenge_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge/dsse"
+	"github.com/smartedge/codechallenge/testtools"
+	"strings"
+	"testing"
+)
+
+// TestSignAndVerifyDSSE verifies that DSSE envelopes written by RealMain,
+// including those with signatures added to them and the in-toto Statements
+// written by the attest command, can be verified in -verify mode against the
+// public key of each signer.
+func TestSignAndVerifyDSSE(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signArgs   [][]string
+		tamper     func(string) string
+		verifyArgs []string
+		status     int
+		stdOutput  testtools.StringMatcher
+		stdErr     testtools.StringMatcher
+	}{
+		"Payload": {
+			signArgs:   [][]string{{"codechallenge", "-format", "dsse", "-payload-type", "text/plain"}},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "dsse"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"payloadType\": \"text/plain\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"First of two signatures": {
+			signArgs: [][]string{
+				{"codechallenge", "-format", "dsse"},
+				{"codechallenge", "-ed25519", "-format", "dsse", "-add-signature"},
+			},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "dsse"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"payloadType\": \"application/octet-stream\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Second of two signatures": {
+			signArgs: [][]string{
+				{"codechallenge", "-format", "dsse"},
+				{"codechallenge", "-ed25519", "-format", "dsse", "-add-signature"},
+			},
+			verifyArgs: []string{"codechallenge", "-ed25519", "-verify", "-format", "dsse"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"payloadType\": \"application/octet-stream\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Signature added twice": {
+			signArgs: [][]string{
+				{"codechallenge", "-format", "dsse"},
+				{"codechallenge", "-format", "dsse", "-add-signature"},
+			},
+			status:    5,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewRegexpStringMatcher("^DSSE envelope is already signed by key [A-Za-z0-9_-]{43}\nUsage of codechallenge:"),
+		},
+		"Attestation": {
+			signArgs:   [][]string{{"codechallenge", "attest", "-predicate-type", "https://example.com/test/v1", "-predicate", "predicate.json", "hello.txt"}},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "dsse"},
+			status:     0,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"payloadType\": \"application/vnd.in-toto+json\",\n\"statement\": {\n" +
+				"\"_type\": \"https://in-toto.io/Statement/v1\",\n\"subject\": [\n{\n\"name\": \"hello.txt\",\n\"digest\": {\n" +
+				"\"sha256\": \"dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f\"\n}\n}\n],\n" +
+				"\"predicateType\": \"https://example.com/test/v1\",\n\"predicate\": {\n\"built\": true\n}\n}\n}"),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Changed payload type": {
+			signArgs:   [][]string{{"codechallenge", "-format", "dsse", "-payload-type", "text/plain"}},
+			tamper:     func(envelope string) string { return strings.Replace(envelope, "text/plain", "text/html", 1) },
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "dsse"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Verified with the wrong key": {
+			signArgs:   [][]string{{"codechallenge", "-format", "dsse"}},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "dsse", "-public", "other.pub"},
+			status:     9,
+			stdOutput:  testtools.NewRegexpStringMatcher("^\\{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"DSSE envelope has no signature by key [A-Za-z0-9_-]{43}\"\n\\}$"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/hello.txt":      testtools.StringPtr("Hello, World!"),
+				"/home/anybody/predicate.json": testtools.StringPtr("{\"built\": true}\n"),
+			}
+			// An unrelated key-pair, to verify with:
+			testtools.AddOtherKeyPair(files, "/home/anybody")
+			// Each signing step signs the output of the last:
+			envelope := "Hello, World!"
+			for i, args := range tc.signArgs {
+				signBundle := runMain(tt, &files, envelope, args[1:]...)
+				if tc.verifyArgs == nil && (i == len(tc.signArgs)-1) {
+					if exitStatus := signBundle.GetExitStatus(); exitStatus != tc.status {
+						tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+					}
+					if err := tc.stdErr.MatchString(signBundle.ErrBuf.String()); err != nil {
+						tt.Errorf("Standard Error:\n%#v didn't match:\n%s.", signBundle.ErrBuf.String(), err.Error())
+					}
+					return
+				}
+				if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+					tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+				}
+				envelope = signBundle.OutBuf.String()
+			}
+			if parsed, err := dsse.Parse([]byte(envelope)); err != nil {
+				tt.Fatalf("Unexpected error parsing DSSE envelope: %s", err.Error())
+			} else if len(parsed.Signatures) != len(tc.signArgs) {
+				tt.Errorf("DSSE envelope should have %d signatures. Got %d instead.", len(tc.signArgs), len(parsed.Signatures))
+			}
+			if tc.tamper != nil {
+				envelope = tc.tamper(envelope)
+			}
+			verifyBundle := runMain(tt, &files, envelope, tc.verifyArgs[1:]...)
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if err := tc.stdErr.MatchString(verifyBundle.ErrBuf.String()); err != nil {
+				tt.Errorf("Standard Error:\n%#v didn't match:\n%s.", verifyBundle.ErrBuf.String(), err.Error())
+			}
+		})
+	}
+}
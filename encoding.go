@@ -0,0 +1,56 @@
+package codechallenge
+
+import (
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"sort"
+	"strings"
+)
+
+// characterEncoding is a named character set that can be transcoded to UTF-8.
+type characterEncoding struct {
+	name     string
+	encoding encoding.Encoding
+}
+
+// characterEncodings are the supported input character sets, indexed by
+// lower case name and alias. UTF-16 input must begin with a byte order mark
+// so that its byte order is known.
+var characterEncodings = map[string]characterEncoding{
+	"iso-8859-1":   {name: "ISO-8859-1", encoding: charmap.ISO8859_1},
+	"latin1":       {name: "ISO-8859-1", encoding: charmap.ISO8859_1},
+	"windows-1252": {name: "windows-1252", encoding: charmap.Windows1252},
+	"cp1252":       {name: "windows-1252", encoding: charmap.Windows1252},
+	"utf-16":       {name: "UTF-16", encoding: unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)},
+}
+
+// CanonicalEncodingName returns the canonical name of the character set
+// named by name. Names are not case sensitive.
+func CanonicalEncodingName(name string) (string, error) {
+	charset, ok := characterEncodings[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(characterEncodings))
+		for knownName := range characterEncodings {
+			names = append(names, knownName)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("Unrecognized character encoding %#v: expected one of %s", name, strings.Join(names, ", "))
+	}
+	return charset.name, nil
+}
+
+// TranscodeToUTF8 converts buff from the character set named by name to
+// UTF-8.
+func TranscodeToUTF8(buff []byte, name string) ([]byte, error) {
+	charset, ok := characterEncodings[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("INTERNAL ERROR: Unrecognized character encoding: %#v", name)
+	}
+	result, err := charset.encoding.NewDecoder().Bytes(buff)
+	if err != nil {
+		return nil, fmt.Errorf("Input could not be decoded as %s: %s", charset.name, err.Error())
+	}
+	return result, nil
+}
@@ -0,0 +1,298 @@
+package codechallenge
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/jws"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvelopeVersion is the version of a signed message in JSON format.
+type EnvelopeVersion int
+
+// Envelope versions. Version 1 signs the digest of the message alone, while
+// version 2 signs the digest of its envelope: the message along with the
+// metadata of the signature.
+const (
+	EnvelopeV1 EnvelopeVersion = 1
+	EnvelopeV2 EnvelopeVersion = 2
+)
+
+// envelopeVersionNames maps each EnvelopeVersion to its name.
+var envelopeVersionNames = map[EnvelopeVersion]string{
+	EnvelopeV1: "v1",
+	EnvelopeV2: "v2",
+}
+
+// ParseEnvelopeVersion returns the EnvelopeVersion named by name. Names are
+// not case sensitive.
+func ParseEnvelopeVersion(name string) (EnvelopeVersion, error) {
+	names := make([]string, 0, len(envelopeVersionNames))
+	for version, versionName := range envelopeVersionNames {
+		if strings.EqualFold(versionName, name) {
+			return version, nil
+		}
+		names = append(names, versionName)
+	}
+	sort.Strings(names)
+	return EnvelopeV1, fmt.Errorf("Unrecognized envelope version %#v: expected one of %s", name, strings.Join(names, ", "))
+}
+
+// String returns the name of the envelope version.
+func (ev EnvelopeVersion) String() string {
+	name, ok := envelopeVersionNames[ev]
+	if !ok {
+		return fmt.Sprintf("Unknown EnvelopeVersion %#v (INTERNAL ERROR)", int(ev))
+	}
+	return name
+}
+
+// envelopeDomain begins the signing input of every envelope, so that it
+// can't be mistaken for any other message signed by the same key.
+const envelopeDomain = "codechallenge-envelope-v2"
+
+// envelopeNonceSize is the size in bytes of the random nonce of an envelope.
+const envelopeNonceSize = 16
+
+// envelopeAlgorithms maps each public key algorithm to the name of the
+// signature scheme it signs envelopes with.
+var envelopeAlgorithms = map[x509.PublicKeyAlgorithm]string{
+	x509.ECDSA:   "ECDSA",
+	x509.RSA:     "RSASSA-PSS",
+	x509.Ed25519: "Ed25519",
+}
+
+// EnvelopeSigningInput returns the canonical encoding of the envelope of doc,
+// which is what a version 2 signature is of: the domain, followed by the name
+// and value of each field of doc other than the signature, the public key
+// and any time-stamp token of the signature, leaving out those that are
+// empty. The fields are in a fixed order, and each name and value is
+// preceded by its length in bytes, in ASCII decimal, with a space separating
+// each from the next, as in the pre-authentication encoding of DSSE. The
+// encoding of an envelope is therefore unambiguous, however its values are
+// chosen.
+func EnvelopeSigningInput(doc *SignedMessage) []byte {
+	sequence := ""
+	if doc.Sequence != 0 {
+		sequence = strconv.FormatUint(doc.Sequence, 10)
+	}
+	result := &strings.Builder{}
+	result.WriteString(envelopeDomain)
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{name: "message", value: doc.Message},
+		{name: "format", value: doc.Format},
+		{name: "encoding", value: doc.Encoding},
+		{name: "normalization", value: doc.Normalization},
+		{name: "hash", value: doc.Hash},
+		{name: "algorithm", value: doc.Algorithm},
+		{name: "key_id", value: doc.KeyID},
+		{name: "signed_at", value: doc.SignedAt},
+		{name: "not_before", value: doc.NotBefore},
+		{name: "expires", value: doc.Expires},
+		{name: "nonce", value: doc.Nonce},
+		{name: "sequence", value: sequence},
+	} {
+		if field.value == "" {
+			continue
+		}
+		for _, s := range []string{field.name, field.value} {
+			result.WriteString(" ")
+			result.WriteString(strconv.Itoa(len(s)))
+			result.WriteString(" ")
+			result.WriteString(s)
+		}
+	}
+	return []byte(result.String())
+}
+
+// ValiditySettings describes the period a version 2 envelope being signed is
+// valid for, with times relative to the signing time, which is unlimited if
+// neither is given, and the clock skew allowed when checking the period of
+// one being verified.
+type ValiditySettings struct {
+	NotBefore *ClaimTime
+	Expires   *ClaimTime
+	Leeway    time.Duration
+}
+
+// SealEnvelope fills in the metadata of the version 2 envelope of doc, whose
+// message is already set, for a signature by publicKey with the settings in
+// config, at the current time and with a new random nonce, along with the
+// next sequence number of the key if config numbers them. It returns the
+// digest of the envelope, which is what is to be signed.
+func SealEnvelope(d *deps.Dependencies, config *RunConfig, publicKey crypto.PublicKey, doc *SignedMessage) (crypt.DigestHash, error) {
+	keyID, err := jws.KeyID(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, envelopeNonceSize)
+	if _, err := io.ReadFull(d.Crypto.Rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	now := d.Time.Now()
+	if config.Validity.NotBefore != nil {
+		doc.NotBefore = config.Validity.NotBefore.Time(now).UTC().Format(time.RFC3339)
+	}
+	if config.Validity.Expires != nil {
+		expires := config.Validity.Expires.Time(now)
+		validFrom := now
+		if config.Validity.NotBefore != nil {
+			validFrom = config.Validity.NotBefore.Time(now)
+		}
+		if !expires.After(validFrom) {
+			return nil, fmt.Errorf("Signature would expire at %s, but is only valid from %s", expires.UTC().Format(time.RFC3339), validFrom.UTC().Format(time.RFC3339))
+		}
+		doc.Expires = expires.UTC().Format(time.RFC3339)
+	}
+	if config.State.Sequence {
+		doc.Sequence, err = NextSequenceNumber(d, config.State.Dir, keyID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hash := config.PubKeySettings.GetHash()
+	doc.Version = int(EnvelopeV2)
+	doc.Format = config.Input.Format.String()
+	doc.Hash = crypt.HashName(hash)
+	doc.Algorithm = envelopeAlgorithms[config.PubKeySettings.Algorithm]
+	doc.KeyID = keyID
+	doc.SignedAt = now.UTC().Format(time.RFC3339)
+	doc.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	return crypt.NewDigestHash(hash, string(EnvelopeSigningInput(doc))), nil
+}
+
+// OpenEnvelope checks that the version 2 envelope of doc is complete, and
+// that its algorithm and key ID are those of publicKey, which has the
+// algorithm given. It returns the digest of the envelope, which is what was
+// signed. Malformed envelopes are reported as errors, while envelopes of
+// another key are reported in the returned verdict, which is nil otherwise.
+func OpenEnvelope(doc *SignedMessage, publicKey crypto.PublicKey, algorithm x509.PublicKeyAlgorithm, hash crypto.Hash) (crypt.DigestHash, *Verdict, error) {
+	if doc.Digest {
+		return nil, nil, errors.New("Signed message of version 2 may not be a pre-computed digest")
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{name: "format", value: doc.Format},
+		{name: "hash", value: doc.Hash},
+		{name: "algorithm", value: doc.Algorithm},
+		{name: "key_id", value: doc.KeyID},
+		{name: "signed_at", value: doc.SignedAt},
+		{name: "nonce", value: doc.Nonce},
+	} {
+		if field.value == "" {
+			return nil, nil, fmt.Errorf("Signed message of version 2 has no %s", field.name)
+		}
+	}
+	if _, err := ParseContentFormat(doc.Format); err != nil {
+		return nil, nil, err
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{name: "signed_at", value: doc.SignedAt},
+		{name: "not_before", value: doc.NotBefore},
+		{name: "expires", value: doc.Expires},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, field.value); err != nil {
+			return nil, nil, fmt.Errorf("Time %#v of %s of the signed message is not an RFC 3339 time", field.value, field.name)
+		}
+	}
+	if doc.Algorithm != envelopeAlgorithms[algorithm] {
+		return nil, NewVerdict(BadSignature, fmt.Sprintf("Signed message is of algorithm %s, but its public key is of algorithm %s", doc.Algorithm, envelopeAlgorithms[algorithm])), nil
+	}
+	keyID, err := jws.KeyID(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.KeyID != keyID {
+		return nil, NewVerdict(BadSignature, fmt.Sprintf("Signed message is of key ID %s, but its public key has key ID %s", doc.KeyID, keyID)), nil
+	}
+	return crypt.NewDigestHash(hash, string(EnvelopeSigningInput(doc))), nil, nil
+}
+
+// CheckValidityPeriod checks that now is within the validity period of the
+// version 2 envelope of doc, whose times OpenEnvelope has already checked,
+// allowing for the clock skew of leeway either side of it. It returns the
+// verdict on a signature that isn't valid at now, or nil if it is.
+func CheckValidityPeriod(now time.Time, leeway time.Duration, doc *SignedMessage) *Verdict {
+	if doc.NotBefore != "" {
+		notBefore, _ := time.Parse(time.RFC3339, doc.NotBefore)
+		if now.Add(leeway).Before(notBefore) {
+			return NewVerdict(NotYetValid, fmt.Sprintf("Signature is not valid before %s", doc.NotBefore))
+		}
+	}
+	if doc.Expires != "" {
+		expires, _ := time.Parse(time.RFC3339, doc.Expires)
+		if !now.Add(-leeway).Before(expires) {
+			return NewVerdict(Expired, fmt.Sprintf("Signature expired at %s", doc.Expires))
+		}
+	}
+	return nil
+}
+
+// parseEnvelopeOptions validates the envelope version option in cl into
+// config.
+func parseEnvelopeOptions(config *RunConfig, cl *commandLine) error {
+	if *cl.envelopeName != "" {
+		if (config.Output.Format != JSONOutput) || config.VerifyMode || (config.Command != "") {
+			return errors.New("Option -envelope is only valid when signing JSON output, as the version of JSON input is recorded in it")
+		}
+		version, err := ParseEnvelopeVersion(*cl.envelopeName)
+		if err != nil {
+			return err
+		}
+		if (version == EnvelopeV2) && config.DigestMode {
+			return errors.New("Option -envelope=v2 is not valid with -digest, as a pre-computed digest can't cover the envelope")
+		}
+		config.Output.Envelope = version
+	}
+	return nil
+}
+
+// parseValidityOptions validates the not-before and expiry time options in cl
+// into config.
+func parseValidityOptions(config *RunConfig, cl *commandLine) error {
+	if (*cl.envelopeNotBefore != "") || (*cl.envelopeExpires != "") {
+		if (config.Output.Format != JSONOutput) || config.VerifyMode || (config.Command != "") {
+			return errors.New("Options -not-before and -expires are only valid when signing JSON output")
+		}
+		if config.Output.Envelope != EnvelopeV2 {
+			return errors.New("Options -not-before and -expires require -envelope=v2, as only its signature covers them")
+		}
+		for _, validityTime := range []struct {
+			name  string
+			value string
+			dest  **ClaimTime
+		}{
+			{name: "not-before", value: *cl.envelopeNotBefore, dest: &config.Validity.NotBefore},
+			{name: "expires", value: *cl.envelopeExpires, dest: &config.Validity.Expires},
+		} {
+			if validityTime.value != "" {
+				parsed, err := ParseClaimTime(validityTime.value)
+				if err != nil {
+					return fmt.Errorf("Option -%s: %s", validityTime.name, err.Error())
+				}
+				*validityTime.dest = parsed
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package codechallenge_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/testtools"
+	"testing"
+)
+
+// TestEnvelopeV2 verifies that a version 2 envelope records the metadata of
+// its signature, and that the signature covers every field of it.
+func TestEnvelopeV2(t *testing.T) {
+	files := testtools.FakeFileSystem{}
+	for _, keyArgs := range [][]string{{"-ecdsa"}, {"-rsa"}, {"-ed25519"}, {"-ecdsa", "-hash", "sha384", "-ascii"}} {
+		t.Run(fmt.Sprintf("Subtest: %v", keyArgs), func(tt *testing.T) {
+			bundle := runMain(tt, &files, "Hello, World!", append([]string{"-envelope", "v2"}, keyArgs...)...)
+			if exitStatus := bundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, bundle.ErrBuf.String())
+			}
+			verifyBundle := runMain(tt, &files, bundle.OutBuf.String(), "-verify", keyArgs[0])
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Errorf("Verifying failed with exit status %d:\n%s", exitStatus, verifyBundle.OutBuf.String())
+			}
+			if verdict := verifyBundle.OutBuf.String(); verdict != "{\n\"valid\": true,\n\"reason\": \"valid\",\n\"signed_at\": \"2019-09-01T12:00:00Z\"\n}" {
+				tt.Errorf("Verdict should record the signing time. Got %s instead.", verdict)
+			}
+		})
+	}
+
+	bundle := runMain(t, &files, "Hello, World!", "-envelope", "v2")
+	doc := codechallenge.SignedMessage{}
+	if err := json.Unmarshal(bundle.OutBuf.Bytes(), &doc); err != nil {
+		t.Fatalf("Unexpected error parsing signed message %#v: %s", bundle.OutBuf.String(), err.Error())
+	}
+	if (doc.Version != 2) || (doc.Format != "utf8") || (doc.Hash != "sha256") || (doc.Algorithm != "ECDSA") || (doc.SignedAt != "2019-09-01T12:00:00Z") || (len(doc.KeyID) != 43) || (len(doc.Nonce) != 24) {
+		t.Errorf("Signed message should record the metadata of its signature. Got %#v instead.", doc)
+	}
+	for desc, tamper := range map[string]func(doc *codechallenge.SignedMessage){
+		"Message":      func(doc *codechallenge.SignedMessage) { doc.Message = "Goodbye, World!" },
+		"Format":       func(doc *codechallenge.SignedMessage) { doc.Format = "binary" },
+		"Signing time": func(doc *codechallenge.SignedMessage) { doc.SignedAt = "2019-09-02T12:00:00Z" },
+		"Nonce":        func(doc *codechallenge.SignedMessage) { doc.Nonce = "AAAAAAAAAAAAAAAAAAAAAA==" },
+		"Encoding":     func(doc *codechallenge.SignedMessage) { doc.Encoding = "ISO-8859-1" },
+		"Key ID":       func(doc *codechallenge.SignedMessage) { doc.KeyID = "tlyP6ZhQFrZCCsdsqVIb1Gp1kFiNYEYCAgShDjDpUzI" },
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			tampered := doc
+			tamper(&tampered)
+			buff, _ := json.Marshal(&tampered)
+			verifyBundle := runMain(tt, &files, string(buff), "-verify")
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != 9 {
+				tt.Errorf("Verifying should fail with exit status 9. Got %d instead:\n%s", exitStatus, verifyBundle.OutBuf.String())
+			}
+		})
+	}
+
+	incomplete := doc
+	incomplete.Nonce = ""
+	buff, _ := json.Marshal(&incomplete)
+	checkFailure(t, runMain(t, &files, string(buff), "-verify"), 3, "Signed message of version 2 has no nonce")
+
+	v1Bundle := runMain(t, &files, "Hello, World!")
+	v1 := map[string]interface{}{}
+	if err := json.Unmarshal(v1Bundle.OutBuf.Bytes(), &v1); err != nil {
+		t.Fatalf("Unexpected error parsing signed message %#v: %s", v1Bundle.OutBuf.String(), err.Error())
+	}
+	if len(v1) != 3 {
+		t.Errorf("Signed message should be of version 1 by default. Got %v instead.", v1)
+	}
+}
+
+// TestEnvelopeValidity verifies that signatures of version 2 envelopes only
+// verify within their validity period, allowing for the leeway given, and
+// that the signature covers the period.
+func TestEnvelopeValidity(t *testing.T) {
+	files := testtools.FakeFileSystem{}
+	sign := func(args ...string) string {
+		bundle := runMain(t, &files, "Hello, World!", append([]string{"-envelope", "v2"}, args...)...)
+		if exitStatus := bundle.GetExitStatus(); exitStatus != 0 {
+			t.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, bundle.ErrBuf.String())
+		}
+		return bundle.OutBuf.String()
+	}
+	verify := func(desc string, stdin string, status int, expected string, args ...string) {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			bundle := runMain(tt, &files, stdin, append([]string{"-verify"}, args...)...)
+			if exitStatus := bundle.GetExitStatus(); exitStatus != status {
+				tt.Errorf("Verifying should have an exit status of %d. Got %d instead:\n%s", status, exitStatus, bundle.ErrBuf.String())
+			}
+			if verdict := bundle.OutBuf.String(); verdict != expected {
+				tt.Errorf("Verdict should be %#v. Got %#v instead.", expected, verdict)
+			}
+		})
+	}
+	valid := "{\n\"valid\": true,\n\"reason\": \"valid\",\n\"signed_at\": \"2019-09-01T12:00:00Z\"\n}"
+
+	current := sign("-not-before", "-1h", "-expires", "1h")
+	doc := codechallenge.SignedMessage{}
+	if err := json.Unmarshal([]byte(current), &doc); err != nil {
+		t.Fatalf("Unexpected error parsing signed message %#v: %s", current, err.Error())
+	}
+	if (doc.NotBefore != "2019-09-01T11:00:00Z") || (doc.Expires != "2019-09-01T13:00:00Z") {
+		t.Errorf("Signed message should record its validity period. Got %#v instead.", doc)
+	}
+	verify("Within the validity period", current, 0, valid)
+
+	expired := sign("-expires", "2019-09-01T11:59:00Z", "-not-before", "-1h")
+	verify("Expired", expired, 14, "{\n\"valid\": false,\n\"reason\": \"expired signature\",\n\"detail\": \"Signature expired at 2019-09-01T11:59:00Z\"\n}")
+	verify("Expired within the leeway", expired, 0, valid, "-leeway", "2m")
+
+	future := sign("-not-before", "1567340460")
+	verify("Not yet valid", future, 15, "{\n\"valid\": false,\n\"reason\": \"signature not yet valid\",\n\"detail\": \"Signature is not valid before 2019-09-01T12:21:00Z\"\n}")
+	verify("Not yet valid within the leeway", future, 0, valid, "-leeway", "30m")
+
+	tampered := doc
+	tampered.Expires = "2019-09-02T13:00:00Z"
+	buff, _ := json.Marshal(&tampered)
+	verify("Tampered expiry", string(buff), 9, "{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}")
+	tampered = doc
+	tampered.NotBefore = "tomorrow"
+	buff, _ = json.Marshal(&tampered)
+	checkFailure(t, runMain(t, &files, string(buff), "-verify"), 3, "Time \"tomorrow\" of not_before of the signed message is not an RFC 3339 time")
+
+	checkFailure(t, runMain(t, &files, "Hello, World!", "-envelope", "v2", "-not-before", "1h", "-expires", "30m"), 5, "Signature would expire at 2019-09-01T12:30:00Z, but is only valid from 2019-09-01T13:00:00Z")
+}
@@ -0,0 +1,196 @@
+package codechallenge
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+)
+
+// SignatureFileSuffix is appended to the path of a file to name its detached
+// signature.
+const SignatureFileSuffix = ".sig"
+
+// FileVerdict is the outcome of verifying a file against its detached
+// signature, to be rendered to JSON.
+type FileVerdict struct {
+	File string `json:"file"`
+	*Verdict
+}
+
+// SignFilesMain is the entry-point for the sign-file command. It writes a
+// detached signature of each file in config.Paths alongside it.
+func SignFilesMain(d *deps.Dependencies, config *RunConfig) {
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	for _, path := range config.Paths {
+		digest, err := HashFile(d, path, config.PubKeySettings.GetHash())
+		if err != nil {
+			HandleError(d, err, 2)
+		}
+		binSig, err := cryptStuff.Sign(digest)
+		if err != nil {
+			HandleError(d, err, 5)
+		}
+		// Verify with a round trip:
+		valid, err := cryptStuff.VerifySignedDigest(digest, binSig.Base64(), cryptStuff.PubKey.String())
+		if err != nil {
+			HandleError(d, err, 6)
+		}
+		if !valid {
+			HandleError(d, errors.New("round trip verification of signature failed"), 7)
+		}
+		sigFile, err := NewDetachedSignature(cryptStuff, digest, binSig, config.RawSignatures)
+		if err != nil {
+			HandleError(d, err, 8)
+		}
+		err = d.Io.Ioutil.WriteFile(path+SignatureFileSuffix, sigFile, 0644)
+		if err != nil {
+			HandleError(d, err, 8)
+		}
+	}
+}
+
+// VerifyFilesMain is the entry-point for the verify-file command. It checks
+// each file in config.Paths against its detached signature, and writes the
+// verdicts in JSON format to d.Os.Stdout, exiting with the status of the
+// first verdict that isn't valid.
+func VerifyFilesMain(d *deps.Dependencies, config *RunConfig) {
+	verdicts := make([]FileVerdict, 0, len(config.Paths))
+	exitStatus := 0
+	for _, path := range config.Paths {
+		verdict, err := VerifyFile(d, config, path)
+		if err != nil {
+			HandleError(d, err, 3)
+		}
+		verdicts = append(verdicts, FileVerdict{File: path, Verdict: verdict})
+		if !verdict.Valid && (exitStatus == 0) {
+			exitStatus = verdict.ExitStatus()
+		}
+	}
+	err := WriteJSON(d, verdicts)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if exitStatus != 0 {
+		d.Os.Exit(exitStatus)
+	}
+}
+
+// HashFile digests the contents of the file at path with hash, streaming it
+// rather than reading it into memory all at once.
+func HashFile(d *deps.Dependencies, path string, hash crypto.Hash) (crypt.DigestHash, error) {
+	file, err := d.Os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := crypt.NewDigestHashFromReader(hash, file)
+	closeErr := file.Close()
+	if err != nil {
+		return nil, err
+	}
+	if closeErr != nil {
+		return nil, closeErr
+	}
+	return digest, nil
+}
+
+// NewDetachedSignature returns the contents of a detached signature file,
+// given the digest of the file and its signature. This is either the raw
+// binary signature, or a signed message in JSON format with the digest as its
+// message.
+func NewDetachedSignature(ct *crypt.CryptoTooling, digest crypt.DigestHash, binSig crypt.BinarySignature, raw bool) ([]byte, error) {
+	if raw {
+		return []byte(binSig), nil
+	}
+	return RenderJSON(&SignedMessage{
+		Message:   digest.Hex(),
+		Signature: binSig.Base64(),
+		Pubkey:    ct.PubKey.String(),
+		Hash:      crypt.HashName(ct.Settings.GetHash()),
+		Digest:    true,
+	})
+}
+
+// VerifyFile checks the file at path against its detached signature, which
+// must be by the public key file named in config. The public key a signature
+// in JSON format contains must be that key, as anyone able to replace the
+// file could also replace its signature.
+func VerifyFile(d *deps.Dependencies, config *RunConfig, path string) (*Verdict, error) {
+	sigFile, err := d.Io.Ioutil.ReadFile(path + SignatureFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if config.RawSignatures {
+		return verifyRawDetachedSignature(d, config, path, crypt.BinarySignature(sigFile))
+	}
+	doc, err := InjestSignedMessage(bytes.NewReader(sigFile))
+	if err != nil {
+		return nil, err
+	}
+	if !doc.Digest {
+		return NewVerdict(ContentMismatch, "signature is not over a file digest"), nil
+	}
+	hash, err := SignedMessageHash(doc)
+	if err != nil {
+		return nil, err
+	}
+	signedDigest, err := crypt.NewDigestHashFromString(doc.Message, hash)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := HashFile(d, path, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(signedDigest, digest) {
+		return NewVerdict(ContentMismatch, fmt.Sprintf("file has %s digest %s, but the signature is over %s", crypt.HashName(hash), digest.Hex(), signedDigest.Hex())), nil
+	}
+	verdict, err := VerifySignedMessageDocument(d, &RunConfig{DigestMode: true, PubKeySettings: config.PubKeySettings}, doc)
+	if err != nil {
+		return nil, err
+	}
+	return CheckSignedMessageKey(d, config, doc, verdict)
+}
+
+// verifyRawDetachedSignature checks the file at path against a raw binary
+// signature, using the public key file and hash function named in config.
+func verifyRawDetachedSignature(d *deps.Dependencies, config *RunConfig, path string, binSig crypt.BinarySignature) (*Verdict, error) {
+	settings := config.PubKeySettings
+	pemPubKey, _, err := crypt.LoadAndDecodeKey(d, settings.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	settings.Algorithm, err = pemPubKey.PublicKeyAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := HashFile(d, path, settings.GetHash())
+	if err != nil {
+		return nil, err
+	}
+	tooling, err := crypt.GetCryptoTooling(d, &settings)
+	if err != nil {
+		return nil, err
+	}
+	return newVerdictFromVerification(tooling.VerifySignedDigest(digest, binSig.Base64(), pemPubKey.String())), nil
+}
+
+// parseFileOptions validates the raw signatures option in cl into config.
+func parseFileOptions(config *RunConfig, cl *commandLine) error {
+	if *cl.rawSignatures {
+		if (config.Command != SignFileCommand) && (config.Command != VerifyFileCommand) {
+			return fmt.Errorf("Option -raw may only be used with the %s and %s commands", SignFileCommand, VerifyFileCommand)
+		}
+		config.RawSignatures = true
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package codechallenge_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"regexp"
+	"testing"
+)
+
+const (
+	// HelloWorldSHA256Hex is the SHA-256 digest of "Hello, World!\n", in hex.
+	HelloWorldSHA256Hex = "c98c24b677eff44860afea6f493bbaec5bb1c4cbb209c6fc2bbb47f66ff2ad31"
+	// GoodbyeWorldSHA256Hex is the SHA-256 digest of "Goodbye, World!\n", in
+	// hex.
+	GoodbyeWorldSHA256Hex = "3b93626bebaa9c2854dfb25c25b52498618df84b6dd03ab48d03d43ae5a44038"
+)
+
+// TestSignAndVerifyFiles verifies that the sign-file command writes detached
+// signatures that the verify-file command accepts, and that tampering with
+// the files is detected.
+func TestSignAndVerifyFiles(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signArgs   []string
+		raw        bool
+		tamper     func(testtools.FakeFileSystem)
+		verifyArgs []string
+		status     int
+		stdOutput  testtools.StringMatcher
+		stdErr     testtools.StringMatcher
+	}{
+		"Untouched files with JSON signatures": {
+			signArgs:   []string{"codechallenge", "sign-file", "hello.txt", "/data/empty.bin"},
+			tamper:     func(testtools.FakeFileSystem) {},
+			verifyArgs: []string{"codechallenge", "verify-file", "hello.txt", "/data/empty.bin"},
+			status:     0,
+			stdOutput: testtools.NewStringStringMatcher("[\n" +
+				"{\n\"file\": \"hello.txt\",\n\"valid\": true,\n\"reason\": \"valid\"\n},\n" +
+				"{\n\"file\": \"/data/empty.bin\",\n\"valid\": true,\n\"reason\": \"valid\"\n}\n" +
+				"]"),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Untouched file with raw RSA signature over SHA-384": {
+			signArgs:   []string{"codechallenge", "sign-file", "-rsa", "-raw", "-hash", "sha384", "hello.txt"},
+			raw:        true,
+			tamper:     func(testtools.FakeFileSystem) {},
+			verifyArgs: []string{"codechallenge", "verify-file", "-rsa", "-raw", "-hash", "sha384", "hello.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("[\n{\n\"file\": \"hello.txt\",\n\"valid\": true,\n\"reason\": \"valid\"\n}\n]"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Modified file with JSON signature": {
+			signArgs: []string{"codechallenge", "sign-file", "hello.txt", "/data/empty.bin"},
+			tamper: func(files testtools.FakeFileSystem) {
+				files["/home/anybody/hello.txt"] = testtools.StringPtr("Goodbye, World!\n")
+			},
+			verifyArgs: []string{"codechallenge", "verify-file", "hello.txt", "/data/empty.bin"},
+			status:     10,
+			stdOutput: testtools.NewStringStringMatcher("[\n" +
+				"{\n\"file\": \"hello.txt\",\n\"valid\": false,\n\"reason\": \"signed content mismatch\",\n" +
+				"\"detail\": \"file has sha256 digest " + GoodbyeWorldSHA256Hex + ", but the signature is over " + HelloWorldSHA256Hex + "\"\n},\n" +
+				"{\n\"file\": \"/data/empty.bin\",\n\"valid\": true,\n\"reason\": \"valid\"\n}\n" +
+				"]"),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Modified file with raw signature": {
+			signArgs: []string{"codechallenge", "sign-file", "-raw", "hello.txt"},
+			raw:      true,
+			tamper: func(files testtools.FakeFileSystem) {
+				files["/home/anybody/hello.txt"] = testtools.StringPtr("Goodbye, World!\n")
+			},
+			verifyArgs: []string{"codechallenge", "verify-file", "-raw", "hello.txt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("[\n{\n\"file\": \"hello.txt\",\n\"valid\": false,\n\"reason\": \"bad signature\"\n}\n]"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"JSON signature by another key": {
+			signArgs:   []string{"codechallenge", "sign-file", "hello.txt"},
+			tamper:     func(testtools.FakeFileSystem) {},
+			verifyArgs: []string{"codechallenge", "verify-file", "-public", "other.pub", "hello.txt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("[\n{\n\"file\": \"hello.txt\",\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"Signed message is not signed by the public key in other.pub\"\n}\n]"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Missing signature": {
+			signArgs:   []string{"codechallenge", "sign-file", "hello.txt"},
+			tamper:     func(testtools.FakeFileSystem) {},
+			verifyArgs: []string{"codechallenge", "verify-file", "hello.txt", "../../data/empty.bin"},
+			status:     3,
+			stdOutput:  testtools.NewStringStringMatcher(""),
+			stdErr:     testtools.NewStringStringMatcher("open ../../data/empty.bin.sig: no such file or directory\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Raw signature verified as JSON": {
+			signArgs:   []string{"codechallenge", "sign-file", "-raw", "hello.txt"},
+			raw:        true,
+			tamper:     func(testtools.FakeFileSystem) {},
+			verifyArgs: []string{"codechallenge", "verify-file", "hello.txt"},
+			status:     3,
+			stdOutput:  testtools.NewStringStringMatcher(""),
+			stdErr:     testtools.NewRegexpStringMatcher(fmt.Sprintf("^Input is not a valid signed message: .*%s$", regexp.QuoteMeta("\nUsage of codechallenge:"+UsageMessageBody))),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/hello.txt": testtools.StringPtr("Hello, World!\n"),
+				"/data/empty.bin":         testtools.StringPtr(""),
+			}
+			// An unrelated key-pair, to verify with:
+			testtools.AddOtherKeyPair(files, "/home/anybody")
+			signBundle := mocks.NewDefaultMockDeps("", tc.signArgs, "/home/anybody", &files)
+			err := signBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(signBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling signBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+			}
+			if sigFile, ok := files["/home/anybody/hello.txt.sig"]; !ok || (sigFile == nil) {
+				tt.Fatalf("sign-file should have written /home/anybody/hello.txt.sig. Files:\n%s", files.String())
+			} else if !tc.raw {
+				matcher := testtools.GetResponseMatcherForMessageAndMetadata(deps.Defaults, HelloWorldSHA256Hex, map[string]string{"hash": "sha256"})
+				if err := matcher.MatchString(*sigFile); err != nil {
+					tt.Errorf("Detached signature:\n%#v didn't match:\n%s.", *sigFile, err.Error())
+				}
+			}
+			tc.tamper(files)
+			verifyBundle := mocks.NewDefaultMockDeps("", tc.verifyArgs, "/home/anybody", &files)
+			err = verifyBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(verifyBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Errorf("Unexpected error calling verifyBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if err := tc.stdErr.MatchString(verifyBundle.ErrBuf.String()); err != nil {
+				tt.Errorf("Standard Error:\n%#v didn't match:\n%s.", verifyBundle.ErrBuf.String(), err.Error())
+			}
+		})
+	}
+}
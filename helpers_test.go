@@ -0,0 +1,41 @@
+package codechallenge_test
+
+import (
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"testing"
+)
+
+// runMain runs the program with args and stdin against files, returning the
+// bundle of mocks it ran with.
+func runMain(t *testing.T, files *testtools.FakeFileSystem, stdin string, args ...string) *mocks.MockDepsBundle {
+	return runMainWithHTTP(t, files, stdin, deps.NetHTTPDependencies{}, args...)
+}
+
+// runMainWithHTTP runs the program like runMain, with the HTTP dependencies
+// given.
+func runMainWithHTTP(t *testing.T, files *testtools.FakeFileSystem, stdin string, httpDeps deps.NetHTTPDependencies, args ...string) *mocks.MockDepsBundle {
+	bundle := mocks.NewDefaultMockDeps(stdin, append([]string{"codechallenge"}, args...), "/home/anybody", files)
+	bundle.Deps.Net.HTTP = httpDeps
+	err := bundle.InvokeCallInMockedEnv(func() error {
+		codechallenge.RealMain(bundle.Deps)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error calling bundle.InvokeCallInMockedEnv(): %s", err.Error())
+	}
+	return bundle
+}
+
+// checkFailure checks that bundle exited with status and the error message
+// msg.
+func checkFailure(t *testing.T, bundle *mocks.MockDepsBundle, status int, msg string) {
+	if exitStatus := bundle.GetExitStatus(); exitStatus != status {
+		t.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", status, exitStatus)
+	}
+	if err := testtools.NewStringStringMatcher(msg + "\nUsage of codechallenge:" + UsageMessageBody).MatchString(bundle.ErrBuf.String()); err != nil {
+		t.Errorf("Standard Error:\n%#v didn't match:\n%s.", bundle.ErrBuf.String(), err.Error())
+	}
+}
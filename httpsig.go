@@ -0,0 +1,198 @@
+package codechallenge
+
+import (
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/httpsig"
+	"github.com/smartedge/codechallenge/jws"
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// HTTPSigSettings describes the label of an HTTP message signature, and the
+// components it covers, or must cover when it is verified.
+type HTTPSigSettings struct {
+	Label      string
+	Components []string
+}
+
+// HTTPSigVerdict is the outcome of verifying an HTTP message signature, to
+// be rendered to JSON. The key ID and components the signature covers are
+// only included if it is valid.
+type HTTPSigVerdict struct {
+	*Verdict
+	KeyID      string   `json:"keyid,omitempty"`
+	Components []string `json:"components,omitempty"`
+}
+
+// readHTTPRequest reads a raw HTTP request from d.Os.Stdin, which isn't
+// subject to the length limit of a message.
+func readHTTPRequest(d *deps.Dependencies) (*httpsig.Request, error) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	return httpsig.ParseRequest(buff)
+}
+
+// NewHTTPSignature signs request with the keys in cryptStuff, according to
+// config. The algorithm is the one in config if given, or otherwise the one
+// determined by the key, and the keyid is the key's JWK thumbprint.
+func NewHTTPSignature(d *deps.Dependencies, config *RunConfig, cryptStuff *crypt.CryptoTooling, request *httpsig.Request) (*httpsig.Signature, error) {
+	alg := config.Output.JWSAlgorithm
+	if alg == "" {
+		var err error
+		alg, err = httpsig.AlgorithmForKey(cryptStuff.Signer.Public(), crypt.PSSPadding)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keyID, err := jws.KeyID(cryptStuff.Signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	sig := httpsig.NewSignature(config.HTTPSig.Label, config.HTTPSig.Components, d.Time.Now(), keyID, alg)
+	if err := sig.Sign(cryptStuff.Signer, d.Crypto.Rand.Reader, request); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// SignHTTPMain is the entry-point for the sign-http command. It reads a raw
+// HTTP request from d.Os.Stdin, and writes the Signature-Input and Signature
+// headers of its signature to d.Os.Stdout. If the signature covers the
+// Content-Digest header, and the request doesn't have one, it is written
+// first.
+func SignHTTPMain(d *deps.Dependencies, config *RunConfig) {
+	request, err := readHTTPRequest(d)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	headers := ""
+	for _, component := range config.HTTPSig.Components {
+		if (component == httpsig.ContentDigestHeader) && (len(request.Header[textproto.CanonicalMIMEHeaderKey(httpsig.ContentDigestHeader)]) == 0) {
+			digest := httpsig.ContentDigest(request.Body)
+			request.Header.Set(httpsig.ContentDigestHeader, digest)
+			headers += "Content-Digest: " + digest + "\r\n"
+		}
+	}
+	sig, err := NewHTTPSignature(d, config, cryptStuff, request)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	valid, err := sig.Verify(cryptStuff.Signer.Public(), request)
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	signatureInput, signature := sig.Headers()
+	headers += httpsig.SignatureInputHeader + ": " + signatureInput + "\r\n" + httpsig.SignatureHeader + ": " + signature + "\r\n"
+	err = WriteOutput(d, []byte(headers))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// VerifyHTTPMain is the entry-point for the verify-http command. It reads a
+// raw HTTP request from d.Os.Stdin, and writes the verdict on its signature
+// with the label in config in JSON format to d.Os.Stdout, exiting with the
+// verdict's exit status if it isn't valid.
+func VerifyHTTPMain(d *deps.Dependencies, config *RunConfig) {
+	request, err := readHTTPRequest(d)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	sig, err := httpsig.Parse(request, config.HTTPSig.Label)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyHTTP(d, config, request, sig)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyHTTP checks that sig of request was made by the public key file in
+// config, covers the components in config, and hasn't expired. If it covers
+// the Content-Digest header, that must match the body.
+func VerifyHTTP(d *deps.Dependencies, config *RunConfig, request *httpsig.Request, sig *httpsig.Signature) (*HTTPSigVerdict, error) {
+	publicKey, err := loadPublicKey(d, config.PubKeySettings.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, component := range config.HTTPSig.Components {
+		if !sig.Covers(component) {
+			return &HTTPSigVerdict{Verdict: NewVerdict(BadSignature, fmt.Sprintf("HTTP message signature does not cover %s", component))}, nil
+		}
+	}
+	if expires, ok := sig.Expires(); ok && !d.Time.Now().Before(expires) {
+		return &HTTPSigVerdict{Verdict: NewVerdict(InvalidClaims, fmt.Sprintf("HTTP message signature expired at %s", expires.Format(time.RFC3339)))}, nil
+	}
+	result := &HTTPSigVerdict{Verdict: newVerdictFromVerification(sig.Verify(publicKey, request))}
+	if !result.Valid {
+		return result, nil
+	}
+	if sig.Covers(httpsig.ContentDigestHeader) {
+		if err := request.CheckContentDigest(); err != nil {
+			return &HTTPSigVerdict{Verdict: NewVerdict(ContentMismatch, err.Error())}, nil
+		}
+	}
+	result.KeyID = sig.KeyID()
+	result.Components = sig.Components
+	return result, nil
+}
+
+// usesHTTPSig returns true if config is of a command that signs or verifies
+// HTTP message signatures.
+func (config *RunConfig) usesHTTPSig() bool {
+	return (config.Command == SignHTTPCommand) || (config.Command == VerifyHTTPCommand)
+}
+
+// parseHTTPSigOptions validates the covered components and signature label
+// options in cl into config.
+func parseHTTPSigOptions(config *RunConfig, cl *commandLine) error {
+	if (*cl.components != "") || (*cl.label != "") {
+		if !config.usesHTTPSig() {
+			return fmt.Errorf("Options -components and -label are only valid with the %s and %s commands", SignHTTPCommand, VerifyHTTPCommand)
+		}
+		if *cl.components != "" {
+			config.HTTPSig.Components = nil
+			for _, component := range strings.Split(*cl.components, ",") {
+				component = strings.TrimSpace(component)
+				if err := httpsig.CheckComponentName(component); err != nil {
+					return err
+				}
+				config.HTTPSig.Components = append(config.HTTPSig.Components, component)
+			}
+		}
+		if *cl.label != "" {
+			if err := httpsig.CheckLabel(*cl.label); err != nil {
+				return err
+			}
+			config.HTTPSig.Label = *cl.label
+		}
+	}
+	return nil
+}
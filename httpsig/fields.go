@@ -0,0 +1,268 @@
+package httpsig
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Token is a token of a structured field, as defined by RFC 8941, such as
+// the alg of a signature. It serializes without quotes.
+type Token string
+
+// Param is a parameter of a structured field item or inner list. Its value
+// is a string, Token, int64, []byte or bool.
+type Param struct {
+	Name  string
+	Value interface{}
+}
+
+// item is a structured field item with its parameters.
+type item struct {
+	value  interface{}
+	params []Param
+}
+
+// member is a member of a structured field dictionary: an item, or an inner
+// list of items, with its parameters.
+type member struct {
+	key       string
+	value     interface{}
+	innerList []*item
+	isList    bool
+	params    []Param
+}
+
+// fieldParser parses the structured fields HTTP message signatures use.
+type fieldParser struct {
+	input string
+	pos   int
+}
+
+// parseDictionary parses a structured field dictionary, keeping its members
+// in order.
+func parseDictionary(input string) ([]*member, error) {
+	p := &fieldParser{input: input}
+	p.skipSpace(" \t")
+	result := []*member{}
+	for p.pos < len(p.input) {
+		m := &member{}
+		var err error
+		if m.key, err = p.parseKey(); err != nil {
+			return nil, err
+		}
+		if p.peek() == '=' {
+			p.pos++
+			if p.peek() == '(' {
+				m.isList = true
+				if m.innerList, err = p.parseInnerList(); err != nil {
+					return nil, err
+				}
+			} else if m.value, err = p.parseBareItem(); err != nil {
+				return nil, err
+			}
+		} else {
+			m.value = true
+		}
+		if m.params, err = p.parseParams(); err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+		p.skipSpace(" \t")
+		if p.pos >= len(p.input) {
+			break
+		}
+		if p.peek() != ',' {
+			return nil, fmt.Errorf("expected a comma at position %d", p.pos)
+		}
+		p.pos++
+		p.skipSpace(" \t")
+		if p.pos >= len(p.input) {
+			return nil, errors.New("unexpected trailing comma")
+		}
+	}
+	return result, nil
+}
+
+// peek returns the next character, or 0 at the end of the input.
+func (p *fieldParser) peek() byte {
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+// skipSpace skips any of the characters in space.
+func (p *fieldParser) skipSpace(space string) {
+	for (p.pos < len(p.input)) && strings.IndexByte(space, p.input[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// parseKey parses the key of a dictionary member or parameter.
+func (p *fieldParser) parseKey() (string, error) {
+	start := p.pos
+	if c := p.peek(); !((c >= 'a') && (c <= 'z')) && (c != '*') {
+		return "", fmt.Errorf("expected a key at position %d", p.pos)
+	}
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if !((c >= 'a') && (c <= 'z')) && !((c >= '0') && (c <= '9')) && (strings.IndexByte("_-.*", c) < 0) {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos], nil
+}
+
+// parseInnerList parses an inner list of items.
+func (p *fieldParser) parseInnerList() ([]*item, error) {
+	p.pos++
+	result := []*item{}
+	for {
+		p.skipSpace(" ")
+		if p.peek() == ')' {
+			p.pos++
+			return result, nil
+		}
+		value, err := p.parseBareItem()
+		if err != nil {
+			return nil, err
+		}
+		params, err := p.parseParams()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &item{value: value, params: params})
+		if c := p.peek(); (c != ' ') && (c != ')') {
+			return nil, fmt.Errorf("expected a space or ) at position %d", p.pos)
+		}
+	}
+}
+
+// parseParams parses the parameters of an item or inner list.
+func (p *fieldParser) parseParams() ([]Param, error) {
+	result := []Param{}
+	for p.peek() == ';' {
+		p.pos++
+		p.skipSpace(" ")
+		name, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var value interface{} = true
+		if p.peek() == '=' {
+			p.pos++
+			if value, err = p.parseBareItem(); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, Param{Name: name, Value: value})
+	}
+	return result, nil
+}
+
+// parseBareItem parses a string, token, integer, byte sequence or boolean.
+func (p *fieldParser) parseBareItem() (interface{}, error) {
+	c := p.peek()
+	switch {
+	case c == '"':
+		var result strings.Builder
+		for p.pos++; p.pos < len(p.input); p.pos++ {
+			c := p.input[p.pos]
+			if c == '\\' {
+				p.pos++
+				if (p.pos >= len(p.input)) || ((p.input[p.pos] != '"') && (p.input[p.pos] != '\\')) {
+					return nil, fmt.Errorf("invalid escape in string at position %d", p.pos)
+				}
+				result.WriteByte(p.input[p.pos])
+			} else if c == '"' {
+				p.pos++
+				return result.String(), nil
+			} else if (c < 0x20) || (c > 0x7e) {
+				return nil, fmt.Errorf("invalid character in string at position %d", p.pos)
+			} else {
+				result.WriteByte(c)
+			}
+		}
+		return nil, errors.New("unterminated string")
+	case c == ':':
+		end := strings.IndexByte(p.input[p.pos+1:], ':')
+		if end < 0 {
+			return nil, errors.New("unterminated byte sequence")
+		}
+		encoded := p.input[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid byte sequence: %s", err.Error())
+		}
+		return decoded, nil
+	case (c == '-') || ((c >= '0') && (c <= '9')):
+		start := p.pos
+		for p.pos++; (p.pos < len(p.input)) && (p.input[p.pos] >= '0') && (p.input[p.pos] <= '9'); p.pos++ {
+		}
+		value, err := strconv.ParseInt(p.input[start:p.pos], 10, 64)
+		if err != nil || (p.peek() == '.') {
+			return nil, fmt.Errorf("invalid integer at position %d", start)
+		}
+		return value, nil
+	case ((c >= 'a') && (c <= 'z')) || ((c >= 'A') && (c <= 'Z')) || (c == '*'):
+		start := p.pos
+		for p.pos < len(p.input) {
+			c := p.input[p.pos]
+			if (c <= ' ') || (c >= 0x7f) || (strings.IndexByte("\"(),;<=>?@[\\]{}", c) >= 0) {
+				break
+			}
+			p.pos++
+		}
+		return Token(p.input[start:p.pos]), nil
+	case c == '?':
+		p.pos++
+		switch p.peek() {
+		case '0':
+			p.pos++
+			return false, nil
+		case '1':
+			p.pos++
+			return true, nil
+		}
+		return nil, fmt.Errorf("invalid boolean at position %d", p.pos)
+	}
+	return nil, fmt.Errorf("unexpected character at position %d", p.pos)
+}
+
+// serializeBareItem serializes a string, Token, int64, []byte or bool.
+func serializeBareItem(value interface{}) string {
+	switch typed := value.(type) {
+	case string:
+		return strconv.Quote(typed)
+	case Token:
+		return string(typed)
+	case int64:
+		return strconv.FormatInt(typed, 10)
+	case []byte:
+		return ":" + base64.StdEncoding.EncodeToString(typed) + ":"
+	case bool:
+		if typed {
+			return "?1"
+		}
+		return "?0"
+	}
+	return ""
+}
+
+// serializeParams serializes parameters, omitting the value of boolean true
+// ones, as RFC 8941 requires.
+func serializeParams(params []Param) string {
+	var result strings.Builder
+	for _, param := range params {
+		result.WriteString(";" + param.Name)
+		if value, ok := param.Value.(bool); !ok || !value {
+			result.WriteString("=" + serializeBareItem(param.Value))
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,324 @@
+// Package httpsig implements HTTP Message Signatures, as defined by RFC 9421,
+// of HTTP requests, for the algorithms the codechallenge tool supports.
+package httpsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HTTP message signature algorithm names, as registered by RFC 9421
+const (
+	RSAPSSSHA512    = "rsa-pss-sha512"
+	RSAv15SHA256    = "rsa-v1_5-sha256"
+	ECDSAP256SHA256 = "ecdsa-p256-sha256"
+	ECDSAP384SHA384 = "ecdsa-p384-sha384"
+	Ed25519         = "ed25519"
+)
+
+// Header names of HTTP message signatures
+const (
+	SignatureInputHeader = "Signature-Input"
+	SignatureHeader      = "Signature"
+)
+
+// CheckLabel returns an error unless label can identify a signature: a
+// structured field key, such as sig1.
+func CheckLabel(label string) error {
+	p := &fieldParser{input: label}
+	if key, err := p.parseKey(); (err != nil) || (key != label) {
+		return fmt.Errorf("HTTP message signature label %#v must be lower-case letters, digits and _-.*, such as sig1", label)
+	}
+	return nil
+}
+
+// algorithm describes the keys an HTTP message signature algorithm signs
+// with, and how.
+type algorithm struct {
+	keyType string
+	scheme  crypt.SignatureScheme
+}
+
+// algorithms are the supported HTTP message signature algorithms, indexed by
+// name.
+var algorithms = map[string]algorithm{
+	RSAPSSSHA512:    {keyType: "RSA", scheme: crypt.SignatureScheme{Hash: crypto.SHA512, RSAPadding: crypt.PSSPadding}},
+	RSAv15SHA256:    {keyType: "RSA", scheme: crypt.SignatureScheme{Hash: crypto.SHA256, RSAPadding: crypt.PKCS1v15Padding}},
+	ECDSAP256SHA256: {keyType: "ECDSA P-256", scheme: crypt.SignatureScheme{Hash: crypto.SHA256, ECDSAEncoding: crypt.RawEncoding}},
+	ECDSAP384SHA384: {keyType: "ECDSA P-384", scheme: crypt.SignatureScheme{Hash: crypto.SHA384, ECDSAEncoding: crypt.RawEncoding}},
+	Ed25519:         {keyType: "Ed25519"},
+}
+
+// keyType describes the type of publicKey, in the terms of algorithms.
+func keyType(publicKey crypto.PublicKey) (string, error) {
+	switch typedPublicKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA " + typedPublicKey.Curve.Params().Name, nil
+	case *rsa.PublicKey:
+		return "RSA", nil
+	case ed25519.PublicKey:
+		return "Ed25519", nil
+	}
+	return "", fmt.Errorf("Public key did not conform to recognized algorithm: %T", publicKey)
+}
+
+// AlgorithmForKey returns the HTTP message signature algorithm that signs
+// with publicKey. RSA keys support both rsa-pss-sha512 and rsa-v1_5-sha256,
+// so rsaPadding chooses between them.
+func AlgorithmForKey(publicKey crypto.PublicKey, rsaPadding crypt.RSAPadding) (string, error) {
+	switch typedPublicKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch typedPublicKey.Curve {
+		case elliptic.P256():
+			return ECDSAP256SHA256, nil
+		case elliptic.P384():
+			return ECDSAP384SHA384, nil
+		}
+		return "", fmt.Errorf("HTTP message signatures don't support ECDSA keys on %s", typedPublicKey.Curve.Params().Name)
+	case *rsa.PublicKey:
+		if rsaPadding == crypt.PKCS1v15Padding {
+			return RSAv15SHA256, nil
+		}
+		return RSAPSSSHA512, nil
+	case ed25519.PublicKey:
+		return Ed25519, nil
+	}
+	return "", fmt.Errorf("Public key did not conform to recognized algorithm: %T", publicKey)
+}
+
+// SchemeForAlgorithm returns how the HTTP message signature algorithm alg
+// signs, or an error if alg isn't supported, or can't be used with
+// publicKey.
+func SchemeForAlgorithm(alg string, publicKey crypto.PublicKey) (crypt.SignatureScheme, error) {
+	algDetails, ok := algorithms[alg]
+	if !ok {
+		names := make([]string, 0, len(algorithms))
+		for name := range algorithms {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return crypt.SignatureScheme{}, fmt.Errorf("Unsupported HTTP message signature algorithm %#v: expected one of %s", alg, strings.Join(names, ", "))
+	}
+	kt, err := keyType(publicKey)
+	if err != nil {
+		return crypt.SignatureScheme{}, err
+	}
+	if kt != algDetails.keyType {
+		return crypt.SignatureScheme{}, fmt.Errorf("HTTP message signature algorithm %s can't be used with an %s key", alg, kt)
+	}
+	return algDetails.scheme, nil
+}
+
+// Signature is an HTTP message signature of a request, with the label that
+// identifies it among the signatures of the request. Params are kept in
+// order, as they are part of what is signed.
+type Signature struct {
+	Label      string
+	Components []string
+	Params     []Param
+	Value      crypt.BinarySignature
+}
+
+// NewSignature returns an unsigned Signature covering components, created
+// at created, with the key ID and algorithm given.
+func NewSignature(label string, components []string, created time.Time, keyID string, alg string) *Signature {
+	return &Signature{
+		Label:      label,
+		Components: components,
+		Params: []Param{
+			{Name: "created", Value: created.Unix()},
+			{Name: "keyid", Value: keyID},
+			{Name: "alg", Value: alg},
+		},
+	}
+}
+
+// param returns the value of the parameter called name, or nil if there
+// isn't one.
+func (s *Signature) param(name string) interface{} {
+	for _, param := range s.Params {
+		if param.Name == name {
+			return param.Value
+		}
+	}
+	return nil
+}
+
+// KeyID returns the keyid parameter, or "" if there isn't one.
+func (s *Signature) KeyID() string {
+	keyID, _ := s.param("keyid").(string)
+	return keyID
+}
+
+// Algorithm returns the alg parameter, or "" if there isn't one.
+func (s *Signature) Algorithm() string {
+	alg, _ := s.param("alg").(string)
+	return alg
+}
+
+// Expires returns the time of the expires parameter, and whether there is
+// one.
+func (s *Signature) Expires() (time.Time, bool) {
+	expires, ok := s.param("expires").(int64)
+	return time.Unix(expires, 0).UTC(), ok
+}
+
+// Covers returns whether the signature covers the component called name.
+func (s *Signature) Covers(name string) bool {
+	for _, component := range s.Components {
+		if component == name {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureParams returns the value of the Signature-Input member of the
+// signature, which is also the value of its @signature-params component.
+func (s *Signature) signatureParams() string {
+	quoted := make([]string, len(s.Components))
+	for i, component := range s.Components {
+		quoted[i] = serializeBareItem(component)
+	}
+	return "(" + strings.Join(quoted, " ") + ")" + serializeParams(s.Params)
+}
+
+// Base returns the signature base of the signature of request: the message
+// that is actually signed.
+func (s *Signature) Base(request *Request) ([]byte, error) {
+	var result strings.Builder
+	seen := map[string]bool{}
+	for _, component := range s.Components {
+		if seen[component] {
+			return nil, fmt.Errorf("HTTP message signature covers %s more than once", component)
+		}
+		seen[component] = true
+		value, err := request.Component(component)
+		if err != nil {
+			return nil, err
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("HTTP message signature component %s contains a line break", component)
+		}
+		result.WriteString(serializeBareItem(component) + ": " + value + "\n")
+	}
+	result.WriteString("\"@signature-params\": " + s.signatureParams())
+	return []byte(result.String()), nil
+}
+
+// scheme returns how the signature is made by publicKey: according to its
+// alg parameter if it has one, or otherwise the key.
+func (s *Signature) scheme(publicKey crypto.PublicKey) (crypt.SignatureScheme, error) {
+	alg := s.Algorithm()
+	if alg == "" {
+		var err error
+		alg, err = AlgorithmForKey(publicKey, crypt.PSSPadding)
+		if err != nil {
+			return crypt.SignatureScheme{}, err
+		}
+	}
+	return SchemeForAlgorithm(alg, publicKey)
+}
+
+// Sign signs the components of request the signature covers with signer.
+func (s *Signature) Sign(signer crypto.Signer, randReader io.Reader, request *Request) error {
+	scheme, err := s.scheme(signer.Public())
+	if err != nil {
+		return err
+	}
+	base, err := s.Base(request)
+	if err != nil {
+		return err
+	}
+	s.Value, err = crypt.SignWithScheme(signer, randReader, base, scheme)
+	return err
+}
+
+// Verify checks that the signature of request was made by publicKey.
+func (s *Signature) Verify(publicKey crypto.PublicKey, request *Request) (bool, error) {
+	scheme, err := s.scheme(publicKey)
+	if err != nil {
+		return false, err
+	}
+	base, err := s.Base(request)
+	if err != nil {
+		return false, err
+	}
+	return crypt.VerifyWithScheme(publicKey, base, s.Value, scheme)
+}
+
+// Headers returns the values of the Signature-Input and Signature headers of
+// the signature.
+func (s *Signature) Headers() (signatureInput string, signature string) {
+	return s.Label + "=" + s.signatureParams(), s.Label + "=" + serializeBareItem([]byte(s.Value))
+}
+
+// Parse returns the signature labelled label from the Signature-Input and
+// Signature headers of request.
+func Parse(request *Request, label string) (*Signature, error) {
+	inputs, err := parseHeader(request, SignatureInputHeader)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseHeader(request, SignatureHeader)
+	if err != nil {
+		return nil, err
+	}
+	input, ok := inputs[label]
+	if !ok {
+		return nil, fmt.Errorf("HTTP request has no signature labelled %s", label)
+	}
+	value, ok := values[label]
+	if !ok {
+		return nil, fmt.Errorf("HTTP request has no Signature for its Signature-Input labelled %s", label)
+	}
+	if !input.isList {
+		return nil, fmt.Errorf("Signature-Input %s is not an inner list", label)
+	}
+	result := &Signature{Label: label, Params: input.params}
+	for _, component := range input.innerList {
+		name, ok := component.value.(string)
+		if !ok {
+			return nil, fmt.Errorf("Signature-Input %s has a component that isn't a string", label)
+		}
+		if len(component.params) > 0 {
+			return nil, fmt.Errorf("Unsupported parameters of HTTP message signature component %s", name)
+		}
+		result.Components = append(result.Components, name)
+	}
+	signature, ok := value.value.([]byte)
+	if value.isList || !ok {
+		return nil, fmt.Errorf("Signature %s is not a byte sequence", label)
+	}
+	result.Value = crypt.BinarySignature(signature)
+	return result, nil
+}
+
+// parseHeader parses the dictionary that is the value of the header called
+// name, indexed by key.
+func parseHeader(request *Request, name string) (map[string]*member, error) {
+	values := request.Header[textproto.CanonicalMIMEHeaderKey(name)]
+	if len(values) == 0 {
+		return nil, fmt.Errorf("HTTP request has no %s header", name)
+	}
+	members, err := parseDictionary(strings.Join(values, ", "))
+	if err != nil {
+		return nil, errors.New(name + " header is not valid: " + err.Error())
+	}
+	result := map[string]*member{}
+	for _, m := range members {
+		result[m.key] = m
+	}
+	return result, nil
+}
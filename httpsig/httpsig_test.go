@@ -0,0 +1,265 @@
+package httpsig_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/httpsig"
+	"github.com/smartedge/codechallenge/testtools"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFCRequest is the request of the examples of RFC 9421, Appendix B.2.
+const RFCRequest = "POST /foo?param=Value&Pet=dog HTTP/1.1\r\n" +
+	"Host: example.com\r\n" +
+	"Date: Tue, 20 Apr 2021 02:07:55 GMT\r\n" +
+	"Content-Type: application/json\r\n" +
+	"Content-Digest: sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:\r\n" +
+	"Content-Length: 18\r\n"
+
+// RFCBody is the body of RFCRequest.
+const RFCBody = "\r\n{\"hello\": \"world\"}"
+
+// RFCEd25519Signature is the signature of RFCRequest in RFC 9421, Appendix
+// B.2.6, by RFCEd25519PublicKey's private key.
+const RFCEd25519Signature = "Signature-Input: sig-b26=(\"date\" \"@method\" \"@path\" \"@authority\" \"content-type\" \"content-length\");created=1618884473;keyid=\"test-key-ed25519\"\r\n" +
+	"Signature: sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:\r\n"
+
+// RFCEd25519PublicKey is the test-key-ed25519 key of RFC 9421, Appendix B.1.4.
+const RFCEd25519PublicKey = `-----BEGIN PUBLIC KEY-----
+MCowBQYDK2VwAyEAJrQLj5P/89iXES9+vFgrIy29clF9CC/oPPsw3c5D0bs=
+-----END PUBLIC KEY-----
+`
+
+// OpenSSLSignature is a signature of RFCRequest made with OpenSSLPublicKey's
+// private key by `openssl dgst -sha256 -sign`, converted to the raw encoding.
+const OpenSSLSignature = "Signature-Input: sig1=(\"@method\" \"@authority\" \"@path\" \"content-digest\");created=1618884473;keyid=\"test-key-ecc-p256\";alg=\"ecdsa-p256-sha256\"\r\n" +
+	"Signature: sig1=:a6Dzxk86hlJ9m2Y3NeoagSIdUuR8Pb60j7AnJxGOnGB6g6RtDlt0Dkkf5VGMHAyR2jX7vtT1FUXmSqI/khSYAA==:\r\n"
+
+// OpenSSLPublicKey is the P-256 public key that made OpenSSLSignature.
+const OpenSSLPublicKey = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE9iepuXHAY/6ISvbjij9yaqDtQ5w+
+DgpjMHJx2p9LwYrxFN6/KLQmf1Q//iN0PLtzLB26V0E04rrq6W3Sf2+z0w==
+-----END PUBLIC KEY-----
+`
+
+// parsePublicKey parses a PEM public key.
+func parsePublicKey(t *testing.T, src string) crypto.PublicKey {
+	block, _ := pem.Decode([]byte(src))
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return publicKey
+}
+
+// TestIndependentSignatures verifies signatures made independently of this
+// package, and that changes to the covered components are detected.
+func TestIndependentSignatures(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signature string
+		label     string
+		publicKey string
+		base      string
+	}{
+		"RFC 9421 Ed25519 example": {
+			signature: RFCEd25519Signature,
+			label:     "sig-b26",
+			publicKey: RFCEd25519PublicKey,
+			base: "\"date\": Tue, 20 Apr 2021 02:07:55 GMT\n\"@method\": POST\n\"@path\": /foo\n\"@authority\": example.com\n" +
+				"\"content-type\": application/json\n\"content-length\": 18\n" +
+				"\"@signature-params\": (\"date\" \"@method\" \"@path\" \"@authority\" \"content-type\" \"content-length\");created=1618884473;keyid=\"test-key-ed25519\"",
+		},
+		"OpenSSL ECDSA": {
+			signature: OpenSSLSignature,
+			label:     "sig1",
+			publicKey: OpenSSLPublicKey,
+			base: "\"@method\": POST\n\"@authority\": example.com\n\"@path\": /foo\n" +
+				"\"content-digest\": sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:\n" +
+				"\"@signature-params\": (\"@method\" \"@authority\" \"@path\" \"content-digest\");created=1618884473;keyid=\"test-key-ecc-p256\";alg=\"ecdsa-p256-sha256\"",
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			publicKey := parsePublicKey(tt, tc.publicKey)
+			request, err := httpsig.ParseRequest([]byte(RFCRequest + tc.signature + RFCBody))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			sig, err := httpsig.Parse(request, tc.label)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			base, err := sig.Base(request)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if string(base) != tc.base {
+				tt.Errorf("Signature base should be:\n%s\nGot:\n%s", tc.base, string(base))
+			}
+			if valid, err := sig.Verify(publicKey, request); !valid {
+				tt.Errorf("Signature should be valid: %v", err)
+			}
+			if err := request.CheckContentDigest(); err != nil {
+				tt.Errorf("Content-Digest should match: %s", err.Error())
+			}
+			request.Method = "PUT"
+			if valid, err := sig.Verify(publicKey, request); valid {
+				tt.Errorf("Signature of another method should not be valid: %v", err)
+			}
+		})
+	}
+}
+
+// TestSignAndVerify verifies that signatures written to headers parse back
+// to valid signatures for each algorithm.
+func TestSignAndVerify(t *testing.T) {
+	ecdsaP256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecdsaP384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for desc, tc := range map[string]struct {
+		signer     crypto.Signer
+		rsaPadding crypt.RSAPadding
+		alg        string
+	}{
+		"ECDSA P-256": {signer: ecdsaP256, alg: httpsig.ECDSAP256SHA256},
+		"ECDSA P-384": {signer: ecdsaP384, alg: httpsig.ECDSAP384SHA384},
+		"Ed25519":     {signer: ed25519Key, alg: httpsig.Ed25519},
+		"RSA PSS":     {signer: rsaKey, rsaPadding: crypt.PSSPadding, alg: httpsig.RSAPSSSHA512},
+		"RSA v1.5":    {signer: rsaKey, rsaPadding: crypt.PKCS1v15Padding, alg: httpsig.RSAv15SHA256},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			alg, err := httpsig.AlgorithmForKey(tc.signer.Public(), tc.rsaPadding)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if alg != tc.alg {
+				tt.Errorf("Algorithm should be %s. Got %s instead.", tc.alg, alg)
+			}
+			request, err := httpsig.ParseRequest([]byte(RFCRequest + RFCBody))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			components := []string{"@method", "@authority", "@path", "@query", "content-digest"}
+			sig := httpsig.NewSignature("sig1", components, time.Unix(1567339200, 0), "test-key", alg)
+			if err := sig.Sign(tc.signer, rand.Reader, request); err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			signatureInput, signature := sig.Headers()
+			expectedInput := "sig1=(\"@method\" \"@authority\" \"@path\" \"@query\" \"content-digest\");created=1567339200;keyid=\"test-key\";alg=\"" + alg + "\""
+			if signatureInput != expectedInput {
+				tt.Errorf("Signature-Input should be %#v. Got %#v instead.", expectedInput, signatureInput)
+			}
+			signed, err := httpsig.ParseRequest([]byte(RFCRequest + "Signature-Input: " + signatureInput + "\r\nSignature: " + signature + "\r\n" + RFCBody))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			parsed, err := httpsig.Parse(signed, "sig1")
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if valid, err := parsed.Verify(tc.signer.Public(), signed); !valid {
+				tt.Errorf("Signature should be valid: %v", err)
+			}
+			signed.Query = "?param=Value&Pet=cat"
+			if valid, err := parsed.Verify(tc.signer.Public(), signed); valid {
+				tt.Errorf("Signature of another query should not be valid: %v", err)
+			}
+		})
+	}
+}
+
+// TestAlgorithmErrors verifies that algorithms are checked against keys.
+func TestAlgorithmErrors(t *testing.T) {
+	ecdsaP256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecdsaP521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	_, err := httpsig.AlgorithmForKey(ecdsaP521.Public(), crypt.PSSPadding)
+	expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "HTTP message signatures don't support ECDSA keys on P-521"}
+	if err := expectedErr.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+	_, err = httpsig.SchemeForAlgorithm(httpsig.ECDSAP384SHA384, ecdsaP256.Public())
+	expectedErr = &testtools.ErrorSpec{Type: "*errors.errorString", Message: "HTTP message signature algorithm ecdsa-p384-sha384 can't be used with an ECDSA P-256 key"}
+	if err := expectedErr.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+	_, err = httpsig.SchemeForAlgorithm("hmac-sha256", ecdsaP256.Public())
+	expectedErr = &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported HTTP message signature algorithm \"hmac-sha256\": expected one of ecdsa-p256-sha256, ecdsa-p384-sha384, ed25519, rsa-pss-sha512, rsa-v1_5-sha256"}
+	if err := expectedErr.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+// TestParseErrors verifies that requests without a usable signature are
+// rejected with an explanation.
+func TestParseErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		headers string
+		label   string
+		err     *testtools.ErrorSpec
+	}{
+		"Unsigned": {
+			headers: "",
+			label:   "sig1",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "HTTP request has no Signature-Input header"},
+		},
+		"Other label": {
+			headers: OpenSSLSignature,
+			label:   "sig2",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "HTTP request has no signature labelled sig2"},
+		},
+		"Missing signature": {
+			headers: strings.Replace(OpenSSLSignature, "Signature: sig1=", "Signature: sig2=", 1),
+			label:   "sig1",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "HTTP request has no Signature for its Signature-Input labelled sig1"},
+		},
+		"Component parameters": {
+			headers: strings.Replace(OpenSSLSignature, "\"content-digest\"", "\"content-digest\";sf", 1),
+			label:   "sig1",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported parameters of HTTP message signature component content-digest"},
+		},
+		"Malformed input": {
+			headers: strings.Replace(OpenSSLSignature, ");created", ";created", 1),
+			label:   "sig1",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Signature-Input header is not valid: expected a space or ) at position 122"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			request, err := httpsig.ParseRequest([]byte(RFCRequest + tc.headers + RFCBody))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			_, err = httpsig.Parse(request, tc.label)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
+
+// TestContentDigest verifies that Content-Digest headers are written, and
+// checked against the body.
+func TestContentDigest(t *testing.T) {
+	expected := "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"
+	if digest := httpsig.ContentDigest([]byte("{\"hello\": \"world\"}")); digest != expected {
+		t.Errorf("Content-Digest should be %#v. Got %#v instead.", expected, digest)
+	}
+	request, err := httpsig.ParseRequest([]byte(strings.Replace(RFCRequest+RFCBody, "world", "World", 1)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	err = request.CheckContentDigest()
+	expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Content-Digest does not match the body of the HTTP request"}
+	if err := expectedErr.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+}
@@ -0,0 +1,164 @@
+package httpsig
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ContentDigestHeader is the header of the digest of the body, as defined by
+// RFC 9530, which a signature covers to protect the body.
+const ContentDigestHeader = "content-digest"
+
+// contentDigestAlgorithms are the Content-Digest algorithms that can be
+// checked, indexed by name.
+var contentDigestAlgorithms = map[string]crypto.Hash{
+	"sha-256": crypto.SHA256,
+	"sha-512": crypto.SHA512,
+}
+
+// Request is an HTTP request, as read from the wire, whose components a
+// signature covers.
+type Request struct {
+	Method    string
+	Target    string
+	Path      string
+	Query     string
+	Authority string
+	Header    http.Header
+	Body      []byte
+}
+
+// ParseRequest parses a raw HTTP/1.1 request. Lines may end with CRLF or
+// just LF.
+func ParseRequest(data []byte) (*Request, error) {
+	parsed, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request is not valid: %s", err.Error())
+	}
+	body, err := ioutil.ReadAll(parsed.Body)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request is not valid: %s", err.Error())
+	}
+	result := &Request{
+		Method:    parsed.Method,
+		Target:    parsed.RequestURI,
+		Path:      parsed.URL.EscapedPath(),
+		Query:     "?" + parsed.URL.RawQuery,
+		Authority: strings.ToLower(parsed.Host),
+		Header:    parsed.Header,
+		Body:      body,
+	}
+	if result.Path == "" {
+		result.Path = "/"
+	}
+	// net/http moves the Host header out of Header:
+	if parsed.Host != "" {
+		result.Header.Set("Host", parsed.Host)
+	}
+	return result, nil
+}
+
+// derivedComponents are the supported derived components, which are
+// derived from the request line rather than a header.
+var derivedComponents = []string{"@method", "@authority", "@path", "@query", "@request-target"}
+
+// CheckComponentName returns an error unless name is a supported derived
+// component, or the lower-case name of a header.
+func CheckComponentName(name string) error {
+	if strings.HasPrefix(name, "@") {
+		for _, derived := range derivedComponents {
+			if name == derived {
+				return nil
+			}
+		}
+		return fmt.Errorf("Unsupported HTTP message signature component %#v: expected a header name or one of %s", name, strings.Join(derivedComponents, ", "))
+	}
+	if (name == "") || strings.ContainsAny(name, " \t\":") {
+		return fmt.Errorf("HTTP message signature component %#v is not a header name", name)
+	}
+	if name != strings.ToLower(name) {
+		return fmt.Errorf("HTTP message signature component %#v must be lower-case", name)
+	}
+	return nil
+}
+
+// Component returns the value of the component called name: a derived
+// component such as @method, or a header field given by its lower-case
+// name, whose values are combined as RFC 9421 requires.
+func (r *Request) Component(name string) (string, error) {
+	if err := CheckComponentName(name); err != nil {
+		return "", err
+	}
+	switch name {
+	case "@method":
+		return r.Method, nil
+	case "@authority":
+		return r.Authority, nil
+	case "@path":
+		return r.Path, nil
+	case "@query":
+		return r.Query, nil
+	case "@request-target":
+		return r.Target, nil
+	}
+	values, ok := r.Header[http.CanonicalHeaderKey(name)]
+	if !ok {
+		return "", fmt.Errorf("HTTP request has no %s header", name)
+	}
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.TrimSpace(value)
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+// ContentDigest returns the value of a Content-Digest header of body, using
+// SHA-256.
+func ContentDigest(body []byte) string {
+	digest := crypto.SHA256.New()
+	digest.Write(body)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(digest.Sum(nil)) + ":"
+}
+
+// CheckContentDigest returns an error unless the request's Content-Digest
+// header has a digest of its body using SHA-256 or SHA-512, and every such
+// digest matches.
+func (r *Request) CheckContentDigest() error {
+	value, err := r.Component(ContentDigestHeader)
+	if err != nil {
+		return err
+	}
+	members, err := parseDictionary(value)
+	if err != nil {
+		return fmt.Errorf("Content-Digest header is not valid: %s", err.Error())
+	}
+	checked := false
+	for _, m := range members {
+		hash, ok := contentDigestAlgorithms[m.key]
+		if !ok {
+			continue
+		}
+		expected, ok := m.value.([]byte)
+		if !ok {
+			return fmt.Errorf("Content-Digest %s is not a byte sequence", m.key)
+		}
+		digest := hash.New()
+		digest.Write(r.Body)
+		if subtle.ConstantTimeCompare(digest.Sum(nil), expected) != 1 {
+			return errors.New("Content-Digest does not match the body of the HTTP request")
+		}
+		checked = true
+	}
+	if !checked {
+		return errors.New("Content-Digest has no sha-256 or sha-512 digest")
+	}
+	return nil
+}
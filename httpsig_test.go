@@ -0,0 +1,136 @@
+package codechallenge_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge/testtools"
+	"strings"
+	"testing"
+)
+
+// HTTPRequest is the request of the examples of RFC 9421, Appendix B.2, up to
+// the end of its headers.
+const HTTPRequest = "POST /foo?param=Value&Pet=dog HTTP/1.1\r\n" +
+	"Host: example.com\r\n" +
+	"Date: Tue, 20 Apr 2021 02:07:55 GMT\r\n" +
+	"Content-Type: application/json\r\n" +
+	"Content-Length: 18\r\n"
+
+// HTTPBody is the body of HTTPRequest, after the blank line that ends its
+// headers.
+const HTTPBody = "\r\n{\"hello\": \"world\"}"
+
+// RFCHTTPSignature is the signature of HTTPRequest in RFC 9421, Appendix
+// B.2.6, by the key in RFCHTTPPublicKey.
+const RFCHTTPSignature = "Signature-Input: sig-b26=(\"date\" \"@method\" \"@path\" \"@authority\" \"content-type\" \"content-length\");created=1618884473;keyid=\"test-key-ed25519\"\r\n" +
+	"Signature: sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:\r\n"
+
+// RFCHTTPPublicKey is the test-key-ed25519 key of RFC 9421, Appendix B.1.4.
+const RFCHTTPPublicKey = `-----BEGIN PUBLIC KEY-----
+MCowBQYDK2VwAyEAJrQLj5P/89iXES9+vFgrIy29clF9CC/oPPsw3c5D0bs=
+-----END PUBLIC KEY-----
+`
+
+// TestSignAndVerifyHTTP verifies that the headers written by the sign-http
+// command make a request that verify-http finds valid, and that changes to
+// the covered components are detected.
+func TestSignAndVerifyHTTP(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signArgs   []string
+		headers    testtools.StringMatcher
+		tamper     func(string) string
+		verifyArgs []string
+		status     int
+		stdOutput  testtools.StringMatcher
+	}{
+		"Default components": {
+			signArgs:   []string{"codechallenge", "sign-http"},
+			headers:    testtools.NewRegexpStringMatcher("^Signature-Input: sig1=\\(\"@method\" \"@authority\" \"@path\"\\);created=1567339200;keyid=\"[A-Za-z0-9_-]{43}\";alg=\"ecdsa-p256-sha256\"\r\nSignature: sig1=:[A-Za-z0-9+/]{86}==:\r\n$"),
+			verifyArgs: []string{"codechallenge", "verify-http"},
+			status:     0,
+			stdOutput:  testtools.NewRegexpStringMatcher("^\\{\n\"valid\": true,\n\"reason\": \"valid\",\n\"keyid\": \"[A-Za-z0-9_-]{43}\",\n\"components\": \\[\n\"@method\",\n\"@authority\",\n\"@path\"\n\\]\n\\}$"),
+		},
+		"Content digest": {
+			signArgs:   []string{"codechallenge", "sign-http", "-ed25519", "-label", "request", "-components", "@method, @path, @query, content-digest, content-type"},
+			headers:    testtools.NewRegexpStringMatcher("^Content-Digest: sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:\r\nSignature-Input: request=\\(\"@method\" \"@path\" \"@query\" \"content-digest\" \"content-type\"\\);created=1567339200;keyid=\"[A-Za-z0-9_-]{43}\";alg=\"ed25519\"\r\nSignature: request=:[A-Za-z0-9+/]{86}==:\r\n$"),
+			verifyArgs: []string{"codechallenge", "verify-http", "-ed25519", "-label", "request", "-components", "@method,content-digest"},
+			status:     0,
+			stdOutput:  testtools.NewRegexpStringMatcher("^\\{\n\"valid\": true,\n\"reason\": \"valid\",\n\"keyid\": \"[A-Za-z0-9_-]{43}\",\n\"components\": \\[\n\"@method\",\n\"@path\",\n\"@query\",\n\"content-digest\",\n\"content-type\"\n\\]\n\\}$"),
+		},
+		"RSA PKCS #1 v1.5": {
+			signArgs:   []string{"codechallenge", "sign-http", "-rsa", "-alg", "rsa-v1_5-sha256"},
+			headers:    testtools.NewRegexpStringMatcher("^Signature-Input: sig1=\\(\"@method\" \"@authority\" \"@path\"\\);created=1567339200;keyid=\"[A-Za-z0-9_-]{43}\";alg=\"rsa-v1_5-sha256\"\r\nSignature: sig1=:[A-Za-z0-9+/]{342}==:\r\n$"),
+			verifyArgs: []string{"codechallenge", "verify-http", "-rsa"},
+			status:     0,
+			stdOutput:  testtools.NewRegexpStringMatcher("^\\{\n\"valid\": true,"),
+		},
+		"RFC 9421 example": {
+			headers:    testtools.NewStringStringMatcher(RFCHTTPSignature),
+			verifyArgs: []string{"codechallenge", "verify-http", "-public", "rfc.pub", "-label", "sig-b26"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"keyid\": \"test-key-ed25519\",\n\"components\": [\n\"date\",\n\"@method\",\n\"@path\",\n\"@authority\",\n\"content-type\",\n\"content-length\"\n]\n}"),
+		},
+		"Changed path": {
+			signArgs:   []string{"codechallenge", "sign-http"},
+			headers:    testtools.NewRegexpStringMatcher("^Signature-Input: "),
+			tamper:     func(request string) string { return strings.Replace(request, "/foo", "/bar", 1) },
+			verifyArgs: []string{"codechallenge", "verify-http"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+		},
+		"Changed body": {
+			signArgs:   []string{"codechallenge", "sign-http", "-components", "@method,@authority,@path,content-digest"},
+			headers:    testtools.NewRegexpStringMatcher("^Content-Digest: "),
+			tamper:     func(request string) string { return strings.Replace(request, "world", "World", 1) },
+			verifyArgs: []string{"codechallenge", "verify-http"},
+			status:     10,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"signed content mismatch\",\n\"detail\": \"Content-Digest does not match the body of the HTTP request\"\n}"),
+		},
+		"Required component not covered": {
+			signArgs:   []string{"codechallenge", "sign-http"},
+			headers:    testtools.NewRegexpStringMatcher("^Signature-Input: "),
+			verifyArgs: []string{"codechallenge", "verify-http", "-components", "@method,@authority,@path,content-digest"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"HTTP message signature does not cover content-digest\"\n}"),
+		},
+		"Verified with the wrong key": {
+			signArgs:   []string{"codechallenge", "sign-http"},
+			headers:    testtools.NewRegexpStringMatcher("^Signature-Input: "),
+			verifyArgs: []string{"codechallenge", "verify-http", "-public", "other.pub"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/rfc.pub": testtools.StringPtr(RFCHTTPPublicKey),
+			}
+			// An unrelated key-pair, to verify with:
+			testtools.AddOtherKeyPair(files, "/home/anybody")
+			headers := RFCHTTPSignature
+			if tc.signArgs != nil {
+				signBundle := runMain(tt, &files, HTTPRequest+HTTPBody, tc.signArgs[1:]...)
+				if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+					tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+				}
+				headers = signBundle.OutBuf.String()
+			}
+			if err := tc.headers.MatchString(headers); err != nil {
+				tt.Errorf("Headers:\n%#v didn't match:\n%s.", headers, err.Error())
+			}
+			request := HTTPRequest + headers + HTTPBody
+			if tc.tamper != nil {
+				request = tc.tamper(request)
+			}
+			verifyBundle := runMain(tt, &files, request, tc.verifyArgs[1:]...)
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if errOutput := verifyBundle.ErrBuf.String(); errOutput != "" {
+				tt.Errorf("Standard Error should be empty. Got %#v instead.", errOutput)
+			}
+		})
+	}
+}
@@ -2,18 +2,77 @@ package codechallenge_test
 
 import (
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"github.com/smartedge/codechallenge"
 	"github.com/smartedge/codechallenge/deps"
 	"github.com/smartedge/codechallenge/testtools"
 	"github.com/smartedge/codechallenge/testtools/mocks"
 	"regexp"
+	"strings"
 	"testing"
 )
 
 const (
-	UsageMessageBody = "\n  -help\n" +
+	UsageMessageBody = "\n  Commands:\n" +
+		"      sign-file path...\n" +
+		"        \tWrite a detached signature of each file to path.sig, instead of signing standard input\n" +
+		"      verify-file path...\n" +
+		"        \tVerify each file against its detached signature in path.sig\n" +
+		"      sign-manifest directory\n" +
+		"        \tWrite a signed manifest of every file in the directory to standard output\n" +
+		"      verify-manifest directory\n" +
+		"        \tVerify the directory against a signed manifest read from standard input, reporting added, removed and modified files\n" +
+		"      jwt\n" +
+		"        \tWrite a signed JWT of the claims given by the token options to standard output\n" +
+		"      verify-jwt\n" +
+		"        \tVerify a JWT read from standard input, checking its time claims\n" +
+		"      cwt\n" +
+		"        \tWrite a signed CWT of the claims given by the token options to standard output, in binary COSE format\n" +
+		"      verify-cwt\n" +
+		"        \tVerify a CWT read from standard input, checking its time claims\n" +
+		"      paseto\n" +
+		"        \tWrite a signed PASETO token of the claims given by the token options to standard output: v4.public for Ed25519 keys, or v3.public for ECDSA keys on P-384\n" +
+		"      verify-paseto\n" +
+		"        \tVerify a PASETO token read from standard input, checking its time claims\n" +
+		"      export-pgp-key\n" +
+		"        \tWrite the public key to standard output as an armored OpenPGP key, with the user ID given by -uid\n" +
+		"      export-ssh-key\n" +
+		"        \tWrite the public key to standard output in the format of authorized_keys and allowed_signers files\n" +
+		"      export-minisign-key\n" +
+		"        \tWrite the Ed25519 public key to standard output as a minisign public key file\n" +
+		"      attest path...\n" +
+		"        \tWrite a DSSE envelope of an in-toto Statement about each file, with the predicate given by -predicate-type and -predicate, to standard output\n" +
+		"      sign-http\n" +
+		"        \tWrite the Signature-Input and Signature headers of an HTTP message signature of the raw HTTP request read from standard input to standard output\n" +
+		"      verify-http\n" +
+		"        \tVerify the HTTP message signature of a raw HTTP request read from standard input\n" +
+		"      dkim\n" +
+		"        \tWrite the DKIM-Signature header field of the raw email message read from standard input, signed for -domain with the key of -selector, to standard output\n" +
+		"      verify-dkim\n" +
+		"        \tVerify the DKIM signature of a raw email message read from standard input against the DNS record given by -dns-record\n" +
+		"      export-dkim-record\n" +
+		"        \tWrite the value of the DNS TXT record that publishes the RSA or Ed25519 public key for DKIM to standard output\n" +
+		"      cert self-sign\n" +
+		"        \tWrite a self-signed X.509 certificate of the public key, with the profile given by the certificate options, to standard output in PEM format\n" +
+		"      csr\n" +
+		"        \tWrite a PKCS #10 certificate signing request for the public key, with the profile given by the certificate options, to standard output\n" +
+		"      ca init\n" +
+		"        \tCreate a local CA in -ca-dir with a new key-pair and a self-signed CA certificate, and write the certificate to standard output in PEM format\n" +
+		"      ca issue\n" +
+		"        \tWrite a certificate issued by the local CA for the CSR read from standard input, with its names and the profile given by the certificate options, to standard output in PEM format\n" +
+		"      ca revoke serial\n" +
+		"        \tRevoke the certificate with the serial number, in hex, issued by the local CA\n" +
+		"      ca crl\n" +
+		"        \tWrite a CRL of the certificates the local CA has revoked to standard output in PEM format\n" +
+		"      tsa-server\n" +
+		"        \tServe RFC 3161 time-stamp requests over HTTP on -listen, signing the tokens with the key-pair, whose TSA certificate is given by -cert\n" +
+		"      add-signature\n" +
+		"        \tAdd a co-signature by the key-pair, or by each of the key-pairs, to the signed message in JSON format read from standard input, and write the multi-signature document to standard output\n" +
+		"  -help\n" +
 		"    \tdisplay this help message.\n" +
+		"  -verify\n" +
+		"    \tverify a signed message read from standard input, instead of signing one.\n" +
 		"  Input format options:\n" +
 		"      -ascii\n" +
 		"        \tThis specifies that the message is ASCII content\n" +
@@ -21,17 +80,162 @@ const (
 		"        \tThis specifies that the message is raw binary content\n" +
 		"      -utf8\n" +
 		"        \tThis specifies that the message is UTF-8 content [default]\n" +
+		"      -encoding string\n" +
+		"        \tCharacter encoding of the input (ISO-8859-1, windows-1252 or UTF-16), transcoded to UTF-8 before signing\n" +
+		"      -normalize string\n" +
+		"        \tUnicode normalization form (NFC, NFD or NFKC) applied to text before signing\n" +
+		"      -digest\n" +
+		"        \tThis specifies that the message is a hex or base64 encoded digest, to be signed directly\n" +
 		"  Algorithm options:\n" +
 		"      -ecdsa\n" +
 		"        \tCauses the mesage to be signed with an ECDSA key-pair [default]\n" +
+		"      -ed25519\n" +
+		"        \tCauses the mesage to be signed with an Ed25519 key-pair\n" +
 		"      -rsa\n" +
 		"        \tCauses the mesage to be signed with an RSA key-pair\n" +
 		"      -bits uint\n" +
 		"        \tBit length of the RSA key [default=2048]\n" +
+		"      -curve string\n" +
+		"        \tElliptic curve (P-256, P-384 or P-521) of the ECDSA key [default=P-256]\n" +
+		"      -hash string\n" +
+		"        \tHash algorithm (sha256, sha384 or sha512) used to digest the message [default=sha256]\n" +
+		"  Output format options:\n" +
+		"      -format string\n" +
+		"        \tFormat of the signed message (json, jws, jws-json, cose, cms, cms-pem, pgp, sshsig, minisign or dsse) [default=json]\n" +
+		"      -alg string\n" +
+		"        \tJWS, COSE or HTTP message signature algorithm (ES256, ES384, ES512, RS256, PS256 or EdDSA, or rsa-pss-sha512, rsa-v1_5-sha256, ecdsa-p256-sha256, ecdsa-p384-sha384 or ed25519) [default is determined by the key]\n" +
+		"      -jwk\n" +
+		"        \tEmbed the public key in the JWS header as a JWK\n" +
+		"      -detached\n" +
+		"        \tOmit the payload from the JWS, COSE_Sign1, CMS or OpenPGP message\n" +
+		"      -payload string\n" +
+		"        \tfilepath of the payload of a detached JWS, COSE_Sign1, CMS, OpenPGP, SSH or minisign signature being verified\n" +
+		"      -cert string\n" +
+		"        \tfilepath of a PEM certificate of the signing key, to embed in CMS output, to replace the public key in JSON output, or the TSA certificate of tsa-server\n" +
+		"      -envelope string\n" +
+		"        \tVersion of the signed message in JSON format: v1, or v2 to also sign the input format, hash, algorithm, key ID, signing time and a random nonce [default=v1]\n" +
+		"      -not-before string\n" +
+		"        \tTime the signature of a version 2 envelope is valid from: a duration from now, an RFC 3339 time or seconds since the Unix epoch [default is the signing time]\n" +
+		"      -expires string\n" +
+		"        \tTime the signature of a version 2 envelope expires at, in the same format as -not-before [default is never]\n" +
+		"      -uid string\n" +
+		"        \tUser ID of the key written by export-pgp-key, such as \"Name <email>\"\n" +
+		"  Token options:\n" +
+		"      -claims string\n" +
+		"        \tfilepath of a JSON file of claims to include in the token\n" +
+		"      -iss string\n" +
+		"        \tIssuer claim of the token, or the issuer required when verifying one\n" +
+		"      -sub string\n" +
+		"        \tSubject claim of the token\n" +
+		"      -aud string\n" +
+		"        \tComma separated audience claim of the token, or the audience required when verifying one\n" +
+		"      -exp string\n" +
+		"        \tExpiration time of the token: a duration from now, an RFC 3339 time or seconds since the Unix epoch [default=1h]\n" +
+		"      -nbf string\n" +
+		"        \tTime before which the token is not valid, in the same format as -exp [default=0s]\n" +
+		"      -iat string\n" +
+		"        \tTime the token was issued, in the same format as -exp [default=0s]\n" +
+		"      -jti string\n" +
+		"        \tUnique identifier of the token [default is random]\n" +
+		"      -leeway duration\n" +
+		"        \tClock skew allowed when verifying the time claims of a token, or the validity period of a signed message in JSON format [default=0s]\n" +
+		"  PASETO options:\n" +
+		"      -footer string\n" +
+		"        \tFooter of the PASETO token, or the footer required by verify-paseto\n" +
+		"      -implicit string\n" +
+		"        \tImplicit assertion the PASETO token is signed with, which must be given again to verify it\n" +
+		"  SSH signature options:\n" +
+		"      -namespace string\n" +
+		"        \tNamespace of the SSH signature, such as file or git, which must be given again to verify it\n" +
+		"      -allowed-signers string\n" +
+		"        \tfilepath of an OpenSSH allowed_signers file to verify the SSH signature against, instead of -public\n" +
+		"      -principal string\n" +
+		"        \tPrincipal the allowed_signers file must allow to make the SSH signature\n" +
+		"  Minisign options:\n" +
+		"      -trusted-comment string\n" +
+		"        \tTrusted comment signed along with the minisign signature [default=timestamp:<seconds since the Unix epoch>]\n" +
+		"      -legacy\n" +
+		"        \tSign the message itself in a legacy minisign signature, rather than its BLAKE2b-512 hash\n" +
+		"  DSSE options:\n" +
+		"      -payload-type string\n" +
+		"        \tPayload type of the DSSE envelope, such as a media type [default=application/octet-stream]\n" +
+		"      -add-signature\n" +
+		"        \tAdd a signature to the DSSE envelope read from standard input, instead of signing it as the payload\n" +
+		"      -predicate-type string\n" +
+		"        \tPredicate type URI of the in-toto Statement written by attest, such as https://slsa.dev/provenance/v1\n" +
+		"      -predicate string\n" +
+		"        \tfilepath of the JSON predicate of the in-toto Statement written by attest\n" +
+		"  HTTP message signature options:\n" +
+		"      -components string\n" +
+		"        \tComma separated components the HTTP message signature covers, or must cover when verifying it, such as @method, @path, content-digest or a header name [default=@method,@authority,@path]\n" +
+		"      -label string\n" +
+		"        \tLabel of the HTTP message signature [default=sig1]\n" +
+		"  DKIM options:\n" +
+		"      -domain string\n" +
+		"        \tSigning domain (d=) of the DKIM signature, or the domain it must be from when verifying it\n" +
+		"      -selector string\n" +
+		"        \tSelector (s=) of the DKIM key, published under selector._domainkey.domain, or the selector the signature must have when verifying it\n" +
+		"      -canonicalization string\n" +
+		"        \tDKIM canonicalization (simple or relaxed, or header/body such as relaxed/simple) [default=relaxed/relaxed]\n" +
+		"      -headers string\n" +
+		"        \tComma separated header fields the DKIM signature covers, which must include From [default=those of From,To,Cc,Subject,Date,Message-ID,Reply-To,MIME-Version,Content-Type the message has]\n" +
+		"      -dns-record string\n" +
+		"        \tfilepath of the DNS TXT record of the DKIM key to verify the signature against, as written by export-dkim-record or as it appears in a zone file\n" +
+		"  Certificate options:\n" +
+		"      -subject string\n" +
+		"        \tSubject of the certificate, such as \"CN=signer,O=Example Corp,C=US\" [default=CN=codechallenge]\n" +
+		"      -san string\n" +
+		"        \tComma separated subject alternative names of the certificate, each a DNS name, IP address, email address or URI, optionally prefixed by DNS:, IP:, email: or URI:\n" +
+		"      -days uint\n" +
+		"        \tNumber of days the certificate, or the CRL of ca crl, is valid for [default=365, 3650 with ca init, or 30 with ca crl]\n" +
+		"      -key-usage string\n" +
+		"        \tComma separated key usages of the certificate, or that the certificate of the signer must allow with -trust-store, such as digitalSignature or keyCertSign [default=digitalSignature, and keyCertSign,cRLSign with -ca]\n" +
+		"      -ext-key-usage string\n" +
+		"        \tComma separated extended key usages of the certificate, or that the certificate of the signer must allow with -trust-store, such as codeSigning or serverAuth\n" +
+		"      -ca\n" +
+		"        \tMark the certificate as a CA certificate in its basic constraints\n" +
+		"      -path-len int\n" +
+		"        \tMaximum number of intermediate CAs below the CA certificate [default is unlimited]\n" +
+		"      -permitted-dns string\n" +
+		"        \tComma separated DNS domains the names of certificates issued by the CA certificate must be within\n" +
+		"      -excluded-dns string\n" +
+		"        \tComma separated DNS domains the names of certificates issued by the CA certificate must not be within\n" +
+		"      -der\n" +
+		"        \tWrite the CSR in DER, rather than PEM\n" +
+		"      -issued string\n" +
+		"        \tfilepath of a PEM or DER certificate issued for the CSR, to check against the key-pair instead of writing a CSR\n" +
+		"      -ca-dir string\n" +
+		"        \tfilepath of the directory of the local CA [default=~/.smartEdge/ca]\n" +
+		"  Trust options:\n" +
+		"      -trust-store string\n" +
+		"        \tfilepath of a directory of trusted root certificates and CRLs in PEM format, to validate the certificate of the signer against in -verify mode\n" +
+		"      -crl string\n" +
+		"        \tComma separated filepaths of further PEM or DER CRLs to check the certificates of the chain against\n" +
+		"      -check-time string\n" +
+		"        \tTime the certificates of the chain must be valid and not revoked at: now, signing for the signing time of CMS input, or timestamp for the time of the time-stamp token of the signature [default=now]\n" +
+		"  Time-stamp options:\n" +
+		"      -tsa string\n" +
+		"        \tURL of an RFC 3161 TSA to time-stamp the signature of JSON or CMS output by, such as http://localhost:3161/\n" +
+		"      -listen string\n" +
+		"        \tAddress the tsa-server command listens on [default=localhost:3161]\n" +
+		"  Replay protection options:\n" +
+		"      -sequence\n" +
+		"        \tNumber the version 2 envelope by the signing counter of its key, kept in -state-dir\n" +
+		"      -replay-check\n" +
+		"        \tReject version 2 envelopes whose signatures were already verified, as recorded in -state-dir\n" +
+		"      -state-dir string\n" +
+		"        \tfilepath of the directory of the signing counters and replay state [default=~/.smartEdge/state]\n" +
+		"  Multi-signature options:\n" +
+		"      -policy string\n" +
+		"        \tNumber of the keys of a multi-signature document that must have valid signatures for it to verify: all, any, or a number of them [default=all]\n" +
+		"      -signers string\n" +
+		"        \tComma separated filepaths of the public keys a multi-signature document is verified against, instead of -public\n" +
 		"  -private string\n" +
-		"    \tfilepath of the private key file. Defaults to ~/.smartEdge/id_rsa.priv for RSA and ~/.smartEdge/id_ecdsa.priv for ECDSA.\n" +
+		"    \tfilepath of the private key file, or comma separated filepaths of several to sign a multi-signature document with. Defaults to ~/.smartEdge/id_rsa.priv for RSA and ~/.smartEdge/id_ecdsa.priv for ECDSA.\n" +
 		"  -public string\n" +
-		"    \tfilepath of the private key file. Defaults to ~/.smartEdge/id_rsa.pub for RSA and ~/.smartEdge/id_ecdsa.pub for ECDSA.\n"
+		"    \tfilepath of the private key file, or comma separated filepaths of the public keys of several. Defaults to ~/.smartEdge/id_rsa.pub for RSA and ~/.smartEdge/id_ecdsa.pub for ECDSA.\n" +
+		"  -raw\n" +
+		"    \tdetached signatures are raw binary, rather than a signed message in JSON format.\n"
 	// I had to slip in a space to have 250 characters end on a word boundary
 	DeclarationOfIndependanceFirst250Chars = "When in the Course of human " +
 		"events it becomes necessary for one people to dissolve the " +
@@ -44,6 +248,11 @@ const (
 		"MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE7WzVjtn9Gk+WHr5xbv8XMvooqU25\n" +
 		"BhgNjZ/vHZLBdVtCOjk4KxjS1UBfQm0c3TRxWBl3hj2AmnJbCrnGofMHBQ==\n" +
 		"-----END ECDSA PUBLIC KEY-----\n"
+	// FamilyEmoji is a single user-perceived character made up of seven
+	// code points: four emoji joined by three zero width joiners.
+	FamilyEmoji = "\U0001F468\u200D\U0001F469\u200D\U0001F467\u200D\U0001F466"
+	// AbcSHA256Hex is the SHA-256 digest of "abc", in hex.
+	AbcSHA256Hex = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
 )
 
 // TestCallingMainWithMocks verifies that calling RealMain with mocked
@@ -95,6 +304,22 @@ func TestCallingMainWithMocks(t *testing.T) {
 			stdOutput: testtools.NewStringStringMatcher(""),
 			stdErr:    testtools.NewRegexpStringMatcher(fmt.Sprintf("^Options (-utf8 and -ascii|-ascii and -utf8) may not be used together%s$", regexp.QuoteMeta("\nUsage of codechallenge:"+UsageMessageBody))),
 		},
+		"Help with another option": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-help", "-rsa"},
+			stdInput:  "Abcdefg",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -help ignores all other options\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Help with a command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-file", "-help"},
+			stdInput:  "Abcdefg",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -help ignores all other options\nUsage of codechallenge:" + UsageMessageBody),
+		},
 		"Exactly 250 ascii characters": {
 			homeDir:  "/home/anybody",
 			argList:  []string{"codechallenge", "-ascii"},
@@ -106,13 +331,1328 @@ func TestCallingMainWithMocks(t *testing.T) {
 				ExpectedInitialECDSAPublicKey),
 			stdErr: testtools.NewStringStringMatcher(""),
 		},
-		"Exactly 250 ascii characters, plus a trailing newline, but not removed in banary mode": {
+		"Exactly 250 ascii characters, plus a trailing newline, but not removed in banary mode": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-binary"},
+			stdInput:  DeclarationOfIndependanceFirst250Chars + "\n",
+			status:    2,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Input contains more than 250 bytes (exactly 251):\n\"When in the Course of human events it becomes necessary for one people to dissolve the political bands which have connected them with another and to assume among the powers of the earth, the separate and equal station to which the Laws of Nature  and\\n\"\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Decomposed input normalized to NFC": {
+			homeDir:  "/home/anybody",
+			argList:  []string{"codechallenge", "-normalize", "nfc"},
+			stdInput: "Cafe\u0301 con lec\u0327he\n",
+			status:   0,
+			stdOutput: testtools.GetResponseMatcherForMessageAndAlgorithm(
+				deps.Defaults,
+				"Caf\u00e9 con le\u00e7he",
+				x509.ECDSA),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Precomposed input normalized to NFD": {
+			homeDir:  "/home/anybody",
+			argList:  []string{"codechallenge", "-normalize", "NFD"},
+			stdInput: "Caf\u00e9",
+			status:   0,
+			stdOutput: testtools.GetResponseMatcherForMessageAndAlgorithm(
+				deps.Defaults,
+				"Cafe\u0301",
+				x509.ECDSA),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Unrecognized normalization form": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-normalize", "NFX"},
+			stdInput:  "Abcdefg",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized normalization form \"NFX\": expected NFC, NFD or NFKC\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Normalization of binary content": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-binary", "-normalize", "NFC"},
+			stdInput:  "Abcdefg",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -normalize is not valid for -binary content\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"250 emoji ZWJ sequences count as 250 characters": {
+			homeDir:  "/home/anybody",
+			argList:  []string{"codechallenge"},
+			stdInput: strings.Repeat(FamilyEmoji, 250),
+			status:   0,
+			stdOutput: testtools.GetResponseMatcherForMessageAndAlgorithm(
+				deps.Defaults,
+				strings.Repeat(FamilyEmoji, 250),
+				x509.ECDSA),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"251 combining character sequences": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge"},
+			stdInput:  strings.Repeat("e\u0301", 251),
+			status:    2,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewRegexpStringMatcher("^Input contains more than 250 UTF-8 characters \\(exactly 251\\):\n"),
+		},
+		"Non-ASCII byte in ascii mode": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-ascii"},
+			stdInput:  "Na\xefve",
+			status:    2,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Input contains a non-ASCII byte (0xef) at offset 2:\n\"Na\\xefve\"\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Latin-1 input transcoded to UTF-8": {
+			homeDir:  "/home/anybody",
+			argList:  []string{"codechallenge", "-encoding", "latin1"},
+			stdInput: "Na\xefve caf\xe9\n",
+			status:   0,
+			stdOutput: testtools.GetResponseMatcherForMessageAndMetadata(
+				deps.Defaults,
+				"Na\u00efve caf\u00e9",
+				map[string]string{"encoding": "ISO-8859-1"}),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Windows-1252 input transcoded to UTF-8": {
+			homeDir:  "/home/anybody",
+			argList:  []string{"codechallenge", "-encoding", "CP1252"},
+			stdInput: "\x93Quoted\x94 \x80 5",
+			status:   0,
+			stdOutput: testtools.GetResponseMatcherForMessageAndMetadata(
+				deps.Defaults,
+				"\u201cQuoted\u201d \u20ac 5",
+				map[string]string{"encoding": "windows-1252"}),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Little endian UTF-16 input transcoded to UTF-8": {
+			homeDir:  "/home/anybody",
+			argList:  []string{"codechallenge", "-encoding", "utf-16", "-normalize", "NFC"},
+			stdInput: "\xff\xfeC\x00a\x00f\x00e\x00\x01\x03",
+			status:   0,
+			stdOutput: testtools.GetResponseMatcherForMessageAndMetadata(
+				deps.Defaults,
+				"Caf\u00e9",
+				map[string]string{"encoding": "UTF-16", "normalization": "NFC"}),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"UTF-16 input without byte order mark": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-encoding", "utf-16"},
+			stdInput:  "C\x00a\x00",
+			status:    2,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewRegexpStringMatcher("^Input could not be decoded as UTF-16: "),
+		},
+		"Transcoding binary content": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-binary", "-encoding", "latin1"},
+			stdInput:  "Abcdefg",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -encoding may only be used with -utf8 content\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized character encoding": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-encoding", "ebcdic"},
+			stdInput:  "Abcdefg",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewRegexpStringMatcher("^Unrecognized character encoding \"ebcdic\": expected one of cp1252, iso-8859-1, latin1, utf-16, windows-1252\n"),
+		},
+		"Pre-computed SHA-256 digest in hex": {
+			homeDir:  "/home/anybody",
+			argList:  []string{"codechallenge", "-digest"},
+			stdInput: AbcSHA256Hex + "\n",
+			status:   0,
+			stdOutput: testtools.GetResponseMatcherForMessageAndMetadata(
+				deps.Defaults,
+				AbcSHA256Hex,
+				map[string]string{"hash": "sha256"}),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Pre-computed SHA-256 digest in base64": {
+			homeDir:  "/home/anybody",
+			argList:  []string{"codechallenge", "-digest", "-rsa"},
+			stdInput: "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=",
+			status:   0,
+			stdOutput: testtools.GetResponseMatcherForMessageAndMetadata(
+				deps.Defaults,
+				AbcSHA256Hex,
+				map[string]string{"hash": "sha256"}),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Pre-computed SHA-256 digest signed as SHA-512": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-digest", "-hash", "sha512"},
+			stdInput:  AbcSHA256Hex,
+			status:    2,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Digest is 32 bytes long, but sha512 digests are 64 bytes long\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Pre-computed digest with ascii content": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-digest", "-ascii"},
+			stdInput:  AbcSHA256Hex,
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -digest may not be used with other input format options\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Message digested with SHA-384": {
+			homeDir:  "/home/anybody",
+			argList:  []string{"codechallenge", "-hash", "SHA384"},
+			stdInput: "abc",
+			status:   0,
+			stdOutput: testtools.GetResponseMatcherForMessageAndMetadata(
+				deps.Defaults,
+				"abc",
+				map[string]string{"hash": "sha384"}),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Unrecognized hash": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-hash", "md5"},
+			stdInput:  "abc",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized hash \"md5\": expected sha256, sha384 or sha512\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with verify mode": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-hash", "sha384"},
+			stdInput:  "{}",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with -verify, as the hash is recorded in the signed message\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Verify mode with malformed input": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify"},
+			stdInput:  "not JSON",
+			status:    2,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewRegexpStringMatcher(fmt.Sprintf("^Input is not a valid signed message: .*%s$", regexp.QuoteMeta("\nUsage of codechallenge:"+UsageMessageBody))),
+		},
+		"sign-file without paths": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-file"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command sign-file requires at least one file path\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"verify-file with input format options": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "verify-file", "-binary", "a.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Input format options may not be used with the verify-file command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"sign-file with verify mode": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-file", "-verify", "a.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -verify may not be used with the sign-file command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Raw signatures without a command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-raw"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -raw may only be used with the sign-file and verify-file commands\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with verify-file for JSON signatures": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "verify-file", "-hash", "sha512", "a.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is only valid with verify-file for -raw signatures, as the hash is otherwise recorded in the signature\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"sign-manifest with two directories": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-manifest", "a", "b"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command sign-manifest requires exactly one directory path\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with verify-manifest": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "verify-manifest", "-hash", "sha512", "a"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with verify-manifest, as the hash is recorded in the signed manifest\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Raw signatures with sign-manifest": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-manifest", "-raw", "a"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -raw may only be used with the sign-file and verify-file commands\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sing-file", "a.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized command \"sing-file\": expected one of sign-file, verify-file, sign-manifest, verify-manifest, jwt, verify-jwt, cwt, verify-cwt, paseto, verify-paseto, export-pgp-key, export-ssh-key, export-minisign-key, attest, sign-http, verify-http, dkim, verify-dkim, export-dkim-record, cert self-sign, csr, ca init, ca issue, ca revoke, ca crl, tsa-server, add-signature\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized output format": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "xml"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized output format \"xml\": expected one of cms, cms-pem, cose, dsse, json, jws, jws-json, minisign, pgp, sshsig\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with JWS output": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "jws", "-hash", "sha512"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with JWS output, as the hash is determined by the JWS algorithm\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"JWS algorithm without JWS output": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-alg", "ES256"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -alg is only valid when signing JWS or COSE output, or with the sign-http command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Payload file when signing a JWS": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "jws", "-payload", "a.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -payload is only valid when verifying JWS, COSE, CMS, OpenPGP, SSH or minisign input\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Certificate without JSON or CMS output": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "jws", "-cert", "signer.crt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -cert is only valid when signing JSON or CMS output, or with the tsa-server command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Digest with CMS output": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "cms", "-digest"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -digest is not valid with CMS output, as CMS signs the content itself\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Digest with OpenPGP output": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "pgp", "-digest"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -digest is not valid with OpenPGP output, as OpenPGP signs the message itself\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Binary OpenPGP cleartext": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "pgp", "-binary"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -binary is only valid with -detached for OpenPGP output, as a cleartext signed message is text\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"User ID without export-pgp-key": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "pgp", "-uid", "Test <test@example.com>"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -uid is only valid with the export-pgp-key command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"export-pgp-key without user ID": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "export-pgp-key"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command export-pgp-key requires -uid\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Namespace without SSH signature": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "pgp", "-namespace", "file"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -namespace is only valid with SSH signatures\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"SSH signature without namespace": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "sshsig"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("SSH signatures require -namespace\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"SHA-384 SSH signature": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "sshsig", "-namespace", "file", "-hash", "sha384"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash must be sha256 or sha512 for SSH signatures\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Allowed signers when signing": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "sshsig", "-namespace", "file", "-allowed-signers", "allowed_signers", "-principal", "ops@example.com"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -allowed-signers and -principal are only valid when verifying SSH signatures\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Allowed signers without principal": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-format", "sshsig", "-namespace", "file", "-allowed-signers", "allowed_signers"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -allowed-signers and -principal must be used together\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Minisign signature with ECDSA": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "minisign"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Minisign keys and signatures require an Ed25519 key, given by -ed25519\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Minisign key export with RSA": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "export-minisign-key", "-rsa"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Minisign keys and signatures require an Ed25519 key, given by -ed25519\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with minisign": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-ed25519", "-format", "minisign", "-hash", "sha512"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with minisign, as its signatures use BLAKE2b-512\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Trusted comment without minisign": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "sshsig", "-namespace", "file", "-trusted-comment", "release"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -trusted-comment and -legacy are only valid when signing minisign signatures\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Legacy when verifying minisign": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-format", "minisign", "-legacy"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -trusted-comment and -legacy are only valid when signing minisign signatures\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Digest with DSSE": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "dsse", "-digest"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -digest is not valid with DSSE output, as DSSE signs the payload itself\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with DSSE": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "dsse", "-hash", "sha512"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with DSSE output, as the hash is determined by the key\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Payload type without DSSE": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "jws", "-payload-type", "text/plain"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -payload-type and -add-signature are only valid when signing DSSE output\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Add signature when verifying DSSE": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-format", "dsse", "-add-signature"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -payload-type and -add-signature are only valid when signing DSSE output\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Payload type with added signature": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "dsse", "-add-signature", "-payload-type", "text/plain"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -payload-type and -add-signature may not be used together, as the envelope already has a payload type\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Predicate without attest": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "dsse", "-predicate", "predicate.json"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -predicate-type and -predicate are only valid with the attest command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Attest without predicate type": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "attest", "-predicate", "predicate.json", "hello.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command attest requires -predicate-type\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Attest without paths": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "attest", "-predicate-type", "https://example.com/test/v1"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command attest requires at least one file path\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Components without HTTP command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-components", "@method"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -components and -label are only valid with the sign-http and verify-http commands\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Label with verify": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-label", "sig1"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -components and -label are only valid with the sign-http and verify-http commands\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unsupported component": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-http", "-components", "@method,@target-uri"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unsupported HTTP message signature component \"@target-uri\": expected a header name or one of @method, @authority, @path, @query, @request-target\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Upper-case component": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-http", "-components", "Content-Type"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("HTTP message signature component \"Content-Type\" must be lower-case\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Empty component": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "verify-http", "-components", "@method,,@path"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("HTTP message signature component \"\" is not a header name\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Invalid label": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-http", "-label", "Sig 1"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("HTTP message signature label \"Sig 1\" must be lower-case letters, digits and _-.*, such as sig1\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with HTTP message signature": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-http", "-hash", "sha512"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with HTTP message signatures, as the hash is determined by the algorithm\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Algorithm with verify-http": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "verify-http", "-alg", "ed25519"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -alg is only valid when signing JWS or COSE output, or with the sign-http command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Paths with sign-http": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-http", "request.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command sign-http takes no paths\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"DKIM without domain": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "dkim", "-ed25519", "-selector", "mail"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command dkim requires -domain and -selector\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"DKIM with ECDSA": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "dkim", "-domain", "example.com", "-selector", "mail"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("DKIM keys and signatures require an RSA or Ed25519 key, given by -rsa or -ed25519\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Selector without DKIM command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-selector", "mail"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -domain and -selector are only valid with the dkim and verify-dkim commands\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Headers with verify-dkim": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "verify-dkim", "-dns-record", "mail.txt", "-headers", "From,To"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -canonicalization and -headers are only valid with the dkim command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unsupported canonicalization": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "dkim", "-rsa", "-domain", "example.com", "-selector", "mail", "-canonicalization", "nofws"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unsupported DKIM canonicalization \"nofws\": expected simple or relaxed, or header/body such as relaxed/simple\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Headers without From": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "dkim", "-rsa", "-domain", "example.com", "-selector", "mail", "-headers", "To,Subject"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -headers must include From, as DKIM signatures must cover it\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Invalid header name": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "dkim", "-rsa", "-domain", "example.com", "-selector", "mail", "-headers", "From,Reply To"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("DKIM header \"Reply To\" is not a header field name\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"verify-dkim without DNS record": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "verify-dkim"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command verify-dkim requires -dns-record\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"DNS record with dkim": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "dkim", "-rsa", "-domain", "example.com", "-selector", "mail", "-dns-record", "mail.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -dns-record is only valid with the verify-dkim command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with DKIM": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "dkim", "-ed25519", "-domain", "example.com", "-selector", "mail", "-hash", "sha512"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with DKIM, as its signatures use SHA-256\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Paths with export-dkim-record": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "export-dkim-record", "-rsa", "mail.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command export-dkim-record takes no paths\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Certificate with verify": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-cert", "signer.crt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -cert is only valid when signing JSON or CMS output, or with the tsa-server command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Certificate with sign-file": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-file", "-cert", "signer.crt", "a.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -cert is only valid when signing JSON or CMS output, or with the tsa-server command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Certificate options without cert self-sign": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-subject", "CN=signer"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Certificate options are only valid with the cert self-sign, csr, ca init, ca issue and ca crl commands\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Subject without type": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-subject", "signer"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Subject attribute \"signer\" is not of the form type=value\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unsupported subject attribute": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-subject", "CN=signer,E=signer@example.com"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unsupported subject attribute \"E\": expected one of C, CN, L, O, OU, POSTALCODE, SERIALNUMBER, ST, STREET\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Bad IP address SAN": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-san", "IP:10.0.0"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Subject alternative name \"IP:10.0.0\" is not an IP address\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Relative URI SAN": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-san", "URI:/signer"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Subject alternative name \"URI:/signer\" is not an absolute URI\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized key usage": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-key-usage", "signing"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized key usage \"signing\": expected one of cRLSign, contentCommitment, dataEncipherment, decipherOnly, digitalSignature, encipherOnly, keyAgreement, keyCertSign, keyEncipherment, nonRepudiation\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized extended key usage": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-ext-key-usage", "documentSigning"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized extended key usage \"documentSigning\": expected one of OCSPSigning, any, clientAuth, codeSigning, emailProtection, serverAuth, timeStamping\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Path length without CA": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-path-len", "0"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -path-len is only valid with -ca\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Negative path length": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-ca", "-path-len", "-2"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -path-len must not be negative. Saw -path-len=-2\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with cert self-sign": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-hash", "sha512"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with certificates, as the hash is determined by the key\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Paths with cert self-sign": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "signer.crt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command cert self-sign takes no paths\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Certificate without subcommand": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized command \"cert\": expected one of sign-file, verify-file, sign-manifest, verify-manifest, jwt, verify-jwt, cwt, verify-cwt, paseto, verify-paseto, export-pgp-key, export-ssh-key, export-minisign-key, attest, sign-http, verify-http, dkim, verify-dkim, export-dkim-record, cert self-sign, csr, ca init, ca issue, ca revoke, ca crl, tsa-server, add-signature\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Days with csr": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "csr", "-days", "30"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -days is not valid with the csr command, as the CA sets the validity period\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"DER without csr": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-der"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -der and -issued are only valid with the csr command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"DER with issued certificate": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "csr", "-der", "-issued", "signer.crt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -der and -issued may not be used together, as no CSR is written\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Issued certificate with certificate options": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "csr", "-subject", "CN=signer", "-issued", "signer.crt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -issued may not be used with other certificate options, as no CSR is written\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with csr": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "csr", "-hash", "sha384"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with certificates, as the hash is determined by the key\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Paths with csr": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "csr", "signer.csr"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command csr takes no paths\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Subject with ca issue": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "ca", "issue", "-subject", "CN=signer"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -subject and -san are not valid with the ca issue command, as the names are those of the CSR\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Certificate options with ca crl": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "ca", "crl", "-ca"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -days is the only certificate option valid with the ca crl command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Certificate options with ca revoke": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "ca", "revoke", "-days", "30", "01"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Certificate options are only valid with the cert self-sign, csr, ca init, ca issue and ca crl commands\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Name constraints without CA": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cert", "self-sign", "-permitted-dns", "example.com"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -permitted-dns and -excluded-dns are only valid with -ca or the ca init command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Name constraints with csr": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "csr", "-ca", "-excluded-dns", "example.com"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -permitted-dns and -excluded-dns are not valid with the csr command, as the CA sets the name constraints\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Malformed name constraint": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "ca", "init", "-permitted-dns", "example.com,"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Name constraint \"\" is not a DNS domain\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"CA directory without ca command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "csr", "-ca-dir", "ca"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -ca-dir is only valid with the ca commands\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Private key with ca command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "ca", "init", "-private", "ca.priv"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -private and -public are not valid with the ca commands, as the keys of the CA are in -ca-dir\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Key options with ca issue": {
 			homeDir:   "/home/anybody",
-			argList:   []string{"codechallenge", "-binary"},
-			stdInput:  DeclarationOfIndependanceFirst250Chars + "\n",
-			status:    2,
+			argList:   []string{"codechallenge", "ca", "issue", "-rsa"},
+			stdInput:  "",
+			status:    1,
 			stdOutput: testtools.NewStringStringMatcher(""),
-			stdErr:    testtools.NewStringStringMatcher("Input contains more than 250 bytes (exactly 251):\n\"When in the Course of human events it becomes necessary for one people to dissolve the political bands which have connected them with another and to assume among the powers of the earth, the separate and equal station to which the Laws of Nature  and\\n\"\nUsage of codechallenge:" + UsageMessageBody),
+			stdErr:    testtools.NewStringStringMatcher("Key options are only valid with the ca init command, as the key of the CA is that of its certificate\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with ca issue": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "ca", "issue", "-hash", "sha384"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with certificates, as the hash is determined by the key\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Paths with ca crl": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "ca", "crl", "crl.pem"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command ca crl takes no paths\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Revoke without serial number": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "ca", "revoke"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command ca revoke requires exactly one serial number\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized ca command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "ca", "sign"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized command \"ca\": expected one of sign-file, verify-file, sign-manifest, verify-manifest, jwt, verify-jwt, cwt, verify-cwt, paseto, verify-paseto, export-pgp-key, export-ssh-key, export-minisign-key, attest, sign-http, verify-http, dkim, verify-dkim, export-dkim-record, cert self-sign, csr, ca init, ca issue, ca revoke, ca crl, tsa-server, add-signature\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Trust store without verify": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-trust-store", "roots"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Trust options are only valid when verifying JSON or CMS input\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Trust store with JWS": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-format", "jws", "-trust-store", "roots"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Trust options are only valid when verifying JSON or CMS input\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"CRL without trust store": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-crl", "crl.pem"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -crl and -check-time require -trust-store\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Signing time with JSON": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-trust-store", "roots", "-check-time", "signing"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -check-time=signing is only valid for CMS input, as signed messages in JSON format have no signing time\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized check time": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-format", "cms", "-trust-store", "roots", "-check-time", "later"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized check time \"later\": expected now, signing or timestamp\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Subject with trust store": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-trust-store", "roots", "-subject", "CN=signer"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -key-usage and -ext-key-usage are the only certificate options valid with -trust-store\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"TSA when verifying": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-tsa", "http://localhost:3161/"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -tsa is only valid when signing JSON or CMS output\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"TSA with JWS output": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "jws", "-tsa", "http://localhost:3161/"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -tsa is only valid when signing JSON or CMS output\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"TSA without a scheme": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-tsa", "localhost:3161"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -tsa must be an http or https URL. Saw -tsa=localhost:3161\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Listen without tsa-server": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-listen", "localhost:8080"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -listen is only valid with the tsa-server command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"tsa-server without a certificate": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "tsa-server"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command tsa-server requires -cert\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"tsa-server with paths": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "tsa-server", "-cert", "tsa.crt", "extra"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command tsa-server takes no paths\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Envelope when verifying": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-envelope", "v2"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -envelope is only valid when signing JSON output, as the version of JSON input is recorded in it\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Envelope with CMS output": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "cms", "-envelope", "v2"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -envelope is only valid when signing JSON output, as the version of JSON input is recorded in it\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized envelope version": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-envelope", "v3"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized envelope version \"v3\": expected one of v1, v2\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Envelope v2 with a digest": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-digest", "-envelope", "v2"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -envelope=v2 is not valid with -digest, as a pre-computed digest can't cover the envelope\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Expiry when verifying": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-expires", "1h"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -not-before and -expires are only valid when signing JSON output\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Expiry without envelope v2": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-expires", "1h"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -not-before and -expires require -envelope=v2, as only its signature covers them\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized not-before time": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-envelope", "v2", "-not-before", "tomorrow"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -not-before: Unrecognized time \"tomorrow\": expected a duration relative to now (such as 1h or -5m), an RFC 3339 time or seconds since the Unix epoch\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Leeway when signing": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-leeway", "1m"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -leeway is only valid with the verify-jwt, verify-cwt and verify-paseto commands, or when verifying JSON input\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Sequence when verifying": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-sequence"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -sequence is only valid when signing JSON output\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Sequence without envelope v2": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-sequence"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -sequence requires -envelope=v2, as only its signature covers the sequence number\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Replay check when signing": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-replay-check"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -replay-check is only valid when verifying JSON input\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"State directory alone": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-state-dir", "/tmp/state"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -state-dir is only valid with -sequence or -replay-check\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Several keys with CMS output": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "cms", "-private", "a.priv,b.priv", "-public", "a.pub,b.pub"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -private and -public only list several keys when signing JSON output, or with the add-signature command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Mismatched key lists": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-private", "a.priv,b.priv", "-public", "a.pub"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -private and -public must list the same number of key files\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Several keys with envelope v2": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-envelope", "v2", "-private", "a.priv,b.priv", "-public", "a.pub,b.pub"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Several keys are not valid with -envelope=v2, -cert or -tsa, which are of a single signature\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Key listed twice": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-private", "a.priv,a.priv", "-public", "a.pub,b.pub"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Key file a.priv is listed more than once\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Policy when signing": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-policy", "any"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -policy and -signers are only valid when verifying JSON input\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized signature policy": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-policy", "most"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized signature policy \"most\": expected all, any or a positive number of keys\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Policy of more keys than signers": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-verify", "-policy", "3", "-signers", "a.pub,b.pub"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -policy requires 3 keys, but -signers lists only 2\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with add-signature": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "add-signature", "-hash", "sha512"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with add-signature, as the hash is recorded in the signed message\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"add-signature with a path": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "add-signature", "signed.json"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command add-signature takes no paths\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Missing certificate file": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "cms", "-cert", "signer.crt"},
+			stdInput:  "Hello, World!",
+			status:    4,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("open signer.crt: no such file or directory\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Curve with RSA": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-rsa", "-curve", "P-384"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -curve is only valid for ECDSA\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized curve": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-curve", "P-192"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Unrecognized elliptic curve \"P-192\": expected P-256, P-384 or P-521\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Output format with sign-file": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "sign-file", "-format", "jws", "a.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -format may not be used with the sign-file command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"JWT claim without the jwt command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-sub", "me"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -sub is only valid with the jwt, cwt and paseto commands\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Leeway with the jwt command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "jwt", "-leeway", "1m"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -leeway is only valid with the verify-jwt, verify-cwt and verify-paseto commands, or when verifying JSON input\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Negative leeway": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "verify-jwt", "-leeway", "-1m"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -leeway must not be negative. Saw -leeway=-1m0s\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Unrecognized JWT expiration time": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "jwt", "-exp", "tomorrow"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -exp: Unrecognized time \"tomorrow\": expected a duration relative to now (such as 1h or -5m), an RFC 3339 time or seconds since the Unix epoch\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"jwt with a path": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "jwt", "a.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command jwt takes no paths\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with verify-jwt": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "verify-jwt", "-hash", "sha384"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with JWS output, as the hash is determined by the JWS algorithm\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with COSE output": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "cose", "-hash", "sha512"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with COSE output, as the hash is determined by the COSE algorithm\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"JWK with COSE output": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "-format", "cose", "-jwk"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -jwk is only valid when signing JWS output\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Leeway with the cwt command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cwt", "-leeway", "1m"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -leeway is only valid with the verify-jwt, verify-cwt and verify-paseto commands, or when verifying JSON input\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"cwt with a path": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "cwt", "a.txt"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Command cwt takes no paths\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Footer without the paseto command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "jwt", "-footer", "kid"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Options -footer and -implicit are only valid with the paseto and verify-paseto commands\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Algorithm with the paseto command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "paseto", "-ed25519", "-alg", "EdDSA"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -alg is only valid when signing JWS or COSE output, or with the sign-http command\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Hash with the paseto command": {
+			homeDir:   "/home/anybody",
+			argList:   []string{"codechallenge", "paseto", "-hash", "sha384"},
+			stdInput:  "",
+			status:    1,
+			stdOutput: testtools.NewStringStringMatcher(""),
+			stdErr:    testtools.NewStringStringMatcher("Option -hash is not valid with PASETO output, as the hash is determined by the PASETO algorithm\nUsage of codechallenge:" + UsageMessageBody),
 		},
 		"Exactly 250 ascii characters, works fine in banary mode without newline": {
 			homeDir:  "/home/anybody",
@@ -147,3 +1687,137 @@ func TestCallingMainWithMocks(t *testing.T) {
 		})
 	}
 }
+
+// TestVerifyMode verifies that messages signed by RealMain can be verified in
+// -verify mode, and that tampering with them is detected.
+func TestVerifyMode(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signArgs   []string
+		stdInput   string
+		tamper     func(*codechallenge.SignedMessage)
+		verifyArgs []string
+		status     int
+		stdOutput  string
+	}{
+		"Untouched ECDSA signature": {
+			signArgs:   []string{"codechallenge"},
+			stdInput:   "Hello, World!",
+			tamper:     func(*codechallenge.SignedMessage) {},
+			verifyArgs: []string{"codechallenge", "-verify"},
+			status:     0,
+			stdOutput:  "{\n\"valid\": true,\n\"reason\": \"valid\"\n}",
+		},
+		"Untouched RSA signature over SHA-512": {
+			signArgs:   []string{"codechallenge", "-rsa", "-hash", "sha512"},
+			stdInput:   "Hello, World!",
+			tamper:     func(*codechallenge.SignedMessage) {},
+			verifyArgs: []string{"codechallenge", "-rsa", "-verify"},
+			status:     0,
+			stdOutput:  "{\n\"valid\": true,\n\"reason\": \"valid\"\n}",
+		},
+		"Untouched signature over a digest": {
+			signArgs:   []string{"codechallenge", "-digest"},
+			stdInput:   AbcSHA256Hex,
+			tamper:     func(*codechallenge.SignedMessage) {},
+			verifyArgs: []string{"codechallenge", "-verify", "-digest"},
+			status:     0,
+			stdOutput:  "{\n\"valid\": true,\n\"reason\": \"valid\"\n}",
+		},
+		"Tampered message": {
+			signArgs: []string{"codechallenge"},
+			stdInput: "Hello, World!",
+			tamper: func(doc *codechallenge.SignedMessage) {
+				doc.Message = "Goodbye, World!"
+			},
+			verifyArgs: []string{"codechallenge", "-verify"},
+			status:     9,
+			stdOutput:  "{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}",
+		},
+		"Tampered hash": {
+			signArgs: []string{"codechallenge", "-rsa"},
+			stdInput: "Hello, World!",
+			tamper: func(doc *codechallenge.SignedMessage) {
+				doc.Hash = "sha384"
+			},
+			verifyArgs: []string{"codechallenge", "-rsa", "-verify"},
+			status:     9,
+			stdOutput:  "{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"crypto/rsa: verification error\"\n}",
+		},
+		"Verified with the wrong key": {
+			signArgs:   []string{"codechallenge"},
+			stdInput:   "Hello, World!",
+			tamper:     func(*codechallenge.SignedMessage) {},
+			verifyArgs: []string{"codechallenge", "-verify", "-public", "other.pub"},
+			status:     9,
+			stdOutput:  "{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"Signed message is not signed by the public key in other.pub\"\n}",
+		},
+		"Public key of another signer": {
+			signArgs:   []string{"codechallenge", "-private", "other.priv", "-public", "other.pub"},
+			stdInput:   "Hello, World!",
+			tamper:     func(*codechallenge.SignedMessage) {},
+			verifyArgs: []string{"codechallenge", "-verify"},
+			status:     9,
+			stdOutput:  "{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"Signed message is not signed by the public key in /home/anybody/.smartEdge/id_ecdsa.pub\"\n}",
+		},
+		"Digest verified without -digest": {
+			signArgs:   []string{"codechallenge", "-digest"},
+			stdInput:   AbcSHA256Hex,
+			tamper:     func(*codechallenge.SignedMessage) {},
+			verifyArgs: []string{"codechallenge", "-verify"},
+			status:     10,
+			stdOutput:  "{\n\"valid\": false,\n\"reason\": \"signed content mismatch\",\n\"detail\": \"message is a pre-computed digest, which requires -digest\"\n}",
+		},
+		"Message verified with -digest": {
+			signArgs:   []string{"codechallenge"},
+			stdInput:   AbcSHA256Hex,
+			tamper:     func(*codechallenge.SignedMessage) {},
+			verifyArgs: []string{"codechallenge", "-verify", "-digest"},
+			status:     10,
+			stdOutput:  "{\n\"valid\": false,\n\"reason\": \"signed content mismatch\",\n\"detail\": \"message is not a pre-computed digest, but -digest was given\"\n}",
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			// Generate the key-pair of one signer, and add that of another:
+			files := testtools.FakeFileSystem{}
+			runMain(tt, &files, "Hello, World!")
+			testtools.AddOtherKeyPair(files, "/home/anybody")
+			signBundle := mocks.NewDefaultMockDeps(tc.stdInput, tc.signArgs, "/home/anybody", &files)
+			err := signBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(signBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling signBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+			}
+			doc, err := codechallenge.InjestSignedMessage(strings.NewReader(signBundle.OutBuf.String()))
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing signed message: %s", err.Error())
+			}
+			tc.tamper(doc)
+			signedMessage, err := json.Marshal(doc)
+			if err != nil {
+				tt.Fatalf("Unexpected error rendering signed message: %s", err.Error())
+			}
+			verifyBundle := mocks.NewDefaultMockDeps(string(signedMessage), tc.verifyArgs, "/home/anybody", &files)
+			err = verifyBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(verifyBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Errorf("Unexpected error calling verifyBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if actual := verifyBundle.OutBuf.String(); actual != tc.stdOutput {
+				tt.Errorf("Standard Output:\n%#v when expecting:\n%#v", actual, tc.stdOutput)
+			}
+			if actual := verifyBundle.ErrBuf.String(); actual != "" {
+				tt.Errorf("Unexpected Standard Error:\n%#v", actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Package intoto builds and parses in-toto Statements, which attest to a
+// predicate about a set of subjects, such as the provenance of build outputs.
+package intoto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PayloadType is the DSSE payload type of a Statement.
+const PayloadType = "application/vnd.in-toto+json"
+
+// StatementType is the _type of the Statements written.
+const StatementType = "https://in-toto.io/Statement/v1"
+
+// statementTypePrefix starts the _type of every version of Statement, all of
+// which have the same fields.
+const statementTypePrefix = "https://in-toto.io/Statement/"
+
+// Subject is an artifact a Statement is about, identified by its digests,
+// keyed by the name of the hash, such as sha256.
+type Subject struct {
+	Name   string            `json:"name,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Statement is an in-toto Statement. The predicate is kept as JSON, as its
+// contents depend on its type.
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []*Subject      `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate,omitempty"`
+}
+
+// NewStatement returns a Statement of the predicate, of predicateType, about
+// subjects. The predicate must be a JSON object, or empty if its type says
+// all there is to say.
+func NewStatement(subjects []*Subject, predicateType string, predicate []byte) (*Statement, error) {
+	result := &Statement{Type: StatementType, Subject: subjects, PredicateType: predicateType}
+	if trimmed := bytes.TrimSpace(predicate); len(trimmed) > 0 {
+		if (trimmed[0] != '{') || !json.Valid(trimmed) {
+			return nil, errors.New("in-toto predicate is not a JSON object")
+		}
+		compacted := &bytes.Buffer{}
+		if err := json.Compact(compacted, predicate); err != nil {
+			return nil, err
+		}
+		result.Predicate = compacted.Bytes()
+	}
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// validate returns an error if the Statement is missing something it
+// requires.
+func (s *Statement) validate() error {
+	if !strings.HasPrefix(s.Type, statementTypePrefix) {
+		return fmt.Errorf("Unsupported in-toto Statement type %#v", s.Type)
+	}
+	if len(s.Subject) == 0 {
+		return errors.New("in-toto Statement has no subjects")
+	}
+	for i, subject := range s.Subject {
+		if len(subject.Digest) == 0 {
+			return fmt.Errorf("in-toto subject %d has no digests", i+1)
+		}
+	}
+	if s.PredicateType == "" {
+		return errors.New("in-toto Statement is missing its predicateType")
+	}
+	return nil
+}
+
+// Marshal returns the JSON serialization of the Statement.
+func (s *Statement) Marshal() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// ParseStatement parses the JSON serialization of a Statement.
+func ParseStatement(data []byte) (*Statement, error) {
+	result := &Statement{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("in-toto Statement is not valid JSON: %s", err.Error())
+	}
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
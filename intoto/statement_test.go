@@ -0,0 +1,90 @@
+package intoto_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge/intoto"
+	"github.com/smartedge/codechallenge/testtools"
+	"testing"
+)
+
+// TestNewStatement verifies the serialization of Statements, and that it
+// parses back to the same Statement.
+func TestNewStatement(t *testing.T) {
+	subjects := []*intoto.Subject{{Name: "hello.txt", Digest: map[string]string{"sha256": "dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"}}}
+	for desc, tc := range map[string]struct {
+		predicate string
+		expected  string
+	}{
+		"Predicate": {
+			predicate: "{\n  \"built\": true\n}\n",
+			expected:  `{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"hello.txt","digest":{"sha256":"dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"}}],"predicateType":"https://example.com/test/v1","predicate":{"built":true}}`,
+		},
+		"No predicate": {
+			predicate: "",
+			expected:  `{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"hello.txt","digest":{"sha256":"dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"}}],"predicateType":"https://example.com/test/v1"}`,
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			statement, err := intoto.NewStatement(subjects, "https://example.com/test/v1", []byte(tc.predicate))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			buff, err := statement.Marshal()
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if string(buff) != tc.expected {
+				tt.Errorf("Statement should be:\n%s\nGot:\n%s", tc.expected, string(buff))
+			}
+			parsed, err := intoto.ParseStatement(buff)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if (parsed.PredicateType != statement.PredicateType) || (parsed.Subject[0].Digest["sha256"] != subjects[0].Digest["sha256"]) {
+				tt.Errorf("Parsed Statement %#v should match %#v", parsed, statement)
+			}
+		})
+	}
+}
+
+// TestStatementErrors verifies that invalid Statements are rejected with an
+// explanation.
+func TestStatementErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		input string
+		err   *testtools.ErrorSpec
+	}{
+		"Not JSON": {
+			input: "Hello, World!",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "in-toto Statement is not valid JSON: invalid character 'H' looking for beginning of value"},
+		},
+		"Other type": {
+			input: `{"_type": "https://example.com/Statement/v1"}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported in-toto Statement type \"https://example.com/Statement/v1\""},
+		},
+		"No subjects": {
+			input: `{"_type": "https://in-toto.io/Statement/v0.1", "subject": [], "predicateType": "https://example.com/test/v1"}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "in-toto Statement has no subjects"},
+		},
+		"Subject without digests": {
+			input: `{"_type": "https://in-toto.io/Statement/v1", "subject": [{"name": "hello.txt", "digest": {}}], "predicateType": "https://example.com/test/v1"}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "in-toto subject 1 has no digests"},
+		},
+		"Missing predicate type": {
+			input: `{"_type": "https://in-toto.io/Statement/v1", "subject": [{"digest": {"sha256": "00"}}]}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "in-toto Statement is missing its predicateType"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			_, err := intoto.ParseStatement([]byte(tc.input))
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+	_, err := intoto.NewStatement([]*intoto.Subject{{Digest: map[string]string{"sha256": "00"}}}, "https://example.com/test/v1", []byte("[true]"))
+	expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "in-toto predicate is not a JSON object"}
+	if err := expectedErr.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+}
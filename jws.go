@@ -0,0 +1,194 @@
+package codechallenge
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/jws"
+	"io/ioutil"
+)
+
+// NewJWSHeader returns the protected header for signing with the keys in
+// cryptStuff, according to settings. The JWS algorithm is derived from the
+// key unless specified, and the kid of the key is always included.
+func NewJWSHeader(cryptStuff *crypt.CryptoTooling, settings *OutputSettings) (*jws.Header, error) {
+	publicKey := cryptStuff.Signer.Public()
+	header := &jws.Header{
+		Alg: settings.JWSAlgorithm,
+	}
+	if header.Alg == "" {
+		var err error
+		header.Alg, err = jws.AlgorithmForKey(publicKey, crypt.PSSPadding)
+		if err != nil {
+			return nil, err
+		}
+	}
+	jwk, err := jws.NewJWK(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	header.Kid, err = jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	if settings.EmbedJWK {
+		header.JWK = jwk
+	}
+	return header, nil
+}
+
+// NewSignedJWS signs message with the keys in cryptStuff as a JWS, according
+// to settings.
+func NewSignedJWS(d *deps.Dependencies, cryptStuff *crypt.CryptoTooling, message []byte, settings *OutputSettings) (*jws.JWS, error) {
+	header, err := NewJWSHeader(cryptStuff, settings)
+	if err != nil {
+		return nil, err
+	}
+	return jws.Sign(cryptStuff.Signer, d.Crypto.Rand.Reader, message, header, settings.Detached)
+}
+
+// RenderJWS returns the serialization of signed selected by format.
+func RenderJWS(signed *jws.JWS, format OutputFormat) ([]byte, error) {
+	switch format {
+	case JWSCompactOutput:
+		compact, err := signed.Compact()
+		if err != nil {
+			return nil, err
+		}
+		return []byte(compact), nil
+	case JWSJSONOutput:
+		return signed.JSON()
+	}
+	return nil, fmt.Errorf("INTERNAL ERROR: %s is not a JWS output format", format.String())
+}
+
+// SignJWSMain signs message as a JWS with the keys in cryptStuff, and writes
+// it to d.Os.Stdout in the serialization selected by config.
+func SignJWSMain(d *deps.Dependencies, config *RunConfig, cryptStuff *crypt.CryptoTooling, message string) {
+	signed, err := NewSignedJWS(d, cryptStuff, []byte(message), &config.Output)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	valid, err := signed.Verify(signed.Signatures[0], cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	buff, err := RenderJWS(signed, config.Output.Format)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	err = WriteOutput(d, buff)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// VerifyJWSMain is the entry-point for -verify mode with JWS input. It reads
+// a JWS in either serialization from d.Os.Stdin, and writes the verdict in
+// JSON format to d.Os.Stdout, exiting with the verdict's exit status if it
+// isn't valid.
+func VerifyJWSMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	signed, err := jws.Parse(string(buff))
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyJWS(d, config, signed)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyJWS checks every signature of signed against the public key file in
+// config. A JWK in the protected header of a signature must be that key, as
+// otherwise whoever made the signature would choose the key it is checked
+// against. A detached payload is read from the file in config.
+func VerifyJWS(d *deps.Dependencies, config *RunConfig, signed *jws.JWS) (*Verdict, error) {
+	if signed.Detached {
+		if config.Output.PayloadPath == "" {
+			return nil, errors.New("JWS payload is detached, which requires -payload")
+		}
+		payload, err := d.Io.Ioutil.ReadFile(config.Output.PayloadPath)
+		if err != nil {
+			return nil, err
+		}
+		signed.Payload = payload
+	} else if config.Output.PayloadPath != "" {
+		return nil, errors.New("Option -payload is only valid for a detached JWS")
+	}
+	publicKey, err := loadPublicKey(d, config.PubKeySettings.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	for i, sig := range signed.Signatures {
+		if sig.Header.JWK != nil {
+			jwkPublicKey, err := sig.Header.JWK.PublicKey()
+			if err != nil {
+				return nil, err
+			}
+			if !crypt.PublicKeysEqual(jwkPublicKey, publicKey) {
+				return NewVerdict(BadSignature, fmt.Sprintf("jwk of signature %d does not match its public key", i+1)), nil
+			}
+		}
+		if sig.Header.Kid != "" {
+			kid, err := jws.KeyID(publicKey)
+			if err != nil {
+				return nil, err
+			}
+			if kid != sig.Header.Kid {
+				return NewVerdict(BadSignature, fmt.Sprintf("kid of signature %d does not match its public key", i+1)), nil
+			}
+		}
+		verdict := newVerdictFromVerification(signed.Verify(sig, publicKey))
+		if !verdict.Valid {
+			return verdict, nil
+		}
+	}
+	return NewVerdict(SignatureValid, ""), nil
+}
+
+// loadPublicKey reads the PEM encoded public key in filename.
+func loadPublicKey(d *deps.Dependencies, filename string) (crypto.PublicKey, error) {
+	_, x509PubKey, err := crypt.LoadAndDecodeKey(d, filename)
+	if err != nil {
+		return nil, err
+	}
+	return x509PubKey.AsGenericPublicKey()
+}
+
+// parseJWSOptions validates the options of the JWS algorithm and embedded JWK
+// in cl into config. The algorithm is also that of COSE and HTTP message
+// signatures.
+func parseJWSOptions(config *RunConfig, cl *commandLine) error {
+	signsJWS := (config.Output.Format.IsJWS() && !config.VerifyMode) || (config.Command == JWTCommand)
+	signsCOSE := (config.Output.Format.IsCOSE() && !config.VerifyMode) || (config.Command == CWTCommand)
+	if *cl.jwsAlgorithm != "" {
+		if !signsJWS && !signsCOSE && (config.Command != SignHTTPCommand) {
+			return fmt.Errorf("Option -alg is only valid when signing JWS or COSE output, or with the %s command", SignHTTPCommand)
+		}
+		config.Output.JWSAlgorithm = *cl.jwsAlgorithm
+	}
+	if *cl.embedJWK {
+		if !signsJWS {
+			return errors.New("Option -jwk is only valid when signing JWS output")
+		}
+		config.Output.EmbedJWK = true
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK is a public JSON Web Key, as defined by RFC 7517, RFC 7518 and
+// RFC 8037.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// curveNames maps each supported elliptic curve to its JWK name.
+var curveNames = map[elliptic.Curve]string{
+	elliptic.P256(): "P-256",
+	elliptic.P384(): "P-384",
+	elliptic.P521(): "P-521",
+}
+
+// NewJWK returns the JWK of publicKey.
+func NewJWK(publicKey crypto.PublicKey) (*JWK, error) {
+	switch typedPublicKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		crv, ok := curveNames[typedPublicKey.Curve]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported elliptic curve: %s", typedPublicKey.Curve.Params().Name)
+		}
+		size := (typedPublicKey.Curve.Params().BitSize + 7) / 8
+		return &JWK{
+			Kty: "EC",
+			Crv: crv,
+			X:   encodeSegment(padLeft(typedPublicKey.X.Bytes(), size)),
+			Y:   encodeSegment(padLeft(typedPublicKey.Y.Bytes(), size)),
+		}, nil
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			N:   encodeSegment(typedPublicKey.N.Bytes()),
+			E:   encodeSegment(big.NewInt(int64(typedPublicKey.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encodeSegment(typedPublicKey),
+		}, nil
+	}
+	return nil, fmt.Errorf("Public key did not conform to recognized algorithm: %T", publicKey)
+}
+
+// PublicKey returns the public key described by the JWK.
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "EC":
+		for curve, crv := range curveNames {
+			if crv != k.Crv {
+				continue
+			}
+			x, err := decodeSegment(k.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := decodeSegment(k.Y)
+			if err != nil {
+				return nil, err
+			}
+			result := &ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+			if !curve.IsOnCurve(result.X, result.Y) {
+				return nil, errors.New("JWK point is not on its curve")
+			}
+			return result, nil
+		}
+		return nil, fmt.Errorf("Unsupported JWK curve %#v", k.Crv)
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || (exponent.Int64() > (1<<31 - 1)) {
+			return nil, errors.New("JWK RSA exponent is too large")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("Unsupported JWK curve %#v", k.Crv)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("JWK Ed25519 key is %d bytes long, but %d bytes were expected", len(x), ed25519.PublicKeySize)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("Unsupported JWK key type %#v", k.Kty)
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the JWK, in base64url
+// encoding. This is used as the kid of a key.
+func (k *JWK) Thumbprint() (string, error) {
+	members := map[string]string{"kty": k.Kty}
+	switch k.Kty {
+	case "EC":
+		members["crv"] = k.Crv
+		members["x"] = k.X
+		members["y"] = k.Y
+	case "RSA":
+		members["e"] = k.E
+		members["n"] = k.N
+	case "OKP":
+		members["crv"] = k.Crv
+		members["x"] = k.X
+	default:
+		return "", fmt.Errorf("Unsupported JWK key type %#v", k.Kty)
+	}
+	// json.Marshal() sorts map keys, and doesn't add whitespace, as RFC 7638
+	// requires.
+	buff, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(buff)
+	return encodeSegment(digest[:]), nil
+}
+
+// KeyID returns the kid of publicKey: the thumbprint of its JWK.
+func KeyID(publicKey crypto.PublicKey) (string, error) {
+	jwk, err := NewJWK(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return jwk.Thumbprint()
+}
+
+// padLeft left pads buf with zeros to size bytes.
+func padLeft(buf []byte, size int) []byte {
+	if len(buf) >= size {
+		return buf
+	}
+	result := make([]byte, size)
+	copy(result[size-len(buf):], buf)
+	return result
+}
+
+// encodeSegment encodes buf in unpadded base64url, as used throughout JOSE.
+func encodeSegment(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// decodeSegment decodes unpadded base64url.
+func decodeSegment(src string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(src)
+}
@@ -0,0 +1,294 @@
+// Package jws implements JSON Web Signatures, as defined by RFC 7515, for the
+// algorithms the codechallenge tool supports.
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// JWS algorithm names, as registered by RFC 7518 and RFC 8037
+const (
+	ES256 = "ES256"
+	ES384 = "ES384"
+	ES512 = "ES512"
+	RS256 = "RS256"
+	PS256 = "PS256"
+	EdDSA = "EdDSA"
+)
+
+// algorithm describes the keys a JWS algorithm signs with, and how.
+type algorithm struct {
+	keyType string
+	crv     string
+	scheme  crypt.SignatureScheme
+}
+
+// algorithms are the supported JWS algorithms, indexed by name.
+var algorithms = map[string]algorithm{
+	ES256: {keyType: "EC", crv: "P-256", scheme: crypt.SignatureScheme{Hash: crypto.SHA256, ECDSAEncoding: crypt.RawEncoding}},
+	ES384: {keyType: "EC", crv: "P-384", scheme: crypt.SignatureScheme{Hash: crypto.SHA384, ECDSAEncoding: crypt.RawEncoding}},
+	ES512: {keyType: "EC", crv: "P-521", scheme: crypt.SignatureScheme{Hash: crypto.SHA512, ECDSAEncoding: crypt.RawEncoding}},
+	RS256: {keyType: "RSA", scheme: crypt.SignatureScheme{Hash: crypto.SHA256, RSAPadding: crypt.PKCS1v15Padding}},
+	PS256: {keyType: "RSA", scheme: crypt.SignatureScheme{Hash: crypto.SHA256, RSAPadding: crypt.PSSPadding}},
+	EdDSA: {keyType: "OKP", crv: "Ed25519"},
+}
+
+// AlgorithmForKey returns the JWS algorithm that signs with publicKey. RSA
+// keys support both RS256 and PS256, so rsaPadding chooses between them.
+func AlgorithmForKey(publicKey crypto.PublicKey, rsaPadding crypt.RSAPadding) (string, error) {
+	switch typedPublicKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		crv, ok := curveNames[typedPublicKey.Curve]
+		if !ok {
+			return "", fmt.Errorf("Unsupported elliptic curve: %s", typedPublicKey.Curve.Params().Name)
+		}
+		for name, alg := range algorithms {
+			if alg.crv == crv {
+				return name, nil
+			}
+		}
+	case *rsa.PublicKey:
+		if rsaPadding == crypt.PKCS1v15Padding {
+			return RS256, nil
+		}
+		return PS256, nil
+	case ed25519.PublicKey:
+		return EdDSA, nil
+	}
+	return "", fmt.Errorf("Public key did not conform to recognized algorithm: %T", publicKey)
+}
+
+// SchemeForAlgorithm returns how the JWS algorithm alg signs, or an error if
+// alg isn't supported, or can't be used with publicKey.
+func SchemeForAlgorithm(alg string, publicKey crypto.PublicKey) (crypt.SignatureScheme, error) {
+	algDetails, ok := algorithms[alg]
+	if !ok {
+		names := make([]string, 0, len(algorithms))
+		for name := range algorithms {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return crypt.SignatureScheme{}, fmt.Errorf("Unsupported JWS algorithm %#v: expected one of %s", alg, strings.Join(names, ", "))
+	}
+	jwk, err := NewJWK(publicKey)
+	if err != nil {
+		return crypt.SignatureScheme{}, err
+	}
+	if (jwk.Kty != algDetails.keyType) || (jwk.Crv != algDetails.crv) {
+		return crypt.SignatureScheme{}, fmt.Errorf("JWS algorithm %s can't be used with a %s key", alg, strings.TrimSpace(jwk.Kty+" "+jwk.Crv))
+	}
+	return algDetails.scheme, nil
+}
+
+// Header is the JOSE header of a JWS. Only the protected header is used.
+type Header struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid,omitempty"`
+	Typ  string   `json:"typ,omitempty"`
+	Cty  string   `json:"cty,omitempty"`
+	JWK  *JWK     `json:"jwk,omitempty"`
+	Crit []string `json:"crit,omitempty"`
+}
+
+// Signature is one signature of a JWS.
+type Signature struct {
+	Protected string
+	Header    *Header
+	Value     crypt.BinarySignature
+}
+
+// JWS is a JSON Web Signature. A detached JWS doesn't include its payload,
+// which must be provided separately before it can be verified.
+type JWS struct {
+	Payload    []byte
+	Detached   bool
+	Signatures []*Signature
+}
+
+// flattenedJSON is the flattened JWS JSON serialization. It is also used for
+// each signature of the general JWS JSON serialization.
+type flattenedJSON struct {
+	Protected string          `json:"protected"`
+	Header    json.RawMessage `json:"header,omitempty"`
+	Payload   *string         `json:"payload,omitempty"`
+	Signature string          `json:"signature"`
+}
+
+// generalJSON is the general JWS JSON serialization.
+type generalJSON struct {
+	Payload    *string          `json:"payload,omitempty"`
+	Signatures []*flattenedJSON `json:"signatures"`
+}
+
+// Sign returns a JWS of payload, signed by signer with the given protected
+// header. The payload is omitted from its serializations if detached is true.
+func Sign(signer crypto.Signer, randReader io.Reader, payload []byte, header *Header, detached bool) (*JWS, error) {
+	result := &JWS{
+		Payload:  payload,
+		Detached: detached,
+	}
+	if err := result.AddSignature(signer, randReader, header); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AddSignature signs the JWS payload with signer, with the given protected
+// header.
+func (j *JWS) AddSignature(signer crypto.Signer, randReader io.Reader, header *Header) error {
+	scheme, err := SchemeForAlgorithm(header.Alg, signer.Public())
+	if err != nil {
+		return err
+	}
+	headerBuf, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	sig := &Signature{
+		Protected: encodeSegment(headerBuf),
+		Header:    header,
+	}
+	sig.Value, err = crypt.SignWithScheme(signer, randReader, j.SigningInput(sig), scheme)
+	if err != nil {
+		return err
+	}
+	j.Signatures = append(j.Signatures, sig)
+	return nil
+}
+
+// SigningInput returns what sig signs: its encoded protected header and the
+// encoded payload, separated by a period.
+func (j *JWS) SigningInput(sig *Signature) []byte {
+	return []byte(sig.Protected + "." + encodeSegment(j.Payload))
+}
+
+// Verify checks sig against publicKey. An error explains why a signature
+// isn't valid.
+func (j *JWS) Verify(sig *Signature, publicKey crypto.PublicKey) (bool, error) {
+	scheme, err := SchemeForAlgorithm(sig.Header.Alg, publicKey)
+	if err != nil {
+		return false, err
+	}
+	return crypt.VerifyWithScheme(publicKey, j.SigningInput(sig), sig.Value, scheme)
+}
+
+// Compact returns the JWS compact serialization. The payload is left empty
+// if it is detached.
+func (j *JWS) Compact() (string, error) {
+	if len(j.Signatures) != 1 {
+		return "", fmt.Errorf("The JWS compact serialization requires exactly one signature, but there are %d", len(j.Signatures))
+	}
+	payload := ""
+	if !j.Detached {
+		payload = encodeSegment(j.Payload)
+	}
+	sig := j.Signatures[0]
+	return sig.Protected + "." + payload + "." + encodeSegment(sig.Value), nil
+}
+
+// JSON returns the JWS JSON serialization: flattened if there is a single
+// signature, or general otherwise. The payload is omitted if it is detached.
+func (j *JWS) JSON() ([]byte, error) {
+	var payload *string
+	if !j.Detached {
+		encodedPayload := encodeSegment(j.Payload)
+		payload = &encodedPayload
+	}
+	signatures := make([]*flattenedJSON, len(j.Signatures))
+	for i, sig := range j.Signatures {
+		signatures[i] = &flattenedJSON{
+			Protected: sig.Protected,
+			Signature: encodeSegment(sig.Value),
+		}
+	}
+	if len(signatures) == 1 {
+		signatures[0].Payload = payload
+		return json.MarshalIndent(signatures[0], "", "")
+	}
+	return json.MarshalIndent(&generalJSON{Payload: payload, Signatures: signatures}, "", "")
+}
+
+// Parse parses a JWS in any of its serializations. A JWS in JSON begins with
+// an opening brace, and is otherwise compact.
+func Parse(input string) (*JWS, error) {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "{") {
+		return parseJSON(input)
+	}
+	parts := strings.Split(input, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("JWS compact serialization has %d parts, but 3 were expected", len(parts))
+	}
+	return newParsedJWS(&parts[1], []*flattenedJSON{{Protected: parts[0], Signature: parts[2]}})
+}
+
+// parseJSON parses the flattened or general JWS JSON serialization.
+func parseJSON(input string) (*JWS, error) {
+	general := generalJSON{}
+	if err := json.Unmarshal([]byte(input), &general); err != nil {
+		return nil, fmt.Errorf("Input is not a valid JWS: %s", err.Error())
+	}
+	if general.Signatures != nil {
+		return newParsedJWS(general.Payload, general.Signatures)
+	}
+	flattened := flattenedJSON{}
+	if err := json.Unmarshal([]byte(input), &flattened); err != nil {
+		return nil, fmt.Errorf("Input is not a valid JWS: %s", err.Error())
+	}
+	return newParsedJWS(flattened.Payload, []*flattenedJSON{&flattened})
+}
+
+// newParsedJWS decodes the parts of a parsed JWS. An empty payload in the
+// compact serialization, or a missing payload in the JSON serialization,
+// is detached.
+func newParsedJWS(payload *string, signatures []*flattenedJSON) (*JWS, error) {
+	result := &JWS{
+		Detached: (payload == nil) || (*payload == ""),
+	}
+	if len(signatures) == 0 {
+		return nil, errors.New("JWS has no signatures")
+	}
+	if !result.Detached {
+		var err error
+		result.Payload, err = decodeSegment(*payload)
+		if err != nil {
+			return nil, fmt.Errorf("JWS payload is not base64url encoded: %s", err.Error())
+		}
+	}
+	for _, encodedSig := range signatures {
+		if len(encodedSig.Header) > 0 {
+			return nil, errors.New("JWS unprotected headers are not supported")
+		}
+		headerBuf, err := decodeSegment(encodedSig.Protected)
+		if err != nil {
+			return nil, fmt.Errorf("JWS protected header is not base64url encoded: %s", err.Error())
+		}
+		header := &Header{}
+		if err := json.Unmarshal(headerBuf, header); err != nil {
+			return nil, fmt.Errorf("JWS protected header is not valid: %s", err.Error())
+		}
+		if len(header.Crit) > 0 {
+			return nil, fmt.Errorf("JWS critical header parameters are not supported: %s", strings.Join(header.Crit, ", "))
+		}
+		value, err := decodeSegment(encodedSig.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("JWS signature is not base64url encoded: %s", err.Error())
+		}
+		result.Signatures = append(result.Signatures, &Signature{
+			Protected: encodedSig.Protected,
+			Header:    header,
+			Value:     crypt.BinarySignature(value),
+		})
+	}
+	return result, nil
+}
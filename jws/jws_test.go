@@ -0,0 +1,181 @@
+package jws_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"github.com/smartedge/codechallenge/jws"
+	"github.com/smartedge/codechallenge/testtools"
+	"testing"
+)
+
+// Test vectors from RFC 8037, Appendix A
+const (
+	RFC8037PrivateKey = "nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A"
+	RFC8037PublicKey  = "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+	RFC8037Thumbprint = "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"
+	RFC8037Payload    = "Example of Ed25519 signing"
+	RFC8037JWS        = "eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc.hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg"
+)
+
+// getRFC8037Key returns the Ed25519 private key of RFC 8037, Appendix A.
+func getRFC8037Key(t *testing.T) ed25519.PrivateKey {
+	seed, err := base64.RawURLEncoding.DecodeString(RFC8037PrivateKey)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding private key: %s", err.Error())
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// TestThumbprint verifies the JWK and its thumbprint against RFC 8037.
+func TestThumbprint(t *testing.T) {
+	jwk, err := jws.NewJWK(getRFC8037Key(t).Public())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if jwk.X != RFC8037PublicKey {
+		t.Errorf("JWK x should be %s. Got %s instead.", RFC8037PublicKey, jwk.X)
+	}
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if thumbprint != RFC8037Thumbprint {
+		t.Errorf("Thumbprint should be %s. Got %s instead.", RFC8037Thumbprint, thumbprint)
+	}
+}
+
+// TestSign verifies that signing reproduces the compact JWS of RFC 8037.
+// Ed25519 signatures are deterministic.
+func TestSign(t *testing.T) {
+	signed, err := jws.Sign(getRFC8037Key(t), rand.Reader, []byte(RFC8037Payload), &jws.Header{Alg: jws.EdDSA}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	compact, err := signed.Compact()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if compact != RFC8037JWS {
+		t.Errorf("Compact JWS:\n%s when expecting:\n%s", compact, RFC8037JWS)
+	}
+}
+
+// TestParse tests parsing and verifying each serialization of a JWS.
+func TestParse(t *testing.T) {
+	publicKey := getRFC8037Key(t).Public()
+	for desc, tc := range map[string]struct {
+		input    string
+		detached bool
+		valid    bool
+		err      *testtools.ErrorSpec
+	}{
+		"Compact": {
+			input: RFC8037JWS,
+			valid: true,
+		},
+		"Compact with tampered payload": {
+			input: "eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDQ0OCBzaWduaW5n.hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg",
+			valid: false,
+		},
+		"Compact detached": {
+			input:    "eyJhbGciOiJFZERTQSJ9..hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg",
+			detached: true,
+			valid:    true,
+		},
+		"Flattened JSON": {
+			input: "{\"protected\":\"eyJhbGciOiJFZERTQSJ9\",\"payload\":\"RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc\"," +
+				"\"signature\":\"hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg\"}",
+			valid: true,
+		},
+		"General JSON": {
+			input: "{\"payload\":\"RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc\",\"signatures\":[{\"protected\":\"eyJhbGciOiJFZERTQSJ9\"," +
+				"\"signature\":\"hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg\"}]}",
+			valid: true,
+		},
+		"Unprotected header": {
+			input: "{\"protected\":\"eyJhbGciOiJFZERTQSJ9\",\"header\":{\"kid\":\"1\"},\"payload\":\"RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc\"," +
+				"\"signature\":\"hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg\"}",
+			err: &testtools.ErrorSpec{Type: "*errors.errorString", Message: "JWS unprotected headers are not supported"},
+		},
+		"Critical header parameter": {
+			// {"alg":"EdDSA","crit":["exp"]}
+			input: "eyJhbGciOiJFZERTQSIsImNyaXQiOlsiZXhwIl19.e30.AA",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "JWS critical header parameters are not supported: exp"},
+		},
+		"Too few parts": {
+			input: "eyJhbGciOiJFZERTQSJ9.e30",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "JWS compact serialization has 2 parts, but 3 were expected"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			signed, err := jws.Parse(tc.input)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Fatal(err.Error())
+			}
+			if tc.err != nil {
+				return
+			}
+			if signed.Detached != tc.detached {
+				tt.Errorf("Detached should be %v", tc.detached)
+			}
+			if signed.Detached {
+				signed.Payload = []byte(RFC8037Payload)
+			}
+			valid, _ := signed.Verify(signed.Signatures[0], publicKey)
+			if valid != tc.valid {
+				tt.Errorf("Verify() should return %v", tc.valid)
+			}
+		})
+	}
+}
+
+// TestAlgorithms verifies that a JWS signed with each supported algorithm
+// survives a round trip through both serializations.
+func TestAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	signers := map[string]crypto.Signer{
+		jws.RS256: rsaKey,
+		jws.PS256: rsaKey,
+		jws.EdDSA: getRFC8037Key(t),
+	}
+	for alg, curve := range map[string]elliptic.Curve{jws.ES256: elliptic.P256(), jws.ES384: elliptic.P384(), jws.ES512: elliptic.P521()} {
+		signers[alg], err = ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+	}
+	for alg, signer := range signers {
+		t.Run(fmt.Sprintf("Subtest: %s", alg), func(tt *testing.T) {
+			signed, err := jws.Sign(signer, rand.Reader, []byte("Hello, World!"), &jws.Header{Alg: alg}, false)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			compact, err := signed.Compact()
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			buff, err := signed.JSON()
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			for _, serialized := range []string{compact, string(buff)} {
+				parsed, err := jws.Parse(serialized)
+				if err != nil {
+					tt.Fatalf("Unexpected error: %s", err.Error())
+				}
+				if valid, err := parsed.Verify(parsed.Signatures[0], signer.Public()); !valid {
+					tt.Errorf("Signature of %s should be valid: %v", serialized, err)
+				}
+			}
+		})
+	}
+}
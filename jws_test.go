@@ -0,0 +1,156 @@
+package codechallenge_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/smartedge/codechallenge/jws"
+	"github.com/smartedge/codechallenge/testtools"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestSignAndVerifyJWS verifies that JWS output written by RealMain can be
+// verified in -verify mode, and that tampering with it is detected.
+func TestSignAndVerifyJWS(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signArgs   []string
+		alg        string
+		embedJWK   bool
+		tamper     func(string) string
+		verifyArgs []string
+		status     int
+		stdOutput  testtools.StringMatcher
+		stdErr     testtools.StringMatcher
+	}{
+		"Compact ECDSA JWS": {
+			signArgs:   []string{"codechallenge", "-format", "jws"},
+			alg:        jws.ES256,
+			tamper:     func(signed string) string { return signed },
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "jws"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Compact ECDSA JWS on P-384": {
+			signArgs:   []string{"codechallenge", "-format", "jws", "-curve", "P-384", "-private", "p384.priv", "-public", "p384.pub"},
+			alg:        jws.ES384,
+			tamper:     func(signed string) string { return signed },
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "jws", "-public", "p384.pub"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Compact RSA JWS with PKCS #1 v1.5 padding": {
+			signArgs:   []string{"codechallenge", "-rsa", "-format", "jws", "-alg", "RS256"},
+			alg:        jws.RS256,
+			tamper:     func(signed string) string { return signed },
+			verifyArgs: []string{"codechallenge", "-rsa", "-verify", "-format", "jws"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"JSON Ed25519 JWS with embedded JWK": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "jws-json", "-jwk"},
+			alg:        jws.EdDSA,
+			embedJWK:   true,
+			tamper:     func(signed string) string { return signed },
+			verifyArgs: []string{"codechallenge", "-ed25519", "-verify", "-format", "jws-json"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Embedded JWK of another key": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "jws", "-jwk"},
+			alg:        jws.EdDSA,
+			embedJWK:   true,
+			tamper:     func(signed string) string { return signed },
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "jws", "-public", "other.pub"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"jwk of signature 1 does not match its public key\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Detached JWS with payload file": {
+			signArgs:   []string{"codechallenge", "-rsa", "-format", "jws", "-detached"},
+			alg:        jws.PS256,
+			tamper:     func(signed string) string { return signed },
+			verifyArgs: []string{"codechallenge", "-rsa", "-verify", "-format", "jws", "-payload", "hello.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Detached JWS without payload file": {
+			signArgs:   []string{"codechallenge", "-format", "jws", "-detached"},
+			alg:        jws.ES256,
+			tamper:     func(signed string) string { return signed },
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "jws"},
+			status:     3,
+			stdOutput:  testtools.NewStringStringMatcher(""),
+			stdErr:     testtools.NewStringStringMatcher("JWS payload is detached, which requires -payload\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Tampered payload": {
+			signArgs: []string{"codechallenge", "-format", "jws"},
+			alg:      jws.ES256,
+			tamper: func(signed string) string {
+				parts := strings.Split(signed, ".")
+				parts[1] = base64.RawURLEncoding.EncodeToString([]byte("Goodbye, World!"))
+				return strings.Join(parts, ".")
+			},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "jws"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Verified with the wrong key": {
+			signArgs:   []string{"codechallenge", "-format", "jws"},
+			alg:        jws.ES256,
+			tamper:     func(signed string) string { return signed },
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "jws", "-public", "other.pub"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"kid of signature 1 does not match its public key\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Not a JWS": {
+			signArgs:   []string{"codechallenge", "-format", "jws"},
+			alg:        jws.ES256,
+			tamper:     func(string) string { return "Hello, World!" },
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "jws"},
+			status:     2,
+			stdOutput:  testtools.NewStringStringMatcher(""),
+			stdErr:     testtools.NewRegexpStringMatcher(fmt.Sprintf("^JWS compact serialization has 1 parts, but 3 were expected%s$", regexp.QuoteMeta("\nUsage of codechallenge:"+UsageMessageBody))),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/hello.txt": testtools.StringPtr("Hello, World!"),
+			}
+			// An unrelated key-pair, to verify with:
+			testtools.AddOtherKeyPair(files, "/home/anybody")
+			signBundle := runMain(tt, &files, "Hello, World!", tc.signArgs[1:]...)
+			if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+			}
+			signed, err := jws.Parse(signBundle.OutBuf.String())
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing JWS: %s", err.Error())
+			}
+			if header := signed.Signatures[0].Header; header.Alg != tc.alg {
+				tt.Errorf("JWS algorithm should be %s. Got %s instead.", tc.alg, header.Alg)
+			} else if (header.JWK != nil) != tc.embedJWK {
+				tt.Errorf("JWS header should embed a JWK: %v", tc.embedJWK)
+			} else if header.Kid == "" {
+				tt.Errorf("JWS header should include a kid")
+			}
+			verifyBundle := runMain(tt, &files, tc.tamper(signBundle.OutBuf.String()), tc.verifyArgs[1:]...)
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if err := tc.stdErr.MatchString(verifyBundle.ErrBuf.String()); err != nil {
+				tt.Errorf("Standard Error:\n%#v didn't match:\n%s.", verifyBundle.ErrBuf.String(), err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package codechallenge
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/jwt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultJWTLifetime is how long a JWT is valid for, unless its expiration
+// time is given.
+const DefaultJWTLifetime = time.Hour
+
+// ClaimTime is a time claim given on the command line: either a duration
+// relative to the current time, or an absolute time.
+type ClaimTime struct {
+	Offset time.Duration
+	At     *time.Time
+}
+
+// ParseClaimTime parses a duration relative to now (such as 1h or -5m), an
+// RFC 3339 time, or a number of seconds since the Unix epoch.
+func ParseClaimTime(value string) (*ClaimTime, error) {
+	if offset, err := time.ParseDuration(value); err == nil {
+		return &ClaimTime{Offset: offset}, nil
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return &ClaimTime{At: &at}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		at := time.Unix(seconds, 0).UTC()
+		return &ClaimTime{At: &at}, nil
+	}
+	return nil, fmt.Errorf("Unrecognized time %#v: expected a duration relative to now (such as 1h or -5m), an RFC 3339 time or seconds since the Unix epoch", value)
+}
+
+// Time returns the claim time, relative to now.
+func (ct *ClaimTime) Time(now time.Time) time.Time {
+	if ct.At != nil {
+		return *ct.At
+	}
+	return now.Add(ct.Offset)
+}
+
+// Resolve returns the claim time as a NumericDate, relative to now.
+func (ct *ClaimTime) Resolve(now time.Time) *jwt.NumericDate {
+	return jwt.NewNumericDate(ct.Time(now))
+}
+
+// JWTSettings describes the claims of a JWT being issued, and how the claims
+// of a JWT being verified are checked. Issuer and Audience are required of a
+// JWT being verified, if given.
+type JWTSettings struct {
+	ClaimsPath string
+	Issuer     string
+	Subject    string
+	Audience   []string
+	ExpiresAt  *ClaimTime
+	NotBefore  *ClaimTime
+	IssuedAt   *ClaimTime
+	ID         string
+	Leeway     time.Duration
+}
+
+// NewJWTClaims returns the claims of a JWT to be issued. Claims given in
+// settings override those in the claims file, which override the defaults:
+// issued and valid from now, expiring after DefaultJWTLifetime, with a random
+// ID.
+func NewJWTClaims(d *deps.Dependencies, settings *JWTSettings) (*jwt.Claims, error) {
+	now := d.Time.Now()
+	result := &jwt.Claims{}
+	if settings.ClaimsPath != "" {
+		buff, err := d.Io.Ioutil.ReadFile(settings.ClaimsPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(buff, result); err != nil {
+			return nil, fmt.Errorf("File %s does not contain valid JWT claims: %s", settings.ClaimsPath, err.Error())
+		}
+	}
+	if settings.Issuer != "" {
+		result.Issuer = settings.Issuer
+	}
+	if settings.Subject != "" {
+		result.Subject = settings.Subject
+	}
+	if len(settings.Audience) > 0 {
+		result.Audience = jwt.Audience(settings.Audience)
+	}
+	if settings.IssuedAt != nil {
+		result.IssuedAt = settings.IssuedAt.Resolve(now)
+	} else if result.IssuedAt == nil {
+		result.IssuedAt = jwt.NewNumericDate(now)
+	}
+	if settings.NotBefore != nil {
+		result.NotBefore = settings.NotBefore.Resolve(now)
+	} else if result.NotBefore == nil {
+		result.NotBefore = jwt.NewNumericDate(now)
+	}
+	if settings.ExpiresAt != nil {
+		result.ExpiresAt = settings.ExpiresAt.Resolve(now)
+	} else if result.ExpiresAt == nil {
+		result.ExpiresAt = jwt.NewNumericDate(now.Add(DefaultJWTLifetime))
+	}
+	if settings.ID != "" {
+		result.ID = settings.ID
+	} else if result.ID == "" {
+		id := make([]byte, 16)
+		if _, err := io.ReadFull(d.Crypto.Rand.Reader, id); err != nil {
+			return nil, err
+		}
+		result.ID = base64.RawURLEncoding.EncodeToString(id)
+	}
+	return result, nil
+}
+
+// JWTMain is the entry-point for the jwt command. It writes a signed JWT of
+// the claims in config to d.Os.Stdout.
+func JWTMain(d *deps.Dependencies, config *RunConfig) {
+	claims, err := NewJWTClaims(d, &config.JWT)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	header, err := NewJWSHeader(cryptStuff, &config.Output)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	token, err := jwt.Sign(cryptStuff.Signer, d.Crypto.Rand.Reader, claims, header)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	signed, _, err := jwt.Parse(token)
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	valid, err := signed.Verify(signed.Signatures[0], cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	err = WriteOutput(d, []byte(token))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// JWTVerdict is the outcome of verifying a JWT, to be rendered to JSON. The
+// claims are only included if the signature is valid.
+type JWTVerdict struct {
+	*Verdict
+	Claims *jwt.Claims `json:"claims,omitempty"`
+}
+
+// VerifyJWTMain is the entry-point for the verify-jwt command. It reads a JWT
+// from d.Os.Stdin, and writes the verdict in JSON format to d.Os.Stdout,
+// exiting with the verdict's exit status if it isn't valid.
+func VerifyJWTMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyJWT(d, config, string(buff))
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyJWT checks the signature of token, and then its claims: its time
+// claims against d.Time.Now(), allowing for the leeway in config, and its
+// issuer and audience if config requires them.
+func VerifyJWT(d *deps.Dependencies, config *RunConfig, token string) (*JWTVerdict, error) {
+	signed, claims, err := jwt.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	verdict, err := VerifyJWS(d, config, signed)
+	if err != nil {
+		return nil, err
+	}
+	if !verdict.Valid {
+		return &JWTVerdict{Verdict: verdict}, nil
+	}
+	return &JWTVerdict{Verdict: ValidateClaims(d, &config.JWT, claims), Claims: claims}, nil
+}
+
+// ValidateClaims checks the time claims of a token against d.Time.Now(),
+// allowing for the leeway in settings, and its issuer and audience if
+// settings requires them.
+func ValidateClaims(d *deps.Dependencies, settings *JWTSettings, claims *jwt.Claims) *Verdict {
+	if err := claims.ValidateTimes(d.Time.Now(), settings.Leeway); err != nil {
+		return NewVerdict(InvalidClaims, err.Error())
+	}
+	if (settings.Issuer != "") && (claims.Issuer != settings.Issuer) {
+		return NewVerdict(InvalidClaims, fmt.Sprintf("token was issued by %#v, not %#v", claims.Issuer, settings.Issuer))
+	}
+	for _, aud := range settings.Audience {
+		if !claims.Audience.Contains(aud) {
+			return NewVerdict(InvalidClaims, fmt.Sprintf("token is not intended for %#v", aud))
+		}
+	}
+	return NewVerdict(SignatureValid, "")
+}
+
+// issuesToken returns true if config is of a command that issues a JWT, CWT or
+// PASETO token.
+func (config *RunConfig) issuesToken() bool {
+	return (config.Command == JWTCommand) || (config.Command == CWTCommand) || (config.Command == PASETOCommand)
+}
+
+// verifiesToken returns true if config is of a command that verifies a JWT,
+// CWT or PASETO token.
+func (config *RunConfig) verifiesToken() bool {
+	return (config.Command == VerifyJWTCommand) || (config.Command == VerifyCWTCommand) || (config.Command == VerifyPASETOCommand)
+}
+
+// parseJWTOptions validates the claim options of issued tokens, and the
+// issuer, audience and leeway of verified ones, in cl into config.
+func parseJWTOptions(config *RunConfig, cl *commandLine) error {
+	for _, jwtFlag := range []struct {
+		name  string
+		value string
+	}{
+		{name: "claims", value: *cl.claimsPath},
+		{name: "sub", value: *cl.subject},
+		{name: "exp", value: *cl.expiresAt},
+		{name: "nbf", value: *cl.notBefore},
+		{name: "iat", value: *cl.issuedAt},
+		{name: "jti", value: *cl.jwtID},
+	} {
+		if jwtFlag.value != "" {
+			if !config.issuesToken() {
+				return fmt.Errorf("Option -%s is only valid with the %s, %s and %s commands", jwtFlag.name, JWTCommand, CWTCommand, PASETOCommand)
+			}
+		}
+	}
+	config.JWT.ClaimsPath = *cl.claimsPath
+	config.JWT.Subject = *cl.subject
+	config.JWT.ID = *cl.jwtID
+	for _, claimTime := range []struct {
+		name  string
+		value string
+		dest  **ClaimTime
+	}{
+		{name: "exp", value: *cl.expiresAt, dest: &config.JWT.ExpiresAt},
+		{name: "nbf", value: *cl.notBefore, dest: &config.JWT.NotBefore},
+		{name: "iat", value: *cl.issuedAt, dest: &config.JWT.IssuedAt},
+	} {
+		if claimTime.value != "" {
+			parsed, err := ParseClaimTime(claimTime.value)
+			if err != nil {
+				return fmt.Errorf("Option -%s: %s", claimTime.name, err.Error())
+			}
+			*claimTime.dest = parsed
+		}
+	}
+	if (*cl.issuer != "") || (*cl.audience != "") {
+		if !config.issuesToken() && !config.verifiesToken() {
+			return fmt.Errorf("Options -iss and -aud are only valid with the %s, %s, %s, %s, %s and %s commands", JWTCommand, VerifyJWTCommand, CWTCommand, VerifyCWTCommand, PASETOCommand, VerifyPASETOCommand)
+		}
+		config.JWT.Issuer = *cl.issuer
+		if *cl.audience != "" {
+			config.JWT.Audience = strings.Split(*cl.audience, ",")
+		}
+	}
+	if *cl.leeway != 0 {
+		verifiesEnvelope := config.VerifyMode && (config.Output.Format == JSONOutput) && (config.Command == "")
+		if !config.verifiesToken() && !verifiesEnvelope {
+			return fmt.Errorf("Option -leeway is only valid with the %s, %s and %s commands, or when verifying JSON input", VerifyJWTCommand, VerifyCWTCommand, VerifyPASETOCommand)
+		}
+		if *cl.leeway < 0 {
+			return fmt.Errorf("Option -leeway must not be negative. Saw -leeway=%s", cl.leeway.String())
+		}
+		config.JWT.Leeway = *cl.leeway
+		config.Validity.Leeway = *cl.leeway
+	}
+	return nil
+}
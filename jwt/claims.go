@@ -0,0 +1,178 @@
+// Package jwt implements JSON Web Tokens, as defined by RFC 7519, signed as a
+// JWS in the compact serialization.
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// NumericDate is a JWT time: seconds since the Unix epoch, ignoring leap
+// seconds.
+type NumericDate int64
+
+// NewNumericDate returns the NumericDate of t, truncated to the second.
+func NewNumericDate(t time.Time) *NumericDate {
+	result := NumericDate(t.Unix())
+	return &result
+}
+
+// Time returns the NumericDate as a time.Time in UTC.
+func (nd NumericDate) Time() time.Time {
+	return time.Unix(int64(nd), 0).UTC()
+}
+
+// String returns the NumericDate in RFC 3339 format.
+func (nd NumericDate) String() string {
+	return nd.Time().Format(time.RFC3339)
+}
+
+// UnmarshalJSON decodes a NumericDate. RFC 7519 allows fractional seconds,
+// which are truncated.
+func (nd *NumericDate) UnmarshalJSON(buf []byte) error {
+	value, err := strconv.ParseFloat(string(buf), 64)
+	if err != nil {
+		return fmt.Errorf("JWT time %s is not a number", string(buf))
+	}
+	*nd = NumericDate(value)
+	return nil
+}
+
+// Audience lists the recipients a JWT is intended for. A single recipient is
+// encoded as a string, rather than an array.
+type Audience []string
+
+// Contains returns true if aud is one of the recipients.
+func (a Audience) Contains(aud string) bool {
+	for _, recipient := range a {
+		if recipient == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON encodes the Audience as a string if it has a single recipient,
+// or an array otherwise.
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON decodes an Audience from either a string or an array.
+func (a *Audience) UnmarshalJSON(buf []byte) error {
+	single := ""
+	if err := json.Unmarshal(buf, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	multiple := []string{}
+	if err := json.Unmarshal(buf, &multiple); err != nil {
+		return fmt.Errorf("JWT aud claim %s is neither a string nor an array of strings", string(buf))
+	}
+	*a = Audience(multiple)
+	return nil
+}
+
+// registeredClaims are the claims registered by RFC 7519, as encoded in JSON.
+type registeredClaims struct {
+	Issuer    string       `json:"iss,omitempty"`
+	Subject   string       `json:"sub,omitempty"`
+	Audience  Audience     `json:"aud,omitempty"`
+	ExpiresAt *NumericDate `json:"exp,omitempty"`
+	NotBefore *NumericDate `json:"nbf,omitempty"`
+	IssuedAt  *NumericDate `json:"iat,omitempty"`
+	ID        string       `json:"jti,omitempty"`
+}
+
+// registeredClaimNames are the JSON names of the registered claims.
+var registeredClaimNames = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+
+// Claims is the claims set of a JWT. Any claims other than those registered
+// by RFC 7519 are kept in Extra, and encoded along with them.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  Audience
+	ExpiresAt *NumericDate
+	NotBefore *NumericDate
+	IssuedAt  *NumericDate
+	ID        string
+	Extra     map[string]json.RawMessage
+}
+
+// MarshalJSON encodes the claims, with the registered claims first, followed
+// by any others in order of their names.
+func (c *Claims) MarshalJSON() ([]byte, error) {
+	buf, err := json.Marshal(&registeredClaims{
+		Issuer:    c.Issuer,
+		Subject:   c.Subject,
+		Audience:  c.Audience,
+		ExpiresAt: c.ExpiresAt,
+		NotBefore: c.NotBefore,
+		IssuedAt:  c.IssuedAt,
+		ID:        c.ID,
+	})
+	if err != nil || (len(c.Extra) == 0) {
+		return buf, err
+	}
+	// json.Marshal() sorts map keys.
+	extraBuf, err := json.Marshal(c.Extra)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(buf, []byte("{}")) {
+		return extraBuf, nil
+	}
+	return append(append(buf[:len(buf)-1], ','), extraBuf[1:]...), nil
+}
+
+// UnmarshalJSON decodes the claims, keeping any claims that aren't
+// registered in Extra.
+func (c *Claims) UnmarshalJSON(buf []byte) error {
+	registered := registeredClaims{}
+	if err := json.Unmarshal(buf, &registered); err != nil {
+		return err
+	}
+	extra := map[string]json.RawMessage{}
+	if err := json.Unmarshal(buf, &extra); err != nil {
+		return err
+	}
+	for _, name := range registeredClaimNames {
+		delete(extra, name)
+	}
+	if len(extra) == 0 {
+		extra = nil
+	}
+	*c = Claims{
+		Issuer:    registered.Issuer,
+		Subject:   registered.Subject,
+		Audience:  registered.Audience,
+		ExpiresAt: registered.ExpiresAt,
+		NotBefore: registered.NotBefore,
+		IssuedAt:  registered.IssuedAt,
+		ID:        registered.ID,
+		Extra:     extra,
+	}
+	return nil
+}
+
+// ValidateTimes checks the time claims against now, allowing for clock skew
+// of up to leeway. An error explains why the claims aren't valid.
+func (c *Claims) ValidateTimes(now time.Time, leeway time.Duration) error {
+	if (c.ExpiresAt != nil) && !now.Add(-leeway).Before(c.ExpiresAt.Time()) {
+		return fmt.Errorf("token expired at %s", c.ExpiresAt.String())
+	}
+	if (c.NotBefore != nil) && now.Add(leeway).Before(c.NotBefore.Time()) {
+		return fmt.Errorf("token is not valid before %s", c.NotBefore.String())
+	}
+	if (c.IssuedAt != nil) && now.Add(leeway).Before(c.IssuedAt.Time()) {
+		return fmt.Errorf("token was issued in the future, at %s", c.IssuedAt.String())
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package jwt
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/jws"
+	"io"
+	"strings"
+)
+
+// TokenType is the typ header parameter of a JWT.
+const TokenType = "JWT"
+
+// Sign returns a JWT of claims, signed by signer with the given protected
+// header, in the JWS compact serialization.
+func Sign(signer crypto.Signer, randReader io.Reader, claims *Claims, header *jws.Header) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	typedHeader := *header
+	typedHeader.Typ = TokenType
+	signed, err := jws.Sign(signer, randReader, payload, &typedHeader, false)
+	if err != nil {
+		return "", err
+	}
+	return signed.Compact()
+}
+
+// Parse parses a JWT, returning the JWS it is signed as along with its
+// claims. The signature is not verified.
+func Parse(token string) (*jws.JWS, *Claims, error) {
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, "{") {
+		return nil, nil, errors.New("JWT must use the JWS compact serialization")
+	}
+	signed, err := jws.Parse(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if signed.Detached {
+		return nil, nil, errors.New("JWT must not have a detached payload")
+	}
+	if typ := signed.Signatures[0].Header.Typ; (typ != "") && !strings.EqualFold(typ, TokenType) {
+		return nil, nil, fmt.Errorf("JWS type %#v is not a JWT", typ)
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(signed.Payload, claims); err != nil {
+		return nil, nil, fmt.Errorf("JWT claims are not valid: %s", err.Error())
+	}
+	return signed, claims, nil
+}
@@ -0,0 +1,161 @@
+package jwt_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"github.com/smartedge/codechallenge/jws"
+	"github.com/smartedge/codechallenge/jwt"
+	"github.com/smartedge/codechallenge/testtools"
+	"testing"
+	"time"
+)
+
+// TestClaimsJSON tests encoding and decoding claims, including claims that
+// aren't registered.
+func TestClaimsJSON(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		input    string
+		expected string
+		err      *testtools.ErrorSpec
+	}{
+		"Registered claims": {
+			input:    `{"jti":"1","iss":"me","aud":"you","exp":1567339200,"nbf":1567335600,"iat":1567335600,"sub":"them"}`,
+			expected: `{"iss":"me","sub":"them","aud":"you","exp":1567339200,"nbf":1567335600,"iat":1567335600,"jti":"1"}`,
+		},
+		"Multiple audiences": {
+			input:    `{"aud":["you","them"]}`,
+			expected: `{"aud":["you","them"]}`,
+		},
+		"Fractional time": {
+			input:    `{"exp":1567339200.75}`,
+			expected: `{"exp":1567339200}`,
+		},
+		"Unregistered claims": {
+			input:    `{"scope":"read","iss":"me","admin":false}`,
+			expected: `{"iss":"me","admin":false,"scope":"read"}`,
+		},
+		"Only unregistered claims": {
+			input:    `{"scope":"read"}`,
+			expected: `{"scope":"read"}`,
+		},
+		"Time that isn't a number": {
+			input: `{"exp":"tomorrow"}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "JWT time \"tomorrow\" is not a number"},
+		},
+		"Audience that isn't a string": {
+			input: `{"aud":7}`,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "JWT aud claim 7 is neither a string nor an array of strings"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			claims := &jwt.Claims{}
+			err := json.Unmarshal([]byte(tc.input), claims)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Fatal(err.Error())
+			}
+			if tc.err != nil {
+				return
+			}
+			actual, err := json.Marshal(claims)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if string(actual) != tc.expected {
+				tt.Errorf("Claims encoded as:\n%s when expecting:\n%s", string(actual), tc.expected)
+			}
+		})
+	}
+}
+
+// TestValidateTimes tests checking the time claims, with and without leeway.
+func TestValidateTimes(t *testing.T) {
+	issued := time.Date(2019, time.September, 1, 12, 0, 0, 0, time.UTC)
+	claims := &jwt.Claims{
+		IssuedAt:  jwt.NewNumericDate(issued),
+		NotBefore: jwt.NewNumericDate(issued.Add(time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(issued.Add(time.Hour)),
+	}
+	issuedOnly := &jwt.Claims{
+		IssuedAt: jwt.NewNumericDate(issued),
+	}
+	for desc, tc := range map[string]struct {
+		claims *jwt.Claims
+		now    time.Time
+		leeway time.Duration
+		err    *testtools.ErrorSpec
+	}{
+		"Valid": {
+			claims: claims,
+			now:    issued.Add(30 * time.Minute),
+		},
+		"Expired": {
+			claims: claims,
+			now:    issued.Add(time.Hour),
+			err:    &testtools.ErrorSpec{Type: "*errors.errorString", Message: "token expired at 2019-09-01T13:00:00Z"},
+		},
+		"Expired within leeway": {
+			claims: claims,
+			now:    issued.Add(time.Hour + 30*time.Second),
+			leeway: time.Minute,
+		},
+		"Not yet valid": {
+			claims: claims,
+			now:    issued.Add(30 * time.Second),
+			err:    &testtools.ErrorSpec{Type: "*errors.errorString", Message: "token is not valid before 2019-09-01T12:01:00Z"},
+		},
+		"Not yet valid within leeway": {
+			claims: claims,
+			now:    issued.Add(30 * time.Second),
+			leeway: time.Minute,
+		},
+		"Issued in the future": {
+			claims: issuedOnly,
+			now:    issued.Add(-2 * time.Minute),
+			leeway: 90 * time.Second,
+			err:    &testtools.ErrorSpec{Type: "*errors.errorString", Message: "token was issued in the future, at 2019-09-01T12:00:00Z"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			err := tc.claims.ValidateTimes(tc.now, tc.leeway)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
+
+// TestSignAndParse verifies that a signed JWT parses back to the same claims
+// and a valid signature.
+func TestSignAndParse(t *testing.T) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	claims := &jwt.Claims{
+		Issuer:   "me",
+		Audience: jwt.Audience{"you"},
+		Extra:    map[string]json.RawMessage{"scope": json.RawMessage(`"read"`)},
+	}
+	token, err := jwt.Sign(signer, rand.Reader, claims, &jws.Header{Alg: jws.ES256})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	signed, parsedClaims, err := jwt.Parse(token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if typ := signed.Signatures[0].Header.Typ; typ != jwt.TokenType {
+		t.Errorf("JWT typ should be %s. Got %s instead.", jwt.TokenType, typ)
+	}
+	if valid, err := signed.Verify(signed.Signatures[0], signer.Public()); !valid {
+		t.Errorf("JWT signature should be valid: %v", err)
+	}
+	expected, _ := json.Marshal(claims)
+	actual, _ := json.Marshal(parsedClaims)
+	if string(actual) != string(expected) {
+		t.Errorf("Parsed claims:\n%s when expecting:\n%s", string(actual), string(expected))
+	}
+}
@@ -0,0 +1,140 @@
+package codechallenge_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// TestIssueAndVerifyJWT verifies that JWTs issued by the jwt command are
+// accepted by the verify-jwt command until they expire, using the mock clock.
+func TestIssueAndVerifyJWT(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		issueArgs  []string
+		verifyArgs []string
+		verifyAt   time.Duration
+		status     int
+		stdOutput  testtools.StringMatcher
+		stdErr     testtools.StringMatcher
+	}{
+		"Default claims": {
+			issueArgs:  []string{"codechallenge", "jwt"},
+			verifyArgs: []string{"codechallenge", "verify-jwt"},
+			verifyAt:   30 * time.Minute,
+			status:     0,
+			stdOutput: testtools.NewRegexpStringMatcher("^" + regexp.QuoteMeta("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"claims\": {\n"+
+				"\"exp\": 1567342800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"") + "[-_0-9A-Za-z]{22}" + regexp.QuoteMeta("\"\n}\n}") + "$"),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Claims from flags and a file": {
+			issueArgs:  []string{"codechallenge", "jwt", "-claims", "claims.json", "-iss", "me", "-aud", "you,them", "-exp", "2h", "-jti", "1"},
+			verifyArgs: []string{"codechallenge", "verify-jwt", "-iss", "me", "-aud", "them"},
+			verifyAt:   90 * time.Minute,
+			status:     0,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"claims\": {\n" +
+				"\"iss\": \"me\",\n\"sub\": \"someone\",\n\"aud\": [\n\"you\",\n\"them\"\n],\n" +
+				"\"exp\": 1567346400,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\",\n\"scope\": \"read\"\n}\n}"),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Ed25519 key with absolute times": {
+			issueArgs:  []string{"codechallenge", "jwt", "-ed25519", "-jwk", "-nbf", "2019-09-01T13:00:00Z", "-exp", "1567353600", "-jti", "1"},
+			verifyArgs: []string{"codechallenge", "verify-jwt", "-ed25519"},
+			verifyAt:   2 * time.Hour,
+			status:     0,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"claims\": {\n" +
+				"\"exp\": 1567353600,\n\"nbf\": 1567342800,\n\"iat\": 1567339200,\n\"jti\": \"1\"\n}\n}"),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Expired": {
+			issueArgs:  []string{"codechallenge", "jwt", "-exp", "10m", "-jti", "1"},
+			verifyArgs: []string{"codechallenge", "verify-jwt"},
+			verifyAt:   11 * time.Minute,
+			status:     11,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"invalid claims\",\n\"detail\": \"token expired at 2019-09-01T12:10:00Z\",\n\"claims\": {\n" +
+				"\"exp\": 1567339800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\"\n}\n}"),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Expired within leeway": {
+			issueArgs:  []string{"codechallenge", "jwt", "-exp", "10m", "-jti", "1"},
+			verifyArgs: []string{"codechallenge", "verify-jwt", "-leeway", "2m"},
+			verifyAt:   11 * time.Minute,
+			status:     0,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"claims\": {\n" +
+				"\"exp\": 1567339800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\"\n}\n}"),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Wrong audience": {
+			issueArgs:  []string{"codechallenge", "jwt", "-aud", "you", "-jti", "1"},
+			verifyArgs: []string{"codechallenge", "verify-jwt", "-aud", "them"},
+			status:     11,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"invalid claims\",\n\"detail\": \"token is not intended for \\\"them\\\"\",\n\"claims\": {\n" +
+				"\"aud\": \"you\",\n\"exp\": 1567342800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\"\n}\n}"),
+			stdErr: testtools.NewStringStringMatcher(""),
+		},
+		"Embedded JWK of another key": {
+			issueArgs:  []string{"codechallenge", "jwt", "-ed25519", "-jwk", "-iss", "admin"},
+			verifyArgs: []string{"codechallenge", "verify-jwt", "-iss", "admin"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"jwk of signature 1 does not match its public key\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Verified with the wrong key": {
+			issueArgs:  []string{"codechallenge", "jwt", "-rsa"},
+			verifyArgs: []string{"codechallenge", "verify-jwt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"kid of signature 1 does not match its public key\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/claims.json": testtools.StringPtr("{\"sub\": \"someone\", \"iss\": \"not me\", \"scope\": \"read\"}"),
+			}
+			// Generate the default key-pair, in case the JWT is issued with
+			// another:
+			defaultBundle := mocks.NewDefaultMockDeps("Hello, World!", []string{"codechallenge"}, "/home/anybody", &files)
+			err := defaultBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(defaultBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling defaultBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			issueBundle := mocks.NewDefaultMockDeps("", tc.issueArgs, "/home/anybody", &files)
+			err = issueBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(issueBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling issueBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := issueBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Issuing failed with exit status %d:\n%s", exitStatus, issueBundle.ErrBuf.String())
+			}
+			verifyBundle := mocks.NewDefaultMockDeps(issueBundle.OutBuf.String(), tc.verifyArgs, "/home/anybody", &files)
+			verifyBundle.Deps.Time.Now = func() time.Time {
+				return mocks.MockCurrentTime.Add(tc.verifyAt)
+			}
+			err = verifyBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(verifyBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Errorf("Unexpected error calling verifyBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if err := tc.stdErr.MatchString(verifyBundle.ErrBuf.String()); err != nil {
+				tt.Errorf("Standard Error:\n%#v didn't match:\n%s.", verifyBundle.ErrBuf.String(), err.Error())
+			}
+		})
+	}
+}
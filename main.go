@@ -3,6 +3,8 @@
 package codechallenge
 
 import (
+	"crypto"
+	"encoding/base64"
 	"errors"
 	"flag"
 	"fmt"
@@ -37,10 +39,142 @@ func RealMain(d *deps.Dependencies) {
 		flag.CommandLine.Usage()
 		d.Os.Exit(0)
 	}
-	message, err := InjestMessage(d.Os.Stdin, config.Format)
+	switch config.Command {
+	case SignFileCommand:
+		SignFilesMain(d, config)
+		return
+	case VerifyFileCommand:
+		VerifyFilesMain(d, config)
+		return
+	case SignManifestCommand:
+		SignManifestMain(d, config)
+		return
+	case VerifyManifestCommand:
+		VerifyManifestMain(d, config)
+		return
+	case JWTCommand:
+		JWTMain(d, config)
+		return
+	case VerifyJWTCommand:
+		VerifyJWTMain(d, config)
+		return
+	case CWTCommand:
+		CWTMain(d, config)
+		return
+	case VerifyCWTCommand:
+		VerifyCWTMain(d, config)
+		return
+	case PASETOCommand:
+		PASETOMain(d, config)
+		return
+	case VerifyPASETOCommand:
+		VerifyPASETOMain(d, config)
+		return
+	case ExportPGPKeyCommand:
+		ExportPGPKeyMain(d, config)
+		return
+	case ExportSSHKeyCommand:
+		ExportSSHKeyMain(d, config)
+		return
+	case ExportMinisignKeyCommand:
+		ExportMinisignKeyMain(d, config)
+		return
+	case AttestCommand:
+		AttestMain(d, config)
+		return
+	case SignHTTPCommand:
+		SignHTTPMain(d, config)
+		return
+	case VerifyHTTPCommand:
+		VerifyHTTPMain(d, config)
+		return
+	case DKIMCommand:
+		DKIMMain(d, config)
+		return
+	case VerifyDKIMCommand:
+		VerifyDKIMMain(d, config)
+		return
+	case ExportDKIMRecordCommand:
+		ExportDKIMRecordMain(d, config)
+		return
+	case CertSelfSignCommand:
+		CertSelfSignMain(d, config)
+		return
+	case CSRCommand:
+		CSRMain(d, config)
+		return
+	case CAInitCommand:
+		CAInitMain(d, config)
+		return
+	case CAIssueCommand:
+		CAIssueMain(d, config)
+		return
+	case CARevokeCommand:
+		CARevokeMain(d, config)
+		return
+	case CACRLCommand:
+		CACRLMain(d, config)
+		return
+	case TSAServerCommand:
+		TSAServerMain(d, config)
+		return
+	case AddSignatureCommand:
+		AddSignatureMain(d, config)
+		return
+	}
+	if config.VerifyMode {
+		if config.Output.Format.IsJWS() {
+			VerifyJWSMain(d, config)
+			return
+		}
+		if config.Output.Format.IsCOSE() {
+			VerifyCOSEMain(d, config)
+			return
+		}
+		if config.Output.Format.IsCMS() {
+			VerifyCMSMain(d, config)
+			return
+		}
+		if config.Output.Format.IsPGP() {
+			VerifyPGPMain(d, config)
+			return
+		}
+		if config.Output.Format.IsSSHSig() {
+			VerifySSHSigMain(d, config)
+			return
+		}
+		if config.Output.Format.IsMinisign() {
+			VerifyMinisignMain(d, config)
+			return
+		}
+		if config.Output.Format.IsDSSE() {
+			VerifyDSSEMain(d, config)
+			return
+		}
+		VerifyMain(d, config)
+		return
+	}
+	if config.DSSE.AddSignature {
+		AddDSSESignatureMain(d, config)
+		return
+	}
+	hash := config.PubKeySettings.GetHash()
+	var message string
+	var digest crypt.DigestHash
+	if config.DigestMode {
+		digest, err = InjestDigest(d.Os.Stdin, hash)
+		message = digest.Hex()
+	} else {
+		message, err = InjestMessage(d.Os.Stdin, &config.Input)
+		digest = crypt.NewDigestHash(hash, message)
+	}
 	if err != nil {
 		HandleError(d, err, 2)
 	}
+	if len(config.MultiSig.PrivateKeyPaths) != 0 {
+		SignMultiSigMain(d, config, message, digest)
+		return
+	}
 	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
 	if err != nil {
 		HandleError(d, err, 3)
@@ -49,45 +183,130 @@ func RealMain(d *deps.Dependencies) {
 	if err != nil {
 		HandleError(d, err, 4)
 	}
-	binSig, err := cryptStuff.SignMessage(message)
+	if config.Output.Format.IsJWS() {
+		SignJWSMain(d, config, cryptStuff, message)
+		return
+	}
+	if config.Output.Format.IsCOSE() {
+		SignCOSEMain(d, config, cryptStuff, message)
+		return
+	}
+	if config.Output.Format.IsCMS() {
+		SignCMSMain(d, config, cryptStuff, message)
+		return
+	}
+	if config.Output.Format.IsPGP() {
+		SignPGPMain(d, config, cryptStuff, message)
+		return
+	}
+	if config.Output.Format.IsSSHSig() {
+		SignSSHSigMain(d, config, cryptStuff, message)
+		return
+	}
+	if config.Output.Format.IsMinisign() {
+		SignMinisignMain(d, config, cryptStuff, message)
+		return
+	}
+	if config.Output.Format.IsDSSE() {
+		SignDSSEMain(d, config, cryptStuff, message)
+		return
+	}
+	response := &SignedMessage{
+		Message:       message,
+		Pubkey:        cryptStuff.PubKey.String(),
+		Encoding:      config.Input.Encoding,
+		Normalization: config.Input.Normalization.String(),
+		Digest:        config.DigestMode,
+	}
+	if config.Output.Envelope == EnvelopeV2 {
+		digest, err = SealEnvelope(d, config, cryptStuff.Signer.Public(), response)
+		if err != nil {
+			HandleError(d, err, 5)
+		}
+	}
+	binSig, err := cryptStuff.Sign(digest)
 	if err != nil {
 		HandleError(d, err, 5)
 	}
 	// Verify with a round trip:
-	valid, err := cryptStuff.VerifySignedMessage(message, binSig.Base64(), cryptStuff.PubKey.String())
+	valid, err := cryptStuff.VerifySignedDigest(digest, binSig.Base64(), cryptStuff.PubKey.String())
 	if err != nil {
 		HandleError(d, err, 6)
 	}
 	if !valid {
 		HandleError(d, errors.New("round trip verification of signature failed"), 7)
 	}
-	err = GenerateResponse(d, message, binSig, cryptStuff.PubKey)
+	response.Signature = binSig.Base64()
+	if config.Output.CertPath != "" {
+		response.Pubkey, err = loadSigningCertificate(d, config.Output.CertPath, cryptStuff)
+		if err != nil {
+			HandleError(d, err, 4)
+		}
+	}
+	if config.DigestMode || (hash != crypto.SHA256) {
+		response.Hash = crypt.HashName(hash)
+	}
+	if config.Timestamp.URL != "" {
+		token, err := RequestTimestamp(d, config.Timestamp.URL, &config.PubKeySettings, binSig)
+		if err != nil {
+			HandleError(d, err, 5)
+		}
+		response.Timestamp = base64.StdEncoding.EncodeToString(token)
+	}
+	err = GenerateResponse(d, response)
 	if err != nil {
 		HandleError(d, err, 8)
 	}
 }
 
+// InjestDigest reads a hex or base64 encoded digest from dataSource, ignoring
+// surrounding whitespace. Returns an error if it isn't the length of a digest
+// produced by hash.
+func InjestDigest(dataSource io.Reader, hash crypto.Hash) (crypt.DigestHash, error) {
+	buff, err := ioutil.ReadAll(dataSource)
+	if err != nil {
+		return nil, err
+	}
+	return crypt.NewDigestHashFromString(strings.TrimSpace(string(buff)), hash)
+}
+
 // InjestMessage reads all data from dataSource, removing any trailing
 // whitespace. Returns an error if the content is longer than 250 characters.
 // Input is allowed to be ASCII, Binary or UTF-8: ASCII and Binary data have a
-// 250 byte limit, while UTF-8 has a 250 character limit with up to 4 bytes per
-// character. ASCII and UTF-8 inputs are both trimmed of trailing whitespace.
-func InjestMessage(dataSource io.Reader, format ContentFormat) (string, error) {
+// 250 byte limit, while UTF-8 has a 250 character limit, counted in grapheme
+// clusters (user-perceived characters) rather than code points. Input in
+// another character set is first transcoded to UTF-8 if an encoding is
+// specified, and UTF-8 input is converted to the requested normalization form
+// before the limit is applied. ASCII input must be strictly 7-bit. ASCII and
+// UTF-8 inputs are both trimmed of trailing whitespace.
+func InjestMessage(dataSource io.Reader, settings *InputSettings) (string, error) {
 	buff, err := ioutil.ReadAll(dataSource)
 	if err != nil {
 		return "", err
 	}
+	if settings.Encoding != "" {
+		buff, err = TranscodeToUTF8(buff, settings.Encoding)
+		if err != nil {
+			return "", err
+		}
+	}
 	msg := string(buff)
 	// format is meaningless for an empty string
 	if msg == "" {
 		return "", nil
 	}
-	switch format {
+	switch settings.Format {
 	case ASCII, Binary:
-		// ASCII is technically only bytes < 127, but related character sets
-		// use bytes > 128, so the only difference between ASCII and Binary
-		// is the trimming of trailing of trailing whitespace:
-		if format == ASCII {
+		// ASCII is strictly 7-bit. Text in related 8-bit character sets must
+		// be transcoded with -encoding instead. Other than that, the only
+		// difference between ASCII and Binary is the trimming of trailing
+		// whitespace:
+		if settings.Format == ASCII {
+			for i := 0; i < len(msg); i++ {
+				if msg[i] > unicode.MaxASCII {
+					return "", fmt.Errorf("Input contains a non-ASCII byte (0x%02x) at offset %d:\n%#v", msg[i], i, msg)
+				}
+			}
 			msg = strings.TrimRightFunc(msg, unicode.IsSpace)
 		}
 		if len(msg) > 250 {
@@ -98,12 +317,13 @@ func InjestMessage(dataSource io.Reader, format ContentFormat) (string, error) {
 		if !utf8.ValidString(msg) {
 			return "", fmt.Errorf("Input contains invalid UTF-8 character(s):\n%#v", msg)
 		}
+		msg = settings.Normalization.Apply(msg)
 		msg = misc.TrimRightUTF8Func(msg, unicode.IsSpace)
-		charCount := utf8.RuneCountInString(msg)
+		charCount := misc.GraphemeClusterCount(msg)
 		if charCount > 250 {
-			return "", fmt.Errorf("Input contains more than 250 UTF-8 characters:\n%#v", msg)
+			return "", fmt.Errorf("Input contains more than 250 UTF-8 characters (exactly %d):\n%#v", charCount, msg)
 		}
 		return msg, nil
 	}
-	return "", fmt.Errorf("INTERNAL ERROR: Unrecognized content format: %#v", format)
+	return "", fmt.Errorf("INTERNAL ERROR: Unrecognized content format: %#v", settings.Format)
 }
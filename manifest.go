@@ -0,0 +1,280 @@
+package codechallenge
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ManifestEntry describes a single file in a directory manifest. Path is
+// relative to the directory, with forward slashes as separators.
+type ManifestEntry struct {
+	Path   string
+	Size   int64
+	Mode   os.FileMode
+	Digest crypt.DigestHash
+}
+
+// String returns the canonical representation of the entry: its SHA-256
+// digest in hex, size, permission bits in octal and quoted path, separated by
+// spaces.
+func (me ManifestEntry) String() string {
+	return fmt.Sprintf("%s %d %04o %s", me.Digest.Hex(), me.Size, me.Mode.Perm(), strconv.Quote(me.Path))
+}
+
+// Manifest lists every file in a directory, sorted by path.
+type Manifest []ManifestEntry
+
+// String returns the canonical representation of the manifest, with one line
+// per entry. This is what is signed.
+func (m Manifest) String() string {
+	var result strings.Builder
+	for _, entry := range m {
+		result.WriteString(entry.String())
+		result.WriteString("\n")
+	}
+	return result.String()
+}
+
+// NewManifest walks the directory dir, and returns a Manifest of every
+// regular file within it. Anything other than a regular file or a directory
+// is reported as an error.
+func NewManifest(d *deps.Dependencies, dir string) (Manifest, error) {
+	info, err := d.Os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	result := Manifest{}
+	err = d.Path.FilePath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("Manifest can't include %s, which is not a regular file or directory", path)
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		digest, err := HashFile(d, path, crypto.SHA256)
+		if err != nil {
+			return err
+		}
+		result = append(result, ManifestEntry{
+			Path:   filepath.ToSlash(relPath),
+			Size:   info.Size(),
+			Mode:   info.Mode().Perm(),
+			Digest: digest,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// ParseManifest parses the canonical representation of a Manifest.
+func ParseManifest(text string) (Manifest, error) {
+	result := Manifest{}
+	if !strings.HasSuffix(text, "\n") {
+		if text != "" {
+			return nil, errors.New("Manifest must end with a newline")
+		}
+		return result, nil
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("Manifest line %d is malformed: %#v", i+1, line)
+		}
+		digest, err := crypt.NewDigestHashFromString(fields[0], crypto.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("Manifest line %d is malformed: %s", i+1, err.Error())
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Manifest line %d is malformed: %s", i+1, err.Error())
+		}
+		mode, err := strconv.ParseUint(fields[2], 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Manifest line %d is malformed: %s", i+1, err.Error())
+		}
+		path, err := strconv.Unquote(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("Manifest line %d is malformed: %s", i+1, err.Error())
+		}
+		entry := ManifestEntry{
+			Path:   path,
+			Size:   size,
+			Mode:   os.FileMode(mode),
+			Digest: digest,
+		}
+		if entry.String() != line {
+			return nil, fmt.Errorf("Manifest line %d is not in canonical form: %#v", i+1, line)
+		}
+		if (len(result) > 0) && (result[len(result)-1].Path >= path) {
+			return nil, fmt.Errorf("Manifest line %d is out of order: %#v", i+1, line)
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// ManifestDifferences lists the paths of files that differ between a
+// directory and its manifest.
+type ManifestDifferences struct {
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+}
+
+// Any returns true if there are any differences.
+func (md *ManifestDifferences) Any() bool {
+	return (len(md.Added) + len(md.Removed) + len(md.Modified)) > 0
+}
+
+// CompareManifests returns the files added, removed and modified in actual,
+// relative to expected.
+func CompareManifests(expected Manifest, actual Manifest) *ManifestDifferences {
+	result := &ManifestDifferences{}
+	i, j := 0, 0
+	for (i < len(expected)) || (j < len(actual)) {
+		switch {
+		case j == len(actual) || ((i < len(expected)) && (expected[i].Path < actual[j].Path)):
+			result.Removed = append(result.Removed, expected[i].Path)
+			i++
+		case i == len(expected) || (actual[j].Path < expected[i].Path):
+			result.Added = append(result.Added, actual[j].Path)
+			j++
+		default:
+			if expected[i].String() != actual[j].String() {
+				result.Modified = append(result.Modified, actual[j].Path)
+			}
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// ManifestVerdict is the outcome of verifying a directory against a signed
+// manifest, to be rendered to JSON.
+type ManifestVerdict struct {
+	*Verdict
+	*ManifestDifferences
+}
+
+// SignManifestMain is the entry-point for the sign-manifest command. It
+// writes a signed manifest of the directory in config.Paths in JSON format to
+// d.Os.Stdout.
+func SignManifestMain(d *deps.Dependencies, config *RunConfig) {
+	manifest, err := NewManifest(d, config.Paths[0])
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	hash := config.PubKeySettings.GetHash()
+	digest := crypt.NewDigestHash(hash, manifest.String())
+	binSig, err := cryptStuff.Sign(digest)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	valid, err := cryptStuff.VerifySignedDigest(digest, binSig.Base64(), cryptStuff.PubKey.String())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	err = WriteJSON(d, &SignedMessage{
+		Message:   manifest.String(),
+		Signature: binSig.Base64(),
+		Pubkey:    cryptStuff.PubKey.String(),
+		Hash:      crypt.HashName(hash),
+		Manifest:  true,
+	})
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// VerifyManifestMain is the entry-point for the verify-manifest command. It
+// reads a signed manifest in JSON format from d.Os.Stdin, checks the
+// directory in config.Paths against it, and writes the verdict in JSON format
+// to d.Os.Stdout, exiting with the verdict's exit status if it isn't valid.
+func VerifyManifestMain(d *deps.Dependencies, config *RunConfig) {
+	doc, err := InjestSignedMessage(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyManifest(d, config, doc)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyManifest checks the signature of the manifest in doc, which must be
+// by the public key file in config, and then checks the directory in
+// config.Paths against it. The contents of a manifest are only compared if
+// its signature is valid.
+func VerifyManifest(d *deps.Dependencies, config *RunConfig, doc *SignedMessage) (*ManifestVerdict, error) {
+	if !doc.Manifest {
+		return &ManifestVerdict{Verdict: NewVerdict(ContentMismatch, "signed message is not a manifest")}, nil
+	}
+	verdict, err := VerifySignedMessageDocument(d, config, doc)
+	if err != nil {
+		return nil, err
+	}
+	verdict, err = CheckSignedMessageKey(d, config, doc, verdict)
+	if err != nil {
+		return nil, err
+	}
+	if !verdict.Valid {
+		return &ManifestVerdict{Verdict: verdict}, nil
+	}
+	expected, err := ParseManifest(doc.Message)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := NewManifest(d, config.Paths[0])
+	if err != nil {
+		return nil, err
+	}
+	differences := CompareManifests(expected, actual)
+	if differences.Any() {
+		verdict = NewVerdict(ContentMismatch, "directory does not match the manifest")
+	}
+	return &ManifestVerdict{Verdict: verdict, ManifestDifferences: differences}, nil
+}
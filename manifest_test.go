@@ -0,0 +1,204 @@
+package codechallenge_test
+
+import (
+	"crypto"
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseManifest tests parsing the canonical form of manifests.
+func TestParseManifest(t *testing.T) {
+	emptyDigest := crypt.NewDigestHash(crypto.SHA256, "")
+	for desc, tc := range map[string]struct {
+		text     string
+		expected codechallenge.Manifest
+		err      *testtools.ErrorSpec
+	}{
+		"empty manifest": {
+			text:     "",
+			expected: codechallenge.Manifest{},
+		},
+		"two files": {
+			text: emptyDigest.Hex() + " 0 0644 \"a file\"\n" +
+				HelloWorldSHA256Hex + " 14 0755 \"sub/dir/\\\"quoted\\\"\"\n",
+			expected: codechallenge.Manifest{
+				{Path: "a file", Size: 0, Mode: 0644, Digest: emptyDigest},
+				{Path: "sub/dir/\"quoted\"", Size: 14, Mode: 0755, Digest: crypt.NewDigestHash(crypto.SHA256, "Hello, World!\n")},
+			},
+		},
+		"missing trailing newline": {
+			text: emptyDigest.Hex() + " 0 0644 \"a\"",
+			err:  &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Manifest must end with a newline"},
+		},
+		"missing field": {
+			text: emptyDigest.Hex() + " 0 \"a\"\n",
+			err:  &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Manifest line 1 is malformed: \"" + emptyDigest.Hex() + " 0 \\\"a\\\"\""},
+		},
+		"upper case digest": {
+			text: strings.ToUpper(emptyDigest.Hex()) + " 0 0644 \"a\"\n",
+			err:  &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Manifest line 1 is not in canonical form: \"" + strings.ToUpper(emptyDigest.Hex()) + " 0 0644 \\\"a\\\"\""},
+		},
+		"out of order": {
+			text: emptyDigest.Hex() + " 0 0644 \"b\"\n" + emptyDigest.Hex() + " 0 0644 \"a\"\n",
+			err:  &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Manifest line 2 is out of order: \"" + emptyDigest.Hex() + " 0 0644 \\\"a\\\"\""},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			manifest, err := codechallenge.ParseManifest(tc.text)
+			if err2 := tc.err.EnsureMatches(err); err2 != nil {
+				tt.Error(err2.Error())
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(manifest, tc.expected) {
+				tt.Errorf("ParseManifest(%#v) returned %#v when %#v was expected", tc.text, manifest, tc.expected)
+			}
+			if actual := manifest.String(); actual != tc.text {
+				tt.Errorf("Manifest.String() returned %#v when %#v was expected", actual, tc.text)
+			}
+		})
+	}
+}
+
+// TestCompareManifests tests finding the differences between manifests.
+func TestCompareManifests(t *testing.T) {
+	entry := func(path string, content string, mode os.FileMode) codechallenge.ManifestEntry {
+		return codechallenge.ManifestEntry{Path: path, Size: int64(len(content)), Mode: mode, Digest: crypt.NewDigestHash(crypto.SHA256, content)}
+	}
+	expected := codechallenge.Manifest{
+		entry("a", "a", 0644),
+		entry("b", "b", 0644),
+		entry("c", "c", 0644),
+		entry("e", "e", 0644),
+	}
+	actual := codechallenge.Manifest{
+		entry("b", "B", 0644),
+		entry("c", "c", 0755),
+		entry("d", "d", 0644),
+		entry("e", "e", 0644),
+		entry("f", "f", 0644),
+	}
+	differences := codechallenge.CompareManifests(expected, actual)
+	if !reflect.DeepEqual(differences, &codechallenge.ManifestDifferences{
+		Added:    []string{"d", "f"},
+		Removed:  []string{"a"},
+		Modified: []string{"b", "c"},
+	}) {
+		t.Errorf("CompareManifests() returned %#v", differences)
+	}
+	if differences := codechallenge.CompareManifests(expected, expected); differences.Any() {
+		t.Errorf("CompareManifests() found differences between identical manifests: %#v", differences)
+	}
+}
+
+// TestSignAndVerifyManifest verifies that the sign-manifest command writes a
+// signed manifest that the verify-manifest command accepts, and that changes
+// to the directory are reported.
+func TestSignAndVerifyManifest(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		tamper     func(testtools.FakeFileSystem)
+		verifyArgs []string
+		status     int
+		stdOutput  string
+	}{
+		"Untouched directory": {
+			tamper:    func(testtools.FakeFileSystem) {},
+			status:    0,
+			stdOutput: "{\n\"valid\": true,\n\"reason\": \"valid\"\n}",
+		},
+		"Added, removed and modified files": {
+			tamper: func(files testtools.FakeFileSystem) {
+				files["/release/new.txt"] = testtools.StringPtr("new")
+				delete(files, "/release/docs/empty.txt")
+				files["/release/hello.txt"] = testtools.StringPtr("Goodbye, World!\n")
+			},
+			status: 10,
+			stdOutput: "{\n\"valid\": false,\n\"reason\": \"signed content mismatch\",\n" +
+				"\"detail\": \"directory does not match the manifest\",\n" +
+				"\"added\": [\n\"new.txt\"\n],\n" +
+				"\"removed\": [\n\"docs/empty.txt\"\n],\n" +
+				"\"modified\": [\n\"hello.txt\"\n]\n}",
+		},
+		"Manifest signed by another key": {
+			tamper:     func(testtools.FakeFileSystem) {},
+			verifyArgs: []string{"-public", "other.pub"},
+			status:     9,
+			stdOutput:  "{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"Signed message is not signed by the public key in other.pub\"\n}",
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/release/hello.txt":      testtools.StringPtr("Hello, World!\n"),
+				"/release/docs/empty.txt": testtools.StringPtr(""),
+			}
+			// An unrelated key-pair, to verify with:
+			testtools.AddOtherKeyPair(files, "/home/anybody")
+			signBundle := mocks.NewDefaultMockDeps("", []string{"codechallenge", "sign-manifest", "/release"}, "/home/anybody", &files)
+			err := signBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(signBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling signBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+			}
+			doc, err := codechallenge.InjestSignedMessage(strings.NewReader(signBundle.OutBuf.String()))
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing signed manifest: %s", err.Error())
+			}
+			expectedManifest := crypt.NewDigestHash(crypto.SHA256, "").Hex() + " 0 0644 \"docs/empty.txt\"\n" +
+				HelloWorldSHA256Hex + " 14 0644 \"hello.txt\"\n"
+			if doc.Message != expectedManifest {
+				tt.Errorf("Signed manifest was %#v when %#v was expected", doc.Message, expectedManifest)
+			}
+			tc.tamper(files)
+			verifyBundle := mocks.NewDefaultMockDeps(signBundle.OutBuf.String(), append(append([]string{"codechallenge", "verify-manifest"}, tc.verifyArgs...), "/release"), "/home/anybody", &files)
+			err = verifyBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(verifyBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Errorf("Unexpected error calling verifyBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if actual := verifyBundle.OutBuf.String(); actual != tc.stdOutput {
+				tt.Errorf("Standard Output:\n%#v when expecting:\n%#v", actual, tc.stdOutput)
+			}
+			if actual := verifyBundle.ErrBuf.String(); actual != "" {
+				tt.Errorf("Unexpected Standard Error:\n%#v", actual)
+			}
+		})
+	}
+}
+
+// TestVerifyManifestAsMessage verifies that -verify rejects signed manifests,
+// which are only valid against the directory they list.
+func TestVerifyManifestAsMessage(t *testing.T) {
+	files := testtools.FakeFileSystem{
+		"/release/hello.txt": testtools.StringPtr("Hello, World!\n"),
+	}
+	signBundle := runMain(t, &files, "", "sign-manifest", "/release")
+	if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+		t.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+	}
+	verifyBundle := runMain(t, &files, signBundle.OutBuf.String(), "-verify")
+	if exitStatus := verifyBundle.GetExitStatus(); exitStatus != 10 {
+		t.Errorf("RealMain() should have an exit status of 10. Got %#v instead.", exitStatus)
+	}
+	expected := "{\n\"valid\": false,\n\"reason\": \"signed content mismatch\",\n\"detail\": \"signed message is a manifest, which requires verify-manifest\"\n}"
+	if actual := verifyBundle.OutBuf.String(); actual != expected {
+		t.Errorf("Standard Output:\n%#v when expecting:\n%#v", actual, expected)
+	}
+}
@@ -0,0 +1,166 @@
+package codechallenge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/minisign"
+	"io/ioutil"
+	"strings"
+)
+
+// MinisignSettings describes the trusted comment of a minisign signature, and
+// whether it signs the message itself, rather than its hash.
+type MinisignSettings struct {
+	TrustedComment string
+	Legacy         bool
+}
+
+// MinisignVerdict is the outcome of verifying a minisign signature, to be
+// rendered to JSON. The trusted comment is only included if the signature is
+// valid.
+type MinisignVerdict struct {
+	*Verdict
+	TrustedComment string `json:"trustedComment,omitempty"`
+}
+
+// loadMinisignPublicKey reads the public key in filename, which may be a
+// minisign or signify public key file, or a PEM encoded Ed25519 key.
+func loadMinisignPublicKey(d *deps.Dependencies, filename string) (*minisign.PublicKey, error) {
+	buff, err := d.Io.Ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(buff, []byte("-----BEGIN ")) {
+		return minisign.ParsePublicKey(string(buff))
+	}
+	publicKey, err := loadPublicKey(d, filename)
+	if err != nil {
+		return nil, err
+	}
+	return minisign.NewPublicKey(publicKey)
+}
+
+// ExportMinisignKeyMain is the entry-point for the export-minisign-key
+// command. It writes the public key to d.Os.Stdout as a minisign public key
+// file.
+func ExportMinisignKeyMain(d *deps.Dependencies, config *RunConfig) {
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	key, err := minisign.NewPublicKey(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	err = WriteOutput(d, key.Marshal())
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// SignMinisignMain signs message with the keys in cryptStuff, and writes the
+// minisign signature to d.Os.Stdout. Unless config gives one, the trusted
+// comment is the current time, as minisign's is.
+func SignMinisignMain(d *deps.Dependencies, config *RunConfig, cryptStuff *crypt.CryptoTooling, message string) {
+	trustedComment := config.Minisign.TrustedComment
+	if trustedComment == "" {
+		trustedComment = fmt.Sprintf("timestamp:%d", d.Time.Now().Unix())
+		if !config.Minisign.Legacy {
+			trustedComment += "\thashed"
+		}
+	}
+	buff, err := minisign.Sign(cryptStuff.Signer, []byte(message), !config.Minisign.Legacy, trustedComment)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	sig, err := minisign.Parse(string(buff))
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	key, err := minisign.NewPublicKey(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	valid, err := sig.Verify(key, []byte(message))
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	err = WriteOutput(d, buff)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// VerifyMinisignMain is the entry-point for -verify mode with minisign input.
+// It reads a minisign or signify signature of the payload file in config from
+// d.Os.Stdin, and writes the verdict in JSON format to d.Os.Stdout, exiting
+// with the verdict's exit status if it isn't valid.
+func VerifyMinisignMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	sig, err := minisign.Parse(string(buff))
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyMinisign(d, config, sig)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyMinisign checks sig of the payload file in config against the public
+// key file in config, which may be a minisign public key file.
+func VerifyMinisign(d *deps.Dependencies, config *RunConfig, sig *minisign.Signature) (*MinisignVerdict, error) {
+	if config.Output.PayloadPath == "" {
+		return nil, errors.New("Minisign signatures are detached, which requires -payload")
+	}
+	payload, err := d.Io.Ioutil.ReadFile(config.Output.PayloadPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadMinisignPublicKey(d, config.PubKeySettings.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	result := &MinisignVerdict{Verdict: newVerdictFromVerification(sig.Verify(key, payload))}
+	if result.Valid {
+		result.TrustedComment = sig.TrustedComment
+	}
+	return result, nil
+}
+
+// parseMinisignOptions validates the minisign trusted comment and legacy
+// options in cl into config.
+func parseMinisignOptions(config *RunConfig, cl *commandLine) error {
+	if (*cl.trustedComment != "") || *cl.legacy {
+		if !config.Output.Format.IsMinisign() || config.VerifyMode {
+			return errors.New("Options -trusted-comment and -legacy are only valid when signing minisign signatures")
+		}
+		if strings.ContainsAny(*cl.trustedComment, "\r\n") {
+			return errors.New("Option -trusted-comment must be a single line")
+		}
+		config.Minisign.TrustedComment = *cl.trustedComment
+		config.Minisign.Legacy = *cl.legacy
+	}
+	return nil
+}
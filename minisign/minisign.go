@@ -0,0 +1,224 @@
+// Package minisign reads and writes the public keys and signatures of the
+// minisign tool. They are Ed25519 keys and signatures, which are also those of
+// OpenBSD's signify, other than the signed trusted comment minisign adds.
+package minisign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Signature algorithms
+const (
+	// LegacyAlgorithm signs the message itself, as signify does.
+	LegacyAlgorithm = "Ed"
+	// PrehashedAlgorithm signs the BLAKE2b-512 hash of the message.
+	PrehashedAlgorithm = "ED"
+)
+
+// Comment line prefixes
+const (
+	untrustedCommentPrefix = "untrusted comment: "
+	trustedCommentPrefix   = "trusted comment: "
+)
+
+// keyIDSize is the size of the key ID that identifies a key, and the
+// signatures made by it.
+const keyIDSize = 8
+
+// untrustedComment is the untrusted comment of the signatures written, which
+// is that written by minisign.
+const untrustedComment = "signature from minisign secret key"
+
+// PublicKey is a minisign public key.
+type PublicKey struct {
+	ID  [keyIDSize]byte
+	Key ed25519.PublicKey
+}
+
+// NewPublicKey returns publicKey as a minisign public key. minisign gives each
+// key a random ID, but as it is only a hint to find the key, the first bytes
+// of the BLAKE2b-512 hash of the key are used instead, so that the key always
+// has the same ID.
+func NewPublicKey(publicKey crypto.PublicKey) (*PublicKey, error) {
+	key, ok := publicKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Minisign keys must be Ed25519 keys, not %T", publicKey)
+	}
+	hash := blake2b512(key)
+	result := &PublicKey{Key: key}
+	copy(result.ID[:], hash[:keyIDSize])
+	return result, nil
+}
+
+// formatKeyID returns id as minisign shows it: the hex of the little-endian
+// number it encodes.
+func formatKeyID(id [keyIDSize]byte) string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(id[:]))
+}
+
+// KeyID returns the ID of key as minisign shows it.
+func (key *PublicKey) KeyID() string {
+	return formatKeyID(key.ID)
+}
+
+// Marshal returns key in the format of a minisign public key file.
+func (key *PublicKey) Marshal() []byte {
+	data := append([]byte(LegacyAlgorithm), key.ID[:]...)
+	data = append(data, key.Key...)
+	return []byte(untrustedCommentPrefix + "minisign public key " + key.KeyID() + "\n" + base64.StdEncoding.EncodeToString(data) + "\n")
+}
+
+// lines returns the lines of text, without carriage returns or trailing
+// blank lines.
+func lines(text string) []string {
+	result := strings.Split(strings.Replace(text, "\r", "", -1), "\n")
+	for (len(result) > 0) && (strings.TrimSpace(result[len(result)-1]) == "") {
+		result = result[:len(result)-1]
+	}
+	return result
+}
+
+// ParsePublicKey parses a minisign or signify public key file, or the base64
+// line of one alone.
+func ParsePublicKey(text string) (*PublicKey, error) {
+	keyLines := lines(text)
+	if (len(keyLines) > 0) && strings.HasPrefix(keyLines[0], untrustedCommentPrefix) {
+		keyLines = keyLines[1:]
+	}
+	if len(keyLines) != 1 {
+		return nil, errors.New("Input is not a minisign public key")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(keyLines[0]))
+	if err != nil {
+		return nil, fmt.Errorf("Minisign public key is not valid base64: %s", err.Error())
+	}
+	if len(data) != len(LegacyAlgorithm)+keyIDSize+ed25519.PublicKeySize {
+		return nil, fmt.Errorf("Minisign public key is %d bytes long, but %d bytes were expected", len(data), len(LegacyAlgorithm)+keyIDSize+ed25519.PublicKeySize)
+	}
+	if string(data[:len(LegacyAlgorithm)]) != LegacyAlgorithm {
+		return nil, fmt.Errorf("Unsupported minisign key algorithm %#v", string(data[:len(LegacyAlgorithm)]))
+	}
+	result := &PublicKey{Key: ed25519.PublicKey(data[len(LegacyAlgorithm)+keyIDSize:])}
+	copy(result.ID[:], data[len(LegacyAlgorithm):])
+	return result, nil
+}
+
+// Signature is a parsed minisign or signify signature.
+type Signature struct {
+	UntrustedComment string
+	TrustedComment   string
+	KeyID            [keyIDSize]byte
+	Algorithm        string
+	signature        []byte
+	// globalSignature signs the signature and trusted comment, and is nil for
+	// signify signatures, which have no trusted comment.
+	globalSignature []byte
+}
+
+// Sign returns a minisign signature of message by signer, which must hold an
+// Ed25519 key, with trustedComment. The BLAKE2b-512 hash of the message is
+// signed if prehashed is true, and the message itself otherwise.
+func Sign(signer crypto.Signer, message []byte, prehashed bool, trustedComment string) ([]byte, error) {
+	key, err := NewPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(trustedComment, "\r\n") {
+		return nil, errors.New("Minisign trusted comments must be a single line")
+	}
+	algorithm := LegacyAlgorithm
+	if prehashed {
+		algorithm = PrehashedAlgorithm
+		hash := blake2b512(message)
+		message = hash[:]
+	}
+	signature, err := signer.Sign(nil, message, crypto.Hash(0))
+	if err != nil {
+		return nil, err
+	}
+	globalSignature, err := signer.Sign(nil, append(append([]byte{}, signature...), trustedComment...), crypto.Hash(0))
+	if err != nil {
+		return nil, err
+	}
+	data := append([]byte(algorithm), key.ID[:]...)
+	data = append(data, signature...)
+	result := &bytes.Buffer{}
+	result.WriteString(untrustedCommentPrefix + untrustedComment + "\n")
+	result.WriteString(base64.StdEncoding.EncodeToString(data) + "\n")
+	result.WriteString(trustedCommentPrefix + trustedComment + "\n")
+	result.WriteString(base64.StdEncoding.EncodeToString(globalSignature) + "\n")
+	return result.Bytes(), nil
+}
+
+// Parse parses a minisign signature file, or a signify one, which has no
+// trusted comment.
+func Parse(text string) (*Signature, error) {
+	sigLines := lines(text)
+	if ((len(sigLines) != 2) && (len(sigLines) != 4)) || !strings.HasPrefix(sigLines[0], untrustedCommentPrefix) {
+		return nil, errors.New("Input is not a minisign signature")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(sigLines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("Minisign signature is not valid base64: %s", err.Error())
+	}
+	if len(data) != len(LegacyAlgorithm)+keyIDSize+ed25519.SignatureSize {
+		return nil, fmt.Errorf("Minisign signature is %d bytes long, but %d bytes were expected", len(data), len(LegacyAlgorithm)+keyIDSize+ed25519.SignatureSize)
+	}
+	result := &Signature{
+		UntrustedComment: strings.TrimPrefix(sigLines[0], untrustedCommentPrefix),
+		Algorithm:        string(data[:len(LegacyAlgorithm)]),
+		signature:        data[len(LegacyAlgorithm)+keyIDSize:],
+	}
+	if (result.Algorithm != LegacyAlgorithm) && (result.Algorithm != PrehashedAlgorithm) {
+		return nil, fmt.Errorf("Unsupported minisign signature algorithm %#v", result.Algorithm)
+	}
+	copy(result.KeyID[:], data[len(LegacyAlgorithm):])
+	if len(sigLines) == 2 {
+		return result, nil
+	}
+	if !strings.HasPrefix(sigLines[2], trustedCommentPrefix) {
+		return nil, errors.New("Minisign signature is missing its trusted comment")
+	}
+	result.TrustedComment = strings.TrimPrefix(sigLines[2], trustedCommentPrefix)
+	result.globalSignature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(sigLines[3]))
+	if err != nil {
+		return nil, fmt.Errorf("Minisign trusted comment signature is not valid base64: %s", err.Error())
+	}
+	if len(result.globalSignature) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("Minisign trusted comment signature is %d bytes long, but %d bytes were expected", len(result.globalSignature), ed25519.SignatureSize)
+	}
+	return result, nil
+}
+
+// HasTrustedComment returns true for minisign signatures, which sign their
+// trusted comment, and false for signify ones.
+func (sig *Signature) HasTrustedComment() bool {
+	return sig.globalSignature != nil
+}
+
+// Verify checks that sig is a signature of message by key, along with its
+// trusted comment, if it has one. An error explains why a signature isn't
+// valid.
+func (sig *Signature) Verify(key *PublicKey, message []byte) (bool, error) {
+	if sig.KeyID != key.ID {
+		return false, fmt.Errorf("Minisign signature was made by key %s, not %s", formatKeyID(sig.KeyID), key.KeyID())
+	}
+	if sig.Algorithm == PrehashedAlgorithm {
+		hash := blake2b512(message)
+		message = hash[:]
+	}
+	if !ed25519.Verify(key.Key, message, sig.signature) {
+		return false, nil
+	}
+	if sig.HasTrustedComment() && !ed25519.Verify(key.Key, append(append([]byte{}, sig.signature...), sig.TrustedComment...), sig.globalSignature) {
+		return false, errors.New("Minisign trusted comment is not signed by the key")
+	}
+	return true, nil
+}
@@ -0,0 +1,237 @@
+package minisign_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/smartedge/codechallenge/minisign"
+	"github.com/smartedge/codechallenge/testtools"
+	"strings"
+	"testing"
+)
+
+// FixtureMessage is the message signed by the fixtures, which is longer than
+// a BLAKE2b block.
+var FixtureMessage = strings.Repeat("Hello, minisign!\n", 10)
+
+// FixtureSeed is the seed of the Ed25519 key of FixturePublicKey.
+const FixtureSeed = "1715a4422a9584c99026140878828b1f306dbdf22f976e1ea549974b1eeb9a20"
+
+// FixturePublicKey is a minisign public key file. The fixtures were made
+// independently of this package, with openssl's Ed25519 signatures and
+// Python's BLAKE2b.
+const FixturePublicKey = `untrusted comment: minisign public key 14FCAFD35A7A5AF1
+RWTxWnpa06/8FLU3YF6rTtGrsVx0Z5H9e0DXqKIwWjpH4RIYEqZYBqTO
+`
+
+// FixturePrehashedSignature is a prehashed minisign signature of
+// FixtureMessage by FixturePublicKey.
+const FixturePrehashedSignature = `untrusted comment: signature from minisign secret key
+RUTxWnpa06/8FHK3AvNQbGQWMjMnCxuz4eVzjIN40t0KR3xToaMASx380Dv/D8OSCyqp5c56OjPT2cotbAg2KGgzb+M2o7Pmtw0=
+trusted comment: timestamp:1567339200	file:hello.txt	hashed
+ZEd5UfXTACfzjTNgMTEEI26MNRySumQNW3ns6D/xVPjlyw+yv7bexHsjtkKpqOJ18Ofs7r4/lXhjl7OJ5ntsBQ==
+`
+
+// FixtureLegacySignature is a legacy minisign signature of FixtureMessage by
+// FixturePublicKey.
+const FixtureLegacySignature = `untrusted comment: signature from minisign secret key
+RWTxWnpa06/8FKnIbWuc41aD5GKqBn4rGi7Utb3zZheWvaUzzRuEW6qVdHHek+15PwNH9bKlffrooTNMuh2h0vJYtKCUn5WFZQM=
+trusted comment: timestamp:1567339200	file:hello.txt
+W68ha+3uxpCN9r8VRR6W/GzBZmwJ3ozsl8U/UIBCy1LPpFeiN+G8rMGinlQ/EqoB/YYVc60o4QuGaq/5kB+xAw==
+`
+
+// FixtureSignifySignature is a signify signature of FixtureMessage by
+// FixturePublicKey, which has no trusted comment.
+const FixtureSignifySignature = `untrusted comment: verify with key.pub
+RWTxWnpa06/8FKnIbWuc41aD5GKqBn4rGi7Utb3zZheWvaUzzRuEW6qVdHHek+15PwNH9bKlffrooTNMuh2h0vJYtKCUn5WFZQM=
+`
+
+// fixtureSigner returns the private key of FixturePublicKey.
+func fixtureSigner(t *testing.T) ed25519.PrivateKey {
+	seed, err := hex.DecodeString(FixtureSeed)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// TestPublicKey verifies that the public key file of a key matches the
+// fixture, and parses back to the same key.
+func TestPublicKey(t *testing.T) {
+	signer := fixtureSigner(t)
+	key, err := minisign.NewPublicKey(signer.Public())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if key.KeyID() != "14FCAFD35A7A5AF1" {
+		t.Errorf("Key ID should be 14FCAFD35A7A5AF1. Got %s instead.", key.KeyID())
+	}
+	if string(key.Marshal()) != FixturePublicKey {
+		t.Errorf("Public key file should be:\n%s\nGot:\n%s", FixturePublicKey, string(key.Marshal()))
+	}
+	parsed, err := minisign.ParsePublicKey(FixturePublicKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if (parsed.ID != key.ID) || !bytes.Equal(parsed.Key, key.Key) {
+		t.Errorf("Parsed public key %#v should match %#v", parsed, key)
+	}
+	if _, err := minisign.NewPublicKey(&signer); err == nil {
+		t.Errorf("Keys other than Ed25519 public keys should be rejected")
+	}
+}
+
+// TestSign verifies that signatures of the fixture key match the fixtures
+// byte for byte, as Ed25519 signatures are deterministic.
+func TestSign(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		prehashed      bool
+		trustedComment string
+		expected       string
+	}{
+		"Prehashed": {prehashed: true, trustedComment: "timestamp:1567339200\tfile:hello.txt\thashed", expected: FixturePrehashedSignature},
+		"Legacy":    {prehashed: false, trustedComment: "timestamp:1567339200\tfile:hello.txt", expected: FixtureLegacySignature},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			buff, err := minisign.Sign(fixtureSigner(tt), []byte(FixtureMessage), tc.prehashed, tc.trustedComment)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if string(buff) != tc.expected {
+				tt.Errorf("Signature should be:\n%s\nGot:\n%s", tc.expected, string(buff))
+			}
+		})
+	}
+	_, err := minisign.Sign(fixtureSigner(t), []byte(FixtureMessage), true, "two\nlines")
+	expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Minisign trusted comments must be a single line"}
+	if err := expectedErr.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+// TestVerify verifies that the fixtures are valid, and that changes to the
+// message, trusted comment or key are detected.
+func TestVerify(t *testing.T) {
+	key, err := minisign.ParsePublicKey(FixturePublicKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	_, otherSigner, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := minisign.NewPublicKey(otherSigner.Public())
+	for desc, tc := range map[string]struct {
+		signature      string
+		message        string
+		key            *minisign.PublicKey
+		valid          bool
+		trustedComment bool
+		err            *testtools.ErrorSpec
+	}{
+		"Prehashed":         {signature: FixturePrehashedSignature, message: FixtureMessage, key: key, valid: true, trustedComment: true},
+		"Legacy":            {signature: FixtureLegacySignature, message: FixtureMessage, key: key, valid: true, trustedComment: true},
+		"Signify":           {signature: FixtureSignifySignature, message: FixtureMessage, key: key, valid: true},
+		"Other message":     {signature: FixturePrehashedSignature, message: "Goodbye, minisign!\n", key: key, trustedComment: true},
+		"Other legacy text": {signature: FixtureLegacySignature, message: "Goodbye, minisign!\n", key: key, trustedComment: true},
+		"Changed trusted comment": {
+			signature:      strings.Replace(FixturePrehashedSignature, "timestamp:1567339200", "timestamp:1567339201", 1),
+			message:        FixtureMessage,
+			key:            key,
+			trustedComment: true,
+			err:            &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Minisign trusted comment is not signed by the key"},
+		},
+		"Other key": {
+			signature:      FixturePrehashedSignature,
+			message:        FixtureMessage,
+			key:            otherKey,
+			trustedComment: true,
+			err:            &testtools.ErrorSpec{Type: "*errors.errorString", Message: fmt.Sprintf("Minisign signature was made by key 14FCAFD35A7A5AF1, not %s", otherKey.KeyID())},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			sig, err := minisign.Parse(tc.signature)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if sig.HasTrustedComment() != tc.trustedComment {
+				tt.Errorf("HasTrustedComment() should be %t", tc.trustedComment)
+			}
+			valid, err := sig.Verify(tc.key, []byte(tc.message))
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+			if valid != tc.valid {
+				tt.Errorf("Verify() should return %t. Got %t instead.", tc.valid, valid)
+			}
+		})
+	}
+}
+
+// TestParseErrors verifies that malformed public keys and signatures are
+// rejected with an explanation.
+func TestParseErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		parse func(string) error
+		input string
+		err   *testtools.ErrorSpec
+	}{
+		"Empty public key": {
+			parse: parsePublicKey,
+			input: "",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Input is not a minisign public key"},
+		},
+		"Public key of the wrong size": {
+			parse: parsePublicKey,
+			input: "untrusted comment: minisign public key\nRWTxWnpa06/8FA==\n",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Minisign public key is 10 bytes long, but 42 bytes were expected"},
+		},
+		"Public key of another algorithm": {
+			parse: parsePublicKey,
+			input: strings.Replace(FixturePublicKey, "RWTx", "RUTx", 1),
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported minisign key algorithm \"ED\""},
+		},
+		"Signature without an untrusted comment": {
+			parse: parseSignature,
+			input: strings.Replace(FixturePrehashedSignature, "untrusted comment: ", "", 1),
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Input is not a minisign signature"},
+		},
+		"Signature without its global signature": {
+			parse: parseSignature,
+			input: strings.Join(strings.Split(FixturePrehashedSignature, "\n")[:3], "\n"),
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Input is not a minisign signature"},
+		},
+		"Signature missing its trusted comment": {
+			parse: parseSignature,
+			input: strings.Replace(FixturePrehashedSignature, "trusted comment: timestamp", "timestamp", 1),
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Minisign signature is missing its trusted comment"},
+		},
+		"Signature of another algorithm": {
+			parse: parseSignature,
+			input: strings.Replace(FixtureSignifySignature, "RWTx", "RXTx", 1),
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported minisign signature algorithm \"Et\""},
+		},
+		"Signature that is not base64": {
+			parse: parseSignature,
+			input: "untrusted comment: verify with key.pub\n!!!!\n",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Minisign signature is not valid base64: illegal base64 data at input byte 0"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			if err := tc.err.EnsureMatches(tc.parse(tc.input)); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
+
+// parsePublicKey parses a minisign public key, for TestParseErrors.
+func parsePublicKey(input string) error {
+	_, err := minisign.ParsePublicKey(input)
+	return err
+}
+
+// parseSignature parses a minisign signature, for TestParseErrors.
+func parseSignature(input string) error {
+	_, err := minisign.Parse(input)
+	return err
+}
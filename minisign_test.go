@@ -0,0 +1,139 @@
+package codechallenge_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/minisign"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"strings"
+	"testing"
+)
+
+// OtherMinisignPublicKey is a minisign public key file of a key unrelated to
+// those generated by the tests.
+const OtherMinisignPublicKey = `untrusted comment: minisign public key 14FCAFD35A7A5AF1
+RWTxWnpa06/8FLU3YF6rTtGrsVx0Z5H9e0DXqKIwWjpH4RIYEqZYBqTO
+`
+
+// TestSignAndVerifyMinisign verifies that minisign signatures written by
+// RealMain can be verified in -verify mode, against the PEM public key file or
+// the minisign public key file written by the export-minisign-key command.
+func TestSignAndVerifyMinisign(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signArgs   []string
+		tamper     func(string) string
+		verifyArgs []string
+		status     int
+		stdOutput  testtools.StringMatcher
+		stdErr     testtools.StringMatcher
+	}{
+		"Prehashed": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "minisign"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "minisign", "-payload", "hello.txt", "-public", "minisign.pub"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"trustedComment\": \"timestamp:1567339200\\thashed\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Legacy with a trusted comment": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "minisign", "-legacy", "-trusted-comment", "release 1.0"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "minisign", "-payload", "hello.txt", "-public", "minisign.pub"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"trustedComment\": \"release 1.0\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"PEM public key": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "minisign"},
+			verifyArgs: []string{"codechallenge", "-ed25519", "-verify", "-format", "minisign", "-payload", "hello.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"trustedComment\": \"timestamp:1567339200\\thashed\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Changed trusted comment": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "minisign", "-trusted-comment", "release 1.0"},
+			tamper:     func(sig string) string { return strings.Replace(sig, "release 1.0", "release 2.0", 1) },
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "minisign", "-payload", "hello.txt", "-public", "minisign.pub"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"Minisign trusted comment is not signed by the key\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Wrong payload file": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "minisign"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "minisign", "-payload", "goodbye.txt", "-public", "minisign.pub"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Missing payload file": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "minisign"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "minisign", "-public", "minisign.pub"},
+			status:     3,
+			stdOutput:  testtools.NewStringStringMatcher(""),
+			stdErr:     testtools.NewStringStringMatcher("Minisign signatures are detached, which requires -payload\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Verified with the wrong key": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "minisign"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "minisign", "-payload", "hello.txt", "-public", "other.pub"},
+			status:     9,
+			stdOutput:  testtools.NewRegexpStringMatcher("^\\{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"Minisign signature was made by key [0-9A-F]{16}, not 14FCAFD35A7A5AF1\"\n\\}$"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			// The mocked random numbers are the same for every key-pair, so
+			// the unrelated key is a fixed minisign public key file:
+			files := testtools.FakeFileSystem{
+				"/home/anybody/hello.txt":   testtools.StringPtr("Hello, World!"),
+				"/home/anybody/goodbye.txt": testtools.StringPtr("Goodbye, World!"),
+				"/home/anybody/other.pub":   testtools.StringPtr(OtherMinisignPublicKey),
+			}
+			keyBundle := mocks.NewDefaultMockDeps("", []string{"codechallenge", "export-minisign-key", "-ed25519"}, "/home/anybody", &files)
+			err := keyBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(keyBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling keyBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := keyBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Exporting the key failed with exit status %d:\n%s", exitStatus, keyBundle.ErrBuf.String())
+			}
+			files["/home/anybody/minisign.pub"] = testtools.StringPtr(keyBundle.OutBuf.String())
+			signBundle := mocks.NewDefaultMockDeps("Hello, World!", tc.signArgs, "/home/anybody", &files)
+			err = signBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(signBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling signBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+			}
+			if _, err := minisign.Parse(signBundle.OutBuf.String()); err != nil {
+				tt.Fatalf("Unexpected error parsing minisign signature: %s", err.Error())
+			}
+			signature := signBundle.OutBuf.String()
+			if tc.tamper != nil {
+				signature = tc.tamper(signature)
+			}
+			verifyBundle := mocks.NewDefaultMockDeps(signature, tc.verifyArgs, "/home/anybody", &files)
+			err = verifyBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(verifyBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Errorf("Unexpected error calling verifyBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if err := tc.stdErr.MatchString(verifyBundle.ErrBuf.String()); err != nil {
+				tt.Errorf("Standard Error:\n%#v didn't match:\n%s.", verifyBundle.ErrBuf.String(), err.Error())
+			}
+		})
+	}
+}
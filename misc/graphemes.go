@@ -0,0 +1,248 @@
+package misc
+
+import (
+	"unicode"
+)
+
+// graphemeBreakProperty is the Unicode Grapheme_Cluster_Break property of a
+// code point, as defined by UAX #29.
+type graphemeBreakProperty int
+
+// Grapheme_Cluster_Break property values
+const (
+	gbpOther graphemeBreakProperty = iota
+	gbpCR
+	gbpLF
+	gbpControl
+	gbpExtend
+	gbpZWJ
+	gbpRegionalIndicator
+	gbpPrepend
+	gbpSpacingMark
+	gbpL
+	gbpV
+	gbpT
+	gbpLV
+	gbpLVT
+)
+
+// Hangul syllable block constants, used to compute the L, V, T, LV and LVT
+// properties algorithmically rather than from tables.
+const (
+	hangulSBase  = 0xAC00
+	hangulSCount = 11172
+	hangulTCount = 28
+)
+
+// prependTable holds the code points with Grapheme_Cluster_Break=Prepend.
+var prependTable = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x0600, Hi: 0x0605, Stride: 1},
+		{Lo: 0x06DD, Hi: 0x06DD, Stride: 1},
+		{Lo: 0x070F, Hi: 0x070F, Stride: 1},
+		{Lo: 0x0890, Hi: 0x0891, Stride: 1},
+		{Lo: 0x08E2, Hi: 0x08E2, Stride: 1},
+		{Lo: 0x0D4E, Hi: 0x0D4E, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x110BD, Hi: 0x110BD, Stride: 1},
+		{Lo: 0x110CD, Hi: 0x110CD, Stride: 1},
+		{Lo: 0x111C2, Hi: 0x111C3, Stride: 1},
+		{Lo: 0x1193F, Hi: 0x1193F, Stride: 1},
+		{Lo: 0x11941, Hi: 0x11941, Stride: 1},
+		{Lo: 0x11A3A, Hi: 0x11A3A, Stride: 1},
+		{Lo: 0x11A84, Hi: 0x11A89, Stride: 1},
+		{Lo: 0x11D46, Hi: 0x11D46, Stride: 1},
+	},
+}
+
+// extendedPictographicTable holds the code points with the
+// Extended_Pictographic property from the Unicode emoji data, which the
+// standard library does not provide.
+var extendedPictographicTable = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00A9, Hi: 0x00A9, Stride: 1},
+		{Lo: 0x00AE, Hi: 0x00AE, Stride: 1},
+		{Lo: 0x203C, Hi: 0x203C, Stride: 1},
+		{Lo: 0x2049, Hi: 0x2049, Stride: 1},
+		{Lo: 0x2122, Hi: 0x2122, Stride: 1},
+		{Lo: 0x2139, Hi: 0x2139, Stride: 1},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1},
+		{Lo: 0x21A9, Hi: 0x21AA, Stride: 1},
+		{Lo: 0x231A, Hi: 0x231B, Stride: 1},
+		{Lo: 0x2328, Hi: 0x2328, Stride: 1},
+		{Lo: 0x2388, Hi: 0x2388, Stride: 1},
+		{Lo: 0x23CF, Hi: 0x23CF, Stride: 1},
+		{Lo: 0x23E9, Hi: 0x23F3, Stride: 1},
+		{Lo: 0x23F8, Hi: 0x23FA, Stride: 1},
+		{Lo: 0x24C2, Hi: 0x24C2, Stride: 1},
+		{Lo: 0x25AA, Hi: 0x25AB, Stride: 1},
+		{Lo: 0x25B6, Hi: 0x25B6, Stride: 1},
+		{Lo: 0x25C0, Hi: 0x25C0, Stride: 1},
+		{Lo: 0x25FB, Hi: 0x25FE, Stride: 1},
+		{Lo: 0x2600, Hi: 0x2605, Stride: 1},
+		{Lo: 0x2607, Hi: 0x2612, Stride: 1},
+		{Lo: 0x2614, Hi: 0x2685, Stride: 1},
+		{Lo: 0x2690, Hi: 0x2705, Stride: 1},
+		{Lo: 0x2708, Hi: 0x2712, Stride: 1},
+		{Lo: 0x2714, Hi: 0x2714, Stride: 1},
+		{Lo: 0x2716, Hi: 0x2716, Stride: 1},
+		{Lo: 0x271D, Hi: 0x271D, Stride: 1},
+		{Lo: 0x2721, Hi: 0x2721, Stride: 1},
+		{Lo: 0x2728, Hi: 0x2728, Stride: 1},
+		{Lo: 0x2733, Hi: 0x2734, Stride: 1},
+		{Lo: 0x2744, Hi: 0x2744, Stride: 1},
+		{Lo: 0x2747, Hi: 0x2747, Stride: 1},
+		{Lo: 0x274C, Hi: 0x274C, Stride: 1},
+		{Lo: 0x274E, Hi: 0x274E, Stride: 1},
+		{Lo: 0x2753, Hi: 0x2755, Stride: 1},
+		{Lo: 0x2757, Hi: 0x2757, Stride: 1},
+		{Lo: 0x2763, Hi: 0x2767, Stride: 1},
+		{Lo: 0x2795, Hi: 0x2797, Stride: 1},
+		{Lo: 0x27A1, Hi: 0x27A1, Stride: 1},
+		{Lo: 0x27B0, Hi: 0x27B0, Stride: 1},
+		{Lo: 0x27BF, Hi: 0x27BF, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2B05, Hi: 0x2B07, Stride: 1},
+		{Lo: 0x2B1B, Hi: 0x2B1C, Stride: 1},
+		{Lo: 0x2B50, Hi: 0x2B50, Stride: 1},
+		{Lo: 0x2B55, Hi: 0x2B55, Stride: 1},
+		{Lo: 0x3030, Hi: 0x3030, Stride: 1},
+		{Lo: 0x303D, Hi: 0x303D, Stride: 1},
+		{Lo: 0x3297, Hi: 0x3297, Stride: 1},
+		{Lo: 0x3299, Hi: 0x3299, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1F000, Hi: 0x1F0FF, Stride: 1},
+		{Lo: 0x1F10D, Hi: 0x1F10F, Stride: 1},
+		{Lo: 0x1F12F, Hi: 0x1F12F, Stride: 1},
+		{Lo: 0x1F16C, Hi: 0x1F171, Stride: 1},
+		{Lo: 0x1F17E, Hi: 0x1F17F, Stride: 1},
+		{Lo: 0x1F18E, Hi: 0x1F18E, Stride: 1},
+		{Lo: 0x1F191, Hi: 0x1F19A, Stride: 1},
+		{Lo: 0x1F1AD, Hi: 0x1F1E5, Stride: 1},
+		{Lo: 0x1F201, Hi: 0x1F20F, Stride: 1},
+		{Lo: 0x1F21A, Hi: 0x1F21A, Stride: 1},
+		{Lo: 0x1F22F, Hi: 0x1F22F, Stride: 1},
+		{Lo: 0x1F232, Hi: 0x1F23A, Stride: 1},
+		{Lo: 0x1F23C, Hi: 0x1F23F, Stride: 1},
+		{Lo: 0x1F249, Hi: 0x1F3FA, Stride: 1},
+		{Lo: 0x1F400, Hi: 0x1F53D, Stride: 1},
+		{Lo: 0x1F546, Hi: 0x1F64F, Stride: 1},
+		{Lo: 0x1F680, Hi: 0x1F6FF, Stride: 1},
+		{Lo: 0x1F774, Hi: 0x1F77F, Stride: 1},
+		{Lo: 0x1F7D5, Hi: 0x1F7FF, Stride: 1},
+		{Lo: 0x1F80C, Hi: 0x1F80F, Stride: 1},
+		{Lo: 0x1F848, Hi: 0x1F84F, Stride: 1},
+		{Lo: 0x1F85A, Hi: 0x1F85F, Stride: 1},
+		{Lo: 0x1F888, Hi: 0x1F88F, Stride: 1},
+		{Lo: 0x1F8AE, Hi: 0x1F8FF, Stride: 1},
+		{Lo: 0x1F90C, Hi: 0x1F93A, Stride: 1},
+		{Lo: 0x1F93C, Hi: 0x1F945, Stride: 1},
+		{Lo: 0x1F947, Hi: 0x1FAFF, Stride: 1},
+		{Lo: 0x1FC00, Hi: 0x1FFFD, Stride: 1},
+	},
+}
+
+// getGraphemeBreakProperty looks up the Grapheme_Cluster_Break property of
+// r. The standard library doesn't carry this table, so it is derived from
+// the general categories and properties it does carry.
+func getGraphemeBreakProperty(r rune) graphemeBreakProperty {
+	switch {
+	case r == '\r':
+		return gbpCR
+	case r == '\n':
+		return gbpLF
+	case r == 0x200D:
+		return gbpZWJ
+	case r == 0x200C, (r >= 0x1F3FB) && (r <= 0x1F3FF):
+		// ZWNJ and the emoji skin tone modifiers extend the preceding
+		// character.
+		return gbpExtend
+	case (r >= 0x1F1E6) && (r <= 0x1F1FF):
+		return gbpRegionalIndicator
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Other_Grapheme_Extend):
+		return gbpExtend
+	case unicode.Is(prependTable, r):
+		return gbpPrepend
+	case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Zl, unicode.Zp):
+		return gbpControl
+	case unicode.Is(unicode.Mc, r), r == 0x0E33, r == 0x0EB3:
+		return gbpSpacingMark
+	case ((r >= 0x1100) && (r <= 0x115F)) || ((r >= 0xA960) && (r <= 0xA97C)):
+		return gbpL
+	case ((r >= 0x1160) && (r <= 0x11A7)) || ((r >= 0xD7B0) && (r <= 0xD7C6)):
+		return gbpV
+	case ((r >= 0x11A8) && (r <= 0x11FF)) || ((r >= 0xD7CB) && (r <= 0xD7FB)):
+		return gbpT
+	case (r >= hangulSBase) && (r < hangulSBase+hangulSCount):
+		if (r-hangulSBase)%hangulTCount == 0 {
+			return gbpLV
+		}
+		return gbpLVT
+	}
+	return gbpOther
+}
+
+// isGraphemeBoundary applies the UAX #29 grapheme cluster boundary rules to
+// decide whether a boundary falls between two code points with the
+// properties prev and next. emojiZWJ reports that prev is a ZWJ following an
+// Extended_Pictographic character (and any Extend characters), and
+// oddRegionalIndicators reports that prev completes an odd length run of
+// regional indicators.
+func isGraphemeBoundary(prev, next graphemeBreakProperty, nextIsPictographic, emojiZWJ, oddRegionalIndicators bool) bool {
+	switch {
+	case (prev == gbpCR) && (next == gbpLF): // GB3
+		return false
+	case (prev == gbpCR) || (prev == gbpLF) || (prev == gbpControl): // GB4
+		return true
+	case (next == gbpCR) || (next == gbpLF) || (next == gbpControl): // GB5
+		return true
+	case (prev == gbpL) && ((next == gbpL) || (next == gbpV) || (next == gbpLV) || (next == gbpLVT)): // GB6
+		return false
+	case ((prev == gbpLV) || (prev == gbpV)) && ((next == gbpV) || (next == gbpT)): // GB7
+		return false
+	case ((prev == gbpLVT) || (prev == gbpT)) && (next == gbpT): // GB8
+		return false
+	case (next == gbpExtend) || (next == gbpZWJ): // GB9
+		return false
+	case next == gbpSpacingMark: // GB9a
+		return false
+	case prev == gbpPrepend: // GB9b
+		return false
+	case emojiZWJ && nextIsPictographic: // GB11
+		return false
+	case (prev == gbpRegionalIndicator) && (next == gbpRegionalIndicator): // GB12, GB13
+		return !oddRegionalIndicators
+	}
+	return true // GB999
+}
+
+// GraphemeClusterCount returns the number of extended grapheme clusters in
+// the UTF-8 string s, as defined by UAX #29. This approximates the number of
+// characters a user would see, counting combining character sequences, emoji
+// ZWJ sequences and flags as single characters.
+func GraphemeClusterCount(s string) int {
+	count := 0
+	prev := gbpOther
+	inPictographicSequence := false
+	emojiZWJ := false
+	regionalIndicatorRun := 0
+	for i, r := range s {
+		next := getGraphemeBreakProperty(r)
+		nextIsPictographic := unicode.Is(extendedPictographicTable, r)
+		if (i == 0) || isGraphemeBoundary(prev, next, nextIsPictographic, emojiZWJ, regionalIndicatorRun%2 == 1) {
+			count++
+		}
+		// Track the state needed by GB11, GB12 and GB13:
+		emojiZWJ = inPictographicSequence && (next == gbpZWJ)
+		inPictographicSequence = nextIsPictographic || (inPictographicSequence && (next == gbpExtend))
+		if next == gbpRegionalIndicator {
+			regionalIndicatorRun++
+		} else {
+			regionalIndicatorRun = 0
+		}
+		prev = next
+	}
+	return count
+}
@@ -0,0 +1,45 @@
+package misc_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge/misc"
+	"testing"
+)
+
+// TestGraphemeClusterCount tests GraphemeClusterCount().
+func TestGraphemeClusterCount(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		input    string
+		expected int
+	}{
+		{desc: "empty string", input: "", expected: 0},
+		{desc: "ascii", input: "Hello, World!", expected: 13},
+		{desc: "CR LF pair", input: "a\r\nb", expected: 3},
+		{desc: "LF CR pair", input: "a\n\rb", expected: 4},
+		{desc: "precomposed accent", input: "caf\u00e9", expected: 4},
+		{desc: "combining accent", input: "cafe\u0301", expected: 4},
+		{desc: "stacked combining marks", input: "a\u0301\u0323\u0302b", expected: 2},
+		{desc: "leading combining mark", input: "\u0301a", expected: 2},
+		{desc: "hangul jamo", input: "\u1100\u1161\u11a8", expected: 1},
+		{desc: "hangul syllables", input: "\ud55c\uad6d\uc5b4", expected: 3},
+		{desc: "hangul LV syllable with trailing jamo", input: "\uac00\u11a8", expected: 1},
+		{desc: "devanagari spacing mark", input: "\u0915\u093f", expected: 1},
+		{desc: "arabic prepend mark", input: "\u0600\u0661", expected: 1},
+		{desc: "emoji with skin tone", input: "\U0001F44D\U0001F3FD", expected: 1},
+		{desc: "emoji with variation selector", input: "\u2764\ufe0f", expected: 1},
+		{desc: "emoji ZWJ sequence", input: "\U0001F468\u200d\U0001F469\u200d\U0001F467\u200d\U0001F466", expected: 1},
+		{desc: "ZWJ without emoji", input: "a\u200db", expected: 2},
+		{desc: "flag", input: "\U0001F1FA\U0001F1F8", expected: 1},
+		{desc: "three regional indicators", input: "\U0001F1FA\U0001F1F8\U0001F1EB", expected: 2},
+		{desc: "two flags", input: "\U0001F1FA\U0001F1F8\U0001F1EB\U0001F1F7", expected: 2},
+		{desc: "tag sequence", input: "\U0001F3F4\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F", expected: 1},
+		{desc: "control characters", input: "\x00\u0301", expected: 2},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", tc.desc), func(tt *testing.T) {
+			if actual := misc.GraphemeClusterCount(tc.input); actual != tc.expected {
+				tt.Errorf("GraphemeClusterCount(%#v) returned %d when %d was expected", tc.input, actual, tc.expected)
+			}
+		})
+	}
+}
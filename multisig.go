@@ -0,0 +1,432 @@
+package codechallenge
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/jws"
+	"github.com/smartedge/codechallenge/misc"
+	"strconv"
+	"strings"
+)
+
+// SignaturePolicy is the number of the keys of a multi-signature document
+// that must have valid signatures for it to verify, where AllSignatures
+// requires every key to.
+type SignaturePolicy int
+
+// Signature policies. Any other positive policy requires that many keys.
+const (
+	AllSignatures SignaturePolicy = 0
+	AnySignature  SignaturePolicy = 1
+)
+
+// ParseSignaturePolicy returns the SignaturePolicy named by name: all, any,
+// or a positive number of keys. Names are not case sensitive.
+func ParseSignaturePolicy(name string) (SignaturePolicy, error) {
+	switch strings.ToLower(name) {
+	case "all":
+		return AllSignatures, nil
+	case "any":
+		return AnySignature, nil
+	}
+	count, err := strconv.Atoi(name)
+	if (err != nil) || (count < 1) {
+		return AllSignatures, fmt.Errorf("Unrecognized signature policy %#v: expected all, any or a positive number of keys", name)
+	}
+	return SignaturePolicy(count), nil
+}
+
+// String returns the name of the signature policy.
+func (sp SignaturePolicy) String() string {
+	switch sp {
+	case AllSignatures:
+		return "all"
+	case AnySignature:
+		return "any"
+	}
+	return strconv.Itoa(int(sp))
+}
+
+// Required returns the number of valid signatures the policy requires of a
+// document with count keys.
+func (sp SignaturePolicy) Required(count int) int {
+	if sp == AllSignatures {
+		return count
+	}
+	return int(sp)
+}
+
+// MultiSigSettings describes the key-pairs a multi-signature document is
+// signed with, if more than one, and the policy a document being verified
+// must meet, over the public keys in SignerPaths if any are given, or else
+// over the public key being verified against.
+type MultiSigSettings struct {
+	PrivateKeyPaths []string
+	PublicKeyPaths  []string
+	Policy          SignaturePolicy
+	SignerPaths     []string
+}
+
+// MessageSignature is one of the signatures of a multi-signature document:
+// the base64 signature of the digest of its message, and the PEM public key
+// it was made with.
+type MessageSignature struct {
+	Signature string `json:"signature"`
+	Pubkey    string `json:"pubkey"`
+}
+
+// SignerVerdict is the verdict on the signature of one key of a
+// multi-signature document, identified by its key ID.
+type SignerVerdict struct {
+	KeyID string `json:"key_id"`
+	*Verdict
+}
+
+// MultiSigVerdict is the outcome of verifying a multi-signature document, to
+// be rendered to JSON: whether it meets the policy, along with the verdict on
+// the signature of each of its keys.
+type MultiSigVerdict struct {
+	*Verdict
+	Policy  string          `json:"policy"`
+	Signers []SignerVerdict `json:"signers"`
+}
+
+// pemKeyID returns the key ID of the PEM public key or certificate pemKey.
+func pemKeyID(pemKey string) (string, error) {
+	x509Key, err := crypt.NewPEMBufferFromString(pemKey).DecodeToX509()
+	if err != nil {
+		return "", err
+	}
+	publicKey, err := x509Key.AsGenericPublicKey()
+	if err != nil {
+		return "", err
+	}
+	return jws.KeyID(publicKey)
+}
+
+// loadSigningKeys returns the crypto tooling of each key-pair in config, for
+// signing digests by hash, generating any that are missing with the algorithm
+// options. The algorithm of an existing key-pair is that of its public key, so
+// that a document may be signed by keys of different algorithms.
+func loadSigningKeys(d *deps.Dependencies, config *RunConfig, hash crypto.Hash) ([]*crypt.CryptoTooling, error) {
+	privateKeyPaths := config.MultiSig.PrivateKeyPaths
+	publicKeyPaths := config.MultiSig.PublicKeyPaths
+	if len(privateKeyPaths) == 0 {
+		privateKeyPaths = []string{config.PubKeySettings.PrivateKeyPath}
+		publicKeyPaths = []string{config.PubKeySettings.PublicKeyPath}
+	}
+	result := make([]*crypt.CryptoTooling, 0, len(privateKeyPaths))
+	for i := range privateKeyPaths {
+		settings := config.PubKeySettings
+		settings.PrivateKeyPath = privateKeyPaths[i]
+		settings.PublicKeyPath = publicKeyPaths[i]
+		settings.Hash = hash
+		if misc.FileExists(d, settings.PublicKeyPath) {
+			pemKey, _, err := crypt.LoadAndDecodeKey(d, settings.PublicKeyPath)
+			if err != nil {
+				return nil, err
+			}
+			settings.Algorithm, err = pemKey.PublicKeyAlgorithm()
+			if err != nil {
+				return nil, err
+			}
+		}
+		tooling, err := crypt.GetCryptoTooling(d, &settings)
+		if err != nil {
+			return nil, err
+		}
+		if err := tooling.PopulateKeys(); err != nil {
+			return nil, err
+		}
+		result = append(result, tooling)
+	}
+	return result, nil
+}
+
+// addSignatures signs digest with each of keys, adding the signatures to the
+// multi-signature document doc. A key may only sign a document once.
+func addSignatures(d *deps.Dependencies, doc *SignedMessage, digest crypt.DigestHash, keys []*crypt.CryptoTooling) {
+	signed := map[string]bool{}
+	for _, signature := range doc.Signatures {
+		keyID, err := pemKeyID(signature.Pubkey)
+		if err != nil {
+			HandleError(d, err, 2)
+		}
+		signed[keyID] = true
+	}
+	for _, cryptStuff := range keys {
+		keyID, err := pemKeyID(cryptStuff.PubKey.String())
+		if err != nil {
+			HandleError(d, err, 4)
+		}
+		if signed[keyID] {
+			HandleError(d, fmt.Errorf("Signed message is already signed by key %s", keyID), 5)
+		}
+		signed[keyID] = true
+		binSig, err := cryptStuff.Sign(digest)
+		if err != nil {
+			HandleError(d, err, 5)
+		}
+		// Verify with a round trip:
+		valid, err := cryptStuff.VerifySignedDigest(digest, binSig.Base64(), cryptStuff.PubKey.String())
+		if err != nil {
+			HandleError(d, err, 6)
+		}
+		if !valid {
+			HandleError(d, errors.New("round trip verification of signature failed"), 7)
+		}
+		doc.Signatures = append(doc.Signatures, MessageSignature{
+			Signature: binSig.Base64(),
+			Pubkey:    cryptStuff.PubKey.String(),
+		})
+	}
+}
+
+// SignMultiSigMain signs message, whose digest is digest, with each of the
+// key-pairs in config, and writes the multi-signature document to
+// d.Os.Stdout.
+func SignMultiSigMain(d *deps.Dependencies, config *RunConfig, message string, digest crypt.DigestHash) {
+	keys, err := loadSigningKeys(d, config, config.PubKeySettings.GetHash())
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	response := &SignedMessage{
+		Message:       message,
+		Encoding:      config.Input.Encoding,
+		Normalization: config.Input.Normalization.String(),
+		Digest:        config.DigestMode,
+	}
+	if hash := config.PubKeySettings.GetHash(); config.DigestMode || (hash != crypto.SHA256) {
+		response.Hash = crypt.HashName(hash)
+	}
+	addSignatures(d, response, digest, keys)
+	err = GenerateResponse(d, response)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// AddSignatureMain is the entry-point for the add-signature command. It reads
+// a signed message in JSON format from d.Os.Stdin, whose signatures must be
+// valid, and writes it to d.Os.Stdout as a multi-signature document with a
+// co-signature by each configured key added.
+func AddSignatureMain(d *deps.Dependencies, config *RunConfig) {
+	doc, err := InjestSignedMessage(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	if EnvelopeVersion(doc.Version) == EnvelopeV2 {
+		HandleError(d, errors.New("Signed messages of version 2 can't be co-signed, as their signature covers the key that made it"), 2)
+	}
+	if doc.Timestamp != "" {
+		HandleError(d, errors.New("Time-stamped signed messages can't be co-signed, as the time-stamp token is of their signature alone"), 2)
+	}
+	if len(doc.Signatures) == 0 {
+		doc.Signatures = []MessageSignature{{Signature: doc.Signature, Pubkey: doc.Pubkey}}
+		doc.Signature = ""
+		doc.Pubkey = ""
+	}
+	verifyConfig := *config
+	verifyConfig.DigestMode = doc.Digest
+	for _, signature := range doc.Signatures {
+		keyID, verdict, err := verifyMessageSignature(d, &verifyConfig, doc, &signature)
+		if err != nil {
+			HandleError(d, err, 2)
+		}
+		if !verdict.Valid {
+			HandleError(d, fmt.Errorf("Signature by key %s is not valid (%s), so the signed message can't be co-signed", keyID, verdict.Reason), 2)
+		}
+	}
+	hash, err := SignedMessageHash(doc)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	digest := crypt.NewDigestHash(hash, doc.Message)
+	if doc.Digest {
+		digest, err = crypt.NewDigestHashFromString(doc.Message, hash)
+		if err != nil {
+			HandleError(d, err, 2)
+		}
+	}
+	keys, err := loadSigningKeys(d, config, hash)
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	addSignatures(d, doc, digest, keys)
+	err = GenerateResponse(d, doc)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// verifyMessageSignature verifies signature, one of the signatures of the
+// multi-signature document doc, returning the key ID of its public key along
+// with the verdict on it.
+func verifyMessageSignature(d *deps.Dependencies, config *RunConfig, doc *SignedMessage, signature *MessageSignature) (string, *Verdict, error) {
+	keyID, err := pemKeyID(signature.Pubkey)
+	if err != nil {
+		return "", nil, err
+	}
+	single := *doc
+	single.Signatures = nil
+	single.Signature = signature.Signature
+	single.Pubkey = signature.Pubkey
+	verdict, err := VerifySignedMessageDocument(d, config, &single)
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID, verdict, nil
+}
+
+// VerifyMultiSigDocument verifies each signature of the multi-signature
+// document doc, and checks that enough of its keys have valid signatures to
+// meet the policy in config. The keys are those of the signers in config if
+// any are given, or else the public key in config, and signatures by other
+// keys are ignored: the keys doc lists are never trusted by themselves.
+// Malformed documents and keys are reported as errors, while documents that
+// don't meet the policy are reported in the returned verdict.
+func VerifyMultiSigDocument(d *deps.Dependencies, config *RunConfig, doc *SignedMessage) (*MultiSigVerdict, error) {
+	if (doc.Signature != "") || (doc.Pubkey != "") {
+		return nil, errors.New("Signed message has both a signature and signatures")
+	}
+	if (doc.Version != 0) && (EnvelopeVersion(doc.Version) != EnvelopeV1) {
+		return nil, errors.New("Multi-signature documents must be of version 1")
+	}
+	if (config.Trust.StorePath != "") || config.State.ReplayCheck {
+		return nil, errors.New("Options -trust-store and -replay-check are not valid with multi-signature documents")
+	}
+	signerPaths := config.MultiSig.SignerPaths
+	if len(signerPaths) == 0 {
+		signerPaths = []string{config.PubKeySettings.PublicKeyPath}
+	}
+	keyIDs := []string{}
+	verdicts := map[string]*Verdict{}
+	for _, path := range signerPaths {
+		pemKey, _, err := crypt.LoadAndDecodeKey(d, path)
+		if err != nil {
+			return nil, err
+		}
+		keyID, err := pemKeyID(pemKey.String())
+		if err != nil {
+			return nil, fmt.Errorf("File %s: %s", path, err.Error())
+		}
+		if verdicts[keyID] == nil {
+			keyIDs = append(keyIDs, keyID)
+			verdicts[keyID] = NewVerdict(BadSignature, "Signed message has no signature by this key")
+		}
+	}
+	signed := map[string]bool{}
+	for i := range doc.Signatures {
+		keyID, verdict, err := verifyMessageSignature(d, config, doc, &doc.Signatures[i])
+		if err != nil {
+			return nil, err
+		}
+		previous, listed := verdicts[keyID]
+		if !listed {
+			continue
+		}
+		if previous.Valid || (signed[keyID] && !verdict.Valid) {
+			// A key has a valid signature if any of its signatures is valid:
+			continue
+		}
+		signed[keyID] = true
+		verdicts[keyID] = verdict
+	}
+	required := config.MultiSig.Policy.Required(len(keyIDs))
+	if required > len(keyIDs) {
+		return nil, fmt.Errorf("Signature policy %s requires %d keys, but there are only %d", config.MultiSig.Policy.String(), required, len(keyIDs))
+	}
+	result := &MultiSigVerdict{
+		Policy:  config.MultiSig.Policy.String(),
+		Signers: make([]SignerVerdict, 0, len(keyIDs)),
+	}
+	validCount := 0
+	for _, keyID := range keyIDs {
+		if verdicts[keyID].Valid {
+			validCount++
+		}
+		result.Signers = append(result.Signers, SignerVerdict{KeyID: keyID, Verdict: verdicts[keyID]})
+	}
+	if validCount < required {
+		result.Verdict = NewVerdict(InsufficientSignatures, fmt.Sprintf("%d of %d keys have valid signatures, but the policy requires %d", validCount, len(keyIDs), required))
+	} else {
+		result.Verdict = NewVerdict(SignatureValid, "")
+	}
+	return result, nil
+}
+
+// VerifyMultiSigMain writes the verdict on the multi-signature document doc
+// to d.Os.Stdout in JSON format, exiting with the verdict's exit status if it
+// doesn't meet the policy.
+func VerifyMultiSigMain(d *deps.Dependencies, config *RunConfig, doc *SignedMessage) {
+	verdict, err := VerifyMultiSigDocument(d, config, doc)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// parseMultiSigOptions validates the signature policy and signers options in
+// cl into config.
+func parseMultiSigOptions(config *RunConfig, cl *commandLine) error {
+	if (*cl.policyName != "") || (*cl.signerPaths != "") {
+		if (config.Output.Format != JSONOutput) || !config.VerifyMode || (config.Command != "") {
+			return errors.New("Options -policy and -signers are only valid when verifying JSON input")
+		}
+		if *cl.policyName != "" {
+			policy, err := ParseSignaturePolicy(*cl.policyName)
+			if err != nil {
+				return err
+			}
+			config.MultiSig.Policy = policy
+		}
+		if *cl.signerPaths != "" {
+			config.MultiSig.SignerPaths = strings.Split(*cl.signerPaths, ",")
+			if required := config.MultiSig.Policy.Required(len(config.MultiSig.SignerPaths)); required > len(config.MultiSig.SignerPaths) {
+				return fmt.Errorf("Option -policy requires %d keys, but -signers lists only %d", required, len(config.MultiSig.SignerPaths))
+			}
+		}
+	}
+	return nil
+}
+
+// parseKeyListOptions validates the several key files -private and -public may
+// list in cl into config.
+func parseKeyListOptions(config *RunConfig, cl *commandLine) error {
+	privateKeyPaths := strings.Split(*cl.overridePrivateKeyPath, ",")
+	publicKeyPaths := strings.Split(*cl.overridePublicKeyPath, ",")
+	if (len(privateKeyPaths) > 1) || (len(publicKeyPaths) > 1) {
+		signsJSON := (config.Output.Format == JSONOutput) && !config.VerifyMode && (config.Command == "")
+		if !signsJSON && (config.Command != AddSignatureCommand) {
+			return fmt.Errorf("Options -private and -public only list several keys when signing JSON output, or with the %s command", AddSignatureCommand)
+		}
+		if len(privateKeyPaths) != len(publicKeyPaths) {
+			return errors.New("Options -private and -public must list the same number of key files")
+		}
+		if (config.Output.Envelope == EnvelopeV2) || (config.Output.CertPath != "") || (config.Timestamp.URL != "") {
+			return errors.New("Several keys are not valid with -envelope=v2, -cert or -tsa, which are of a single signature")
+		}
+		listed := map[string]bool{}
+		for _, path := range append(privateKeyPaths, publicKeyPaths...) {
+			if path == "" {
+				return errors.New("Options -private and -public must not list empty filepaths")
+			}
+			if listed[path] {
+				return fmt.Errorf("Key file %s is listed more than once", path)
+			}
+			listed[path] = true
+		}
+		config.MultiSig.PrivateKeyPaths = privateKeyPaths
+		config.MultiSig.PublicKeyPaths = publicKeyPaths
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package codechallenge_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/jws"
+	"github.com/smartedge/codechallenge/testtools"
+	"testing"
+)
+
+// TestMultiSignature verifies that documents signed by several keys of
+// different algorithms, and co-signed by further keys, verify with each
+// signature policy, over the keys given rather than those they list.
+func TestMultiSignature(t *testing.T) {
+	files := testtools.FakeFileSystem{}
+	run := func(stdin string, args ...string) string {
+		bundle := runMain(t, &files, stdin, args...)
+		if exitStatus := bundle.GetExitStatus(); exitStatus != 0 {
+			t.Fatalf("Running %v failed with exit status %d:\n%s", args, exitStatus, bundle.ErrBuf.String())
+		}
+		return bundle.OutBuf.String()
+	}
+	parse := func(signed string) *codechallenge.SignedMessage {
+		doc := codechallenge.SignedMessage{}
+		if err := json.Unmarshal([]byte(signed), &doc); err != nil {
+			t.Fatalf("Unexpected error parsing signed message %#v: %s", signed, err.Error())
+		}
+		return &doc
+	}
+	// The mocked source of randomness is the same for every run, so each key
+	// is of another algorithm to be a key of its own:
+	run("Hello, World!", "-rsa", "-private", "rsa.priv", "-public", "rsa.pub")
+	run("Hello, World!", "-ed25519", "-private", "ed25519.priv", "-public", "ed25519.pub")
+
+	signed := run("Hello, World!", "-private", "ecdsa.priv,rsa.priv", "-public", "ecdsa.pub,rsa.pub")
+	doc := parse(signed)
+	if (len(doc.Signatures) != 2) || (doc.Signature != "") || (doc.Pubkey != "") || (doc.Signatures[1].Pubkey != *files["/home/anybody/rsa.pub"]) {
+		t.Errorf("Signed message should have a signature by each key. Got %#v instead.", doc)
+	}
+	cosigned := run(signed, "add-signature", "-private", "ed25519.priv", "-public", "ed25519.pub")
+	if doc = parse(cosigned); len(doc.Signatures) != 3 {
+		t.Errorf("Co-signed message should have 3 signatures. Got %#v instead.", doc)
+	}
+	keyIDs := []string{}
+	for _, signature := range doc.Signatures {
+		x509Key, err := crypt.NewPEMBufferFromString(signature.Pubkey).DecodeToX509()
+		if err != nil {
+			t.Fatalf("Unexpected error decoding public key: %s", err.Error())
+		}
+		publicKey, err := x509Key.AsGenericPublicKey()
+		if err != nil {
+			t.Fatalf("Unexpected error decoding public key: %s", err.Error())
+		}
+		keyID, err := jws.KeyID(publicKey)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		keyIDs = append(keyIDs, keyID)
+	}
+
+	tampered := *doc
+	tampered.Signatures = append([]codechallenge.MessageSignature{}, doc.Signatures...)
+	tampered.Signatures[1].Signature = doc.Signatures[0].Signature
+	buff, _ := json.Marshal(&tampered)
+	verify := func(desc string, stdin string, status int, expected string, args ...string) {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			bundle := runMain(tt, &files, stdin, append([]string{"-verify"}, args...)...)
+			if exitStatus := bundle.GetExitStatus(); exitStatus != status {
+				tt.Errorf("Verifying should have an exit status of %d. Got %d instead:\n%s", status, exitStatus, bundle.ErrBuf.String())
+			}
+			if verdict := bundle.OutBuf.String(); verdict != expected {
+				tt.Errorf("Verdict should be %#v. Got %#v instead.", expected, verdict)
+			}
+		})
+	}
+	signer := func(keyID string, reason string) string {
+		if reason == "" {
+			return fmt.Sprintf("{\n\"key_id\": \"%s\",\n\"valid\": true,\n\"reason\": \"valid\"\n}", keyID)
+		}
+		return fmt.Sprintf("{\n\"key_id\": \"%s\",\n\"valid\": false,\n\"reason\": %s\n}", keyID, reason)
+	}
+	valid := "{\n\"valid\": true,\n\"reason\": \"valid\",\n\"policy\": \"%s\",\n\"signers\": [\n%s\n]\n}"
+	insufficient := "{\n\"valid\": false,\n\"reason\": \"insufficient signatures\",\n\"detail\": \"%s\",\n\"policy\": \"%s\",\n\"signers\": [\n%s\n]\n}"
+	allValid := signer(keyIDs[0], "") + ",\n" + signer(keyIDs[1], "") + ",\n" + signer(keyIDs[2], "")
+	oneBad := signer(keyIDs[0], "") + ",\n" + signer(keyIDs[1], "\"bad signature\",\n\"detail\": \"crypto/rsa: verification error\"") + ",\n" + signer(keyIDs[2], "")
+
+	allSigners := []string{"-signers", "ecdsa.pub,rsa.pub,ed25519.pub"}
+	verify("All of 3", cosigned, 0, fmt.Sprintf(valid, "all", allValid), allSigners...)
+	verify("All of 3 with a bad signature", string(buff), 17, fmt.Sprintf(insufficient, "2 of 3 keys have valid signatures, but the policy requires 3", "all", oneBad), allSigners...)
+	verify("2 of 3 with a bad signature", string(buff), 0, fmt.Sprintf(valid, "2", oneBad), append([]string{"-policy", "2"}, allSigners...)...)
+	verify("Any of 3 with a bad signature", string(buff), 0, fmt.Sprintf(valid, "any", oneBad), append([]string{"-policy", "any"}, allSigners...)...)
+	verify("Signer given by -public", cosigned, 0, fmt.Sprintf(valid, "all", signer(keyIDs[0], "")), "-public", "ecdsa.pub")
+	verify("All of the signers", string(buff), 0, fmt.Sprintf(valid, "all", signer(keyIDs[2], "")+",\n"+signer(keyIDs[0], "")), "-signers", "ed25519.pub,ecdsa.pub")
+	verify("Signer without a signature", signed, 17, fmt.Sprintf(insufficient, "1 of 2 keys have valid signatures, but the policy requires 2", "all", signer(keyIDs[2], "\"bad signature\",\n\"detail\": \"Signed message has no signature by this key\"")+",\n"+signer(keyIDs[0], "")), "-signers", "ed25519.pub,ecdsa.pub")
+
+	checkFailure(t, runMain(t, &files, cosigned, "-verify", "-public", "ecdsa.pub", "-policy", "2"), 3, "Signature policy 2 requires 2 keys, but there are only 1")
+	checkFailure(t, runMain(t, &files, cosigned, "-verify", "-signers", "ecdsa.pub,rsa.pub,ed25519.pub", "-policy", "4"), 1, "Option -policy requires 4 keys, but -signers lists only 3")
+	checkFailure(t, runMain(t, &files, cosigned, "add-signature", "-private", "ecdsa.priv", "-public", "ecdsa.pub"), 5, fmt.Sprintf("Signed message is already signed by key %s", keyIDs[0]))
+	checkFailure(t, runMain(t, &files, string(buff), "add-signature"), 2, fmt.Sprintf("Signature by key %s is not valid (bad signature), so the signed message can't be co-signed", keyIDs[1]))
+
+	single := run("Hello, World!", "-ed25519", "-private", "ed25519.priv", "-public", "ed25519.pub")
+	converted := run(single, "add-signature", "-private", "rsa.priv", "-public", "rsa.pub")
+	if doc = parse(converted); (len(doc.Signatures) != 2) || (doc.Signature != "") || (doc.Signatures[0].Pubkey != parse(single).Pubkey) {
+		t.Errorf("Co-signed message should have the signature it had, and the co-signature. Got %#v instead.", doc)
+	}
+	verify("Co-signed signed message", converted, 0, fmt.Sprintf(valid, "all", signer(keyIDs[2], "")+",\n"+signer(keyIDs[1], "")), "-signers", "ed25519.pub,rsa.pub")
+	// The co-signature is of the digest by the hash of the signed message,
+	// whatever the hash options:
+	sha512 := run("Hello, World!", "-ed25519", "-private", "ed25519.priv", "-public", "ed25519.pub", "-hash", "sha512")
+	cosignedSHA512 := run(sha512, "add-signature", "-private", "rsa.priv", "-public", "rsa.pub")
+	verify("Co-signed signed message digested with SHA-512", cosignedSHA512, 0, fmt.Sprintf(valid, "all", signer(keyIDs[2], "")+",\n"+signer(keyIDs[1], "")), "-signers", "ed25519.pub,rsa.pub")
+
+	v2 := run("Hello, World!", "-envelope", "v2")
+	checkFailure(t, runMain(t, &files, v2, "add-signature"), 2, "Signed messages of version 2 can't be co-signed, as their signature covers the key that made it")
+}
@@ -0,0 +1,62 @@
+package codechallenge
+
+import (
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+)
+
+// NormalizationForm is the Unicode normalization form applied to text input
+// before it is signed, so that canonically equivalent messages produce the
+// same signature.
+type NormalizationForm int
+
+// Unicode normalization forms
+const (
+	NoNormalization NormalizationForm = iota
+	NFC
+	NFD
+	NFKC
+)
+
+// normalizationFormNames maps each NormalizationForm to its name.
+var normalizationFormNames = map[NormalizationForm]string{
+	NoNormalization: "",
+	NFC:             "NFC",
+	NFD:             "NFD",
+	NFKC:            "NFKC",
+}
+
+// ParseNormalizationForm returns the NormalizationForm named by name. Names
+// are not case sensitive.
+func ParseNormalizationForm(name string) (NormalizationForm, error) {
+	for form, formName := range normalizationFormNames {
+		if (formName != "") && strings.EqualFold(formName, name) {
+			return form, nil
+		}
+	}
+	return NoNormalization, fmt.Errorf("Unrecognized normalization form %#v: expected NFC, NFD or NFKC", name)
+}
+
+// String returns the name of the normalization form, or an empty string if no
+// normalization is applied.
+func (nf NormalizationForm) String() string {
+	name, ok := normalizationFormNames[nf]
+	if !ok {
+		return fmt.Sprintf("Unknown NormalizationForm %#v (INTERNAL ERROR)", int(nf))
+	}
+	return name
+}
+
+// Apply returns s converted to the normalization form nf.
+func (nf NormalizationForm) Apply(s string) string {
+	switch nf {
+	case NFC:
+		return norm.NFC.String(s)
+	case NFD:
+		return norm.NFD.String(s)
+	case NFKC:
+		return norm.NFKC.String(s)
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package openpgp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Armor block types
+const (
+	SignatureBlock     = "PGP SIGNATURE"
+	PublicKeyBlock     = "PGP PUBLIC KEY BLOCK"
+	SignedMessageBlock = "PGP SIGNED MESSAGE"
+)
+
+// armorLineLength is the length of the base64 lines of an armored block.
+const armorLineLength = 64
+
+// crc24 returns the CRC-24 checksum of data, as defined by RFC 4880.
+func crc24(data []byte) uint32 {
+	crc := uint32(0xb704ce)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if (crc & 0x1000000) != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+// Armor returns data as an ASCII armored block of type blockType, with its
+// checksum.
+func Armor(blockType string, data []byte) []byte {
+	result := &bytes.Buffer{}
+	fmt.Fprintf(result, "-----BEGIN %s-----\n\n", blockType)
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > armorLineLength {
+		result.WriteString(encoded[:armorLineLength] + "\n")
+		encoded = encoded[armorLineLength:]
+	}
+	result.WriteString(encoded + "\n")
+	crc := crc24(data)
+	fmt.Fprintf(result, "=%s\n", base64.StdEncoding.EncodeToString([]byte{byte(crc >> 16), byte(crc >> 8), byte(crc)}))
+	fmt.Fprintf(result, "-----END %s-----\n", blockType)
+	return result.Bytes()
+}
+
+// Dearmor returns the data in the first ASCII armored block of type
+// blockType in text, checking its checksum if it has one. Armor headers are
+// ignored.
+func Dearmor(blockType string, text string) ([]byte, error) {
+	begin := fmt.Sprintf("-----BEGIN %s-----", blockType)
+	end := fmt.Sprintf("-----END %s-----", blockType)
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == begin {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("Input does not contain an armored %s", blockType)
+	}
+	// Skip the armor headers, which end with a blank line:
+	for (start < len(lines)) && (strings.TrimSpace(lines[start]) != "") {
+		start++
+	}
+	encoded := ""
+	checksum := ""
+	for _, line := range lines[start:] {
+		line = strings.TrimSpace(line)
+		if line == end {
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("Armored %s is not valid base64: %s", blockType, err.Error())
+			}
+			if checksum != "" {
+				crc, err := base64.StdEncoding.DecodeString(checksum)
+				if (err != nil) || (len(crc) != 3) {
+					return nil, fmt.Errorf("Armored %s has an invalid checksum", blockType)
+				}
+				if (uint32(crc[0])<<16 | uint32(crc[1])<<8 | uint32(crc[2])) != crc24(data) {
+					return nil, fmt.Errorf("Armored %s checksum does not match its content", blockType)
+				}
+			}
+			return data, nil
+		}
+		if strings.HasPrefix(line, "=") && (len(line) == 5) {
+			checksum = line[1:]
+		} else {
+			encoded += line
+		}
+	}
+	return nil, errors.New("Armored " + blockType + " is missing its end line")
+}
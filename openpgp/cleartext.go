@@ -0,0 +1,96 @@
+package openpgp
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Lines delimiting a cleartext signed message
+const (
+	cleartextBegin = "-----BEGIN " + SignedMessageBlock + "-----"
+	signatureBegin = "-----BEGIN " + SignatureBlock + "-----"
+)
+
+// SignDetached returns an armored binary signature of data by signer, made
+// at created.
+func SignDetached(signer crypto.Signer, randReader io.Reader, hash crypto.Hash, data []byte, created time.Time) ([]byte, error) {
+	body, err := sign(signer, randReader, BinarySignature, hash, created, nil, data)
+	if err != nil {
+		return nil, err
+	}
+	return Armor(SignatureBlock, (&Packet{Tag: SignatureTag, Body: body}).Marshal()), nil
+}
+
+// ParseDetached parses an armored signature.
+func ParseDetached(armored string) (*Signature, error) {
+	data, err := Dearmor(SignatureBlock, armored)
+	if err != nil {
+		return nil, err
+	}
+	packets, err := ParsePackets(data)
+	if err != nil {
+		return nil, err
+	}
+	if (len(packets) != 1) || (packets[0].Tag != SignatureTag) {
+		return nil, errors.New("Armored " + SignatureBlock + " does not contain a single signature")
+	}
+	return parseSignature(packets[0].Body)
+}
+
+// SignCleartext returns text signed by signer at created, in the cleartext
+// signature framework. Trailing whitespace isn't signed, so it is removed
+// from each line, and lines starting with a dash are escaped.
+func SignCleartext(signer crypto.Signer, randReader io.Reader, hash crypto.Hash, text string, created time.Time) ([]byte, error) {
+	body, err := sign(signer, randReader, TextSignature, hash, created, nil, []byte(text))
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(canonicalText([]byte(text))), "\r\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "-") {
+			lines[i] = "- " + line
+		}
+	}
+	result := fmt.Sprintf("%s\nHash: %s\n\n%s\n", cleartextBegin, hashAlgorithms[hash].name, strings.Join(lines, "\n"))
+	return append([]byte(result), Armor(SignatureBlock, (&Packet{Tag: SignatureTag, Body: body}).Marshal())...), nil
+}
+
+// ParseCleartext parses a cleartext signed message, returning its text in
+// the canonical form that was signed, and its signature. Armor headers are
+// ignored.
+func ParseCleartext(message string) (string, *Signature, error) {
+	lines := strings.Split(strings.Replace(message, "\r\n", "\n", -1), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.TrimRight(line, " \t") == cleartextBegin {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return "", nil, errors.New("Input is not a cleartext signed message")
+	}
+	// Skip the armor headers, which end with a blank line:
+	for (start < len(lines)) && (strings.TrimSpace(lines[start]) != "") {
+		start++
+	}
+	start++
+	for end := start; end < len(lines); end++ {
+		if strings.TrimRight(lines[end], " \t") == signatureBegin {
+			text := make([]string, 0, end-start)
+			for _, line := range lines[start:end] {
+				text = append(text, strings.TrimPrefix(line, "- "))
+			}
+			sig, err := ParseDetached(strings.Join(lines[end:], "\n"))
+			if err != nil {
+				return "", nil, err
+			}
+			return string(canonicalText([]byte(strings.Join(text, "\n")))), sig, nil
+		}
+	}
+	return "", nil, errors.New("Cleartext signed message is missing its signature")
+}
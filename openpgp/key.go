@@ -0,0 +1,216 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+)
+
+// Public key algorithms
+const (
+	RSAAlgorithm   byte = 1
+	ECDSAAlgorithm byte = 19
+	EdDSAAlgorithm byte = 22
+)
+
+// KeyCreationTime is the creation time of every key. Key files don't record
+// when they were created, and the fingerprint of a key depends on it, so a
+// fixed time gives each key a stable fingerprint.
+var KeyCreationTime = time.Unix(0, 0)
+
+// curveOIDs maps the supported ECDSA curves to their object identifiers, in
+// the form OpenPGP encodes them.
+var curveOIDs = map[elliptic.Curve][]byte{
+	elliptic.P256(): {0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07},
+	elliptic.P384(): {0x2b, 0x81, 0x04, 0x00, 0x22},
+	elliptic.P521(): {0x2b, 0x81, 0x04, 0x00, 0x23},
+}
+
+// ed25519OID is the object identifier of Ed25519, as used by EdDSA keys.
+var ed25519OID = []byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01}
+
+// PublicKey is a v4 OpenPGP public key.
+type PublicKey struct {
+	Key     crypto.PublicKey
+	Created time.Time
+}
+
+// NewPublicKey returns key as an OpenPGP public key created at
+// KeyCreationTime.
+func NewPublicKey(key crypto.PublicKey) (*PublicKey, error) {
+	result := &PublicKey{Key: key, Created: KeyCreationTime}
+	if _, err := result.Algorithm(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Algorithm returns the public key algorithm of the key.
+func (pk *PublicKey) Algorithm() (byte, error) {
+	switch typedKey := pk.Key.(type) {
+	case *rsa.PublicKey:
+		return RSAAlgorithm, nil
+	case *ecdsa.PublicKey:
+		if _, ok := curveOIDs[typedKey.Curve]; !ok {
+			return 0, fmt.Errorf("Unsupported OpenPGP ECDSA curve %s", typedKey.Curve.Params().Name)
+		}
+		return ECDSAAlgorithm, nil
+	case ed25519.PublicKey:
+		return EdDSAAlgorithm, nil
+	}
+	return 0, fmt.Errorf("Public key did not conform to recognized algorithm: %T", pk.Key)
+}
+
+// Body returns the body of the public key packet of the key.
+func (pk *PublicKey) Body() []byte {
+	result := []byte{4, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(result[1:], uint32(pk.Created.Unix()))
+	switch typedKey := pk.Key.(type) {
+	case *rsa.PublicKey:
+		result[5] = RSAAlgorithm
+		result = append(result, marshalMPI(typedKey.N.Bytes())...)
+		result = append(result, marshalMPI(big.NewInt(int64(typedKey.E)).Bytes())...)
+	case *ecdsa.PublicKey:
+		result[5] = ECDSAAlgorithm
+		oid := curveOIDs[typedKey.Curve]
+		result = append(append(result, byte(len(oid))), oid...)
+		result = append(result, marshalMPI(elliptic.Marshal(typedKey.Curve, typedKey.X, typedKey.Y))...)
+	case ed25519.PublicKey:
+		result[5] = EdDSAAlgorithm
+		result = append(append(result, byte(len(ed25519OID))), ed25519OID...)
+		result = append(result, marshalMPI(append([]byte{0x40}, typedKey...))...)
+	}
+	return result
+}
+
+// hashPrefix returns what is hashed for the key, when it is certified.
+func (pk *PublicKey) hashPrefix() []byte {
+	body := pk.Body()
+	return append([]byte{0x99, byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// Fingerprint returns the v4 fingerprint of the key.
+func (pk *PublicKey) Fingerprint() []byte {
+	hash := sha1.Sum(pk.hashPrefix())
+	return hash[:]
+}
+
+// KeyID returns the key ID of the key: the low 64 bits of its fingerprint.
+func (pk *PublicKey) KeyID() []byte {
+	return pk.Fingerprint()[12:]
+}
+
+// parsePublicKey parses the body of a v4 public key packet.
+func parsePublicKey(body []byte) (*PublicKey, error) {
+	if (len(body) < 6) || (body[0] != 4) {
+		return nil, errors.New("OpenPGP public key is not a v4 key")
+	}
+	result := &PublicKey{Created: time.Unix(int64(binary.BigEndian.Uint32(body[1:])), 0)}
+	material := body[6:]
+	switch body[5] {
+	case RSAAlgorithm:
+		n, rest, err := parseMPI(material)
+		if err != nil {
+			return nil, err
+		}
+		e, _, err := parseMPI(rest)
+		if err != nil {
+			return nil, err
+		}
+		result.Key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case ECDSAAlgorithm, EdDSAAlgorithm:
+		if (len(material) < 1) || (len(material) < 1+int(material[0])) {
+			return nil, errors.New("OpenPGP public key is truncated")
+		}
+		oid := material[1 : 1+material[0]]
+		point, _, err := parseMPI(material[1+material[0]:])
+		if err != nil {
+			return nil, err
+		}
+		if body[5] == EdDSAAlgorithm {
+			if !bytes.Equal(oid, ed25519OID) || (len(point) != 1+ed25519.PublicKeySize) || (point[0] != 0x40) {
+				return nil, errors.New("Unsupported OpenPGP EdDSA key: only Ed25519 is supported")
+			}
+			result.Key = ed25519.PublicKey(point[1:])
+			break
+		}
+		for curve, curveOID := range curveOIDs {
+			if bytes.Equal(oid, curveOID) {
+				x, y := elliptic.Unmarshal(curve, point)
+				if x == nil {
+					return nil, errors.New("OpenPGP ECDSA public key is not a point on its curve")
+				}
+				result.Key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+			}
+		}
+		if result.Key == nil {
+			return nil, fmt.Errorf("Unsupported OpenPGP ECDSA curve %x", oid)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported OpenPGP public key algorithm %d", body[5])
+	}
+	return result, nil
+}
+
+// ExportPublicKey returns the armored public key of signer, with the user ID
+// userID, self-certified at created.
+func ExportPublicKey(signer crypto.Signer, randReader io.Reader, userID string, hash crypto.Hash, created time.Time) ([]byte, error) {
+	key, err := NewPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	certified := key.hashPrefix()
+	certified = append(certified, 0xb4, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(certified[len(certified)-4:], uint32(len(userID)))
+	certified = append(certified, userID...)
+	// The key may certify and sign, and prefers the SHA-2 hashes:
+	extra := append(subpacket(keyFlagsSubpacket, []byte{0x03}), subpacket(preferredHashSubpacket, []byte{8, 9, 10})...)
+	certification, err := sign(signer, randReader, PositiveCertification, hash, created, extra, certified)
+	if err != nil {
+		return nil, err
+	}
+	result := (&Packet{Tag: PublicKeyTag, Body: key.Body()}).Marshal()
+	result = append(result, (&Packet{Tag: UserIDTag, Body: []byte(userID)}).Marshal()...)
+	result = append(result, (&Packet{Tag: SignatureTag, Body: certification}).Marshal()...)
+	return Armor(PublicKeyBlock, result), nil
+}
+
+// ParsePublicKey parses the primary key and user IDs of an armored public
+// key. Self-signatures, and any subkeys, are ignored.
+func ParsePublicKey(armored string) (*PublicKey, []string, error) {
+	data, err := Dearmor(PublicKeyBlock, armored)
+	if err != nil {
+		return nil, nil, err
+	}
+	packets, err := ParsePackets(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if (len(packets) == 0) || (packets[0].Tag != PublicKeyTag) {
+		return nil, nil, errors.New("OpenPGP public key block does not start with a public key")
+	}
+	key, err := parsePublicKey(packets[0].Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	userIDs := []string{}
+	for _, packet := range packets[1:] {
+		if packet.Tag == PublicKeyTag {
+			break
+		}
+		if packet.Tag == UserIDTag {
+			userIDs = append(userIDs, string(packet.Body))
+		}
+	}
+	return key, userIDs, nil
+}
@@ -0,0 +1,381 @@
+package openpgp_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"github.com/smartedge/codechallenge/openpgp"
+	"github.com/smartedge/codechallenge/testtools"
+	"strings"
+	"testing"
+	"time"
+)
+
+// GPGText is the text signed by the GPG fixtures.
+const GPGText = "Fixture text\n-with a dash   \nend\n"
+
+// GPGEd25519Key is an Ed25519 key exported by `gpg --armor --export`.
+const GPGEd25519Key = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mDMEatUaBBYJKwYBBAHaRw8BAQdAsCXrFohzGBHN9wEWpCtzhF1Mq3/+1RjfEM52
+n3TZrjy0JUZpeHR1cmUgZWQyNTUxOSA8ZWQyNTUxOUBleGFtcGxlLmNvbT6IkAQT
+FggAOBYhBFEFNNRpZqptK7xj82DPD66yXU6PBQJq1RoEAhsDBQsJCAcCBhUKCQgL
+AgQWAgMBAh4BAheAAAoJEGDPD66yXU6PdXMA/jIEvU6HtgZVo8V11dOWXgOUu577
+i73/GEOQj8Es8EDGAP9WcxSTzw4nfOkH/6zzHAqM+M6bx9mSW/Sx4LzW2dVODQ==
+=NfOD
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+// GPGEd25519Cleartext is GPGText signed with GPGEd25519Key by
+// `gpg --clearsign --digest-algo SHA256`.
+const GPGEd25519Cleartext = `-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+
+Fixture text
+- -with a dash   
+end
+-----BEGIN PGP SIGNATURE-----
+
+iIoEARYIADIWIQRRBTTUaWaqbSu8Y/Ngzw+usl1OjwUCatUaBBQcZWQyNTUxOUBl
+eGFtcGxlLmNvbQAKCRBgzw+usl1Ojx+wAQCXEF1rPYEAGPJHliV4vhjxEmEesisc
+eUXa22F4WJGJygEAiUpqYoipmxE0WnuLOjR2eOLe0GH87qGNiZIXk+Q2EQQ=
+=idjl
+-----END PGP SIGNATURE-----
+`
+
+// GPGEd25519Detached is GPGText signed with GPGEd25519Key by
+// `gpg --armor --detach-sign --digest-algo SHA256`.
+const GPGEd25519Detached = `-----BEGIN PGP SIGNATURE-----
+
+iIoEABYIADIWIQRRBTTUaWaqbSu8Y/Ngzw+usl1OjwUCatUaBBQcZWQyNTUxOUBl
+eGFtcGxlLmNvbQAKCRBgzw+usl1Oj4MZAP0VZ+ylkWh6fz8AwR22/wCVNvZqgjOd
+mZ3ufXwRf6IAlwEAhxdl3AWVJyYTYucHdDZ3bjxvQxyz2a0JAQJ3S1muEg4=
+=TgWe
+-----END PGP SIGNATURE-----
+`
+
+// GPGECDSAKey is an ECDSA P-256 key exported by `gpg --armor --export`.
+const GPGECDSAKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mFIEatUaBBMIKoZIzj0DAQcCAwQIsuEv/gYitmkpAbopdP0sEf/I7o1FZ4XqXHEk
+cykONxdL55k5EYbX+wkTjsd2lgp7+doLXFlVsL0YA4fdhfhwtCdGaXh0dXJlIG5p
+c3RwMjU2IDxuaXN0cDI1NkBleGFtcGxlLmNvbT6IkAQTEwgAOBYhBNCvuTGZZPRS
+K1vJ/mCd+vpSGsehBQJq1RoEAhsDBQsJCAcCBhUKCQgLAgQWAgMBAh4BAheAAAoJ
+EGCd+vpSGsehKJgBAKD1DTulW0mEQCM2+dhZyhxYMPzl+5HHFZUmzNG5WjpLAPsH
+2erbqtyZz3f1vlJsoZPhtqaOGt1/Whi7gtql6WEjyg==
+=5OH5
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+// GPGECDSACleartext is GPGText signed with GPGECDSAKey by
+// `gpg --clearsign --digest-algo SHA256`.
+const GPGECDSACleartext = `-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+
+Fixture text
+- -with a dash   
+end
+-----BEGIN PGP SIGNATURE-----
+
+iIsEARMIADMWIQTQr7kxmWT0Uitbyf5gnfr6UhrHoQUCatUaBBUcbmlzdHAyNTZA
+ZXhhbXBsZS5jb20ACgkQYJ36+lIax6E4LgD9GJecXeUKMB1UAyFVWXmDXRrS0HU7
+dk3QUr+3kIuiCIcA/ilF1GfnsUm+90N1j58hJzdq2cO+5zEvHmiqY2SmnvPL
+=fdg5
+-----END PGP SIGNATURE-----
+`
+
+// GPGRSADetached is GPGText signed with an RSA key by
+// `gpg --armor --detach-sign --digest-algo SHA256`.
+const GPGRSADetached = `-----BEGIN PGP SIGNATURE-----
+
+iQFIBAABCAAyFiEE+l9LuNTpk8N8q+AmZugCXC4NNaMFAmrVGgQUHHJzYTIwNDhA
+ZXhhbXBsZS5jb20ACgkQZugCXC4NNaNL5Af9Grfam3D5YU/3DfG8b61s2HZklS6V
+DRw71qUhFhnIekImuPp4Yomto+QbsDwlTFAeMpaM5kzwL+xJ/v8TqI3w1kQ3HDQz
+ApQIKc4r10FvpEIBavsYjMpimGSKrC6dZ9Dk0KYe+EcmfoGKmgia8DsAnVx06o9c
+QSTsiWZ8X3xdyn1IJYEgzpKMQRwOeRr28CuV5JB/b7BKJnzY52CdOHHAHxVNdNbU
+avrohrV3irXZg/vfUhKil641awRS9+JsEzV8qdMRVXOZ1r2rclQT+vXj6TvN9B0G
+I5uTx1W3ui6K7dBkUHd+0CgjT6RPpSvztPaqyNqxNCp+xvO+SwJHaObI2Q==
+=Zgdd
+-----END PGP SIGNATURE-----
+`
+
+// GPGRSAKey is the RSA key that signed GPGRSADetached.
+const GPGRSAKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mQENBGrVGgQBCACaDUhGbX8kMa8Xjyryezv1YJ1voIcyXK4fz0qITfhnTY580Kzs
+kOSSH255MWBlpA21MNXzTNl3DctYk4AJ92IhgjdLk6ez/PJssHyggv9NL5FtUoKu
+OFv8+51fotZbCeTSY+cvDClsf3Flqe8E77LYU6k825HD+Nx5JJW0svqO74VYo88w
+oixs8YoqPKKtzsU4sYEf83ktc/uqFKlZEKE55bE33uaRS7JEvx1hfMSTUhitbR6B
+pMrU3ZvqqI/pMWOK/NgpPePc3VwpuQEZDR2kv/zMaAN1AkUjqKVwKCfpZClhE/tY
+/grHAb/+u0tbxHWEwu4W/c3ydAuTFd7dyTKTABEBAAG0JUZpeHR1cmUgcnNhMjA0
+OCA8cnNhMjA0OEBleGFtcGxlLmNvbT6JAU4EEwEKADgWIQT6X0u41OmTw3yr4CZm
+6AJcLg01owUCatUaBAIbAwULCQgHAgYVCgkICwIEFgIDAQIeAQIXgAAKCRBm6AJc
+Lg01o6rLCACJKzC0BfZbN7ugX6EVLR4GfKGQR+TNEVxq+VEw0t9TW2yjOrIOcgmv
+aVJW/GF2PPnSTsd9CsG98Axj6Gts3bMQ4u4i7C+j7rN+BDTfiEDVpxop+gpsGzjk
+0X+NFhsmrX+mSrrU8UCnTWeMt3oo71gbF48hweNHqnC4a/nga885etL/YmIcK/jj
+GqrVRT29+HcJwzbs7tael2/b2CprSZe9qI6Nk3gdjInYBqFaBADSpX+QTXrK9OXx
+Fl+A8onE1ZA280n+dNPB4108pFClP1tqN2v0ViWAJCVtit11PI+fongsER6gqqUp
+MHjUU828rc1PLMIvpqIkF+T3YAbdpDiu
+=Rhm5
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+// TestArmor verifies that armored data dearmors to itself, and that
+// corruption is detected by its checksum.
+func TestArmor(t *testing.T) {
+	data := []byte(strings.Repeat("Hello, World! ", 10))
+	armored := string(openpgp.Armor(openpgp.SignatureBlock, data))
+	dearmored, err := openpgp.Dearmor(openpgp.SignatureBlock, armored)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if string(dearmored) != string(data) {
+		t.Errorf("Dearmored data should be %#v. Got %#v instead.", string(data), string(dearmored))
+	}
+	for desc, tc := range map[string]struct {
+		armored string
+		err     *testtools.ErrorSpec
+	}{
+		"Corrupted": {
+			armored: strings.Replace(armored, "SGVsbG8", "SGVsbG9", 1),
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Armored PGP SIGNATURE checksum does not match its content"},
+		},
+		"Missing end line": {
+			armored: strings.Split(armored, "-----END")[0],
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Armored PGP SIGNATURE is missing its end line"},
+		},
+		"Other block type": {
+			armored: string(openpgp.Armor(openpgp.PublicKeyBlock, data)),
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Input does not contain an armored PGP SIGNATURE"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			_, err := openpgp.Dearmor(openpgp.SignatureBlock, tc.armored)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
+
+// TestSignAndVerify verifies that exported keys, cleartext signed messages
+// and detached signatures parse back to valid signatures for each kind of
+// key, and that changes to the text are detected.
+func TestSignAndVerify(t *testing.T) {
+	ecdsaP256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecdsaP384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	created := time.Unix(1567339200, 0)
+	text := "Hello, World!\n-----BEGIN PGP SIGNATURE-----\nTrailing whitespace \t\n"
+	for desc, tc := range map[string]struct {
+		signer crypto.Signer
+		hash   crypto.Hash
+	}{
+		"ECDSA P-256": {signer: ecdsaP256, hash: crypto.SHA256},
+		"ECDSA P-384": {signer: ecdsaP384, hash: crypto.SHA384},
+		"Ed25519":     {signer: ed25519Key, hash: crypto.SHA512},
+		"RSA":         {signer: rsaKey, hash: crypto.SHA256},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			armoredKey, err := openpgp.ExportPublicKey(tc.signer, rand.Reader, "Test Signer <test@example.com>", tc.hash, created)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			key, userIDs, err := openpgp.ParsePublicKey(string(armoredKey))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if (len(userIDs) != 1) || (userIDs[0] != "Test Signer <test@example.com>") {
+				tt.Errorf("Parsed user IDs should be the exported one. Got %#v instead.", userIDs)
+			}
+			expectedKey, _ := openpgp.NewPublicKey(tc.signer.Public())
+			if fmt.Sprintf("%X", key.Fingerprint()) != fmt.Sprintf("%X", expectedKey.Fingerprint()) {
+				tt.Errorf("Parsed key should have fingerprint %X. Got %X instead.", expectedKey.Fingerprint(), key.Fingerprint())
+			}
+			message, err := openpgp.SignCleartext(tc.signer, rand.Reader, tc.hash, text, created)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			signedText, sig, err := openpgp.ParseCleartext(string(message))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if (sig.Hash != tc.hash) || !sig.Created.Equal(created) {
+				tt.Errorf("Parsed signature should have hash %v made at %s. Got %v made at %s instead.", tc.hash, created, sig.Hash, sig.Created)
+			}
+			if valid, err := sig.Verify(key, []byte(signedText)); !valid {
+				tt.Errorf("Cleartext signature should be valid: %v", err)
+			}
+			if valid, err := sig.Verify(key, []byte(signedText+"!")); valid || (err != nil) {
+				tt.Errorf("Cleartext signature of changed text should not be valid, without error. Got %v, %v instead.", valid, err)
+			}
+			detached, err := openpgp.SignDetached(tc.signer, rand.Reader, tc.hash, []byte(text), created)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			sig, err = openpgp.ParseDetached(string(detached))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if valid, err := sig.Verify(key, []byte(text)); !valid {
+				tt.Errorf("Detached signature should be valid: %v", err)
+			}
+			if valid, _ := sig.Verify(key, []byte(signedText)); valid {
+				tt.Error("Detached signature of the canonical text should not be valid, as binary signatures don't canonicalize")
+			}
+		})
+	}
+}
+
+// TestVerifyOtherKey verifies that a signature isn't valid for a key other
+// than its issuer.
+func TestVerifyOtherKey(t *testing.T) {
+	signer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	signerKey, _ := openpgp.NewPublicKey(signer.Public())
+	otherKey, _ := openpgp.NewPublicKey(other.Public())
+	ed25519PublicKey, _ := openpgp.NewPublicKey(ed25519Key.Public())
+	detached, err := openpgp.SignDetached(signer, rand.Reader, crypto.SHA256, []byte("Hello, World!"), time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	sig, err := openpgp.ParseDetached(string(detached))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	for desc, tc := range map[string]struct {
+		key *openpgp.PublicKey
+		err *testtools.ErrorSpec
+	}{
+		"Other ECDSA key": {
+			key: otherKey,
+			err: &testtools.ErrorSpec{Type: "*errors.errorString", Message: fmt.Sprintf("OpenPGP signature was made by key %X, not %X", signerKey.Fingerprint(), otherKey.Fingerprint())},
+		},
+		"Ed25519 key": {
+			key: ed25519PublicKey,
+			err: &testtools.ErrorSpec{Type: "*errors.errorString", Message: "OpenPGP signature algorithm 19 does not match the public key"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			valid, err := sig.Verify(tc.key, []byte("Hello, World!"))
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+			if valid {
+				tt.Error("Signature should not be valid for another key")
+			}
+		})
+	}
+}
+
+// TestGPGSignatures verifies signatures made by GPG, whose keys weren't
+// created at openpgp.KeyCreationTime, and whose signatures have subpackets
+// beyond those this package adds.
+func TestGPGSignatures(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		key         string
+		signature   string
+		cleartext   bool
+		fingerprint string
+		userID      string
+	}{
+		"Ed25519 cleartext": {
+			key:         GPGEd25519Key,
+			signature:   GPGEd25519Cleartext,
+			cleartext:   true,
+			fingerprint: "510534D46966AA6D2BBC63F360CF0FAEB25D4E8F",
+			userID:      "Fixture ed25519 <ed25519@example.com>",
+		},
+		"Ed25519 detached": {
+			key:         GPGEd25519Key,
+			signature:   GPGEd25519Detached,
+			fingerprint: "510534D46966AA6D2BBC63F360CF0FAEB25D4E8F",
+			userID:      "Fixture ed25519 <ed25519@example.com>",
+		},
+		"ECDSA cleartext": {
+			key:         GPGECDSAKey,
+			signature:   GPGECDSACleartext,
+			cleartext:   true,
+			fingerprint: "D0AFB9319964F4522B5BC9FE609DFAFA521AC7A1",
+			userID:      "Fixture nistp256 <nistp256@example.com>",
+		},
+		"RSA detached": {
+			key:         GPGRSAKey,
+			signature:   GPGRSADetached,
+			fingerprint: "FA5F4BB8D4E993C37CABE02666E8025C2E0D35A3",
+			userID:      "Fixture rsa2048 <rsa2048@example.com>",
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			key, userIDs, err := openpgp.ParsePublicKey(tc.key)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if fingerprint := fmt.Sprintf("%X", key.Fingerprint()); fingerprint != tc.fingerprint {
+				tt.Errorf("Parsed key should have fingerprint %s. Got %s instead.", tc.fingerprint, fingerprint)
+			}
+			if (len(userIDs) != 1) || (userIDs[0] != tc.userID) {
+				tt.Errorf("Parsed user IDs should be [%#v]. Got %#v instead.", tc.userID, userIDs)
+			}
+			var sig *openpgp.Signature
+			text := GPGText
+			if tc.cleartext {
+				text, sig, err = openpgp.ParseCleartext(tc.signature)
+			} else {
+				sig, err = openpgp.ParseDetached(tc.signature)
+			}
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if valid, err := sig.Verify(key, []byte(text)); !valid {
+				tt.Errorf("Signature should be valid: %v", err)
+			}
+		})
+	}
+}
+
+// TestParseErrors tests signatures that can't be parsed.
+func TestParseErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		cleartext bool
+		input     string
+		err       *testtools.ErrorSpec
+	}{
+		"Not cleartext signed": {
+			cleartext: true,
+			input:     GPGEd25519Detached,
+			err:       &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Input is not a cleartext signed message"},
+		},
+		"Missing signature": {
+			cleartext: true,
+			input:     strings.Split(GPGEd25519Cleartext, "-----BEGIN PGP SIGNATURE")[0],
+			err:       &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Cleartext signed message is missing its signature"},
+		},
+		"Public key": {
+			input: strings.Replace(GPGEd25519Key, "PUBLIC KEY BLOCK", "SIGNATURE", -1),
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Armored PGP SIGNATURE does not contain a single signature"},
+		},
+		"Truncated": {
+			input: string(openpgp.Armor(openpgp.SignatureBlock, []byte{0xc2, 0x10, 4, 0})),
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "OpenPGP packet is truncated"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			var err error
+			if tc.cleartext {
+				_, _, err = openpgp.ParseCleartext(tc.input)
+			} else {
+				_, err = openpgp.ParseDetached(tc.input)
+			}
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
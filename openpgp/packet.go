@@ -0,0 +1,126 @@
+// Package openpgp implements the parts of OpenPGP, as defined by RFC 4880,
+// needed to export the tool's RSA, ECDSA and Ed25519 keys as v4 public keys,
+// and to make and verify v4 signatures with them, either detached or in the
+// cleartext signature framework.
+package openpgp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Packet tags
+const (
+	SignatureTag = 2
+	PublicKeyTag = 6
+	UserIDTag    = 13
+)
+
+// Packet is an OpenPGP packet.
+type Packet struct {
+	Tag  byte
+	Body []byte
+}
+
+// Marshal returns the packet with a new format header.
+func (p *Packet) Marshal() []byte {
+	result := []byte{0xc0 | p.Tag}
+	length := len(p.Body)
+	switch {
+	case length < 192:
+		result = append(result, byte(length))
+	case length < 8384:
+		length -= 192
+		result = append(result, byte(length>>8)+192, byte(length))
+	default:
+		result = append(result, 0xff, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(result[2:], uint32(length))
+	}
+	return append(result, p.Body...)
+}
+
+// ParsePackets parses a sequence of packets with old or new format headers.
+// Packets of indeterminate or partial length are not supported, as keys and
+// signatures don't use them.
+func ParsePackets(data []byte) ([]*Packet, error) {
+	result := []*Packet{}
+	for offset := 0; offset < len(data); {
+		header := data[offset]
+		if (header & 0x80) == 0 {
+			return nil, fmt.Errorf("OpenPGP packet header 0x%02x is not valid, at offset %d", header, offset)
+		}
+		offset++
+		var tag byte
+		length := 0
+		if (header & 0x40) != 0 {
+			tag = header & 0x3f
+			if offset >= len(data) {
+				return nil, errors.New("OpenPGP packet is truncated")
+			}
+			first := int(data[offset])
+			switch {
+			case first < 192:
+				length = first
+				offset++
+			case first < 224:
+				if offset+2 > len(data) {
+					return nil, errors.New("OpenPGP packet is truncated")
+				}
+				length = ((first - 192) << 8) + int(data[offset+1]) + 192
+				offset += 2
+			case first == 255:
+				if offset+5 > len(data) {
+					return nil, errors.New("OpenPGP packet is truncated")
+				}
+				length = int(binary.BigEndian.Uint32(data[offset+1:]))
+				offset += 5
+			default:
+				return nil, fmt.Errorf("OpenPGP packet has a partial length, which is not supported, at offset %d", offset)
+			}
+		} else {
+			tag = (header >> 2) & 0x0f
+			lengthSize := map[byte]int{0: 1, 1: 2, 2: 4}[header&0x03]
+			if lengthSize == 0 {
+				return nil, fmt.Errorf("OpenPGP packet has an indeterminate length, which is not supported, at offset %d", offset)
+			}
+			if offset+lengthSize > len(data) {
+				return nil, errors.New("OpenPGP packet is truncated")
+			}
+			for _, b := range data[offset : offset+lengthSize] {
+				length = (length << 8) | int(b)
+			}
+			offset += lengthSize
+		}
+		if (length < 0) || (offset+length > len(data)) {
+			return nil, errors.New("OpenPGP packet is truncated")
+		}
+		result = append(result, &Packet{Tag: tag, Body: data[offset : offset+length]})
+		offset += length
+	}
+	return result, nil
+}
+
+// marshalMPI returns value as a multiprecision integer: its length in bits,
+// followed by its big-endian bytes without leading zeros.
+func marshalMPI(value []byte) []byte {
+	for (len(value) > 0) && (value[0] == 0) {
+		value = value[1:]
+	}
+	bitLength := new(big.Int).SetBytes(value).BitLen()
+	return append([]byte{byte(bitLength >> 8), byte(bitLength)}, value...)
+}
+
+// parseMPI returns the bytes of the multiprecision integer at the start of
+// data, and the rest of data.
+func parseMPI(data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errors.New("OpenPGP multiprecision integer is truncated")
+	}
+	byteLength := (int(binary.BigEndian.Uint16(data)) + 7) / 8
+	if len(data) < 2+byteLength {
+		return nil, nil, errors.New("OpenPGP multiprecision integer is truncated")
+	}
+	return data[2 : 2+byteLength], data[2+byteLength:], nil
+}
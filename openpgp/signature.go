@@ -0,0 +1,259 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Signature types
+const (
+	BinarySignature       byte = 0x00
+	TextSignature         byte = 0x01
+	PositiveCertification byte = 0x13
+)
+
+// Signature subpacket types
+const (
+	creationTimeSubpacket      = 2
+	issuerSubpacket            = 16
+	preferredHashSubpacket     = 21
+	keyFlagsSubpacket          = 27
+	issuerFingerprintSubpacket = 33
+)
+
+// hashAlgorithms maps the supported hashes to their OpenPGP identifiers and
+// names, as used in the armor headers of cleartext signatures.
+var hashAlgorithms = map[crypto.Hash]struct {
+	id   byte
+	name string
+}{
+	crypto.SHA256: {id: 8, name: "SHA256"},
+	crypto.SHA384: {id: 9, name: "SHA384"},
+	crypto.SHA512: {id: 10, name: "SHA512"},
+}
+
+// Signature is a parsed v4 signature packet.
+type Signature struct {
+	SigType           byte
+	PubKeyAlgorithm   byte
+	Hash              crypto.Hash
+	Created           time.Time
+	IssuerKeyID       []byte
+	IssuerFingerprint []byte
+	hashedPart        []byte
+	digestPrefix      []byte
+	values            [][]byte
+}
+
+// subpacket returns a signature subpacket of type subpacketType.
+func subpacket(subpacketType byte, data []byte) []byte {
+	return append([]byte{byte(len(data) + 1), subpacketType}, data...)
+}
+
+// canonicalText returns text in the canonical form signed by text
+// signatures: with trailing whitespace removed from each line, and lines
+// ending with CR LF.
+func canonicalText(text []byte) []byte {
+	lines := strings.Split(string(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return []byte(strings.Join(lines, "\r\n"))
+}
+
+// hashedData returns what a signature with hashedPart signs of data,
+// including its trailer.
+func hashedData(sigType byte, hashedPart []byte, data []byte) []byte {
+	if sigType == TextSignature {
+		data = canonicalText(data)
+	}
+	result := append(append([]byte{}, data...), hashedPart...)
+	result = append(result, 4, 0xff, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(result[len(result)-4:], uint32(len(hashedPart)))
+	return result
+}
+
+// sign returns the body of a v4 signature packet of data by signer, of type
+// sigType, made at created, with extra hashed subpackets after the creation
+// time and issuer fingerprint.
+func sign(signer crypto.Signer, randReader io.Reader, sigType byte, hash crypto.Hash, created time.Time, extra []byte, data []byte) ([]byte, error) {
+	key, err := NewPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	algorithm, _ := key.Algorithm()
+	hashAlgorithm, ok := hashAlgorithms[hash]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported OpenPGP hash algorithm %s", crypt.HashName(hash))
+	}
+	creationTime := make([]byte, 4)
+	binary.BigEndian.PutUint32(creationTime, uint32(created.Unix()))
+	hashedSubpackets := subpacket(creationTimeSubpacket, creationTime)
+	hashedSubpackets = append(hashedSubpackets, subpacket(issuerFingerprintSubpacket, append([]byte{4}, key.Fingerprint()...))...)
+	hashedSubpackets = append(hashedSubpackets, extra...)
+	hashedPart := []byte{4, sigType, algorithm, hashAlgorithm.id, byte(len(hashedSubpackets) >> 8), byte(len(hashedSubpackets))}
+	hashedPart = append(hashedPart, hashedSubpackets...)
+	signed := hashedData(sigType, hashedPart, data)
+	digest := crypt.NewDigestHash(hash, string(signed))
+	scheme := crypt.SignatureScheme{Hash: hash, RSAPadding: crypt.PKCS1v15Padding, ECDSAEncoding: crypt.RawEncoding}
+	var signature crypt.BinarySignature
+	if algorithm == EdDSAAlgorithm {
+		// EdDSA signs the digest, rather than what was hashed:
+		signature, err = crypt.SignWithScheme(signer, randReader, digest, scheme)
+	} else {
+		signature, err = crypt.SignWithScheme(signer, randReader, signed, scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	unhashedSubpackets := subpacket(issuerSubpacket, key.KeyID())
+	result := append(hashedPart, byte(len(unhashedSubpackets)>>8), byte(len(unhashedSubpackets)))
+	result = append(result, unhashedSubpackets...)
+	result = append(result, digest[:2]...)
+	if algorithm == RSAAlgorithm {
+		return append(result, marshalMPI(signature)...), nil
+	}
+	// ECDSA and EdDSA signatures are r and s:
+	half := len(signature) / 2
+	result = append(result, marshalMPI(signature[:half])...)
+	return append(result, marshalMPI(signature[half:])...), nil
+}
+
+// parseSubpackets parses signature subpackets into sig. Only the hashed
+// subpackets are trusted for anything but the issuer key ID.
+func (sig *Signature) parseSubpackets(data []byte, hashed bool) error {
+	for len(data) > 0 {
+		length := int(data[0])
+		offset := 1
+		switch {
+		case length >= 255:
+			if len(data) < 5 {
+				return errors.New("OpenPGP signature subpacket is truncated")
+			}
+			length = int(binary.BigEndian.Uint32(data[1:]))
+			offset = 5
+		case length >= 192:
+			if len(data) < 2 {
+				return errors.New("OpenPGP signature subpacket is truncated")
+			}
+			length = ((length - 192) << 8) + int(data[1]) + 192
+			offset = 2
+		}
+		if (length < 1) || (offset+length > len(data)) {
+			return errors.New("OpenPGP signature subpacket is truncated")
+		}
+		subpacketType := data[offset] & 0x7f
+		content := data[offset+1 : offset+length]
+		switch {
+		case hashed && (subpacketType == creationTimeSubpacket) && (len(content) == 4):
+			sig.Created = time.Unix(int64(binary.BigEndian.Uint32(content)), 0)
+		case hashed && (subpacketType == issuerFingerprintSubpacket) && (len(content) == 21) && (content[0] == 4):
+			sig.IssuerFingerprint = content[1:]
+		case (subpacketType == issuerSubpacket) && (len(content) == 8):
+			sig.IssuerKeyID = content
+		}
+		data = data[offset+length:]
+	}
+	return nil
+}
+
+// parseSignature parses the body of a v4 signature packet.
+func parseSignature(body []byte) (*Signature, error) {
+	if (len(body) < 6) || (body[0] != 4) {
+		return nil, errors.New("OpenPGP signature is not a v4 signature")
+	}
+	result := &Signature{SigType: body[1], PubKeyAlgorithm: body[2]}
+	for hash, hashAlgorithm := range hashAlgorithms {
+		if hashAlgorithm.id == body[3] {
+			result.Hash = hash
+		}
+	}
+	if result.Hash == 0 {
+		return nil, fmt.Errorf("Unsupported OpenPGP hash algorithm %d", body[3])
+	}
+	hashedLength := int(binary.BigEndian.Uint16(body[4:]))
+	if len(body) < 6+hashedLength+2 {
+		return nil, errors.New("OpenPGP signature is truncated")
+	}
+	result.hashedPart = body[:6+hashedLength]
+	if err := result.parseSubpackets(body[6:6+hashedLength], true); err != nil {
+		return nil, err
+	}
+	rest := body[6+hashedLength:]
+	unhashedLength := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+unhashedLength+2 {
+		return nil, errors.New("OpenPGP signature is truncated")
+	}
+	if err := result.parseSubpackets(rest[2:2+unhashedLength], false); err != nil {
+		return nil, err
+	}
+	result.digestPrefix = rest[2+unhashedLength : 4+unhashedLength]
+	rest = rest[4+unhashedLength:]
+	count := map[byte]int{RSAAlgorithm: 1, ECDSAAlgorithm: 2, EdDSAAlgorithm: 2}[result.PubKeyAlgorithm]
+	if count == 0 {
+		return nil, fmt.Errorf("Unsupported OpenPGP public key algorithm %d", result.PubKeyAlgorithm)
+	}
+	for i := 0; i < count; i++ {
+		value, remaining, err := parseMPI(rest)
+		if err != nil {
+			return nil, err
+		}
+		result.values = append(result.values, value)
+		rest = remaining
+	}
+	return result, nil
+}
+
+// leftPad returns value padded with leading zeros to size bytes.
+func leftPad(value []byte, size int) []byte {
+	if len(value) >= size {
+		return value
+	}
+	return append(make([]byte, size-len(value)), value...)
+}
+
+// Verify checks that sig is a signature of data by key, which must be its
+// issuer if the signature names one. An error explains why a signature isn't
+// valid.
+func (sig *Signature) Verify(key *PublicKey, data []byte) (bool, error) {
+	algorithm, err := key.Algorithm()
+	if err != nil {
+		return false, err
+	}
+	if algorithm != sig.PubKeyAlgorithm {
+		return false, fmt.Errorf("OpenPGP signature algorithm %d does not match the public key", sig.PubKeyAlgorithm)
+	}
+	if (sig.IssuerFingerprint != nil) && !bytes.Equal(sig.IssuerFingerprint, key.Fingerprint()) {
+		return false, fmt.Errorf("OpenPGP signature was made by key %X, not %X", sig.IssuerFingerprint, key.Fingerprint())
+	}
+	if (sig.IssuerKeyID != nil) && !bytes.Equal(sig.IssuerKeyID, key.KeyID()) {
+		return false, fmt.Errorf("OpenPGP signature was made by key %X, not %X", sig.IssuerKeyID, key.KeyID())
+	}
+	signed := hashedData(sig.SigType, sig.hashedPart, data)
+	digest := crypt.NewDigestHash(sig.Hash, string(signed))
+	if !bytes.Equal(digest[:2], sig.digestPrefix) {
+		return false, nil
+	}
+	scheme := crypt.SignatureScheme{Hash: sig.Hash, RSAPadding: crypt.PKCS1v15Padding, ECDSAEncoding: crypt.RawEncoding}
+	switch typedKey := key.Key.(type) {
+	case *rsa.PublicKey:
+		return crypt.VerifyWithScheme(typedKey, signed, leftPad(sig.values[0], typedKey.Size()), scheme)
+	case *ecdsa.PublicKey:
+		size := (typedKey.Curve.Params().BitSize + 7) / 8
+		signature := append(leftPad(sig.values[0], size), leftPad(sig.values[1], size)...)
+		return crypt.VerifyWithScheme(typedKey, signed, signature, scheme)
+	}
+	// EdDSA signs the digest, rather than what was hashed:
+	signature := append(leftPad(sig.values[0], ed25519.SignatureSize/2), leftPad(sig.values[1], ed25519.SignatureSize/2)...)
+	return crypt.VerifyWithScheme(key.Key, digest, signature, scheme)
+}
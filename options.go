@@ -1,22 +1,83 @@
 package codechallenge
 
 import (
+	"crypto"
 	"crypto/x509"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/smartedge/codechallenge/crypt"
 	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/dkim"
+	"github.com/smartedge/codechallenge/pki"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // UsageMessage is the message displayed when there is an error. The current
 // implementation documents each flag twice. This should be consolidated later.
 const (
-	UsageMessage = "  -help\n" +
+	UsageMessage = "  Commands:\n" +
+		"      sign-file path...\n" +
+		"        \tWrite a detached signature of each file to path.sig, instead of signing standard input\n" +
+		"      verify-file path...\n" +
+		"        \tVerify each file against its detached signature in path.sig\n" +
+		"      sign-manifest directory\n" +
+		"        \tWrite a signed manifest of every file in the directory to standard output\n" +
+		"      verify-manifest directory\n" +
+		"        \tVerify the directory against a signed manifest read from standard input, reporting added, removed and modified files\n" +
+		"      jwt\n" +
+		"        \tWrite a signed JWT of the claims given by the token options to standard output\n" +
+		"      verify-jwt\n" +
+		"        \tVerify a JWT read from standard input, checking its time claims\n" +
+		"      cwt\n" +
+		"        \tWrite a signed CWT of the claims given by the token options to standard output, in binary COSE format\n" +
+		"      verify-cwt\n" +
+		"        \tVerify a CWT read from standard input, checking its time claims\n" +
+		"      paseto\n" +
+		"        \tWrite a signed PASETO token of the claims given by the token options to standard output: v4.public for Ed25519 keys, or v3.public for ECDSA keys on P-384\n" +
+		"      verify-paseto\n" +
+		"        \tVerify a PASETO token read from standard input, checking its time claims\n" +
+		"      export-pgp-key\n" +
+		"        \tWrite the public key to standard output as an armored OpenPGP key, with the user ID given by -uid\n" +
+		"      export-ssh-key\n" +
+		"        \tWrite the public key to standard output in the format of authorized_keys and allowed_signers files\n" +
+		"      export-minisign-key\n" +
+		"        \tWrite the Ed25519 public key to standard output as a minisign public key file\n" +
+		"      attest path...\n" +
+		"        \tWrite a DSSE envelope of an in-toto Statement about each file, with the predicate given by -predicate-type and -predicate, to standard output\n" +
+		"      sign-http\n" +
+		"        \tWrite the Signature-Input and Signature headers of an HTTP message signature of the raw HTTP request read from standard input to standard output\n" +
+		"      verify-http\n" +
+		"        \tVerify the HTTP message signature of a raw HTTP request read from standard input\n" +
+		"      dkim\n" +
+		"        \tWrite the DKIM-Signature header field of the raw email message read from standard input, signed for -domain with the key of -selector, to standard output\n" +
+		"      verify-dkim\n" +
+		"        \tVerify the DKIM signature of a raw email message read from standard input against the DNS record given by -dns-record\n" +
+		"      export-dkim-record\n" +
+		"        \tWrite the value of the DNS TXT record that publishes the RSA or Ed25519 public key for DKIM to standard output\n" +
+		"      cert self-sign\n" +
+		"        \tWrite a self-signed X.509 certificate of the public key, with the profile given by the certificate options, to standard output in PEM format\n" +
+		"      csr\n" +
+		"        \tWrite a PKCS #10 certificate signing request for the public key, with the profile given by the certificate options, to standard output\n" +
+		"      ca init\n" +
+		"        \tCreate a local CA in -ca-dir with a new key-pair and a self-signed CA certificate, and write the certificate to standard output in PEM format\n" +
+		"      ca issue\n" +
+		"        \tWrite a certificate issued by the local CA for the CSR read from standard input, with its names and the profile given by the certificate options, to standard output in PEM format\n" +
+		"      ca revoke serial\n" +
+		"        \tRevoke the certificate with the serial number, in hex, issued by the local CA\n" +
+		"      ca crl\n" +
+		"        \tWrite a CRL of the certificates the local CA has revoked to standard output in PEM format\n" +
+		"      tsa-server\n" +
+		"        \tServe RFC 3161 time-stamp requests over HTTP on -listen, signing the tokens with the key-pair, whose TSA certificate is given by -cert\n" +
+		"      add-signature\n" +
+		"        \tAdd a co-signature by the key-pair, or by each of the key-pairs, to the signed message in JSON format read from standard input, and write the multi-signature document to standard output\n" +
+		"  -help\n" +
 		"    \tdisplay this help message.\n" +
+		"  -verify\n" +
+		"    \tverify a signed message read from standard input, instead of signing one.\n" +
 		"  Input format options:\n" +
 		"      -ascii\n" +
 		"        \tThis specifies that the message is ASCII content\n" +
@@ -24,19 +85,198 @@ const (
 		"        \tThis specifies that the message is raw binary content\n" +
 		"      -utf8\n" +
 		"        \tThis specifies that the message is UTF-8 content [default]\n" +
+		"      -encoding string\n" +
+		"        \tCharacter encoding of the input (ISO-8859-1, windows-1252 or UTF-16), transcoded to UTF-8 before signing\n" +
+		"      -normalize string\n" +
+		"        \tUnicode normalization form (NFC, NFD or NFKC) applied to text before signing\n" +
+		"      -digest\n" +
+		"        \tThis specifies that the message is a hex or base64 encoded digest, to be signed directly\n" +
 		"  Algorithm options:\n" +
 		"      -ecdsa\n" +
 		"        \tCauses the mesage to be signed with an ECDSA key-pair [default]\n" +
+		"      -ed25519\n" +
+		"        \tCauses the mesage to be signed with an Ed25519 key-pair\n" +
 		"      -rsa\n" +
 		"        \tCauses the mesage to be signed with an RSA key-pair\n" +
 		"      -bits uint\n" +
 		"        \tBit length of the RSA key [default=2048]\n" +
+		"      -curve string\n" +
+		"        \tElliptic curve (P-256, P-384 or P-521) of the ECDSA key [default=P-256]\n" +
+		"      -hash string\n" +
+		"        \tHash algorithm (sha256, sha384 or sha512) used to digest the message [default=sha256]\n" +
+		"  Output format options:\n" +
+		"      -format string\n" +
+		"        \tFormat of the signed message (json, jws, jws-json, cose, cms, cms-pem, pgp, sshsig, minisign or dsse) [default=json]\n" +
+		"      -alg string\n" +
+		"        \tJWS, COSE or HTTP message signature algorithm (ES256, ES384, ES512, RS256, PS256 or EdDSA, or rsa-pss-sha512, rsa-v1_5-sha256, ecdsa-p256-sha256, ecdsa-p384-sha384 or ed25519) [default is determined by the key]\n" +
+		"      -jwk\n" +
+		"        \tEmbed the public key in the JWS header as a JWK\n" +
+		"      -detached\n" +
+		"        \tOmit the payload from the JWS, COSE_Sign1, CMS or OpenPGP message\n" +
+		"      -payload string\n" +
+		"        \tfilepath of the payload of a detached JWS, COSE_Sign1, CMS, OpenPGP, SSH or minisign signature being verified\n" +
+		"      -cert string\n" +
+		"        \tfilepath of a PEM certificate of the signing key, to embed in CMS output, to replace the public key in JSON output, or the TSA certificate of tsa-server\n" +
+		"      -envelope string\n" +
+		"        \tVersion of the signed message in JSON format: v1, or v2 to also sign the input format, hash, algorithm, key ID, signing time and a random nonce [default=v1]\n" +
+		"      -not-before string\n" +
+		"        \tTime the signature of a version 2 envelope is valid from: a duration from now, an RFC 3339 time or seconds since the Unix epoch [default is the signing time]\n" +
+		"      -expires string\n" +
+		"        \tTime the signature of a version 2 envelope expires at, in the same format as -not-before [default is never]\n" +
+		"      -uid string\n" +
+		"        \tUser ID of the key written by export-pgp-key, such as \"Name <email>\"\n" +
+		"  Token options:\n" +
+		"      -claims string\n" +
+		"        \tfilepath of a JSON file of claims to include in the token\n" +
+		"      -iss string\n" +
+		"        \tIssuer claim of the token, or the issuer required when verifying one\n" +
+		"      -sub string\n" +
+		"        \tSubject claim of the token\n" +
+		"      -aud string\n" +
+		"        \tComma separated audience claim of the token, or the audience required when verifying one\n" +
+		"      -exp string\n" +
+		"        \tExpiration time of the token: a duration from now, an RFC 3339 time or seconds since the Unix epoch [default=1h]\n" +
+		"      -nbf string\n" +
+		"        \tTime before which the token is not valid, in the same format as -exp [default=0s]\n" +
+		"      -iat string\n" +
+		"        \tTime the token was issued, in the same format as -exp [default=0s]\n" +
+		"      -jti string\n" +
+		"        \tUnique identifier of the token [default is random]\n" +
+		"      -leeway duration\n" +
+		"        \tClock skew allowed when verifying the time claims of a token, or the validity period of a signed message in JSON format [default=0s]\n" +
+		"  PASETO options:\n" +
+		"      -footer string\n" +
+		"        \tFooter of the PASETO token, or the footer required by verify-paseto\n" +
+		"      -implicit string\n" +
+		"        \tImplicit assertion the PASETO token is signed with, which must be given again to verify it\n" +
+		"  SSH signature options:\n" +
+		"      -namespace string\n" +
+		"        \tNamespace of the SSH signature, such as file or git, which must be given again to verify it\n" +
+		"      -allowed-signers string\n" +
+		"        \tfilepath of an OpenSSH allowed_signers file to verify the SSH signature against, instead of -public\n" +
+		"      -principal string\n" +
+		"        \tPrincipal the allowed_signers file must allow to make the SSH signature\n" +
+		"  Minisign options:\n" +
+		"      -trusted-comment string\n" +
+		"        \tTrusted comment signed along with the minisign signature [default=timestamp:<seconds since the Unix epoch>]\n" +
+		"      -legacy\n" +
+		"        \tSign the message itself in a legacy minisign signature, rather than its BLAKE2b-512 hash\n" +
+		"  DSSE options:\n" +
+		"      -payload-type string\n" +
+		"        \tPayload type of the DSSE envelope, such as a media type [default=application/octet-stream]\n" +
+		"      -add-signature\n" +
+		"        \tAdd a signature to the DSSE envelope read from standard input, instead of signing it as the payload\n" +
+		"      -predicate-type string\n" +
+		"        \tPredicate type URI of the in-toto Statement written by attest, such as https://slsa.dev/provenance/v1\n" +
+		"      -predicate string\n" +
+		"        \tfilepath of the JSON predicate of the in-toto Statement written by attest\n" +
+		"  HTTP message signature options:\n" +
+		"      -components string\n" +
+		"        \tComma separated components the HTTP message signature covers, or must cover when verifying it, such as @method, @path, content-digest or a header name [default=@method,@authority,@path]\n" +
+		"      -label string\n" +
+		"        \tLabel of the HTTP message signature [default=sig1]\n" +
+		"  DKIM options:\n" +
+		"      -domain string\n" +
+		"        \tSigning domain (d=) of the DKIM signature, or the domain it must be from when verifying it\n" +
+		"      -selector string\n" +
+		"        \tSelector (s=) of the DKIM key, published under selector._domainkey.domain, or the selector the signature must have when verifying it\n" +
+		"      -canonicalization string\n" +
+		"        \tDKIM canonicalization (simple or relaxed, or header/body such as relaxed/simple) [default=relaxed/relaxed]\n" +
+		"      -headers string\n" +
+		"        \tComma separated header fields the DKIM signature covers, which must include From [default=those of From,To,Cc,Subject,Date,Message-ID,Reply-To,MIME-Version,Content-Type the message has]\n" +
+		"      -dns-record string\n" +
+		"        \tfilepath of the DNS TXT record of the DKIM key to verify the signature against, as written by export-dkim-record or as it appears in a zone file\n" +
+		"  Certificate options:\n" +
+		"      -subject string\n" +
+		"        \tSubject of the certificate, such as \"CN=signer,O=Example Corp,C=US\" [default=CN=codechallenge]\n" +
+		"      -san string\n" +
+		"        \tComma separated subject alternative names of the certificate, each a DNS name, IP address, email address or URI, optionally prefixed by DNS:, IP:, email: or URI:\n" +
+		"      -days uint\n" +
+		"        \tNumber of days the certificate, or the CRL of ca crl, is valid for [default=365, 3650 with ca init, or 30 with ca crl]\n" +
+		"      -key-usage string\n" +
+		"        \tComma separated key usages of the certificate, or that the certificate of the signer must allow with -trust-store, such as digitalSignature or keyCertSign [default=digitalSignature, and keyCertSign,cRLSign with -ca]\n" +
+		"      -ext-key-usage string\n" +
+		"        \tComma separated extended key usages of the certificate, or that the certificate of the signer must allow with -trust-store, such as codeSigning or serverAuth\n" +
+		"      -ca\n" +
+		"        \tMark the certificate as a CA certificate in its basic constraints\n" +
+		"      -path-len int\n" +
+		"        \tMaximum number of intermediate CAs below the CA certificate [default is unlimited]\n" +
+		"      -permitted-dns string\n" +
+		"        \tComma separated DNS domains the names of certificates issued by the CA certificate must be within\n" +
+		"      -excluded-dns string\n" +
+		"        \tComma separated DNS domains the names of certificates issued by the CA certificate must not be within\n" +
+		"      -der\n" +
+		"        \tWrite the CSR in DER, rather than PEM\n" +
+		"      -issued string\n" +
+		"        \tfilepath of a PEM or DER certificate issued for the CSR, to check against the key-pair instead of writing a CSR\n" +
+		"      -ca-dir string\n" +
+		"        \tfilepath of the directory of the local CA [default=~/.smartEdge/ca]\n" +
+		"  Trust options:\n" +
+		"      -trust-store string\n" +
+		"        \tfilepath of a directory of trusted root certificates and CRLs in PEM format, to validate the certificate of the signer against in -verify mode\n" +
+		"      -crl string\n" +
+		"        \tComma separated filepaths of further PEM or DER CRLs to check the certificates of the chain against\n" +
+		"      -check-time string\n" +
+		"        \tTime the certificates of the chain must be valid and not revoked at: now, signing for the signing time of CMS input, or timestamp for the time of the time-stamp token of the signature [default=now]\n" +
+		"  Time-stamp options:\n" +
+		"      -tsa string\n" +
+		"        \tURL of an RFC 3161 TSA to time-stamp the signature of JSON or CMS output by, such as http://localhost:3161/\n" +
+		"      -listen string\n" +
+		"        \tAddress the tsa-server command listens on [default=localhost:3161]\n" +
+		"  Replay protection options:\n" +
+		"      -sequence\n" +
+		"        \tNumber the version 2 envelope by the signing counter of its key, kept in -state-dir\n" +
+		"      -replay-check\n" +
+		"        \tReject version 2 envelopes whose signatures were already verified, as recorded in -state-dir\n" +
+		"      -state-dir string\n" +
+		"        \tfilepath of the directory of the signing counters and replay state [default=~/.smartEdge/state]\n" +
+		"  Multi-signature options:\n" +
+		"      -policy string\n" +
+		"        \tNumber of the keys of a multi-signature document that must have valid signatures for it to verify: all, any, or a number of them [default=all]\n" +
+		"      -signers string\n" +
+		"        \tComma separated filepaths of the public keys a multi-signature document is verified against, instead of -public\n" +
 		"  -private string\n" +
-		"    \tfilepath of the private key file. Defaults to ~/.smartEdge/id_rsa.priv for RSA and ~/.smartEdge/id_ecdsa.priv for ECDSA.\n" +
+		"    \tfilepath of the private key file, or comma separated filepaths of several to sign a multi-signature document with. Defaults to ~/.smartEdge/id_rsa.priv for RSA and ~/.smartEdge/id_ecdsa.priv for ECDSA.\n" +
 		"  -public string\n" +
-		"    \tfilepath of the private key file. Defaults to ~/.smartEdge/id_rsa.pub for RSA and ~/.smartEdge/id_ecdsa.pub for ECDSA.\n"
+		"    \tfilepath of the private key file, or comma separated filepaths of the public keys of several. Defaults to ~/.smartEdge/id_rsa.pub for RSA and ~/.smartEdge/id_ecdsa.pub for ECDSA.\n" +
+		"  -raw\n" +
+		"    \tdetached signatures are raw binary, rather than a signed message in JSON format.\n"
 )
 
+// Commands that sign and verify files or tokens, rather than standard input
+const (
+	SignFileCommand          = "sign-file"
+	VerifyFileCommand        = "verify-file"
+	SignManifestCommand      = "sign-manifest"
+	VerifyManifestCommand    = "verify-manifest"
+	JWTCommand               = "jwt"
+	VerifyJWTCommand         = "verify-jwt"
+	CWTCommand               = "cwt"
+	VerifyCWTCommand         = "verify-cwt"
+	PASETOCommand            = "paseto"
+	VerifyPASETOCommand      = "verify-paseto"
+	ExportPGPKeyCommand      = "export-pgp-key"
+	ExportSSHKeyCommand      = "export-ssh-key"
+	ExportMinisignKeyCommand = "export-minisign-key"
+	AttestCommand            = "attest"
+	SignHTTPCommand          = "sign-http"
+	VerifyHTTPCommand        = "verify-http"
+	DKIMCommand              = "dkim"
+	VerifyDKIMCommand        = "verify-dkim"
+	ExportDKIMRecordCommand  = "export-dkim-record"
+	CertSelfSignCommand      = "cert self-sign"
+	CSRCommand               = "csr"
+	CAInitCommand            = "ca init"
+	CAIssueCommand           = "ca issue"
+	CARevokeCommand          = "ca revoke"
+	CACRLCommand             = "ca crl"
+	TSAServerCommand         = "tsa-server"
+	AddSignatureCommand      = "add-signature"
+)
+
+// commandNames lists every command, in the order they are documented.
+var commandNames = []string{SignFileCommand, VerifyFileCommand, SignManifestCommand, VerifyManifestCommand, JWTCommand, VerifyJWTCommand, CWTCommand, VerifyCWTCommand, PASETOCommand, VerifyPASETOCommand, ExportPGPKeyCommand, ExportSSHKeyCommand, ExportMinisignKeyCommand, AttestCommand, SignHTTPCommand, VerifyHTTPCommand, DKIMCommand, VerifyDKIMCommand, ExportDKIMRecordCommand, CertSelfSignCommand, CSRCommand, CAInitCommand, CAIssueCommand, CARevokeCommand, CACRLCommand, TSAServerCommand, AddSignatureCommand}
+
 // ContentFormat the data format of the message to be signed
 type ContentFormat int
 
@@ -47,79 +287,363 @@ const (
 	Binary
 )
 
+// contentFormatNames maps each ContentFormat to its name, which is that of
+// the option selecting it.
+var contentFormatNames = map[ContentFormat]string{
+	UTF8:   "utf8",
+	ASCII:  "ascii",
+	Binary: "binary",
+}
+
+// ParseContentFormat returns the ContentFormat named by name.
+func ParseContentFormat(name string) (ContentFormat, error) {
+	for format, formatName := range contentFormatNames {
+		if formatName == name {
+			return format, nil
+		}
+	}
+	return UTF8, fmt.Errorf("Unrecognized content format %#v: expected one of ascii, binary, utf8", name)
+}
+
+// String returns the name of the content format.
+func (cf ContentFormat) String() string {
+	name, ok := contentFormatNames[cf]
+	if !ok {
+		return fmt.Sprintf("Unknown ContentFormat %#v (INTERNAL ERROR)", int(cf))
+	}
+	return name
+}
+
 // ReplaceAll tells strings.Replace() to replace all
 const (
 	ReplaceAll = -1
 )
 
+// InputSettings describes how the message read from standard input is to be
+// interpreted.
+type InputSettings struct {
+	Format        ContentFormat
+	Encoding      string
+	Normalization NormalizationForm
+}
+
 // RunConfig program's running config as specified on the command line.
+// Command is empty unless a command was given, in which case Paths are the
+// files it operates on.
 type RunConfig struct {
 	HelpMode       bool
-	Format         ContentFormat
+	VerifyMode     bool
+	DigestMode     bool
+	Command        string
+	Paths          []string
+	RawSignatures  bool
+	Input          InputSettings
+	Output         OutputSettings
+	Validity       ValiditySettings
+	JWT            JWTSettings
+	PASETO         PASETOSettings
+	SSH            SSHSigSettings
+	Minisign       MinisignSettings
+	DSSE           DSSESettings
+	HTTPSig        HTTPSigSettings
+	DKIM           DKIMSettings
+	Certificate    pki.Profile
+	CA             CASettings
+	Trust          TrustSettings
+	Timestamp      TimestampSettings
+	State          StateSettings
+	MultiSig       MultiSigSettings
 	PubKeySettings crypt.PkiSettings
 }
 
+// namedFlagValPair is a boolean option of a set of mutually exclusive ones.
+type namedFlagValPair struct {
+	name    string
+	present *bool
+}
+
+// commandLine holds the options of the command line, as defined with the flag
+// package, for ParseArgs and the parse functions of each format and command to
+// validate into a RunConfig.
+type commandLine struct {
+	helpMode               *bool
+	verifyMode             *bool
+	digestMode             *bool
+	algorithmFlags         map[x509.PublicKeyAlgorithm]namedFlagValPair
+	formatFlags            map[ContentFormat]namedFlagValPair
+	encodingName           *string
+	normalizationFormName  *string
+	overridePrivateKeyPath *string
+	overridePublicKeyPath  *string
+	rsaKeyBits             *uint
+	curveName              *string
+	hashName               *string
+	outputFormatName       *string
+	jwsAlgorithm           *string
+	embedJWK               *bool
+	detached               *bool
+	payloadPath            *string
+	certPath               *string
+	envelopeName           *string
+	envelopeNotBefore      *string
+	envelopeExpires        *string
+	userID                 *string
+	claimsPath             *string
+	issuer                 *string
+	subject                *string
+	audience               *string
+	expiresAt              *string
+	notBefore              *string
+	issuedAt               *string
+	jwtID                  *string
+	leeway                 *time.Duration
+	footer                 *string
+	implicit               *string
+	namespace              *string
+	allowedSignersPath     *string
+	principal              *string
+	trustedComment         *string
+	legacy                 *bool
+	payloadType            *string
+	addSignature           *bool
+	predicateType          *string
+	predicatePath          *string
+	components             *string
+	label                  *string
+	domain                 *string
+	selector               *string
+	canonicalization       *string
+	headers                *string
+	dnsRecordPath          *string
+	certSubject            *string
+	subjectAltNames        *string
+	validityDays           *uint
+	keyUsages              *string
+	extKeyUsages           *string
+	isCA                   *bool
+	maxPathLen             *int
+	permittedDNSDomains    *string
+	excludedDNSDomains     *string
+	der                    *bool
+	issuedCertPath         *string
+	caDir                  *string
+	trustStorePath         *string
+	crlPaths               *string
+	checkTime              *string
+	tsaURL                 *string
+	sequence               *bool
+	replayCheck            *bool
+	stateDir               *string
+	policyName             *string
+	signerPaths            *string
+	listenAddress          *string
+	rawSignatures          *bool
+}
+
+// newCommandLine defines the options of the command line.
+func newCommandLine() *commandLine {
+	return &commandLine{
+		helpMode:   flag.Bool("help", false, "display this help message."),
+		verifyMode: flag.Bool("verify", false, "verify a signed message read from standard input, instead of signing one."),
+		digestMode: flag.Bool("digest", false, "This specifies that the message is a hex or base64 encoded digest, to be signed directly"),
+		algorithmFlags: map[x509.PublicKeyAlgorithm]namedFlagValPair{
+			x509.RSA: {
+				name:    "rsa",
+				present: flag.Bool("rsa", false, "Causes the mesage to be signed with an RSA key-pair"),
+			},
+			x509.ECDSA: {
+				name:    "ecdsa",
+				present: flag.Bool("ecdsa", false, "Causes the mesage to be signed with an ECDSA key-pair [default]"),
+			},
+			x509.Ed25519: {
+				name:    "ed25519",
+				present: flag.Bool("ed25519", false, "Causes the mesage to be signed with an Ed25519 key-pair"),
+			},
+		},
+		formatFlags: map[ContentFormat]namedFlagValPair{
+			UTF8: {
+				name:    "utf8",
+				present: flag.Bool("utf8", false, "This specifies that the message is UTF-8 content [default]"),
+			},
+			ASCII: {
+				name:    "ascii",
+				present: flag.Bool("ascii", false, "This specifies that the message is ASCII content"),
+			},
+			Binary: {
+				name:    "binary",
+				present: flag.Bool("binary", false, "This specifies that the message is raw binary content"),
+			},
+		},
+		encodingName:           flag.String("encoding", "", "Character encoding of the input (ISO-8859-1, windows-1252 or UTF-16), transcoded to UTF-8 before signing"),
+		normalizationFormName:  flag.String("normalize", "", "Unicode normalization form (NFC, NFD or NFKC) applied to text before signing"),
+		overridePrivateKeyPath: flag.String("private", "", "filepath of the private key file, or comma separated filepaths of several to sign a multi-signature document with. Defaults to ~/.smartEdge/id_rsa.priv for RSA and ~/.smartEdge/id_ecdsa.priv for ECDSA."),
+		overridePublicKeyPath:  flag.String("public", "", "filepath of the private key file, or comma separated filepaths of the public keys of several. Defaults to ~/.smartEdge/id_rsa.pub for RSA and ~/.smartEdge/id_ecdsa.pub for ECDSA."),
+		rsaKeyBits:             flag.Uint("bits", 0, "Bit length of the RSA key [default=2048]"),
+		curveName:              flag.String("curve", "", "Elliptic curve (P-256, P-384 or P-521) of the ECDSA key [default=P-256]"),
+		hashName:               flag.String("hash", "", "Hash algorithm (sha256, sha384 or sha512) used to digest the message [default=sha256]"),
+		outputFormatName:       flag.String("format", "", "Format of the signed message (json, jws, jws-json, cose, cms, cms-pem, pgp, sshsig, minisign or dsse) [default=json]"),
+		jwsAlgorithm:           flag.String("alg", "", "JWS, COSE or HTTP message signature algorithm (ES256, ES384, ES512, RS256, PS256 or EdDSA, or rsa-pss-sha512, rsa-v1_5-sha256, ecdsa-p256-sha256, ecdsa-p384-sha384 or ed25519) [default is determined by the key]"),
+		embedJWK:               flag.Bool("jwk", false, "Embed the public key in the JWS header as a JWK"),
+		detached:               flag.Bool("detached", false, "Omit the payload from the JWS, COSE_Sign1, CMS or OpenPGP message"),
+		payloadPath:            flag.String("payload", "", "filepath of the payload of a detached JWS, COSE_Sign1, CMS, OpenPGP, SSH or minisign signature being verified"),
+		certPath:               flag.String("cert", "", "filepath of a PEM certificate of the signing key, to embed in CMS output, to replace the public key in JSON output, or the TSA certificate of tsa-server"),
+		envelopeName:           flag.String("envelope", "", "Version of the signed message in JSON format: v1, or v2 to also sign the input format, hash, algorithm, key ID, signing time and a random nonce [default=v1]"),
+		envelopeNotBefore:      flag.String("not-before", "", "Time the signature of a version 2 envelope is valid from: a duration from now, an RFC 3339 time or seconds since the Unix epoch [default is the signing time]"),
+		envelopeExpires:        flag.String("expires", "", "Time the signature of a version 2 envelope expires at, in the same format as -not-before [default is never]"),
+		userID:                 flag.String("uid", "", "User ID of the key written by export-pgp-key, such as \"Name <email>\""),
+		claimsPath:             flag.String("claims", "", "filepath of a JSON file of claims to include in the token"),
+		issuer:                 flag.String("iss", "", "Issuer claim of the token, or the issuer required when verifying one"),
+		subject:                flag.String("sub", "", "Subject claim of the token"),
+		audience:               flag.String("aud", "", "Comma separated audience claim of the token, or the audience required when verifying one"),
+		expiresAt:              flag.String("exp", "", "Expiration time of the token: a duration from now, an RFC 3339 time or seconds since the Unix epoch [default=1h]"),
+		notBefore:              flag.String("nbf", "", "Time before which the token is not valid, in the same format as -exp [default=0s]"),
+		issuedAt:               flag.String("iat", "", "Time the token was issued, in the same format as -exp [default=0s]"),
+		jwtID:                  flag.String("jti", "", "Unique identifier of the token [default is random]"),
+		leeway:                 flag.Duration("leeway", 0, "Clock skew allowed when verifying the time claims of a token, or the validity period of a signed message in JSON format [default=0s]"),
+		footer:                 flag.String("footer", "", "Footer of the PASETO token, or the footer required by verify-paseto"),
+		implicit:               flag.String("implicit", "", "Implicit assertion the PASETO token is signed with, which must be given again to verify it"),
+		namespace:              flag.String("namespace", "", "Namespace of the SSH signature, such as file or git, which must be given again to verify it"),
+		allowedSignersPath:     flag.String("allowed-signers", "", "filepath of an OpenSSH allowed_signers file to verify the SSH signature against, instead of -public"),
+		principal:              flag.String("principal", "", "Principal the allowed_signers file must allow to make the SSH signature"),
+		trustedComment:         flag.String("trusted-comment", "", "Trusted comment signed along with the minisign signature [default=timestamp:<seconds since the Unix epoch>]"),
+		legacy:                 flag.Bool("legacy", false, "Sign the message itself in a legacy minisign signature, rather than its BLAKE2b-512 hash"),
+		payloadType:            flag.String("payload-type", "", "Payload type of the DSSE envelope, such as a media type [default=application/octet-stream]"),
+		addSignature:           flag.Bool("add-signature", false, "Add a signature to the DSSE envelope read from standard input, instead of signing it as the payload"),
+		predicateType:          flag.String("predicate-type", "", "Predicate type URI of the in-toto Statement written by attest, such as https://slsa.dev/provenance/v1"),
+		predicatePath:          flag.String("predicate", "", "filepath of the JSON predicate of the in-toto Statement written by attest"),
+		components:             flag.String("components", "", "Comma separated components the HTTP message signature covers, or must cover when verifying it, such as @method, @path, content-digest or a header name [default=@method,@authority,@path]"),
+		label:                  flag.String("label", "", "Label of the HTTP message signature [default=sig1]"),
+		domain:                 flag.String("domain", "", "Signing domain (d=) of the DKIM signature, or the domain it must be from when verifying it"),
+		selector:               flag.String("selector", "", "Selector (s=) of the DKIM key, published under selector._domainkey.domain, or the selector the signature must have when verifying it"),
+		canonicalization:       flag.String("canonicalization", "", "DKIM canonicalization (simple or relaxed, or header/body such as relaxed/simple) [default=relaxed/relaxed]"),
+		headers:                flag.String("headers", "", "Comma separated header fields the DKIM signature covers, which must include From [default=those of From,To,Cc,Subject,Date,Message-ID,Reply-To,MIME-Version,Content-Type the message has]"),
+		dnsRecordPath:          flag.String("dns-record", "", "filepath of the DNS TXT record of the DKIM key to verify the signature against, as written by export-dkim-record or as it appears in a zone file"),
+		certSubject:            flag.String("subject", "", "Subject of the certificate, such as \"CN=signer,O=Example Corp,C=US\" [default=CN=codechallenge]"),
+		subjectAltNames:        flag.String("san", "", "Comma separated subject alternative names of the certificate, each a DNS name, IP address, email address or URI, optionally prefixed by DNS:, IP:, email: or URI:"),
+		validityDays:           flag.Uint("days", 0, "Number of days the certificate, or the CRL of ca crl, is valid for [default=365, 3650 with ca init, or 30 with ca crl]"),
+		keyUsages:              flag.String("key-usage", "", "Comma separated key usages of the certificate, or that the certificate of the signer must allow with -trust-store, such as digitalSignature or keyCertSign [default=digitalSignature, and keyCertSign,cRLSign with -ca]"),
+		extKeyUsages:           flag.String("ext-key-usage", "", "Comma separated extended key usages of the certificate, or that the certificate of the signer must allow with -trust-store, such as codeSigning or serverAuth"),
+		isCA:                   flag.Bool("ca", false, "Mark the certificate as a CA certificate in its basic constraints"),
+		maxPathLen:             flag.Int("path-len", -1, "Maximum number of intermediate CAs below the CA certificate [default is unlimited]"),
+		permittedDNSDomains:    flag.String("permitted-dns", "", "Comma separated DNS domains the names of certificates issued by the CA certificate must be within"),
+		excludedDNSDomains:     flag.String("excluded-dns", "", "Comma separated DNS domains the names of certificates issued by the CA certificate must not be within"),
+		der:                    flag.Bool("der", false, "Write the CSR in DER, rather than PEM"),
+		issuedCertPath:         flag.String("issued", "", "filepath of a PEM or DER certificate issued for the CSR, to check against the key-pair instead of writing a CSR"),
+		caDir:                  flag.String("ca-dir", "", "filepath of the directory of the local CA [default=~/.smartEdge/ca]"),
+		trustStorePath:         flag.String("trust-store", "", "filepath of a directory of trusted root certificates and CRLs in PEM format, to validate the certificate of the signer against in -verify mode"),
+		crlPaths:               flag.String("crl", "", "Comma separated filepaths of further PEM or DER CRLs to check the certificates of the chain against"),
+		checkTime:              flag.String("check-time", "", "Time the certificates of the chain must be valid and not revoked at: now, signing for the signing time of CMS input, or timestamp for the time of the time-stamp token of the signature [default=now]"),
+		tsaURL:                 flag.String("tsa", "", "URL of an RFC 3161 TSA to time-stamp the signature of JSON or CMS output by, such as http://localhost:3161/"),
+		sequence:               flag.Bool("sequence", false, "Number the version 2 envelope by the signing counter of its key, kept in -state-dir"),
+		replayCheck:            flag.Bool("replay-check", false, "Reject version 2 envelopes whose signatures were already verified, as recorded in -state-dir"),
+		stateDir:               flag.String("state-dir", "", "filepath of the directory of the signing counters and replay state [default=~/.smartEdge/state]"),
+		policyName:             flag.String("policy", "", "Number of the keys of a multi-signature document that must have valid signatures for it to verify: all, any, or a number of them [default=all]"),
+		signerPaths:            flag.String("signers", "", "Comma separated filepaths of the public keys a multi-signature document is verified against, instead of -public"),
+		listenAddress:          flag.String("listen", "", "Address the tsa-server command listens on [default=localhost:3161]"),
+		rawSignatures:          flag.Bool("raw", false, "detached signatures are raw binary, rather than a signed message in JSON format."),
+	}
+}
+
 // ParseArgs parses the runtime configuration from the command line arguments.
 func ParseArgs(d *deps.Dependencies) (*RunConfig, error) {
 	defaultKeyDir := filepath.Join(d.Os.Getenv("HOME"), ".smartEdge")
 	flag.CommandLine.SetOutput(d.Os.Stderr)
 	result := RunConfig{
-		HelpMode: false, // default
-		Format:   UTF8,  // default
-		PubKeySettings: crypt.PkiSettings{
-			Algorithm:      x509.ECDSA, // default
-			RSAKeyBits:     2048,       //default
-			PrivateKeyPath: filepath.Join(defaultKeyDir, "id_{{algorithm}}.priv"),
-			PublicKeyPath:  filepath.Join(defaultKeyDir, "id_{{algorithm}}.pub"),
+		HelpMode:      false, // default
+		VerifyMode:    false, // default
+		DigestMode:    false, // default
+		Command:       "",    // default
+		Paths:         nil,   // default
+		RawSignatures: false, // default
+		Input: InputSettings{
+			Format:        UTF8,            // default
+			Encoding:      "",              // default
+			Normalization: NoNormalization, // default
 		},
-	}
-	helpMode := flag.Bool("help", false, "display this help message.")
-	type namedFlagValPair struct {
-		name    string
-		present *bool
-	}
-	algorithmFlags := map[x509.PublicKeyAlgorithm]namedFlagValPair{
-		x509.RSA: {
-			name:    "rsa",
-			present: flag.Bool("rsa", false, "Causes the mesage to be signed with an RSA key-pair"),
+		Output: OutputSettings{
+			Format:         JSONOutput, // default
+			JWSAlgorithm:   "",         // default
+			EmbedJWK:       false,      // default
+			Detached:       false,      // default
+			PayloadPath:    "",         // default
+			CertPath:       "",         // default
+			Envelope:       EnvelopeV1, // default
+			UserID:         "",         // default
+			DER:            false,      // default
+			IssuedCertPath: "",         // default
 		},
-		x509.ECDSA: {
-			name:    "ecdsa",
-			present: flag.Bool("ecdsa", false, "Causes the mesage to be signed with an ECDSA key-pair [default]"),
+		DSSE: DSSESettings{
+			PayloadType: "application/octet-stream", // default
 		},
-	}
-	formatFlags := map[ContentFormat]namedFlagValPair{
-		UTF8: {
-			name:    "utf8",
-			present: flag.Bool("utf8", false, "This specifies that the message is UTF-8 content [default]"),
+		HTTPSig: HTTPSigSettings{
+			Label:      "sig1",                                     // default
+			Components: []string{"@method", "@authority", "@path"}, // default
+		},
+		DKIM: DKIMSettings{
+			HeaderCanonicalization: dkim.Relaxed, // default
+			BodyCanonicalization:   dkim.Relaxed, // default
+		},
+		Certificate: *pki.NewProfile(DefaultCertificateCommonName), // default
+		CA: CASettings{
+			Dir:         filepath.Join(defaultKeyDir, "ca"), // default
+			CRLValidity: pki.DefaultCRLValidity,             // default
+		},
+		Timestamp: TimestampSettings{
+			ListenAddress: DefaultTSAListenAddress, // default
 		},
-		ASCII: {
-			name:    "ascii",
-			present: flag.Bool("ascii", false, "This specifies that the message is ASCII content"),
+		MultiSig: MultiSigSettings{
+			Policy: AllSignatures, // default
 		},
-		Binary: {
-			name:    "binary",
-			present: flag.Bool("binary", false, "This specifies that the message is raw binary content"),
+		State: StateSettings{
+			Dir:         filepath.Join(defaultKeyDir, "state"), // default
+			Sequence:    false,                                 // default
+			ReplayCheck: false,                                 // default
+		},
+		PubKeySettings: crypt.PkiSettings{
+			Algorithm:      x509.ECDSA,    // default
+			RSAKeyBits:     2048,          //default
+			Hash:           crypto.SHA256, // default
+			PrivateKeyPath: filepath.Join(defaultKeyDir, "id_{{algorithm}}.priv"),
+			PublicKeyPath:  filepath.Join(defaultKeyDir, "id_{{algorithm}}.pub"),
 		},
 	}
-	overridePrivateKeyPath := flag.String("private", "", "filepath of the private key file. Defaults to ~/.smartEdge/id_rsa.priv for RSA and ~/.smartEdge/id_ecdsa.priv for ECDSA.")
-	overridePublicKeyPath := flag.String("public", "", "filepath of the private key file. Defaults to ~/.smartEdge/id_rsa.pub for RSA and ~/.smartEdge/id_ecdsa.pub for ECDSA.")
-	rsaKeyBits := flag.Uint("bits", 0, "Bit length of the RSA key [default=2048]")
+	cl := newCommandLine()
 	flag.CommandLine.Usage = func() {
 		// Ignore errors
 		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n%s", os.Args[0], UsageMessage)
 	}
-	if err := flag.CommandLine.Parse(d.Os.Args[1:]); err != nil {
+	args := d.Os.Args[1:]
+	if len(args) > 0 {
+		for _, name := range commandNames {
+			// Some commands are a command followed by a subcommand:
+			words := strings.Fields(name)
+			if (len(args) >= len(words)) && (strings.Join(args[:len(words)], " ") == name) {
+				result.Command = name
+				args = args[len(words):]
+				break
+			}
+		}
+	}
+	if err := flag.CommandLine.Parse(args); err != nil {
 		return nil, err
 	}
-	result.HelpMode = *helpMode
+	result.HelpMode = *cl.helpMode
+	if result.HelpMode {
+		othersUsed := result.Command != ""
+		flag.CommandLine.Visit(func(option *flag.Flag) {
+			othersUsed = othersUsed || (option.Name != "help")
+		})
+		if othersUsed {
+			return nil, errors.New("Option -help ignores all other options")
+		}
+	}
+	if *cl.verifyMode {
+		result.VerifyMode = true
+	}
 	mutuallyExclusiveFlagCount := 0
 	lastNamedOption := ""
-	for val, flagPair := range algorithmFlags {
+	for val, flagPair := range cl.algorithmFlags {
 		if *(flagPair.present) {
-			if result.HelpMode {
-				return nil, fmt.Errorf("Option -help ignores all other options")
-			}
 			if mutuallyExclusiveFlagCount > 0 {
 				return nil, fmt.Errorf("Options -%s and -%s may not be used together", lastNamedOption, flagPair.name)
 			}
@@ -128,60 +652,311 @@ func ParseArgs(d *deps.Dependencies) (*RunConfig, error) {
 			result.PubKeySettings.Algorithm = val
 		}
 	}
+	algorithmOptionUsed := mutuallyExclusiveFlagCount > 0
 	mutuallyExclusiveFlagCount = 0
 	lastNamedOption = ""
-	for val, flagPair := range formatFlags {
+	for val, flagPair := range cl.formatFlags {
 		if *(flagPair.present) {
-			if result.HelpMode {
-				return nil, fmt.Errorf("Option -help ignores all other options")
-			}
 			if mutuallyExclusiveFlagCount > 0 {
 				return nil, fmt.Errorf("Options -%s and -%s may not be used together", lastNamedOption, flagPair.name)
 			}
 			mutuallyExclusiveFlagCount++
 			lastNamedOption = flagPair.name
-			result.Format = val
+			result.Input.Format = val
 		}
 	}
+	inputFormatOptionUsed := (mutuallyExclusiveFlagCount > 0) || (*cl.encodingName != "") || (*cl.normalizationFormName != "") || *cl.digestMode
+	if *cl.encodingName != "" {
+		if result.Input.Format != UTF8 {
+			return nil, fmt.Errorf("Option -encoding may only be used with -utf8 content")
+		}
+		name, err := CanonicalEncodingName(*cl.encodingName)
+		if err != nil {
+			return nil, err
+		}
+		result.Input.Encoding = name
+	}
+	if *cl.digestMode {
+		if (result.Input.Format != UTF8) || (*cl.encodingName != "") || (*cl.normalizationFormName != "") {
+			return nil, errors.New("Option -digest may not be used with other input format options")
+		}
+		result.DigestMode = true
+	}
+	if *cl.normalizationFormName != "" {
+		if result.Input.Format == Binary {
+			return nil, errors.New("Option -normalize is not valid for -binary content")
+		}
+		form, err := ParseNormalizationForm(*cl.normalizationFormName)
+		if err != nil {
+			return nil, err
+		}
+		result.Input.Normalization = form
+	}
 	// we only want to replace the "{{algorithm}}" token in the defaults, not in
 	// the command arguments.
 	result.PubKeySettings.PrivateKeyPath = strings.Replace(
 		result.PubKeySettings.PrivateKeyPath,
 		"{{algorithm}}",
-		algorithmFlags[result.PubKeySettings.Algorithm].name,
+		cl.algorithmFlags[result.PubKeySettings.Algorithm].name,
 		ReplaceAll)
 	result.PubKeySettings.PublicKeyPath = strings.Replace(
 		result.PubKeySettings.PublicKeyPath,
 		"{{algorithm}}",
-		algorithmFlags[result.PubKeySettings.Algorithm].name,
+		cl.algorithmFlags[result.PubKeySettings.Algorithm].name,
 		ReplaceAll)
-	if *rsaKeyBits != 0 {
-		if result.HelpMode {
-			return nil, fmt.Errorf("Option -help ignores all other options")
-		}
+	if *cl.rsaKeyBits != 0 {
 		if result.PubKeySettings.Algorithm == x509.RSA {
 			return nil, errors.New("Options -bits is only valid for RSA")
 		}
-		if *rsaKeyBits < 256 {
+		if *cl.rsaKeyBits < 256 {
 			// 2048 is the least currently considered "secure through 2030."
 			// 256 bits is 2.791 * 10^539 times weaker than that.
-			return nil, fmt.Errorf("Options -bits less than 256 not allowed. Saw -bits=%d", *rsaKeyBits)
+			return nil, fmt.Errorf("Options -bits less than 256 not allowed. Saw -bits=%d", *cl.rsaKeyBits)
+		}
+		result.PubKeySettings.RSAKeyBits = int(*cl.rsaKeyBits)
+	}
+	if *cl.curveName != "" {
+		if result.PubKeySettings.Algorithm != x509.ECDSA {
+			return nil, errors.New("Option -curve is only valid for ECDSA")
+		}
+		curve, err := crypt.ParseCurveName(*cl.curveName)
+		if err != nil {
+			return nil, err
+		}
+		result.PubKeySettings.ECDSACurve = curve
+	}
+	if *cl.outputFormatName != "" {
+		format, err := ParseOutputFormat(*cl.outputFormatName)
+		if err != nil {
+			return nil, err
+		}
+		result.Output.Format = format
+	}
+	usesPASETO := (result.Command == PASETOCommand) || (result.Command == VerifyPASETOCommand)
+	usesJWS := result.Output.Format.IsJWS() || (result.Command == JWTCommand) || (result.Command == VerifyJWTCommand)
+	usesCOSE := result.Output.Format.IsCOSE() || (result.Command == CWTCommand) || (result.Command == VerifyCWTCommand)
+	if usesJWS || usesCOSE || usesPASETO {
+		formatName := "JWS"
+		if usesCOSE {
+			formatName = "COSE"
+		} else if usesPASETO {
+			formatName = "PASETO"
+		}
+		if *cl.hashName != "" {
+			return nil, fmt.Errorf("Option -hash is not valid with %s output, as the hash is determined by the %s algorithm", formatName, formatName)
+		}
+		if result.DigestMode {
+			return nil, fmt.Errorf("Option -digest is not valid with %s output, as %s signs the payload itself", formatName, formatName)
+		}
+	}
+	if result.Output.Format.IsCMS() && result.DigestMode {
+		return nil, errors.New("Option -digest is not valid with CMS output, as CMS signs the content itself")
+	}
+	if result.Output.Format.IsPGP() && result.DigestMode {
+		return nil, errors.New("Option -digest is not valid with OpenPGP output, as OpenPGP signs the message itself")
+	}
+	if result.Output.Format.IsSSHSig() && result.DigestMode {
+		return nil, errors.New("Option -digest is not valid with SSH signatures, as they sign the message itself")
+	}
+	if result.Output.Format.IsDSSE() && result.DigestMode {
+		return nil, errors.New("Option -digest is not valid with DSSE output, as DSSE signs the payload itself")
+	}
+	usesMinisign := result.Output.Format.IsMinisign() || (result.Command == ExportMinisignKeyCommand)
+	if result.Output.Format.IsMinisign() && result.DigestMode {
+		return nil, errors.New("Option -digest is not valid with minisign signatures, as they sign the message itself")
+	}
+	if usesMinisign && !result.VerifyMode && (result.PubKeySettings.Algorithm != x509.Ed25519) {
+		return nil, errors.New("Minisign keys and signatures require an Ed25519 key, given by -ed25519")
+	}
+	if result.signsDKIM() && (result.PubKeySettings.Algorithm == x509.ECDSA) {
+		return nil, errors.New("DKIM keys and signatures require an RSA or Ed25519 key, given by -rsa or -ed25519")
+	}
+	if err := parseJWSOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if *cl.detached {
+		if !(result.Output.Format.IsJWS() || result.Output.Format.IsCOSE() || result.Output.Format.IsCMS() || result.Output.Format.IsPGP()) || result.VerifyMode {
+			return nil, errors.New("Option -detached is only valid when signing JWS, COSE, CMS or OpenPGP output")
 		}
-		result.PubKeySettings.RSAKeyBits = int(*rsaKeyBits)
+		result.Output.Detached = true
+	}
+	if result.Output.Format.IsPGP() && !result.VerifyMode && !result.Output.Detached && (result.Input.Format == Binary) {
+		return nil, errors.New("Option -binary is only valid with -detached for OpenPGP output, as a cleartext signed message is text")
+	}
+	if *cl.payloadPath != "" {
+		if !(result.Output.Format.IsJWS() || result.Output.Format.IsCOSE() || result.Output.Format.IsCMS() || result.Output.Format.IsPGP() || result.Output.Format.IsSSHSig() || result.Output.Format.IsMinisign()) || !result.VerifyMode {
+			return nil, errors.New("Option -payload is only valid when verifying JWS, COSE, CMS, OpenPGP, SSH or minisign input")
+		}
+		result.Output.PayloadPath = *cl.payloadPath
+	}
+	if *cl.certPath != "" {
+		signsWithCertificate := ((result.Output.Format == JSONOutput) || result.Output.Format.IsCMS()) && !result.VerifyMode && (result.Command == "")
+		if !signsWithCertificate && (result.Command != TSAServerCommand) {
+			return nil, fmt.Errorf("Option -cert is only valid when signing JSON or CMS output, or with the %s command", TSAServerCommand)
+		}
+		result.Output.CertPath = *cl.certPath
+	}
+	if err := parseTimestampOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseEnvelopeOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseValidityOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseStateOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseMultiSigOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parsePGPOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseJWTOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parsePASETOOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseSSHOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseMinisignOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseDSSEOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseHTTPSigOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseDKIMOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseCertificateOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseTrustOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseCAOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseCSROptions(&result, cl); err != nil {
+		return nil, err
+	}
+
+	if *cl.hashName != "" {
+		if result.VerifyMode {
+			return nil, errors.New("Option -hash is not valid with -verify, as the hash is recorded in the signed message")
+		}
+		if result.Command == VerifyManifestCommand {
+			return nil, errors.New("Option -hash is not valid with verify-manifest, as the hash is recorded in the signed manifest")
+		}
+		if (result.Command == VerifyFileCommand) && !*cl.rawSignatures {
+			return nil, errors.New("Option -hash is only valid with verify-file for -raw signatures, as the hash is otherwise recorded in the signature")
+		}
+		hash, err := crypt.ParseHashName(*cl.hashName)
+		if err != nil {
+			return nil, err
+		}
+		if result.Output.Format.IsSSHSig() && (hash != crypto.SHA256) && (hash != crypto.SHA512) {
+			return nil, errors.New("Option -hash must be sha256 or sha512 for SSH signatures")
+		}
+		if usesMinisign {
+			return nil, errors.New("Option -hash is not valid with minisign, as its signatures use BLAKE2b-512")
+		}
+		if result.Output.Format.IsDSSE() {
+			return nil, errors.New("Option -hash is not valid with DSSE output, as the hash is determined by the key")
+		}
+		if result.usesHTTPSig() {
+			return nil, errors.New("Option -hash is not valid with HTTP message signatures, as the hash is determined by the algorithm")
+		}
+		if result.usesDKIM() {
+			return nil, errors.New("Option -hash is not valid with DKIM, as its signatures use SHA-256")
+		}
+		if (result.Command == CertSelfSignCommand) || (result.Command == CSRCommand) || isCACommand(result.Command) {
+			return nil, errors.New("Option -hash is not valid with certificates, as the hash is determined by the key")
+		}
+		if result.Command == AddSignatureCommand {
+			return nil, fmt.Errorf("Option -hash is not valid with %s, as the hash is recorded in the signed message", AddSignatureCommand)
+		}
+		result.PubKeySettings.Hash = hash
 	}
 
 	// Replace if we don't see the default value of empty string
-	if *overridePrivateKeyPath != "" {
-		if result.HelpMode {
-			return nil, fmt.Errorf("Option -help ignores all other options")
+	if *cl.overridePrivateKeyPath != "" {
+		result.PubKeySettings.PrivateKeyPath = *cl.overridePrivateKeyPath
+	}
+	if *cl.overridePublicKeyPath != "" {
+		result.PubKeySettings.PublicKeyPath = *cl.overridePublicKeyPath
+	}
+	if err := parseKeyListOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if err := parseFileOptions(&result, cl); err != nil {
+		return nil, err
+	}
+	if result.Command == "" {
+		if flag.CommandLine.NArg() > 0 {
+			return nil, fmt.Errorf("Unrecognized command %#v: expected one of %s", flag.CommandLine.Arg(0), strings.Join(commandNames, ", "))
+		}
+		return &result, nil
+	}
+	if result.VerifyMode {
+		return nil, fmt.Errorf("Option -verify may not be used with the %s command", result.Command)
+	}
+	if inputFormatOptionUsed {
+		return nil, fmt.Errorf("Input format options may not be used with the %s command", result.Command)
+	}
+	if *cl.outputFormatName != "" {
+		return nil, fmt.Errorf("Option -format may not be used with the %s command", result.Command)
+	}
+	if (result.Command == ExportPGPKeyCommand) && (result.Output.UserID == "") {
+		return nil, fmt.Errorf("Command %s requires -uid", result.Command)
+	}
+	if (result.Command == AttestCommand) && (result.DSSE.PredicateType == "") {
+		return nil, fmt.Errorf("Command %s requires -predicate-type", result.Command)
+	}
+	if (result.Command == DKIMCommand) && ((result.DKIM.Domain == "") || (result.DKIM.Selector == "")) {
+		return nil, fmt.Errorf("Command %s requires -domain and -selector", result.Command)
+	}
+	if (result.Command == VerifyDKIMCommand) && (result.DKIM.RecordPath == "") {
+		return nil, fmt.Errorf("Command %s requires -dns-record", result.Command)
+	}
+	if (result.Command == TSAServerCommand) && (result.Output.CertPath == "") {
+		return nil, fmt.Errorf("Command %s requires -cert", result.Command)
+	}
+	if isCACommand(result.Command) {
+		if (*cl.overridePrivateKeyPath != "") || (*cl.overridePublicKeyPath != "") {
+			return nil, errors.New("Options -private and -public are not valid with the ca commands, as the keys of the CA are in -ca-dir")
+		}
+		if (result.Command != CAInitCommand) && (algorithmOptionUsed || (*cl.rsaKeyBits != 0) || (*cl.curveName != "")) {
+			return nil, fmt.Errorf("Key options are only valid with the %s command, as the key of the CA is that of its certificate", CAInitCommand)
 		}
-		result.PubKeySettings.PrivateKeyPath = *overridePrivateKeyPath
 	}
-	if *overridePublicKeyPath != "" {
-		if result.HelpMode {
-			return nil, fmt.Errorf("Option -help ignores all other options")
+	if result.issuesToken() || result.verifiesToken() || (result.Command == ExportPGPKeyCommand) || (result.Command == ExportSSHKeyCommand) || (result.Command == ExportMinisignKeyCommand) || result.usesHTTPSig() || result.usesDKIM() || (result.Command == CertSelfSignCommand) || (result.Command == CSRCommand) || (isCACommand(result.Command) && (result.Command != CARevokeCommand)) || (result.Command == TSAServerCommand) || (result.Command == AddSignatureCommand) {
+		if flag.CommandLine.NArg() != 0 {
+			return nil, fmt.Errorf("Command %s takes no paths", result.Command)
 		}
-		result.PubKeySettings.PublicKeyPath = *overridePublicKeyPath
+	} else if (result.Command == SignManifestCommand) || (result.Command == VerifyManifestCommand) {
+		if flag.CommandLine.NArg() != 1 {
+			return nil, fmt.Errorf("Command %s requires exactly one directory path", result.Command)
+		}
+	} else if result.Command == CARevokeCommand {
+		if flag.CommandLine.NArg() != 1 {
+			return nil, fmt.Errorf("Command %s requires exactly one serial number", result.Command)
+		}
+	} else if flag.CommandLine.NArg() == 0 {
+		return nil, fmt.Errorf("Command %s requires at least one file path", result.Command)
 	}
+	result.Paths = flag.CommandLine.Args()
 	return &result, nil
 }
+
+// isCACommand returns true if command is one of the commands of the local CA.
+func isCACommand(command string) bool {
+	return (command == CAInitCommand) || (command == CAIssueCommand) || (command == CARevokeCommand) || (command == CACRLCommand)
+}
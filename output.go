@@ -0,0 +1,115 @@
+package codechallenge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OutputFormat is the format the signed message is written in.
+type OutputFormat int
+
+// Output formats
+const (
+	JSONOutput OutputFormat = iota
+	JWSCompactOutput
+	JWSJSONOutput
+	COSEOutput
+	CMSOutput
+	CMSPEMOutput
+	PGPOutput
+	SSHSigOutput
+	MinisignOutput
+	DSSEOutput
+)
+
+// outputFormatNames maps each OutputFormat to its name.
+var outputFormatNames = map[OutputFormat]string{
+	JSONOutput:       "json",
+	JWSCompactOutput: "jws",
+	JWSJSONOutput:    "jws-json",
+	COSEOutput:       "cose",
+	CMSOutput:        "cms",
+	CMSPEMOutput:     "cms-pem",
+	PGPOutput:        "pgp",
+	SSHSigOutput:     "sshsig",
+	MinisignOutput:   "minisign",
+	DSSEOutput:       "dsse",
+}
+
+// ParseOutputFormat returns the OutputFormat named by name. Names are not
+// case sensitive.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	names := make([]string, 0, len(outputFormatNames))
+	for format, formatName := range outputFormatNames {
+		if strings.EqualFold(formatName, name) {
+			return format, nil
+		}
+		names = append(names, formatName)
+	}
+	sort.Strings(names)
+	return JSONOutput, fmt.Errorf("Unrecognized output format %#v: expected one of %s", name, strings.Join(names, ", "))
+}
+
+// String returns the name of the output format.
+func (of OutputFormat) String() string {
+	name, ok := outputFormatNames[of]
+	if !ok {
+		return fmt.Sprintf("Unknown OutputFormat %#v (INTERNAL ERROR)", int(of))
+	}
+	return name
+}
+
+// IsJWS returns true for the JWS serializations.
+func (of OutputFormat) IsJWS() bool {
+	return (of == JWSCompactOutput) || (of == JWSJSONOutput)
+}
+
+// IsCOSE returns true for COSE_Sign1 output.
+func (of OutputFormat) IsCOSE() bool {
+	return of == COSEOutput
+}
+
+// IsCMS returns true for CMS SignedData output, in DER or PEM.
+func (of OutputFormat) IsCMS() bool {
+	return (of == CMSOutput) || (of == CMSPEMOutput)
+}
+
+// IsPGP returns true for OpenPGP output: a cleartext signed message, or a
+// detached armored signature.
+func (of OutputFormat) IsPGP() bool {
+	return of == PGPOutput
+}
+
+// IsSSHSig returns true for armored SSH signature output.
+func (of OutputFormat) IsSSHSig() bool {
+	return of == SSHSigOutput
+}
+
+// IsMinisign returns true for minisign signature output.
+func (of OutputFormat) IsMinisign() bool {
+	return of == MinisignOutput
+}
+
+// IsDSSE returns true for DSSE envelope output.
+func (of OutputFormat) IsDSSE() bool {
+	return of == DSSEOutput
+}
+
+// OutputSettings describes how the signed message is written, and how a
+// signed message being verified was written. Envelope is the version of a
+// signed message written in JSON format. DER selects DER rather than PEM for
+// a CSR, and IssuedCertPath is a certificate issued for one, to be checked
+// against the key-pair.
+type OutputSettings struct {
+	Format         OutputFormat
+	JWSAlgorithm   string
+	EmbedJWK       bool
+	Detached       bool
+	PayloadPath    string
+	CertPath       string
+	Envelope       EnvelopeVersion
+	UserID         string
+	DER            bool
+	IssuedCertPath string
+}
@@ -0,0 +1,134 @@
+package codechallenge
+
+import (
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/paseto"
+	"io/ioutil"
+)
+
+// PASETOSettings describes the footer and implicit assertion of a PASETO
+// token being issued, and those required of a token being verified.
+type PASETOSettings struct {
+	Footer   string
+	Implicit string
+}
+
+// PASETOMain is the entry-point for the paseto command. It writes a signed
+// PASETO token of the claims in config to d.Os.Stdout. The version is
+// determined by the key: v4.public for Ed25519, or v3.public for ECDSA on
+// P-384.
+func PASETOMain(d *deps.Dependencies, config *RunConfig) {
+	claims, err := NewJWTClaims(d, &config.JWT)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	payload, err := paseto.MarshalClaims(claims)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	implicit := []byte(config.PASETO.Implicit)
+	token, err := paseto.Sign(cryptStuff.Signer, d.Crypto.Rand.Reader, payload, []byte(config.PASETO.Footer), implicit)
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	parsed, err := paseto.Parse(token)
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	valid, err := parsed.Verify(cryptStuff.Signer.Public(), implicit)
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	err = WriteOutput(d, []byte(token))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// PASETOVerdict is the outcome of verifying a PASETO token, to be rendered to
+// JSON. The claims and footer are only included if the signature is valid.
+type PASETOVerdict struct {
+	*JWTVerdict
+	Footer string `json:"footer,omitempty"`
+}
+
+// VerifyPASETOMain is the entry-point for the verify-paseto command. It reads
+// a PASETO token from d.Os.Stdin, and writes the verdict in JSON format to
+// d.Os.Stdout, with the claims in their JWT form, exiting with the verdict's
+// exit status if it isn't valid.
+func VerifyPASETOMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyPASETO(d, config, string(buff))
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyPASETO checks the signature of token against the public key file in
+// config, along with the implicit assertion in config. It then checks the
+// footer, if config requires one, and the claims in the same way as
+// VerifyJWT.
+func VerifyPASETO(d *deps.Dependencies, config *RunConfig, token string) (*PASETOVerdict, error) {
+	parsed, err := paseto.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := loadPublicKey(d, config.PubKeySettings.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	verdict := newVerdictFromVerification(parsed.Verify(publicKey, []byte(config.PASETO.Implicit)))
+	if !verdict.Valid {
+		return &PASETOVerdict{JWTVerdict: &JWTVerdict{Verdict: verdict}}, nil
+	}
+	claims, err := paseto.UnmarshalClaims(parsed.Message)
+	if err != nil {
+		return nil, err
+	}
+	result := &PASETOVerdict{
+		JWTVerdict: &JWTVerdict{Verdict: ValidateClaims(d, &config.JWT, claims), Claims: claims},
+		Footer:     string(parsed.Footer),
+	}
+	if (config.PASETO.Footer != "") && (result.Footer != config.PASETO.Footer) {
+		result.Verdict = NewVerdict(InvalidClaims, fmt.Sprintf("token footer %#v does not match %#v", result.Footer, config.PASETO.Footer))
+	}
+	return result, nil
+}
+
+// parsePASETOOptions validates the PASETO footer and implicit assertion
+// options in cl into config.
+func parsePASETOOptions(config *RunConfig, cl *commandLine) error {
+	if (*cl.footer != "") || (*cl.implicit != "") {
+		if (config.Command != PASETOCommand) && (config.Command != VerifyPASETOCommand) {
+			return fmt.Errorf("Options -footer and -implicit are only valid with the %s and %s commands", PASETOCommand, VerifyPASETOCommand)
+		}
+		config.PASETO.Footer = *cl.footer
+		config.PASETO.Implicit = *cl.implicit
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package paseto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/jwt"
+	"time"
+)
+
+// timeClaimNames are the JSON names of the time claims, which PASETO encodes
+// as RFC 3339 times rather than seconds since the Unix epoch.
+var timeClaimNames = []string{"exp", "nbf", "iat"}
+
+// MarshalClaims encodes claims as the JSON payload of a PASETO token. PASETO
+// only allows a single audience.
+func MarshalClaims(claims *jwt.Claims) ([]byte, error) {
+	if len(claims.Audience) > 1 {
+		return nil, errors.New("PASETO aud claim must be a single audience")
+	}
+	converted := *claims
+	converted.ExpiresAt = nil
+	converted.NotBefore = nil
+	converted.IssuedAt = nil
+	converted.Extra = map[string]json.RawMessage{}
+	for name, value := range claims.Extra {
+		converted.Extra[name] = value
+	}
+	for i, date := range []*jwt.NumericDate{claims.ExpiresAt, claims.NotBefore, claims.IssuedAt} {
+		if date != nil {
+			value, err := json.Marshal(date.String())
+			if err != nil {
+				return nil, err
+			}
+			converted.Extra[timeClaimNames[i]] = value
+		}
+	}
+	return json.Marshal(&converted)
+}
+
+// UnmarshalClaims decodes the JSON payload of a PASETO token.
+func UnmarshalClaims(payload []byte) (*jwt.Claims, error) {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("PASETO token does not contain valid claims: %s", err.Error())
+	}
+	dates := make([]*jwt.NumericDate, len(timeClaimNames))
+	for i, name := range timeClaimNames {
+		value, ok := raw[name]
+		if !ok {
+			continue
+		}
+		text := ""
+		if err := json.Unmarshal(value, &text); err != nil {
+			return nil, fmt.Errorf("PASETO %s claim %s is not an RFC 3339 time", name, string(value))
+		}
+		parsed, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, fmt.Errorf("PASETO %s claim %s is not an RFC 3339 time", name, string(value))
+		}
+		dates[i] = jwt.NewNumericDate(parsed)
+		delete(raw, name)
+	}
+	remaining, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	result := &jwt.Claims{}
+	if err := json.Unmarshal(remaining, result); err != nil {
+		return nil, fmt.Errorf("PASETO token does not contain valid claims: %s", err.Error())
+	}
+	result.ExpiresAt, result.NotBefore, result.IssuedAt = dates[0], dates[1], dates[2]
+	return result, nil
+}
@@ -0,0 +1,168 @@
+// Package paseto implements public PASETO tokens: v4.public, signed with
+// Ed25519, and v3.public, signed with ECDSA on P-384. The version is fixed by
+// the key, so a token can't be verified with an algorithm its issuer didn't
+// intend.
+package paseto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"io"
+	"strings"
+)
+
+// Headers of the supported token versions and purposes
+const (
+	V3Public = "v3.public."
+	V4Public = "v4.public."
+)
+
+// signatureSizes maps each header to the length of its signatures.
+var signatureSizes = map[string]int{
+	V3Public: 96,
+	V4Public: ed25519.SignatureSize,
+}
+
+// v3Scheme is how v3.public tokens are signed. Ed25519 keys used by
+// v4.public always sign the message itself.
+var v3Scheme = crypt.SignatureScheme{Hash: crypto.SHA384, ECDSAEncoding: crypt.RawEncoding}
+
+// PAE returns the Pre-Authentication Encoding of pieces: the number of
+// pieces, followed by the length and content of each, with all numbers as
+// 64-bit little-endian integers whose most significant bit is clear.
+func PAE(pieces ...[]byte) []byte {
+	le64 := func(n int) []byte {
+		result := make([]byte, 8)
+		binary.LittleEndian.PutUint64(result, uint64(n)&^(1<<63))
+		return result
+	}
+	result := le64(len(pieces))
+	for _, piece := range pieces {
+		result = append(result, le64(len(piece))...)
+		result = append(result, piece...)
+	}
+	return result
+}
+
+// HeaderForKey returns the header of the tokens publicKey signs: v4.public
+// for Ed25519 keys, or v3.public for ECDSA keys on P-384.
+func HeaderForKey(publicKey crypto.PublicKey) (string, error) {
+	switch typedPublicKey := publicKey.(type) {
+	case ed25519.PublicKey:
+		return V4Public, nil
+	case *ecdsa.PublicKey:
+		if typedPublicKey.Curve == elliptic.P384() {
+			return V3Public, nil
+		}
+	}
+	return "", errors.New("PASETO requires an Ed25519 key for v4.public tokens, or an ECDSA key on P-384 for v3.public tokens")
+}
+
+// Token is a parsed public PASETO token.
+type Token struct {
+	Header    string
+	Message   []byte
+	Signature crypt.BinarySignature
+	Footer    []byte
+}
+
+// preAuth returns what a token signs, given the public key that signs it.
+// v3.public binds the compressed public key as well.
+func (t *Token) preAuth(publicKey crypto.PublicKey, implicit []byte) []byte {
+	if ecdsaPublicKey, ok := publicKey.(*ecdsa.PublicKey); ok && (t.Header == V3Public) {
+		return PAE(compressPublicKey(ecdsaPublicKey), []byte(t.Header), t.Message, t.Footer, implicit)
+	}
+	return PAE([]byte(t.Header), t.Message, t.Footer, implicit)
+}
+
+// compressPublicKey returns the compressed point of publicKey, as defined by
+// SEC 1: 0x02 or 0x03 for an even or odd Y, followed by X padded to the byte
+// length of the curve.
+func compressPublicKey(publicKey *ecdsa.PublicKey) []byte {
+	size := (publicKey.Curve.Params().BitSize + 7) / 8
+	result := make([]byte, 1+size)
+	result[0] = byte(2 + publicKey.Y.Bit(0))
+	xBytes := publicKey.X.Bytes()
+	copy(result[1+size-len(xBytes):], xBytes)
+	return result
+}
+
+// Sign returns a token of message signed by signer, with an optional footer
+// and implicit assertion. The implicit assertion is signed, but isn't part of
+// the token, so it must be provided again to verify it.
+func Sign(signer crypto.Signer, randReader io.Reader, message, footer, implicit []byte) (string, error) {
+	header, err := HeaderForKey(signer.Public())
+	if err != nil {
+		return "", err
+	}
+	token := &Token{
+		Header:  header,
+		Message: message,
+		Footer:  footer,
+	}
+	token.Signature, err = crypt.SignWithScheme(signer, randReader, token.preAuth(signer.Public(), implicit), v3Scheme)
+	if err != nil {
+		return "", err
+	}
+	return token.String(), nil
+}
+
+// String returns the token in its encoded form.
+func (t *Token) String() string {
+	body := append(append([]byte{}, t.Message...), t.Signature...)
+	result := t.Header + base64.RawURLEncoding.EncodeToString(body)
+	if len(t.Footer) > 0 {
+		result += "." + base64.RawURLEncoding.EncodeToString(t.Footer)
+	}
+	return result
+}
+
+// Parse parses a v3.public or v4.public token. The signature is not
+// verified.
+func Parse(token string) (*Token, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if (len(parts) != 3) && (len(parts) != 4) {
+		return nil, fmt.Errorf("PASETO token has %d parts, but 3 or 4 were expected", len(parts))
+	}
+	result := &Token{Header: parts[0] + "." + parts[1] + "."}
+	sigSize, ok := signatureSizes[result.Header]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported PASETO version and purpose %#v: expected %s or %s", strings.TrimSuffix(result.Header, "."), strings.TrimSuffix(V3Public, "."), strings.TrimSuffix(V4Public, "."))
+	}
+	body, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("PASETO token payload is not valid base64url: %s", err.Error())
+	}
+	if len(body) < sigSize {
+		return nil, fmt.Errorf("PASETO token payload is %d bytes long, which is too short for a %d byte signature", len(body), sigSize)
+	}
+	result.Message = body[:len(body)-sigSize]
+	result.Signature = crypt.BinarySignature(body[len(body)-sigSize:])
+	if len(parts) == 4 {
+		if result.Footer, err = base64.RawURLEncoding.DecodeString(parts[3]); err != nil {
+			return nil, fmt.Errorf("PASETO token footer is not valid base64url: %s", err.Error())
+		}
+	}
+	return result, nil
+}
+
+// Verify checks the signature of the token against publicKey, which must be
+// the kind of key its version requires, along with the implicit assertion it
+// was signed with. An error explains why a signature isn't valid.
+func (t *Token) Verify(publicKey crypto.PublicKey, implicit []byte) (bool, error) {
+	header, err := HeaderForKey(publicKey)
+	if err != nil {
+		return false, err
+	}
+	if header != t.Header {
+		return false, fmt.Errorf("PASETO %s token can't be verified with a %s key", strings.TrimSuffix(t.Header, "."), strings.TrimSuffix(header, "."))
+	}
+	return crypt.VerifyWithScheme(publicKey, t.preAuth(publicKey, implicit), t.Signature, v3Scheme)
+}
@@ -0,0 +1,213 @@
+package paseto_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/smartedge/codechallenge/jwt"
+	"github.com/smartedge/codechallenge/paseto"
+	"github.com/smartedge/codechallenge/testtools"
+	"testing"
+)
+
+// V4SecretKey is the Ed25519 key of the official v4.public test vectors
+const V4SecretKey = "b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a37741eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2"
+
+// V4Message is the message of the official v4.public test vectors
+const V4Message = `{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`
+
+// V4Footer is the footer of the official v4.public test vectors that have one
+const V4Footer = `{"kid":"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN"}`
+
+// TestPAE tests the Pre-Authentication Encoding examples from the PASETO
+// specification.
+func TestPAE(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		pieces   [][]byte
+		expected string
+	}{
+		"No pieces":    {pieces: [][]byte{}, expected: "0000000000000000"},
+		"Empty piece":  {pieces: [][]byte{[]byte("")}, expected: "01000000000000000000000000000000"},
+		"Single piece": {pieces: [][]byte{[]byte("test")}, expected: "0100000000000000040000000000000074657374"},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			if actual := hex.EncodeToString(paseto.PAE(tc.pieces...)); actual != tc.expected {
+				tt.Errorf("PAE was %s when expecting %s", actual, tc.expected)
+			}
+		})
+	}
+}
+
+// TestV4Vectors tests signing and verifying the official v4.public test
+// vectors, which are deterministic as Ed25519 is.
+func TestV4Vectors(t *testing.T) {
+	secretKey, _ := hex.DecodeString(V4SecretKey)
+	signer := ed25519.PrivateKey(secretKey)
+	for desc, tc := range map[string]struct {
+		footer   string
+		implicit string
+		expected string
+	}{
+		"4-S-1": {
+			expected: "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA",
+		},
+		"4-S-2": {
+			footer:   V4Footer,
+			expected: "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9v3Jt8mx_TdM2ceTGoqwrh4yDFn0XsHvvV_D0DtwQxVrJEBMl0F2caAdgnpKlt4p7xBnx1HcO-SPo8FPp214HDw.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+		},
+		"4-S-3": {
+			footer:   V4Footer,
+			implicit: `{"test-vector":"4-S-3"}`,
+			expected: "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9NPWciuD3d0o5eXJXG5pJy-DiVEoyPYWs1YSTwWHNJq6DZD3je5gf-0M4JR9ipdUSJbIovzmBECeaWmaqcaP0DQ.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			token, err := paseto.Sign(signer, rand.Reader, []byte(V4Message), []byte(tc.footer), []byte(tc.implicit))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if token != tc.expected {
+				tt.Errorf("Token:\n%s when expecting:\n%s", token, tc.expected)
+			}
+			parsed, err := paseto.Parse(tc.expected)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if (string(parsed.Message) != V4Message) || (string(parsed.Footer) != tc.footer) {
+				tt.Errorf("Parsed message %#v and footer %#v don't match", string(parsed.Message), string(parsed.Footer))
+			}
+			if valid, err := parsed.Verify(signer.Public(), []byte(tc.implicit)); !valid {
+				tt.Errorf("Signature should be valid: %v", err)
+			}
+			if valid, _ := parsed.Verify(signer.Public(), []byte(`{"test-vector":"other"}`)); valid {
+				tt.Error("Signature with a different implicit assertion should not be valid")
+			}
+		})
+	}
+}
+
+// TestSignAndVerify verifies that the version is determined by the key, and
+// that a token can only be verified with the kind of key its version
+// requires.
+func TestSignAndVerify(t *testing.T) {
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p256Key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	for desc, tc := range map[string]struct {
+		signer    crypto.Signer
+		header    string
+		verifier  crypto.PublicKey
+		signErr   *testtools.ErrorSpec
+		verifyErr *testtools.ErrorSpec
+	}{
+		"v3.public": {
+			signer:   p384Key,
+			header:   paseto.V3Public,
+			verifier: p384Key.Public(),
+		},
+		"v4.public": {
+			signer:   ed25519Key,
+			header:   paseto.V4Public,
+			verifier: ed25519Key.Public(),
+		},
+		"P-256 key": {
+			signer:  p256Key,
+			signErr: &testtools.ErrorSpec{Type: "*errors.errorString", Message: "PASETO requires an Ed25519 key for v4.public tokens, or an ECDSA key on P-384 for v3.public tokens"},
+		},
+		"v3.public verified with an Ed25519 key": {
+			signer:    p384Key,
+			header:    paseto.V3Public,
+			verifier:  ed25519Key.Public(),
+			verifyErr: &testtools.ErrorSpec{Type: "*errors.errorString", Message: "PASETO v3.public token can't be verified with a v4.public key"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			token, err := paseto.Sign(tc.signer, rand.Reader, []byte("Hello, World!"), []byte("footer"), nil)
+			if err := tc.signErr.EnsureMatches(err); err != nil {
+				tt.Fatal(err.Error())
+			}
+			if tc.signErr != nil {
+				return
+			}
+			parsed, err := paseto.Parse(token)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if parsed.Header != tc.header {
+				tt.Errorf("Token header should be %s. Got %s instead.", tc.header, parsed.Header)
+			}
+			valid, err := parsed.Verify(tc.verifier, nil)
+			if err := tc.verifyErr.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+			if valid != (tc.verifyErr == nil) {
+				tt.Errorf("Signature should be valid: %t", tc.verifyErr == nil)
+			}
+		})
+	}
+}
+
+// TestParseErrors tests tokens that can't be parsed.
+func TestParseErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		token string
+		err   *testtools.ErrorSpec
+	}{
+		"Too few parts": {
+			token: "v4.public",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "PASETO token has 2 parts, but 3 or 4 were expected"},
+		},
+		"Local token": {
+			token: "v4.local.AAAA",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported PASETO version and purpose \"v4.local\": expected v3.public or v4.public"},
+		},
+		"Too short": {
+			token: "v4.public.AAAA",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "PASETO token payload is 3 bytes long, which is too short for a 64 byte signature"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			_, err := paseto.Parse(tc.token)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
+
+// TestClaims tests encoding claims with RFC 3339 times, and decoding them.
+func TestClaims(t *testing.T) {
+	claims := &jwt.Claims{}
+	if err := json.Unmarshal([]byte(`{"iss":"me","aud":"you","exp":1567342800,"iat":1567339200,"jti":"1","scope":"read"}`), claims); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	payload, err := paseto.MarshalClaims(claims)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	expected := `{"iss":"me","aud":"you","jti":"1","exp":"2019-09-01T13:00:00Z","iat":"2019-09-01T12:00:00Z","scope":"read"}`
+	if string(payload) != expected {
+		t.Errorf("Payload:\n%s when expecting:\n%s", string(payload), expected)
+	}
+	parsed, err := paseto.UnmarshalClaims([]byte(V4Message))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	actual, _ := json.Marshal(parsed)
+	if expected := `{"exp":1640995200,"data":"this is a signed message"}`; string(actual) != expected {
+		t.Errorf("Claims:\n%s when expecting:\n%s", string(actual), expected)
+	}
+	if _, err := paseto.MarshalClaims(&jwt.Claims{Audience: jwt.Audience{"you", "them"}}); err == nil {
+		t.Error("Multiple audiences should not be allowed")
+	}
+	_, err = paseto.UnmarshalClaims([]byte(`{"exp":1640995200}`))
+	numericTime := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "PASETO exp claim 1640995200 is not an RFC 3339 time"}
+	if err := numericTime.EnsureMatches(err); err != nil {
+		t.Error(err.Error())
+	}
+}
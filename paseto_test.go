@@ -0,0 +1,125 @@
+package codechallenge_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestIssueAndVerifyPASETO verifies that tokens issued by the paseto command
+// are accepted by the verify-paseto command, with the version determined by
+// the key, until they expire, using the mock clock.
+func TestIssueAndVerifyPASETO(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		issueArgs  []string
+		header     string
+		verifyArgs []string
+		verifyAt   time.Duration
+		status     int
+		stdOutput  testtools.StringMatcher
+	}{
+		"v4.public with a footer and implicit assertion": {
+			issueArgs:  []string{"codechallenge", "paseto", "-ed25519", "-iss", "me", "-jti", "1", "-footer", "{\"kid\":\"1\"}", "-implicit", "device-42"},
+			header:     "v4.public.",
+			verifyArgs: []string{"codechallenge", "verify-paseto", "-ed25519", "-iss", "me", "-footer", "{\"kid\":\"1\"}", "-implicit", "device-42"},
+			verifyAt:   30 * time.Minute,
+			status:     0,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"claims\": {\n" +
+				"\"iss\": \"me\",\n\"exp\": 1567342800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\"\n},\n\"footer\": \"{\\\"kid\\\":\\\"1\\\"}\"\n}"),
+		},
+		"v3.public with claims from a file": {
+			issueArgs:  []string{"codechallenge", "paseto", "-curve", "P-384", "-private", "p384.priv", "-public", "p384.pub", "-claims", "claims.json", "-jti", "1"},
+			header:     "v3.public.",
+			verifyArgs: []string{"codechallenge", "verify-paseto", "-public", "p384.pub"},
+			verifyAt:   30 * time.Minute,
+			status:     0,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\",\n\"claims\": {\n" +
+				"\"iss\": \"not me\",\n\"sub\": \"someone\",\n\"exp\": 1567342800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\",\n\"scope\": \"read\"\n}\n}"),
+		},
+		"Expired": {
+			issueArgs:  []string{"codechallenge", "paseto", "-ed25519", "-exp", "10m", "-jti", "1"},
+			header:     "v4.public.",
+			verifyArgs: []string{"codechallenge", "verify-paseto", "-ed25519"},
+			verifyAt:   11 * time.Minute,
+			status:     11,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"invalid claims\",\n\"detail\": \"token expired at 2019-09-01T12:10:00Z\",\n\"claims\": {\n" +
+				"\"exp\": 1567339800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\"\n}\n}"),
+		},
+		"Wrong footer": {
+			issueArgs:  []string{"codechallenge", "paseto", "-ed25519", "-jti", "1", "-footer", "a"},
+			header:     "v4.public.",
+			verifyArgs: []string{"codechallenge", "verify-paseto", "-ed25519", "-footer", "b"},
+			status:     11,
+			stdOutput: testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"invalid claims\",\n\"detail\": \"token footer \\\"a\\\" does not match \\\"b\\\"\",\n\"claims\": {\n" +
+				"\"exp\": 1567342800,\n\"nbf\": 1567339200,\n\"iat\": 1567339200,\n\"jti\": \"1\"\n},\n\"footer\": \"a\"\n}"),
+		},
+		"Missing implicit assertion": {
+			issueArgs:  []string{"codechallenge", "paseto", "-ed25519", "-implicit", "device-42"},
+			header:     "v4.public.",
+			verifyArgs: []string{"codechallenge", "verify-paseto", "-ed25519"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+		},
+		"Verified with a key of another version": {
+			issueArgs:  []string{"codechallenge", "paseto", "-curve", "P-384", "-private", "p384.priv", "-public", "p384.pub"},
+			header:     "v3.public.",
+			verifyArgs: []string{"codechallenge", "verify-paseto", "-ed25519"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"PASETO v3.public token can't be verified with a v4.public key\"\n}"),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/claims.json": testtools.StringPtr("{\"sub\": \"someone\", \"iss\": \"not me\", \"scope\": \"read\"}"),
+			}
+			// Generate the default Ed25519 key-pair, in case the token is
+			// issued with another:
+			defaultBundle := mocks.NewDefaultMockDeps("Hello, World!", []string{"codechallenge", "-ed25519"}, "/home/anybody", &files)
+			err := defaultBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(defaultBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling defaultBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			issueBundle := mocks.NewDefaultMockDeps("", tc.issueArgs, "/home/anybody", &files)
+			err = issueBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(issueBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Fatalf("Unexpected error calling issueBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := issueBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Issuing failed with exit status %d:\n%s", exitStatus, issueBundle.ErrBuf.String())
+			}
+			if token := issueBundle.OutBuf.String(); !strings.HasPrefix(token, tc.header) {
+				tt.Errorf("Token %s should start with %s", token, tc.header)
+			}
+			verifyBundle := mocks.NewDefaultMockDeps(issueBundle.OutBuf.String(), tc.verifyArgs, "/home/anybody", &files)
+			verifyBundle.Deps.Time.Now = func() time.Time {
+				return mocks.MockCurrentTime.Add(tc.verifyAt)
+			}
+			err = verifyBundle.InvokeCallInMockedEnv(func() error {
+				codechallenge.RealMain(verifyBundle.Deps)
+				return nil
+			})
+			if err != nil {
+				tt.Errorf("Unexpected error calling verifyBundle.InvokeCallInMockedEnv(): %s", err.Error())
+			}
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if verifyBundle.ErrBuf.String() != "" {
+				tt.Errorf("Standard Error should be empty. Got:\n%s", verifyBundle.ErrBuf.String())
+			}
+		})
+	}
+}
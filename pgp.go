@@ -0,0 +1,172 @@
+package codechallenge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/openpgp"
+	"io/ioutil"
+	"strings"
+)
+
+// loadPGPPublicKey reads the public key in filename, which may be an armored
+// OpenPGP key, such as one exported by gpg, or a PEM encoded key.
+func loadPGPPublicKey(d *deps.Dependencies, filename string) (*openpgp.PublicKey, error) {
+	buff, err := d.Io.Ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(buff, []byte("-----BEGIN "+openpgp.PublicKeyBlock+"-----")) {
+		key, _, err := openpgp.ParsePublicKey(string(buff))
+		return key, err
+	}
+	publicKey, err := loadPublicKey(d, filename)
+	if err != nil {
+		return nil, err
+	}
+	return openpgp.NewPublicKey(publicKey)
+}
+
+// ExportPGPKeyMain is the entry-point for the export-pgp-key command. It
+// writes the public key to d.Os.Stdout as an armored OpenPGP key with the
+// user ID in config, self-certified now.
+func ExportPGPKeyMain(d *deps.Dependencies, config *RunConfig) {
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	buff, err := openpgp.ExportPublicKey(cryptStuff.Signer, d.Crypto.Rand.Reader, config.Output.UserID, config.PubKeySettings.GetHash(), d.Time.Now())
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	key, _, err := openpgp.ParsePublicKey(string(buff))
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	expected, err := openpgp.NewPublicKey(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !bytes.Equal(key.Fingerprint(), expected.Fingerprint()) {
+		HandleError(d, errors.New("round trip verification of exported key failed"), 7)
+	}
+	err = WriteOutput(d, buff)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// SignPGPMain signs message with the keys in cryptStuff, and writes it to
+// d.Os.Stdout as a cleartext signed message, or writes a detached armored
+// signature of it.
+func SignPGPMain(d *deps.Dependencies, config *RunConfig, cryptStuff *crypt.CryptoTooling, message string) {
+	hash := config.PubKeySettings.GetHash()
+	var buff []byte
+	var err error
+	if config.Output.Detached {
+		buff, err = openpgp.SignDetached(cryptStuff.Signer, d.Crypto.Rand.Reader, hash, []byte(message), d.Time.Now())
+	} else {
+		buff, err = openpgp.SignCleartext(cryptStuff.Signer, d.Crypto.Rand.Reader, hash, message, d.Time.Now())
+	}
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	var sig *openpgp.Signature
+	signed := message
+	if config.Output.Detached {
+		sig, err = openpgp.ParseDetached(string(buff))
+	} else {
+		signed, sig, err = openpgp.ParseCleartext(string(buff))
+	}
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	key, err := openpgp.NewPublicKey(cryptStuff.Signer.Public())
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	valid, err := sig.Verify(key, []byte(signed))
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	err = WriteOutput(d, buff)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// VerifyPGPMain is the entry-point for -verify mode with OpenPGP input. It
+// reads a cleartext signed message, or a detached armored signature of the
+// payload file in config, from d.Os.Stdin, and writes the verdict in JSON
+// format to d.Os.Stdout, exiting with the verdict's exit status if it isn't
+// valid.
+func VerifyPGPMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	input := string(buff)
+	var sig *openpgp.Signature
+	text := ""
+	if config.Output.PayloadPath != "" {
+		sig, err = openpgp.ParseDetached(input)
+	} else if !strings.Contains(input, "-----BEGIN "+openpgp.SignedMessageBlock+"-----") && strings.Contains(input, "-----BEGIN "+openpgp.SignatureBlock+"-----") {
+		err = errors.New("OpenPGP signature is detached, which requires -payload")
+	} else {
+		text, sig, err = openpgp.ParseCleartext(input)
+	}
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifyPGP(d, config, sig, text)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifyPGP checks sig against the public key file in config. The signed data
+// is text, or the payload file in config if the signature is detached.
+func VerifyPGP(d *deps.Dependencies, config *RunConfig, sig *openpgp.Signature, text string) (*Verdict, error) {
+	signed := []byte(text)
+	if config.Output.PayloadPath != "" {
+		payload, err := d.Io.Ioutil.ReadFile(config.Output.PayloadPath)
+		if err != nil {
+			return nil, err
+		}
+		signed = payload
+	}
+	key, err := loadPGPPublicKey(d, config.PubKeySettings.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return newVerdictFromVerification(sig.Verify(key, signed)), nil
+}
+
+// parsePGPOptions validates the OpenPGP user ID option in cl into config.
+func parsePGPOptions(config *RunConfig, cl *commandLine) error {
+	if *cl.userID != "" {
+		if config.Command != ExportPGPKeyCommand {
+			return fmt.Errorf("Option -uid is only valid with the %s command", ExportPGPKeyCommand)
+		}
+		config.Output.UserID = *cl.userID
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package codechallenge_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/openpgp"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"strings"
+	"testing"
+)
+
+// TestSignAndVerifyPGP verifies that OpenPGP output written by RealMain can
+// be verified in -verify mode, cleartext or detached, against a PEM public
+// key or one exported by the export-pgp-key command.
+func TestSignAndVerifyPGP(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signArgs   []string
+		detached   bool
+		verifyArgs []string
+		status     int
+		stdOutput  testtools.StringMatcher
+		stdErr     testtools.StringMatcher
+	}{
+		"Cleartext": {
+			signArgs:   []string{"codechallenge", "-format", "pgp"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "pgp"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Cleartext with SHA-512": {
+			signArgs:   []string{"codechallenge", "-format", "pgp", "-hash", "sha512"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "pgp"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"RSA": {
+			signArgs:   []string{"codechallenge", "-rsa", "-format", "pgp"},
+			verifyArgs: []string{"codechallenge", "-rsa", "-verify", "-format", "pgp"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Ed25519": {
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "pgp"},
+			verifyArgs: []string{"codechallenge", "-ed25519", "-verify", "-format", "pgp"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Verified with the exported key": {
+			signArgs:   []string{"codechallenge", "-format", "pgp"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "pgp", "-public", "exported.asc"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Detached with payload file": {
+			signArgs:   []string{"codechallenge", "-format", "pgp", "-detached"},
+			detached:   true,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "pgp", "-payload", "hello.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Detached binary with the wrong payload file": {
+			signArgs:   []string{"codechallenge", "-format", "pgp", "-detached", "-binary"},
+			detached:   true,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "pgp", "-payload", "goodbye.txt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Detached without payload file": {
+			signArgs:   []string{"codechallenge", "-format", "pgp", "-detached"},
+			detached:   true,
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "pgp"},
+			status:     2,
+			stdOutput:  testtools.NewStringStringMatcher(""),
+			stdErr:     testtools.NewStringStringMatcher("OpenPGP signature is detached, which requires -payload\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Verified with the wrong key": {
+			signArgs:   []string{"codechallenge", "-format", "pgp"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "pgp", "-public", "other.pub"},
+			status:     9,
+			stdOutput:  testtools.NewRegexpStringMatcher("^\\{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"OpenPGP signature was made by key [0-9A-F]{40}, not [0-9A-F]{40}\"\n\\}$"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/hello.txt":   testtools.StringPtr("Hello, World!"),
+				"/home/anybody/goodbye.txt": testtools.StringPtr("Goodbye, World!"),
+			}
+			// An unrelated key-pair, to verify with, and the default key-pair,
+			// exported:
+			testtools.AddOtherKeyPair(files, "/home/anybody")
+			keyBundle := runMain(tt, &files, "", codechallenge.ExportPGPKeyCommand, "-uid", "Anybody <anybody@example.com>")
+			files["/home/anybody/exported.asc"] = testtools.StringPtr(keyBundle.OutBuf.String())
+			signBundle := runMain(tt, &files, "Hello, World!", tc.signArgs[1:]...)
+			if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+			}
+			var sig *openpgp.Signature
+			var err error
+			if tc.detached {
+				sig, err = openpgp.ParseDetached(signBundle.OutBuf.String())
+			} else {
+				_, sig, err = openpgp.ParseCleartext(signBundle.OutBuf.String())
+			}
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing OpenPGP signature: %s", err.Error())
+			}
+			if !sig.Created.Equal(mocks.MockCurrentTime) {
+				tt.Errorf("OpenPGP signature creation time should be %s. Got %s instead.", mocks.MockCurrentTime, sig.Created)
+			}
+			verifyBundle := runMain(tt, &files, signBundle.OutBuf.String(), tc.verifyArgs[1:]...)
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if err := tc.stdErr.MatchString(verifyBundle.ErrBuf.String()); err != nil {
+				tt.Errorf("Standard Error:\n%#v didn't match:\n%s.", verifyBundle.ErrBuf.String(), err.Error())
+			}
+		})
+	}
+}
+
+// TestExportPGPKey verifies that the export-pgp-key command writes the
+// default key-pair's public key with the given user ID.
+func TestExportPGPKey(t *testing.T) {
+	files := testtools.FakeFileSystem{}
+	args := []string{"codechallenge", "export-pgp-key", "-uid", "Anybody <anybody@example.com>"}
+	bundle := mocks.NewDefaultMockDeps("", args, "/home/anybody", &files)
+	err := bundle.InvokeCallInMockedEnv(func() error {
+		codechallenge.RealMain(bundle.Deps)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error calling bundle.InvokeCallInMockedEnv(): %s", err.Error())
+	}
+	if exitStatus := bundle.GetExitStatus(); exitStatus != 0 {
+		t.Fatalf("Export failed with exit status %d:\n%s", exitStatus, bundle.ErrBuf.String())
+	}
+	if !strings.HasPrefix(bundle.OutBuf.String(), "-----BEGIN PGP PUBLIC KEY BLOCK-----\n") {
+		t.Errorf("Output should be an armored public key. Got:\n%s", bundle.OutBuf.String())
+	}
+	key, userIDs, err := openpgp.ParsePublicKey(bundle.OutBuf.String())
+	if err != nil {
+		t.Fatalf("Unexpected error parsing exported key: %s", err.Error())
+	}
+	if (len(userIDs) != 1) || (userIDs[0] != "Anybody <anybody@example.com>") {
+		t.Errorf("Exported key should have the user ID \"Anybody <anybody@example.com>\". Got %#v instead.", userIDs)
+	}
+	if !key.Created.Equal(openpgp.KeyCreationTime) {
+		t.Errorf("Exported key should have been created at %s. Got %s instead.", openpgp.KeyCreationTime, key.Created)
+	}
+	if _, ok := files["/home/anybody/.smartEdge/id_ecdsa.pub"]; !ok {
+		t.Error("Exporting a key should create the default key-pair")
+	}
+}
@@ -0,0 +1,328 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// CRLPEMType is the type of PEM blocks containing CRLs, as defined by RFC
+// 7468.
+const CRLPEMType = "X509 CRL"
+
+// DefaultCRLValidity is how long a CRL is valid for, until the next is
+// issued, if not given.
+const DefaultCRLValidity = 30 * 24 * time.Hour
+
+// indexTimeFormat is the format of times in an index, as in the UTCTime of
+// X.509.
+const indexTimeFormat = "060102150405Z"
+
+// Statuses of certificates in an index
+const (
+	StatusValid   = "V"
+	StatusRevoked = "R"
+)
+
+// IndexEntry records a certificate issued by a CA, and whether it has been
+// revoked.
+type IndexEntry struct {
+	Status       string
+	NotAfter     time.Time
+	RevokedAt    time.Time
+	SerialNumber *big.Int
+	Subject      string
+}
+
+// ParseIndex parses an index of issued certificates in the format of the
+// index.txt of OpenSSL's ca command: a line per certificate of its status,
+// expiry, revocation time, serial number in hex, file name and subject,
+// separated by tabs. Subjects are in the string form of RFC 4514.
+func ParseIndex(buff []byte) ([]IndexEntry, error) {
+	result := []IndexEntry{}
+	for i, line := range strings.Split(string(buff), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("Line %d of index has %d fields, but 6 were expected", i+1, len(fields))
+		}
+		entry := IndexEntry{Status: fields[0], Subject: fields[5]}
+		if (entry.Status != StatusValid) && (entry.Status != StatusRevoked) {
+			return nil, fmt.Errorf("Line %d of index has unrecognized status %#v", i+1, entry.Status)
+		}
+		var err error
+		if entry.NotAfter, err = time.Parse(indexTimeFormat, fields[1]); err != nil {
+			return nil, fmt.Errorf("Line %d of index has a malformed expiry time %#v", i+1, fields[1])
+		}
+		if (entry.Status == StatusRevoked) != (fields[2] != "") {
+			return nil, fmt.Errorf("Line %d of index must have a revocation time if and only if it is revoked", i+1)
+		}
+		if entry.Status == StatusRevoked {
+			if entry.RevokedAt, err = time.Parse(indexTimeFormat, fields[2]); err != nil {
+				return nil, fmt.Errorf("Line %d of index has a malformed revocation time %#v", i+1, fields[2])
+			}
+		}
+		if entry.SerialNumber, err = ParseSerialNumber(fields[3]); err != nil {
+			return nil, fmt.Errorf("Line %d of index: %s", i+1, err.Error())
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// FormatIndex returns entries in the format parsed by ParseIndex.
+func FormatIndex(entries []IndexEntry) []byte {
+	var buff bytes.Buffer
+	for _, entry := range entries {
+		revokedAt := ""
+		if entry.Status == StatusRevoked {
+			revokedAt = entry.RevokedAt.UTC().Format(indexTimeFormat)
+		}
+		fmt.Fprintf(&buff, "%s\t%s\t%s\t%s\tunknown\t%s\n", entry.Status, entry.NotAfter.UTC().Format(indexTimeFormat), revokedAt, FormatSerialNumber(entry.SerialNumber), entry.Subject)
+	}
+	return buff.Bytes()
+}
+
+// ParseSerialNumber parses a serial number in hex, as in OpenSSL's serial
+// files.
+func ParseSerialNumber(value string) (*big.Int, error) {
+	result, ok := new(big.Int).SetString(strings.TrimSpace(value), 16)
+	if !ok || (result.Sign() <= 0) {
+		return nil, fmt.Errorf("Serial number %#v is not a positive hex number", strings.TrimSpace(value))
+	}
+	return result, nil
+}
+
+// FormatSerialNumber returns serialNumber in upper case hex, with an even
+// number of digits, as in OpenSSL's serial files.
+func FormatSerialNumber(serialNumber *big.Int) string {
+	result := strings.ToUpper(serialNumber.Text(16))
+	if len(result)%2 != 0 {
+		result = "0" + result
+	}
+	return result
+}
+
+// ParseRequest parses a certificate signing request in PEM or DER, and
+// checks its signature.
+func ParseRequest(buff []byte) (*x509.CertificateRequest, error) {
+	der := buff
+	if block, _ := pem.Decode(buff); block != nil {
+		if block.Type != RequestPEMType {
+			return nil, fmt.Errorf("Input is a PEM %s, but a %s was expected", block.Type, RequestPEMType)
+		}
+		der = block.Bytes
+	}
+	request, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, errors.New("Input is not a PEM or DER encoded certificate signing request")
+	}
+	if err := request.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("Certificate signing request has an invalid signature: %s", err.Error())
+	}
+	return request, nil
+}
+
+// CheckNameConstraints returns an error if a DNS name of request isn't
+// permitted by the DNS name constraints of ca.
+func CheckNameConstraints(ca *x509.Certificate, request *x509.CertificateRequest) error {
+	for _, name := range request.DNSNames {
+		for _, excluded := range ca.ExcludedDNSDomains {
+			if dnsNameWithin(name, excluded) {
+				return fmt.Errorf("DNS name %s is excluded by the name constraints of the CA", name)
+			}
+		}
+		permitted := len(ca.PermittedDNSDomains) == 0
+		for _, domain := range ca.PermittedDNSDomains {
+			permitted = permitted || dnsNameWithin(name, domain)
+		}
+		if !permitted {
+			return fmt.Errorf("DNS name %s is not permitted by the name constraints of the CA", name)
+		}
+	}
+	return nil
+}
+
+// dnsNameWithin returns true if name is domain or a subdomain of it, as
+// defined for DNS name constraints by RFC 5280. A domain with a leading
+// period only matches subdomains.
+func dnsNameWithin(name string, domain string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	domain = strings.ToLower(domain)
+	if strings.HasPrefix(domain, ".") {
+		return strings.HasSuffix(name, domain)
+	}
+	return (name == domain) || strings.HasSuffix(name, "."+domain)
+}
+
+// Issue returns a certificate of the key of request, with its subject and
+// subject alternative names and otherwise the profile, issued by ca with the
+// key of caSigner, with serialNumber, and valid from now. The certificate
+// must be within the name constraints and validity period of ca.
+func Issue(ca *x509.Certificate, caSigner crypto.Signer, randReader io.Reader, request *x509.CertificateRequest, profile *Profile, serialNumber *big.Int, now time.Time) (*x509.Certificate, error) {
+	if !ca.IsCA || (ca.KeyUsage&x509.KeyUsageCertSign == 0) {
+		return nil, errors.New("CA certificate may not be used to sign certificates")
+	}
+	if profile.IsCA && ca.MaxPathLenZero {
+		return nil, errors.New("CA certificate may not be used to sign CA certificates, as its path length is 0")
+	}
+	if err := CheckNameConstraints(ca, request); err != nil {
+		return nil, err
+	}
+	issued := *profile
+	issued.Subject = request.Subject
+	issued.DNSNames = request.DNSNames
+	issued.EmailAddresses = request.EmailAddresses
+	issued.IPAddresses = request.IPAddresses
+	issued.URIs = request.URIs
+	template, err := issued.Template(serialNumber, request.PublicKey, now)
+	if err != nil {
+		return nil, err
+	}
+	if now.Before(ca.NotBefore) || template.NotAfter.After(ca.NotAfter) {
+		return nil, fmt.Errorf("Certificate would be valid until %s, but the CA certificate is only valid from %s until %s", template.NotAfter.Format(time.RFC3339), ca.NotBefore.Format(time.RFC3339), ca.NotAfter.Format(time.RFC3339))
+	}
+	der, err := x509.CreateCertificate(randReader, template, ca, request.PublicKey, caSigner)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Object identifiers of the authority key identifier and CRL number
+// extensions, and of the signature algorithms CRLs are signed with
+var (
+	oidExtensionAuthorityKeyID = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionCRLNumber      = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidSHA256WithRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA256         = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384         = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512         = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519                 = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// authorityKeyID is the value of the authority key identifier extension.
+type authorityKeyID struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// crlSignatureAlgorithm returns the hash and the signature algorithm to sign
+// CRLs with publicKey, as x509.CreateCertificate chooses them for
+// certificates. The hash is zero for Ed25519, which signs the CRL itself.
+func crlSignatureAlgorithm(publicKey crypto.PublicKey) (crypto.Hash, pkix.AlgorithmIdentifier, error) {
+	switch typed := publicKey.(type) {
+	case *rsa.PublicKey:
+		return crypto.SHA256, pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		switch typed.Curve {
+		case elliptic.P256():
+			return crypto.SHA256, pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+		case elliptic.P384():
+			return crypto.SHA384, pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA384}, nil
+		case elliptic.P521():
+			return crypto.SHA512, pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA512}, nil
+		}
+	case ed25519.PublicKey:
+		return 0, pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, nil
+	}
+	return 0, pkix.AlgorithmIdentifier{}, errors.New("CA key is of an unsupported algorithm for signing CRLs")
+}
+
+// CreateCRL returns the DER encoding of a CRL issued by ca with the key of
+// caSigner, listing the revoked certificates in entries, with number, valid
+// from now for validity. The CRL is built by hand, as x509.CreateCRL can't
+// give it a CRL number.
+func CreateCRL(ca *x509.Certificate, caSigner crypto.Signer, randReader io.Reader, entries []IndexEntry, number *big.Int, now time.Time, validity time.Duration) ([]byte, error) {
+	if validity <= 0 {
+		return nil, errors.New("CRL validity must be positive")
+	}
+	hash, signatureAlgorithm, err := crlSignatureAlgorithm(caSigner.Public())
+	if err != nil {
+		return nil, err
+	}
+	var issuer pkix.RDNSequence
+	if _, err := asn1.Unmarshal(ca.RawSubject, &issuer); err != nil {
+		return nil, err
+	}
+	numberValue, err := asn1.Marshal(number)
+	if err != nil {
+		return nil, err
+	}
+	tbsCertList := pkix.TBSCertificateList{
+		Version:    1,
+		Signature:  signatureAlgorithm,
+		Issuer:     issuer,
+		ThisUpdate: now.UTC().Truncate(time.Second),
+		NextUpdate: now.UTC().Truncate(time.Second).Add(validity),
+		Extensions: []pkix.Extension{{Id: oidExtensionCRLNumber, Value: numberValue}},
+	}
+	if len(ca.SubjectKeyId) > 0 {
+		value, err := asn1.Marshal(authorityKeyID{ID: ca.SubjectKeyId})
+		if err != nil {
+			return nil, err
+		}
+		tbsCertList.Extensions = append(tbsCertList.Extensions, pkix.Extension{Id: oidExtensionAuthorityKeyID, Value: value})
+	}
+	for _, entry := range entries {
+		if entry.Status != StatusRevoked {
+			continue
+		}
+		tbsCertList.RevokedCertificates = append(tbsCertList.RevokedCertificates, pkix.RevokedCertificate{
+			SerialNumber:   entry.SerialNumber,
+			RevocationTime: entry.RevokedAt.UTC(),
+		})
+	}
+	signed, err := asn1.Marshal(tbsCertList)
+	if err != nil {
+		return nil, err
+	}
+	if hash != 0 {
+		h := hash.New()
+		h.Write(signed)
+		signed = h.Sum(nil)
+	}
+	signature, err := caSigner.Sign(randReader, signed, hash)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkix.CertificateList{
+		TBSCertList:        tbsCertList,
+		SignatureAlgorithm: signatureAlgorithm,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+}
+
+// CRLNumber returns the CRL number of crl, or nil if it has none.
+func CRLNumber(crl *pkix.CertificateList) *big.Int {
+	for _, extension := range crl.TBSCertList.Extensions {
+		if !extension.Id.Equal(oidExtensionCRLNumber) {
+			continue
+		}
+		number := new(big.Int)
+		if rest, err := asn1.Unmarshal(extension.Value, &number); (err != nil) || (len(rest) != 0) {
+			return nil
+		}
+		return number
+	}
+	return nil
+}
+
+// EncodeCRLPEM returns the PEM encoding of the DER encoded CRL der.
+func EncodeCRLPEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: CRLPEMType, Bytes: der})
+}
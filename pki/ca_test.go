@@ -0,0 +1,227 @@
+package pki_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"github.com/smartedge/codechallenge/pki"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// TestIndex verifies that indexes of issued certificates round trip, and
+// that malformed ones are rejected.
+func TestIndex(t *testing.T) {
+	now := time.Unix(1567339200, 0).UTC()
+	entries := []pki.IndexEntry{
+		{Status: pki.StatusValid, NotAfter: now.Add(pki.DefaultValidity), SerialNumber: big.NewInt(1), Subject: "CN=signer"},
+		{Status: pki.StatusRevoked, NotAfter: now.Add(pki.DefaultValidity), RevokedAt: now, SerialNumber: big.NewInt(0x1ab), Subject: "CN=other,O=Example Corp"},
+	}
+	buff := pki.FormatIndex(entries)
+	expected := "V\t200831120000Z\t\t01\tunknown\tCN=signer\nR\t200831120000Z\t190901120000Z\t01AB\tunknown\tCN=other,O=Example Corp\n"
+	if string(buff) != expected {
+		t.Errorf("Index should be %#v. Got %#v instead.", expected, string(buff))
+	}
+	parsed, err := pki.ParseIndex(buff)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if fmt.Sprint(parsed) != fmt.Sprint(entries) {
+		t.Errorf("Index should parse to %v. Got %v instead.", entries, parsed)
+	}
+	for desc, tc := range map[string]struct {
+		index string
+		err   string
+	}{
+		"Missing field": {
+			index: "V\t200831120000Z\t01\tunknown\tCN=signer\n",
+			err:   "Line 1 of index has 5 fields, but 6 were expected",
+		},
+		"Unrecognized status": {
+			index: "V\t200831120000Z\t\t01\tunknown\tCN=signer\nE\t200831120000Z\t\t02\tunknown\tCN=signer\n",
+			err:   "Line 2 of index has unrecognized status \"E\"",
+		},
+		"Revoked without time": {
+			index: "R\t200831120000Z\t\t01\tunknown\tCN=signer\n",
+			err:   "Line 1 of index must have a revocation time if and only if it is revoked",
+		},
+		"Malformed serial number": {
+			index: "V\t200831120000Z\t\tXY\tunknown\tCN=signer\n",
+			err:   "Line 1 of index: Serial number \"XY\" is not a positive hex number",
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			if _, err := pki.ParseIndex([]byte(tc.index)); (err == nil) || (err.Error() != tc.err) {
+				tt.Errorf("ParseIndex should fail with %#v. Got %v instead.", tc.err, err)
+			}
+		})
+	}
+}
+
+// TestIssue verifies that a CA issues certificates with the names of the
+// CSR and the profile, within its name constraints and validity period.
+func TestIssue(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Unix(1567339200, 0)
+	caProfile := pki.NewProfile("Test CA")
+	caProfile.IsCA = true
+	caProfile.PermittedDNSDomains = []string{"example.com"}
+	caProfile.ExcludedDNSDomains = []string{"private.example.com"}
+	ca, err := pki.SelfSign(caKey, rand.Reader, caProfile, now)
+	if err != nil {
+		t.Fatalf("Unexpected error creating CA: %s", err.Error())
+	}
+	if !ca.PermittedDNSDomainsCritical || (fmt.Sprint(ca.PermittedDNSDomains, ca.ExcludedDNSDomains) != "[example.com] [private.example.com]") {
+		t.Errorf("CA has name constraints %v and %v.", ca.PermittedDNSDomains, ca.ExcludedDNSDomains)
+	}
+	for desc, tc := range map[string]struct {
+		names    []string
+		validity time.Duration
+		err      string
+	}{
+		"Permitted name": {
+			names:    []string{"signer.example.com", "signer@example.com"},
+			validity: pki.DefaultValidity,
+		},
+		"Domain of the constraint": {
+			names:    []string{"example.com"},
+			validity: pki.DefaultValidity,
+		},
+		"Name outside permitted domains": {
+			names:    []string{"signer.example.org"},
+			validity: pki.DefaultValidity,
+			err:      "DNS name signer.example.org is not permitted by the name constraints of the CA",
+		},
+		"Name with permitted suffix": {
+			names:    []string{"signerexample.com"},
+			validity: pki.DefaultValidity,
+			err:      "DNS name signerexample.com is not permitted by the name constraints of the CA",
+		},
+		"Excluded name": {
+			names:    []string{"host.private.example.com"},
+			validity: pki.DefaultValidity,
+			err:      "DNS name host.private.example.com is excluded by the name constraints of the CA",
+		},
+		"Outlives the CA": {
+			names:    []string{"signer.example.com"},
+			validity: 2 * pki.DefaultValidity,
+			err:      "Certificate would be valid until 2021-08-31T12:00:00Z, but the CA certificate is only valid from 2019-09-01T12:00:00Z until 2020-08-31T12:00:00Z",
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			requestProfile := pki.NewProfile("signer")
+			for _, name := range tc.names {
+				_ = requestProfile.AddSubjectAltName(name)
+			}
+			der, err := pki.CreateRequest(key, rand.Reader, requestProfile)
+			if err != nil {
+				tt.Fatalf("Unexpected error creating CSR: %s", err.Error())
+			}
+			request, err := pki.ParseRequest(pki.EncodeRequestPEM(der))
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing CSR: %s", err.Error())
+			}
+			profile := pki.NewProfile("ignored")
+			profile.Validity = tc.validity
+			profile.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+			cert, err := pki.Issue(ca, caKey, rand.Reader, request, profile, big.NewInt(2), now)
+			if tc.err != "" {
+				if (err == nil) || (err.Error() != tc.err) {
+					tt.Errorf("Issue should fail with %#v. Got %v instead.", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if err := cert.CheckSignatureFrom(ca); err != nil {
+				tt.Errorf("Certificate is not signed by the CA: %s", err.Error())
+			}
+			if (cert.Subject.String() != "CN=signer") || (cert.Issuer.String() != "CN=Test CA") || (cert.SerialNumber.Int64() != 2) {
+				tt.Errorf("Certificate has subject %s, issuer %s and serial number %s.", cert.Subject, cert.Issuer, cert.SerialNumber)
+			}
+			if fmt.Sprint(cert.DNSNames, cert.EmailAddresses) != fmt.Sprint(request.DNSNames, request.EmailAddresses) {
+				tt.Errorf("Certificate has DNS names %v and email addresses %v.", cert.DNSNames, cert.EmailAddresses)
+			}
+			if fmt.Sprint(cert.ExtKeyUsage) != fmt.Sprint(profile.ExtKeyUsage) {
+				tt.Errorf("Certificate has extended key usages %v.", cert.ExtKeyUsage)
+			}
+			if !pki.Certifies(cert, key.Public()) {
+				tt.Errorf("Certificate does not certify the key of the CSR.")
+			}
+		})
+	}
+	intermediate := pki.NewProfile("Intermediate CA")
+	intermediate.IsCA = true
+	intermediate.MaxPathLen = 0
+	intermediateCert, err := pki.Issue(ca, caKey, rand.Reader, mustParseRequest(t, key, "Intermediate CA"), intermediate, big.NewInt(3), now)
+	if err != nil {
+		t.Fatalf("Unexpected error issuing intermediate CA: %s", err.Error())
+	}
+	if !intermediateCert.IsCA || !intermediateCert.MaxPathLenZero {
+		t.Errorf("Intermediate CA has IsCA %t and MaxPathLen %d.", intermediateCert.IsCA, intermediateCert.MaxPathLen)
+	}
+	if _, err := pki.Issue(intermediateCert, key, rand.Reader, mustParseRequest(t, key, "Another CA"), intermediate, big.NewInt(4), now); (err == nil) || (err.Error() != "CA certificate may not be used to sign CA certificates, as its path length is 0") {
+		t.Errorf("Issuing a CA below a path length of 0 should fail. Got %v instead.", err)
+	}
+	leaf, _ := pki.SelfSign(key, rand.Reader, pki.NewProfile("signer"), now)
+	if _, err := pki.Issue(leaf, key, rand.Reader, mustParseRequest(t, key, "signer"), pki.NewProfile("signer"), big.NewInt(2), now); (err == nil) || (err.Error() != "CA certificate may not be used to sign certificates") {
+		t.Errorf("Issuing with a leaf certificate should fail. Got %v instead.", err)
+	}
+}
+
+// mustParseRequest returns a parsed CSR for key with a common name of
+// commonName.
+func mustParseRequest(t *testing.T, key *ecdsa.PrivateKey, commonName string) *x509.CertificateRequest {
+	der, err := pki.CreateRequest(key, rand.Reader, pki.NewProfile(commonName))
+	if err != nil {
+		t.Fatalf("Unexpected error creating CSR: %s", err.Error())
+	}
+	request, err := pki.ParseRequest(der)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing CSR: %s", err.Error())
+	}
+	return request
+}
+
+// TestCreateCRL verifies that CRLs list the revoked certificates of an
+// index, and are signed by the CA.
+func TestCreateCRL(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Unix(1567339200, 0).UTC()
+	caProfile := pki.NewProfile("Test CA")
+	caProfile.IsCA = true
+	ca, err := pki.SelfSign(caKey, rand.Reader, caProfile, now)
+	if err != nil {
+		t.Fatalf("Unexpected error creating CA: %s", err.Error())
+	}
+	entries := []pki.IndexEntry{
+		{Status: pki.StatusValid, NotAfter: now.Add(pki.DefaultValidity), SerialNumber: big.NewInt(1), Subject: "CN=signer"},
+		{Status: pki.StatusRevoked, NotAfter: now.Add(pki.DefaultValidity), RevokedAt: now.Add(time.Hour), SerialNumber: big.NewInt(2), Subject: "CN=other"},
+	}
+	der, err := pki.CreateCRL(ca, caKey, rand.Reader, entries, big.NewInt(3), now.Add(2*time.Hour), pki.DefaultCRLValidity)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	crl, err := x509.ParseDERCRL(der)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing CRL: %s", err.Error())
+	}
+	if err := ca.CheckCRLSignature(crl); err != nil {
+		t.Errorf("CRL is not signed by the CA: %s", err.Error())
+	}
+	tbs := crl.TBSCertList
+	if number := pki.CRLNumber(crl); (number == nil) || (number.Int64() != 3) || !tbs.ThisUpdate.Equal(now.Add(2*time.Hour)) || !tbs.NextUpdate.Equal(now.Add(2*time.Hour+pki.DefaultCRLValidity)) {
+		t.Errorf("CRL has number %s and is valid from %s until %s.", number, tbs.ThisUpdate, tbs.NextUpdate)
+	}
+	if (len(tbs.RevokedCertificates) != 1) || (tbs.RevokedCertificates[0].SerialNumber.Int64() != 2) || !tbs.RevokedCertificates[0].RevocationTime.Equal(now.Add(time.Hour)) {
+		t.Errorf("CRL should list serial number 2 as revoked. Got %v instead.", tbs.RevokedCertificates)
+	}
+	if _, err := pki.CreateCRL(ca, caKey, rand.Reader, entries, big.NewInt(3), now, 0); (err == nil) || (err.Error() != "CRL validity must be positive") {
+		t.Errorf("CRL with no validity should fail. Got %v instead.", err)
+	}
+}
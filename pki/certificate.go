@@ -0,0 +1,351 @@
+// Package pki builds X.509 certificates of the keys this tool manages, as
+// defined by RFC 5280.
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/cms"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PEMType is the type of PEM blocks containing certificates.
+const PEMType = "CERTIFICATE"
+
+// Object identifiers of the extended key usage extension, and of the
+// timeStamping usage
+var (
+	oidExtensionExtKeyUsage    = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtKeyUsageTimeStamping = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+)
+
+// DefaultValidity is how long a certificate is valid for, if not given.
+const DefaultValidity = 365 * 24 * time.Hour
+
+// DefaultCAValidity is how long the certificate of a local CA is valid for,
+// if not given, outliving the certificates it issues.
+const DefaultCAValidity = 10 * DefaultValidity
+
+// Profile describes the contents of a certificate: its subject and subject
+// alternative names, how long it is valid for, what its key may be used for
+// and whether it is a CA. A zero KeyUsage selects digitalSignature, along
+// with keyCertSign and cRLSign for a CA, and a negative MaxPathLen leaves the
+// path length of a CA unlimited. The DNS domains constrain the names of the
+// certificates a CA may issue, and are ignored for other certificates.
+type Profile struct {
+	Subject        pkix.Name
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	Validity       time.Duration
+	KeyUsage       x509.KeyUsage
+	ExtKeyUsage    []x509.ExtKeyUsage
+	IsCA           bool
+	MaxPathLen     int
+
+	PermittedDNSDomains []string
+	ExcludedDNSDomains  []string
+}
+
+// NewProfile returns the profile of a certificate with a common name of
+// commonName, and otherwise the defaults.
+func NewProfile(commonName string) *Profile {
+	return &Profile{
+		Subject:    pkix.Name{CommonName: commonName},
+		Validity:   DefaultValidity,
+		MaxPathLen: -1,
+	}
+}
+
+// subjectAttributes are the supported attributes of a subject name, indexed
+// by their upper case names in RFC 4514, and how to add a value to each.
+var subjectAttributes = map[string]func(name *pkix.Name, value string){
+	"CN":           func(name *pkix.Name, value string) { name.CommonName = value },
+	"SERIALNUMBER": func(name *pkix.Name, value string) { name.SerialNumber = value },
+	"C":            func(name *pkix.Name, value string) { name.Country = append(name.Country, value) },
+	"O":            func(name *pkix.Name, value string) { name.Organization = append(name.Organization, value) },
+	"OU":           func(name *pkix.Name, value string) { name.OrganizationalUnit = append(name.OrganizationalUnit, value) },
+	"L":            func(name *pkix.Name, value string) { name.Locality = append(name.Locality, value) },
+	"ST":           func(name *pkix.Name, value string) { name.Province = append(name.Province, value) },
+	"STREET":       func(name *pkix.Name, value string) { name.StreetAddress = append(name.StreetAddress, value) },
+	"POSTALCODE":   func(name *pkix.Name, value string) { name.PostalCode = append(name.PostalCode, value) },
+}
+
+// splitEscaped splits value at each unescaped occurrence of separator, and
+// removes the backslashes that escape the separator or a backslash.
+func splitEscaped(value string, separator byte) []string {
+	result := []string{}
+	var part strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case (value[i] == '\\') && (i+1 < len(value)):
+			i++
+			part.WriteByte(value[i])
+		case value[i] == separator:
+			result = append(result, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(value[i])
+		}
+	}
+	return append(result, part.String())
+}
+
+// ParseSubject parses a distinguished name in the string form of RFC 4514,
+// such as "CN=signer,O=Example Corp,C=US". Commas within a value must be
+// escaped with a backslash.
+func ParseSubject(value string) (pkix.Name, error) {
+	result := pkix.Name{}
+	for _, attribute := range splitEscaped(value, ',') {
+		equals := strings.Index(attribute, "=")
+		if equals < 0 {
+			return pkix.Name{}, fmt.Errorf("Subject attribute %#v is not of the form type=value", strings.TrimSpace(attribute))
+		}
+		attrType := strings.ToUpper(strings.TrimSpace(attribute[:equals]))
+		add, ok := subjectAttributes[attrType]
+		if !ok {
+			names := make([]string, 0, len(subjectAttributes))
+			for name := range subjectAttributes {
+				names = append(names, name)
+			}
+			return pkix.Name{}, fmt.Errorf("Unsupported subject attribute %#v: expected one of %s", strings.TrimSpace(attribute[:equals]), sortedNames(names))
+		}
+		add(&result, strings.TrimSpace(attribute[equals+1:]))
+	}
+	return result, nil
+}
+
+// AddSubjectAltName adds a subject alternative name to the profile. The type
+// of name may be given by a prefix of DNS:, IP:, email: or URI:, as in
+// OpenSSL configuration files. Otherwise, it is an IP address if it parses as
+// one, an email address if it contains @, a URI if it contains :// and a DNS
+// name if not.
+func (p *Profile) AddSubjectAltName(name string) error {
+	name = strings.TrimSpace(name)
+	nameType, value := "", name
+	if colon := strings.Index(name, ":"); colon >= 0 {
+		prefix := strings.ToUpper(name[:colon])
+		if (prefix == "DNS") || (prefix == "IP") || (prefix == "EMAIL") || (prefix == "URI") {
+			nameType, value = prefix, name[colon+1:]
+		}
+	}
+	if nameType == "" {
+		switch {
+		case net.ParseIP(value) != nil:
+			nameType = "IP"
+		case strings.Contains(value, "@"):
+			nameType = "EMAIL"
+		case strings.Contains(value, "://"):
+			nameType = "URI"
+		default:
+			nameType = "DNS"
+		}
+	}
+	if value == "" {
+		return fmt.Errorf("Subject alternative name %#v is empty", name)
+	}
+	switch nameType {
+	case "DNS":
+		if strings.ContainsAny(value, " \t@/") {
+			return fmt.Errorf("Subject alternative name %#v is not a DNS name", name)
+		}
+		p.DNSNames = append(p.DNSNames, value)
+	case "IP":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return fmt.Errorf("Subject alternative name %#v is not an IP address", name)
+		}
+		p.IPAddresses = append(p.IPAddresses, ip)
+	case "EMAIL":
+		if !strings.Contains(value, "@") {
+			return fmt.Errorf("Subject alternative name %#v is not an email address", name)
+		}
+		p.EmailAddresses = append(p.EmailAddresses, value)
+	case "URI":
+		uri, err := url.Parse(value)
+		if (err != nil) || (uri.Scheme == "") {
+			return fmt.Errorf("Subject alternative name %#v is not an absolute URI", name)
+		}
+		p.URIs = append(p.URIs, uri)
+	}
+	return nil
+}
+
+// keyUsageNames maps the names of key usages in RFC 5280 to their values.
+var keyUsageNames = map[string]x509.KeyUsage{
+	"digitalSignature":  x509.KeyUsageDigitalSignature,
+	"contentCommitment": x509.KeyUsageContentCommitment,
+	"nonRepudiation":    x509.KeyUsageContentCommitment,
+	"keyEncipherment":   x509.KeyUsageKeyEncipherment,
+	"dataEncipherment":  x509.KeyUsageDataEncipherment,
+	"keyAgreement":      x509.KeyUsageKeyAgreement,
+	"keyCertSign":       x509.KeyUsageCertSign,
+	"cRLSign":           x509.KeyUsageCRLSign,
+	"encipherOnly":      x509.KeyUsageEncipherOnly,
+	"decipherOnly":      x509.KeyUsageDecipherOnly,
+}
+
+// extKeyUsageNames maps the names of extended key usages in RFC 5280 to
+// their values.
+var extKeyUsageNames = map[string]x509.ExtKeyUsage{
+	"any":             x509.ExtKeyUsageAny,
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+	"OCSPSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// sortedNames returns names sorted and separated by commas.
+func sortedNames(names []string) string {
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// ParseKeyUsage returns the key usage named by name. Names are not case
+// sensitive.
+func ParseKeyUsage(name string) (x509.KeyUsage, error) {
+	names := make([]string, 0, len(keyUsageNames))
+	for usageName, usage := range keyUsageNames {
+		if strings.EqualFold(usageName, name) {
+			return usage, nil
+		}
+		names = append(names, usageName)
+	}
+	return 0, fmt.Errorf("Unrecognized key usage %#v: expected one of %s", name, sortedNames(names))
+}
+
+// ParseExtKeyUsage returns the extended key usage named by name. Names are
+// not case sensitive.
+func ParseExtKeyUsage(name string) (x509.ExtKeyUsage, error) {
+	names := make([]string, 0, len(extKeyUsageNames))
+	for usageName, usage := range extKeyUsageNames {
+		if strings.EqualFold(usageName, name) {
+			return usage, nil
+		}
+		names = append(names, usageName)
+	}
+	return 0, fmt.Errorf("Unrecognized extended key usage %#v: expected one of %s", name, sortedNames(names))
+}
+
+// NewSerialNumber returns a random, positive 128 bit serial number.
+func NewSerialNumber(randReader io.Reader) (*big.Int, error) {
+	buff := make([]byte, 16)
+	if _, err := io.ReadFull(randReader, buff); err != nil {
+		return nil, err
+	}
+	// Clear the top bit, so that the DER encoding is 16 bytes long:
+	buff[0] &= 0x7f
+	return new(big.Int).SetBytes(buff), nil
+}
+
+// Template returns the template of a certificate of publicKey with the
+// profile, valid from notBefore, for x509.CreateCertificate.
+func (p *Profile) Template(serialNumber *big.Int, publicKey crypto.PublicKey, notBefore time.Time) (*x509.Certificate, error) {
+	if p.Validity <= 0 {
+		return nil, errors.New("Certificate validity must be positive")
+	}
+	keyID, err := cms.SubjectKeyID(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	keyUsage := p.KeyUsage
+	if keyUsage == 0 {
+		keyUsage = x509.KeyUsageDigitalSignature
+		if p.IsCA {
+			keyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		}
+	}
+	result := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               p.Subject,
+		DNSNames:              p.DNSNames,
+		EmailAddresses:        p.EmailAddresses,
+		IPAddresses:           p.IPAddresses,
+		URIs:                  p.URIs,
+		NotBefore:             notBefore.UTC().Truncate(time.Second),
+		NotAfter:              notBefore.UTC().Truncate(time.Second).Add(p.Validity),
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           p.ExtKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  p.IsCA,
+		SubjectKeyId:          keyID,
+	}
+	if p.IsCA && (p.MaxPathLen >= 0) {
+		result.MaxPathLen = p.MaxPathLen
+		result.MaxPathLenZero = p.MaxPathLen == 0
+	} else {
+		result.MaxPathLen = -1
+	}
+	// RFC 3161 requires the extended key usage of a TSA certificate to be
+	// critical, which x509.CreateCertificate never marks it:
+	if (len(p.ExtKeyUsage) == 1) && (p.ExtKeyUsage[0] == x509.ExtKeyUsageTimeStamping) {
+		value, err := asn1.Marshal([]asn1.ObjectIdentifier{oidExtKeyUsageTimeStamping})
+		if err != nil {
+			return nil, err
+		}
+		result.ExtraExtensions = append(result.ExtraExtensions, pkix.Extension{Id: oidExtensionExtKeyUsage, Critical: true, Value: value})
+	}
+	if p.IsCA && (len(p.PermittedDNSDomains)+len(p.ExcludedDNSDomains) > 0) {
+		result.PermittedDNSDomainsCritical = true
+		result.PermittedDNSDomains = p.PermittedDNSDomains
+		result.ExcludedDNSDomains = p.ExcludedDNSDomains
+	}
+	return result, nil
+}
+
+// SelfSign returns a certificate of the key of signer with the profile,
+// signed by that key, and valid from now.
+func SelfSign(signer crypto.Signer, randReader io.Reader, profile *Profile, now time.Time) (*x509.Certificate, error) {
+	serialNumber, err := NewSerialNumber(randReader)
+	if err != nil {
+		return nil, err
+	}
+	template, err := profile.Template(serialNumber, signer.Public(), now)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.CreateCertificate(randReader, template, template, signer.Public(), signer)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Certifies returns true if cert is a certificate of publicKey.
+func Certifies(cert *x509.Certificate, publicKey crypto.PublicKey) bool {
+	comparable, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && comparable.Equal(publicKey)
+}
+
+// EncodePEM returns the PEM encoding of cert.
+func EncodePEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: PEMType, Bytes: cert.Raw})
+}
+
+// ParsePEM parses the first PEM encoded certificate in buff.
+func ParsePEM(buff []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, buff = pem.Decode(buff)
+		if block == nil {
+			return nil, errors.New("No PEM encoded certificate was found")
+		}
+		if block.Type == PEMType {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
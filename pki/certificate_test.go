@@ -0,0 +1,185 @@
+package pki_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"github.com/smartedge/codechallenge/pki"
+	"testing"
+	"time"
+)
+
+// TestParseSubject verifies that distinguished names parse to their
+// attributes, and that malformed ones are rejected.
+func TestParseSubject(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		value string
+		name  string
+		err   string
+	}{
+		"Common name": {
+			value: "CN=signer",
+			name:  "CN=signer",
+		},
+		"Several attributes": {
+			value: "CN=signer, O=Example Corp, OU=Engineering, C=US",
+			name:  "CN=signer,OU=Engineering,O=Example Corp,C=US",
+		},
+		"Escaped comma": {
+			value: "CN=signer,O=Example\\, Inc.",
+			name:  "CN=signer,O=Example\\, Inc.",
+		},
+		"Lower case types": {
+			value: "cn=signer,st=Texas",
+			name:  "CN=signer,ST=Texas",
+		},
+		"Missing equals": {
+			value: "CN=signer,Example",
+			err:   "Subject attribute \"Example\" is not of the form type=value",
+		},
+		"Unsupported type": {
+			value: "UID=signer",
+			err:   "Unsupported subject attribute \"UID\": expected one of C, CN, L, O, OU, POSTALCODE, SERIALNUMBER, ST, STREET",
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			name, err := pki.ParseSubject(tc.value)
+			if tc.err != "" {
+				if (err == nil) || (err.Error() != tc.err) {
+					tt.Errorf("ParseSubject(%#v) should fail with %#v. Got %v instead.", tc.value, tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if name.String() != tc.name {
+				tt.Errorf("ParseSubject(%#v) should be %s. Got %s instead.", tc.value, tc.name, name.String())
+			}
+		})
+	}
+}
+
+// TestAddSubjectAltName verifies that each type of subject alternative name
+// is recognized by its prefix or its form.
+func TestAddSubjectAltName(t *testing.T) {
+	profile := pki.NewProfile("signer")
+	for _, name := range []string{"signer.example.com", "DNS:10.example.com", "192.0.2.1", "IP:2001:db8::1", "signer@example.com", "email:signer@example.com", "https://example.com/signer", "URI:spiffe://example.com/signer"} {
+		if err := profile.AddSubjectAltName(name); err != nil {
+			t.Fatalf("Unexpected error adding %#v: %s", name, err.Error())
+		}
+	}
+	if fmt.Sprint(profile.DNSNames) != "[signer.example.com 10.example.com]" {
+		t.Errorf("DNS names are %v.", profile.DNSNames)
+	}
+	if fmt.Sprint(profile.IPAddresses) != "[192.0.2.1 2001:db8::1]" {
+		t.Errorf("IP addresses are %v.", profile.IPAddresses)
+	}
+	if fmt.Sprint(profile.EmailAddresses) != "[signer@example.com signer@example.com]" {
+		t.Errorf("Email addresses are %v.", profile.EmailAddresses)
+	}
+	if fmt.Sprint(profile.URIs) != "[https://example.com/signer spiffe://example.com/signer]" {
+		t.Errorf("URIs are %v.", profile.URIs)
+	}
+	for name, err := range map[string]string{
+		"DNS:":               "Subject alternative name \"DNS:\" is empty",
+		"IP:signer":          "Subject alternative name \"IP:signer\" is not an IP address",
+		"email:example.com":  "Subject alternative name \"email:example.com\" is not an email address",
+		"URI:example.com":    "Subject alternative name \"URI:example.com\" is not an absolute URI",
+		"DNS:signer example": "Subject alternative name \"DNS:signer example\" is not a DNS name",
+	} {
+		if got := profile.AddSubjectAltName(name); (got == nil) || (got.Error() != err) {
+			t.Errorf("AddSubjectAltName(%#v) should fail with %#v. Got %v instead.", name, err, got)
+		}
+	}
+}
+
+// TestSelfSign verifies that self-signed certificates have the profile they
+// were made with, and are signed by their own key.
+func TestSelfSign(t *testing.T) {
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Unix(1567339200, 0)
+	for desc, tc := range map[string]struct {
+		signer     crypto.Signer
+		profile    func() *pki.Profile
+		keyUsage   x509.KeyUsage
+		isCA       bool
+		maxPathLen int
+	}{
+		"ECDSA leaf with defaults": {
+			signer:     ecdsaKey,
+			profile:    func() *pki.Profile { return pki.NewProfile("signer") },
+			keyUsage:   x509.KeyUsageDigitalSignature,
+			maxPathLen: -1,
+		},
+		"Ed25519 CA with path length": {
+			signer: ed25519Key,
+			profile: func() *pki.Profile {
+				profile := pki.NewProfile("root")
+				profile.IsCA = true
+				profile.MaxPathLen = 0
+				return profile
+			},
+			keyUsage:   x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			isCA:       true,
+			maxPathLen: 0,
+		},
+		"Explicit key usage": {
+			signer: ecdsaKey,
+			profile: func() *pki.Profile {
+				profile := pki.NewProfile("signer")
+				profile.KeyUsage = x509.KeyUsageContentCommitment
+				profile.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+				return profile
+			},
+			keyUsage:   x509.KeyUsageContentCommitment,
+			maxPathLen: -1,
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			profile := tc.profile()
+			cert, err := pki.SelfSign(tc.signer, rand.Reader, profile, now)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+				tt.Errorf("Certificate is not signed by its key: %s", err.Error())
+			}
+			if tc.isCA {
+				if err := cert.CheckSignatureFrom(cert); err != nil {
+					tt.Errorf("CA certificate can't be used to check its own signature: %s", err.Error())
+				}
+			}
+			if cert.Subject.CommonName != profile.Subject.CommonName {
+				tt.Errorf("Certificate subject is %s.", cert.Subject.String())
+			}
+			if !cert.NotBefore.Equal(now) || !cert.NotAfter.Equal(now.Add(pki.DefaultValidity)) {
+				tt.Errorf("Certificate is valid from %s to %s.", cert.NotBefore, cert.NotAfter)
+			}
+			if cert.KeyUsage != tc.keyUsage {
+				tt.Errorf("Certificate key usage should be %d. Got %d instead.", tc.keyUsage, cert.KeyUsage)
+			}
+			if (cert.IsCA != tc.isCA) || (cert.MaxPathLen != tc.maxPathLen) {
+				tt.Errorf("Certificate should have IsCA %t and MaxPathLen %d. Got %t and %d instead.", tc.isCA, tc.maxPathLen, cert.IsCA, cert.MaxPathLen)
+			}
+			if cert.SerialNumber.Sign() <= 0 {
+				tt.Errorf("Certificate serial number %s is not positive.", cert.SerialNumber)
+			}
+			if !pki.Certifies(cert, tc.signer.Public()) {
+				tt.Errorf("Certificate does not certify its key.")
+			}
+			parsed, err := pki.ParsePEM(pki.EncodePEM(cert))
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing PEM: %s", err.Error())
+			}
+			if !parsed.Equal(cert) {
+				tt.Errorf("PEM encoding of certificate didn't round trip.")
+			}
+		})
+	}
+}
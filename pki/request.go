@@ -0,0 +1,139 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io"
+)
+
+// RequestPEMType is the type of PEM blocks containing certificate signing
+// requests, as defined by RFC 7468.
+const RequestPEMType = "CERTIFICATE REQUEST"
+
+// Object identifiers of the certificate extensions requested from a CA
+var (
+	OIDKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	OIDBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	OIDExtKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// extKeyUsageOIDs maps the supported extended key usages to their object
+// identifiers in RFC 5280.
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageAny:             {2, 5, 29, 37, 0},
+	x509.ExtKeyUsageServerAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	x509.ExtKeyUsageClientAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	x509.ExtKeyUsageCodeSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	x509.ExtKeyUsageEmailProtection: {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	x509.ExtKeyUsageTimeStamping:    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	x509.ExtKeyUsageOCSPSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+}
+
+// basicConstraints is the value of the basic constraints extension. A
+// MaxPathLen of -1 is omitted, leaving the path length unlimited.
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+// marshalKeyUsage returns the DER encoding of the key usage extension value
+// for usage: a bit string with bit 0 as digitalSignature.
+func marshalKeyUsage(usage x509.KeyUsage) ([]byte, error) {
+	bits := asn1.BitString{Bytes: make([]byte, 2)}
+	for i := 0; i < 9; i++ {
+		if usage&(1<<uint(i)) != 0 {
+			bits.Bytes[i/8] |= 0x80 >> uint(i%8)
+			bits.BitLength = i + 1
+		}
+	}
+	bits.Bytes = bits.Bytes[:(bits.BitLength+7)/8]
+	return asn1.Marshal(bits)
+}
+
+// RequestedExtensions returns the extensions to request from a CA for a
+// certificate with the profile: its key usage, any extended key usages and,
+// for a CA, its basic constraints. Names and validity aren't extensions of
+// the request.
+func (p *Profile) RequestedExtensions() ([]pkix.Extension, error) {
+	keyUsage := p.KeyUsage
+	if keyUsage == 0 {
+		keyUsage = x509.KeyUsageDigitalSignature
+		if p.IsCA {
+			keyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		}
+	}
+	value, err := marshalKeyUsage(keyUsage)
+	if err != nil {
+		return nil, err
+	}
+	result := []pkix.Extension{{Id: OIDKeyUsage, Critical: true, Value: value}}
+	if len(p.ExtKeyUsage) > 0 {
+		oids := make([]asn1.ObjectIdentifier, 0, len(p.ExtKeyUsage))
+		for _, usage := range p.ExtKeyUsage {
+			oid, ok := extKeyUsageOIDs[usage]
+			if !ok {
+				return nil, errors.New("Unsupported extended key usage")
+			}
+			oids = append(oids, oid)
+		}
+		value, err := asn1.Marshal(oids)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pkix.Extension{Id: OIDExtKeyUsage, Value: value})
+	}
+	if p.IsCA {
+		constraints := basicConstraints{IsCA: true, MaxPathLen: -1}
+		if p.MaxPathLen >= 0 {
+			constraints.MaxPathLen = p.MaxPathLen
+		}
+		value, err := asn1.Marshal(constraints)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pkix.Extension{Id: OIDBasicConstraints, Critical: true, Value: value})
+	}
+	return result, nil
+}
+
+// CreateRequest returns the DER encoding of a PKCS #10 certificate signing
+// request (RFC 2986) for the key of signer, with the subject, subject
+// alternative names and requested extensions of the profile, signed by that
+// key.
+func CreateRequest(signer crypto.Signer, randReader io.Reader, profile *Profile) ([]byte, error) {
+	extensions, err := profile.RequestedExtensions()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.CertificateRequest{
+		Subject:         profile.Subject,
+		DNSNames:        profile.DNSNames,
+		EmailAddresses:  profile.EmailAddresses,
+		IPAddresses:     profile.IPAddresses,
+		URIs:            profile.URIs,
+		ExtraExtensions: extensions,
+	}
+	return x509.CreateCertificateRequest(randReader, template, signer)
+}
+
+// EncodeRequestPEM returns the PEM encoding of the DER encoded certificate
+// signing request der.
+func EncodeRequestPEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: RequestPEMType, Bytes: der})
+}
+
+// ParseCertificate parses a certificate in PEM or DER.
+func ParseCertificate(buff []byte) (*x509.Certificate, error) {
+	if cert, err := ParsePEM(buff); err == nil {
+		return cert, nil
+	}
+	cert, err := x509.ParseCertificate(buff)
+	if err != nil {
+		return nil, errors.New("Input is not a PEM or DER encoded certificate")
+	}
+	return cert, nil
+}
@@ -0,0 +1,142 @@
+package pki_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"github.com/smartedge/codechallenge/pki"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// TestCreateRequest verifies that certificate signing requests carry the
+// names and requested extensions of the profile, and that a CA copying the
+// requested extensions issues a certificate with that profile.
+func TestCreateRequest(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Unix(1567339200, 0)
+	caProfile := pki.NewProfile("Test CA")
+	caProfile.IsCA = true
+	ca, err := pki.SelfSign(caKey, rand.Reader, caProfile, now)
+	if err != nil {
+		t.Fatalf("Unexpected error creating CA: %s", err.Error())
+	}
+	for desc, tc := range map[string]struct {
+		profile     func() *pki.Profile
+		extensions  int
+		keyUsage    x509.KeyUsage
+		extKeyUsage []x509.ExtKeyUsage
+		isCA        bool
+		maxPathLen  int
+	}{
+		"Defaults": {
+			profile:    func() *pki.Profile { return pki.NewProfile("signer") },
+			extensions: 1,
+			keyUsage:   x509.KeyUsageDigitalSignature,
+			maxPathLen: 0,
+		},
+		"Code signing with names": {
+			profile: func() *pki.Profile {
+				profile := pki.NewProfile("signer")
+				profile.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment
+				profile.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageTimeStamping}
+				_ = profile.AddSubjectAltName("signer.example.com")
+				_ = profile.AddSubjectAltName("signer@example.com")
+				return profile
+			},
+			extensions:  2,
+			keyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageTimeStamping},
+			maxPathLen:  0,
+		},
+		"Intermediate CA": {
+			profile: func() *pki.Profile {
+				profile := pki.NewProfile("Intermediate CA")
+				profile.IsCA = true
+				profile.MaxPathLen = 0
+				return profile
+			},
+			extensions: 2,
+			keyUsage:   x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			isCA:       true,
+			maxPathLen: 0,
+		},
+		"Decipher only": {
+			profile: func() *pki.Profile {
+				profile := pki.NewProfile("signer")
+				profile.KeyUsage = x509.KeyUsageKeyAgreement | x509.KeyUsageDecipherOnly
+				return profile
+			},
+			extensions: 1,
+			keyUsage:   x509.KeyUsageKeyAgreement | x509.KeyUsageDecipherOnly,
+			maxPathLen: 0,
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			profile := tc.profile()
+			der, err := pki.CreateRequest(key, rand.Reader, profile)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			request, err := x509.ParseCertificateRequest(der)
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing CSR: %s", err.Error())
+			}
+			if err := request.CheckSignature(); err != nil {
+				tt.Errorf("CSR is not signed by its key: %s", err.Error())
+			}
+			if request.Subject.String() != profile.Subject.String() {
+				tt.Errorf("CSR subject should be %s. Got %s instead.", profile.Subject.String(), request.Subject.String())
+			}
+			if fmt.Sprint(request.DNSNames, request.EmailAddresses) != fmt.Sprint(profile.DNSNames, profile.EmailAddresses) {
+				tt.Errorf("CSR has DNS names %v and email addresses %v.", request.DNSNames, request.EmailAddresses)
+			}
+			requested := 0
+			for _, extension := range request.Extensions {
+				if !extension.Id.Equal(pki.OIDKeyUsage) && !extension.Id.Equal(pki.OIDExtKeyUsage) && !extension.Id.Equal(pki.OIDBasicConstraints) {
+					continue
+				}
+				requested++
+			}
+			if requested != tc.extensions {
+				tt.Errorf("CSR should request %d extensions. Got %d instead.", tc.extensions, requested)
+			}
+			// Issue a certificate with the requested extensions:
+			template := &x509.Certificate{
+				SerialNumber:    big.NewInt(2),
+				Subject:         request.Subject,
+				NotBefore:       now,
+				NotAfter:        now.Add(time.Hour),
+				ExtraExtensions: request.Extensions,
+			}
+			certDER, err := x509.CreateCertificate(rand.Reader, template, ca, request.PublicKey, caKey)
+			if err != nil {
+				tt.Fatalf("Unexpected error issuing certificate: %s", err.Error())
+			}
+			cert, err := pki.ParseCertificate(certDER)
+			if err != nil {
+				tt.Fatalf("Unexpected error parsing certificate: %s", err.Error())
+			}
+			if cert.KeyUsage != tc.keyUsage {
+				tt.Errorf("Certificate key usage should be %d. Got %d instead.", tc.keyUsage, cert.KeyUsage)
+			}
+			if fmt.Sprint(cert.ExtKeyUsage) != fmt.Sprint(tc.extKeyUsage) {
+				tt.Errorf("Certificate extended key usages should be %v. Got %v instead.", tc.extKeyUsage, cert.ExtKeyUsage)
+			}
+			if (cert.IsCA != tc.isCA) || (cert.MaxPathLen != tc.maxPathLen) {
+				tt.Errorf("Certificate should have IsCA %t and MaxPathLen %d. Got %t and %d instead.", tc.isCA, tc.maxPathLen, cert.IsCA, cert.MaxPathLen)
+			}
+			if !pki.Certifies(cert, key.Public()) {
+				tt.Errorf("Certificate does not certify the key of the CSR.")
+			}
+			pemCert, err := pki.ParseCertificate(pki.EncodePEM(cert))
+			if (err != nil) || !pemCert.Equal(cert) {
+				tt.Errorf("PEM certificate didn't parse back to the certificate: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package pki
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrustStore holds the root certificates that are trusted, and CRLs of them
+// and the intermediate CAs below them.
+type TrustStore struct {
+	Roots []*x509.Certificate
+	CRLs  []*pkix.CertificateList
+}
+
+// AddPEM adds the PEM certificates and CRLs in buff to the trust store,
+// ignoring any other PEM blocks or text.
+func (ts *TrustStore) AddPEM(buff []byte) error {
+	for {
+		var block *pem.Block
+		block, buff = pem.Decode(buff)
+		if block == nil {
+			return nil
+		}
+		switch block.Type {
+		case PEMType:
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return err
+			}
+			ts.Roots = append(ts.Roots, cert)
+		case CRLPEMType:
+			crl, err := x509.ParseDERCRL(block.Bytes)
+			if err != nil {
+				return err
+			}
+			ts.CRLs = append(ts.CRLs, crl)
+		}
+	}
+}
+
+// AddCRL adds the PEM or DER CRL in buff to the trust store.
+func (ts *TrustStore) AddCRL(buff []byte) error {
+	der := buff
+	if block, _ := pem.Decode(buff); block != nil {
+		if block.Type != CRLPEMType {
+			return fmt.Errorf("Input is a PEM %s, but a %s was expected", block.Type, CRLPEMType)
+		}
+		der = block.Bytes
+	}
+	crl, err := x509.ParseDERCRL(der)
+	if err != nil {
+		return errors.New("Input is not a PEM or DER encoded CRL")
+	}
+	ts.CRLs = append(ts.CRLs, crl)
+	return nil
+}
+
+// ParsePEMChain parses every PEM encoded certificate in buff, in order.
+func ParsePEMChain(buff []byte) ([]*x509.Certificate, error) {
+	result := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, buff = pem.Decode(buff)
+		if block == nil {
+			break
+		}
+		if block.Type != PEMType {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, cert)
+	}
+	if len(result) == 0 {
+		return nil, errors.New("No PEM encoded certificate was found")
+	}
+	return result, nil
+}
+
+// Validation is the outcome of validating the certificate of a signer: the
+// chain from it to a trusted root, and whether every certificate below the
+// root was checked against a CRL of its issuer.
+type Validation struct {
+	Chain             []*x509.Certificate
+	RevocationChecked bool
+}
+
+// keyUsageNamesOf returns the names of the key usages in usage, naming each
+// by the first of its names in alphabetical order.
+func keyUsageNamesOf(usage x509.KeyUsage) string {
+	allNames := make([]string, 0, len(keyUsageNames))
+	for name := range keyUsageNames {
+		allNames = append(allNames, name)
+	}
+	sort.Strings(allNames)
+	names := []string{}
+	for _, name := range allNames {
+		if usage&keyUsageNames[name] != 0 {
+			names = append(names, name)
+			usage &^= keyUsageNames[name]
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Validate returns the chain from leaf to a root of the trust store, with the
+// help of intermediates, as of the time at. The certificates must be valid at
+// that time, and leaf must allow keyUsage, or digitalSignature if that is
+// zero, and each of extKeyUsage, if any. Certificates revoked by then in the
+// CRLs of the trust store are rejected, although certificates without a CRL
+// of their issuer aren't, which the Validation records.
+func (ts *TrustStore) Validate(leaf *x509.Certificate, intermediates []*x509.Certificate, at time.Time, keyUsage x509.KeyUsage, extKeyUsage []x509.ExtKeyUsage) (*Validation, error) {
+	if keyUsage == 0 {
+		keyUsage = x509.KeyUsageDigitalSignature
+	}
+	// A certificate without the key usage extension may be used for anything:
+	if (leaf.KeyUsage != 0) && (leaf.KeyUsage&keyUsage != keyUsage) {
+		return nil, fmt.Errorf("Certificate of %s does not allow key usage %s", leaf.Subject.String(), keyUsageNamesOf(keyUsage&^leaf.KeyUsage))
+	}
+	options := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, root := range ts.Roots {
+		options.Roots.AddCert(root)
+	}
+	for _, cert := range intermediates {
+		options.Intermediates.AddCert(cert)
+	}
+	var chains [][]*x509.Certificate
+	var err error
+	if len(extKeyUsage) == 0 {
+		chains, err = leaf.Verify(options)
+	}
+	// The chain must allow every extended key usage, rather than any one:
+	for _, usage := range extKeyUsage {
+		options.KeyUsages = []x509.ExtKeyUsage{usage}
+		if chains, err = leaf.Verify(options); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Certificate of %s is not trusted: %s", leaf.Subject.String(), err.Error())
+	}
+	result := &Validation{Chain: chains[0], RevocationChecked: true}
+	for i := 0; i+1 < len(result.Chain); i++ {
+		crl, err := ts.latestCRL(result.Chain[i+1])
+		if err != nil {
+			return nil, err
+		}
+		if crl == nil {
+			result.RevocationChecked = false
+			continue
+		}
+		if crl.HasExpired(at) {
+			return nil, fmt.Errorf("CRL of %s expired at %s", result.Chain[i+1].Subject.String(), crl.TBSCertList.NextUpdate.Format(time.RFC3339))
+		}
+		cert := result.Chain[i]
+		for _, entry := range crl.TBSCertList.RevokedCertificates {
+			if (entry.SerialNumber.Cmp(cert.SerialNumber) == 0) && !entry.RevocationTime.After(at) {
+				return nil, fmt.Errorf("Certificate %s of %s was revoked at %s", FormatSerialNumber(cert.SerialNumber), cert.Subject.String(), entry.RevocationTime.Format(time.RFC3339))
+			}
+		}
+	}
+	return result, nil
+}
+
+// latestCRL returns the CRL of issuer in the trust store with the greatest
+// CRL number, or nil if there is none. CRLs claiming to be of issuer must be
+// signed by it, and it must be allowed to sign CRLs.
+func (ts *TrustStore) latestCRL(issuer *x509.Certificate) (*pkix.CertificateList, error) {
+	var subject pkix.RDNSequence
+	if _, err := asn1.Unmarshal(issuer.RawSubject, &subject); err != nil {
+		return nil, err
+	}
+	var result *pkix.CertificateList
+	var resultNumber *big.Int
+	for _, crl := range ts.CRLs {
+		if crl.TBSCertList.Issuer.String() != subject.String() {
+			continue
+		}
+		if (issuer.KeyUsage != 0) && (issuer.KeyUsage&x509.KeyUsageCRLSign == 0) {
+			return nil, fmt.Errorf("CRL of %s is signed by a certificate that may not sign CRLs", issuer.Subject.String())
+		}
+		if err := issuer.CheckCRLSignature(crl); err != nil {
+			return nil, fmt.Errorf("CRL of %s has an invalid signature: %s", issuer.Subject.String(), err.Error())
+		}
+		number := CRLNumber(crl)
+		if (result == nil) || ((number != nil) && (resultNumber != nil) && (number.Cmp(resultNumber) > 0)) {
+			result, resultNumber = crl, number
+		}
+	}
+	return result, nil
+}
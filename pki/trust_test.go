@@ -0,0 +1,140 @@
+package pki_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"github.com/smartedge/codechallenge/pki"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// TestValidate verifies that certificates are only trusted with a chain to a
+// root of the trust store, valid at the time given, with the key usages
+// required, and not revoked by then.
+func TestValidate(t *testing.T) {
+	now := time.Unix(1567339200, 0).UTC()
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	intermediateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rootProfile := pki.NewProfile("Root CA")
+	rootProfile.IsCA = true
+	rootProfile.Validity = pki.DefaultCAValidity
+	root, err := pki.SelfSign(rootKey, rand.Reader, rootProfile, now)
+	if err != nil {
+		t.Fatalf("Unexpected error creating root: %s", err.Error())
+	}
+	intermediateProfile := pki.NewProfile("ignored")
+	intermediateProfile.IsCA = true
+	intermediateProfile.Validity = 2 * pki.DefaultValidity
+	intermediate, err := pki.Issue(root, rootKey, rand.Reader, mustParseRequest(t, intermediateKey, "Intermediate CA"), intermediateProfile, big.NewInt(1), now)
+	if err != nil {
+		t.Fatalf("Unexpected error creating intermediate: %s", err.Error())
+	}
+	leafProfile := pki.NewProfile("ignored")
+	leafProfile.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	leaf, err := pki.Issue(intermediate, intermediateKey, rand.Reader, mustParseRequest(t, leafKey, "signer"), leafProfile, big.NewInt(7), now)
+	if err != nil {
+		t.Fatalf("Unexpected error creating leaf: %s", err.Error())
+	}
+	crl := func(issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey, revokedAt time.Time, serialNumber int64) []byte {
+		entries := []pki.IndexEntry{}
+		if serialNumber != 0 {
+			entries = append(entries, pki.IndexEntry{Status: pki.StatusRevoked, RevokedAt: revokedAt, SerialNumber: big.NewInt(serialNumber)})
+		}
+		der, err := pki.CreateCRL(issuer, issuerKey, rand.Reader, entries, big.NewInt(1), now, pki.DefaultCRLValidity)
+		if err != nil {
+			t.Fatalf("Unexpected error creating CRL: %s", err.Error())
+		}
+		return pki.EncodeCRLPEM(der)
+	}
+	for desc, tc := range map[string]struct {
+		crls        [][]byte
+		at          time.Time
+		keyUsage    x509.KeyUsage
+		extKeyUsage []x509.ExtKeyUsage
+		checked     bool
+		err         string
+	}{
+		"Without CRLs": {
+			at: now.Add(time.Hour),
+		},
+		"With CRLs": {
+			crls:        [][]byte{crl(root, rootKey, now, 0), crl(intermediate, intermediateKey, now, 0)},
+			at:          now.Add(time.Hour),
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+			checked:     true,
+		},
+		"Revoked before signing": {
+			crls: [][]byte{crl(intermediate, intermediateKey, now.Add(time.Minute), 7)},
+			at:   now.Add(time.Hour),
+			err:  "Certificate 07 of CN=signer was revoked at 2019-09-01T12:01:00Z",
+		},
+		"Revoked after signing": {
+			crls: [][]byte{crl(intermediate, intermediateKey, now.Add(2*time.Hour), 7)},
+			at:   now.Add(time.Hour),
+		},
+		"Intermediate revoked": {
+			crls: [][]byte{crl(root, rootKey, now, 1)},
+			at:   now.Add(time.Hour),
+			err:  "Certificate 01 of CN=Intermediate CA was revoked at 2019-09-01T12:00:00Z",
+		},
+		"CRL expired": {
+			crls: [][]byte{crl(intermediate, intermediateKey, now, 0)},
+			at:   now.Add(pki.DefaultCRLValidity + time.Hour),
+			err:  "CRL of CN=Intermediate CA expired at 2019-10-01T12:00:00Z",
+		},
+		"Missing extended key usage": {
+			at:          now.Add(time.Hour),
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageEmailProtection},
+			err:         "Certificate of CN=signer is not trusted: x509: certificate specifies an incompatible key usage",
+		},
+		"Missing key usage": {
+			at:       now.Add(time.Hour),
+			keyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+			err:      "Certificate of CN=signer does not allow key usage contentCommitment",
+		},
+		"Expired": {
+			at:  now.Add(pki.DefaultValidity + time.Hour),
+			err: "Certificate of CN=signer is not trusted: x509: certificate has expired or is not yet valid: current time 2020-08-31T13:00:00Z is after 2020-08-31T12:00:00Z",
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			store := &pki.TrustStore{}
+			if err := store.AddPEM(append(pki.EncodePEM(root), []byte("Some other text\n")...)); err != nil {
+				tt.Fatalf("Unexpected error adding root: %s", err.Error())
+			}
+			for _, buff := range tc.crls {
+				if err := store.AddCRL(buff); err != nil {
+					tt.Fatalf("Unexpected error adding CRL: %s", err.Error())
+				}
+			}
+			validation, err := store.Validate(leaf, []*x509.Certificate{intermediate}, tc.at, tc.keyUsage, tc.extKeyUsage)
+			if tc.err != "" {
+				if (err == nil) || (err.Error() != tc.err) {
+					tt.Errorf("Validate should fail with %#v. Got %v instead.", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if (len(validation.Chain) != 3) || !validation.Chain[1].Equal(intermediate) || !validation.Chain[2].Equal(root) {
+				tt.Errorf("Chain should be of the leaf, intermediate and root. Got %d certificates instead.", len(validation.Chain))
+			}
+			if validation.RevocationChecked != tc.checked {
+				tt.Errorf("Revocation should be checked: %t. Got %t instead.", tc.checked, validation.RevocationChecked)
+			}
+		})
+	}
+	if _, err := (&pki.TrustStore{}).Validate(leaf, []*x509.Certificate{intermediate}, now, 0, nil); (err == nil) || (err.Error() != "Certificate of CN=signer is not trusted: x509: certificate signed by unknown authority") {
+		t.Errorf("Validate without roots should fail. Got %v instead.", err)
+	}
+	chain, err := pki.ParsePEMChain(append(pki.EncodePEM(leaf), pki.EncodePEM(intermediate)...))
+	if (err != nil) || (len(chain) != 2) || !chain[0].Equal(leaf) || !chain[1].Equal(intermediate) {
+		t.Errorf("PEM chain didn't parse back to the leaf and intermediate: %v", err)
+	}
+}
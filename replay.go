@@ -0,0 +1,223 @@
+package codechallenge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/misc"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files of the state directory, relative to it. The lock file exists while a
+// run updates the state. Each file of the sequence directory holds the last
+// sequence number of the signing counter of a key, named by key ID, in
+// decimal, and the replay file holds the ReplayState of verifying.
+const (
+	StateLockFile    = "lock"
+	StateSequenceDir = "sequence"
+	StateReplayFile  = "replay.json"
+)
+
+// StateSettings describes the state kept between runs: the directory it is
+// kept in, whether version 2 envelopes being signed are numbered by the
+// signing counter of their key, and whether those being verified are checked
+// against the signatures already verified, to reject replays.
+type StateSettings struct {
+	Dir         string
+	Sequence    bool
+	ReplayCheck bool
+}
+
+// ReplayState is the state of replay checking: the highest sequence number
+// verified of each key, by key ID, and the nonce of each signature without a
+// sequence number verified, along with the time it may be forgotten at, which
+// is empty for signatures that never expire.
+type ReplayState struct {
+	Sequences map[string]uint64 `json:"sequences"`
+	Nonces    map[string]string `json:"nonces"`
+}
+
+// lockState locks the state directory dir against other runs, creating it if
+// necessary, and returns the func that unlocks it. Locking fails, rather than
+// waits, if another run holds the lock.
+func lockState(d *deps.Dependencies, dir string) (func() error, error) {
+	if !misc.FileExists(d, dir) {
+		if err := d.Os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	path := filepath.Join(dir, StateLockFile)
+	file, err := d.Os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("State in %s is locked by another run: remove %s if none is running", dir, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	return func() error {
+		return d.Os.RemoveAll(path)
+	}, nil
+}
+
+// writeStateFile replaces the file path of the state directory with buff, by
+// renaming a temporary file over it, so that it is never left half written.
+func writeStateFile(d *deps.Dependencies, path string, buff []byte) error {
+	if err := misc.WriteDirAndFile(d, path+".tmp", buff, 0600, 0700); err != nil {
+		return err
+	}
+	return d.Os.Rename(path+".tmp", path)
+}
+
+// NextSequenceNumber increments the signing counter of the key with key ID
+// keyID in the state directory dir, which starts at zero, and returns its new
+// value. The state is locked while doing so, so that no two runs get the same
+// number.
+func NextSequenceNumber(d *deps.Dependencies, dir string, keyID string) (result uint64, err error) {
+	unlock, err := lockState(d, dir)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+	path := filepath.Join(dir, StateSequenceDir, keyID)
+	var last uint64
+	if misc.FileExists(d, path) {
+		buff, err := d.Io.Ioutil.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		last, err = strconv.ParseUint(strings.TrimSpace(string(buff)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("File %s is not a sequence number", path)
+		}
+	}
+	if last == math.MaxUint64 {
+		return 0, fmt.Errorf("Signing counter in %s is exhausted", path)
+	}
+	if err := writeStateFile(d, path, []byte(strconv.FormatUint(last+1, 10)+"\n")); err != nil {
+		return 0, err
+	}
+	return last + 1, nil
+}
+
+// CheckReplay checks that the signature of the version 2 envelope of doc
+// hasn't already been verified with the state directory in config, given the
+// verdict on it, and records it as verified if it is valid. A signature with
+// a sequence number must have a higher one than any verified of its key,
+// while one without must have a nonce not yet verified. Nonces are forgotten
+// once their signatures expire, allowing for the leeway in config, after
+// which they can't be verified anyway. A malformed state is reported as an
+// error, while replays are reported in the returned verdict.
+func CheckReplay(d *deps.Dependencies, config *RunConfig, doc *SignedMessage, verdict *Verdict) (result *Verdict, err error) {
+	if !verdict.Valid {
+		return verdict, nil
+	}
+	if EnvelopeVersion(doc.Version) != EnvelopeV2 {
+		return nil, errors.New("Signed message of version 1 has no nonce or sequence number to check for replays")
+	}
+	unlock, err := lockState(d, config.State.Dir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+	path := filepath.Join(config.State.Dir, StateReplayFile)
+	state := ReplayState{}
+	if misc.FileExists(d, path) {
+		buff, err := d.Io.Ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(buff, &state); err != nil {
+			return nil, fmt.Errorf("File %s is not a valid replay state: %s", path, err.Error())
+		}
+	}
+	if state.Sequences == nil {
+		state.Sequences = map[string]uint64{}
+	}
+	if state.Nonces == nil {
+		state.Nonces = map[string]string{}
+	}
+	now := d.Time.Now()
+	for nonce, forgetAt := range state.Nonces {
+		if forgetAt == "" {
+			continue
+		}
+		forgetTime, err := time.Parse(time.RFC3339, forgetAt)
+		if err != nil {
+			return nil, fmt.Errorf("File %s is not a valid replay state: time %#v of nonce %s is not an RFC 3339 time", path, forgetAt, nonce)
+		}
+		if now.After(forgetTime) {
+			delete(state.Nonces, nonce)
+		}
+	}
+	if doc.Sequence != 0 {
+		if last := state.Sequences[doc.KeyID]; doc.Sequence <= last {
+			return NewVerdict(Replayed, fmt.Sprintf("Signature has sequence number %d, but sequence number %d of key %s was already verified", doc.Sequence, last, doc.KeyID)), nil
+		}
+		state.Sequences[doc.KeyID] = doc.Sequence
+	} else {
+		if _, ok := state.Nonces[doc.Nonce]; ok {
+			return NewVerdict(Replayed, fmt.Sprintf("Signature with nonce %s was already verified", doc.Nonce)), nil
+		}
+		forgetAt := ""
+		if doc.Expires != "" {
+			expires, err := time.Parse(time.RFC3339, doc.Expires)
+			if err != nil {
+				return nil, err
+			}
+			forgetAt = expires.Add(config.Validity.Leeway).UTC().Format(time.RFC3339)
+		}
+		state.Nonces[doc.Nonce] = forgetAt
+	}
+	buff, err := json.MarshalIndent(&state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeStateFile(d, path, append(buff, '\n')); err != nil {
+		return nil, err
+	}
+	return verdict, nil
+}
+
+// parseStateOptions validates the sequence number, replay check and state
+// directory options in cl into config.
+func parseStateOptions(config *RunConfig, cl *commandLine) error {
+	if *cl.sequence {
+		if (config.Output.Format != JSONOutput) || config.VerifyMode || (config.Command != "") {
+			return errors.New("Option -sequence is only valid when signing JSON output")
+		}
+		if config.Output.Envelope != EnvelopeV2 {
+			return errors.New("Option -sequence requires -envelope=v2, as only its signature covers the sequence number")
+		}
+		config.State.Sequence = true
+	}
+	if *cl.replayCheck {
+		if (config.Output.Format != JSONOutput) || !config.VerifyMode || (config.Command != "") {
+			return errors.New("Option -replay-check is only valid when verifying JSON input")
+		}
+		config.State.ReplayCheck = true
+	}
+	if *cl.stateDir != "" {
+		if !config.State.Sequence && !config.State.ReplayCheck {
+			return errors.New("Option -state-dir is only valid with -sequence or -replay-check")
+		}
+		config.State.Dir = *cl.stateDir
+	}
+	return nil
+}
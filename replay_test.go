@@ -0,0 +1,78 @@
+package codechallenge_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/testtools"
+	"testing"
+)
+
+// TestReplayProtection verifies that signing counters number the version 2
+// envelopes of each key in turn, and that replay checking rejects signatures
+// already verified, forgetting the nonces of those that have expired.
+func TestReplayProtection(t *testing.T) {
+	files := testtools.FakeFileSystem{}
+	stateDir := "/home/anybody/.smartEdge/state/"
+	sign := func(args ...string) (string, *codechallenge.SignedMessage) {
+		bundle := runMain(t, &files, "Hello, World!", append([]string{"-envelope", "v2"}, args...)...)
+		if exitStatus := bundle.GetExitStatus(); exitStatus != 0 {
+			t.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, bundle.ErrBuf.String())
+		}
+		doc := codechallenge.SignedMessage{}
+		if err := json.Unmarshal(bundle.OutBuf.Bytes(), &doc); err != nil {
+			t.Fatalf("Unexpected error parsing signed message %#v: %s", bundle.OutBuf.String(), err.Error())
+		}
+		return bundle.OutBuf.String(), &doc
+	}
+	verify := func(desc string, stdin string, status int, detail string) {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			bundle := runMain(tt, &files, stdin, "-verify", "-replay-check")
+			if exitStatus := bundle.GetExitStatus(); exitStatus != status {
+				tt.Errorf("Verifying should have an exit status of %d. Got %d instead:\n%s", status, exitStatus, bundle.ErrBuf.String())
+			}
+			verdict := codechallenge.Verdict{}
+			if err := json.Unmarshal(bundle.OutBuf.Bytes(), &verdict); err != nil {
+				tt.Fatalf("Unexpected error parsing verdict %#v: %s", bundle.OutBuf.String(), err.Error())
+			}
+			if verdict.Detail != detail {
+				tt.Errorf("Verdict should have the detail %#v. Got %#v instead.", detail, verdict.Detail)
+			}
+		})
+	}
+
+	first, firstDoc := sign("-sequence")
+	second, secondDoc := sign("-sequence")
+	if (firstDoc.Sequence != 1) || (secondDoc.Sequence != 2) {
+		t.Errorf("Signatures should be numbered 1 and 2. Got %d and %d instead.", firstDoc.Sequence, secondDoc.Sequence)
+	}
+	counter := files[stateDir+"sequence/"+secondDoc.KeyID]
+	if (counter == nil) || (*counter != "2\n") || (files[stateDir+"lock"] != nil) {
+		t.Errorf("Signing counter should be 2 and unlocked. Got %v instead.", files)
+	}
+	verify("Sequence number", second, 0, "")
+	verify("Replayed sequence number", second, 16, fmt.Sprintf("Signature has sequence number 2, but sequence number 2 of key %s was already verified", secondDoc.KeyID))
+	verify("Earlier sequence number", first, 16, fmt.Sprintf("Signature has sequence number 1, but sequence number 2 of key %s was already verified", secondDoc.KeyID))
+
+	files[stateDir+"replay.json"] = testtools.StringPtr(`{"sequences": {}, "nonces": {"old": "2019-09-01T11:00:00Z", "forever": ""}}`)
+	expiring, expiringDoc := sign("-expires", "1h")
+	verify("Nonce", expiring, 0, "")
+	verify("Replayed nonce", expiring, 16, fmt.Sprintf("Signature with nonce %s was already verified", expiringDoc.Nonce))
+	state := codechallenge.ReplayState{}
+	if err := json.Unmarshal([]byte(*files[stateDir+"replay.json"]), &state); err != nil {
+		t.Fatalf("Unexpected error parsing replay state: %s", err.Error())
+	}
+	if fmt.Sprint(state.Nonces) != fmt.Sprintf("map[%s:2019-09-01T13:00:00Z forever:]", expiringDoc.Nonce) {
+		t.Errorf("Replay state should forget expired nonces, and keep the others until they expire. Got %v instead.", state.Nonces)
+	}
+
+	v1 := runMain(t, &files, "Hello, World!").OutBuf.String()
+	checkFailure(t, runMain(t, &files, v1, "-verify", "-replay-check"), 3, "Signed message of version 1 has no nonce or sequence number to check for replays")
+	files[stateDir+"lock"] = testtools.StringPtr("")
+	checkFailure(t, runMain(t, &files, "Hello, World!", "-envelope", "v2", "-sequence"), 5, "State in /home/anybody/.smartEdge/state is locked by another run: remove /home/anybody/.smartEdge/state/lock if none is running")
+
+	_, otherDoc := sign("-sequence", "-state-dir", "/home/anybody/other")
+	if otherDoc.Sequence != 1 {
+		t.Errorf("Signing counters should be kept in -state-dir. Got sequence number %d instead.", otherDoc.Sequence)
+	}
+}
@@ -3,29 +3,81 @@ package codechallenge
 import (
 	"encoding/json"
 	"errors"
-	"github.com/smartedge/codechallenge/crypt"
 	"github.com/smartedge/codechallenge/deps"
 )
 
-// SignedMessage the final response to be rendered to JSON.
+// SignedMessage the final response to be rendered to JSON. Fields that
+// don't apply to a signed message are omitted.
 type SignedMessage struct {
 	Message   string `json:"message"`
-	Signature string `json:"signature"`
-	Pubkey    string `json:"pubkey"`
+	Signature string `json:"signature,omitempty"`
+	// Pubkey is the PEM public key, or a PEM certificate of it if one was
+	// given.
+	Pubkey string `json:"pubkey,omitempty"`
+	// Signatures replace Signature and Pubkey in a multi-signature document,
+	// each with its own public key.
+	Signatures []MessageSignature `json:"signatures,omitempty"`
+	// Encoding is the character set the message was transcoded from.
+	Encoding string `json:"encoding,omitempty"`
+	// Normalization is the Unicode normalization form the message was
+	// converted to before signing.
+	Normalization string `json:"normalization,omitempty"`
+	// Hash is the hash function the message was digested with, if not the
+	// default of SHA-256. Version 2 envelopes always record it.
+	Hash string `json:"hash,omitempty"`
+	// Digest marks a message that is itself a pre-computed digest, signed
+	// directly.
+	Digest bool `json:"digest,omitempty"`
+	// Manifest marks a message that is a directory manifest.
+	Manifest bool `json:"manifest,omitempty"`
+	// Version is 2 for a version 2 envelope, whose signature covers the
+	// message along with Format, Hash, Algorithm, KeyID, SignedAt, NotBefore,
+	// Expires, Nonce and Sequence, rather than the digest of the message
+	// alone.
+	Version int `json:"version,omitempty"`
+	// Format is the input format of the message.
+	Format string `json:"format,omitempty"`
+	// Algorithm is the signature algorithm.
+	Algorithm string `json:"algorithm,omitempty"`
+	// KeyID identifies the key that made the signature.
+	KeyID string `json:"key_id,omitempty"`
+	// SignedAt is the signing time.
+	SignedAt string `json:"signed_at,omitempty"`
+	// NotBefore and Expires limit the period the signature is valid for.
+	NotBefore string `json:"not_before,omitempty"`
+	Expires   string `json:"expires,omitempty"`
+	// Nonce is the random nonce of the envelope, in base64.
+	Nonce string `json:"nonce,omitempty"`
+	// Sequence is the number of the signature in the signing counter of its
+	// key.
+	Sequence uint64 `json:"sequence,omitempty"`
+	// Timestamp is the base64 DER of an RFC 3161 time-stamp token of the raw
+	// signature.
+	Timestamp string `json:"timestamp,omitempty"`
 }
 
-// GenerateResponse takes the message, signature and public key and writes them
-// in JSON format to d.Os.Stdout
-func GenerateResponse(d *deps.Dependencies, message string, sig crypt.BinarySignature, pubKey crypt.PEMEncoded) error {
-	response := SignedMessage{
-		Message:   message,
-		Signature: sig.Base64(),
-		Pubkey:    pubKey.String(),
-	}
-	buff, err := json.MarshalIndent(&response, "", "")
+// GenerateResponse takes the signed message response and writes it in JSON
+// format to d.Os.Stdout
+func GenerateResponse(d *deps.Dependencies, response *SignedMessage) error {
+	return WriteJSON(d, response)
+}
+
+// RenderJSON renders value in the JSON format used for all output.
+func RenderJSON(value interface{}) ([]byte, error) {
+	return json.MarshalIndent(value, "", "")
+}
+
+// WriteJSON renders value in JSON format to d.Os.Stdout
+func WriteJSON(d *deps.Dependencies, value interface{}) error {
+	buff, err := RenderJSON(value)
 	if err != nil {
 		return err
 	}
+	return WriteOutput(d, buff)
+}
+
+// WriteOutput writes buff to d.Os.Stdout
+func WriteOutput(d *deps.Dependencies, buff []byte) error {
 	n, err := d.Os.Stdout.Write(buff)
 	if err != nil {
 		return err
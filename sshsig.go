@@ -0,0 +1,157 @@
+package codechallenge
+
+import (
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/sshsig"
+	"io/ioutil"
+)
+
+// SSHSigSettings describes the namespace of an SSH signature, and the
+// allowed_signers file and principal it is verified for, if any.
+type SSHSigSettings struct {
+	Namespace          string
+	AllowedSignersPath string
+	Principal          string
+}
+
+// ExportSSHKeyMain is the entry-point for the export-ssh-key command. It
+// writes the public key to d.Os.Stdout as a line of an authorized_keys file,
+// which is also the end of a line of an allowed_signers file.
+func ExportSSHKeyMain(d *deps.Dependencies, config *RunConfig) {
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	line, err := sshsig.AuthorizedKey(cryptStuff.Signer.Public(), "")
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	err = WriteOutput(d, []byte(line+"\n"))
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// SignSSHSigMain signs message with the keys in cryptStuff, in the namespace
+// in config, and writes the armored SSH signature to d.Os.Stdout.
+func SignSSHSigMain(d *deps.Dependencies, config *RunConfig, cryptStuff *crypt.CryptoTooling, message string) {
+	buff, err := sshsig.Sign(cryptStuff.Signer, d.Crypto.Rand.Reader, config.SSH.Namespace, config.PubKeySettings.GetHash(), []byte(message))
+	if err != nil {
+		HandleError(d, err, 5)
+	}
+	// Verify with a round trip:
+	sig, err := sshsig.Parse(string(buff))
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	valid, err := sig.Verify(config.SSH.Namespace, []byte(message))
+	if err != nil {
+		HandleError(d, err, 6)
+	}
+	if !valid {
+		HandleError(d, errors.New("round trip verification of signature failed"), 7)
+	}
+	err = WriteOutput(d, buff)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+}
+
+// VerifySSHSigMain is the entry-point for -verify mode with SSH signature
+// input. It reads an armored SSH signature of the payload file in config
+// from d.Os.Stdin, and writes the verdict in JSON format to d.Os.Stdout,
+// exiting with the verdict's exit status if it isn't valid.
+func VerifySSHSigMain(d *deps.Dependencies, config *RunConfig) {
+	buff, err := ioutil.ReadAll(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	sig, err := sshsig.Parse(string(buff))
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	verdict, err := VerifySSHSig(d, config, sig)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = WriteJSON(d, verdict)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// VerifySSHSig checks sig of the payload file in config. The key that made
+// it must be allowed to sign for the principal and namespace in config by
+// the allowed_signers file in config, if there is one, and must otherwise be
+// the public key file in config.
+func VerifySSHSig(d *deps.Dependencies, config *RunConfig, sig *sshsig.Signature) (*Verdict, error) {
+	if config.Output.PayloadPath == "" {
+		return nil, errors.New("SSH signatures are detached, which requires -payload")
+	}
+	payload, err := d.Io.Ioutil.ReadFile(config.Output.PayloadPath)
+	if err != nil {
+		return nil, err
+	}
+	if config.SSH.AllowedSignersPath != "" {
+		buff, err := d.Io.Ioutil.ReadFile(config.SSH.AllowedSignersPath)
+		if err != nil {
+			return nil, err
+		}
+		signers, err := sshsig.ParseAllowedSigners(string(buff))
+		if err != nil {
+			return nil, err
+		}
+		if err := signers.Check(config.SSH.Principal, config.SSH.Namespace, sig.PublicKey, d.Time.Now()); err != nil {
+			return NewVerdict(BadSignature, err.Error()), nil
+		}
+	} else {
+		publicKey, err := loadPublicKey(d, config.PubKeySettings.PublicKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		if !sshsig.SamePublicKey(sig.PublicKey, publicKey) {
+			signedBy, _ := sshsig.Fingerprint(sig.PublicKey)
+			expected, err := sshsig.Fingerprint(publicKey)
+			if err != nil {
+				return nil, err
+			}
+			return NewVerdict(BadSignature, fmt.Sprintf("SSH signature was made by key %s, not %s", signedBy, expected)), nil
+		}
+	}
+	return newVerdictFromVerification(sig.Verify(config.SSH.Namespace, payload)), nil
+}
+
+// parseSSHOptions validates the SSH signature namespace and allowed signers
+// options in cl into config.
+func parseSSHOptions(config *RunConfig, cl *commandLine) error {
+	if *cl.namespace != "" {
+		if !config.Output.Format.IsSSHSig() {
+			return errors.New("Option -namespace is only valid with SSH signatures")
+		}
+		config.SSH.Namespace = *cl.namespace
+	}
+	if (*cl.allowedSignersPath != "") || (*cl.principal != "") {
+		if !config.Output.Format.IsSSHSig() || !config.VerifyMode {
+			return errors.New("Options -allowed-signers and -principal are only valid when verifying SSH signatures")
+		}
+		if (*cl.allowedSignersPath == "") || (*cl.principal == "") {
+			return errors.New("Options -allowed-signers and -principal must be used together")
+		}
+		config.SSH.AllowedSignersPath = *cl.allowedSignersPath
+		config.SSH.Principal = *cl.principal
+	}
+	if config.Output.Format.IsSSHSig() && (config.SSH.Namespace == "") {
+		return errors.New("SSH signatures require -namespace")
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package sshsig
+
+import (
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AllowedSigner is a line of an allowed_signers file, saying which
+// principals a key may sign for, and in which namespaces.
+type AllowedSigner struct {
+	Principals    string
+	PublicKey     crypto.PublicKey
+	CertAuthority bool
+	Namespaces    string
+	ValidAfter    time.Time
+	ValidBefore   time.Time
+}
+
+// AllowedSigners is a parsed allowed_signers file.
+type AllowedSigners []*AllowedSigner
+
+// nextField returns the first whitespace separated field of line, in which
+// whitespace may be quoted, and the rest of line.
+func nextField(line string) (string, string) {
+	line = strings.TrimLeft(line, " \t")
+	quoted := false
+	for i, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case ((c == ' ') || (c == '\t')) && !quoted:
+			return line[:i], strings.TrimLeft(line[i:], " \t")
+		}
+	}
+	return line, ""
+}
+
+// splitOptions splits the comma separated options of an allowed_signers
+// line, in which commas may be quoted.
+func splitOptions(options string) []string {
+	result := []string{}
+	quoted := false
+	start := 0
+	for i, c := range options {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case (c == ',') && !quoted:
+			result = append(result, options[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, options[start:])
+}
+
+// parseTimestamp parses the time of a valid-after or valid-before option:
+// YYYYMMDD, YYYYMMDDHHMM or YYYYMMDDHHMMSS, in UTC if followed by Z, and
+// otherwise in local time.
+func parseTimestamp(value string) (time.Time, error) {
+	location := time.Local
+	if strings.HasSuffix(value, "Z") || strings.HasSuffix(value, "z") {
+		location = time.UTC
+		value = value[:len(value)-1]
+	}
+	layout := map[int]string{8: "20060102", 12: "200601021504", 14: "20060102150405"}[len(value)]
+	if layout == "" {
+		return time.Time{}, fmt.Errorf("Timestamp %#v is not in the format YYYYMMDD[HHMM[SS]][Z]", value)
+	}
+	return time.ParseInLocation(layout, value, location)
+}
+
+// parseAllowedSigner parses a line of an allowed_signers file, which isn't
+// blank or a comment.
+func parseAllowedSigner(line string) (*AllowedSigner, error) {
+	principals, rest := nextField(line)
+	result := &AllowedSigner{Principals: strings.Trim(principals, "\"")}
+	field, rest := nextField(rest)
+	if field == "" {
+		return nil, errors.New("Public key is missing")
+	}
+	if !strings.HasPrefix(field, "ssh-") && !strings.HasPrefix(field, "ecdsa-") && !strings.HasPrefix(field, "sk-") {
+		for _, option := range splitOptions(field) {
+			name := strings.ToLower(option)
+			value := ""
+			if i := strings.Index(option, "="); i >= 0 {
+				name = strings.ToLower(option[:i])
+				value = strings.Trim(option[i+1:], "\"")
+			}
+			var err error
+			switch name {
+			case "cert-authority":
+				result.CertAuthority = true
+			case "namespaces":
+				result.Namespaces = value
+			case "valid-after":
+				result.ValidAfter, err = parseTimestamp(value)
+			case "valid-before":
+				result.ValidBefore, err = parseTimestamp(value)
+			default:
+				err = fmt.Errorf("Unrecognized option %#v", option)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		field, rest = nextField(rest)
+	}
+	encoded, _ := nextField(rest)
+	if encoded == "" {
+		return nil, errors.New("Public key is missing")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Public key is not valid base64: %s", err.Error())
+	}
+	result.PublicKey, err = ParsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+	if keyType, _ := KeyType(result.PublicKey); keyType != field {
+		return nil, fmt.Errorf("Public key is %s, not %s", keyType, field)
+	}
+	return result, nil
+}
+
+// ParseAllowedSigners parses an allowed_signers file, as described in the
+// ALLOWED SIGNERS section of ssh-keygen(1). Keys of unsupported types are an
+// error, rather than silently never matching.
+func ParseAllowedSigners(data string) (AllowedSigners, error) {
+	result := AllowedSigners{}
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if (line == "") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		signer, err := parseAllowedSigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("allowed_signers line %d: %s", i+1, err.Error())
+		}
+		result = append(result, signer)
+	}
+	return result, nil
+}
+
+// matchPattern returns true if value matches pattern, in which * matches any
+// sequence of characters, and ? any single character.
+func matchPattern(value string, pattern string) bool {
+	if pattern == "" {
+		return value == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(value); i++ {
+			if matchPattern(value[i:], pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return (value != "") && matchPattern(value[1:], pattern[1:])
+	}
+	return (value != "") && (value[0] == pattern[0]) && matchPattern(value[1:], pattern[1:])
+}
+
+// matchPatternList returns true if value matches any of the comma separated
+// patterns, and none of those negated with a leading !.
+func matchPatternList(value string, patterns string) bool {
+	matched := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		if strings.HasPrefix(pattern, "!") {
+			if matchPattern(value, pattern[1:]) {
+				return false
+			}
+		} else if matchPattern(value, pattern) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// Allows returns true if the line allows publicKey to sign for principal in
+// namespace at now. Certificate authorities aren't supported, so never allow
+// anything.
+func (as *AllowedSigner) Allows(principal string, namespace string, publicKey crypto.PublicKey, now time.Time) bool {
+	if as.CertAuthority || !SamePublicKey(as.PublicKey, publicKey) || !matchPatternList(principal, as.Principals) {
+		return false
+	}
+	if (as.Namespaces != "") && !matchPatternList(namespace, as.Namespaces) {
+		return false
+	}
+	if !as.ValidAfter.IsZero() && now.Before(as.ValidAfter) {
+		return false
+	}
+	return as.ValidBefore.IsZero() || now.Before(as.ValidBefore)
+}
+
+// Check returns an error unless a line allows publicKey to sign for principal
+// in namespace at now.
+func (signers AllowedSigners) Check(principal string, namespace string, publicKey crypto.PublicKey, now time.Time) error {
+	for _, signer := range signers {
+		if signer.Allows(principal, namespace, publicKey, now) {
+			return nil
+		}
+	}
+	fingerprint, err := Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("SSH key %s is not allowed to sign for principal %#v in namespace %#v", fingerprint, principal, namespace)
+}
@@ -0,0 +1,158 @@
+package sshsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Key types
+const (
+	RSAKeyType     = "ssh-rsa"
+	Ed25519KeyType = "ssh-ed25519"
+)
+
+// ecdsaCurves maps the supported ECDSA curves to their SSH names, and the
+// hash their signatures use.
+var ecdsaCurves = map[elliptic.Curve]struct {
+	name string
+	hash crypto.Hash
+}{
+	elliptic.P256(): {name: "nistp256", hash: crypto.SHA256},
+	elliptic.P384(): {name: "nistp384", hash: crypto.SHA384},
+	elliptic.P521(): {name: "nistp521", hash: crypto.SHA512},
+}
+
+// KeyType returns the SSH key type of publicKey.
+func KeyType(publicKey crypto.PublicKey) (string, error) {
+	switch typedKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return RSAKeyType, nil
+	case *ecdsa.PublicKey:
+		curve, ok := ecdsaCurves[typedKey.Curve]
+		if !ok {
+			return "", fmt.Errorf("Unsupported SSH ECDSA curve %s", typedKey.Curve.Params().Name)
+		}
+		return "ecdsa-sha2-" + curve.name, nil
+	case ed25519.PublicKey:
+		return Ed25519KeyType, nil
+	}
+	return "", fmt.Errorf("Public key did not conform to recognized algorithm: %T", publicKey)
+}
+
+// MarshalPublicKey returns the SSH wire encoding of publicKey.
+func MarshalPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	keyType, err := KeyType(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	result := marshalString([]byte(keyType))
+	switch typedKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		result = append(result, marshalMPInt(big.NewInt(int64(typedKey.E)))...)
+		result = append(result, marshalMPInt(typedKey.N)...)
+	case *ecdsa.PublicKey:
+		result = append(result, marshalString([]byte(ecdsaCurves[typedKey.Curve].name))...)
+		result = append(result, marshalString(elliptic.Marshal(typedKey.Curve, typedKey.X, typedKey.Y))...)
+	case ed25519.PublicKey:
+		result = append(result, marshalString(typedKey)...)
+	}
+	return result, nil
+}
+
+// ParsePublicKey parses the SSH wire encoding of a public key.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	r := &reader{data: data}
+	keyType := string(r.readString())
+	var result crypto.PublicKey
+	switch {
+	case keyType == RSAKeyType:
+		e := r.readMPInt()
+		n := r.readMPInt()
+		if (r.err == nil) && !e.IsInt64() {
+			return nil, errors.New("SSH RSA public exponent is too large")
+		}
+		result = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case strings.HasPrefix(keyType, "ecdsa-sha2-"):
+		curveName := string(r.readString())
+		point := r.readString()
+		if r.err != nil {
+			break
+		}
+		if curveName != strings.TrimPrefix(keyType, "ecdsa-sha2-") {
+			return nil, fmt.Errorf("SSH key type %s does not match its curve %s", keyType, curveName)
+		}
+		for curve, params := range ecdsaCurves {
+			if params.name == curveName {
+				x, y := elliptic.Unmarshal(curve, point)
+				if x == nil {
+					return nil, errors.New("SSH ECDSA public key is not a point on its curve")
+				}
+				result = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+			}
+		}
+		if result == nil {
+			return nil, fmt.Errorf("Unsupported SSH ECDSA curve %s", curveName)
+		}
+	case keyType == Ed25519KeyType:
+		point := r.readString()
+		if (r.err == nil) && (len(point) != ed25519.PublicKeySize) {
+			return nil, fmt.Errorf("SSH Ed25519 public key is %d bytes long, but %d bytes were expected", len(point), ed25519.PublicKeySize)
+		}
+		result = ed25519.PublicKey(point)
+	default:
+		if r.err == nil {
+			return nil, fmt.Errorf("Unsupported SSH key type %#v", keyType)
+		}
+	}
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SamePublicKey returns true if a and b are the same public key.
+func SamePublicKey(a crypto.PublicKey, b crypto.PublicKey) bool {
+	aData, aErr := MarshalPublicKey(a)
+	bData, bErr := MarshalPublicKey(b)
+	return (aErr == nil) && (bErr == nil) && bytes.Equal(aData, bData)
+}
+
+// AuthorizedKey returns publicKey in the single line format of
+// authorized_keys and allowed_signers files, followed by comment if it isn't
+// empty.
+func AuthorizedKey(publicKey crypto.PublicKey, comment string) (string, error) {
+	keyType, err := KeyType(publicKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := MarshalPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	result := keyType + " " + base64.StdEncoding.EncodeToString(data)
+	if comment != "" {
+		result += " " + comment
+	}
+	return result, nil
+}
+
+// Fingerprint returns the SHA256 fingerprint of publicKey, as shown by
+// ssh-keygen.
+func Fingerprint(publicKey crypto.PublicKey) (string, error) {
+	data, err := MarshalPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,210 @@
+package sshsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// ArmorType is the type of the armor around an SSH signature.
+const ArmorType = "SSH SIGNATURE"
+
+// magicPreamble starts every SSH signature, and what it signs.
+const magicPreamble = "SSHSIG"
+
+// signatureVersion is the version of the SSH signature format.
+const signatureVersion = 1
+
+// armorLineLength is the length of the base64 lines of an armored signature,
+// as written by ssh-keygen.
+const armorLineLength = 70
+
+// rsaSignatureFormat is the format of RSA signatures, which use SHA-512 as
+// ssh-keygen's do.
+const rsaSignatureFormat = "rsa-sha2-512"
+
+// rsaSignatureHashes maps the RSA signature formats accepted to their hashes.
+// ssh-rsa signatures use SHA-1, so aren't accepted.
+var rsaSignatureHashes = map[string]crypto.Hash{
+	"rsa-sha2-256": crypto.SHA256,
+	"rsa-sha2-512": crypto.SHA512,
+}
+
+// hashNames maps the hashes a message may be digested with to their names.
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA256: "sha256",
+	crypto.SHA512: "sha512",
+}
+
+// Signature is a parsed SSH signature.
+type Signature struct {
+	PublicKey crypto.PublicKey
+	Namespace string
+	Hash      crypto.Hash
+	format    string
+	blob      []byte
+}
+
+// signedData returns what is signed for message in namespace, digested with
+// hash.
+func signedData(namespace string, hash crypto.Hash, message []byte) []byte {
+	result := []byte(magicPreamble)
+	result = append(result, marshalString([]byte(namespace))...)
+	result = append(result, marshalString(nil)...)
+	result = append(result, marshalString([]byte(hashNames[hash]))...)
+	return append(result, marshalString(crypt.NewDigestHash(hash, string(message)))...)
+}
+
+// Sign returns an armored SSH signature of message by signer in namespace,
+// digesting the message with hash, which must be SHA-256 or SHA-512.
+func Sign(signer crypto.Signer, randReader io.Reader, namespace string, hash crypto.Hash, message []byte) ([]byte, error) {
+	if namespace == "" {
+		return nil, errors.New("SSH signatures require a namespace")
+	}
+	if _, ok := hashNames[hash]; !ok {
+		return nil, fmt.Errorf("Unsupported SSH signature hash algorithm %s: expected sha256 or sha512", crypt.HashName(hash))
+	}
+	publicKey, err := MarshalPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	format, _ := KeyType(signer.Public())
+	scheme := crypt.SignatureScheme{Hash: crypto.SHA512, RSAPadding: crypt.PKCS1v15Padding, ECDSAEncoding: crypt.RawEncoding}
+	if typedKey, ok := signer.Public().(*ecdsa.PublicKey); ok {
+		scheme.Hash = ecdsaCurves[typedKey.Curve].hash
+	} else if _, ok := signer.Public().(*rsa.PublicKey); ok {
+		format = rsaSignatureFormat
+	}
+	signature, err := crypt.SignWithScheme(signer, randReader, signedData(namespace, hash, message), scheme)
+	if err != nil {
+		return nil, err
+	}
+	blob := []byte(signature)
+	if _, ok := signer.Public().(*ecdsa.PublicKey); ok {
+		half := len(signature) / 2
+		blob = append(marshalMPInt(new(big.Int).SetBytes(signature[:half])), marshalMPInt(new(big.Int).SetBytes(signature[half:]))...)
+	}
+	result := []byte(magicPreamble)
+	result = append(result, 0, 0, 0, signatureVersion)
+	result = append(result, marshalString(publicKey)...)
+	result = append(result, marshalString([]byte(namespace))...)
+	result = append(result, marshalString(nil)...)
+	result = append(result, marshalString([]byte(hashNames[hash]))...)
+	result = append(result, marshalString(append(marshalString([]byte(format)), marshalString(blob)...))...)
+	return armor(result), nil
+}
+
+// armor returns an SSH signature in its armor.
+func armor(data []byte) []byte {
+	result := &bytes.Buffer{}
+	result.WriteString("-----BEGIN " + ArmorType + "-----\n")
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > armorLineLength {
+		result.WriteString(encoded[:armorLineLength] + "\n")
+		encoded = encoded[armorLineLength:]
+	}
+	result.WriteString(encoded + "\n")
+	result.WriteString("-----END " + ArmorType + "-----\n")
+	return result.Bytes()
+}
+
+// Parse parses an armored SSH signature.
+func Parse(armored string) (*Signature, error) {
+	begin := strings.Index(armored, "-----BEGIN "+ArmorType+"-----")
+	end := strings.Index(armored, "-----END "+ArmorType+"-----")
+	if (begin < 0) || (end < begin) {
+		return nil, errors.New("Input is not an armored SSH signature")
+	}
+	encoded := strings.Join(strings.Fields(armored[begin+len("-----BEGIN "+ArmorType+"-----"):end]), "")
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Armored SSH signature is not valid base64: %s", err.Error())
+	}
+	r := &reader{data: data}
+	if string(r.readBytes(len(magicPreamble))) != magicPreamble {
+		return nil, errors.New("SSH signature is missing its SSHSIG preamble")
+	}
+	if version := r.readUint32(); (r.err == nil) && (version != signatureVersion) {
+		return nil, fmt.Errorf("Unsupported SSH signature version %d", version)
+	}
+	publicKey := r.readString()
+	result := &Signature{Namespace: string(r.readString())}
+	r.readString() // reserved
+	hashName := string(r.readString())
+	signature := r.readString()
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	result.PublicKey, err = ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	for hash, name := range hashNames {
+		if name == hashName {
+			result.Hash = hash
+		}
+	}
+	if result.Hash == 0 {
+		return nil, fmt.Errorf("Unsupported SSH signature hash algorithm %#v", hashName)
+	}
+	r = &reader{data: signature}
+	result.format = string(r.readString())
+	result.blob = r.readString()
+	if err := r.finish(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Verify checks that sig is a signature of message by its public key, in
+// namespace. Whether that key may sign for anyone is for an allowed_signers
+// file to say. An error explains why a signature isn't valid.
+func (sig *Signature) Verify(namespace string, message []byte) (bool, error) {
+	if sig.Namespace != namespace {
+		return false, fmt.Errorf("SSH signature is in namespace %#v, not %#v", sig.Namespace, namespace)
+	}
+	scheme := crypt.SignatureScheme{Hash: crypto.SHA512, RSAPadding: crypt.PKCS1v15Padding, ECDSAEncoding: crypt.RawEncoding}
+	signature := sig.blob
+	keyType, _ := KeyType(sig.PublicKey)
+	switch typedKey := sig.PublicKey.(type) {
+	case *rsa.PublicKey:
+		hash, ok := rsaSignatureHashes[sig.format]
+		if !ok {
+			return false, fmt.Errorf("Unsupported SSH RSA signature format %#v", sig.format)
+		}
+		scheme.Hash = hash
+	case *ecdsa.PublicKey:
+		if sig.format != keyType {
+			return false, fmt.Errorf("SSH signature format %#v does not match the %s key", sig.format, keyType)
+		}
+		scheme.Hash = ecdsaCurves[typedKey.Curve].hash
+		r := &reader{data: sig.blob}
+		rBytes := r.readMPInt().Bytes()
+		sBytes := r.readMPInt().Bytes()
+		if err := r.finish(); err != nil {
+			return false, err
+		}
+		// Pad r and s to the size of the curve:
+		size := (typedKey.Curve.Params().BitSize + 7) / 8
+		if (len(rBytes) > size) || (len(sBytes) > size) {
+			return false, errors.New("SSH ECDSA signature is too long for its curve")
+		}
+		signature = make([]byte, 2*size)
+		copy(signature[size-len(rBytes):size], rBytes)
+		copy(signature[2*size-len(sBytes):], sBytes)
+	case ed25519.PublicKey:
+		if sig.format != keyType {
+			return false, fmt.Errorf("SSH signature format %#v does not match the %s key", sig.format, keyType)
+		}
+	}
+	return crypt.VerifyWithScheme(sig.PublicKey, signedData(namespace, sig.Hash, message), signature, scheme)
+}
@@ -0,0 +1,274 @@
+package sshsig_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"github.com/smartedge/codechallenge/sshsig"
+	"github.com/smartedge/codechallenge/testtools"
+	"strings"
+	"testing"
+	"time"
+)
+
+// SSHKeygenMessage is the message signed by the ssh-keygen fixtures.
+const SSHKeygenMessage = "Hello, SSH!\n"
+
+// SSHKeygenEd25519Signature is SSHKeygenMessage signed in the namespace
+// "file" by `ssh-keygen -Y sign` with the key of SSHKeygenEd25519Key.
+const SSHKeygenEd25519Signature = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAg+4b94afzFMO6POckS+C2EgWNzf
+S59RgpraSJC4uFVMIAAAAEZmlsZQAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAEA0mY2RalU9Zp3owYXeO65V4G2IP0nnRjD/5WECv/5QQuR7d5tNI/7kKCT0yJwluw
+wlDo6/x1AHNZg+L0CrAqUI
+-----END SSH SIGNATURE-----
+`
+
+// SSHKeygenEd25519Key is the public key that signed
+// SSHKeygenEd25519Signature.
+const SSHKeygenEd25519Key = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIPuG/eGn8xTDujznJEvgthIFjc30ufUYKa2kiQuLhVTC fixture"
+
+// SSHKeygenECDSASignature is SSHKeygenMessage signed in the namespace "file"
+// by `ssh-keygen -Y sign` with the key of SSHKeygenECDSAKey.
+const SSHKeygenECDSASignature = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAAGgAAAATZWNkc2Etc2hhMi1uaXN0cDI1NgAAAAhuaXN0cDI1NgAAAE
+EEQr1yqYWSo6fe7nxG6ZVpjBT1HhYz+NYfuQVtiTkIpmY3EmVID10/olHBbMXlQcsjHH57
+dBkc00djOv1idce/IgAAAARmaWxlAAAAAAAAAAZzaGE1MTIAAABjAAAAE2VjZHNhLXNoYT
+ItbmlzdHAyNTYAAABIAAAAIE7jFeq3Mohz50KpaEpQ+yBVbDRS+S2mDFidIxnwway+AAAA
+IGjN5al+/dKU50PAnelSI1gFK/3A6VbxzyIe7i4jrQJv
+-----END SSH SIGNATURE-----
+`
+
+// SSHKeygenECDSAKey is the public key that signed SSHKeygenECDSASignature.
+const SSHKeygenECDSAKey = "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBEK9cqmFkqOn3u58RumVaYwU9R4WM/jWH7kFbYk5CKZmNxJlSA9dP6JRwWzF5UHLIxx+e3QZHNNHYzr9YnXHvyI= fixture"
+
+// TestSignAndVerify verifies that signatures parse back to valid signatures
+// for each kind of key and hash, and that changes to the message or
+// namespace are detected.
+func TestSignAndVerify(t *testing.T) {
+	ecdsaP256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecdsaP384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	ecdsaP521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	message := []byte("Hello, World!")
+	for desc, tc := range map[string]struct {
+		signer crypto.Signer
+		hash   crypto.Hash
+	}{
+		"ECDSA P-256": {signer: ecdsaP256, hash: crypto.SHA256},
+		"ECDSA P-384": {signer: ecdsaP384, hash: crypto.SHA512},
+		"ECDSA P-521": {signer: ecdsaP521, hash: crypto.SHA512},
+		"Ed25519":     {signer: ed25519Key, hash: crypto.SHA512},
+		"RSA":         {signer: rsaKey, hash: crypto.SHA256},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			armored, err := sshsig.Sign(tc.signer, rand.Reader, "file", tc.hash, message)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if !strings.HasPrefix(string(armored), "-----BEGIN SSH SIGNATURE-----\n") {
+				tt.Errorf("Signature should be armored. Got:\n%s", string(armored))
+			}
+			sig, err := sshsig.Parse(string(armored))
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if (sig.Namespace != "file") || (sig.Hash != tc.hash) || !sshsig.SamePublicKey(sig.PublicKey, tc.signer.Public()) {
+				tt.Errorf("Parsed signature doesn't match what was signed: %#v", sig)
+			}
+			if valid, err := sig.Verify("file", message); !valid {
+				tt.Errorf("Signature should be valid: %v", err)
+			}
+			if valid, err := sig.Verify("file", []byte("Goodbye, World!")); valid {
+				tt.Errorf("Signature of another message should not be valid: %v", err)
+			}
+			valid, err := sig.Verify("git", message)
+			expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: "SSH signature is in namespace \"file\", not \"git\""}
+			if err := expectedErr.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+			if valid {
+				tt.Error("Signature should not be valid in another namespace")
+			}
+		})
+	}
+	for desc, tc := range map[string]struct {
+		namespace string
+		hash      crypto.Hash
+		err       *testtools.ErrorSpec
+	}{
+		"Missing namespace": {
+			hash: crypto.SHA256,
+			err:  &testtools.ErrorSpec{Type: "*errors.errorString", Message: "SSH signatures require a namespace"},
+		},
+		"SHA-384": {
+			namespace: "file",
+			hash:      crypto.SHA384,
+			err:       &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Unsupported SSH signature hash algorithm sha384: expected sha256 or sha512"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			_, err := sshsig.Sign(ecdsaP256, rand.Reader, tc.namespace, tc.hash, message)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
+
+// TestSSHKeygenSignatures verifies signatures made by ssh-keygen against the
+// allowed_signers lines of their keys.
+func TestSSHKeygenSignatures(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		signature string
+		key       string
+	}{
+		"Ed25519": {signature: SSHKeygenEd25519Signature, key: SSHKeygenEd25519Key},
+		"ECDSA":   {signature: SSHKeygenECDSASignature, key: SSHKeygenECDSAKey},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			sig, err := sshsig.Parse(tc.signature)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			signers, err := sshsig.ParseAllowedSigners("ops@example.com namespaces=\"file\" " + tc.key + "\n")
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if err := signers.Check("ops@example.com", "file", sig.PublicKey, time.Now()); err != nil {
+				tt.Errorf("Key should be allowed to sign: %s", err.Error())
+			}
+			if valid, err := sig.Verify("file", []byte(SSHKeygenMessage)); !valid {
+				tt.Errorf("Signature should be valid: %v", err)
+			}
+			line, err := sshsig.AuthorizedKey(sig.PublicKey, "fixture")
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if line != tc.key {
+				tt.Errorf("Key should be written as %#v. Got %#v instead.", tc.key, line)
+			}
+		})
+	}
+}
+
+// TestAllowedSigners tests which principals, namespaces and times
+// allowed_signers lines allow a key to sign for.
+func TestAllowedSigners(t *testing.T) {
+	signer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, _ := sshsig.AuthorizedKey(signer.Public(), "signer")
+	otherKey, _ := sshsig.AuthorizedKey(other.Public(), "other")
+	fingerprint, _ := sshsig.Fingerprint(signer.Public())
+	now := time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)
+	for desc, tc := range map[string]struct {
+		lines     string
+		principal string
+		namespace string
+		allowed   bool
+	}{
+		"Exact principal":           {lines: "ops@example.com " + key, principal: "ops@example.com", namespace: "file", allowed: true},
+		"Other principal":           {lines: "ops@example.com " + key, principal: "dev@example.com", namespace: "file"},
+		"Wildcard principal":        {lines: "*@example.com " + key, principal: "dev@example.com", namespace: "file", allowed: true},
+		"Negated principal":         {lines: "*@example.com,!dev@example.com " + key, principal: "dev@example.com", namespace: "file"},
+		"Principal list":            {lines: "ops@example.com,dev@example.com " + key, principal: "dev@example.com", namespace: "file", allowed: true},
+		"Allowed namespace":         {lines: "ops@example.com namespaces=\"git,file\" " + key, principal: "ops@example.com", namespace: "file", allowed: true},
+		"Other namespace":           {lines: "ops@example.com namespaces=\"git\" " + key, principal: "ops@example.com", namespace: "file"},
+		"Other key":                 {lines: "ops@example.com " + otherKey, principal: "ops@example.com", namespace: "file"},
+		"Second line":               {lines: "# comment\nops@example.com " + otherKey + "\n\nops@example.com " + key, principal: "ops@example.com", namespace: "file", allowed: true},
+		"Certificate authority":     {lines: "ops@example.com cert-authority " + key, principal: "ops@example.com", namespace: "file"},
+		"Valid after":               {lines: "ops@example.com valid-after=\"20190901Z\" " + key, principal: "ops@example.com", namespace: "file", allowed: true},
+		"Not yet valid":             {lines: "ops@example.com valid-after=\"201909011201Z\" " + key, principal: "ops@example.com", namespace: "file"},
+		"No longer valid":           {lines: "ops@example.com valid-before=\"20190901115959Z\" " + key, principal: "ops@example.com", namespace: "file"},
+		"Several options":           {lines: "ops@example.com namespaces=\"file\",valid-before=\"20200101Z\" " + key, principal: "ops@example.com", namespace: "file", allowed: true},
+		"Quoted principal":          {lines: "\"ops@example.com\" " + key, principal: "ops@example.com", namespace: "file", allowed: true},
+		"Single character wildcard": {lines: "ops?@example.com " + key, principal: "ops1@example.com", namespace: "file", allowed: true},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			signers, err := sshsig.ParseAllowedSigners(tc.lines)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			err = signers.Check(tc.principal, tc.namespace, signer.Public(), now)
+			expectedErr := &testtools.ErrorSpec{Type: "*errors.errorString", Message: fmt.Sprintf("SSH key %s is not allowed to sign for principal %#v in namespace %#v", fingerprint, tc.principal, tc.namespace)}
+			if tc.allowed {
+				expectedErr = nil
+			}
+			if err := expectedErr.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
+
+// TestParseAllowedSignersErrors tests allowed_signers files that can't be
+// parsed.
+func TestParseAllowedSignersErrors(t *testing.T) {
+	signer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, _ := sshsig.AuthorizedKey(signer.Public(), "")
+	for desc, tc := range map[string]struct {
+		lines string
+		err   *testtools.ErrorSpec
+	}{
+		"Unrecognized option": {
+			lines: "# comment\nops@example.com no-touch-required " + key,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "allowed_signers line 2: Unrecognized option \"no-touch-required\""},
+		},
+		"Invalid timestamp": {
+			lines: "ops@example.com valid-after=\"2019\" " + key,
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "allowed_signers line 1: Timestamp \"2019\" is not in the format YYYYMMDD[HHMM[SS]][Z]"},
+		},
+		"Missing key": {
+			lines: "ops@example.com",
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "allowed_signers line 1: Public key is missing"},
+		},
+		"Mismatched key type": {
+			lines: "ops@example.com ssh-ed25519 " + strings.Fields(key)[1],
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "allowed_signers line 1: Public key is ecdsa-sha2-nistp256, not ssh-ed25519"},
+		},
+		"Truncated key": {
+			lines: "ops@example.com " + key[:40],
+			err:   &testtools.ErrorSpec{Type: "*errors.errorString", Message: "allowed_signers line 1: SSH wire encoding is truncated"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			_, err := sshsig.ParseAllowedSigners(tc.lines)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
+
+// TestParseErrors tests signatures that can't be parsed.
+func TestParseErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		armored string
+		err     *testtools.ErrorSpec
+	}{
+		"Not armored": {
+			armored: "Hello, World!",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "Input is not an armored SSH signature"},
+		},
+		"Missing preamble": {
+			armored: "-----BEGIN SSH SIGNATURE-----\nSGVsbG8sIFdvcmxkIQ==\n-----END SSH SIGNATURE-----\n",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "SSH signature is missing its SSHSIG preamble"},
+		},
+		"Truncated": {
+			armored: "-----BEGIN SSH SIGNATURE-----\nU1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAg\n-----END SSH SIGNATURE-----\n",
+			err:     &testtools.ErrorSpec{Type: "*errors.errorString", Message: "SSH wire encoding is truncated"},
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			_, err := sshsig.Parse(tc.armored)
+			if err := tc.err.EnsureMatches(err); err != nil {
+				tt.Error(err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Package sshsig implements SSH signatures, as made by `ssh-keygen -Y sign`
+// and defined by OpenSSH's PROTOCOL.sshsig, with the tool's RSA, ECDSA and
+// Ed25519 keys, and the allowed_signers files `ssh-keygen -Y verify` checks
+// them against.
+package sshsig
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+// marshalString returns data as an SSH string: its length, followed by its
+// bytes.
+func marshalString(data []byte) []byte {
+	result := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(result, uint32(len(data)))
+	return append(result, data...)
+}
+
+// marshalMPInt returns value as an SSH mpint: a string of its two's
+// complement big-endian bytes, without unnecessary leading bytes.
+func marshalMPInt(value *big.Int) []byte {
+	data := value.Bytes()
+	if (len(data) > 0) && ((data[0] & 0x80) != 0) {
+		data = append([]byte{0}, data...)
+	}
+	return marshalString(data)
+}
+
+// reader reads the fields of an SSH wire encoding in turn. Once a field is
+// truncated, every later read fails too, so errors need only be checked at
+// the end.
+type reader struct {
+	data []byte
+	err  error
+}
+
+// errTruncated is the error of a reader that ran out of data.
+var errTruncated = errors.New("SSH wire encoding is truncated")
+
+// readBytes returns the next n bytes.
+func (r *reader) readBytes(n int) []byte {
+	if (r.err != nil) || (len(r.data) < n) {
+		r.err = errTruncated
+		return nil
+	}
+	result := r.data[:n]
+	r.data = r.data[n:]
+	return result
+}
+
+// readUint32 returns the next uint32.
+func (r *reader) readUint32() uint32 {
+	data := r.readBytes(4)
+	if data == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(data)
+}
+
+// readString returns the bytes of the next string.
+func (r *reader) readString() []byte {
+	length := r.readUint32()
+	if (r.err == nil) && (uint64(length) > uint64(len(r.data))) {
+		r.err = errTruncated
+		return nil
+	}
+	return r.readBytes(int(length))
+}
+
+// readMPInt returns the next mpint, which must not be negative.
+func (r *reader) readMPInt() *big.Int {
+	data := r.readString()
+	if (len(data) > 0) && ((data[0] & 0x80) != 0) && (r.err == nil) {
+		r.err = errors.New("SSH mpint is negative")
+	}
+	return new(big.Int).SetBytes(data)
+}
+
+// finish returns the first error reading, or an error if any data remains
+// unread.
+func (r *reader) finish() error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) > 0 {
+		return errors.New("SSH wire encoding is followed by unexpected bytes")
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package codechallenge_test
+
+import (
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/sshsig"
+	"github.com/smartedge/codechallenge/testtools"
+	"testing"
+)
+
+// TestSignAndVerifySSHSig verifies that SSH signatures written by RealMain
+// can be verified in -verify mode, against the public key file or an
+// allowed_signers file of the key written by the export-ssh-key command.
+func TestSignAndVerifySSHSig(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		keyArgs        []string
+		signArgs       []string
+		allowedSigners string
+		verifyArgs     []string
+		status         int
+		stdOutput      testtools.StringMatcher
+		stdErr         testtools.StringMatcher
+	}{
+		"Public key": {
+			signArgs:   []string{"codechallenge", "-format", "sshsig", "-namespace", "file"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "sshsig", "-namespace", "file", "-payload", "hello.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"RSA with SHA-512": {
+			keyArgs:    []string{"-rsa"},
+			signArgs:   []string{"codechallenge", "-rsa", "-format", "sshsig", "-namespace", "file", "-hash", "sha512"},
+			verifyArgs: []string{"codechallenge", "-rsa", "-verify", "-format", "sshsig", "-namespace", "file", "-payload", "hello.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Ed25519": {
+			keyArgs:    []string{"-ed25519"},
+			signArgs:   []string{"codechallenge", "-ed25519", "-format", "sshsig", "-namespace", "file"},
+			verifyArgs: []string{"codechallenge", "-ed25519", "-verify", "-format", "sshsig", "-namespace", "file", "-payload", "hello.txt"},
+			status:     0,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Allowed signer": {
+			signArgs:       []string{"codechallenge", "-format", "sshsig", "-namespace", "git"},
+			allowedSigners: "ops@example.com namespaces=\"git\" ",
+			verifyArgs:     []string{"codechallenge", "-verify", "-format", "sshsig", "-namespace", "git", "-payload", "hello.txt", "-allowed-signers", "allowed_signers", "-principal", "ops@example.com"},
+			status:         0,
+			stdOutput:      testtools.NewStringStringMatcher("{\n\"valid\": true,\n\"reason\": \"valid\"\n}"),
+			stdErr:         testtools.NewStringStringMatcher(""),
+		},
+		"Signer not allowed in namespace": {
+			signArgs:       []string{"codechallenge", "-format", "sshsig", "-namespace", "file"},
+			allowedSigners: "ops@example.com namespaces=\"git\" ",
+			verifyArgs:     []string{"codechallenge", "-verify", "-format", "sshsig", "-namespace", "file", "-payload", "hello.txt", "-allowed-signers", "allowed_signers", "-principal", "ops@example.com"},
+			status:         9,
+			stdOutput:      testtools.NewRegexpStringMatcher("^\\{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"SSH key SHA256:[A-Za-z0-9+/]{43} is not allowed to sign for principal \\\\\"ops@example.com\\\\\" in namespace \\\\\"file\\\\\"\"\n\\}$"),
+			stdErr:         testtools.NewStringStringMatcher(""),
+		},
+		"Expired allowed signer": {
+			signArgs:       []string{"codechallenge", "-format", "sshsig", "-namespace", "file"},
+			allowedSigners: "ops@example.com valid-before=\"20190901Z\" ",
+			verifyArgs:     []string{"codechallenge", "-verify", "-format", "sshsig", "-namespace", "file", "-payload", "hello.txt", "-allowed-signers", "allowed_signers", "-principal", "ops@example.com"},
+			status:         9,
+			stdOutput:      testtools.NewRegexpStringMatcher("^\\{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"SSH key SHA256:[A-Za-z0-9+/]{43} is not allowed to sign for principal \\\\\"ops@example.com\\\\\" in namespace \\\\\"file\\\\\"\"\n\\}$"),
+			stdErr:         testtools.NewStringStringMatcher(""),
+		},
+		"Wrong namespace": {
+			signArgs:   []string{"codechallenge", "-format", "sshsig", "-namespace", "file"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "sshsig", "-namespace", "git", "-payload", "hello.txt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"SSH signature is in namespace \\\"file\\\", not \\\"git\\\"\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Wrong payload file": {
+			signArgs:   []string{"codechallenge", "-format", "sshsig", "-namespace", "file"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "sshsig", "-namespace", "file", "-payload", "goodbye.txt"},
+			status:     9,
+			stdOutput:  testtools.NewStringStringMatcher("{\n\"valid\": false,\n\"reason\": \"bad signature\"\n}"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+		"Missing payload file": {
+			signArgs:   []string{"codechallenge", "-format", "sshsig", "-namespace", "file"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "sshsig", "-namespace", "file"},
+			status:     3,
+			stdOutput:  testtools.NewStringStringMatcher(""),
+			stdErr:     testtools.NewStringStringMatcher("SSH signatures are detached, which requires -payload\nUsage of codechallenge:" + UsageMessageBody),
+		},
+		"Verified with the wrong key": {
+			signArgs:   []string{"codechallenge", "-format", "sshsig", "-namespace", "file"},
+			verifyArgs: []string{"codechallenge", "-verify", "-format", "sshsig", "-namespace", "file", "-payload", "hello.txt", "-public", "other.pub"},
+			status:     9,
+			stdOutput:  testtools.NewRegexpStringMatcher("^\\{\n\"valid\": false,\n\"reason\": \"bad signature\",\n\"detail\": \"SSH signature was made by key SHA256:[A-Za-z0-9+/]{43}, not SHA256:[A-Za-z0-9+/]{43}\"\n\\}$"),
+			stdErr:     testtools.NewStringStringMatcher(""),
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			files := testtools.FakeFileSystem{
+				"/home/anybody/hello.txt":   testtools.StringPtr("Hello, World!"),
+				"/home/anybody/goodbye.txt": testtools.StringPtr("Goodbye, World!"),
+			}
+			// An unrelated key-pair, to verify with, and the signing key-pair,
+			// to allow:
+			testtools.AddOtherKeyPair(files, "/home/anybody")
+			keyBundle := runMain(tt, &files, "", append([]string{codechallenge.ExportSSHKeyCommand}, tc.keyArgs...)...)
+			files["/home/anybody/allowed_signers"] = testtools.StringPtr(tc.allowedSigners + keyBundle.OutBuf.String())
+			signBundle := runMain(tt, &files, "Hello, World!", tc.signArgs[1:]...)
+			if exitStatus := signBundle.GetExitStatus(); exitStatus != 0 {
+				tt.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, signBundle.ErrBuf.String())
+			}
+			if _, err := sshsig.Parse(signBundle.OutBuf.String()); err != nil {
+				tt.Fatalf("Unexpected error parsing SSH signature: %s", err.Error())
+			}
+			verifyBundle := runMain(tt, &files, signBundle.OutBuf.String(), tc.verifyArgs[1:]...)
+			if exitStatus := verifyBundle.GetExitStatus(); exitStatus != tc.status {
+				tt.Errorf("RealMain() should have an exit status of %d. Got %#v instead.", tc.status, exitStatus)
+			}
+			if err := tc.stdOutput.MatchString(verifyBundle.OutBuf.String()); err != nil {
+				tt.Errorf("Standard Output:\n%#v didn't match:\n%s.", verifyBundle.OutBuf.String(), err.Error())
+			}
+			if err := tc.stdErr.MatchString(verifyBundle.ErrBuf.String()); err != nil {
+				tt.Errorf("Standard Error:\n%#v didn't match:\n%s.", verifyBundle.ErrBuf.String(), err.Error())
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	mathRand "math/rand"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // AllItems tells os.*File.ReadDir to read all items from directory
@@ -17,6 +18,9 @@ const (
 	AllItems = -1
 )
 
+// MockCurrentTime is the time reported by the mock clock.
+var MockCurrentTime = time.Date(2019, time.September, 1, 12, 0, 0, 0, time.UTC)
+
 // MockDepsBundle is a bundle of dependencies along with a mock environment it
 // talks to.
 type MockDepsBundle struct {
@@ -66,6 +70,12 @@ func NewDefaultMockDeps(stdinContent string, cmdLnArgs []string, homeDir string,
 					WriteFile: nil,
 				},
 			},
+			Net: deps.NetDependencies{
+				HTTP: deps.NetHTTPDependencies{
+					ListenAndServe: nil,
+					Post:           nil,
+				},
+			},
 			Os: deps.OsDependencies{
 				Args:      cmdLnArgs,
 				Chdir:     nil,
@@ -76,7 +86,9 @@ func NewDefaultMockDeps(stdinContent string, cmdLnArgs []string, homeDir string,
 				Getwd:     nil,
 				MkdirAll:  nil,
 				Open:      nil,
+				OpenFile:  nil,
 				RemoveAll: nil,
+				Rename:    nil,
 				Setenv:    os.Setenv,
 				Stat:      nil,
 				Stderr:    fakeStderr,
@@ -88,6 +100,11 @@ func NewDefaultMockDeps(stdinContent string, cmdLnArgs []string, homeDir string,
 					Walk: nil,
 				},
 			},
+			Time: deps.TimeDependencies{
+				Now: func() time.Time {
+					return MockCurrentTime
+				},
+			},
 		},
 		NativeDeps:  &CopyOfDefaultDeps,
 		OutBuf:      fakeStdout,
@@ -355,6 +372,13 @@ func (mdb *MockDepsBundle) populatePathMappingMocks() {
 		}
 		return mdb.NativeDeps.Os.Open(realPath)
 	}
+	mdb.Deps.Os.OpenFile = func(path string, flag int, perm os.FileMode) (*os.File, error) {
+		realPath, err := mdb.MapPathIn(path)
+		if err != nil {
+			return nil, err
+		}
+		return mdb.NativeDeps.Os.OpenFile(realPath, flag, perm)
+	}
 	mdb.Deps.Os.RemoveAll = func(path string) error {
 		realPath, err := mdb.MapPathIn(path)
 		if err != nil {
@@ -362,6 +386,17 @@ func (mdb *MockDepsBundle) populatePathMappingMocks() {
 		}
 		return mdb.NativeDeps.Os.RemoveAll(realPath)
 	}
+	mdb.Deps.Os.Rename = func(oldPath string, newPath string) error {
+		realOldPath, err := mdb.MapPathIn(oldPath)
+		if err != nil {
+			return err
+		}
+		realNewPath, err := mdb.MapPathIn(newPath)
+		if err != nil {
+			return err
+		}
+		return mdb.NativeDeps.Os.Rename(realOldPath, realNewPath)
+	}
 	mdb.Deps.Os.Stat = func(path string) (os.FileInfo, error) {
 		realPath, err := mdb.MapPathIn(path)
 		if err != nil {
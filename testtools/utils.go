@@ -1,8 +1,6 @@
 package testtools
 
 import (
-	"crypto/ecdsa"
-	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
 	"errors"
@@ -226,29 +224,35 @@ func GetResponseMatcherForMessageAndAlgorithm(d *deps.Dependencies, msg string,
 	})
 }
 
+// GetResponseMatcherForMessageAndMetadata returns a string matcher for a valid
+// response with a specific message, and specific values for the string
+// metadata fields named in metadata.
+func GetResponseMatcherForMessageAndMetadata(d *deps.Dependencies, msg string, metadata map[string]string) GenericStringMatcher {
+	return GenericStringMatcher(func(r string) error {
+		resp, _, err := ValidateResponse(d, r)
+		if err != nil {
+			return err
+		}
+		if resp.Message != msg {
+			return fmt.Errorf("signed message was %#v when %#v was expected", resp.Message, msg)
+		}
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(r), &fields); err != nil {
+			return err
+		}
+		for name, expected := range metadata {
+			if actual, ok := fields[name]; !ok || (actual != expected) {
+				return fmt.Errorf("metadata field %#v was %#v when %#v was expected", name, actual, expected)
+			}
+		}
+		return nil
+	})
+}
+
 // GetPEMPublicKeyAlgorithm determines the PKI algorithm from a given public
-// key string. (When the production code supports verification, this will be
-// moved to a methods of the X509Encoded and PEMEncoded types)
+// key string. This is a thin wrapper over crypt.PEMEncoded.PublicKeyAlgorithm()
 func GetPEMPublicKeyAlgorithm(PEMPublicKey string) (x509.PublicKeyAlgorithm, error) {
-	keyType := x509.UnknownPublicKeyAlgorithm
-	pubKeyPEM := crypt.NewPEMBufferFromString(PEMPublicKey)
-	pubKeyX509, err := pubKeyPEM.DecodeToX509()
-	if err != nil {
-		return keyType, err
-	}
-	untypedPubKey, err := pubKeyX509.AsGenericPublicKey()
-	if err != nil {
-		return keyType, err
-	}
-	switch untypedPubKey.(type) {
-	case *ecdsa.PublicKey:
-		keyType = x509.ECDSA
-	case *rsa.PublicKey:
-		keyType = x509.RSA
-	default:
-		return keyType, fmt.Errorf("Public key did not conform to recognized algorithm:\n%s", PEMPublicKey)
-	}
-	return keyType, nil
+	return crypt.NewPEMBufferFromString(PEMPublicKey).PublicKeyAlgorithm()
 }
 
 // GetURLFromProjectPath converts a project path to a file:/// URL.
@@ -283,7 +287,8 @@ func ValidateJSONSchema(d *deps.Dependencies, responseStr string, schemaPath str
 // ValidateResponse validates that the string provided conforms to the
 // schema in the spec, has a valid PEM format public key, a valid base64
 // signature, and that the signature was produced by signing the message with
-// the private key (corresponding to the included public key). It returns the
+// the private key (corresponding to the included public key), using the hash
+// and digest mode recorded in the response. It returns the
 // parsed JSON response, the signing algorithm and any errors encountered.
 func ValidateResponse(d *deps.Dependencies, responseStr string) (*codechallenge.SignedMessage, x509.PublicKeyAlgorithm, error) {
 	keyType := x509.UnknownPublicKeyAlgorithm
@@ -298,21 +303,15 @@ func ValidateResponse(d *deps.Dependencies, responseStr string) (*codechallenge.
 	if err != nil {
 		return &response, keyType, err
 	}
-	settings := &crypt.PkiSettings{
-		Algorithm:      keyType,
-		RSAKeyBits:     2048,
-		PrivateKeyPath: "",
-		PublicKeyPath:  "",
-	}
-	tooling, err := crypt.GetCryptoTooling(nil, settings)
+	config := &codechallenge.RunConfig{DigestMode: response.Digest}
+	verdict, err := codechallenge.VerifySignedMessageDocument(d, config, &response)
 	if err != nil {
 		return &response, keyType, err
 	}
-	matched, err := tooling.VerifySignedMessage(response.Message, response.Signature, response.Pubkey)
-	if (err == nil) && !matched {
-		return &response, keyType, fmt.Errorf("Code signature invalid for message: %#v", response.Message)
+	if !verdict.Valid {
+		return &response, keyType, fmt.Errorf("Code signature invalid for message: %#v (%s)", response.Message, verdict.Reason)
 	}
-	return &response, keyType, err
+	return &response, keyType, nil
 }
 
 // GetSourceFilename returns the filename of the caller's source code.
@@ -0,0 +1,177 @@
+package codechallenge
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/pki"
+	"github.com/smartedge/codechallenge/tsp"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultTSAListenAddress is the address the tsa-server command listens on,
+// if no address is given: the local host, on a port after the RFC.
+const DefaultTSAListenAddress = "localhost:3161"
+
+// maxTimestampResponseSize limits the size of the responses read from a TSA,
+// which are a token of a digest and the certificates of the TSA.
+const maxTimestampResponseSize = 1024 * 1024
+
+// TimestampSettings describes RFC 3161 time-stamping: the URL of the TSA the
+// signature is time-stamped by when signing, if any, and the address the
+// tsa-server command listens on.
+type TimestampSettings struct {
+	URL           string
+	ListenAddress string
+}
+
+// RequestTimestamp sends the digest of signature to the TSA at url, and
+// returns the DER encoding of the time-stamp token it responds with, once it
+// is checked to be of signature and of this request.
+func RequestTimestamp(d *deps.Dependencies, url string, settings *crypt.PkiSettings, signature []byte) ([]byte, error) {
+	nonce, err := pki.NewSerialNumber(d.Crypto.Rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	request, err := tsp.NewRequest(settings.GetHash(), signature, nonce)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.Net.HTTP.Post(url, tsp.RequestContentType, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// Ignore errors, as the response has been read:
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TSA %s responded with status %s", url, resp.Status)
+	}
+	buff, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTimestampResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	der, err := tsp.ParseResponse(buff)
+	if err != nil {
+		return nil, err
+	}
+	token, err := tsp.ParseToken(der)
+	if err != nil {
+		return nil, err
+	}
+	if (token.Nonce == nil) || (token.Nonce.Cmp(nonce) != 0) {
+		return nil, fmt.Errorf("TSA %s responded with a time-stamp token of another request", url)
+	}
+	if err := token.Verify(signature); err != nil {
+		return nil, err
+	}
+	return der, nil
+}
+
+// CheckTimestamp checks the DER encoded time-stamp token of signature, if
+// there is one, given the verdict on the signature. The token must be signed
+// by the TSA certificate it embeds, which must also be trusted by the trust
+// store in config if one is given, at the time of the token. The returned
+// verdict records that time and the TSA if the token is valid, along with the
+// time itself, which is zero if there is no token. A malformed trust store is
+// reported as an error, while tokens that aren't valid are reported in the
+// returned verdict.
+func CheckTimestamp(d *deps.Dependencies, config *RunConfig, verdict *Verdict, der []byte, signature []byte) (*Verdict, time.Time, error) {
+	if !verdict.Valid || (der == nil) {
+		return verdict, time.Time{}, nil
+	}
+	token, err := tsp.ParseToken(der)
+	if err != nil {
+		return NewVerdict(BadTimestamp, err.Error()), time.Time{}, nil
+	}
+	if err := token.Verify(signature); err != nil {
+		return NewVerdict(BadTimestamp, err.Error()), time.Time{}, nil
+	}
+	cert, err := token.Certificate()
+	if err != nil {
+		return NewVerdict(BadTimestamp, err.Error()), time.Time{}, nil
+	}
+	if config.Trust.StorePath != "" {
+		store, err := loadTrustStore(d, &config.Trust)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if _, err := store.Validate(cert, token.Intermediates(), token.GenTime, 0, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}); err != nil {
+			return NewVerdict(BadTimestamp, err.Error()), time.Time{}, nil
+		}
+	}
+	result := *verdict
+	result.Timestamp = token.GenTime.UTC().Format(time.RFC3339)
+	result.TSA = cert.Subject.String()
+	return &result, token.GenTime, nil
+}
+
+// TSAServerMain is the entry-point for the tsa-server command. It serves RFC
+// 3161 time-stamp requests over HTTP on the address in config, signing tokens
+// with the private key, whose TSA certificate is the certificate in config,
+// until the server fails.
+func TSAServerMain(d *deps.Dependencies, config *RunConfig) {
+	cryptStuff, err := crypt.GetCryptoTooling(d, &config.PubKeySettings)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	err = cryptStuff.PopulateKeys()
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	certs, err := loadCertificates(d, config.Output.CertPath)
+	if err != nil {
+		HandleError(d, err, 4)
+	}
+	if !pki.Certifies(certs[0], cryptStuff.Signer.Public()) {
+		HandleError(d, fmt.Errorf("Certificate in %s is not of the signing key", config.Output.CertPath), 4)
+	}
+	if err := tsp.CheckCertificate(certs[0]); err != nil {
+		HandleError(d, err, 4)
+	}
+	authority := &tsp.Authority{
+		Signer:        cryptStuff.Signer,
+		Certificate:   certs[0],
+		Intermediates: certs[1:],
+		Hash:          config.PubKeySettings.GetHash(),
+		Policy:        tsp.DefaultPolicy,
+		Rand:          d.Crypto.Rand.Reader,
+		Now:           d.Time.Now,
+	}
+	// Ignore errors, as the message is only informational:
+	_, _ = fmt.Fprintf(d.Os.Stderr, "TSA %s listening on http://%s/\n", certs[0].Subject.String(), config.Timestamp.ListenAddress)
+	err = d.Net.HTTP.ListenAndServe(config.Timestamp.ListenAddress, authority)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+}
+
+// parseTimestampOptions validates the TSA URL and listen address options in cl
+// into config.
+func parseTimestampOptions(config *RunConfig, cl *commandLine) error {
+	if *cl.tsaURL != "" {
+		if !((config.Output.Format == JSONOutput) || config.Output.Format.IsCMS()) || config.VerifyMode || (config.Command != "") {
+			return errors.New("Option -tsa is only valid when signing JSON or CMS output")
+		}
+		parsed, err := url.Parse(*cl.tsaURL)
+		if (err != nil) || ((parsed.Scheme != "http") && (parsed.Scheme != "https")) || (parsed.Host == "") {
+			return fmt.Errorf("Option -tsa must be an http or https URL. Saw -tsa=%s", *cl.tsaURL)
+		}
+		config.Timestamp.URL = *cl.tsaURL
+	}
+	if *cl.listenAddress != "" {
+		if config.Command != TSAServerCommand {
+			return fmt.Errorf("Option -listen is only valid with the %s command", TSAServerCommand)
+		}
+		config.Timestamp.ListenAddress = *cl.listenAddress
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package codechallenge_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/testtools"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestTimestamp verifies that signatures time-stamped by the tsa-server of a
+// certificate of a local CA verify with the time of the token, which the
+// certificates of the chain may be checked at, and that tokens of other
+// signatures don't verify.
+func TestTimestamp(t *testing.T) {
+	files := testtools.FakeFileSystem{}
+	caDir := "/home/anybody/.smartEdge/ca"
+	if bundle := runMain(t, &files, "", "ca", "init"); bundle.GetExitStatus() != 0 {
+		t.Fatalf("Creating the CA failed:\n%s", bundle.ErrBuf.String())
+	}
+	issue := func(filename string, extKeyUsage string, keyArgs ...string) {
+		csrBundle := runMain(t, &files, "", append([]string{"csr", "-subject", "CN=" + extKeyUsage}, keyArgs...)...)
+		issueBundle := runMain(t, &files, csrBundle.OutBuf.String(), "ca", "issue", "-ext-key-usage", extKeyUsage)
+		if exitStatus := issueBundle.GetExitStatus(); exitStatus != 0 {
+			t.Fatalf("Issuing the certificate failed with exit status %d:\n%s", exitStatus, issueBundle.ErrBuf.String())
+		}
+		files["/home/anybody/"+filename] = testtools.StringPtr(issueBundle.OutBuf.String())
+	}
+	// The mocked source of randomness is the same for every run, so the TSA
+	// needs a key on another curve to have a key of its own:
+	tsaKeyArgs := []string{"-curve", "P-384", "-private", "tsa.priv", "-public", "tsa.pub"}
+	issue("tsa.crt", "timeStamping", tsaKeyArgs...)
+	issue("signer.crt", "codeSigning")
+
+	var authority http.Handler
+	serverBundle := runMainWithHTTP(t, &files, "", deps.NetHTTPDependencies{
+		ListenAndServe: func(addr string, handler http.Handler) error {
+			if addr != "localhost:3161" {
+				t.Errorf("TSA should listen on localhost:3161. Got %s instead.", addr)
+			}
+			authority = handler
+			return nil
+		},
+	}, append([]string{"tsa-server", "-cert", "tsa.crt"}, tsaKeyArgs...)...)
+	if exitStatus := serverBundle.GetExitStatus(); (exitStatus != 0) || (authority == nil) {
+		t.Fatalf("Serving the TSA failed with exit status %d:\n%s", exitStatus, serverBundle.ErrBuf.String())
+	}
+	if msg := serverBundle.ErrBuf.String(); msg != "TSA CN=timeStamping listening on http://localhost:3161/\n" {
+		t.Errorf("TSA should report the address it listens on. Got %#v instead.", msg)
+	}
+	post := func(url string, contentType string, body io.Reader) (*http.Response, error) {
+		request := httptest.NewRequest(http.MethodPost, url, body)
+		request.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		authority.ServeHTTP(recorder, request)
+		return recorder.Result(), nil
+	}
+	sign := func(stdin string, args ...string) string {
+		bundle := runMainWithHTTP(t, &files, stdin, deps.NetHTTPDependencies{Post: post}, append([]string{"-tsa", "http://localhost:3161/"}, args...)...)
+		if exitStatus := bundle.GetExitStatus(); exitStatus != 0 {
+			t.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, bundle.ErrBuf.String())
+		}
+		return bundle.OutBuf.String()
+	}
+	jsonSigned := sign("Hello, World!", "-cert", "signer.crt")
+	cmsSigned := sign("Hello, World!", "-format", "cms", "-cert", "signer.crt")
+	plainSigned := sign("Hello, World!")
+	otherSigned := sign("Goodbye, World!")
+	untimed := runMain(t, &files, "Hello, World!", "-cert", "signer.crt").OutBuf.String()
+
+	verify := func(desc string, stdin string, status int, expected map[string]interface{}, args ...string) {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			bundle := runMain(tt, &files, stdin, append([]string{"-verify"}, args...)...)
+			if exitStatus := bundle.GetExitStatus(); exitStatus != status {
+				tt.Errorf("Verifying should have an exit status of %d. Got %d instead:\n%s", status, exitStatus, bundle.ErrBuf.String())
+			}
+			verdict := map[string]interface{}{}
+			if err := json.Unmarshal(bundle.OutBuf.Bytes(), &verdict); err != nil {
+				tt.Fatalf("Unexpected error parsing verdict %#v: %s", bundle.OutBuf.String(), err.Error())
+			}
+			if fmt.Sprint(verdict) != fmt.Sprint(expected) {
+				tt.Errorf("Verdict should be %v. Got %v instead.", expected, verdict)
+			}
+		})
+	}
+	timestamped := map[string]interface{}{"valid": true, "reason": "valid", "timestamp": "2019-09-01T12:00:00Z", "tsa": "CN=timeStamping"}
+	trusted := map[string]interface{}{
+		"valid":      true,
+		"reason":     "valid",
+		"timestamp":  "2019-09-01T12:00:00Z",
+		"tsa":        "CN=timeStamping",
+		"trusted":    true,
+		"chain":      []interface{}{"CN=codeSigning", "CN=codechallenge CA"},
+		"checked_at": "2019-09-01T12:00:00Z",
+	}
+
+	verify("JSON", plainSigned, 0, timestamped)
+	verify("JSON at time-stamp time", jsonSigned, 0, trusted, "-trust-store", caDir, "-check-time", "timestamp")
+	verify("CMS at time-stamp time", cmsSigned, 0, trusted, "-format", "cms", "-trust-store", caDir, "-check-time", "timestamp")
+	verify("Without a time-stamp token", untimed, 12, map[string]interface{}{"valid": false, "reason": "untrusted certificate", "detail": "Signature has no time-stamp token to check the certificates at", "trusted": false}, "-trust-store", caDir, "-check-time", "timestamp")
+
+	doc := map[string]interface{}{}
+	other := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(plainSigned), &doc); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if err := json.Unmarshal([]byte(otherSigned), &other); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	doc["timestamp"] = other["timestamp"]
+	tampered, _ := json.Marshal(doc)
+	verify("Token of another signature", string(tampered), 13, map[string]interface{}{"valid": false, "reason": "invalid timestamp", "detail": "Time-stamp token is of another digest"})
+
+	failing := runMainWithHTTP(t, &files, "Hello, World!", deps.NetHTTPDependencies{
+		Post: func(url string, contentType string, body io.Reader) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		},
+	}, "-tsa", "http://localhost:3161/")
+	checkFailure(t, failing, 5, "connection refused")
+	refusing := runMainWithHTTP(t, &files, "Hello, World!", deps.NetHTTPDependencies{
+		Post: func(url string, contentType string, body io.Reader) (*http.Response, error) {
+			recorder := httptest.NewRecorder()
+			http.Error(recorder, "Not Found", http.StatusNotFound)
+			return recorder.Result(), nil
+		},
+	}, "-tsa", "http://localhost:3161/")
+	checkFailure(t, refusing, 5, "TSA http://localhost:3161/ responded with status 404 Not Found")
+	checkFailure(t, runMain(t, &files, "", "tsa-server", "-cert", "signer.crt"), 4, "Certificate of CN=codeSigning is not a TSA certificate, which must have a critical extended key usage of timeStamping alone")
+}
@@ -0,0 +1,168 @@
+package codechallenge
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/pki"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TrustSettings describes how the certificate of a signer is validated in
+// -verify mode: the directory of trusted roots and CRLs, any further CRL
+// files, whether certificates are checked at the signing time or the time of
+// the time-stamp token rather than the current time, and the key usages the
+// certificate of the signer must allow. Certificates are only validated if
+// StorePath is given.
+type TrustSettings struct {
+	StorePath     string
+	CRLPaths      []string
+	AtSigningTime bool
+	AtTimestamp   bool
+	KeyUsage      x509.KeyUsage
+	ExtKeyUsage   []x509.ExtKeyUsage
+}
+
+// TrustVerdict is the outcome of verifying a signature by a certificate
+// against the trust store, to be rendered to JSON. The chain of subjects from
+// the signer to a trusted root, whether revocation of each was checked
+// against a CRL, and the time the certificates were checked at are only
+// included if the certificate is trusted.
+type TrustVerdict struct {
+	*Verdict
+	Trusted           bool     `json:"trusted"`
+	Chain             []string `json:"chain,omitempty"`
+	RevocationChecked bool     `json:"revocation_checked,omitempty"`
+	CheckedAt         string   `json:"checked_at,omitempty"`
+}
+
+// loadTrustStore reads the trust store in settings: the PEM certificates and
+// CRLs in each file of its directory, other than those in subdirectories,
+// and the PEM or DER CRL in each further CRL file.
+func loadTrustStore(d *deps.Dependencies, settings *TrustSettings) (*pki.TrustStore, error) {
+	info, err := d.Os.Stat(settings.StorePath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", settings.StorePath)
+	}
+	result := &pki.TrustStore{}
+	err = d.Path.FilePath.Walk(settings.StorePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != settings.StorePath {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		buff, err := d.Io.Ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := result.AddPEM(buff); err != nil {
+			return fmt.Errorf("File %s of the trust store: %s", path, err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Roots) == 0 {
+		return nil, fmt.Errorf("Trust store %s has no PEM certificates", settings.StorePath)
+	}
+	for _, path := range settings.CRLPaths {
+		buff, err := d.Io.Ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := result.AddCRL(buff); err != nil {
+			return nil, fmt.Errorf("File %s: %s", path, err.Error())
+		}
+	}
+	return result, nil
+}
+
+// CheckTrust validates the certificate leaf of a signer whose signature has
+// the verdict given, along with the intermediates of its chain, against the
+// trust store in config. The certificates are checked at signingTime or at
+// timestampTime, the time of a valid time-stamp token of the signature, if
+// the settings ask for that, or otherwise at the current time. Signatures
+// without the time asked for are untrusted. A malformed trust store is
+// reported as an error, while certificates that aren't trusted are reported
+// in the returned verdict.
+func CheckTrust(d *deps.Dependencies, config *RunConfig, verdict *Verdict, leaf *x509.Certificate, intermediates []*x509.Certificate, signingTime time.Time, timestampTime time.Time) (*TrustVerdict, error) {
+	store, err := loadTrustStore(d, &config.Trust)
+	if err != nil {
+		return nil, err
+	}
+	if !verdict.Valid {
+		return &TrustVerdict{Verdict: verdict}, nil
+	}
+	at := d.Time.Now()
+	if config.Trust.AtSigningTime {
+		if signingTime.IsZero() {
+			return &TrustVerdict{Verdict: NewVerdict(Untrusted, "Signature has no signing time to check the certificates at")}, nil
+		}
+		at = signingTime
+	}
+	if config.Trust.AtTimestamp {
+		if timestampTime.IsZero() {
+			return &TrustVerdict{Verdict: NewVerdict(Untrusted, "Signature has no time-stamp token to check the certificates at")}, nil
+		}
+		at = timestampTime
+	}
+	validation, err := store.Validate(leaf, intermediates, at, config.Trust.KeyUsage, config.Trust.ExtKeyUsage)
+	if err != nil {
+		return &TrustVerdict{Verdict: NewVerdict(Untrusted, err.Error())}, nil
+	}
+	result := &TrustVerdict{
+		Verdict:           verdict,
+		Trusted:           true,
+		RevocationChecked: validation.RevocationChecked,
+		CheckedAt:         at.UTC().Format(time.RFC3339),
+	}
+	for _, cert := range validation.Chain {
+		result.Chain = append(result.Chain, cert.Subject.String())
+	}
+	return result, nil
+}
+
+// parseTrustOptions validates the trust store, CRL and check time options in
+// cl into config.
+func parseTrustOptions(config *RunConfig, cl *commandLine) error {
+	if (*cl.trustStorePath != "") || (*cl.crlPaths != "") || (*cl.checkTime != "") {
+		if !((config.Output.Format == JSONOutput) || config.Output.Format.IsCMS()) || !config.VerifyMode {
+			return errors.New("Trust options are only valid when verifying JSON or CMS input")
+		}
+		if *cl.trustStorePath == "" {
+			return errors.New("Options -crl and -check-time require -trust-store")
+		}
+		config.Trust.StorePath = *cl.trustStorePath
+		if *cl.crlPaths != "" {
+			config.Trust.CRLPaths = strings.Split(*cl.crlPaths, ",")
+		}
+		switch *cl.checkTime {
+		case "", "now":
+		case "signing":
+			if !config.Output.Format.IsCMS() {
+				return errors.New("Option -check-time=signing is only valid for CMS input, as signed messages in JSON format have no signing time")
+			}
+			config.Trust.AtSigningTime = true
+		case "timestamp":
+			config.Trust.AtTimestamp = true
+		default:
+			return fmt.Errorf("Unrecognized check time %#v: expected now, signing or timestamp", *cl.checkTime)
+		}
+	}
+	return nil
+}
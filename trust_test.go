@@ -0,0 +1,106 @@
+package codechallenge_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/smartedge/codechallenge"
+	"github.com/smartedge/codechallenge/pki"
+	"github.com/smartedge/codechallenge/testtools"
+	"github.com/smartedge/codechallenge/testtools/mocks"
+	"testing"
+	"time"
+)
+
+// TestVerifyTrust verifies that signatures by certificates of a local CA are
+// only trusted with the CA directory as the trust store, and that they stop
+// being trusted once the certificate is revoked.
+func TestVerifyTrust(t *testing.T) {
+	files := testtools.FakeFileSystem{}
+	caDir := "/home/anybody/.smartEdge/ca"
+	if bundle := runMain(t, &files, "", "ca", "init"); bundle.GetExitStatus() != 0 {
+		t.Fatalf("Creating the CA failed:\n%s", bundle.ErrBuf.String())
+	}
+	csrBundle := runMain(t, &files, "", "csr", "-subject", "CN=signer")
+	issueBundle := runMain(t, &files, csrBundle.OutBuf.String(), "ca", "issue", "-ext-key-usage", "codeSigning")
+	if exitStatus := issueBundle.GetExitStatus(); exitStatus != 0 {
+		t.Fatalf("Issuing the certificate failed with exit status %d:\n%s", exitStatus, issueBundle.ErrBuf.String())
+	}
+	files["/home/anybody/signer.crt"] = testtools.StringPtr(issueBundle.OutBuf.String())
+	jsonBundle := runMain(t, &files, "Hello, World!", "-cert", "signer.crt")
+	cmsBundle := runMain(t, &files, "Hello, World!", "-format", "cms", "-cert", "signer.crt")
+	plainBundle := runMain(t, &files, "Hello, World!")
+	for _, bundle := range []*mocks.MockDepsBundle{jsonBundle, cmsBundle, plainBundle} {
+		if exitStatus := bundle.GetExitStatus(); exitStatus != 0 {
+			t.Fatalf("Signing failed with exit status %d:\n%s", exitStatus, bundle.ErrBuf.String())
+		}
+	}
+
+	verify := func(desc string, stdin string, status int, expected map[string]interface{}, args ...string) {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			bundle := runMain(tt, &files, stdin, append([]string{"-verify", "-trust-store", caDir}, args...)...)
+			if exitStatus := bundle.GetExitStatus(); exitStatus != status {
+				tt.Errorf("Verifying should have an exit status of %d. Got %d instead:\n%s", status, exitStatus, bundle.ErrBuf.String())
+			}
+			verdict := map[string]interface{}{}
+			if err := json.Unmarshal(bundle.OutBuf.Bytes(), &verdict); err != nil {
+				tt.Fatalf("Unexpected error parsing verdict %#v: %s", bundle.OutBuf.String(), err.Error())
+			}
+			if fmt.Sprint(verdict) != fmt.Sprint(expected) {
+				tt.Errorf("Verdict should be %v. Got %v instead.", expected, verdict)
+			}
+		})
+	}
+	trusted := func(revocationChecked bool) map[string]interface{} {
+		result := map[string]interface{}{
+			"valid":      true,
+			"reason":     "valid",
+			"trusted":    true,
+			"chain":      []interface{}{"CN=signer", "CN=codechallenge CA"},
+			"checked_at": "2019-09-01T12:00:00Z",
+		}
+		if revocationChecked {
+			result["revocation_checked"] = true
+		}
+		return result
+	}
+	untrusted := func(reason string) map[string]interface{} {
+		return map[string]interface{}{"valid": false, "reason": "untrusted certificate", "detail": reason, "trusted": false}
+	}
+
+	verify("JSON without CRL", jsonBundle.OutBuf.String(), 0, trusted(false))
+	verify("CMS at signing time", cmsBundle.OutBuf.String(), 0, trusted(false), "-format", "cms", "-check-time", "signing")
+	verify("Key usage", jsonBundle.OutBuf.String(), 12, untrusted("Certificate of CN=signer is not trusted: x509: certificate specifies an incompatible key usage"), "-ext-key-usage", "serverAuth")
+	verify("Plain public key", plainBundle.OutBuf.String(), 12, untrusted("Public key of the signed message is not a certificate"))
+
+	if bundle := runMain(t, &files, "", "ca", "crl"); bundle.GetExitStatus() != 0 {
+		t.Fatalf("Generating the CRL failed:\n%s", bundle.ErrBuf.String())
+	}
+	verify("JSON with CRL", jsonBundle.OutBuf.String(), 0, trusted(true))
+
+	runMain(t, &files, "", "ca", "revoke", "01")
+	files["/home/anybody/crl.pem"] = files[caDir+"/crl.pem"]
+	if bundle := runMain(t, &files, "", "ca", "crl"); bundle.GetExitStatus() != 0 {
+		t.Fatalf("Generating the CRL failed:\n%s", bundle.ErrBuf.String())
+	}
+	verify("Revoked", jsonBundle.OutBuf.String(), 12, untrusted("Certificate 01 of CN=signer was revoked at 2019-09-01T12:00:00Z"), "-crl", "crl.pem")
+
+	// A CMS signature need not have a signing time, which mustn't be taken for
+	// the zero time:
+	chain, err := pki.ParsePEMChain([]byte(*files["/home/anybody/signer.crt"]))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing certificate: %s", err.Error())
+	}
+	bundle := mocks.NewDefaultMockDeps("", []string{"codechallenge"}, "/home/anybody", &files)
+	config := &codechallenge.RunConfig{Trust: codechallenge.TrustSettings{StorePath: caDir, AtSigningTime: true}}
+	var trustVerdict *codechallenge.TrustVerdict
+	err = bundle.InvokeCallInMockedEnv(func() error {
+		trustVerdict, err = codechallenge.CheckTrust(bundle.Deps, config, codechallenge.NewVerdict(codechallenge.SignatureValid, ""), chain[0], chain[1:], time.Time{}, time.Time{})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if (trustVerdict.Reason != codechallenge.Untrusted.String()) || (trustVerdict.Detail != "Signature has no signing time to check the certificates at") {
+		t.Errorf("Signature without a signing time should be untrusted. Got %#v instead.", trustVerdict.Verdict)
+	}
+}
@@ -0,0 +1,135 @@
+package tsp
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"github.com/smartedge/codechallenge/cms"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/pki"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// DefaultPolicy is a TSA policy for tokens that make no promises beyond the
+// time of the clock they were issued by: the anyPolicy certificate policy of
+// RFC 5280.
+var DefaultPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+
+// maxRequestSize limits the size of the requests an Authority reads, which
+// are only a digest and a few small fields.
+const maxRequestSize = 64 * 1024
+
+// Authority is a TSA, which issues time-stamp tokens with the time given by
+// Now, under Policy, signed by Signer with the digest Hash. Certificate is
+// the TSA certificate of Signer, which is embedded in the tokens along with
+// the Intermediates of its chain if the request asks for it.
+type Authority struct {
+	Signer        crypto.Signer
+	Certificate   *x509.Certificate
+	Intermediates []*x509.Certificate
+	Hash          crypto.Hash
+	Policy        asn1.ObjectIdentifier
+	Rand          io.Reader
+	Now           func() time.Time
+}
+
+// rejection returns the DER encoding of a response rejecting a request, with
+// text and the failure information bit failure.
+func rejection(failure int, text string) ([]byte, error) {
+	failInfo := make([]byte, failure/8+1)
+	failInfo[failure/8] = 0x80 >> uint(failure%8)
+	status := statusInfo{
+		Status:       StatusRejection,
+		StatusString: []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(text)}},
+		FailInfo:     asn1.BitString{Bytes: failInfo, BitLength: failure + 1},
+	}
+	return asn1.Marshal(response{Status: status})
+}
+
+// Respond returns the DER encoding of the response to the DER encoded
+// request der: a time-stamp token of its digest, or the reason it was
+// rejected. An error is only returned if no response could be made.
+func (a *Authority) Respond(der []byte) ([]byte, error) {
+	req := request{}
+	if rest, err := asn1.Unmarshal(der, &req); (err != nil) || (len(rest) > 0) {
+		return rejection(FailBadDataFormat, "Request is not a valid time-stamp request")
+	}
+	if req.Version != 1 {
+		return rejection(FailBadRequest, fmt.Sprintf("Request has version %d, but 1 was expected", req.Version))
+	}
+	hash, err := cms.DigestAlgorithmHash(req.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return rejection(FailBadAlg, err.Error())
+	}
+	if len(req.MessageImprint.HashedMessage) != hash.Size() {
+		return rejection(FailBadDataFormat, fmt.Sprintf("Request digest is %d bytes long, but %s digests are %d bytes long", len(req.MessageImprint.HashedMessage), crypt.HashName(hash), hash.Size()))
+	}
+	if (req.ReqPolicy != nil) && !req.ReqPolicy.Equal(a.Policy) {
+		return rejection(FailUnacceptedPolicy, fmt.Sprintf("Request policy %s is not the policy %s of the TSA", req.ReqPolicy.String(), a.Policy.String()))
+	}
+	if len(req.Extensions) > 0 {
+		return rejection(FailUnacceptedExtension, "Request extensions are not supported")
+	}
+	serialNumber, err := pki.NewSerialNumber(a.Rand)
+	if err != nil {
+		return nil, err
+	}
+	content, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         a.Policy,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   serialNumber,
+		GenTime:        a.Now().UTC().Truncate(time.Second),
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	attr := cms.Attribute{
+		Type:  OIDSigningCertificateV2,
+		Value: signingCertificateV2{Certs: []essCertIDv2{{CertHash: crypt.NewDigestHash(crypto.SHA256, string(a.Certificate.Raw))}}},
+	}
+	var embedded []*x509.Certificate
+	if req.CertReq {
+		embedded = append([]*x509.Certificate{a.Certificate}, a.Intermediates...)
+	}
+	token, err := cms.SignContent(a.Signer, a.Rand, OIDTSTInfo, content, a.Hash, a.Certificate, embedded, false, []cms.Attribute{attr})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(response{Status: statusInfo{Status: StatusGranted}, TimeStampToken: asn1.RawValue{FullBytes: token}})
+}
+
+// ServeHTTP responds to time-stamp requests POSTed to any path, as described
+// by section 3.4 of RFC 3161.
+func (a *Authority) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Time-stamp requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Content-Type") != RequestContentType {
+		http.Error(w, fmt.Sprintf("Time-stamp requests must have the media type %s", RequestContentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	der, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := a.Respond(der)
+	if err != nil {
+		resp, err = rejection(FailSystemFailure, err.Error())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", ResponseContentType)
+	// Ignore errors, as the client has gone away:
+	_, _ = w.Write(resp)
+}
@@ -0,0 +1,382 @@
+// Package tsp implements the Time-Stamp Protocol, as defined by RFC 3161:
+// requests for time-stamp tokens of a digest, the responses of a
+// time-stamping authority (TSA), and the tokens themselves, which are CMS
+// SignedData of a TSTInfo signed by the TSA.
+package tsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/smartedge/codechallenge/cms"
+	"github.com/smartedge/codechallenge/crypt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Media types of time-stamp requests and responses sent over HTTP, as
+// registered by RFC 3161.
+const (
+	RequestContentType  = "application/timestamp-query"
+	ResponseContentType = "application/timestamp-reply"
+)
+
+// Object identifiers of the content type of tokens, and of attributes
+var (
+	OIDTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	OIDTimeStampToken       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	OIDSigningCertificate   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	OIDSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidExtKeyUsage          = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// Status values of a response
+const (
+	StatusGranted = iota
+	StatusGrantedWithMods
+	StatusRejection
+	StatusWaiting
+	StatusRevocationWarning
+	StatusRevocationNotification
+)
+
+// statusNames names the status values of a response.
+var statusNames = []string{"granted", "grantedWithMods", "rejection", "waiting", "revocationWarning", "revocationNotification"}
+
+// Bits of the failure information of a rejected request
+const (
+	FailBadAlg              = 0
+	FailBadRequest          = 2
+	FailBadDataFormat       = 5
+	FailTimeNotAvailable    = 14
+	FailUnacceptedPolicy    = 15
+	FailUnacceptedExtension = 16
+	FailAddInfoNotAvailable = 17
+	FailSystemFailure       = 25
+)
+
+// failureNames names the bits of the failure information.
+var failureNames = map[int]string{
+	FailBadAlg:              "badAlg",
+	FailBadRequest:          "badRequest",
+	FailBadDataFormat:       "badDataFormat",
+	FailTimeNotAvailable:    "timeNotAvailable",
+	FailUnacceptedPolicy:    "unacceptedPolicy",
+	FailUnacceptedExtension: "unacceptedExtension",
+	FailAddInfoNotAvailable: "addInfoNotAvailable",
+	FailSystemFailure:       "systemFailure",
+}
+
+// messageImprint is the digest a time-stamp is of.
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// request is a TimeStampReq.
+type request struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"optional,tag:0"`
+}
+
+// statusInfo is the PKIStatusInfo of a response. The free text is kept as
+// raw values, as it must be encoded as UTF8String.
+type statusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+// response is a TimeStampResp.
+type response struct {
+	Status         statusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// accuracy is how far the time of a time-stamp may be from the true time.
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// tstInfo is the content of a time-stamp token.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time        `asn1:"generalized"`
+	Accuracy       accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,explicit,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+// essCertID identifies the certificate of the signer of a token by its SHA-1
+// hash, in a signing-certificate attribute.
+type essCertID struct {
+	CertHash     []byte
+	IssuerSerial asn1.RawValue `asn1:"optional"`
+}
+
+// signingCertificate is the value of a signing-certificate attribute.
+type signingCertificate struct {
+	Certs    []essCertID
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+// essCertIDv2 identifies the certificate of the signer of a token by its
+// hash, with SHA-256 unless given, in a signing-certificate-v2 attribute.
+type essCertIDv2 struct {
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+	IssuerSerial  asn1.RawValue `asn1:"optional"`
+}
+
+// signingCertificateV2 is the value of a signing-certificate-v2 attribute.
+type signingCertificateV2 struct {
+	Certs    []essCertIDv2
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+// newMessageImprint returns the message imprint of data, digested with
+// hash.
+func newMessageImprint(hash crypto.Hash, data []byte) (messageImprint, error) {
+	oid, err := cms.DigestAlgorithmOID(hash)
+	if err != nil {
+		return messageImprint{}, err
+	}
+	return messageImprint{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid},
+		HashedMessage: crypt.NewDigestHash(hash, string(data)),
+	}, nil
+}
+
+// NewRequest returns the DER encoding of a request for a time-stamp token of
+// data, digested with hash, with nonce, asking for the certificate of the
+// TSA to be embedded in the token.
+func NewRequest(hash crypto.Hash, data []byte, nonce *big.Int) ([]byte, error) {
+	imprint, err := newMessageImprint(hash, data)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(request{Version: 1, MessageImprint: imprint, Nonce: nonce, CertReq: true})
+}
+
+// describeStatus describes the status, free text and failure information of
+// a response that wasn't granted.
+func describeStatus(status statusInfo) string {
+	result := fmt.Sprintf("status %d", status.Status)
+	if (status.Status >= 0) && (status.Status < len(statusNames)) {
+		result = "status " + statusNames[status.Status]
+	}
+	texts := []string{}
+	for _, text := range status.StatusString {
+		texts = append(texts, string(text.Bytes))
+	}
+	if len(texts) > 0 {
+		result += ": " + strings.Join(texts, "; ")
+	}
+	failures := []string{}
+	for bit := 0; bit < status.FailInfo.BitLength; bit++ {
+		if status.FailInfo.At(bit) == 0 {
+			continue
+		}
+		name, ok := failureNames[bit]
+		if !ok {
+			name = fmt.Sprintf("failure %d", bit)
+		}
+		failures = append(failures, name)
+	}
+	if len(failures) > 0 {
+		result += " (" + strings.Join(failures, ", ") + ")"
+	}
+	return result
+}
+
+// ParseResponse returns the DER encoding of the time-stamp token in the DER
+// encoded response der, or an error explaining why the TSA didn't grant it.
+func ParseResponse(der []byte) ([]byte, error) {
+	resp := response{}
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, fmt.Errorf("Time-stamp response is not valid: %s", err.Error())
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("Time-stamp response is followed by %d unexpected bytes", len(rest))
+	}
+	if (resp.Status.Status != StatusGranted) && (resp.Status.Status != StatusGrantedWithMods) {
+		return nil, fmt.Errorf("TSA did not grant the time-stamp request, with %s", describeStatus(resp.Status))
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("Time-stamp response was granted, but has no time-stamp token")
+	}
+	return resp.TimeStampToken.FullBytes, nil
+}
+
+// Token is a parsed time-stamp token: the time GenTime at which the TSA
+// asserts the digest HashedMessage, made with Hash, existed.
+type Token struct {
+	SignedData    *cms.SignedData
+	Policy        asn1.ObjectIdentifier
+	Hash          crypto.Hash
+	HashedMessage []byte
+	SerialNumber  *big.Int
+	GenTime       time.Time
+	Nonce         *big.Int
+}
+
+// ParseToken parses the DER encoding of a time-stamp token. Its signature is
+// not verified.
+func ParseToken(der []byte) (*Token, error) {
+	signed, err := cms.ParseContent(der, OIDTSTInfo)
+	if err != nil {
+		return nil, fmt.Errorf("Time-stamp token is not valid: %s", err.Error())
+	}
+	if signed.Detached {
+		return nil, errors.New("Time-stamp token has no TSTInfo")
+	}
+	info := tstInfo{}
+	if rest, err := asn1.Unmarshal(signed.Content, &info); err != nil {
+		return nil, fmt.Errorf("Time-stamp token has an invalid TSTInfo: %s", err.Error())
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("Time-stamp token TSTInfo is followed by %d unexpected bytes", len(rest))
+	}
+	if info.Version != 1 {
+		return nil, fmt.Errorf("Time-stamp token has TSTInfo version %d, but 1 was expected", info.Version)
+	}
+	hash, err := cms.DigestAlgorithmHash(info.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("Time-stamp token: %s", err.Error())
+	}
+	return &Token{
+		SignedData:    signed,
+		Policy:        info.Policy,
+		Hash:          hash,
+		HashedMessage: info.MessageImprint.HashedMessage,
+		SerialNumber:  info.SerialNumber,
+		GenTime:       info.GenTime,
+		Nonce:         info.Nonce,
+	}, nil
+}
+
+// Certificate returns the certificate of the TSA embedded in the token, which
+// signed it.
+func (t *Token) Certificate() (*x509.Certificate, error) {
+	cert, err := t.SignedData.SignerCertificate()
+	if err != nil {
+		return nil, fmt.Errorf("Time-stamp token: %s", err.Error())
+	}
+	return cert, nil
+}
+
+// Intermediates returns the certificates embedded in the token other than
+// that of the TSA, which may be intermediates of its chain.
+func (t *Token) Intermediates() []*x509.Certificate {
+	cert, _ := t.SignedData.SignerCertificate()
+	result := []*x509.Certificate{}
+	for _, embedded := range t.SignedData.Certificates {
+		if embedded != cert {
+			result = append(result, embedded)
+		}
+	}
+	return result
+}
+
+// Verify checks that the token is of data, and is signed by the embedded
+// certificate of the TSA, which must be valid at the time of the token, and
+// be identified by a signing-certificate or signing-certificate-v2 attribute.
+// The certificate isn't checked against any trusted roots.
+func (t *Token) Verify(data []byte) error {
+	if !bytes.Equal(t.HashedMessage, crypt.NewDigestHash(t.Hash, string(data))) {
+		return errors.New("Time-stamp token is of another digest")
+	}
+	cert, err := t.Certificate()
+	if err != nil {
+		return err
+	}
+	if err := CheckCertificate(cert); err != nil {
+		return err
+	}
+	if t.GenTime.Before(cert.NotBefore) || t.GenTime.After(cert.NotAfter) {
+		return fmt.Errorf("Time-stamp token was made at %s, but the certificate of the TSA is only valid from %s until %s", t.GenTime.UTC().Format(time.RFC3339), cert.NotBefore.UTC().Format(time.RFC3339), cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if err := t.checkSigningCertificate(cert); err != nil {
+		return err
+	}
+	valid, err := t.SignedData.Verify(cert.PublicKey)
+	if err != nil {
+		return fmt.Errorf("Time-stamp token signature is not valid: %s", err.Error())
+	}
+	if !valid {
+		return errors.New("Time-stamp token signature is not valid")
+	}
+	return nil
+}
+
+// checkSigningCertificate checks that the first certificate identified by the
+// signing-certificate-v2 attribute of the token, or otherwise by its
+// signing-certificate attribute, is cert.
+func (t *Token) checkSigningCertificate(cert *x509.Certificate) error {
+	var hash crypto.Hash
+	var certHash []byte
+	if buff := t.SignedData.SignedAttribute(OIDSigningCertificateV2); buff != nil {
+		value := signingCertificateV2{}
+		if _, err := asn1.Unmarshal(buff, &value); (err != nil) || (len(value.Certs) == 0) {
+			return errors.New("Time-stamp token has an invalid signing-certificate-v2 attribute")
+		}
+		hash = crypto.SHA256
+		if value.Certs[0].HashAlgorithm.Algorithm != nil {
+			var err error
+			if hash, err = cms.DigestAlgorithmHash(value.Certs[0].HashAlgorithm.Algorithm); err != nil {
+				return fmt.Errorf("Time-stamp token signing-certificate-v2 attribute: %s", err.Error())
+			}
+		}
+		certHash = value.Certs[0].CertHash
+	} else if buff := t.SignedData.SignedAttribute(OIDSigningCertificate); buff != nil {
+		value := signingCertificate{}
+		if _, err := asn1.Unmarshal(buff, &value); (err != nil) || (len(value.Certs) == 0) {
+			return errors.New("Time-stamp token has an invalid signing-certificate attribute")
+		}
+		hash = crypto.SHA1
+		certHash = value.Certs[0].CertHash
+	} else {
+		return errors.New("Time-stamp token has no signing-certificate or signing-certificate-v2 attribute")
+	}
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum(cert.Raw)
+		digest = sum[:]
+	} else {
+		digest = crypt.NewDigestHash(hash, string(cert.Raw))
+	}
+	if !bytes.Equal(certHash, digest) {
+		return errors.New("Time-stamp token signing certificate attribute does not identify the certificate of the TSA")
+	}
+	return nil
+}
+
+// CheckCertificate checks that cert may be used by a TSA: its extended key
+// usage extension must be critical, with timeStamping as its only usage.
+func CheckCertificate(cert *x509.Certificate) error {
+	critical := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtKeyUsage) {
+			critical = ext.Critical
+		}
+	}
+	if !critical || (len(cert.ExtKeyUsage) != 1) || (cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping) || (len(cert.UnknownExtKeyUsage) > 0) {
+		return fmt.Errorf("Certificate of %s is not a TSA certificate, which must have a critical extended key usage of timeStamping alone", cert.Subject.String())
+	}
+	return nil
+}
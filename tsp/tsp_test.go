@@ -0,0 +1,244 @@
+package tsp_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"github.com/smartedge/codechallenge/pki"
+	"github.com/smartedge/codechallenge/tsp"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// OpenSSLToken is a time-stamp token of "Hello, World!", made by
+// `openssl ts -reply -token_out` with the TSA certificate OpenSSLCertificate,
+// which identifies it with a signing-certificate-v2 attribute.
+const OpenSSLToken = `MIIFFwYJKoZIhvcNAQcCoIIFCDCCBQQCAQMxDzANBglghkgBZQMEAgEFADCBkwYL
+KoZIhvcNAQkQAQSggYMEgYAwfgIBAQYEKgMEATAxMA0GCWCGSAFlAwQCAQUABCDf
+/WAhuyvVsK9nYpCAnsOlMZHdgcf3CksoaIo2IYKYbwIBAhgPMjAyNjEwMTgyMTA0
+MDVaMAMCAQEBAf8CCBEzBjc3szO0oBqkGDAWMRQwEgYDVQQDDAtmaXh0dXJlIFRT
+QaCCAxAwggGEMIIBKqADAgECAhQyoXUDXPgu+vjby7W8r6GJudONQTAKBggqhkjO
+PQQDAjAWMRQwEgYDVQQDDAtmaXh0dXJlIFRTQTAgFw0yNjEwMTgyMTA0MDVaGA8y
+MTI2MDkyNDIxMDQwNVowFjEUMBIGA1UEAwwLZml4dHVyZSBUU0EwWTATBgcqhkjO
+PQIBBggqhkjOPQMBBwNCAAQ7noUU8n86Ywgn7508oh/hWlGbi2rCYhWKh+EqTnut
+WIUtX5OCE0VGEFh09PEhksktA5qN6SaundW8Q9P/7Rwqo1QwUjAJBgNVHRMEAjAA
+MA4GA1UdDwEB/wQEAwIHgDAWBgNVHSUBAf8EDDAKBggrBgEFBQcDCDAdBgNVHQ4E
+FgQUKCKYKJNgVdfI2SlFWPQerFcsmTMwCgYIKoZIzj0EAwIDSAAwRQIgP6JBu8YW
+c8h+TNE/rRCsZP5WTri9xLRSXiiIiUd4rFECIQCdZ7Usbd3J5O/xemifISEzCtXh
+1Fz9/jNpO6++YlBCDTCCAYQwggEqoAMCAQICFDKhdQNc+C76+NvLtbyvoYm5041B
+MAoGCCqGSM49BAMCMBYxFDASBgNVBAMMC2ZpeHR1cmUgVFNBMCAXDTI2MTAxODIx
+MDQwNVoYDzIxMjYwOTI0MjEwNDA1WjAWMRQwEgYDVQQDDAtmaXh0dXJlIFRTQTBZ
+MBMGByqGSM49AgEGCCqGSM49AwEHA0IABDuehRTyfzpjCCfvnTyiH+FaUZuLasJi
+FYqH4SpOe61YhS1fk4ITRUYQWHT08SGSyS0Dmo3pJq6d1bxD0//tHCqjVDBSMAkG
+A1UdEwQCMAAwDgYDVR0PAQH/BAQDAgeAMBYGA1UdJQEB/wQMMAoGCCsGAQUFBwMI
+MB0GA1UdDgQWBBQoIpgok2BV18jZKUVY9B6sVyyZMzAKBggqhkjOPQQDAgNIADBF
+AiA/okG7xhZzyH5M0T+tEKxk/lZOuL3EtFJeKIiJR3isUQIhAJ1ntSxt3cnk7/F6
+aJ8hITMK1eHUXP3+M2k7r75iUEINMYIBQjCCAT4CAQEwLjAWMRQwEgYDVQQDDAtm
+aXh0dXJlIFRTQQIUMqF1A1z4Lvr428u1vK+hibnTjUEwDQYJYIZIAWUDBAIBBQCg
+gaQwGgYJKoZIhvcNAQkDMQ0GCyqGSIb3DQEJEAEEMBwGCSqGSIb3DQEJBTEPFw0y
+NjEwMTgyMTA0MDVaMC8GCSqGSIb3DQEJBDEiBCDXZviJW9AWmGR5mNIBYnknoGZl
+T4o5tt26+v89u0Bx/TA3BgsqhkiG9w0BCRACLzEoMCYwJDAiBCACXqmBH9gX/0x1
+UG1fLN5NgxZG9LywCddqAD6N6fzm5jAKBggqhkjOPQQDAgRHMEUCIEtK4HdNWtmA
+ZAoZXB+KhX2K29W5m1r06yELlO/f6TYoAiEAprhr0CBZ1f1AutRcFC7GOyxpl+wO
+hXmwrZ22y1X0h0A=`
+
+// OpenSSLCertificate is the self-signed TSA certificate that signed
+// OpenSSLToken.
+const OpenSSLCertificate = `-----BEGIN CERTIFICATE-----
+MIIBhDCCASqgAwIBAgIUMqF1A1z4Lvr428u1vK+hibnTjUEwCgYIKoZIzj0EAwIw
+FjEUMBIGA1UEAwwLZml4dHVyZSBUU0EwIBcNMjYxMDE4MjEwNDA1WhgPMjEyNjA5
+MjQyMTA0MDVaMBYxFDASBgNVBAMMC2ZpeHR1cmUgVFNBMFkwEwYHKoZIzj0CAQYI
+KoZIzj0DAQcDQgAEO56FFPJ/OmMIJ++dPKIf4VpRm4tqwmIViofhKk57rViFLV+T
+ghNFRhBYdPTxIZLJLQOajekmrp3VvEPT/+0cKqNUMFIwCQYDVR0TBAIwADAOBgNV
+HQ8BAf8EBAMCB4AwFgYDVR0lAQH/BAwwCgYIKwYBBQUHAwgwHQYDVR0OBBYEFCgi
+mCiTYFXXyNkpRVj0HqxXLJkzMAoGCCqGSM49BAMCA0gAMEUCID+iQbvGFnPIfkzR
+P60QrGT+Vk64vcS0Ul4oiIlHeKxRAiEAnWe1LG3dyeTv8XponyEhMwrV4dRc/f4z
+aTuvvmJQQg0=
+-----END CERTIFICATE-----
+`
+
+// newAuthority returns an Authority with a new key and a TSA certificate of
+// it with the extended key usages given, at now.
+func newAuthority(t *testing.T, now time.Time, extKeyUsage ...x509.ExtKeyUsage) *tsp.Authority {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	profile := pki.NewProfile("Test TSA")
+	profile.ExtKeyUsage = extKeyUsage
+	cert, err := pki.SelfSign(key, rand.Reader, profile, now)
+	if err != nil {
+		t.Fatalf("Unexpected error creating TSA certificate: %s", err.Error())
+	}
+	return &tsp.Authority{
+		Signer:      key,
+		Certificate: cert,
+		Hash:        crypto.SHA256,
+		Policy:      tsp.DefaultPolicy,
+		Rand:        rand.Reader,
+		Now:         func() time.Time { return now },
+	}
+}
+
+// TestOpenSSLToken verifies that a token made by OpenSSL parses and verifies
+// for the data it is of, and only that data.
+func TestOpenSSLToken(t *testing.T) {
+	der, _ := base64.StdEncoding.DecodeString(OpenSSLToken)
+	token, err := tsp.ParseToken(der)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing token: %s", err.Error())
+	}
+	if (token.Hash != crypto.SHA256) || (token.SerialNumber.Int64() != 2) || !token.Policy.Equal(asn1.ObjectIdentifier{1, 2, 3, 4, 1}) || (token.GenTime.Unix() != 1792357445) {
+		t.Errorf("Token has hash %v, serial number %s, policy %s and time %s.", token.Hash, token.SerialNumber, token.Policy, token.GenTime)
+	}
+	cert, err := token.Certificate()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if expected, _ := pki.ParsePEM([]byte(OpenSSLCertificate)); !cert.Equal(expected) {
+		t.Errorf("Token should embed the TSA certificate. Got %s instead.", cert.Subject.String())
+	}
+	if err := token.Verify([]byte("Hello, World!")); err != nil {
+		t.Errorf("Token should verify. Got %s instead.", err.Error())
+	}
+	if err := token.Verify([]byte("Goodbye, World!")); (err == nil) || (err.Error() != "Time-stamp token is of another digest") {
+		t.Errorf("Token should not verify for other data. Got %v instead.", err)
+	}
+}
+
+// TestAuthority verifies that an Authority grants requests with tokens that
+// verify, and otherwise rejects them with the failure information of RFC
+// 3161.
+func TestAuthority(t *testing.T) {
+	now := time.Unix(1567339200, 0).UTC()
+	authority := newAuthority(t, now, x509.ExtKeyUsageTimeStamping)
+	nonce := big.NewInt(42)
+	for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		t.Run(fmt.Sprintf("Subtest: %s", hash), func(tt *testing.T) {
+			request, err := tsp.NewRequest(hash, []byte("signature"), nonce)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			response, err := authority.Respond(request)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			der, err := tsp.ParseResponse(response)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			token, err := tsp.ParseToken(der)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if (token.Hash != hash) || (token.Nonce.Cmp(nonce) != 0) || !token.GenTime.Equal(now) || !token.Policy.Equal(tsp.DefaultPolicy) {
+				tt.Errorf("Token has hash %v, nonce %s, time %s and policy %s.", token.Hash, token.Nonce, token.GenTime, token.Policy)
+			}
+			if err := token.Verify([]byte("signature")); err != nil {
+				tt.Errorf("Token should verify. Got %s instead.", err.Error())
+			}
+		})
+	}
+	for desc, tc := range map[string]struct {
+		request []byte
+		err     string
+	}{
+		"Not a request": {
+			request: []byte("Hello, World!"),
+			err:     "TSA did not grant the time-stamp request, with status rejection: Request is not a valid time-stamp request (badDataFormat)",
+		},
+		"Short digest": {
+			request: mustMarshal(t, 1, []byte("short")),
+			err:     "TSA did not grant the time-stamp request, with status rejection: Request digest is 5 bytes long, but sha256 digests are 32 bytes long (badDataFormat)",
+		},
+		"Wrong version": {
+			request: mustMarshal(t, 2, make([]byte, 32)),
+			err:     "TSA did not grant the time-stamp request, with status rejection: Request has version 2, but 1 was expected (badRequest)",
+		},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			response, err := authority.Respond(tc.request)
+			if err != nil {
+				tt.Fatalf("Unexpected error: %s", err.Error())
+			}
+			if _, err := tsp.ParseResponse(response); (err == nil) || (err.Error() != tc.err) {
+				tt.Errorf("Response should be rejected with %#v. Got %v instead.", tc.err, err)
+			}
+		})
+	}
+	other := newAuthority(t, now, x509.ExtKeyUsageCodeSigning)
+	request, _ := tsp.NewRequest(crypto.SHA256, []byte("signature"), nonce)
+	response, _ := other.Respond(request)
+	der, _ := tsp.ParseResponse(response)
+	token, _ := tsp.ParseToken(der)
+	if err := token.Verify([]byte("signature")); (err == nil) || (err.Error() != "Certificate of CN=Test TSA is not a TSA certificate, which must have a critical extended key usage of timeStamping alone") {
+		t.Errorf("Token of a certificate without timeStamping should not verify. Got %v instead.", err)
+	}
+}
+
+// mustMarshal returns a request of version with a SHA-256 message imprint of
+// digest, which need not be the length of one.
+func mustMarshal(t *testing.T, version int, digest []byte) []byte {
+	sha256, _ := asn1.Marshal(asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1})
+	der, err := asn1.Marshal(struct {
+		Version        int
+		MessageImprint struct {
+			HashAlgorithm struct{ Algorithm asn1.RawValue }
+			HashedMessage []byte
+		}
+	}{
+		Version: version,
+		MessageImprint: struct {
+			HashAlgorithm struct{ Algorithm asn1.RawValue }
+			HashedMessage []byte
+		}{
+			HashAlgorithm: struct{ Algorithm asn1.RawValue }{Algorithm: asn1.RawValue{FullBytes: sha256}},
+			HashedMessage: digest,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return der
+}
+
+// TestServeHTTP verifies that an Authority only answers time-stamp requests
+// POSTed with their media type.
+func TestServeHTTP(t *testing.T) {
+	authority := newAuthority(t, time.Unix(1567339200, 0), x509.ExtKeyUsageTimeStamping)
+	request, _ := tsp.NewRequest(crypto.SHA256, []byte("signature"), nil)
+	for desc, tc := range map[string]struct {
+		method      string
+		contentType string
+		status      int
+	}{
+		"Time-stamp request": {method: http.MethodPost, contentType: tsp.RequestContentType, status: http.StatusOK},
+		"GET":                {method: http.MethodGet, contentType: tsp.RequestContentType, status: http.StatusMethodNotAllowed},
+		"Wrong media type":   {method: http.MethodPost, contentType: "application/octet-stream", status: http.StatusUnsupportedMediaType},
+	} {
+		t.Run(fmt.Sprintf("Subtest: %s", desc), func(tt *testing.T) {
+			httpRequest := httptest.NewRequest(tc.method, "http://localhost:3161/", strings.NewReader(string(request)))
+			httpRequest.Header.Set("Content-Type", tc.contentType)
+			recorder := httptest.NewRecorder()
+			authority.ServeHTTP(recorder, httpRequest)
+			if recorder.Code != tc.status {
+				tt.Errorf("Response should have status %d. Got %d instead.", tc.status, recorder.Code)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != tsp.ResponseContentType {
+				tt.Errorf("Response should have media type %s. Got %s instead.", tsp.ResponseContentType, contentType)
+			}
+			if _, err := tsp.ParseResponse(recorder.Body.Bytes()); err != nil {
+				tt.Errorf("Unexpected error: %s", err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package codechallenge
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/smartedge/codechallenge/crypt"
+	"github.com/smartedge/codechallenge/deps"
+	"github.com/smartedge/codechallenge/pki"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// VerdictReason explains the outcome of verifying a signed message.
+type VerdictReason int
+
+// Verification outcomes
+const (
+	SignatureValid VerdictReason = iota
+	BadSignature
+	ContentMismatch
+	InvalidClaims
+	Untrusted
+	BadTimestamp
+	Expired
+	NotYetValid
+	Replayed
+	InsufficientSignatures
+)
+
+// verdictReasons holds the name and exit status of each VerdictReason.
+var verdictReasons = map[VerdictReason]struct {
+	name       string
+	exitStatus int
+}{
+	SignatureValid:         {name: "valid", exitStatus: 0},
+	BadSignature:           {name: "bad signature", exitStatus: 9},
+	ContentMismatch:        {name: "signed content mismatch", exitStatus: 10},
+	InvalidClaims:          {name: "invalid claims", exitStatus: 11},
+	Untrusted:              {name: "untrusted certificate", exitStatus: 12},
+	BadTimestamp:           {name: "invalid timestamp", exitStatus: 13},
+	Expired:                {name: "expired signature", exitStatus: 14},
+	NotYetValid:            {name: "signature not yet valid", exitStatus: 15},
+	Replayed:               {name: "replayed signature", exitStatus: 16},
+	InsufficientSignatures: {name: "insufficient signatures", exitStatus: 17},
+}
+
+// String returns the name of the verdict reason.
+func (vr VerdictReason) String() string {
+	reason, ok := verdictReasons[vr]
+	if !ok {
+		return fmt.Sprintf("Unknown VerdictReason %#v (INTERNAL ERROR)", int(vr))
+	}
+	return reason.name
+}
+
+// ExitStatus returns the status the program exits with for this verdict.
+// Each reason a signature can be rejected has its own exit status.
+func (vr VerdictReason) ExitStatus() int {
+	reason, ok := verdictReasons[vr]
+	if !ok {
+		return 1
+	}
+	return reason.exitStatus
+}
+
+// Verdict is the outcome of verifying a signed message, to be rendered to
+// JSON. The signing time of a version 2 envelope, and the time of an RFC 3161
+// time-stamp token of the signature and the TSA that issued it, are only
+// included if the signed message is valid and has them.
+type Verdict struct {
+	Valid      bool   `json:"valid"`
+	Reason     string `json:"reason"`
+	Detail     string `json:"detail,omitempty"`
+	SignedAt   string `json:"signed_at,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"`
+	TSA        string `json:"tsa,omitempty"`
+	reasonCode VerdictReason
+}
+
+// NewVerdict returns the Verdict for reason, with optional detail explaining
+// it.
+func NewVerdict(reason VerdictReason, detail string) *Verdict {
+	return &Verdict{
+		Valid:      reason == SignatureValid,
+		Reason:     reason.String(),
+		Detail:     detail,
+		reasonCode: reason,
+	}
+}
+
+// ExitStatus returns the status the program exits with for this verdict.
+func (v *Verdict) ExitStatus() int {
+	return v.reasonCode.ExitStatus()
+}
+
+// VerifyMain is the entry-point for -verify mode. It reads a signed message
+// in JSON format from d.Os.Stdin, and writes the verdict in JSON format to
+// d.Os.Stdout, exiting with the verdict's exit status if it isn't valid. Any
+// time-stamp token of the signature must be valid. Given a trust store, the
+// public key must be a certificate trusted by it, and otherwise it must be the
+// public key file in config. With replay checking, the signature must not have
+// been verified before. Multi-signature documents are verified by
+// VerifyMultiSigMain instead, and signed manifests are rejected, as only
+// verify-manifest can check them.
+func VerifyMain(d *deps.Dependencies, config *RunConfig) {
+	doc, err := InjestSignedMessage(d.Os.Stdin)
+	if err != nil {
+		HandleError(d, err, 2)
+	}
+	if len(doc.Signatures) != 0 {
+		VerifyMultiSigMain(d, config, doc)
+		return
+	}
+	if doc.Manifest {
+		// A manifest is only valid against the directory it lists:
+		verdict := NewVerdict(ContentMismatch, "signed message is a manifest, which requires verify-manifest")
+		err = WriteJSON(d, verdict)
+		if err != nil {
+			HandleError(d, err, 8)
+		}
+		d.Os.Exit(verdict.ExitStatus())
+		return
+	}
+	verdict, err := VerifySignedMessageDocument(d, config, doc)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	verdict, timestampTime, err := CheckSignedMessageTimestamp(d, config, doc, verdict)
+	if err != nil {
+		HandleError(d, err, 3)
+	}
+	var trustVerdict *TrustVerdict
+	if config.Trust.StorePath != "" {
+		trustVerdict, err = CheckSignedMessageTrust(d, config, doc, verdict, timestampTime)
+		if err != nil {
+			HandleError(d, err, 3)
+		}
+		verdict = trustVerdict.Verdict
+	} else {
+		verdict, err = CheckSignedMessageKey(d, config, doc, verdict)
+		if err != nil {
+			HandleError(d, err, 3)
+		}
+	}
+	if config.State.ReplayCheck {
+		verdict, err = CheckReplay(d, config, doc, verdict)
+		if err != nil {
+			HandleError(d, err, 3)
+		}
+	}
+	var report interface{} = verdict
+	if trustVerdict != nil {
+		trustVerdict.Verdict = verdict
+		report = trustVerdict
+	}
+	err = WriteJSON(d, report)
+	if err != nil {
+		HandleError(d, err, 8)
+	}
+	if !verdict.Valid {
+		d.Os.Exit(verdict.ExitStatus())
+	}
+}
+
+// InjestSignedMessage reads a signed message in JSON format from dataSource.
+func InjestSignedMessage(dataSource io.Reader) (*SignedMessage, error) {
+	buff, err := ioutil.ReadAll(dataSource)
+	if err != nil {
+		return nil, err
+	}
+	doc := SignedMessage{}
+	if err := json.Unmarshal(buff, &doc); err != nil {
+		return nil, fmt.Errorf("Input is not a valid signed message: %s", err.Error())
+	}
+	return &doc, nil
+}
+
+// VerifySignedMessageDocument checks the signature of doc against the public
+// key it contains, which is of the envelope of doc for version 2, whose
+// validity period must include the current time. Malformed documents are
+// reported as errors, while signatures that don't match are reported in the
+// returned verdict.
+func VerifySignedMessageDocument(d *deps.Dependencies, config *RunConfig, doc *SignedMessage) (*Verdict, error) {
+	if (doc.Version != 0) && (EnvelopeVersion(doc.Version) != EnvelopeV1) && (EnvelopeVersion(doc.Version) != EnvelopeV2) {
+		return nil, fmt.Errorf("Unsupported signed message version %d: expected 1 or 2", doc.Version)
+	}
+	if doc.Digest && !config.DigestMode {
+		return NewVerdict(ContentMismatch, "message is a pre-computed digest, which requires -digest"), nil
+	}
+	if !doc.Digest && config.DigestMode {
+		return NewVerdict(ContentMismatch, "message is not a pre-computed digest, but -digest was given"), nil
+	}
+	settings := config.PubKeySettings
+	hash, err := SignedMessageHash(doc)
+	if err != nil {
+		return nil, err
+	}
+	settings.Hash = hash
+	x509PubKey, err := crypt.NewPEMBufferFromString(doc.Pubkey).DecodeToX509()
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := x509PubKey.PublicKeyAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	settings.Algorithm = algorithm
+	if _, err := crypt.NewBinarySignatureFromBase64(doc.Signature); err != nil {
+		return nil, err
+	}
+	var digest crypt.DigestHash
+	if EnvelopeVersion(doc.Version) == EnvelopeV2 {
+		publicKey, err := x509PubKey.AsGenericPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		var verdict *Verdict
+		digest, verdict, err = OpenEnvelope(doc, publicKey, algorithm, settings.Hash)
+		if (err != nil) || (verdict != nil) {
+			return verdict, err
+		}
+	} else if doc.Digest {
+		digest, err = crypt.NewDigestHashFromString(doc.Message, settings.Hash)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		digest = crypt.NewDigestHash(settings.Hash, doc.Message)
+	}
+	tooling, err := crypt.GetCryptoTooling(d, &settings)
+	if err != nil {
+		return nil, err
+	}
+	verdict := newVerdictFromVerification(tooling.VerifySignedDigest(digest, doc.Signature, doc.Pubkey))
+	if verdict.Valid && (EnvelopeVersion(doc.Version) == EnvelopeV2) {
+		if periodVerdict := CheckValidityPeriod(d.Time.Now(), config.Validity.Leeway, doc); periodVerdict != nil {
+			return periodVerdict, nil
+		}
+		verdict.SignedAt = doc.SignedAt
+	}
+	return verdict, nil
+}
+
+// CheckSignedMessageTimestamp checks the time-stamp token of the signature of
+// doc, if it has one, given the verdict on the signature.
+func CheckSignedMessageTimestamp(d *deps.Dependencies, config *RunConfig, doc *SignedMessage, verdict *Verdict) (*Verdict, time.Time, error) {
+	if doc.Timestamp == "" {
+		return verdict, time.Time{}, nil
+	}
+	token, err := base64.StdEncoding.DecodeString(doc.Timestamp)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("Time-stamp token of the signed message is not valid base64: %s", err.Error())
+	}
+	signature, err := crypt.NewBinarySignatureFromBase64(doc.Signature)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return CheckTimestamp(d, config, verdict, token, signature)
+}
+
+// CheckSignedMessageTrust validates the certificate that is the public key of
+// doc, followed by any intermediates of its chain, against the trust store in
+// config, given the verdict on its signature and the time of its time-stamp
+// token, if any.
+func CheckSignedMessageTrust(d *deps.Dependencies, config *RunConfig, doc *SignedMessage, verdict *Verdict, timestampTime time.Time) (*TrustVerdict, error) {
+	certs, err := pki.ParsePEMChain([]byte(doc.Pubkey))
+	if err != nil {
+		if verdict.Valid {
+			verdict = NewVerdict(Untrusted, "Public key of the signed message is not a certificate")
+		}
+		return CheckTrust(d, config, verdict, nil, nil, time.Time{}, timestampTime)
+	}
+	// Signed messages in JSON format have no signing time:
+	return CheckTrust(d, config, verdict, certs[0], certs[1:], time.Time{}, timestampTime)
+}
+
+// SignedMessageHash returns the hash function the message in doc was digested
+// with.
+func SignedMessageHash(doc *SignedMessage) (crypto.Hash, error) {
+	if doc.Hash == "" {
+		return crypto.SHA256, nil
+	}
+	return crypt.ParseHashName(doc.Hash)
+}
+
+// newVerdictFromVerification returns the Verdict for the result of verifying
+// a signature, where any error explains why the signature was rejected.
+func newVerdictFromVerification(valid bool, err error) *Verdict {
+	if err != nil {
+		return NewVerdict(BadSignature, err.Error())
+	}
+	if !valid {
+		return NewVerdict(BadSignature, "")
+	}
+	return NewVerdict(SignatureValid, "")
+}
+
+// CheckSignedMessageKey checks that the public key of doc, or the key of its
+// certificate, is the public key file in config, given the verdict on its
+// signature. Otherwise a signed message would be valid whatever key signed it,
+// as it names that key itself.
+func CheckSignedMessageKey(d *deps.Dependencies, config *RunConfig, doc *SignedMessage, verdict *Verdict) (*Verdict, error) {
+	if !verdict.Valid {
+		return verdict, nil
+	}
+	_, x509PubKey, err := crypt.LoadAndDecodeKey(d, config.PubKeySettings.PublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509PubKey.AsGenericPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	x509DocPubKey, err := crypt.NewPEMBufferFromString(doc.Pubkey).DecodeToX509()
+	if err != nil {
+		return nil, err
+	}
+	docPublicKey, err := x509DocPubKey.AsGenericPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !crypt.PublicKeysEqual(docPublicKey, publicKey) {
+		return NewVerdict(BadSignature, fmt.Sprintf("Signed message is not signed by the public key in %s", config.PubKeySettings.PublicKeyPath)), nil
+	}
+	return verdict, nil
+}